@@ -1,3 +1,11 @@
 #!/usr/bin/env bash
 printf 'DUMMY RUNNER: %s\n' "$@"
+# the TUI passes the manifest's entry and interpreter; the working directory and the
+# agent's env vars are already set, so nothing here is specific to one agent
+if [[ -n "${AGENT_ENTRY:-}" && " $* " == *" --exec "* ]]; then
+  if [[ -n "${AGENT_INTERPRETER:-}" ]]; then
+    exec $AGENT_INTERPRETER "$AGENT_ENTRY"
+  fi
+  exec "$AGENT_ENTRY"
+fi
 exit 0
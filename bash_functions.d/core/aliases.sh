@@ -23,6 +23,7 @@ alias bwunlock='bw unlock --raw'
 
 # TUI launcher
 alias go-term='~/bash_functions.d/tui/go-term/term || true'
+alias cbw='~/bash_functions.d/tui/go-term/term'
 
 # Misc
 alias ll='ls -la'
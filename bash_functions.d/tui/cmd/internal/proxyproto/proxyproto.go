@@ -0,0 +1,164 @@
+// Package proxyproto reads the PROXY protocol header (v1 text or v2 binary) that
+// HAProxy and cloud load balancers put in front of a forwarded TCP connection, so
+// the SSH servers see the real client address instead of the balancer's.
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// v2Sig starts every v2 header
+var v2Sig = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// Listener wraps a listener; connections from Trusted peers (and over a unix
+// socket) must start with a header, anyone else is passed through untouched so
+// they cannot spoof an address.
+type Listener struct {
+	net.Listener
+	Trusted []*net.IPNet
+	Timeout time.Duration // how long to wait for the header; 0 means 5s
+}
+
+// ParseCIDRs reads a comma separated list of networks; a bare address is a /32 or /128
+func ParseCIDRs(s string) ([]*net.IPNet, error) {
+	var out []*net.IPNet
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" { continue }
+		if !strings.Contains(f, "/") {
+			ip := net.ParseIP(f)
+			if ip == nil { return nil, fmt.Errorf("bad address %q", f) }
+			bits := 128
+			if ip.To4() != nil { bits = 32 }
+			f = fmt.Sprintf("%s/%d", f, bits)
+		}
+		_, n, err := net.ParseCIDR(f)
+		if err != nil { return nil, err }
+		out = append(out, n)
+	}
+	return out, nil
+}
+
+// trusted is true for the listed networks and for unix socket peers, whom the
+// socket's permissions already vouch for
+func (l *Listener) trusted(a net.Addr) bool {
+	switch a := a.(type) {
+	case *net.UnixAddr:
+		return true
+	case *net.TCPAddr:
+		for _, n := range l.Trusted {
+			if n.Contains(a.IP) { return true }
+		}
+	}
+	return false
+}
+
+// Accept returns at once; the header is read on the connection's first Read or
+// RemoteAddr, in the goroutine that serves it, so a slow peer blocks nobody else
+func (l *Listener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil || !l.trusted(c.RemoteAddr()) { return c, err }
+	timeout := l.Timeout
+	if timeout == 0 { timeout = 5 * time.Second }
+	return &Conn{Conn: c, br: bufio.NewReader(c), timeout: timeout}, nil
+}
+
+// Conn is a connection whose remote address comes from its PROXY header
+type Conn struct {
+	net.Conn
+	br      *bufio.Reader
+	timeout time.Duration
+	once    sync.Once
+	remote  net.Addr
+	err     error
+}
+
+func (c *Conn) init() {
+	c.once.Do(func() {
+		c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+		c.remote, c.err = readHeader(c.br)
+		c.Conn.SetReadDeadline(time.Time{})
+		if c.err != nil { c.err = fmt.Errorf("proxy protocol from %s: %w", c.Conn.RemoteAddr(), c.err) }
+	})
+}
+
+func (c *Conn) Read(p []byte) (int, error) {
+	c.init()
+	if c.err != nil { return 0, c.err }
+	return c.br.Read(p)
+}
+
+// RemoteAddr is the client the header names; the peer itself for a LOCAL or
+// UNKNOWN header, or when the header is bad (Read then fails)
+func (c *Conn) RemoteAddr() net.Addr {
+	c.init()
+	if c.remote == nil { return c.Conn.RemoteAddr() }
+	return c.remote
+}
+
+// readHeader reads one v1 or v2 header; a nil address means keep the peer's
+func readHeader(br *bufio.Reader) (net.Addr, error) {
+	peek, err := br.Peek(5)
+	if err != nil { return nil, err }
+	if string(peek) == "PROXY" { return readV1(br) }
+	if !bytes.HasPrefix(v2Sig, peek) { return nil, errors.New("no PROXY header") }
+	peek, err = br.Peek(len(v2Sig))
+	if err != nil { return nil, err }
+	if bytes.Equal(peek, v2Sig) { return readV2(br) }
+	return nil, errors.New("no PROXY header")
+}
+
+// readV1 parses "PROXY TCP4|TCP6|UNKNOWN src dst sport dport\r\n"
+func readV1(br *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for len(line) < 107 {
+		b, err := br.ReadByte()
+		if err != nil { return nil, err }
+		line = append(line, b)
+		if b == '\n' { break }
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) { return nil, errors.New("v1 header too long or not terminated") }
+	f := strings.Fields(string(line))
+	if len(f) >= 2 && f[1] == "UNKNOWN" { return nil, nil }
+	if len(f) != 6 || f[1] != "TCP4" && f[1] != "TCP6" { return nil, fmt.Errorf("bad v1 header %q", strings.TrimSpace(string(line))) }
+	ip := net.ParseIP(f[2])
+	port, err := strconv.Atoi(f[4])
+	if ip == nil || err != nil || port < 0 || port > 65535 { return nil, fmt.Errorf("bad v1 source %s:%s", f[2], f[4]) }
+	return &net.TCPAddr{IP: ip, Port: port}, nil
+}
+
+// readV2 parses the binary header: signature, version/command, family, length,
+// addresses, then TLVs, which are skipped
+func readV2(br *bufio.Reader) (net.Addr, error) {
+	hdr := make([]byte, 16)
+	if _, err := io.ReadFull(br, hdr); err != nil { return nil, err }
+	if hdr[12]>>4 != 2 { return nil, fmt.Errorf("v2 header with version %d", hdr[12]>>4) }
+	body := make([]byte, binary.BigEndian.Uint16(hdr[14:16]))
+	if _, err := io.ReadFull(br, body); err != nil { return nil, err }
+	switch cmd := hdr[12] & 0xf; cmd {
+	case 0: // LOCAL: a health check from the balancer itself
+		return nil, nil
+	case 1: // PROXY
+	default:
+		return nil, fmt.Errorf("v2 header with command %d", cmd)
+	}
+	switch hdr[13] {
+	case 0x11, 0x12: // TCP or UDP over IPv4
+		if len(body) < 12 { return nil, errors.New("short v2 IPv4 addresses") }
+		return &net.TCPAddr{IP: net.IP(append([]byte(nil), body[0:4]...)), Port: int(binary.BigEndian.Uint16(body[8:10]))}, nil
+	case 0x21, 0x22: // over IPv6
+		if len(body) < 36 { return nil, errors.New("short v2 IPv6 addresses") }
+		return &net.TCPAddr{IP: net.IP(append([]byte(nil), body[0:16]...)), Port: int(binary.BigEndian.Uint16(body[32:34]))}, nil
+	}
+	return nil, nil // unix or unspecified: keep the peer address
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// setupLogging sends slog (and the standard log package) to file, or stderr when
+// file is empty, at the given level and in text or json format
+func setupLogging(level, format, file string) error {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil { return err }
+	var w io.Writer = os.Stderr
+	if file != "" {
+		f, err := os.OpenFile(file, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0o600)
+		if err != nil { return err }
+		w = f
+	}
+	opts := &slog.HandlerOptions{Level: l}
+	var h slog.Handler = slog.NewTextHandler(w, opts)
+	if strings.EqualFold(format, "json") { h = slog.NewJSONHandler(w, opts) }
+	slog.SetDefault(slog.New(h).With("service", "sshserver"))
+	return nil
+}
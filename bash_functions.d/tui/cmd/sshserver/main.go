@@ -9,14 +9,16 @@ import (
 	"flag"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net"
 	"os"
 	"os/exec"
-	"time"
 
 	"golang.org/x/crypto/ssh"
 	"github.com/creack/pty"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/cbwinslow/go-term/cmd/internal/proxyproto"
 )
 
 func generateSigner() (ssh.Signer, error) {
@@ -34,10 +36,12 @@ func handleConn(nConn net.Conn, config *ssh.ServerConfig) {
 	defer nConn.Close()
 	sshConn, chans, reqs, err := ssh.NewServerConn(nConn, config)
 	if err != nil {
-		log.Printf("Failed to handshake: %v", err)
+		slog.Warn("handshake failed", "remote", nConn.RemoteAddr().String(), "err", err)
 		return
 	}
-	log.Printf("New SSH connection from %s (%s)", sshConn.RemoteAddr(), sshConn.ClientVersion())
+	slog.Info("ssh connection", "remote", sshConn.RemoteAddr().String(), "user", sshConn.User(), "client", string(sshConn.ClientVersion()))
+	ctx, span := startSpan(context.Background(), "ssh.connection", attribute.String("remote", sshConn.RemoteAddr().String()), attribute.String("user", sshConn.User()), attribute.String("client", string(sshConn.ClientVersion())))
+	defer span.End()
 	// Discard global requests
 	go ssh.DiscardRequests(reqs)
 	// Handle channels
@@ -48,17 +52,24 @@ func handleConn(nConn net.Conn, config *ssh.ServerConfig) {
 		}
 		channel, requests, err := newChannel.Accept()
 		if err != nil {
-			log.Printf("Could not accept channel: %v", err)
+			slog.Warn("could not accept channel", "err", err)
 			continue
 		}
 		// Start the TUI in a pty
+		sctx, sspan := startSpan(ctx, "ssh.session")
 		cmd := exec.Command("/bin/sh", "-c", "./term")
+		cmd.Env = append(os.Environ(), traceEnv(sctx)...)
 		ptmx, err := pty.Start(cmd)
 		if err != nil {
-			log.Printf("pty start error: %v", err)
+			slog.Error("pty start failed", "err", err)
+			sspan.End()
 			channel.Close()
 			continue
 		}
+		go func() {
+			cmd.Wait()
+			sspan.End()
+		}()
 		// copy I/O
 		go func() {
 			io.Copy(channel, ptmx)
@@ -85,10 +96,18 @@ func handleConn(nConn net.Conn, config *ssh.ServerConfig) {
 
 func main() {
 	port := flag.Int("port", 8022, "ssh listen port")
+	traceFlag := flag.Bool("trace", false, "export OpenTelemetry spans over OTLP (endpoint from OTEL_EXPORTER_OTLP_ENDPOINT)")
+	logLevel := flag.String("log-level", "info", "log level: debug, info, warn or error")
+	logFormat := flag.String("log-format", "text", "log format: text or json")
+	logFile := flag.String("log-file", "", "append logs to this file instead of stderr")
+	proxyProto := flag.Bool("proxy-protocol", false, "read a PROXY protocol v1/v2 header from connections of --proxy-trust peers")
+	proxyTrust := flag.String("proxy-trust", "127.0.0.1,::1", "comma separated addresses or CIDRs of the load balancers that send PROXY headers")
 	flag.Parse()
+	if err := setupLogging(*logLevel, *logFormat, *logFile); err != nil { fmt.Fprintln(os.Stderr, err); os.Exit(2) }
+	if *traceFlag { defer setupTracing()() }
 
 	signer, err := generateSigner()
-	if err != nil { log.Fatalf("generate signer: %v", err) }
+	if err != nil { slog.Error("generate signer failed", "err", err); os.Exit(1) }
 
 	config := &ssh.ServerConfig{
 		NoClientAuth: true,
@@ -96,12 +115,18 @@ func main() {
 	config.AddHostKey(signer)
 
 	ln, err := net.Listen("tcp", fmt.Sprintf("0.0.0.0:%d", *port))
-	if err != nil { log.Fatalf("listen: %v", err) }
+	if err != nil { slog.Error("listen failed", "err", err); os.Exit(1) }
 	defer ln.Close()
-	log.Printf("SSH server listening on %d", *port)
+	if *proxyProto {
+		trusted, err := proxyproto.ParseCIDRs(*proxyTrust)
+		if err != nil { slog.Error("bad --proxy-trust", "err", err); os.Exit(2) }
+		ln = &proxyproto.Listener{Listener: ln, Trusted: trusted}
+		slog.Info("PROXY protocol enabled", "trusted", *proxyTrust)
+	}
+	slog.Info("ssh server listening", "port", *port)
 	for {
 		nConn, err := ln.Accept()
-		if err != nil { log.Printf("accept: %v", err); continue }
+		if err != nil { slog.Warn("accept failed", "err", err); continue }
 		go handleConn(nConn, config)
 	}
 }
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// setupTracing exports spans over OTLP/HTTP to the endpoint in the standard
+// OTEL_EXPORTER_OTLP_* variables; the returned function flushes pending spans
+func setupTracing() func() {
+	exp, err := otlptracehttp.New(context.Background())
+	if err != nil { slog.Warn("tracing disabled", "err", err); return func() {} }
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exp), sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", "cbw-sshserver"))))
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		tp.Shutdown(ctx)
+	}
+}
+
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer("github.com/cbwinslow/go-term/sshserver").Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// traceEnv passes ctx to the TUI so its session span joins the connection's trace
+func traceEnv(ctx context.Context) []string {
+	c := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, c)
+	if v := c.Get("traceparent"); v != "" { return []string{"TRACEPARENT=" + v} }
+	return nil
+}
@@ -0,0 +1,431 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"golang.org/x/crypto/ssh"
+)
+
+// allowlistPath is the wish-server allowlist that the Admin tab edits and the broker reads
+func allowlistPath() string {
+	if p := loadConfig().Allowlist; p != "" { return expandHome(p) }
+	return filepath.Join(tuiDataDir(), "wish_allowlist.json")
+}
+
+// lastLoginPath is where wish-server records each user's last login, next to the allowlist
+func lastLoginPath(allowPath string) string { return filepath.Join(filepath.Dir(allowPath), "last_login.json") }
+
+func allowlistBackupDir(allowPath string) string { return filepath.Join(filepath.Dir(allowPath), "allowlist-backups") }
+
+// allowlistBackups is how many previous allowlists are kept
+const allowlistBackups = 20
+
+// loadLastLogins reads user -> RFC 3339 time of the last login
+func loadLastLogins(allowPath string) map[string]string {
+	logins := map[string]string{}
+	if b, err := ioutil.ReadFile(lastLoginPath(allowPath)); err == nil { _ = json.Unmarshal(b, &logins) }
+	return logins
+}
+
+// keyFingerprint is the SHA256 fingerprint of an authorized_keys line, as ssh-keygen -l prints it
+func keyFingerprint(pubkey string) (string, error) {
+	k, _, _, _, err := ssh.ParseAuthorizedKey([]byte(pubkey))
+	if err != nil { return "", err }
+	return ssh.FingerprintSHA256(k), nil
+}
+
+var allowUserRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// validateAllowlist checks every entry: a valid user name, used once, and a public key
+// that parses and belongs to no other entry
+func validateAllowlist(entries []allowEntry) error {
+	seen, owners := map[string]bool{}, map[string]string{}
+	for _, e := range entries {
+		if !allowUserRe.MatchString(e.User) { return fmt.Errorf("bad user name %q", e.User) }
+		if seen[e.User] { return fmt.Errorf("user %s is listed twice", e.User) }
+		seen[e.User] = true
+		fp, err := keyFingerprint(e.PubKey)
+		if err != nil { return fmt.Errorf("%s: public key: %v", e.User, err) }
+		if u, ok := owners[fp]; ok { return fmt.Errorf("%s: key %s is already the key of %s", e.User, fp, u) }
+		owners[fp] = e.User
+		for _, a := range e.AllowedExec {
+			if a == "" || strings.ContainsAny(a, " ,\t") { return fmt.Errorf("%s: bad agent name %q in allowed_exec", e.User, a) }
+		}
+	}
+	return nil
+}
+
+// editAllowlist applies fn to the allowlist under the allowlist lock and writes the
+// result. before is the file the change was previewed against; if another admin
+// changed it since, nothing is written. The previous file is kept in
+// allowlist-backups/ before the new one replaces it.
+func editAllowlist(path string, before []byte, fn func([]allowEntry) ([]allowEntry, error)) error {
+	if !isAdmin() { return errors.New(T("Admin privileges required")) }
+	if readOnlySession() { return errReadOnly }
+	return withLock("allowlist", func() error {
+		b, err := ioutil.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) { return err }
+		if !bytes.Equal(b, before) { return errors.New(T("the allowlist changed since the preview; review the change again")) }
+		_, next, err := applyAllowlist(path, b, fn)
+		if err != nil { return err }
+		if err := backupAllowlist(path); err != nil { return fmt.Errorf("backup: %w", err) }
+		tmp := path + ".tmp"
+		if err := ioutil.WriteFile(tmp, next, 0o600); err != nil { return err }
+		return os.Rename(tmp, path)
+	})
+}
+
+// applyAllowlist runs fn on the allowlist in b and validates the result; both lists
+// are returned as the JSON that is written
+func applyAllowlist(path string, b []byte, fn func([]allowEntry) ([]allowEntry, error)) (cur, next []byte, err error) {
+	var entries []allowEntry
+	if len(bytes.TrimSpace(b)) > 0 {
+		if err := json.Unmarshal(b, &entries); err != nil { return nil, nil, fmt.Errorf("%s: %w", path, err) }
+	}
+	after, err := fn(append([]allowEntry{}, entries...))
+	if err != nil { return nil, nil, err }
+	if err := validateAllowlist(after); err != nil { return nil, nil, err }
+	if cur, err = json.MarshalIndent(entries, "", "  "); err != nil { return nil, nil, err }
+	if next, err = json.MarshalIndent(after, "", "  "); err != nil { return nil, nil, err }
+	return append(cur, '\n'), append(next, '\n'), nil
+}
+
+// backupAllowlist copies the current allowlist into the backup directory and drops
+// the oldest backups beyond allowlistBackups
+func backupAllowlist(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) { return nil }
+	if err != nil { return err }
+	dir := allowlistBackupDir(path)
+	if err := os.MkdirAll(dir, 0o700); err != nil { return err }
+	name := strings.TrimSuffix(filepath.Base(path), ".json") + "-" + time.Now().UTC().Format("20060102T150405.000") + ".json"
+	if err := ioutil.WriteFile(filepath.Join(dir, name), b, 0o600); err != nil { return err }
+	fis, _ := ioutil.ReadDir(dir)
+	sort.Slice(fis, func(i, j int) bool { return fis[i].Name() < fis[j].Name() })
+	for i := 0; i < len(fis)-allowlistBackups; i++ { os.Remove(filepath.Join(dir, fis[i].Name())) }
+	return nil
+}
+
+// adminItem is one allowlist entry in the Admin tab
+type adminItem struct {
+	e    allowEntry
+	fp   string // key fingerprint, or why the key does not parse
+	last string // last login, "" if never seen
+	req  *pendingEntry // set for a key submitted with an invite, not yet in the allowlist
+}
+
+func (i adminItem) Title() string {
+	if i.req != nil { return i.e.User + " " + T("(pending)") }
+	t := i.e.User
+	if i.e.IsAdmin { t += " " + T("(admin)") }
+	if i.e.ReadOnly { t += " " + T("(read-only)") }
+	return t
+}
+
+func (i adminItem) Description() string {
+	parts := []string{i.fp}
+	if i.req != nil { return strings.Join(append(parts, T("requested %s from %s", i.req.Requested.Local().Format("2006-01-02 15:04"), i.req.Remote)), " · ") }
+	if len(i.e.AllowedExec) > 0 { parts = append(parts, T("exec: %s", strings.Join(i.e.AllowedExec, ", "))) }
+	if len(i.e.Roles) > 0 { parts = append(parts, T("roles: %s", strings.Join(i.e.Roles, ", "))) }
+	last := T("never logged in")
+	if t, err := time.Parse(time.RFC3339, i.last); err == nil { last = T("last login %s", t.Local().Format("2006-01-02 15:04")) }
+	return strings.Join(append(parts, last), " · ")
+}
+
+func (i adminItem) FilterValue() string { return i.e.User + " " + strings.Join(i.e.Roles, " ") }
+
+func adminItems(path string) ([]list.Item, error) {
+	entries, err := loadAllowlist(path)
+	if err != nil && !os.IsNotExist(err) { return nil, err }
+	logins := loadLastLogins(path)
+	items := []list.Item{}
+	for _, e := range entries {
+		fp, err := keyFingerprint(e.PubKey)
+		if err != nil { fp = T("invalid key: %v", err) }
+		items = append(items, adminItem{e: e, fp: fp, last: logins[e.User]})
+	}
+	pend, err := loadPending(path)
+	if err != nil { return nil, err }
+	for i := range pend {
+		p := pend[i]
+		fp, err := keyFingerprint(p.PubKey)
+		if err != nil { fp = T("invalid key: %v", err) }
+		items = append(items, adminItem{e: allowEntry{User: p.User, PubKey: p.PubKey}, fp: fp, req: &p})
+	}
+	return items, nil
+}
+
+func newAdminList() list.Model {
+	l := list.New(nil, list.NewDefaultDelegate(), 80, 20)
+	l.Title = T("Allowlist")
+	l.SetShowHelp(false)
+	return l
+}
+
+// refreshAdmin rereads the allowlist and the last logins
+func (m *model) refreshAdmin() {
+	items, err := adminItems(m.allowPath)
+	if err != nil { m.status = T("cannot read %s: %v", m.allowPath, err); slog.Warn("allowlist unreadable", "path", m.allowPath, "err", err); return }
+	m.adminList.SetItems(items)
+	m.adminList.Title = T("Allowlist (%s)", m.allowPath)
+}
+
+// renderAdminEntry is the detail of one entry shown in the Preview
+func renderAdminEntry(i adminItem) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n\n", i.e.User)
+	fmt.Fprintf(&b, "  %-12s %s\n", T("fingerprint"), i.fp)
+	fmt.Fprintf(&b, "  %-12s %v\n", T("admin"), i.e.IsAdmin)
+	fmt.Fprintf(&b, "  %-12s %v\n", T("read-only"), i.e.ReadOnly)
+	fmt.Fprintf(&b, "  %-12s %s\n", T("exec"), strings.Join(i.e.AllowedExec, ", "))
+	fmt.Fprintf(&b, "  %-12s %s\n", T("roles"), strings.Join(i.e.Roles, ", "))
+	if i.req != nil {
+		fmt.Fprintf(&b, "  %-12s %s\n", T("requested"), i.req.Requested.Local().Format(time.RFC3339))
+		fmt.Fprintf(&b, "  %-12s %s\n", T("from"), i.req.Remote)
+		fmt.Fprintf(&b, "  %-12s %s\n", T("invite"), i.req.Invite[:min(12, len(i.req.Invite))])
+	} else {
+		last := i.last
+		if last == "" { last = T("never") }
+		fmt.Fprintf(&b, "  %-12s %s\n", T("last login"), last)
+	}
+	raw, _ := json.MarshalIndent(i.e, "", "  ")
+	b.WriteString("\n" + T("Raw JSON") + "\n\n" + string(raw) + "\n")
+	return b.String()
+}
+
+// adminForm adds or edits one allowlist entry: one input per field, tab moves
+// between them
+type adminForm struct {
+	fields []textinput.Model
+	focus  int
+	user   string            // entry being edited; "" when adding
+	owners map[string]string // key fingerprint -> user of the other entries
+	req    *pendingEntry     // the pending request being approved, if any
+}
+
+const (
+	adminFieldUser = iota
+	adminFieldKey
+	adminFieldExec
+	adminFieldRoles
+	adminFieldAdmin
+	adminFieldReadOnly
+)
+
+var adminFieldNames = []string{"user", "public key", "allowed exec", "roles", "admin (yes/no)", "read-only"}
+
+func newAdminForm(e allowEntry, editing bool, others []allowEntry) *adminForm {
+	f := &adminForm{owners: map[string]string{}}
+	if editing { f.user = e.User }
+	for _, o := range others {
+		if fp, err := keyFingerprint(o.PubKey); err == nil && o.User != f.user { f.owners[fp] = o.User }
+	}
+	admin, readOnly := "no", "no"
+	if e.IsAdmin { admin = "yes" }
+	if e.ReadOnly { readOnly = "yes" }
+	for i, v := range []string{e.User, e.PubKey, strings.Join(e.AllowedExec, ","), strings.Join(e.Roles, ","), admin, readOnly} {
+		ti := textinput.New()
+		ti.Prompt = fmt.Sprintf("%-16s", T(adminFieldNames[i])+": ")
+		ti.CharLimit = 1000
+		ti.Width = 60
+		ti.SetValue(v)
+		f.fields = append(f.fields, ti)
+	}
+	f.fields[adminFieldKey].CharLimit = 16 << 10
+	f.fields[adminFieldKey].Placeholder = T("paste a public key, or the path of a .pub file")
+	f.fields[adminFieldExec].Placeholder = T("agents, comma separated")
+	f.fields[adminFieldRoles].Placeholder = T("roles, comma separated")
+	f.fields[adminFieldReadOnly].Placeholder = T("yes: browse only, no edits, shell, exec or approvals")
+	return f
+}
+
+// splitList reads a comma separated field
+func splitList(s string) []string {
+	var out []string
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" { out = append(out, p) }
+	}
+	return out
+}
+
+// entry is the allowlist entry the form describes
+func (f *adminForm) entry() (allowEntry, error) {
+	key, _, _, err := resolveKey(f.fields[adminFieldKey].Value())
+	if err != nil { return allowEntry{}, err }
+	e := allowEntry{
+		User:        strings.TrimSpace(f.fields[adminFieldUser].Value()),
+		PubKey:      key,
+		AllowedExec: splitList(f.fields[adminFieldExec].Value()),
+		Roles:       splitList(f.fields[adminFieldRoles].Value()),
+	}
+	if e.IsAdmin, err = yesNo(f.fields[adminFieldAdmin].Value()); err != nil { return e, errors.New(T("admin must be yes or no")) }
+	if e.ReadOnly, err = yesNo(f.fields[adminFieldReadOnly].Value()); err != nil { return e, errors.New(T("read-only must be yes or no")) }
+	return e, nil
+}
+
+// yesNo reads a yes/no field; empty is no
+func yesNo(s string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "yes", "y", "true", "sí", "si":
+		return true, nil
+	case "no", "n", "false", "":
+		return false, nil
+	}
+	return false, errors.New("not yes or no")
+}
+
+func (f *adminForm) view() string {
+	title := T("New allowlist entry")
+	if f.user != "" { title = T("Edit %s", f.user) }
+	var b strings.Builder
+	b.WriteString(lipgloss.NewStyle().Bold(true).Render(title) + "\n\n")
+	for i, ti := range f.fields {
+		b.WriteString(ti.View() + "\n")
+		if i == adminFieldKey { b.WriteString(strings.Repeat(" ", 16) + f.keyStatus() + "\n") }
+	}
+	b.WriteString("\n" + helpStyle.Render(T("tab/shift+tab: next/previous field • enter: preview the change • esc: cancel")))
+	return b.String()
+}
+
+func (m *model) openAdminForm(e allowEntry, editing bool) tea.Cmd {
+	others, err := loadAllowlist(m.allowPath)
+	if err != nil && !os.IsNotExist(err) { m.status = T("cannot read %s: %v", m.allowPath, err); return nil }
+	m.adminForm = newAdminForm(e, editing, others)
+	return m.adminForm.fields[0].Focus()
+}
+
+// updateAdminForm handles keys while the entry form is open
+func (m *model) updateAdminForm(msg tea.KeyMsg) tea.Cmd {
+	f := m.adminForm
+	switch msg.String() {
+	case "esc":
+		m.adminForm = nil
+		m.status = T("cancelled")
+		return nil
+	case "tab", "down", "shift+tab", "up":
+		if f.focus == adminFieldKey { f.guessUser() }
+		f.fields[f.focus].Blur()
+		if msg.String() == "tab" || msg.String() == "down" { f.focus = (f.focus + 1) % len(f.fields) } else { f.focus = (f.focus - 1 + len(f.fields)) % len(f.fields) }
+		return f.fields[f.focus].Focus()
+	case "enter":
+		e, err := f.entry()
+		var p allowlistPlan
+		if err == nil { p, err = planAllowlist(m.allowPath, putEntry(f.user, e)) }
+		if err != nil { m.status = T("not saved: %v", err); slog.Warn("allowlist edit rejected", "user", e.User, "err", err); return nil }
+		if r := f.req; r != nil { p.after = func() error { return dropPending(m.allowPath, r.User, r.Invite) } }
+		m.confirmAllowlist(p, T("write %s to the allowlist?", e.User), T("saved %s to the allowlist", e.User))
+		return nil
+	}
+	var cmd tea.Cmd
+	f.fields[f.focus], cmd = f.fields[f.focus].Update(msg)
+	return cmd
+}
+
+// putEntry adds e, or replaces the entry of user when editing
+func putEntry(user string, e allowEntry) func([]allowEntry) ([]allowEntry, error) {
+	return func(cur []allowEntry) ([]allowEntry, error) {
+		if user == "" { return append(cur, e), nil }
+		for i := range cur {
+			if cur[i].User == user { cur[i] = e; return cur, nil }
+		}
+		return nil, errors.New(T("%s is no longer in the allowlist", user))
+	}
+}
+
+// dropEntry removes the entry of user
+func dropEntry(user string) func([]allowEntry) ([]allowEntry, error) {
+	return func(cur []allowEntry) ([]allowEntry, error) {
+		next := []allowEntry{}
+		for _, e := range cur { if e.User != user { next = append(next, e) } }
+		if len(next) == len(cur) { return nil, errors.New(T("%s is no longer in the allowlist", user)) }
+		return next, nil
+	}
+}
+
+// updateAdmin handles keys in the Admin tab
+func (m *model) updateAdmin(msg tea.KeyMsg) (tea.Cmd, bool) {
+	if m.adminList.FilterState() == list.Filtering { return nil, false }
+	sel, ok := m.adminList.SelectedItem().(adminItem)
+	switch msg.String() {
+	case "u":
+		m.refreshAdmin()
+		m.status = T("refreshed allowlist")
+		return nil, true
+	case "n":
+		if m.denyReadOnly() { return nil, true }
+		return m.openAdminForm(allowEntry{}, false), true
+	case "enter":
+		if !ok { return nil, true }
+		m.panes.show(true, m.tabs[m.active], "Preview")
+		m.setContent(renderAdminEntry(sel))
+		return nil, true
+	case "i":
+		if m.denyReadOnly() { return nil, true }
+		token, err := newInvite(m.allowPath)
+		if err != nil { m.status = T("no invite: %v", err); slog.Warn("invite failed", "err", err); return nil, true }
+		m.panes.show(true, m.tabs[m.active], "Preview")
+		m.setContent(renderInvite(token))
+		m.status = T("invite created; it is shown only once")
+		return nil, true
+	case "I":
+		invs, err := loadInvites(m.allowPath)
+		if err != nil { m.status = T("cannot read %s: %v", invitesPath(m.allowPath), err); return nil, true }
+		m.panes.show(true, m.tabs[m.active], "Preview")
+		m.setContent(renderInvites(invs))
+		return nil, true
+	case "a":
+		if !ok || sel.req == nil || m.denyReadOnly() { return nil, true }
+		r := sel.req
+		p, err := planAllowlist(m.allowPath, putEntry("", sel.e))
+		if err != nil { m.status = T("not saved: %v", err); slog.Warn("invite approval rejected", "user", r.User, "err", err); return nil, true }
+		p.after = func() error { return dropPending(m.allowPath, r.User, r.Invite) }
+		m.confirmAllowlist(p, T("approve %s?", r.User), T("approved %s", r.User))
+		return nil, true
+	case "e":
+		if !ok || m.denyReadOnly() { return nil, true }
+		if sel.req != nil {
+			cmd := m.openAdminForm(sel.e, false)
+			if m.adminForm != nil { m.adminForm.req = sel.req }
+			return cmd, true
+		}
+		return m.openAdminForm(sel.e, true), true
+	case "x":
+		if !ok || m.denyReadOnly() { return nil, true }
+		if r := sel.req; r != nil {
+			m.ask(T("reject the request of %s?", r.User), func(m *model) tea.Cmd {
+				if err := dropPending(m.allowPath, r.User, r.Invite); err != nil { m.status = T("not rejected: %v", err); slog.Warn("invite rejection failed", "user", r.User, "err", err); return nil }
+				m.refreshAdmin()
+				m.status = T("rejected the request of %s", r.User)
+				return nil
+			})
+			return nil, true
+		}
+		user := sel.e.User
+		p, err := planAllowlist(m.allowPath, dropEntry(user))
+		if err != nil { m.status = T("not removed: %v", err); slog.Warn("allowlist removal failed", "user", user, "err", err); return nil, true }
+		m.confirmAllowlist(p, T("remove %s from the allowlist?", user), T("removed %s from the allowlist", user))
+		return nil, true
+	}
+	return nil, false
+}
+
+// adminView is the Admin tab: the form while it is open, else the entries
+func (m model) adminView() string {
+	if m.adminForm != nil { return m.adminForm.view() }
+	return m.adminList.View()
+}
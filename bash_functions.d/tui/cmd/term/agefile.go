@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+	"filippo.io/age/agessh"
+	"filippo.io/age/armor"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// ageConfig says whom X encrypts files to and which key decrypts them
+type ageConfig struct {
+	Recipients     []string `json:"recipients,omitempty"`      // age1… or ssh- public keys
+	RecipientsFile string   `json:"recipients_file,omitempty"` // one recipient per line, as for age -R
+	Identity       string   `json:"identity,omitempty"`        // age or unencrypted ssh key file; default ~/.config/age/keys.txt
+}
+
+func (c ageConfig) identityFile() string {
+	if c.Identity != "" { return c.Identity }
+	return expandHome("~/.config/age/keys.txt")
+}
+
+// parseAgeRecipient reads an age1… recipient or an ssh public key line
+func parseAgeRecipient(s string) (age.Recipient, error) {
+	if strings.HasPrefix(s, "ssh-") { return agessh.ParseRecipient(s) }
+	return age.ParseX25519Recipient(s)
+}
+
+// identities reads the identity file: age secret keys, or an ssh private key
+func (c ageConfig) identities() ([]age.Identity, error) {
+	b, err := ioutil.ReadFile(c.identityFile())
+	if err != nil { return nil, err }
+	if bytes.HasPrefix(bytes.TrimSpace(b), []byte("-----BEGIN")) {
+		id, err := agessh.ParseIdentity(b)
+		if err != nil { return nil, err }
+		return []age.Identity{id}, nil
+	}
+	return age.ParseIdentities(bytes.NewReader(b))
+}
+
+// recipients are the configured recipients and those of the recipients file; with
+// neither, files are encrypted to the identity's own key so they can be read back
+func (c ageConfig) recipients() ([]age.Recipient, error) {
+	lines := append([]string(nil), c.Recipients...)
+	if c.RecipientsFile != "" {
+		f, err := os.Open(c.RecipientsFile)
+		if err != nil { return nil, err }
+		defer f.Close()
+		sc := bufio.NewScanner(f)
+		for sc.Scan() { lines = append(lines, sc.Text()) }
+		if err := sc.Err(); err != nil { return nil, err }
+	}
+	var rs []age.Recipient
+	for _, l := range lines {
+		l = strings.TrimSpace(l)
+		if l == "" || strings.HasPrefix(l, "#") { continue }
+		r, err := parseAgeRecipient(l)
+		if err != nil { return nil, fmt.Errorf("%s: %v", l, err) }
+		rs = append(rs, r)
+	}
+	if len(rs) > 0 { return rs, nil }
+	ids, err := c.identities()
+	if err != nil { return nil, errors.New(T("no age recipients: set age.recipients in config.json or create %s", c.identityFile())) }
+	for _, id := range ids {
+		if x, ok := id.(*age.X25519Identity); ok { rs = append(rs, x.Recipient()) }
+	}
+	if len(rs) == 0 { return nil, errors.New(T("no age recipients: set age.recipients in config.json")) }
+	return rs, nil
+}
+
+// ageOutput names the result of X: file.age for a file, file for file.age
+func ageOutput(path string) string {
+	if strings.HasSuffix(path, ".age") { return strings.TrimSuffix(path, ".age") }
+	return path + ".age"
+}
+
+// writeNew writes dst through a temporary file in its directory; unless replace is
+// set an existing dst is left alone, even one created meanwhile
+func writeNew(dst string, perm os.FileMode, replace bool, fill func(io.Writer) error) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(dst), "."+filepath.Base(dst)+".*")
+	if err != nil { return err }
+	defer os.Remove(tmp.Name())
+	if err := fill(tmp); err != nil { tmp.Close(); return err }
+	if err := tmp.Close(); err != nil { return err }
+	if err := os.Chmod(tmp.Name(), perm); err != nil { return err }
+	if replace { return os.Rename(tmp.Name(), dst) }
+	// a hard link fails when dst exists, where a rename would replace it
+	if err := os.Link(tmp.Name(), dst); err != nil {
+		if os.IsExist(err) { return errors.New(T("%s already exists", filepath.Base(dst))) }
+		return err
+	}
+	return nil
+}
+
+func encryptFile(src, dst string, rs []age.Recipient, replace bool) error {
+	in, err := os.Open(src)
+	if err != nil { return err }
+	defer in.Close()
+	fi, err := in.Stat()
+	if err != nil { return err }
+	return writeNew(dst, fi.Mode().Perm(), replace, func(out io.Writer) error {
+		w, err := age.Encrypt(out, rs...)
+		if err != nil { return err }
+		if _, err := io.Copy(w, in); err != nil { return err }
+		return w.Close()
+	})
+}
+
+// decryptFile reads binary or armored age files; the plaintext is only readable by
+// the user
+func decryptFile(src, dst string, ids []age.Identity, replace bool) error {
+	in, err := os.Open(src)
+	if err != nil { return err }
+	defer in.Close()
+	br := bufio.NewReader(in)
+	var r io.Reader = br
+	if head, _ := br.Peek(len(armor.Header)); string(head) == armor.Header { r = armor.NewReader(br) }
+	return writeNew(dst, 0o600, replace, func(out io.Writer) error {
+		pr, err := age.Decrypt(r, ids...)
+		if err != nil { return err }
+		_, err = io.Copy(out, pr)
+		return err
+	})
+}
+
+// ageDoneMsg reports the files X wrote and the ones that failed
+type ageDoneMsg struct {
+	wrote  []string
+	failed []string
+}
+
+// ageCrypt encrypts files and decrypts those ending in .age in the background; every
+// decryption is audited, successful or not
+func ageCrypt(files []string, cfg ageConfig, auditPath string, replace bool) tea.Cmd {
+	return func() tea.Msg {
+		var msg ageDoneMsg
+		var rs []age.Recipient
+		var ids []age.Identity
+		var rsErr, idsErr error
+		for _, f := range files {
+			dst := ageOutput(f)
+			var err error
+			if strings.HasSuffix(f, ".age") {
+				if ids == nil && idsErr == nil {
+					if ids, idsErr = cfg.identities(); idsErr != nil { idsErr = errors.New(T("no age identity: %v (set age.identity in config.json)", idsErr)) }
+				}
+				err = idsErr
+				if err == nil { err = decryptFile(f, dst, ids, replace) }
+				appendAudit(auditPath, fmt.Sprintf("%s\tage=decrypt\tpath=%s\tout=%s\tuser=%s\terror=%v", time.Now().Format(time.RFC3339), f, dst, transferUser(), err))
+			} else {
+				if rs == nil && rsErr == nil { rs, rsErr = cfg.recipients() }
+				err = rsErr
+				if err == nil { err = encryptFile(f, dst, rs, replace) }
+			}
+			if err != nil { msg.failed = append(msg.failed, fmt.Sprintf("%s: %v", filepath.Base(f), err)); continue }
+			msg.wrote = append(msg.wrote, filepath.Base(dst))
+		}
+		return msg
+	}
+}
+
+// cryptSelected runs X on the marked files or the selected one, asking first when
+// that would replace files
+func (m *model) cryptSelected() tea.Cmd {
+	files := m.checksumTargets()
+	if len(files) == 0 { m.status = T("select a file or mark some with m"); return nil }
+	var existing []string
+	for _, f := range files {
+		if _, err := os.Stat(ageOutput(f)); err == nil { existing = append(existing, filepath.Base(ageOutput(f))) }
+	}
+	cfg, audit := m.cfg.Age, m.auditPath
+	if len(existing) > 0 {
+		m.ask(T("replace %s?", strings.Join(existing, ", ")), func(m *model) tea.Cmd {
+			m.status = T("age: working on %d files", len(files))
+			return ageCrypt(files, cfg, audit, true)
+		})
+		return nil
+	}
+	m.status = T("age: working on %d files", len(files))
+	return ageCrypt(files, cfg, audit, false)
+}
+
+// ageDone lists what X wrote; failures take the status line
+func (m *model) ageDone(msg ageDoneMsg) {
+	m.refreshFiles()
+	switch {
+	case len(msg.failed) > 0 && len(msg.wrote) > 0:
+		m.status = T("age wrote %s; failed: %s", strings.Join(msg.wrote, ", "), strings.Join(msg.failed, "; "))
+	case len(msg.failed) > 0:
+		m.status = T("age failed: %s", strings.Join(msg.failed, "; "))
+	default:
+		m.status = T("age wrote %s", strings.Join(msg.wrote, ", "))
+	}
+	if len(msg.failed) > 0 { slog.Warn("age failed", "files", msg.failed) }
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// draftSeparator splits a draft in the editor: the manifest entry above, the script below
+const draftSeparator = "----- script -----"
+
+// agentDraftSystem tells the model what a draft looks like
+const agentDraftSystem = `You write agents for a manifest of shell automation agents. Reply with exactly two fenced code blocks and nothing else.
+The first is a json block with the manifest entry: an object with "name" (lowercase letters, digits and dashes), "desc" (one line), "entry" (the script's file name, e.g. name.sh or name.py), "tags" (a few short words), "tools" (the commands the script needs) and, only for scripts that are not run directly, "interpreter" (e.g. python3).
+The second is the script, in a block tagged with its language. It starts with a shebang, is self-contained, changes nothing it was not asked to change, and writes a short report to stdout, in markdown when that helps; errors go to stderr with a non-zero exit.`
+
+var agentNameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// agentDraft is a generated agent under review in the Editor tab; nothing of it is
+// written until ctrl+s and a yes to the question that follows
+type agentDraft struct {
+	description string
+}
+
+// agentDraftMsg carries the model's draft, already laid out for the editor
+type agentDraftMsg struct {
+	description string
+	buffer      string
+	err         error
+}
+
+func newGenInput() textinput.Model {
+	ti := textinput.New()
+	ti.Prompt = T("describe the agent: ")
+	ti.Placeholder = T("e.g. report the five largest directories under /var and their growth since yesterday")
+	ti.CharLimit = 1000
+	return ti
+}
+
+// openAgentGen opens the G prompt of the Agents tab
+func (m *model) openAgentGen() tea.Cmd {
+	if m.denyReadOnly() { return nil }
+	m.genInput.SetValue("")
+	return m.genInput.Focus()
+}
+
+// updateGenInput handles keys while the G prompt has focus; enter sends the description
+func (m *model) updateGenInput(msg tea.KeyMsg) tea.Cmd {
+	switch msg.String() {
+	case "esc":
+		m.genInput.Blur()
+		return nil
+	case "enter":
+		desc := strings.TrimSpace(m.genInput.Value())
+		if desc == "" { return nil }
+		m.genInput.Blur()
+		m.status = T("drafting an agent...")
+		return generateAgent(m.cfg.LLM, desc)
+	}
+	var cmd tea.Cmd
+	m.genInput, cmd = m.genInput.Update(msg)
+	return cmd
+}
+
+// generateAgent asks the model for a draft of the described agent
+func generateAgent(cfg llmConfig, desc string) tea.Cmd {
+	return func() tea.Msg {
+		out, err := askLLM(context.Background(), cfg, agentDraftSystem, desc)
+		if err != nil { return agentDraftMsg{description: desc, err: err} }
+		buf, err := draftBuffer(out)
+		return agentDraftMsg{description: desc, buffer: buf, err: err}
+	}
+}
+
+// draftBuffer lays out the model's answer for review: the manifest entry, indented,
+// then the separator and the script
+func draftBuffer(answer string) (string, error) {
+	var entry, script string
+	for _, b := range fencedBlocks(answer) {
+		if entry == "" && (b.lang == "json" || strings.HasPrefix(strings.TrimSpace(b.body), "{")) { entry = b.body; continue }
+		if script == "" { script = b.body }
+	}
+	if entry == "" || script == "" { return "", errors.New(T("the model did not answer with a manifest entry and a script")) }
+	var raw json.RawMessage
+	if err := json.Unmarshal([]byte(entry), &raw); err != nil { return "", errors.New(T("the manifest entry is not JSON: %v", err)) }
+	pretty, err := json.MarshalIndent(raw, "", "  ")
+	if err != nil { return "", err }
+	return string(pretty) + "\n" + draftSeparator + "\n" + script, nil
+}
+
+// openDraft puts a draft in the editor, which has no file behind it until it is added
+func (m *model) openDraft(msg agentDraftMsg) tea.Cmd {
+	if msg.err != nil { m.status = T("agent draft failed: %v", msg.err); slog.Warn("agent draft failed", "err", msg.err); return nil }
+	m.ta.SetValue(msg.buffer)
+	m.editorFile, m.editorRO = "", false
+	m.draft = &agentDraft{description: msg.description}
+	if m.vim != nil { m.vim.insert = false }
+	editorGoto(&m.ta, 1, 1)
+	m.active = m.tabIndex("Editor")
+	m.status = T("review the draft: ctrl+s adds the agent, ctrl+q drops it")
+	return m.ta.Focus()
+}
+
+// splitDraft reads the reviewed buffer back into the manifest entry and the script
+func splitDraft(buf string) (json.RawMessage, agentSpec, string, error) {
+	var a agentSpec
+	i := strings.Index(buf, "\n"+draftSeparator+"\n")
+	if i < 0 { return nil, a, "", errors.New(T("the draft lost its %q line", draftSeparator)) }
+	entry, script := buf[:i], buf[i+len(draftSeparator)+2:]
+	if err := json.Unmarshal([]byte(entry), &a); err != nil { return nil, a, "", errors.New(T("the manifest entry is not JSON: %v", err)) }
+	if strings.TrimSpace(script) == "" { return nil, a, "", errors.New(T("the draft has no script")) }
+	return json.RawMessage(entry), a, script, nil
+}
+
+// checkDraft refuses an entry that is incomplete or would replace an agent or file
+func checkDraft(a agentSpec) error {
+	if !agentNameRe.MatchString(a.Name) { return errors.New(T("the agent needs a name of letters, digits, '.', '_' and '-'")) }
+	mf, err := loadManifest()
+	if err != nil && !os.IsNotExist(err) { return err }
+	if _, ok := mf.agent(a.Name); ok { return errors.New(T("agent %s already exists", a.Name)) }
+	for _, c := range mf.Crews { if c.Name == a.Name { return errors.New(T("a crew is named %s", a.Name)) } }
+	if a.Entry == "" || filepath.IsAbs(a.Entry) || strings.HasPrefix(filepath.Clean(a.Entry), "..") { return errors.New(T("the entry must be a path inside %s", filepath.Dir(manifestPath()))) }
+	if _, err := os.Stat(a.entryPath()); err == nil { return errors.New(T("%s already exists", a.entryPath())) }
+	return nil
+}
+
+// confirmDraft checks the reviewed draft and asks before writing anything
+func (m *model) confirmDraft() {
+	if m.denyReadOnly() { return }
+	raw, a, script, err := splitDraft(m.ta.Value())
+	if err == nil { err = checkDraft(a) }
+	if err != nil { m.status = err.Error(); return }
+	m.ask(T("add agent %s: write %s and add it to manifest.json?", a.Name, a.Entry), func(m *model) tea.Cmd {
+		m.addDraft(raw, a, script)
+		return nil
+	})
+}
+
+// addDraft writes the script and appends the entry to the manifest, then keeps the
+// script open in the editor
+func (m *model) addDraft(raw json.RawMessage, a agentSpec, script string) {
+	err := writeAgent(raw, a, script)
+	appendAudit(m.auditPath, fmt.Sprintf("%s\tagent_create=%s\tentry=%s\tsource=llm\tuser=%s\terror=%v", time.Now().Format(time.RFC3339), a.Name, a.Entry, transferUser(), err))
+	if err != nil { m.status = T("cannot add agent %s: %v", a.Name, err); slog.Warn("agent not added", "agent", a.Name, "err", err); return }
+	m.draft = nil
+	m.refreshAgents()
+	m.ta.SetValue(script)
+	m.editorFile = a.entryPath()
+	editorGoto(&m.ta, 1, 1)
+	m.status = T("added agent %s", a.Name)
+}
+
+// writeAgent creates the script, then adds the entry under the manifest lock; the
+// script is removed again if the manifest cannot be updated
+func writeAgent(raw json.RawMessage, a agentSpec, script string) error {
+	p := a.entryPath()
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil { return err }
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o755)
+	if err != nil { return err }
+	_, err = f.WriteString(script)
+	if cerr := f.Close(); err == nil { err = cerr }
+	if err == nil { err = withLock("manifest", func() error { return appendManifestAgent(raw) }) }
+	if err != nil { os.Remove(p) }
+	return err
+}
+
+// appendManifestAgent adds raw to the manifest's agents, leaving the rest of the file
+// as it is apart from the indentation
+func appendManifestAgent(raw json.RawMessage) error {
+	path := manifestPath()
+	doc := map[string]json.RawMessage{}
+	b, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) { return err }
+	if len(b) > 0 {
+		if err := json.Unmarshal(b, &doc); err != nil { return fmt.Errorf("%s: %w", path, err) }
+	}
+	var agents []json.RawMessage
+	if doc["agents"] != nil {
+		if err := json.Unmarshal(doc["agents"], &agents); err != nil { return fmt.Errorf("%s: %w", path, err) }
+	}
+	if doc["agents"], err = json.Marshal(append(agents, raw)); err != nil { return err }
+	out, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil { return err }
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, append(out, '\n'), 0o644); err != nil { return err }
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// maxAgentSource caps how much of an agent's script is read for searching
+const maxAgentSource = 256 << 10
+
+// agentDoc is what the agent search looks at: the list item and the agent's script
+type agentDoc struct {
+	item   agentItem
+	source string // lowercased script contents; for a crew, its description and members
+}
+
+// agentSearchDocs reads the manifest and every agent's script once per search
+func agentSearchDocs() []agentDoc {
+	mf, err := loadManifest()
+	if err != nil { return nil }
+	var docs []agentDoc
+	for _, a := range mf.Agents {
+		d := agentDoc{item: agentItem{name: a.Name, desc: a.Desc, tags: a.Tags, locked: execAllowed(a.Name) != nil}}
+		if p := a.entryPath(); p != "" {
+			if b, err := ioutil.ReadFile(p); err == nil {
+				if len(b) > maxAgentSource { b = b[:maxAgentSource] }
+				d.source = strings.ToLower(string(b))
+			}
+		}
+		docs = append(docs, d)
+	}
+	for _, c := range mf.Crews {
+		desc := c.Desc
+		if len(c.Agents) > 0 { desc += " " + strings.Join(c.Agents, " ") }
+		docs = append(docs, agentDoc{item: agentItem{name: c.Name, desc: c.Desc, tags: c.Tags, crew: len(c.Agents), locked: crewExecAllowed(c) != nil}, source: strings.ToLower(desc)})
+	}
+	return docs
+}
+
+// scoreAgent ranks d against the query terms. Every term has to match somewhere;
+// a hit in the name counts most, then tags, the description and last the script.
+// 0 means no match.
+func scoreAgent(d agentDoc, terms []string) int {
+	name, desc := strings.ToLower(d.item.name), strings.ToLower(d.item.desc)
+	total := 0
+	for _, t := range terms {
+		score := 0
+		switch {
+		case name == t:
+			score = 100
+		case strings.HasPrefix(name, t):
+			score = 60
+		case strings.Contains(name, t):
+			score = 40
+		}
+		for _, tag := range d.item.tags {
+			if strings.EqualFold(tag, t) { score += 30 } else if strings.Contains(strings.ToLower(tag), t) { score += 15 }
+		}
+		if strings.Contains(desc, t) { score += 10 }
+		if n := strings.Count(d.source, t); n > 0 {
+			if n > 5 { n = 5 }
+			score += n
+		}
+		if score == 0 { return 0 }
+		total += score
+	}
+	return total
+}
+
+// rankAgents returns the agents matching query, best first; ties keep manifest order
+func rankAgents(docs []agentDoc, query string) []list.Item {
+	terms := strings.Fields(strings.ToLower(query))
+	type hit struct {
+		item  agentItem
+		score int
+	}
+	var hits []hit
+	for _, d := range docs {
+		if len(terms) == 0 { hits = append(hits, hit{d.item, 1}); continue }
+		if s := scoreAgent(d, terms); s > 0 { hits = append(hits, hit{d.item, s}) }
+	}
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].score > hits[j].score })
+	out := make([]list.Item, len(hits))
+	for i, h := range hits { out[i] = h.item }
+	return out
+}
+
+func newAgentSearchInput() textinput.Model {
+	ti := textinput.New()
+	ti.Prompt = T("search agents: ")
+	ti.Placeholder = T("name, tag, description or script text")
+	ti.CharLimit = 100
+	return ti
+}
+
+// openAgentSearch focuses the search box, reading the scripts it searches
+func (m *model) openAgentSearch() tea.Cmd {
+	m.agentDocs = agentSearchDocs()
+	return m.agentSearch.Focus()
+}
+
+// updateAgentSearch handles keys while the Agents search box has focus; the list is
+// re-ranked as the query changes. enter keeps the results, esc clears the search.
+func (m *model) updateAgentSearch(msg tea.KeyMsg) tea.Cmd {
+	switch msg.String() {
+	case "esc":
+		m.agentSearch.Blur()
+		m.agentSearch.SetValue("")
+		m.refreshAgents()
+		m.status = ""
+		return nil
+	case "enter":
+		m.agentSearch.Blur()
+		return nil
+	case "up", "down":
+		var cmd tea.Cmd
+		m.agentsList, cmd = m.agentsList.Update(msg)
+		return cmd
+	}
+	var cmd tea.Cmd
+	m.agentSearch, cmd = m.agentSearch.Update(msg)
+	m.refreshAgents()
+	m.agentsList.Select(0)
+	m.status = T("%d agents match", len(m.agentsList.Items()))
+	return cmd
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// tagColors are the chip backgrounds; a tag always gets the same one
+var tagColors = []string{"24", "28", "94", "54", "30", "130", "90", "61"}
+
+func tagChip(tag string) string {
+	h := fnv.New32a()
+	h.Write([]byte(tag))
+	c := tagColors[h.Sum32()%uint32(len(tagColors))]
+	return lipgloss.NewStyle().Background(lipgloss.Color(c)).Foreground(lipgloss.Color("255")).Padding(0, 1).Render(tag)
+}
+
+// agentDelegate is the default two-line delegate with the agent's tags as colored
+// chips after its name; agents the user cannot exec are greyed out
+type agentDelegate struct{ list.DefaultDelegate }
+
+func newAgentDelegate() agentDelegate { return agentDelegate{list.NewDefaultDelegate()} }
+
+func (d agentDelegate) Render(w io.Writer, m list.Model, index int, item list.Item) {
+	a, ok := item.(agentItem)
+	if !ok || len(a.tags) == 0 && !a.locked || m.FilterState() == list.Filtering { d.DefaultDelegate.Render(w, m, index, item); return }
+	title, desc := d.Styles.NormalTitle, d.Styles.NormalDesc
+	if a.locked { title, desc = d.Styles.DimmedTitle, d.Styles.DimmedDesc }
+	if index == m.Index() { title, desc = d.Styles.SelectedTitle, d.Styles.SelectedDesc }
+	head := title.Render(a.name)
+	for _, t := range a.tags { head += " " + tagChip(t) }
+	text := a.summary()
+	if max := m.Width() - 4; max > 0 && len([]rune(text)) > max { text = string([]rune(text)[:max-1]) + "…" }
+	fmt.Fprintf(w, "%s\n%s", head, desc.Render(text))
+}
+
+// agentTags lists the tags used in items, sorted
+func agentTags(items []list.Item) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, it := range items {
+		a, ok := it.(agentItem)
+		if !ok { continue }
+		for _, t := range a.tags { if !seen[t] { seen[t] = true; out = append(out, t) } }
+	}
+	sort.Strings(out)
+	return out
+}
+
+func (a agentItem) hasTag(tag string) bool {
+	for _, t := range a.tags { if strings.EqualFold(t, tag) { return true } }
+	return false
+}
+
+// refreshAgents reloads the manifest into the Agents list, ranked by the search
+// query when there is one and keeping only agents with the selected tag
+func (m *model) refreshAgents() {
+	all := loadAgents()
+	m.agentTagList = agentTags(all)
+	items := all
+	if q := m.agentSearch.Value(); q != "" { items = rankAgents(m.agentDocs, q) }
+	if m.agentTag != "" {
+		var tagged []list.Item
+		for _, it := range items { if it.(agentItem).hasTag(m.agentTag) { tagged = append(tagged, it) } }
+		items = tagged
+	}
+	m.agentsList.SetItems(items)
+	if m.agentTag == "" { m.agentsList.Title = T("Agents") } else { m.agentsList.Title = T("Agents #%s", m.agentTag) }
+}
+
+// cycleAgentTag steps the tag filter through every tag and back to showing all agents
+func (m *model) cycleAgentTag() {
+	m.refreshAgents()
+	next := ""
+	for i, t := range m.agentTagList {
+		if m.agentTag == "" { next = t; break }
+		if t == m.agentTag && i+1 < len(m.agentTagList) { next = m.agentTagList[i+1]; break }
+	}
+	m.agentTag = next
+	m.refreshAgents()
+	m.agentsList.Select(0)
+	switch {
+	case len(m.agentTagList) == 0:
+		m.status = T("no agent has tags")
+	case next == "":
+		m.status = T("showing all agents")
+	default:
+		m.status = T("showing agents tagged %s", next)
+	}
+}
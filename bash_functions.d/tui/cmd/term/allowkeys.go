@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"golang.org/x/crypto/ssh"
+)
+
+// resolveKey reads the key field of the allowlist form: a pasted authorized_keys
+// line, or the path of a file holding one (a key always contains a space, a path
+// here never does). The key comes back as "type base64 comment", without the
+// options, which wish-server does not honour.
+func resolveKey(input string) (key, fp, comment string, err error) {
+	input = strings.TrimSpace(input)
+	if input == "" { return "", "", "", errors.New(T("no public key")) }
+	if !strings.ContainsAny(input, " \t") {
+		b, err := ioutil.ReadFile(expandHome(input))
+		if err != nil { return "", "", "", err }
+		input = string(b)
+	}
+	k, comment, _, rest, err := ssh.ParseAuthorizedKey([]byte(input))
+	if err != nil { return "", "", "", err }
+	if len(bytes.TrimSpace(rest)) > 0 { return "", "", "", errors.New(T("more than one key; add them one at a time")) }
+	key = strings.TrimSpace(string(ssh.MarshalAuthorizedKey(k)))
+	if comment != "" { key += " " + comment }
+	return key, ssh.FingerprintSHA256(k), comment, nil
+}
+
+// keyStatus checks the key field as it is typed: whether it parses and whether
+// another entry already has it
+func (f *adminForm) keyStatus() string {
+	v := f.fields[adminFieldKey].Value()
+	if strings.TrimSpace(v) == "" { return helpStyle.Render(T("paste a public key, or the path of a .pub file")) }
+	key, fp, _, err := resolveKey(v)
+	if err != nil { return diffDelStyle.Render("✗ " + err.Error()) }
+	if u := f.owners[fp]; u != "" { return diffDelStyle.Render("✗ " + T("%s already has this key", u)) }
+	return diffAddStyle.Render("✓ " + strings.Fields(key)[0] + " " + fp)
+}
+
+// guessUser fills an empty user field from a key comment such as alice@laptop
+func (f *adminForm) guessUser() {
+	if strings.TrimSpace(f.fields[adminFieldUser].Value()) != "" { return }
+	_, _, comment, err := resolveKey(f.fields[adminFieldKey].Value())
+	if err != nil { return }
+	if u := strings.SplitN(comment, "@", 2)[0]; allowUserRe.MatchString(u) { f.fields[adminFieldUser].SetValue(u) }
+}
+
+// allowlistPlan is a validated allowlist edit, shown as a diff until the admin
+// confirms it
+type allowlistPlan struct {
+	before []byte // the file the edit was planned against
+	diff   []diffLine
+	apply  func([]allowEntry) ([]allowEntry, error)
+	after  func() error // runs once the change is written, e.g. to clear an approved request
+}
+
+func (p allowlistPlan) changed() bool {
+	for _, l := range p.diff { if l.op != ' ' { return true } }
+	return false
+}
+
+// planAllowlist applies fn to the allowlist as it is now without writing anything
+func planAllowlist(path string, fn func([]allowEntry) ([]allowEntry, error)) (allowlistPlan, error) {
+	before, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) { return allowlistPlan{}, err }
+	cur, next, err := applyAllowlist(path, before, fn)
+	if err != nil { return allowlistPlan{}, err }
+	return allowlistPlan{before: before, diff: diffLines(splitLines(string(cur)), splitLines(string(next))), apply: fn}, nil
+}
+
+// confirmAllowlist shows the diff of p in the Preview and writes the change once the
+// admin answers y
+func (m *model) confirmAllowlist(p allowlistPlan, question, done string) {
+	if !p.changed() { m.status = T("no changes to the allowlist"); return }
+	m.panes.show(true, m.tabs[m.active], "Preview")
+	m.setContent(T("Allowlist changes (%s)", m.allowPath) + "\n\n" + renderDiff(p.diff, m.plain))
+	m.ask(question, func(m *model) tea.Cmd {
+		if err := editAllowlist(m.allowPath, p.before, p.apply); err != nil { m.status = T("not saved: %v", err); slog.Warn("allowlist write failed", "path", m.allowPath, "err", err); return nil }
+		m.adminForm = nil
+		if p.after != nil {
+			if err := p.after(); err != nil { slog.Warn("allowlist follow-up failed", "err", err) }
+		}
+		m.refreshAdmin()
+		m.status = done
+		return nil
+	})
+}
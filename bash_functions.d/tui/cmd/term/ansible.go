@@ -0,0 +1,311 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// The Ansible tab finds the playbooks and inventories under ansible_dir (the cwd by
+// default) and runs ansible-playbook as a background job. The play output streams
+// into the tab as the job log grows and is archived under the TUI data dir.
+
+// ansibleSkipDirs are not searched for playbooks: they hold roles and variables
+var ansibleSkipDirs = map[string]bool{".git": true, "roles": true, "group_vars": true, "host_vars": true, "collections": true, "node_modules": true, "vendor": true, "tasks": true, "handlers": true, "templates": true, "files": true, "vars": true, "defaults": true, "meta": true}
+
+var (
+	playbookKey     = regexp.MustCompile(`(?m)^-?\s*(hosts|import_playbook|ansible\.builtin\.import_playbook):`)
+	ansibleRecap    = regexp.MustCompile(`^\S+\s+:\s+ok=\d+\s+changed=(\d+)\s+unreachable=(\d+)\s+failed=(\d+)`)
+	ansChangedStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("214"))
+)
+
+// ansibleSections are the lists the arrow keys move through
+const (
+	ansPlaybooks = iota
+	ansInventories
+	ansRuns
+)
+
+// ansibleView is the Ansible tab
+type ansibleView struct {
+	dir         string
+	playbooks   []string // relative to dir
+	inventories []string // relative to dir; "" is the ansible.cfg default
+	runs        []string // archived run logs, newest first
+	sel         [3]int
+	section     int
+	tags, limit string
+	check       bool            // --check: report what would change
+	prompt      textinput.Model // T or L: tags or limit
+	promptFor   string
+	runJob      string // job ID of the run started from this tab
+	runLog      string // job log of that run
+	shown       string // log shown below the lists: the run, or an archived one
+}
+
+func newAnsibleView() *ansibleView {
+	ti := textinput.New()
+	ti.CharLimit = 300
+	return &ansibleView{prompt: ti}
+}
+
+func ansibleRunsDir() string { return filepath.Join(tuiDataDir(), "ansible") }
+
+// scanAnsible finds playbooks and inventories up to three directories below dir
+func scanAnsible(dir string) (playbooks, inventories []string) {
+	inventories = []string{""}
+	base := strings.Count(filepath.Clean(dir), string(filepath.Separator))
+	filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil { return nil }
+		rel, _ := filepath.Rel(dir, path)
+		parent := filepath.Base(filepath.Dir(path))
+		if fi.IsDir() {
+			if path == dir { return nil }
+			if ansibleSkipDirs[fi.Name()] || strings.Count(path, string(filepath.Separator))-base > 3 { return filepath.SkipDir }
+			// inventories/prod is an inventory directory
+			if parent == "inventories" { inventories = append(inventories, rel); return filepath.SkipDir }
+			return nil
+		}
+		if fi.Size() > 1<<20 { return nil }
+		name, ext := strings.ToLower(fi.Name()), strings.ToLower(filepath.Ext(fi.Name()))
+		yaml := ext == ".yml" || ext == ".yaml"
+		switch {
+		case name == "hosts" || name == "inventory" || ext == ".ini" && name != "ansible.cfg" || parent == "inventory" && !yaml:
+			inventories = append(inventories, rel)
+		case yaml:
+			b, err := ioutil.ReadFile(path)
+			if err != nil { return nil }
+			kind := ansibleYAMLKind(string(b))
+			if kind == "playbook" { playbooks = append(playbooks, rel) }
+			if kind == "inventory" || parent == "inventory" && kind == "" { inventories = append(inventories, rel) }
+		}
+		return nil
+	})
+	sort.Strings(playbooks)
+	sort.Strings(inventories[1:])
+	return playbooks, inventories
+}
+
+// ansibleYAMLKind tells a playbook (a list of plays) from a YAML inventory (all:)
+func ansibleYAMLKind(src string) string {
+	for _, line := range strings.Split(src, "\n") {
+		t := strings.TrimSpace(line)
+		if t == "" || t == "---" || strings.HasPrefix(t, "#") { continue }
+		if strings.HasPrefix(line, "all:") { return "inventory" }
+		if strings.HasPrefix(line, "- ") && playbookKey.MatchString(src) { return "playbook" }
+		return ""
+	}
+	return ""
+}
+
+// listRuns returns the archived run logs, newest first
+func listRuns() []string {
+	files, _ := filepath.Glob(filepath.Join(ansibleRunsDir(), "*.log"))
+	sort.Sort(sort.Reverse(sort.StringSlice(files)))
+	return files
+}
+
+// loadAnsible scans the Ansible dir the first time the tab is shown
+func (m *model) loadAnsible() {
+	if m.tabs[m.active] == "Ansible" && m.ans.dir == "" { m.refreshAnsible() }
+}
+
+// refreshAnsible rescans the Ansible dir and the archive
+func (m *model) refreshAnsible() {
+	a := m.ans
+	a.dir = m.cfg.AnsibleDir
+	if a.dir == "" { a.dir = m.cwd }
+	a.playbooks, a.inventories = scanAnsible(a.dir)
+	a.runs = listRuns()
+	for i, n := range []int{len(a.playbooks), len(a.inventories), len(a.runs)} {
+		if a.sel[i] >= n { a.sel[i] = max(0, n-1) }
+	}
+}
+
+// ansibleCommand is the ansible-playbook command line for the current selection
+func (a *ansibleView) command() []string {
+	args := []string{"ansible-playbook"}
+	if inv := a.inventories[a.sel[ansInventories]]; inv != "" { args = append(args, "-i", inv) }
+	if a.tags != "" { args = append(args, "--tags", a.tags) }
+	if a.limit != "" { args = append(args, "--limit", a.limit) }
+	if a.check { args = append(args, "--check", "--diff") }
+	return append(args, a.playbooks[a.sel[ansPlaybooks]])
+}
+
+// runPlaybook queues the selected playbook as a job. The job script tees the play
+// output into the archive, so the log is kept even if the TUI exits mid-run.
+func (m *model) runPlaybook() tea.Cmd {
+	a := m.ans
+	if _, err := exec.LookPath("ansible-playbook"); err != nil { m.status = T("ansible-playbook not found in PATH"); return nil }
+	if err := os.MkdirAll(ansibleRunsDir(), 0o700); err != nil { m.status = T("run failed: %v", err); slog.Warn("run failed", "err", err); return nil }
+	pb := a.playbooks[a.sel[ansPlaybooks]]
+	stem := strings.TrimSuffix(filepath.Base(pb), filepath.Ext(pb))
+	archive := filepath.Join(ansibleRunsDir(), time.Now().Format("20060102-150405")+"-"+stem+".log")
+	var quoted []string
+	for _, arg := range a.command() { quoted = append(quoted, "'"+shellEscape(arg)+"'") }
+	script := fmt.Sprintf("set -o pipefail\ncd '%s' || exit 1\necho '$ %s'\n%s 2>&1 | tee '%s'\n", shellEscape(a.dir), shellEscape(strings.Join(a.command(), " ")), strings.Join(quoted, " "), shellEscape(archive))
+	path := strings.TrimSuffix(archive, ".log") + ".sh"
+	if err := ioutil.WriteFile(path, []byte(script), 0o600); err != nil { m.status = T("run failed: %v", err); slog.Warn("run failed", "err", err); return nil }
+	j, err := enqueue(job{Agent: "ansible:" + pb, Exec: true, User: os.Getenv("SSH_USER"), Script: path, Env: []string{"PYTHONUNBUFFERED=1", "ANSIBLE_NOCOLOR=1"}})
+	if err != nil { m.status = T("run failed: %v", err); slog.Warn("run failed", "err", err); return nil }
+	a.runJob, a.runLog, a.shown = j.ID, j.Log, ""
+	m.status = T("running %s as %s", pb, j.ID)
+	return m.startJobsTick()
+}
+
+// syncAnsible follows the run started from the tab on each jobs tick
+func (m *model) syncAnsible(all []job) {
+	a := m.ans
+	if a.runJob == "" { return }
+	for _, j := range all {
+		if j.ID != a.runJob { continue }
+		if j.State == JobRunning || j.State == JobQueued { return }
+		a.runJob = ""
+		a.runs = listRuns()
+		if j.Exit == 0 { m.status = T("%s finished", strings.TrimPrefix(j.Agent, "ansible:")) } else { m.status = T("%s failed: %s", strings.TrimPrefix(j.Agent, "ansible:"), jobError(j)) }
+	}
+}
+
+// updateAnsibleInput handles keys while the tags or limit prompt has focus
+func (m *model) updateAnsibleInput(msg tea.KeyMsg) tea.Cmd {
+	a := m.ans
+	switch msg.String() {
+	case "esc":
+		a.prompt.Blur()
+		return nil
+	case "enter":
+		a.prompt.Blur()
+		v := strings.TrimSpace(a.prompt.Value())
+		if a.promptFor == "tags" { a.tags = v } else { a.limit = v }
+		return nil
+	}
+	var cmd tea.Cmd
+	a.prompt, cmd = a.prompt.Update(msg)
+	return cmd
+}
+
+// updateAnsible handles the Ansible tab keys: left/right pick the list, up/down move,
+// enter runs the selected playbook (or shows an archived run), T and L set tags and
+// limit, c toggles check mode and u rescans
+func (m *model) updateAnsible(key string) (tea.Cmd, bool) {
+	a := m.ans
+	counts := []int{len(a.playbooks), len(a.inventories), len(a.runs)}
+	switch key {
+	case "left", "h":
+		a.section = (a.section + 2) % 3
+	case "right", "l":
+		a.section = (a.section + 1) % 3
+	case "up", "k":
+		if a.sel[a.section] > 0 { a.sel[a.section]-- }
+		if a.section == ansRuns && len(a.runs) > 0 { a.shown = a.runs[a.sel[ansRuns]] }
+	case "down", "j":
+		if a.sel[a.section] < counts[a.section]-1 { a.sel[a.section]++ }
+		if a.section == ansRuns && len(a.runs) > 0 { a.shown = a.runs[a.sel[ansRuns]] }
+	case "u":
+		m.refreshAnsible()
+		m.status = T("found %d playbooks in %s", len(a.playbooks), a.dir)
+	case "T", "L":
+		a.promptFor, a.prompt.Prompt = "tags", T("tags (comma separated): ")
+		a.prompt.SetValue(a.tags)
+		if key == "L" { a.promptFor, a.prompt.Prompt = "limit", T("limit (hosts or groups): "); a.prompt.SetValue(a.limit) }
+		a.prompt.CursorEnd()
+		return a.prompt.Focus(), true
+	case "c":
+		a.check = !a.check
+	case "enter":
+		if a.section == ansRuns {
+			if len(a.runs) > 0 { a.shown = a.runs[a.sel[ansRuns]] }
+			return nil, true
+		}
+		if len(a.playbooks) == 0 { m.status = T("no playbooks in %s", a.dir); return nil, true }
+		if a.runJob != "" { m.status = T("a playbook is already running"); return nil, true }
+		if m.denyReadOnly() { return nil, true }
+		m.ask(T("run %s?", strings.Join(a.command(), " ")), func(m *model) tea.Cmd { return m.runPlaybook() })
+	default:
+		return nil, false
+	}
+	return nil, true
+}
+
+// ansibleTabView renders the Ansible tab in w x h cells: the playbooks, inventories
+// and archived runs, the options, then the output of the current or selected run
+func (m model) ansibleTabView(w, h int) string {
+	a := m.ans
+	var b strings.Builder
+	b.WriteString(T("Ansible: %s", a.dir) + "\n")
+	rows := max(2, (h-8)/6)
+	section := func(i int, title string, items []string, label func(string) string) {
+		head := T(title)
+		if i == a.section { head = activeTabStyle.Render(head) } else { head = helpStyle.Render(head) }
+		b.WriteString(head + "\n")
+		if len(items) == 0 { b.WriteString("  " + helpStyle.Render(T("none")) + "\n") }
+		first := max(0, a.sel[i]-rows+1)
+		for j := first; j < len(items) && j < first+rows; j++ { b.WriteString(selMarker(i == a.section && j == a.sel[i]) + truncateCells(label(items[j]), max(10, w-2)) + "\n") }
+	}
+	same := func(s string) string { return s }
+	section(ansPlaybooks, "Playbooks", a.playbooks, same)
+	section(ansInventories, "Inventories", a.inventories, func(s string) string {
+		if s == "" { return T("(ansible.cfg default)") }
+		return s
+	})
+	section(ansRuns, "Runs", a.runs, func(s string) string { return filepath.Base(s) })
+	opts := T("tags: %s • limit: %s • check mode: %v", orNone(a.tags), orNone(a.limit), a.check)
+	if a.prompt.Focused() { opts = a.prompt.View() }
+	b.WriteString(opts + "\n")
+	log := a.shown
+	if log == "" { log = a.runLog }
+	if log == "" {
+		b.WriteString(helpStyle.Render(T("enter: run • ←/→: playbooks, inventories, runs • T/L: tags/limit • c: check mode • u: rescan")) + "\n")
+		return b.String()
+	}
+	out, _ := ioutil.ReadFile(log)
+	lines := strings.Split(strings.TrimRight(string(out), "\n"), "\n")
+	left := max(3, h-strings.Count(b.String(), "\n")-2)
+	if len(lines) > left { lines = lines[len(lines)-left:] }
+	title := filepath.Base(log)
+	if a.runJob != "" && log == a.runLog { title += " " + T("(running)") }
+	b.WriteString(helpStyle.Render(title) + "\n")
+	for _, l := range lines { b.WriteString(colorAnsibleLine(truncateCells(l, max(10, w)), m.plain) + "\n") }
+	return b.String()
+}
+
+func orNone(s string) string {
+	if s == "" { return T("none") }
+	return s
+}
+
+// colorAnsibleLine colors a line of play output by task status: ok green, changed
+// yellow, failed and unreachable red, skipped dim, play and task headers bold
+func colorAnsibleLine(l string, plain bool) string {
+	if plain { return l }
+	bold := lipgloss.NewStyle().Bold(true)
+	switch {
+	case strings.HasPrefix(l, "PLAY"), strings.HasPrefix(l, "TASK ["), strings.HasPrefix(l, "RUNNING HANDLER ["):
+		return bold.Render(l)
+	case strings.HasPrefix(l, "ok:"):
+		return diffAddStyle.Render(l)
+	case strings.HasPrefix(l, "changed:"):
+		return ansChangedStyle.Render(l)
+	case strings.HasPrefix(l, "fatal:"), strings.HasPrefix(l, "failed:"), strings.HasPrefix(l, "ERROR!"), strings.Contains(l, "UNREACHABLE!"):
+		return diffDelStyle.Render(l)
+	case strings.HasPrefix(l, "skipping:"), strings.HasPrefix(l, "included:"), strings.HasPrefix(l, "..."):
+		return helpStyle.Render(l)
+	}
+	if r := ansibleRecap.FindStringSubmatch(l); r != nil {
+		if r[2] != "0" || r[3] != "0" { return diffDelStyle.Render(l) }
+		if r[1] != "0" { return ansChangedStyle.Render(l) }
+		return diffAddStyle.Render(l)
+	}
+	return l
+}
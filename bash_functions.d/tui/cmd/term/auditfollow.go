@@ -0,0 +1,126 @@
+package main
+
+import (
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/fsnotify/fsnotify"
+)
+
+// auditFollow watches the audit store while follow mode is on. The directory is
+// watched so a log that is created, or rotated by renaming, is still seen.
+type auditFollow struct {
+	watcher *fsnotify.Watcher
+	path    string        // the audit log
+	watched string        // the file its store changes on each append
+	offset  int64         // bytes of the log already in auditContent
+	changed chan struct{} // coalesced: one pending notification is enough
+}
+
+// auditChangedMsg reports that the followed audit log grew
+type auditChangedMsg struct{ f *auditFollow }
+
+func newAuditFollow(path string, offset int64) (*auditFollow, error) {
+	var watched string
+	if err := withAuditStore(path, func(s AuditStore) error { watched = s.Watched(); return nil }); err != nil { return nil, err }
+	w, err := fsnotify.NewWatcher()
+	if err != nil { return nil, err }
+	if err := w.Add(filepath.Dir(watched)); err != nil { w.Close(); return nil, err }
+	f := &auditFollow{watcher: w, path: path, watched: watched, offset: offset, changed: make(chan struct{}, 1)}
+	go f.watch()
+	return f, nil
+}
+
+func (f *auditFollow) watch() {
+	defer close(f.changed)
+	for {
+		select {
+		case ev, ok := <-f.watcher.Events:
+			if !ok { return }
+			if ev.Name != f.watched || ev.Op == fsnotify.Chmod { continue }
+			select {
+			case f.changed <- struct{}{}:
+			default:
+			}
+		case err, ok := <-f.watcher.Errors:
+			if !ok { return }
+			slog.Debug("audit follow: watch error", "err", err)
+		}
+	}
+}
+
+func (f *auditFollow) stop() { f.watcher.Close() }
+
+// waitAuditChange delivers the next change of the followed log; nothing once stopped
+func waitAuditChange(f *auditFollow) tea.Cmd {
+	return func() tea.Msg {
+		if _, ok := <-f.changed; !ok { return nil }
+		return auditChangedMsg{f: f}
+	}
+}
+
+// readNew returns what was appended since the last read; reset is set when the log
+// shrank or was replaced, and text is then the whole file
+func (f *auditFollow) readNew() (text string, reset bool, err error) {
+	var size int64
+	err = withAuditStore(f.path, func(s AuditStore) error {
+		if text, size, err = s.Since(f.offset); err != nil || size >= f.offset { return err }
+		f.offset, reset = 0, true
+		text, size, err = s.Since(0)
+		return err
+	})
+	if err != nil { return "", false, err }
+	// keep a partly written last line for the next read
+	if i := strings.LastIndexByte(text, '\n'); i >= 0 { text = text[:i+1] } else { text = "" }
+	f.offset += int64(len(text))
+	return text, reset, nil
+}
+
+// toggleAuditFollow turns follow mode on or off. While on, the viewport shows the
+// audit log and new entries are appended as they are written.
+func (m *model) toggleAuditFollow() tea.Cmd {
+	if m.follow != nil {
+		m.follow.stop()
+		m.follow = nil
+		m.status = T("stopped following the audit log")
+		return nil
+	}
+	m.refreshAudit()
+	f, err := newAuditFollow(m.auditPath, int64(len(m.auditContent)))
+	if err != nil { m.status = T("cannot follow the audit log: %v", err); slog.Warn("audit follow failed", "err", err); return nil }
+	m.follow = f
+	m.panes.show(true, m.tabs[m.active], "Preview")
+	m.setContent(m.auditContent)
+	m.vp.GotoBottom()
+	m.status = T("following the audit log (f stops)")
+	return waitAuditChange(f)
+}
+
+// followAudit adds the entries written since the last change to the Audit tab and,
+// if it still shows the log, to the viewport
+func (m *model) followAudit(msg auditChangedMsg) tea.Cmd {
+	if msg.f != m.follow { return nil }
+	text, reset, err := m.follow.readNew()
+	if err != nil { slog.Debug("audit follow: read failed", "err", err); return waitAuditChange(m.follow) }
+	if text == "" && !reset { return waitAuditChange(m.follow) }
+	showing := m.vpContent == m.auditContent
+	if reset { m.auditContent = text } else { m.auditContent += text }
+	m.stats = computeStats(m.auditContent, time.Now())
+	if showing {
+		atBottom := m.vp.AtBottom()
+		m.setContent(m.auditContent)
+		if atBottom { m.vp.GotoBottom() }
+	}
+	return waitAuditChange(m.follow)
+}
+
+// auditTail is the end of the log that fits in the Audit tab while following
+func auditTail(content string, height int) string {
+	lines := strings.Split(strings.TrimRight(content, "\n"), "\n")
+	if height < 1 { height = 1 }
+	if len(lines) > height { lines = lines[len(lines)-height:] }
+	return strings.Join(lines, "\n")
+}
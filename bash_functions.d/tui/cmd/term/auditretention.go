@@ -0,0 +1,169 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// auditRetention bounds agent_audit.log. Entries older than MaxAgeDays, and the
+// oldest entries while the log is over MaxSizeMB, move to gzipped segments in
+// audit-archive/ next to the log. 0 keeps everything.
+type auditRetention struct {
+	MaxAgeDays int `json:"max_age_days,omitempty"`
+	MaxSizeMB  int `json:"max_size_mb,omitempty"`
+}
+
+func auditArchiveDir(auditPath string) string { return filepath.Join(filepath.Dir(auditPath), "audit-archive") }
+
+// auditDue is the cheap check run before compacting: the log's size, and the time of
+// its first entry, which is the oldest
+func auditDue(auditPath string, r auditRetention, now time.Time) bool {
+	var first string
+	var size int64
+	if err := withAuditStore(auditPath, func(s AuditStore) (err error) { first, size, err = s.Head(); return err }); err != nil { return false }
+	if r.MaxSizeMB > 0 && size > int64(r.MaxSizeMB)<<20 { return true }
+	if r.MaxAgeDays <= 0 { return false }
+	e, ok := parseAuditLine(first)
+	return ok && e.time.Before(now.AddDate(0, 0, -r.MaxAgeDays))
+}
+
+// splitRetained picks the lines to archive: every entry older than the age limit,
+// then the oldest entries until the rest fits in the size limit. Lines that do not
+// parse stay with the entry before them.
+func splitRetained(lines []string, r auditRetention, now time.Time) (old, keep []string) {
+	cut := 0
+	if r.MaxAgeDays > 0 {
+		limit := now.AddDate(0, 0, -r.MaxAgeDays)
+		for i, l := range lines {
+			e, ok := parseAuditLine(l)
+			if ok && !e.time.Before(limit) { break }
+			cut = i + 1
+		}
+	}
+	if r.MaxSizeMB > 0 {
+		size := 0
+		for _, l := range lines[cut:] { size += len(l) + 1 }
+		// trim to three quarters of the limit so compaction does not run on every append
+		for budget := (r.MaxSizeMB << 20) * 3 / 4; size > budget && cut < len(lines); cut++ { size -= len(lines[cut]) + 1 }
+	}
+	return lines[:cut], lines[cut:]
+}
+
+// compactAudit moves old entries into a new archive segment named after the time
+// range it covers. The store is held under the audit lock, so appendAudit waits for it.
+func compactAudit(auditPath string, r auditRetention, now time.Time) (segment string, moved int, err error) {
+	err = withAuditStore(auditPath, func(s AuditStore) error {
+		text, _, err := s.Since(0)
+		if err != nil || text == "" { return err }
+		lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+		old, _ := splitRetained(lines, r, now)
+		if len(old) == 0 { return nil }
+		first, last := now, now
+		if e, ok := parseAuditLine(old[0]); ok { first = e.time }
+		for i := len(old) - 1; i >= 0; i-- {
+			if e, ok := parseAuditLine(old[i]); ok { last = e.time; break }
+		}
+		dir := auditArchiveDir(auditPath)
+		if err := os.MkdirAll(dir, 0o700); err != nil { return err }
+		segment = filepath.Join(dir, fmt.Sprintf("agent_audit-%s-%s.log.gz", first.UTC().Format("20060102T150405"), last.UTC().Format("20060102T150405")))
+		if err := writeGzip(segment, strings.Join(old, "\n")+"\n"); err != nil { return err }
+		moved = len(old)
+		return s.Trim(len(old))
+	})
+	return segment, moved, err
+}
+
+func writeGzip(path, text string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil { return err }
+	zw := gzip.NewWriter(f)
+	if _, err := zw.Write([]byte(text)); err != nil { zw.Close(); f.Close(); os.Remove(path); return err }
+	if err := zw.Close(); err != nil { f.Close(); os.Remove(path); return err }
+	return f.Close()
+}
+
+func readGzip(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil { return "", err }
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil { return "", err }
+	defer zr.Close()
+	b, err := ioutil.ReadAll(zr)
+	return string(b), err
+}
+
+// maybeCompactAudit applies the retention policy when the log is due; the scheduler
+// calls it every tick and the TUI at startup
+func maybeCompactAudit(auditPath string, r auditRetention) {
+	now := time.Now()
+	if !auditDue(auditPath, r, now) { return }
+	segment, moved, err := compactAudit(auditPath, r, now)
+	if err != nil { slog.Warn("audit compaction failed", "path", auditPath, "err", err); return }
+	if moved > 0 { slog.Info("audit compacted", "archived", moved, "segment", segment) }
+}
+
+// archiveItem is one archived segment in the Audit tab's archive browser
+type archiveItem struct {
+	path string
+	size int64
+}
+
+func (i archiveItem) Title() string { return strings.TrimSuffix(filepath.Base(i.path), ".log.gz") }
+func (i archiveItem) Description() string { return humanSize(i.size) + " " + T("compressed") }
+func (i archiveItem) FilterValue() string { return filepath.Base(i.path) }
+
+// auditArchives lists the segments, newest first
+func auditArchives(auditPath string) []list.Item {
+	fis, _ := ioutil.ReadDir(auditArchiveDir(auditPath))
+	var items []list.Item
+	for _, fi := range fis {
+		if strings.HasSuffix(fi.Name(), ".log.gz") { items = append(items, archiveItem{path: filepath.Join(auditArchiveDir(auditPath), fi.Name()), size: fi.Size()}) }
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].(archiveItem).path > items[j].(archiveItem).path })
+	return items
+}
+
+// openAuditArchives shows the archived segments in the Audit tab
+func (m *model) openAuditArchives() {
+	items := auditArchives(m.auditPath)
+	if len(items) == 0 { m.status = T("no archived audit segments in %s", auditArchiveDir(m.auditPath)); return }
+	l := list.New(items, list.NewDefaultDelegate(), 40, m.height-8)
+	if m.plain { l.SetDelegate(plainDelegate{}) }
+	l.Title = T("Audit archive")
+	l.SetShowHelp(false)
+	m.archives = &l
+	m.status = T("enter shows a segment, esc goes back")
+}
+
+// updateAuditArchives handles keys in the archive browser
+func (m *model) updateAuditArchives(msg tea.KeyMsg) tea.Cmd {
+	switch msg.String() {
+	case "esc":
+		m.archives = nil
+		m.status = ""
+		return nil
+	case "enter":
+		sel, ok := m.archives.SelectedItem().(archiveItem)
+		if !ok { return nil }
+		text, err := readGzip(sel.path)
+		if err != nil { m.status = T("cannot read %s: %v", filepath.Base(sel.path), err); slog.Warn("audit archive unreadable", "path", sel.path, "err", err); return nil }
+		m.panes.show(true, m.tabs[m.active], "Preview")
+		m.setContent(text)
+		m.status = T("%s: %d entries", sel.Title(), strings.Count(text, "\n"))
+		return nil
+	}
+	var cmd tea.Cmd
+	*m.archives, cmd = m.archives.Update(msg)
+	return cmd
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"net"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The exec broker runs agents with --exec on behalf of other processes. It runs as
+// the account that owns the agents' privileges and decides from the caller's
+// identity (the socket's peer credentials, not its environment) whether the agent
+// may be run, so exporting SSH_ALLOWED_EXEC grants nothing. When a broker socket is
+// configured every exec run goes through it.
+//
+// A caller acts for its own account unless it presents a ticket. Tickets are issued
+// to trusted peers only (the account wish-server or the gateway runs as), for the SSH
+// user they authenticated, and handed to that user's session on an inherited
+// descriptor named by CBW_BROKER_TICKET_FD. The session keeps it in memory: in the
+// environment any process of the account could read it from /proc.
+
+const defaultBrokerSocket = "/run/cbw/broker.sock"
+
+// brokerTicketTTL is how long a ticket lasts when its session does not revoke it
+const brokerTicketTTL = 24 * time.Hour
+
+// brokerRequest is one call to the broker. User is whom op "ticket" issues a ticket
+// for; runs and grants name another user only through Ticket.
+type brokerRequest struct {
+	Op     string `json:"op"` // "run", "grants", "ticket" or "revoke"
+	Agent  string `json:"agent,omitempty"`
+	User   string `json:"user,omitempty"`
+	Ticket string `json:"ticket,omitempty"`
+}
+
+type brokerReply struct {
+	Lines  outputLines `json:"lines,omitempty"`
+	Exit   int         `json:"exit"`
+	Error  string      `json:"error,omitempty"`
+	Grants []string    `json:"grants,omitempty"`
+	Ticket string      `json:"ticket,omitempty"`
+}
+
+// brokerServing is set in the broker itself, which runs agents locally
+var brokerServing bool
+
+// sessionTicket is the broker ticket a server handed this session, "" when none
+var sessionTicket string
+
+// loadSessionTicket reads the ticket from the descriptor CBW_BROKER_TICKET_FD names
+// and closes it, before any child could inherit it
+func loadSessionTicket() {
+	fd, err := strconv.Atoi(os.Getenv("CBW_BROKER_TICKET_FD"))
+	os.Unsetenv("CBW_BROKER_TICKET_FD")
+	if err != nil || fd < 3 { return }
+	f := os.NewFile(uintptr(fd), "broker-ticket")
+	if f == nil { return }
+	defer f.Close()
+	b, err := io.ReadAll(io.LimitReader(f, 4<<10))
+	if err != nil { slog.Warn("broker ticket unreadable", "err", err); return }
+	sessionTicket = strings.TrimSpace(string(b))
+}
+
+// ticketPipe returns the read end of a pipe holding ticket, for a child to inherit
+// as its CBW_BROKER_TICKET_FD; the caller closes it once the child has started
+func ticketPipe(ticket string) (*os.File, error) {
+	r, w, err := os.Pipe()
+	if err != nil { return nil, err }
+	_, err = w.WriteString(ticket)
+	w.Close()
+	if err != nil { r.Close(); return nil, err }
+	return r, nil
+}
+
+// brokerSocket is the broker clients use: CBW_BROKER_SOCKET, else broker_socket in
+// config.json; "" runs exec locally, checked against SSH_ALLOWED_EXEC only
+func brokerSocket() string {
+	if brokerServing { return "" }
+	if s := os.Getenv("CBW_BROKER_SOCKET"); s != "" { return s }
+	return loadConfig().BrokerSocket
+}
+
+// allowEntry is a wish-server allowlist entry
+type allowEntry struct {
+	User        string     `json:"user"`
+	PubKey      string     `json:"pubkey"`
+	AllowedExec []string   `json:"allowed_exec,omitempty"`
+	IsAdmin     bool       `json:"is_admin,omitempty"`
+	Roles       []string   `json:"roles,omitempty"`
+	ReadOnly    bool       `json:"read_only,omitempty"`
+	Quota       *quotaSpec `json:"quota,omitempty"`
+}
+
+func loadAllowlist(path string) ([]allowEntry, error) {
+	var arr []allowEntry
+	b, err := ioutil.ReadFile(path)
+	if err != nil { return nil, err }
+	if err := json.Unmarshal(b, &arr); err != nil { return nil, fmt.Errorf("%s: %w", path, err) }
+	return arr, nil
+}
+
+// execGrants is what user may exec: the allowlist's allowed_exec plus the agents
+// whose manifest ACL names the user or one of the entry's roles. Users without an
+// allowlist entry only get agents that name them, read_only entries nothing.
+func execGrants(user string, allow []allowEntry, mf agentManifest) []string {
+	var roles, out []string
+	seen := map[string]bool{}
+	add := func(a string) { if !seen[a] { seen[a] = true; out = append(out, a) } }
+	for _, e := range allow {
+		if e.User != user { continue }
+		if e.ReadOnly { return nil }
+		for _, a := range e.AllowedExec { add(a) }
+		roles = e.Roles
+		if e.IsAdmin { roles = append(append([]string{}, roles...), "admin") }
+		break
+	}
+	for _, a := range mf.Agents {
+		if a.Exec == nil { continue }
+		for _, u := range a.Exec.Users { if u == user { add(a.Name) } }
+		for _, r := range a.Exec.Roles {
+			for _, have := range roles { if r == have { add(a.Name) } }
+		}
+	}
+	return out
+}
+
+// brokerServer holds the broker's policy; the allowlist and manifest are read per
+// request so edits apply without a restart
+type brokerServer struct {
+	allowPath string
+	trusted   map[string]bool // peers that may have tickets issued for other users
+	auditPath string
+	mu        sync.Mutex
+	tickets   map[string]brokerTicket
+}
+
+type brokerTicket struct {
+	user    string
+	expires time.Time
+}
+
+// issue makes a ticket for user, dropping the expired ones
+func (s *brokerServer) issue(user string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil { return "", err }
+	t := hex.EncodeToString(b)
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, v := range s.tickets { if now.After(v.expires) { delete(s.tickets, k) } }
+	s.tickets[t] = brokerTicket{user: user, expires: now.Add(brokerTicketTTL)}
+	return t, nil
+}
+
+// ticketUser is the user a live ticket was issued for
+func (s *brokerServer) ticketUser(t string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.tickets[t]
+	if !ok || time.Now().After(v.expires) { return "", false }
+	return v.user, true
+}
+
+func (s *brokerServer) grants(user string) ([]string, error) {
+	allow, err := loadAllowlist(s.allowPath)
+	if err != nil && !os.IsNotExist(err) { return nil, err }
+	mf, err := loadManifest()
+	if err != nil && !os.IsNotExist(err) { return nil, err }
+	return execGrants(user, allow, mf), nil
+}
+
+func (s *brokerServer) serve(conn net.Conn) {
+	defer conn.Close()
+	reply := func(r brokerReply) { json.NewEncoder(conn).Encode(r) }
+	peer, err := peerUser(conn)
+	if err != nil { slog.Warn("broker: unknown peer", "err", err); reply(brokerReply{Exit: 1, Error: "cannot identify caller: " + err.Error()}); return }
+	conn.SetReadDeadline(time.Now().Add(ctlTimeout))
+	var req brokerRequest
+	if err := json.NewDecoder(conn).Decode(&req); err != nil { reply(brokerReply{Exit: 1, Error: err.Error()}); return }
+	conn.SetReadDeadline(time.Time{})
+	user := peer
+	switch {
+	case req.Op == "ticket" || req.Op == "revoke":
+		if !s.trusted[peer] { slog.Warn("broker: untrusted peer asked for a ticket", "peer", peer, "user", req.User); reply(brokerReply{Exit: 1, Error: fmt.Sprintf("%s may not issue tickets", peer)}); return }
+		if req.Op == "revoke" {
+			s.mu.Lock()
+			delete(s.tickets, req.Ticket)
+			s.mu.Unlock()
+			reply(brokerReply{})
+			return
+		}
+		if req.User == "" { reply(brokerReply{Exit: 1, Error: "ticket: no user"}); return }
+		t, err := s.issue(req.User)
+		if err != nil { reply(brokerReply{Exit: 1, Error: err.Error()}); return }
+		slog.Info("broker: ticket issued", "user", req.User, "peer", peer)
+		reply(brokerReply{Ticket: t})
+		return
+	case req.Ticket != "":
+		u, ok := s.ticketUser(req.Ticket)
+		if !ok { slog.Warn("broker: unknown or expired ticket", "peer", peer); reply(brokerReply{Exit: 1, Error: "unknown or expired broker ticket"}); return }
+		user = u
+	case req.User != "" && req.User != peer:
+		slog.Warn("broker: peer named a user without a ticket", "peer", peer, "user", req.User)
+		reply(brokerReply{Exit: 1, Error: fmt.Sprintf("%s may not act for %s", peer, req.User)})
+		return
+	}
+	grants, err := s.grants(user)
+	if err != nil { slog.Error("broker: policy unreadable", "err", err); reply(brokerReply{Exit: 1, Error: err.Error()}); return }
+	switch req.Op {
+	case "grants":
+		reply(brokerReply{Grants: grants})
+		return
+	case "run":
+	default:
+		reply(brokerReply{Exit: 1, Error: fmt.Sprintf("unknown op %q", req.Op)})
+		return
+	}
+	allowed := false
+	for _, g := range grants { if g == req.Agent { allowed = true } }
+	now := time.Now().Format(time.RFC3339)
+	if !allowed {
+		appendAudit(s.auditPath, fmt.Sprintf("%s\tagent=%s\texec=true\tdenied=true\tsource=broker\tuser=%s\tpeer=%s", now, req.Agent, user, peer))
+		reply(brokerReply{Exit: 1, Error: errExecNotPermitted.Error()})
+		return
+	}
+	start := time.Now()
+	out, code, runErr := runAgentCapture(traceCtx, req.Agent, true)
+	appendAudit(s.auditPath, fmt.Sprintf("%s\tagent=%s\texec=true\texit=%d\terror=%v\tsource=broker\tuser=%s\tpeer=%s\tduration=%s", now, req.Agent, code, runErr, user, peer, time.Since(start).Round(time.Millisecond))+sandboxAudit(req.Agent, true))
+	r := brokerReply{Lines: out, Exit: code}
+	if runErr != nil { r.Error = runErr.Error() }
+	reply(r)
+}
+
+// callBroker sends one request and waits for the reply; runs take as long as the agent
+func callBroker(ctx context.Context, sock string, req brokerRequest) (brokerReply, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", sock)
+	if err != nil { return brokerReply{}, fmt.Errorf("exec broker: %w", err) }
+	defer conn.Close()
+	if dl, ok := ctx.Deadline(); ok { conn.SetDeadline(dl) }
+	if err := json.NewEncoder(conn).Encode(req); err != nil { return brokerReply{}, fmt.Errorf("exec broker: %w", err) }
+	var r brokerReply
+	if err := json.NewDecoder(conn).Decode(&r); err != nil { return brokerReply{}, fmt.Errorf("exec broker: %w", err) }
+	return r, nil
+}
+
+// brokerRun runs agent with --exec through the broker, like runAgentScript
+func brokerRun(ctx context.Context, sock, agent string) (outputLines, int, error) {
+	r, err := callBroker(ctx, sock, brokerRequest{Op: "run", Agent: agent, Ticket: sessionTicket})
+	if err != nil { return nil, 1, err }
+	if r.Error != "" { return r.Lines, r.Exit, errors.New(r.Error) }
+	return r.Lines, r.Exit, nil
+}
+
+// issueBrokerTicket asks the broker for a ticket for user, for a server to hand to the
+// session it starts for user. It only works for the accounts the broker trusts.
+func issueBrokerTicket(sock, user string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), ctlTimeout)
+	defer cancel()
+	r, err := callBroker(ctx, sock, brokerRequest{Op: "ticket", User: user})
+	if err != nil { return "", err }
+	if r.Error != "" { return "", errors.New(r.Error) }
+	return r.Ticket, nil
+}
+
+// revokeBrokerTicket ends a session's ticket
+func revokeBrokerTicket(sock, ticket string) {
+	ctx, cancel := context.WithTimeout(context.Background(), ctlTimeout)
+	defer cancel()
+	if r, err := callBroker(ctx, sock, brokerRequest{Op: "revoke", Ticket: ticket}); err != nil || r.Error != "" { slog.Warn("broker ticket not revoked", "err", err, "reply", r.Error) }
+}
+
+var brokerGrantsCache struct {
+	sync.Once
+	grants []string
+	err    error
+}
+
+// brokerGrants asks the broker once per process what this user may exec
+func brokerGrants(sock string) ([]string, error) {
+	c := &brokerGrantsCache
+	c.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), ctlTimeout)
+		defer cancel()
+		r, err := callBroker(ctx, sock, brokerRequest{Op: "grants", Ticket: sessionTicket})
+		if err == nil && r.Error != "" { err = errors.New(r.Error) }
+		c.grants, c.err = r.Grants, err
+	})
+	return c.grants, c.err
+}
+
+const brokerUsage = `usage: term broker <command> [flags]
+
+  serve [-socket path] [-allowlist path] [-trust users]   run the exec broker
+  run <agent>                                            run an agent with --exec through the broker
+  grants                                                 list the agents the broker lets you exec
+`
+
+// runBroker implements `term broker`
+func runBroker(args []string) int {
+	if len(args) < 1 { fmt.Fprint(os.Stderr, brokerUsage); return 2 }
+	switch args[0] {
+	case "serve":
+		return serveBroker(args[1:])
+	case "run", "grants":
+		sock := brokerSocket()
+		if sock == "" { sock = defaultBrokerSocket }
+		if args[0] == "grants" {
+			g, err := brokerGrants(sock)
+			if err != nil { fmt.Fprintln(os.Stderr, err); return 1 }
+			for _, a := range g { fmt.Println(a) }
+			return 0
+		}
+		if len(args) != 2 { fmt.Fprint(os.Stderr, brokerUsage); return 2 }
+		out, code, err := brokerRun(context.Background(), sock, args[1])
+		for _, l := range out { if l.Err { fmt.Fprintln(os.Stderr, l.Text) } else { fmt.Println(l.Text) } }
+		if err != nil { fmt.Fprintln(os.Stderr, err); if code == 0 { code = 1 } }
+		return code
+	}
+	fmt.Fprint(os.Stderr, brokerUsage)
+	return 2
+}
+
+func serveBroker(args []string) int {
+	fs := flag.NewFlagSet("broker serve", flag.ExitOnError)
+	sock := fs.String("socket", defaultBrokerSocket, "unix socket to listen on; its directory must exist")
+	allowPath := fs.String("allowlist", allowlistPath(), "wish-server allowlist with allowed_exec, is_admin and roles")
+	trust := fs.String("trust", "", "comma-separated accounts that may have tickets issued for other users: the account wish-server or the gateway runs as, never one sessions get a shell as")
+	fs.Parse(args)
+	brokerServing = true
+	cfg := loadConfig()
+	defer setupLogging(cfg.Log, "broker", false)()
+	if cfg.Tracing { defer setupTracing("cbw-broker")() }
+
+	s := &brokerServer{allowPath: *allowPath, trusted: map[string]bool{}, auditPath: filepath.Join(tuiDataDir(), "agent_audit.log"), tickets: map[string]brokerTicket{}}
+	for _, u := range strings.Split(*trust, ",") { if u = strings.TrimSpace(u); u != "" { s.trusted[u] = true } }
+	os.MkdirAll(tuiDataDir(), 0o700)
+	os.Remove(*sock)
+	l, err := net.Listen("unix", *sock)
+	if err != nil { slog.Error("broker: listen failed", "socket", *sock, "err", err); return 1 }
+	defer os.Remove(*sock)
+	// anyone may connect; the peer credentials decide what they may run
+	if err := os.Chmod(*sock, 0o666); err != nil { slog.Error("broker: socket not opened to callers", "socket", *sock, "err", err); l.Close(); return 1 }
+	slog.Info("exec broker listening", "socket", *sock, "allowlist", *allowPath)
+	for {
+		conn, err := l.Accept()
+		if err != nil { slog.Error("broker: accept failed", "err", err); return 1 }
+		go s.serve(conn)
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// event bus kinds; a busConfig's events may name a kind or its prefix ("agent")
+const (
+	BusAgentQueued    = "agent.queued"
+	BusAgentStarted   = "agent.started"
+	BusAgentFinished  = "agent.finished"
+	BusRequestCreated = "request.created"
+	BusRequestDecided = "request.decided"
+	BusSessionStarted = "session.started"
+	BusSessionEnded   = "session.ended"
+)
+
+// busConfig publishes events as JSON to a NATS subject or MQTT topic; see config.json
+type busConfig struct {
+	URL         string   `json:"url"`             // nats://, tls:// (NATS over TLS), mqtt:// or mqtts://
+	Topic       string   `json:"topic,omitempty"` // prefix; the kind is appended (default cbw.events, cbw/events for MQTT)
+	Username    string   `json:"username,omitempty"`
+	PasswordEnv string   `json:"password_env,omitempty"` // env var holding the password
+	Events      []string `json:"events,omitempty"`       // default: every event
+}
+
+// busEvent is the JSON body of a published event
+type busEvent struct {
+	Kind     string `json:"kind"`
+	Time     string `json:"time"`
+	Host     string `json:"host"`
+	ID       string `json:"id,omitempty"` // job, request or schedule id
+	Agent    string `json:"agent,omitempty"`
+	Exec     bool   `json:"exec,omitempty"`
+	User     string `json:"user,omitempty"`
+	State    string `json:"state,omitempty"`
+	Exit     *int   `json:"exit,omitempty"`   // only once an agent has run
+	Source   string `json:"source,omitempty"` // job, scheduler or request
+	Notes    string `json:"notes,omitempty"`
+	By       string `json:"by,omitempty"` // approver
+	Decision string `json:"decision,omitempty"`
+	Remote   string `json:"remote,omitempty"`
+	PID      int    `json:"pid,omitempty"`
+}
+
+// busTimeout bounds a whole publish, connect included, so a dead broker only
+// delays the caller briefly
+const busTimeout = 3 * time.Second
+
+func (c *busConfig) wants(kind string) bool {
+	if c == nil || c.URL == "" { return false }
+	if len(c.Events) == 0 { return true }
+	for _, e := range c.Events { if e == kind || strings.HasPrefix(kind, e+".") { return true } }
+	return false
+}
+
+// emitEvent publishes ev on the bus configured in config.json and reports whether it
+// went out; failures are only logged, the bus never stops an agent or a session
+func emitEvent(ev busEvent) bool {
+	cfg := loadConfig().Notify.Bus
+	if !cfg.wants(ev.Kind) { return false }
+	if ev.Time == "" { ev.Time = time.Now().Format(time.RFC3339) }
+	ev.Host, _ = os.Hostname()
+	if err := publishBus(*cfg, ev); err != nil { slog.Warn("event bus publish failed", "kind", ev.Kind, "id", ev.ID, "err", err); return false }
+	return true
+}
+
+// busQueueSize bounds the events waiting for emitEventAsync's goroutine; past it
+// they are dropped
+const busQueueSize = 64
+
+var busQueue struct {
+	once    sync.Once
+	ch      chan busEvent
+	pending sync.WaitGroup
+}
+
+// emitEventAsync hands ev to a goroutine that emits it, for callers on the TUI's
+// update loop, which must not wait for a connect to the bus. A full queue drops ev.
+func emitEventAsync(ev busEvent) {
+	q := &busQueue
+	q.once.Do(func() {
+		q.ch = make(chan busEvent, busQueueSize)
+		go func() {
+			for ev := range q.ch { emitEvent(ev); q.pending.Done() }
+		}()
+	})
+	ev.Time = time.Now().Format(time.RFC3339)
+	q.pending.Add(1)
+	select {
+	case q.ch <- ev:
+	default:
+		q.pending.Done()
+		slog.Warn("event bus queue full, event dropped", "kind", ev.Kind, "id", ev.ID)
+	}
+}
+
+// flushBus waits up to d for the queued events to go out, so the program does not
+// exit on the events of jobs it just started
+func flushBus(d time.Duration) {
+	done := make(chan struct{})
+	go func() { busQueue.pending.Wait(); close(done) }()
+	select {
+	case <-done:
+	case <-time.After(d):
+	}
+}
+
+// emitJobEvent announces a job by its state: queued, started, or finished (also lost)
+func emitJobEvent(j job) {
+	ev := busEvent{ID: j.ID, Agent: j.Agent, Exec: j.Exec, User: j.User, State: j.State, Source: "job"}
+	switch j.State {
+	case JobQueued:
+		ev.Kind = BusAgentQueued
+	case JobRunning:
+		ev.Kind, ev.PID = BusAgentStarted, j.PID
+	default:
+		code := j.Exit
+		ev.Kind, ev.Exit = BusAgentFinished, &code
+	}
+	emitEventAsync(ev)
+}
+
+func publishBus(cfg busConfig, ev busEvent) error {
+	u, err := url.Parse(cfg.URL)
+	if err != nil { return err }
+	body, err := json.Marshal(ev)
+	if err != nil { return err }
+	password := ""
+	if cfg.PasswordEnv != "" { password = os.Getenv(cfg.PasswordEnv) }
+	switch u.Scheme {
+	case "nats", "tls":
+		topic := cfg.Topic
+		if topic == "" { topic = "cbw.events" }
+		return publishNATS(u, cfg.Username, password, topic+"."+ev.Kind, body)
+	case "mqtt", "mqtts":
+		topic := cfg.Topic
+		if topic == "" { topic = "cbw/events" }
+		return publishMQTT(u, cfg.Username, password, topic+"/"+strings.ReplaceAll(ev.Kind, ".", "/"), body)
+	}
+	return fmt.Errorf("unknown event bus scheme %q", u.Scheme)
+}
+
+// busDial connects to u's host, with TLS when asked, within busTimeout
+func busDial(u *url.URL, port string, useTLS bool) (net.Conn, error) {
+	addr := u.Host
+	if u.Port() == "" { addr = net.JoinHostPort(u.Hostname(), port) }
+	d := &net.Dialer{Timeout: busTimeout}
+	var c net.Conn
+	var err error
+	if useTLS { c, err = tls.DialWithDialer(d, "tcp", addr, &tls.Config{ServerName: u.Hostname()}) } else { c, err = d.Dial("tcp", addr) }
+	if err != nil { return nil, err }
+	c.SetDeadline(time.Now().Add(busTimeout))
+	return c, nil
+}
+
+// publishNATS speaks just enough of the NATS client protocol to publish once: read
+// INFO, CONNECT, PUB, then PING so any -ERR arrives before the PONG
+func publishNATS(u *url.URL, user, password, subject string, body []byte) error {
+	c, err := busDial(u, "4222", false)
+	if err != nil { return err }
+	defer c.Close()
+	r := bufio.NewReader(c)
+	info, err := r.ReadString('\n')
+	if err != nil { return err }
+	if !strings.HasPrefix(info, "INFO ") { return fmt.Errorf("nats: unexpected greeting %q", strings.TrimSpace(info)) }
+	var conn net.Conn = c
+	// NATS upgrades to TLS after the plain INFO line
+	if u.Scheme == "tls" {
+		tc := tls.Client(c, &tls.Config{ServerName: u.Hostname()})
+		if err := tc.Handshake(); err != nil { return err }
+		conn, r = tc, bufio.NewReader(tc)
+	}
+	opts := map[string]interface{}{"verbose": false, "pedantic": false, "name": "cbw", "lang": "go", "version": version}
+	if user != "" { opts["user"], opts["pass"] = user, password }
+	ob, _ := json.Marshal(opts)
+	msg := fmt.Sprintf("CONNECT %s\r\nPUB %s %d\r\n%s\r\nPING\r\n", ob, subject, len(body), body)
+	if _, err := conn.Write([]byte(msg)); err != nil { return err }
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil { return err }
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "PONG":
+			return nil
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("nats: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+	}
+}
+
+// publishMQTT sends one QoS 0 PUBLISH in an MQTT 3.1.1 session
+func publishMQTT(u *url.URL, user, password, topic string, body []byte) error {
+	port := "1883"
+	if u.Scheme == "mqtts" { port = "8883" }
+	c, err := busDial(u, port, u.Scheme == "mqtts")
+	if err != nil { return err }
+	defer c.Close()
+	id, err := randomToken()
+	if err != nil { return err }
+	// clean session, 60s keepalive
+	flags := byte(0x02)
+	payload := mqttString(nil, "cbw-"+id[:16])
+	if user != "" { flags |= 0x80; payload = mqttString(payload, user) }
+	if user != "" && password != "" { flags |= 0x40; payload = mqttString(payload, password) }
+	connect := append(mqttString(nil, "MQTT"), 4, flags, 0, 60)
+	if _, err := c.Write(mqttPacket(0x10, append(connect, payload...))); err != nil { return err }
+	ack := make([]byte, 4)
+	if _, err := io.ReadFull(c, ack); err != nil { return err }
+	if ack[0] != 0x20 { return errors.New("mqtt: no CONNACK") }
+	if ack[3] != 0 { return fmt.Errorf("mqtt: connection refused (code %d)", ack[3]) }
+	if _, err := c.Write(mqttPacket(0x30, append(mqttString(nil, topic), body...))); err != nil { return err }
+	_, err = c.Write([]byte{0xe0, 0})
+	return err
+}
+
+// mqttString appends s with its 16-bit length prefix
+func mqttString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// mqttPacket frames rest behind a fixed header with its variable-length size
+func mqttPacket(typ byte, rest []byte) []byte {
+	b := []byte{typ}
+	n := len(rest)
+	for {
+		d := byte(n % 128)
+		n /= 128
+		if n > 0 { d |= 0x80 }
+		b = append(b, d)
+		if n == 0 { break }
+	}
+	return append(b, rest...)
+}
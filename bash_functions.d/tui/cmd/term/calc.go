@@ -0,0 +1,291 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// The command palette's calculator: arithmetic with + - * / % ^, parentheses, a few
+// functions and constants, and conversions such as "3*1024 MiB in GB" or "98.6 F to C".
+
+// unit is a unit of measure: factor converts it to the base unit of its dimension
+// (bytes, seconds, meters, grams, liters). Temperatures are converted separately.
+type unit struct {
+	dim    string
+	factor float64
+}
+
+var units = map[string]unit{}
+
+func init() {
+	add := func(dim string, factor float64, names ...string) {
+		for _, n := range names { units[n] = unit{dim, factor} }
+	}
+	add("data", 1, "B", "byte", "bytes")
+	add("data", 0.125, "bit", "bits")
+	for i, p := range []string{"K", "M", "G", "T", "P", "E"} {
+		add("data", math.Pow(1000, float64(i+1)), p+"B")
+		add("data", math.Pow(1024, float64(i+1)), p+"iB")
+		add("data", math.Pow(1000, float64(i+1))/8, p+"bit")
+	}
+	units["kB"] = units["KB"]
+	add("time", 1e-9, "ns")
+	add("time", 1e-6, "us", "µs")
+	add("time", 1e-3, "ms")
+	add("time", 1, "s", "sec", "secs", "second", "seconds")
+	add("time", 60, "min", "mins", "minute", "minutes")
+	add("time", 3600, "h", "hr", "hrs", "hour", "hours")
+	add("time", 86400, "d", "day", "days")
+	add("time", 7*86400, "wk", "week", "weeks")
+	add("time", 365*86400, "y", "yr", "year", "years")
+	add("length", 1e-3, "mm")
+	add("length", 1e-2, "cm")
+	add("length", 1, "m", "meter", "meters")
+	add("length", 1e3, "km")
+	add("length", 0.0254, "in", "inch", "inches")
+	add("length", 0.3048, "ft", "foot", "feet")
+	add("length", 0.9144, "yd", "yard", "yards")
+	add("length", 1609.344, "mi", "mile", "miles")
+	add("mass", 1e-3, "mg")
+	add("mass", 1, "g", "gram", "grams")
+	add("mass", 1e3, "kg")
+	add("mass", 1e6, "t", "tonne", "tonnes")
+	add("mass", 28.349523125, "oz")
+	add("mass", 453.59237, "lb", "lbs", "pound", "pounds")
+	add("volume", 1e-3, "ml", "mL")
+	add("volume", 1, "l", "L", "liter", "liters")
+	add("volume", 3.785411784, "gal", "gallon", "gallons")
+	for _, n := range []string{"C", "°C", "celsius", "F", "°F", "fahrenheit", "K", "kelvin"} { add("temperature", 1, n) }
+}
+
+// lookupUnit finds a unit by its exact name, or a lowercase name case-insensitively
+// ("gib", "mb" for MB); bit and temperature units are only matched exactly
+func lookupUnit(name string) (string, unit, bool) {
+	if u, ok := units[name]; ok { return name, u, true }
+	if len(name) < 2 || name != strings.ToLower(name) { return "", unit{}, false }
+	found := ""
+	for n, u := range units {
+		// KB and kB both match "kb"; take the same one every time
+		if strings.EqualFold(n, name) && !strings.HasSuffix(n, "bit") && u.dim != "temperature" && (found == "" || n < found) { found = n }
+	}
+	if found == "" { return "", unit{}, false }
+	return found, units[found], true
+}
+
+// conversion is "<expression> <unit> in|to|as <unit>"
+var conversion = regexp.MustCompile(`^(.*?)\s*([A-Za-zµ°]+)\s+(?:in|to|as)\s+([A-Za-zµ°]+)$`)
+
+// calculate evaluates a palette entry: an expression, or an expression with a unit
+// converted to another unit. It returns the number and the result as shown.
+func calculate(s string) (float64, string, error) {
+	s = strings.TrimSpace(s)
+	if c := conversion.FindStringSubmatch(s); c != nil {
+		v, err := evalExpr(c[1])
+		if err != nil { return 0, "", err }
+		fromName, from, ok := lookupUnit(c[2])
+		if !ok { return 0, "", errors.New(T("unknown unit %q", c[2])) }
+		toName, to, ok := lookupUnit(c[3])
+		if !ok { return 0, "", errors.New(T("unknown unit %q", c[3])) }
+		if from.dim != to.dim { return 0, "", errors.New(T("cannot convert %s to %s", T(from.dim), T(to.dim))) }
+		if from.dim == "temperature" {
+			v = fromKelvin(toKelvin(v, fromName), toName)
+		} else {
+			v = v * from.factor / to.factor
+		}
+		return v, formatNumber(v) + " " + toName, nil
+	}
+	v, err := evalExpr(s)
+	if err != nil { return 0, "", err }
+	return v, formatNumber(v), nil
+}
+
+func toKelvin(v float64, u string) float64 {
+	switch strings.TrimPrefix(strings.ToLower(u), "°") {
+	case "c", "celsius":
+		return v + 273.15
+	case "f", "fahrenheit":
+		return (v-32)*5/9 + 273.15
+	}
+	return v
+}
+
+func fromKelvin(v float64, u string) float64 {
+	switch strings.TrimPrefix(strings.ToLower(u), "°") {
+	case "c", "celsius":
+		return v - 273.15
+	case "f", "fahrenheit":
+		return (v-273.15)*9/5 + 32
+	}
+	return v
+}
+
+// formatNumber prints integers in full and other values to 12 significant digits,
+// so 0.1+0.2 is 0.3
+func formatNumber(v float64) string {
+	if v == math.Trunc(v) && math.Abs(v) < 1e18 { return strconv.FormatFloat(v, 'f', 0, 64) }
+	return strconv.FormatFloat(v, 'g', 12, 64)
+}
+
+var calcFuncs = map[string]func(float64) float64{
+	"sqrt": math.Sqrt, "abs": math.Abs, "floor": math.Floor, "ceil": math.Ceil, "round": math.Round,
+	"ln": math.Log, "log": math.Log10, "log2": math.Log2, "exp": math.Exp,
+	"sin": math.Sin, "cos": math.Cos, "tan": math.Tan,
+}
+
+var calcConsts = map[string]float64{"pi": math.Pi, "e": math.E}
+
+// evalExpr evaluates an arithmetic expression. ^ and ** are powers and bind tighter
+// than a leading minus, so -2^2 is -4; numbers may be hex (0x), binary (0b) and use
+// _ as a digit separator.
+func evalExpr(s string) (float64, error) {
+	p := &calcParser{src: []rune(s)}
+	v, err := p.expr()
+	if err != nil { return 0, err }
+	p.space()
+	if p.pos < len(p.src) { return 0, errors.New(T("unexpected %q", string(p.src[p.pos:]))) }
+	if math.IsNaN(v) || math.IsInf(v, 0) { return 0, errors.New(T("result is not a number")) }
+	return v, nil
+}
+
+type calcParser struct {
+	src []rune
+	pos int
+}
+
+func (p *calcParser) space() {
+	for p.pos < len(p.src) && unicode.IsSpace(p.src[p.pos]) { p.pos++ }
+}
+
+// eat consumes tok if it comes next
+func (p *calcParser) eat(tok string) bool {
+	p.space()
+	if strings.HasPrefix(string(p.src[p.pos:]), tok) { p.pos += len([]rune(tok)); return true }
+	return false
+}
+
+func (p *calcParser) expr() (float64, error) {
+	v, err := p.term()
+	for err == nil {
+		switch {
+		case p.eat("+"):
+			var r float64
+			r, err = p.term()
+			v += r
+		case p.eat("-"):
+			var r float64
+			r, err = p.term()
+			v -= r
+		default:
+			return v, nil
+		}
+	}
+	return 0, err
+}
+
+func (p *calcParser) term() (float64, error) {
+	v, err := p.unary()
+	for err == nil {
+		var op rune
+		switch {
+		case p.eat("*"):
+			op = '*'
+		case p.eat("/"):
+			op = '/'
+		case p.eat("%"):
+			op = '%'
+		default:
+			return v, nil
+		}
+		var r float64
+		if r, err = p.unary(); err != nil { break }
+		switch {
+		case op == '*':
+			v *= r
+		case r == 0:
+			return 0, errors.New(T("division by zero"))
+		case op == '/':
+			v /= r
+		default:
+			v = math.Mod(v, r)
+		}
+	}
+	return 0, err
+}
+
+func (p *calcParser) unary() (float64, error) {
+	if p.eat("-") {
+		v, err := p.unary()
+		return -v, err
+	}
+	if p.eat("+") { return p.unary() }
+	return p.power()
+}
+
+func (p *calcParser) power() (float64, error) {
+	v, err := p.primary()
+	if err != nil { return 0, err }
+	if p.eat("^") || p.eat("**") {
+		r, err := p.unary()
+		if err != nil { return 0, err }
+		return math.Pow(v, r), nil
+	}
+	return v, nil
+}
+
+func (p *calcParser) primary() (float64, error) {
+	p.space()
+	if p.pos >= len(p.src) { return 0, errors.New(T("incomplete expression")) }
+	c := p.src[p.pos]
+	switch {
+	case c == '(':
+		p.pos++
+		v, err := p.expr()
+		if err != nil { return 0, err }
+		if !p.eat(")") { return 0, errors.New(T("missing )")) }
+		return v, nil
+	case unicode.IsDigit(c) || c == '.':
+		return p.number()
+	case unicode.IsLetter(c):
+		start := p.pos
+		for p.pos < len(p.src) && (unicode.IsLetter(p.src[p.pos]) || unicode.IsDigit(p.src[p.pos])) { p.pos++ }
+		name := strings.ToLower(string(p.src[start:p.pos]))
+		if f, ok := calcFuncs[name]; ok {
+			if !p.eat("(") { return 0, errors.New(T("%s needs parentheses", name)) }
+			v, err := p.expr()
+			if err != nil { return 0, err }
+			if !p.eat(")") { return 0, errors.New(T("missing )")) }
+			return f(v), nil
+		}
+		if v, ok := calcConsts[name]; ok { return v, nil }
+		return 0, errors.New(T("unknown name %q", name))
+	}
+	return 0, errors.New(T("unexpected %q", string(c)))
+}
+
+func (p *calcParser) number() (float64, error) {
+	start := p.pos
+	rest := strings.ToLower(string(p.src[p.pos:]))
+	base := 10
+	if strings.HasPrefix(rest, "0x") { base = 16 } else if strings.HasPrefix(rest, "0b") { base = 2 }
+	if base != 10 {
+		p.pos += 2
+		for p.pos < len(p.src) && (strings.ContainsRune("0123456789abcdefABCDEF_", p.src[p.pos])) { p.pos++ }
+		n, err := strconv.ParseUint(strings.ReplaceAll(string(p.src[start+2:p.pos]), "_", ""), base, 64)
+		if err != nil { return 0, errors.New(T("bad number %q", string(p.src[start:p.pos]))) }
+		return float64(n), nil
+	}
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		exp := (c == 'e' || c == 'E') && p.pos+1 < len(p.src) && (unicode.IsDigit(p.src[p.pos+1]) || strings.ContainsRune("+-", p.src[p.pos+1]))
+		if !(unicode.IsDigit(c) || c == '.' || c == '_' || exp) { break }
+		if exp { p.pos++ }
+		p.pos++
+	}
+	v, err := strconv.ParseFloat(strings.ReplaceAll(string(p.src[start:p.pos]), "_", ""), 64)
+	if err != nil { return 0, errors.New(T("bad number %q", string(p.src[start:p.pos]))) }
+	return v, nil
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// sumFiles are the names of checksum lists covering a whole directory
+var sumFiles = []string{"SHA256SUMS", "sha256sums.txt", "MD5SUMS", "md5sums.txt"}
+
+// checksumResult is the SHA-256 and MD5 of one file and, when an expected value was
+// known, whether it matched
+type checksumResult struct {
+	path        string
+	sha256, md5 string
+	expect      string // expected hex, SHA-256 or MD5 by its length; "" when none
+	from        string // the list expect was read from, or "the value entered"
+	err         error
+}
+
+// expectedSum is the value a file should hash to and where it was found
+type expectedSum struct{ sum, from string }
+
+func (r checksumResult) ok() bool { return r.err == nil && (r.expect == r.sha256 || r.expect == r.md5) }
+
+// checksumRun hashes files in the background; the UI polls its progress with
+// checksumTickMsg until done
+type checksumRun struct {
+	files  []string
+	expect map[string]expectedSum // by path
+	total  int64
+	read   atomic.Int64
+	cur    atomic.Value // name of the file being read
+	cancel context.CancelFunc
+	mu     sync.Mutex
+	res    []checksumResult
+	done   bool
+}
+
+type checksumTickMsg struct{ r *checksumRun }
+
+func checksumTick(r *checksumRun) tea.Cmd {
+	return tea.Tick(250*time.Millisecond, func(time.Time) tea.Msg { return checksumTickMsg{r} })
+}
+
+// progressReader counts what is read through it into n
+type progressReader struct {
+	ctx context.Context
+	r   io.Reader
+	n   *atomic.Int64
+}
+
+func (p progressReader) Read(b []byte) (int, error) {
+	if err := p.ctx.Err(); err != nil { return 0, err }
+	k, err := p.r.Read(b)
+	p.n.Add(int64(k))
+	return k, err
+}
+
+// startChecksums hashes files one after the other; expect maps paths to the value
+// they should have
+func startChecksums(files []string, expect map[string]expectedSum) *checksumRun {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &checksumRun{files: files, expect: expect, cancel: cancel}
+	r.cur.Store("")
+	for _, f := range files {
+		if fi, err := os.Stat(f); err == nil { r.total += fi.Size() }
+	}
+	go func() {
+		for _, f := range files {
+			r.cur.Store(filepath.Base(f))
+			res := hashFile(ctx, f, &r.read)
+			res.expect, res.from = r.expect[f].sum, r.expect[f].from
+			r.mu.Lock()
+			r.res = append(r.res, res)
+			r.mu.Unlock()
+			if ctx.Err() != nil { break }
+		}
+		r.mu.Lock()
+		r.done = true
+		r.mu.Unlock()
+	}()
+	return r
+}
+
+// hashFile reads path once for both sums
+func hashFile(ctx context.Context, path string, n *atomic.Int64) checksumResult {
+	res := checksumResult{path: path}
+	f, err := os.Open(path)
+	if err != nil { res.err = err; return res }
+	defer f.Close()
+	s, m := sha256.New(), md5.New()
+	if _, err := io.Copy(io.MultiWriter(s, m), progressReader{ctx, f, n}); err != nil { res.err = err; return res }
+	res.sha256, res.md5 = hex.EncodeToString(s.Sum(nil)), hex.EncodeToString(m.Sum(nil))
+	return res
+}
+
+// progress is the status line of a run still going, e.g. "hashing big.iso: 42% (1.1G of 2.6G)"
+func (r *checksumRun) progress() string {
+	read := r.read.Load()
+	if r.total == 0 { return T("hashing %s", r.cur.Load()) }
+	return T("hashing %s: %d%% (%s of %s), esc cancels", r.cur.Load(), read*100/r.total, humanSize(read), humanSize(r.total))
+}
+
+// parseChecksum takes a bare hex value or the first field of a sha256sum line and
+// checks it has the length of a SHA-256 or an MD5
+func parseChecksum(s string) (string, error) {
+	f := strings.Fields(s)
+	if len(f) == 0 { return "", errors.New(T("no checksum given")) }
+	v := strings.ToLower(strings.TrimPrefix(f[0], "\\"))
+	if _, err := hex.DecodeString(v); err != nil || len(v) != 64 && len(v) != 32 { return "", errors.New(T("%q is not a SHA-256 or MD5 checksum", f[0])) }
+	return v, nil
+}
+
+// readSumFile reads a checksum list: sha256sum/md5sum lines ("hex  name", "hex *name")
+// or BSD ones ("SHA256 (name) = hex"). Names are resolved against the list's directory.
+func readSumFile(path string) (map[string]expectedSum, error) {
+	f, err := os.Open(path)
+	if err != nil { return nil, err }
+	defer f.Close()
+	dir := filepath.Dir(path)
+	sums := map[string]expectedSum{}
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") { continue }
+		var name, sum string
+		if i := strings.LastIndex(line, ") = "); i > 0 && strings.Contains(line[:i], " (") {
+			name, sum = line[strings.Index(line, " (")+2:i], line[i+4:]
+		} else if h, rest, ok := strings.Cut(line, " "); ok {
+			sum, name = h, strings.TrimPrefix(strings.TrimPrefix(rest, " "), "*")
+		} else {
+			// a bare value, as in file.iso.sha256: it is the sum of file.iso
+			sum, name = line, strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		}
+		v, err := parseChecksum(sum)
+		if err != nil { continue }
+		if !filepath.IsAbs(name) { name = filepath.Join(dir, name) }
+		sums[filepath.Clean(name)] = expectedSum{v, filepath.Base(path)}
+	}
+	if err := sc.Err(); err != nil { return nil, err }
+	if len(sums) == 0 { return nil, errors.New(T("%s has no checksums", filepath.Base(path))) }
+	return sums, nil
+}
+
+// isSumFile reports whether path is a checksum list, whose files H verifies
+func isSumFile(path string) bool {
+	base := filepath.Base(path)
+	for _, n := range sumFiles { if base == n { return true } }
+	ext := filepath.Ext(base)
+	return ext == ".sha256" || ext == ".md5"
+}
+
+// knownChecksums looks for published sums of files next to them: file.sha256,
+// file.md5 or a SHA256SUMS/MD5SUMS list in the same directory
+func knownChecksums(files []string) map[string]expectedSum {
+	expect := map[string]expectedSum{}
+	for _, f := range files {
+		var lists []string
+		for _, ext := range []string{".sha256", ".md5"} { lists = append(lists, f+ext) }
+		for _, n := range sumFiles { lists = append(lists, filepath.Join(filepath.Dir(f), n)) }
+		for _, l := range lists {
+			sums, err := readSumFile(l)
+			if err != nil { continue }
+			if v, ok := sums[filepath.Clean(f)]; ok {
+				expect[f] = v
+				break
+			}
+		}
+	}
+	return expect
+}
+
+// checksumTargets are the marked files, or else the selected one
+func (m *model) checksumTargets() []string {
+	if len(m.files.marked) > 0 { return append([]string(nil), m.files.marked...) }
+	if sel, ok := m.list.SelectedItem().(fileItem); ok && !sel.isDir { return []string{sel.path} }
+	return nil
+}
+
+// runChecksums starts hashing files unless a run is still going
+func (m *model) runChecksums(files []string, expect map[string]expectedSum) tea.Cmd {
+	if m.sums != nil && !m.sums.finished() { m.status = T("still hashing: esc cancels"); return nil }
+	if len(files) == 0 { m.status = T("select a file or mark some with m"); return nil }
+	m.sums = startChecksums(files, expect)
+	m.status = m.sums.progress()
+	return checksumTick(m.sums)
+}
+
+// checksumSelected hashes the marked or selected files, checked against any sums
+// published next to them; a checksum list itself has its files verified instead
+func (m *model) checksumSelected() tea.Cmd {
+	if sel, ok := m.list.SelectedItem().(fileItem); ok && len(m.files.marked) == 0 && !sel.isDir && isSumFile(sel.path) {
+		sums, err := readSumFile(sel.path)
+		if err != nil { m.status = T("cannot read %s: %v", sel.name, err); return nil }
+		files := make([]string, 0, len(sums))
+		for f := range sums { files = append(files, f) }
+		sort.Strings(files)
+		return m.runChecksums(files, sums)
+	}
+	files := m.checksumTargets()
+	return m.runChecksums(files, knownChecksums(files))
+}
+
+func (r *checksumRun) finished() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.done
+}
+
+// checksumTicked shows the progress of the run, or its results once it is done
+func (m *model) checksumTicked(r *checksumRun) tea.Cmd {
+	if r != m.sums { return nil }
+	if !r.finished() { m.status = r.progress(); return checksumTick(r) }
+	m.showChecksums(r)
+	return nil
+}
+
+// showChecksums lists the sums in a Preview pane in sha256sum format and puts the
+// verdict in the status line
+func (m *model) showChecksums(r *checksumRun) {
+	r.mu.Lock()
+	res := append([]checksumResult(nil), r.res...)
+	r.mu.Unlock()
+	var b strings.Builder
+	var checked, failed, from []string
+	for _, c := range res {
+		if c.err != nil { fmt.Fprintf(&b, "%s: %v\n\n", c.path, c.err); failed = append(failed, filepath.Base(c.path)); continue }
+		fmt.Fprintf(&b, "SHA-256  %s  %s\nMD5      %s  %s\n", c.sha256, c.path, c.md5, c.path)
+		if c.expect != "" {
+			checked = append(checked, filepath.Base(c.path))
+			if len(from) == 0 || from[len(from)-1] != c.from { from = append(from, c.from) }
+			verdict, style := T("OK"), diffAddStyle
+			if !c.ok() {
+				verdict, style = T("FAILED: expected %s", c.expect), diffDelStyle
+				failed = append(failed, filepath.Base(c.path))
+			}
+			if !m.plain { verdict = style.Render(verdict) }
+			fmt.Fprintf(&b, "%s  %s\n", T("checked against %s:", c.from), verdict)
+		}
+		b.WriteString("\n")
+	}
+	if len(res) < len(r.files) { b.WriteString(T("cancelled after %d of %d files", len(res), len(r.files)) + "\n") }
+	m.panes.show(true, m.tabs[m.active], "Preview")
+	m.setContent(b.String())
+	m.lastOutput = b.String()
+	m.vp.GotoTop()
+	switch {
+	case len(failed) > 0:
+		m.status = T("✗ FAILED: %s", strings.Join(failed, ", "))
+		if !m.plain { m.status = diffDelStyle.Render(m.status) }
+	case len(checked) > 0:
+		m.status = T("✓ %d of %d checksums match (%s)", len(checked), len(res), strings.Join(from, ", "))
+		if !m.plain { m.status = diffAddStyle.Render(m.status) }
+	default:
+		m.status = T("checksums of %d files: no expected value to check them against (V enters one)", len(res))
+	}
+}
+
+// cancelChecksums stops a run still going
+func (m *model) cancelChecksums() bool {
+	if m.sums == nil || m.sums.finished() { return false }
+	m.sums.cancel()
+	m.status = T("cancelling checksums")
+	return true
+}
+
+func newChecksumInput() textinput.Model {
+	ti := textinput.New()
+	ti.Prompt = T("expected SHA-256 or MD5: ")
+	ti.CharLimit = 200
+	return ti
+}
+
+// updateChecksumInput handles keys while the V prompt has focus: enter hashes the
+// selected file and compares it with the value typed or pasted
+func (m *model) updateChecksumInput(msg tea.KeyMsg) tea.Cmd {
+	switch msg.String() {
+	case "esc":
+		m.sumInput.Blur()
+		return nil
+	case "enter":
+		v, err := parseChecksum(m.sumInput.Value())
+		if err != nil { m.status = err.Error(); return nil }
+		m.sumInput.Blur()
+		files := m.checksumTargets()
+		if len(files) != 1 { m.status = T("an expected value checks one file: unmark the others"); return nil }
+		return m.runChecksums(files, map[string]expectedSum{files[0]: {v, T("the value entered")}})
+	}
+	var cmd tea.Cmd
+	m.sumInput, cmd = m.sumInput.Update(msg)
+	return cmd
+}
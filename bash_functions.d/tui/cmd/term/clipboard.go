@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// osc52 builds the OSC 52 escape sequence asking the terminal emulator to place s
+// on the system clipboard. This works over plain SSH/wish sessions because the
+// client terminal, not the server, owns the clipboard.
+func osc52(s string) string {
+	seq := "\x1b]52;c;" + base64.StdEncoding.EncodeToString([]byte(s)) + "\x07"
+	// tmux and screen swallow OSC sequences unless wrapped in a DCS passthrough
+	if os.Getenv("TMUX") != "" {
+		return "\x1bPtmux;\x1b" + seq + "\x1b\\"
+	}
+	if strings.HasPrefix(os.Getenv("TERM"), "screen") {
+		return "\x1bP" + seq + "\x1b\\"
+	}
+	return seq
+}
+
+// clipboardMsg reports the outcome of a copyToClipboard command
+type clipboardMsg struct {
+	what string
+	n    int
+	err  error
+}
+
+// copyToClipboard writes the OSC 52 sequence for s to out and records s in the
+// clipboard history. out must be the terminal the program renders to (os.Stdout
+// locally, the session for wish).
+func copyToClipboard(out io.Writer, what, s string) tea.Cmd {
+	return func() tea.Msg {
+		if s == "" { return clipboardMsg{what: what, err: fmt.Errorf("nothing to copy")} }
+		_, err := io.WriteString(out, osc52(s))
+		if err == nil {
+			if herr := recordClip(what, s); herr != nil { slog.Warn("cannot record clipboard history", "err", herr) }
+		}
+		return clipboardMsg{what: what, n: len(s), err: err}
+	}
+}
+
+// copySecret is copyToClipboard for secrets, which stay out of the history
+func copySecret(out io.Writer, what, s string) tea.Cmd {
+	return func() tea.Msg {
+		if s == "" { return clipboardMsg{what: what, err: fmt.Errorf("nothing to copy")} }
+		_, err := io.WriteString(out, osc52(s))
+		return clipboardMsg{what: what, n: len(s), err: err}
+	}
+}
+
+// selection is whatever is most relevant for the active tab: the selected file path,
+// request ID, host address or vault entry, or the viewport contents. secret is set
+// for vault entries.
+func (m *model) selection() (what, text string, secret bool) {
+	switch m.tabs[m.active] {
+	case "Files":
+		if sel, ok := m.list.SelectedItem().(fileItem); ok { return "path", sel.path, false }
+	case "Requests":
+		if sel, ok := m.requestsList.SelectedItem().(requestItem); ok { return "request id", sel.ID, false }
+	case "Hosts":
+		if sel, ok := m.hostsList.SelectedItem().(hostItem); ok { return "host address", sel.h.target(), false }
+	case "Vault":
+		e, _ := m.selectedVaultEntry()
+		return e.Name, e.Value, true
+	}
+	return "viewport", m.vpContent, false
+}
+
+// copySelection copies the selection of the active tab
+func (m *model) copySelection() tea.Cmd {
+	what, text, secret := m.selection()
+	if secret { return copySecret(m.termOut, what, text) }
+	return copyToClipboard(m.termOut, what, text)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// maxClips is how many copies the clipboard history keeps, newest first
+const maxClips = 200
+
+// clip is one copy made in the TUI: what was copied and where it came from
+type clip struct {
+	Text string `json:"text"`
+	What string `json:"what"` // path, request id, viewport, last output...
+	Time string `json:"time"`
+}
+
+func (c clip) Title() string {
+	first := strings.TrimSpace(strings.SplitN(strings.TrimSpace(c.Text), "\n", 2)[0])
+	if n := strings.Count(strings.TrimRight(c.Text, "\n"), "\n"); n > 0 { first += T(" (+%d lines)", n) }
+	return truncateCells(first, 100)
+}
+func (c clip) Description() string {
+	when := c.Time
+	if t, err := time.Parse(time.RFC3339, c.Time); err == nil { when = t.Format("2006-01-02 15:04") }
+	return T(c.What) + " · " + when + " · " + humanSize(int64(len(c.Text)))
+}
+func (c clip) FilterValue() string { return c.What + " " + c.Text }
+
+// clipsPath is the per-user clipboard history
+func clipsPath() string { return filepath.Join(tuiDataDir(), "clipboard_history.json") }
+
+func loadClips() []clip {
+	var clips []clip
+	if b, err := ioutil.ReadFile(clipsPath()); err == nil { _ = json.Unmarshal(b, &clips) }
+	return clips
+}
+
+func saveClips(clips []clip) error {
+	b, err := json.MarshalIndent(clips, "", "  ")
+	if err != nil { return err }
+	if err := os.MkdirAll(tuiDataDir(), 0o700); err != nil { return err }
+	tmp := clipsPath() + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0o600); err != nil { return err }
+	return os.Rename(tmp, clipsPath())
+}
+
+// recordClip puts text at the top of the history; copying it again moves it there
+// instead of adding a duplicate
+func recordClip(what, text string) error {
+	return withLock("clipboard", func() error {
+		clips := []clip{{Text: text, What: what, Time: time.Now().Format(time.RFC3339)}}
+		for _, c := range loadClips() {
+			if c.Text != text { clips = append(clips, c) }
+		}
+		if len(clips) > maxClips { clips = clips[:maxClips] }
+		return saveClips(clips)
+	})
+}
+
+// removeClip drops text from the history
+func removeClip(text string) error {
+	return withLock("clipboard", func() error {
+		var clips []clip
+		for _, c := range loadClips() {
+			if c.Text != text { clips = append(clips, c) }
+		}
+		return saveClips(clips)
+	})
+}
+
+// clipPicker is the clipboard history overlay opened with alt+y; target is the tab
+// it was opened from, where p pastes into the Shell input and elsewhere into the editor
+type clipPicker struct {
+	list   list.Model
+	target string
+}
+
+func (m *model) openClipPicker() {
+	items := []list.Item{}
+	for _, c := range loadClips() { items = append(items, c) }
+	l := list.New(items, list.NewDefaultDelegate(), 60, m.height-10)
+	l.Title = T("Clipboard history")
+	l.SetShowHelp(false)
+	if m.plain { l.SetDelegate(plainDelegate{}); l.Styles.Title = lipgloss.NewStyle() }
+	m.clips = &clipPicker{list: l, target: m.tabs[m.active]}
+	m.status = T("enter: copy again • p: paste into the editor or shell • x: remove • /: search • esc: close")
+}
+
+// updateClipPicker handles keys while the history is open; / searches, enter copies
+// the entry again, p pastes it and x removes it
+func (m *model) updateClipPicker(msg tea.KeyMsg) tea.Cmd {
+	p := m.clips
+	filtering := p.list.SettingFilter()
+	c, ok := p.list.SelectedItem().(clip)
+	if !filtering {
+		switch msg.String() {
+		case "esc":
+			if p.list.IsFiltered() { break }
+			m.clips = nil
+			return nil
+		case "q":
+			m.clips = nil
+			return nil
+		case "enter":
+			if !ok { return nil }
+			m.clips = nil
+			return copyToClipboard(m.termOut, c.What, c.Text)
+		case "p":
+			if !ok { return nil }
+			m.clips = nil
+			m.pasteClip(c, p.target)
+			return nil
+		case "x":
+			if !ok { return nil }
+			if err := removeClip(c.Text); err != nil { m.status = T("cannot update clipboard history: %v", err); slog.Warn("cannot update clipboard history", "err", err); return nil }
+			items := []list.Item{}
+			for _, c := range loadClips() { items = append(items, c) }
+			cmd := p.list.SetItems(items)
+			m.status = T("removed from clipboard history")
+			return cmd
+		}
+	}
+	var cmd tea.Cmd
+	p.list, cmd = p.list.Update(msg)
+	return cmd
+}
+
+// pasteClip appends c to the Shell input, folded into one command line, when the
+// history was opened from Shell and inserts it at the editor cursor otherwise
+func (m *model) pasteClip(c clip, target string) {
+	if target == "Shell" {
+		m.ti.SetValue(m.ti.Value() + joinShellLines(c.Text))
+		m.ti.CursorEnd()
+		m.status = T("pasted into the shell input")
+		return
+	}
+	if m.editorRO { m.status = T("%s is read-only; alt+w to edit", m.editorFile); return }
+	m.ta.InsertString(c.Text)
+	m.active = m.tabIndex("Editor")
+	m.status = T("pasted into the editor")
+}
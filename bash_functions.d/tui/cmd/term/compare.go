@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// compareMsg carries a fresh dry-run of agent for comparison with its last exec
+type compareMsg struct {
+	agent string
+	out   string
+	code  int
+	err   error
+}
+
+// compareAgent dry-runs agent in the background; the result is shown next to the
+// output of the agent's most recent exec job so approvers see what would change
+func compareAgent(agent string) tea.Cmd {
+	return func() tea.Msg {
+		out, code, err := runAgentScript(traceCtx, agent, false)
+		return compareMsg{agent: agent, out: out, code: code, err: err}
+	}
+}
+
+// lastExecJob returns the newest finished exec job of agent
+func lastExecJob(agent string) (job, bool) {
+	jobs := loadJobs()
+	for i := len(jobs) - 1; i >= 0; i-- {
+		j := jobs[i]
+		if j.Agent == agent && j.Exec && j.Script == "" && (j.State == JobFinished || j.State == JobLost) { return j, true }
+	}
+	return job{}, false
+}
+
+// renderComparison lays the dry-run and the last exec output out side by side in
+// width columns, or one after the other in plain mode
+func renderComparison(msg compareMsg, width int, plain bool) string {
+	left := T("Dry run (now, exit %d)", msg.code) + "\n\n" + msg.out
+	right := T("No previous exec run of %s.", msg.agent)
+	if j, ok := lastExecJob(msg.agent); ok {
+		right = T("Last exec (%s, %s, exit %d)", j.Finished, j.ID, j.Exit) + "\n\n" + readJobLog(j)
+	}
+	if plain || width < 40 { return left + "\n\n" + right }
+	cw := (width - 3) / 2
+	col := lipgloss.NewStyle().Width(cw)
+	sep := lipgloss.NewStyle().Border(lipgloss.NormalBorder(), false, true, false, false).BorderForeground(lipgloss.AdaptiveColor{Light: "250", Dark: "238"})
+	return lipgloss.JoinHorizontal(lipgloss.Top, sep.Render(col.Render(left)), " ", col.Render(right))
+}
+
+// showComparison displays a finished comparison beside the current tab and audits
+// the dry run
+func (m *model) showComparison(msg compareMsg) {
+	appendAudit(m.auditPath, fmt.Sprintf("%s\tagent=%s\texec=false\texit=%d\terror=%v\tmode=compare", time.Now().Format(time.RFC3339), msg.agent, msg.code, msg.err))
+	m.panes.show(true, m.tabs[m.active], "Preview")
+	m.setContent(renderComparison(msg, m.vp.Width, m.plain))
+	m.lastOutput = msg.out
+	m.status = T("dry run of %s compared with its last exec", msg.agent)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// tuiConfig holds user settings read from config.json in the TUI data dir.
+// Missing fields keep their defaults.
+type tuiConfig struct {
+	OutputDir string `json:"output_dir,omitempty"`
+	Locale    string `json:"locale,omitempty"` // UI language, e.g. "es"; defaults to $LANG
+	Plain     bool   `json:"plain,omitempty"`  // screen-reader friendly rendering, same as --plain
+	Theme     string `json:"theme,omitempty"`  // "auto" (query the terminal), "dark" or "light"
+	Author    string `json:"author,omitempty"` // fills the Author field of new-file templates
+	Notify    notifyConfig `json:"notify,omitempty"` // announce new requests (used by `term scheduler`)
+	StartTab  string `json:"start_tab,omitempty"` // tab shown at startup
+	Tracing   bool   `json:"tracing,omitempty"`   // export OpenTelemetry spans, same as --trace
+	Log       logConfig `json:"log,omitempty"`
+	Mux       []muxTemplate `json:"mux,omitempty"` // session templates for the Mux tab
+	PreviewCacheMB int `json:"preview_cache_mb,omitempty"` // memory for rendered previews (default 16)
+	Keys      string `json:"keys,omitempty"` // key profile: "vim" adds vim motions and a modal editor
+	CrewParallel int `json:"crew_parallel,omitempty"` // crew members of a stage run at once (default 4)
+	BrokerSocket string `json:"broker_socket,omitempty"` // exec broker; when set, --exec runs go through it
+	InsecureEnvExec bool `json:"insecure_env_exec,omitempty"` // without a broker, trust SSH_ALLOWED_EXEC for --exec
+	Allowlist string `json:"allowlist,omitempty"` // wish-server allowlist edited in the Admin tab
+	Audit     auditRetention `json:"audit,omitempty"` // when old audit entries move to compressed archives
+	Storage   storageConfig `json:"storage,omitempty"` // where requests and the audit log are kept
+	DownloadDir string `json:"download_dir,omitempty"` // where the YouTube tab saves downloads (default ~/Downloads)
+	AnsibleDir string `json:"ansible_dir,omitempty"` // where the Ansible tab looks for playbooks (default the cwd)
+	TerraformDir string `json:"terraform_dir,omitempty"` // where the Terraform tab looks for configurations (default the cwd)
+	Password  passwordConfig `json:"password,omitempty"` // defaults of the palette's password generator
+	GPGKey    string `json:"gpg_key,omitempty"` // key P signs with (default gpg's default key)
+	Age       ageConfig `json:"age,omitempty"` // recipients and identity of X in the Files tab
+	Openers   map[string][]opener `json:"openers,omitempty"` // programs o opens files with, by extension or media type
+	LLM       llmConfig `json:"llm,omitempty"` // model that drafts agents (G in Agents) and suggests commands (? in Shell)
+}
+
+// tuiDataDir is where the TUI keeps requests, audit and per-user state
+func tuiDataDir() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".bash_functions_d", "tui")
+}
+
+func defaultConfig() tuiConfig {
+	return tuiConfig{OutputDir: filepath.Join(tuiDataDir(), "output"), Theme: "auto", Author: os.Getenv("USER"), StartTab: "Dashboard", Audit: auditRetention{MaxAgeDays: 90, MaxSizeMB: 10}}
+}
+
+// loadConfig reads config.json, falling back to defaults if it is absent or invalid
+func loadConfig() tuiConfig {
+	cfg := defaultConfig()
+	b, err := ioutil.ReadFile(filepath.Join(tuiDataDir(), "config.json"))
+	if err != nil { return cfg }
+	if err := json.Unmarshal(b, &cfg); err != nil { return defaultConfig() }
+	cfg.OutputDir = expandHome(cfg.OutputDir)
+	cfg.DownloadDir = expandHome(cfg.DownloadDir)
+	cfg.AnsibleDir = expandHome(cfg.AnsibleDir)
+	cfg.TerraformDir = expandHome(cfg.TerraformDir)
+	cfg.Password.Wordlist = expandHome(cfg.Password.Wordlist)
+	cfg.Age.RecipientsFile = expandHome(cfg.Age.RecipientsFile)
+	cfg.Age.Identity = expandHome(cfg.Age.Identity)
+	return cfg
+}
+
+// expandHome turns a leading ~/ into the user's home directory
+func expandHome(p string) string {
+	if p == "~" || len(p) > 1 && p[:2] == "~/" {
+		home, _ := os.UserHomeDir()
+		return filepath.Join(home, p[1:])
+	}
+	return p
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+var (
+	dialogStyle       = lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).BorderForeground(lipgloss.AdaptiveColor{Light: "162", Dark: "205"}).Padding(1, 2)
+	dialogButtonStyle = lipgloss.NewStyle().Padding(0, 1)
+	dialogActiveStyle = lipgloss.NewStyle().Padding(0, 1).Bold(true).Reverse(true)
+)
+
+// maxDialogWidth is the widest a dialog gets on a wide terminal
+const maxDialogWidth = 72
+
+type dialogKind int
+
+const (
+	dialogYesNo dialogKind = iota
+	dialogInput
+	dialogChoice
+)
+
+// dialog is a modal question drawn over the tab: yes/no, a line of text or one of
+// several choices. It takes every key until it is answered or dismissed with esc, and
+// nothing runs on a stray key: enter on a yes/no dialog answers the selected button,
+// which starts on No.
+type dialog struct {
+	kind    dialogKind
+	title   string
+	body    string   // what the action will do, above the question
+	choices []string // the buttons of a yes/no dialog, the options of a choice dialog
+	sel     int
+	input   textinput.Model
+	expect  string // what an input dialog needs typed before it accepts, e.g. the name of what goes
+	yes     func(m *model) tea.Cmd
+	text    func(m *model, s string) tea.Cmd
+	choose  func(m *model, i int) tea.Cmd
+}
+
+// ask asks a yes/no question and runs yes on yes
+func (m *model) ask(question string, yes func(m *model) tea.Cmd) { m.askDetail(question, "", yes) }
+
+// askDetail is ask with a body saying what yes will do
+func (m *model) askDetail(title, body string, yes func(m *model) tea.Cmd) {
+	m.dialog = &dialog{kind: dialogYesNo, title: title, body: body, choices: []string{T("Yes"), T("No")}, sel: 1, yes: yes}
+}
+
+// askText asks for a line of text, empty allowed, and passes it to text on enter
+func (m *model) askText(title, body, placeholder string, text func(m *model, s string) tea.Cmd) tea.Cmd {
+	m.dialog = &dialog{kind: dialogInput, title: title, body: body, input: newDialogInput(placeholder), text: text}
+	return m.dialog.input.Focus()
+}
+
+// askTyped runs yes only once expect has been typed, for actions too large to take
+// back on a single key
+func (m *model) askTyped(title, body, expect string, yes func(m *model) tea.Cmd) tea.Cmd {
+	m.dialog = &dialog{kind: dialogInput, title: title, body: body + "\n\n" + T("Type %s to confirm.", expect), input: newDialogInput(expect), expect: expect, yes: yes}
+	return m.dialog.input.Focus()
+}
+
+// askChoice offers choices and passes the index of the chosen one to choose; esc
+// chooses nothing
+func (m *model) askChoice(title, body string, choices []string, choose func(m *model, i int) tea.Cmd) {
+	m.dialog = &dialog{kind: dialogChoice, title: title, body: body, choices: choices, choose: choose}
+}
+
+func newDialogInput(placeholder string) textinput.Model {
+	ti := textinput.New()
+	ti.Prompt = "> "
+	ti.Placeholder = placeholder
+	ti.CharLimit = 500
+	return ti
+}
+
+// answer handles a key while a dialog is open
+func (m *model) answer(msg tea.KeyMsg) tea.Cmd {
+	d := m.dialog
+	key := msg.String()
+	switch key {
+	case "ctrl+c":
+		return tea.Quit
+	case "esc":
+		m.dismissDialog()
+		return nil
+	}
+	switch d.kind {
+	case dialogInput:
+		if key != "enter" {
+			var cmd tea.Cmd
+			d.input, cmd = d.input.Update(msg)
+			return cmd
+		}
+		v := strings.TrimSpace(d.input.Value())
+		if d.expect != "" && v != d.expect { m.status = T("type %s to confirm, or esc to cancel", d.expect); return nil }
+		m.dialog, m.status = nil, ""
+		if d.text != nil { return d.text(m, v) }
+		return d.yes(m)
+	case dialogChoice:
+		switch key {
+		case "up", "k", "shift+tab":
+			if d.sel > 0 { d.sel-- }
+		case "down", "j", "tab":
+			if d.sel < len(d.choices)-1 { d.sel++ }
+		case "enter":
+			m.dialog, m.status = nil, ""
+			return d.choose(m, d.sel)
+		default:
+			if n, err := strconv.Atoi(key); err == nil && n >= 1 && n <= len(d.choices) {
+				m.dialog, m.status = nil, ""
+				return d.choose(m, n-1)
+			}
+		}
+		return nil
+	}
+	switch key {
+	case "y", "Y":
+		d.sel = 0
+	case "s", "S":
+		if locale != "es" { return nil }
+		d.sel = 0
+	case "n", "N":
+		d.sel = 1
+	case "left", "right", "h", "l", "tab", "shift+tab":
+		d.sel = 1 - d.sel
+		return nil
+	case "enter":
+	default:
+		return nil
+	}
+	if d.sel != 0 { m.dismissDialog(); return nil }
+	m.dialog, m.status = nil, ""
+	return d.yes(m)
+}
+
+func (m *model) dismissDialog() {
+	m.dialog = nil
+	m.status = T("cancelled")
+}
+
+// dialogView renders the open dialog; plain mode gets the same text without the box
+// or the reverse video of the selected button
+func (m model) dialogView() string {
+	d := m.dialog
+	var b strings.Builder
+	title := d.title
+	if !m.plain { title = titleStyle.Render(title) }
+	b.WriteString(title + "\n")
+	if d.body != "" { b.WriteString("\n" + d.body + "\n") }
+	b.WriteString("\n")
+	var hint string
+	switch d.kind {
+	case dialogInput:
+		b.WriteString(d.input.View())
+		hint = T("enter: confirm · esc: cancel")
+	case dialogChoice:
+		for i, c := range d.choices {
+			marker := "  "
+			if i == d.sel { marker = "> " }
+			line := fmt.Sprintf("%s%d. %s", marker, i+1, c)
+			if i == d.sel && !m.plain { line = activeTabStyle.Render(line) }
+			b.WriteString(line + "\n")
+		}
+		hint = T("up/down or 1-9, enter: choose · esc: cancel")
+	default:
+		var buttons []string
+		for i, c := range d.choices {
+			switch {
+			case m.plain && i == d.sel:
+				buttons = append(buttons, "> "+c)
+			case m.plain:
+				buttons = append(buttons, "  "+c)
+			case i == d.sel:
+				buttons = append(buttons, dialogActiveStyle.Render(c))
+			default:
+				buttons = append(buttons, dialogButtonStyle.Render(c))
+			}
+		}
+		b.WriteString(strings.Join(buttons, "   "))
+		hint = T("y/n, or left/right and enter · esc: cancel")
+	}
+	if m.plain { b.WriteString("\n\n" + hint); return b.String() }
+	b.WriteString("\n\n" + helpStyle.Render(hint))
+	w := m.width - 4
+	if w > maxDialogWidth { w = maxDialogWidth }
+	return dialogStyle.Width(w).Render(b.String())
+}
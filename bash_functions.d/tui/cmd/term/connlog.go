@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// maxConnEvents is how many of the latest connection events the Connections tab loads
+const maxConnEvents = 5000
+
+// connEvent is a line of connections.log, where wish-server records logins, failed
+// logins, bans and invite logins
+type connEvent struct {
+	Time   time.Time `json:"time"`
+	Event  string    `json:"event"`
+	User   string    `json:"user,omitempty"`
+	Remote string    `json:"remote"`
+	Method string    `json:"method,omitempty"`
+	Detail string    `json:"detail,omitempty"`
+}
+
+func (e connEvent) Title() string {
+	t := fmt.Sprintf("%-11s %s", T(e.Event), e.Remote)
+	if e.User != "" { t += " " + T("as %s", e.User) }
+	return t
+}
+func (e connEvent) Description() string {
+	parts := []string{e.Time.Local().Format("2006-01-02 15:04:05")}
+	if e.Method != "" { parts = append(parts, e.Method) }
+	if e.Detail != "" { parts = append(parts, e.Detail) }
+	return strings.Join(parts, " · ")
+}
+func (e connEvent) FilterValue() string { return e.Event + " " + e.User + " " + e.Remote }
+
+// connLogPath is where wish-server logs connections, next to the allowlist
+func connLogPath(allowPath string) string { return filepath.Join(filepath.Dir(allowPath), "connections.log") }
+
+// loadConnLog reads the rotated log and the current one, oldest first, keeping the
+// last maxConnEvents; lines that do not parse are skipped
+func loadConnLog(allowPath string) ([]connEvent, error) {
+	var evs []connEvent
+	for _, p := range []string{connLogPath(allowPath) + ".1", connLogPath(allowPath)} {
+		f, err := os.Open(p)
+		if os.IsNotExist(err) { continue }
+		if err != nil { return nil, err }
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			var e connEvent
+			if json.Unmarshal(sc.Bytes(), &e) == nil { evs = append(evs, e) }
+		}
+		f.Close()
+		if err := sc.Err(); err != nil { return nil, err }
+	}
+	if len(evs) > maxConnEvents { evs = evs[len(evs)-maxConnEvents:] }
+	return evs, nil
+}
+
+// connQuery is the filter of the Connections tab: user=, ip= (an address or a prefix), event=,
+// since= and until=; a bare word matches the user or the address
+type connQuery struct {
+	user, ip, event, word string
+	since, until        time.Time
+}
+
+// parseWhen reads a time of a filter: an age such as 2h or 7d, a date or an RFC 3339 time
+func parseWhen(s string, now time.Time) (time.Time, error) {
+	if n, err := strconv.Atoi(strings.TrimSuffix(s, "d")); err == nil && strings.HasSuffix(s, "d") { return now.AddDate(0, 0, -n), nil }
+	if d, err := time.ParseDuration(s); err == nil { return now.Add(-d), nil }
+	for _, layout := range []string{"2006-01-02", "2006-01-02T15:04", time.RFC3339} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil { return t, nil }
+	}
+	return time.Time{}, errors.New(T("bad time %q: use 2h, 7d, 2006-01-02 or 2006-01-02T15:04", s))
+}
+
+func parseConnQuery(s string, now time.Time) (connQuery, error) {
+	var q connQuery
+	for _, w := range strings.Fields(s) {
+		k, v, ok := strings.Cut(w, "=")
+		if !ok { q.word = w; continue }
+		var err error
+		switch k {
+		case "user":
+			q.user = v
+		case "ip":
+			q.ip = v
+		case "event":
+			q.event = v
+		case "since":
+			q.since, err = parseWhen(v, now)
+		case "until":
+			q.until, err = parseWhen(v, now)
+		default:
+			err = errors.New(T("unknown filter %s: use user=, ip=, event=, since= or until=", k))
+		}
+		if err != nil { return q, err }
+	}
+	return q, nil
+}
+
+func (q connQuery) match(e connEvent) bool {
+	switch {
+	case q.user != "" && e.User != q.user,
+		q.ip != "" && !ipMatches(e.Remote, q.ip),
+		q.event != "" && e.Event != q.event,
+		!q.since.IsZero() && e.Time.Before(q.since),
+		!q.until.IsZero() && e.Time.After(q.until),
+		q.word != "" && !strings.Contains(e.User, q.word) && !strings.Contains(e.Remote, q.word):
+		return false
+	}
+	return true
+}
+
+// ipMatches compares a whole address exactly and takes anything else as a prefix,
+// so ip=10.0.0.1 does not match 10.0.0.12 but ip=10.0. matches the network
+func ipMatches(remote, ip string) bool {
+	if net.ParseIP(ip) != nil { return remote == ip }
+	return strings.HasPrefix(remote, ip)
+}
+
+func newConnList() list.Model {
+	l := list.New(nil, list.NewDefaultDelegate(), 80, 20)
+	l.Title = T("Connections")
+	l.SetShowHelp(false)
+	return l
+}
+
+func newConnInput() textinput.Model {
+	ti := textinput.New()
+	ti.Prompt = T("filter: ")
+	ti.Placeholder = "user=alice ip=10.0. event=auth_failed since=24h until=2006-01-02"
+	ti.CharLimit = 200
+	return ti
+}
+
+// refreshConnections rereads the log and lists the events that match the filter,
+// newest first, with their counts in the title
+func (m *model) refreshConnections() {
+	q, err := parseConnQuery(m.connFilter, time.Now())
+	if err != nil { m.status = err.Error(); return }
+	evs, err := loadConnLog(m.allowPath)
+	if err != nil { m.status = T("cannot read %s: %v", connLogPath(m.allowPath), err); return }
+	items := []list.Item{}
+	counts := map[string]int{}
+	for i := len(evs) - 1; i >= 0; i-- {
+		if !q.match(evs[i]) { continue }
+		items = append(items, evs[i])
+		counts[evs[i].Event]++
+	}
+	m.connList.SetItems(items)
+	m.connList.Title = T("Connections: %d logins, %d failed, %d bans, %d invites", counts["login"], counts["auth_failed"], counts["banned"], counts["invite"])
+	if m.connFilter != "" { m.connList.Title += " · " + m.connFilter }
+}
+
+// updateConnInput handles keys while the filter prompt has focus
+func (m *model) updateConnInput(msg tea.KeyMsg) tea.Cmd {
+	switch msg.String() {
+	case "esc":
+		m.connInput.Blur()
+		return nil
+	case "enter":
+		m.connInput.Blur()
+		m.connFilter = strings.TrimSpace(m.connInput.Value())
+		m.refreshConnections()
+		return nil
+	}
+	var cmd tea.Cmd
+	m.connInput, cmd = m.connInput.Update(msg)
+	return cmd
+}
+
+// updateConnections handles the keys of the Connections tab: f edits the filter, c
+// clears it, enter shows every event of the selected address, u reloads
+func (m *model) updateConnections(key string) (tea.Cmd, bool) {
+	if m.connList.FilterState() == list.Filtering { return nil, false }
+	switch key {
+	case "u":
+		m.refreshConnections()
+		m.status = T("refreshed connections")
+	case "f":
+		m.connInput.SetValue(m.connFilter)
+		m.connInput.CursorEnd()
+		return m.connInput.Focus(), true
+	case "c":
+		m.connFilter = ""
+		m.refreshConnections()
+	case "enter":
+		sel, ok := m.connList.SelectedItem().(connEvent)
+		if !ok { return nil, true }
+		m.connFilter = "ip=" + sel.Remote
+		m.refreshConnections()
+	default:
+		return nil, false
+	}
+	return nil, true
+}
+
+// connectionsView is the tab: the filter prompt while it is open, then the events
+func (m model) connectionsView() string {
+	if m.connInput.Focused() { return m.connInput.View() + "\n\n" + m.connList.View() }
+	return m.connList.View()
+}
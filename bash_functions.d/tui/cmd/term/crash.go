@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// crashDir holds crash reports written when the TUI panics
+func crashDir() string { return filepath.Join(tuiDataDir(), "crashes") }
+
+const crashHistory = 20
+
+// msgHistory remembers the last messages the model handled for crash reports;
+// commands run on other goroutines, so it is locked
+type msgHistory struct {
+	mu   sync.Mutex
+	msgs []string
+}
+
+func (h *msgHistory) add(msg tea.Msg) {
+	s := fmt.Sprintf("%s %T %v", time.Now().Format("15:04:05.000"), msg, msg)
+	if len(s) > 200 { s = s[:200] + "..." }
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.msgs = append(h.msgs, s)
+	if len(h.msgs) > crashHistory { h.msgs = h.msgs[len(h.msgs)-crashHistory:] }
+}
+
+func (h *msgHistory) lines() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]string{}, h.msgs...)
+}
+
+// crashMsg reports a panic recovered in a command; the program quits on it
+type crashMsg struct{ report string }
+
+// crashState is shared by all copies of the guard and tells main what happened
+type crashState struct {
+	panicked bool
+	report   string // crash report path, empty if it could not be written
+}
+
+// crashGuard wraps the model so a panic in Update, View or a command quits the
+// program normally, which restores the terminal, instead of killing it. This matters
+// over SSH, where a dead TUI leaves the client's terminal in raw mode. Since it sees
+// every message and render it also drives the debug overlay (debug.go).
+type crashGuard struct {
+	inner   model
+	history *msgHistory
+	state   *crashState
+	debug   *debugStats
+}
+
+func newCrashGuard(m model) crashGuard {
+	return crashGuard{inner: m, history: &msgHistory{}, state: &crashState{}, debug: &debugStats{}}
+}
+
+func (c crashGuard) Init() tea.Cmd { return c.guard(c.inner.Init()) }
+
+func (c crashGuard) Update(msg tea.Msg) (res tea.Model, cmd tea.Cmd) {
+	if cm, ok := msg.(crashMsg); ok {
+		c.state.panicked, c.state.report = true, cm.report
+		return c, tea.Quit
+	}
+	// View cannot quit by itself; the next message does after it panicked
+	if c.state.panicked { return c, tea.Quit }
+	c.history.add(msg)
+	if k, ok := msg.(tea.KeyMsg); ok && k.String() == debugKey {
+		c.debug.on = !c.debug.on
+		return c, nil
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			c.state.panicked, c.state.report = true, c.writeReport(r, debug.Stack())
+			res, cmd = c, tea.Quit
+		}
+	}()
+	start := time.Now()
+	next, cmd := c.inner.Update(msg)
+	c.debug.update(msg, time.Since(start))
+	c.inner = next.(model)
+	return c, c.guard(cmd)
+}
+
+func (c crashGuard) View() (s string) {
+	defer func() {
+		if r := recover(); r != nil {
+			if !c.state.panicked { c.state.panicked, c.state.report = true, c.writeReport(r, debug.Stack()) }
+			s = T("The TUI crashed and is closing.")
+		}
+	}()
+	if c.state.panicked { return T("The TUI crashed and is closing.") }
+	start := time.Now()
+	s = c.inner.View()
+	c.debug.view(time.Since(start))
+	// below the tab row
+	if c.debug.on { s = overlayLines(s, renderDebug(c.debug, c.inner, c.history.lines(), c.inner.plain), 2) }
+	return s
+}
+
+// guard wraps cmd, and the commands of a batch, so their panics become crashMsg
+func (c crashGuard) guard(cmd tea.Cmd) tea.Cmd {
+	if cmd == nil { return nil }
+	return func() (msg tea.Msg) {
+		defer func() {
+			if r := recover(); r != nil { msg = crashMsg{report: c.writeReport(r, debug.Stack())} }
+		}()
+		msg = cmd()
+		if batch, ok := msg.(tea.BatchMsg); ok {
+			for i := range batch { batch[i] = c.guard(batch[i]) }
+			return batch
+		}
+		return msg
+	}
+}
+
+// writeReport saves the panic, stack, a summary of the model and the last messages
+// to the crash directory and returns the report path ("" if it could not be written)
+func (c crashGuard) writeReport(r interface{}, stack []byte) string {
+	m := c.inner
+	var b strings.Builder
+	fmt.Fprintf(&b, "time: %s\ngo: %s %s/%s\npid: %d\nuser: %s\n\npanic: %v\n\n%s\n", time.Now().Format(time.RFC3339), runtime.Version(), runtime.GOOS, runtime.GOARCH, os.Getpid(), transferUser(), r, stack)
+	b.WriteString("model:\n")
+	tab := ""
+	if m.active >= 0 && m.active < len(m.tabs) { tab = m.tabs[m.active] }
+	fmt.Fprintf(&b, "  tab: %s\n  workspace: %d of %d\n  cwd: %s\n  editor file: %s\n  size: %dx%d\n  plain: %v\n  status: %s\n  my jobs: %d\n", tab, m.ws+1, len(m.workspaces), m.cwd, m.editorFile, m.width, m.height, m.plain, m.status, len(m.myJobs))
+	b.WriteString("\nlast messages:\n")
+	for _, l := range c.history.lines() { b.WriteString("  " + l + "\n") }
+
+	slog.Error("panic", "panic", fmt.Sprint(r), "stack", string(stack))
+	if err := os.MkdirAll(crashDir(), 0o700); err != nil { return "" }
+	path := filepath.Join(crashDir(), fmt.Sprintf("crash-%s-%d.txt", time.Now().Format("20060102-150405"), os.Getpid()))
+	if err := ioutil.WriteFile(path, []byte(b.String()), 0o600); err != nil { return "" }
+	return path
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// defaultCrewParallel bounds how many members of one stage run at once
+const defaultCrewParallel = 4
+
+// memberResult is the outcome of one crew member's run
+type memberResult struct {
+	Agent    string        `json:"agent"`
+	Stage    int           `json:"stage"`
+	Output   string        `json:"output,omitempty"`
+	Exit     int           `json:"exit"`
+	Error    string        `json:"error,omitempty"`
+	Skipped  bool          `json:"skipped,omitempty"` // a member it depends on failed
+	Duration time.Duration `json:"duration"`
+}
+
+func (r memberResult) ok() bool { return !r.Skipped && r.Exit == 0 && r.Error == "" }
+
+// crewResult aggregates a crew run; it passed when every member did
+type crewResult struct {
+	Crew     string         `json:"crew"`
+	Exec     bool           `json:"exec"`
+	Members  []memberResult `json:"members"`
+	Passed   bool           `json:"passed"`
+	Duration time.Duration  `json:"duration"`
+}
+
+func (r crewResult) verdict() string {
+	if r.Passed { return T("PASS") }
+	return T("FAIL")
+}
+
+// runCrew runs c stage by stage. Members of a stage run concurrently, at most
+// parallel at a time; a member whose dependencies failed is skipped. Every run is
+// audited with source=crew:<name>.
+func runCrew(ctx context.Context, c crewSpec, execFlag bool, parallel int, auditPath string) (crewResult, error) {
+	stages, err := crewStages(c)
+	if err != nil { return crewResult{}, err }
+	if parallel < 1 { parallel = defaultCrewParallel }
+	ctx, span := startSpan(ctx, "crew.run", attribute.String("crew", c.Name), attribute.Bool("exec", execFlag))
+	start := time.Now()
+	res := crewResult{Crew: c.Name, Exec: execFlag, Passed: true}
+	failed := map[string]bool{}
+	for si, stage := range stages {
+		results := make([]memberResult, len(stage))
+		sem := make(chan struct{}, parallel)
+		var wg sync.WaitGroup
+		for i, a := range stage {
+			results[i] = memberResult{Agent: a, Stage: si + 1}
+			blocked := false
+			for _, d := range c.Depends[a] { if failed[d] { blocked = true } }
+			if blocked { results[i].Skipped = true; continue }
+			wg.Add(1)
+			go func(r *memberResult) {
+				defer wg.Done()
+				sem <- struct{}{}
+				defer func() { <-sem }()
+				t0 := time.Now()
+				out, code, runErr := runAgentScript(ctx, r.Agent, execFlag)
+				r.Output, r.Exit, r.Duration = out, code, time.Since(t0)
+				if runErr != nil { r.Error = runErr.Error() }
+				appendAudit(auditPath, fmt.Sprintf("%s\tagent=%s\texec=%v\texit=%d\terror=%v\tsource=crew:%s\tuser=%s\tduration=%s", t0.Format(time.RFC3339), r.Agent, execFlag, code, runErr, c.Name, transferUser(), r.Duration.Round(time.Millisecond))+sandboxAudit(r.Agent, execFlag))
+			}(&results[i])
+		}
+		wg.Wait()
+		for _, r := range results {
+			if !r.ok() { failed[r.Agent] = true; res.Passed = false }
+		}
+		res.Members = append(res.Members, results...)
+	}
+	res.Duration = time.Since(start)
+	code := 0
+	if !res.Passed { code = 1 }
+	endSpan(span, code, nil)
+	return res, nil
+}
+
+// crewExecAllowed checks every member against SSH_ALLOWED_EXEC
+func crewExecAllowed(c crewSpec) error {
+	for _, a := range c.Agents {
+		if err := execAllowed(a); err != nil { return fmt.Errorf("%s: %w", a, err) }
+	}
+	return nil
+}
+
+// memberMark is the pass/fail/skip marker of a member in the report
+func memberMark(r memberResult, plain bool) string {
+	switch {
+	case r.Skipped && plain:
+		return T("SKIP")
+	case r.Skipped:
+		return "-"
+	case r.ok() && plain:
+		return T("PASS")
+	case r.ok():
+		return "✔"
+	case plain:
+		return T("FAIL")
+	}
+	return "✘"
+}
+
+// renderCrewReport is the aggregated report: a summary line, then one header per
+// member with its output underneath when it is expanded
+func renderCrewReport(res crewResult, open map[string]bool, plain bool) string {
+	var b strings.Builder
+	mode := T("dry-run")
+	if res.Exec { mode = "exec" }
+	b.WriteString(T("Crew %s: %s (%s, %s)", res.Crew, res.verdict(), mode, res.Duration.Round(time.Millisecond)) + "\n\n")
+	for _, r := range res.Members {
+		fold := "▸"
+		if open[r.Agent] { fold = "▾" }
+		if plain { fold = "" }
+		line := fmt.Sprintf("%s %s %d. %s", fold, memberMark(r, plain), r.Stage, r.Agent)
+		switch {
+		case r.Skipped:
+			line += "  " + T("skipped: a dependency failed")
+		default:
+			line += "  " + T("exit %d in %s", r.Exit, r.Duration.Round(time.Millisecond))
+			if r.Error != "" && r.Exit == 0 { line += "  " + r.Error }
+		}
+		b.WriteString(strings.TrimLeft(line, " ") + "\n")
+		if open[r.Agent] && !r.Skipped {
+			out := strings.TrimRight(r.Output, "\n")
+			if out == "" { out = T("(no output)") }
+			for _, l := range strings.Split(out, "\n") { b.WriteString("    " + l + "\n") }
+		}
+	}
+	return b.String()
+}
+
+// crewDoneMsg delivers a finished crew run to the model
+type crewDoneMsg struct {
+	res crewResult
+	err error
+}
+
+// startCrewRun runs the open crew in the background; exec needs every member allowed
+func (m *model) startCrewRun(execFlag bool) tea.Cmd {
+	c := m.crew.spec
+	if execFlag {
+		if err := crewExecAllowed(c); err != nil { m.status = T("crew exec refused: %v", err); return nil }
+	}
+	parallel, auditPath := m.cfg.CrewParallel, m.auditPath
+	m.status = T("running crew %s (exec=%v)", c.Name, execFlag)
+	return func() tea.Msg {
+		res, err := runCrew(traceCtx, c, execFlag, parallel, auditPath)
+		return crewDoneMsg{res: res, err: err}
+	}
+}
+
+// showCrewResult opens the report beside the crew with failed members expanded
+func (m *model) showCrewResult(res crewResult) {
+	if m.crew != nil && m.crew.spec.Name == res.Crew {
+		m.crew.result = &res
+		m.crew.open = map[string]bool{}
+		for _, r := range res.Members { if !r.ok() && !r.Skipped { m.crew.open[r.Agent] = true } }
+		m.crew.refreshStatus()
+	}
+	m.panes.show(true, m.tabs[m.active], "Preview")
+	m.setContent(renderCrewReport(res, m.crewOpen(), m.plain))
+	m.lastOutput = m.vpContent
+	m.status = T("crew %s: %s", res.Crew, res.verdict())
+}
+
+func (m *model) crewOpen() map[string]bool {
+	if m.crew == nil { return nil }
+	return m.crew.open
+}
+
+// toggleCrewMember expands or collapses the selected member in the report
+func (m *model) toggleCrewMember() {
+	if m.crew == nil || m.crew.result == nil { return }
+	sel, ok := m.crew.list.SelectedItem().(crewMemberItem)
+	if !ok { return }
+	m.crew.open[sel.name] = !m.crew.open[sel.name]
+	off := m.vp.YOffset
+	m.setContent(renderCrewReport(*m.crew.result, m.crew.open, m.plain))
+	m.vp.SetYOffset(off)
+}
+
+// runCrewCLI implements `term crew [-exec] [-parallel n] [-json] <crew>`
+func runCrewCLI(args []string) int {
+	fs := flag.NewFlagSet("crew", flag.ExitOnError)
+	execFlag := fs.Bool("exec", false, "run members with --exec (each must be in SSH_ALLOWED_EXEC)")
+	parallel := fs.Int("parallel", 0, "members of a stage run at once (default: crew_parallel from config.json, else 4)")
+	asJSON := fs.Bool("json", false, "print the result as JSON")
+	fs.Usage = func() { fmt.Fprintln(fs.Output(), "usage: term crew [-exec] [-parallel n] [-json] <crew>"); fs.PrintDefaults() }
+	fs.Parse(args)
+	if fs.NArg() != 1 { fs.Usage(); return 2 }
+	cfg := loadConfig()
+	defer setupLogging(cfg.Log, "crew", false)()
+	if cfg.Tracing { defer setupTracing("cbw-crew")() }
+	mf, err := loadManifest()
+	if err != nil { fmt.Fprintln(os.Stderr, err); return 1 }
+	var c crewSpec
+	found := false
+	for _, cr := range mf.Crews { if cr.Name == fs.Arg(0) { c, found = cr, true } }
+	if !found { fmt.Fprintf(os.Stderr, "no crew %q in %s\n", fs.Arg(0), manifestPath()); return 1 }
+	if *execFlag {
+		if err := crewExecAllowed(c); err != nil { fmt.Fprintln(os.Stderr, err); return 3 }
+	}
+	n := *parallel
+	if n == 0 { n = cfg.CrewParallel }
+	res, err := runCrew(traceCtx, c, *execFlag, n, filepath.Join(tuiDataDir(), "agent_audit.log"))
+	if err != nil { fmt.Fprintln(os.Stderr, err); return 1 }
+	if *asJSON {
+		printJSON(res)
+	} else {
+		open := map[string]bool{}
+		for _, r := range res.Members { open[r.Agent] = true }
+		fmt.Print(renderCrewReport(res, open, true))
+	}
+	if !res.Passed { return 1 }
+	return 0
+}
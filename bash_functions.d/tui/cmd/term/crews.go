@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// crewStages orders a crew's members by their depends entries: every member of a
+// stage only depends on members of earlier stages. Members without dependencies
+// run in the first stage, in the order they are listed.
+func crewStages(c crewSpec) ([][]string, error) {
+	members := map[string]bool{}
+	for _, a := range c.Agents { members[a] = true }
+	for a, deps := range c.Depends {
+		if !members[a] { return nil, fmt.Errorf("crew %s: depends names %s, which is not a member", c.Name, a) }
+		for _, d := range deps { if !members[d] { return nil, fmt.Errorf("crew %s: %s depends on %s, which is not a member", c.Name, a, d) } }
+	}
+	done := map[string]bool{}
+	var stages [][]string
+	for len(done) < len(c.Agents) {
+		var stage []string
+		for _, a := range c.Agents {
+			if done[a] { continue }
+			ready := true
+			for _, d := range c.Depends[a] { if !done[d] { ready = false } }
+			if ready { stage = append(stage, a) }
+		}
+		if len(stage) == 0 { return nil, fmt.Errorf("crew %s: dependency cycle", c.Name) }
+		for _, a := range stage { done[a] = true }
+		stages = append(stages, stage)
+	}
+	return stages, nil
+}
+
+// lastRuns returns the newest audit entry with an exit code for each agent
+func lastRuns(log string) map[string]auditEntry {
+	out := map[string]auditEntry{}
+	for _, line := range strings.Split(log, "\n") {
+		e, ok := parseAuditLine(line)
+		if !ok { continue }
+		if _, err := strconv.Atoi(e.fields["exit"]); err != nil { continue }
+		if prev, ok := out[e.fields["agent"]]; !ok || !e.time.Before(prev.time) { out[e.fields["agent"]] = e }
+	}
+	return out
+}
+
+// runStatus describes an agent's last run, e.g. "ok 2h0m0s ago" or "failed (exit 3) 5m0s ago"
+func runStatus(e auditEntry, ok bool, now time.Time) string {
+	if !ok { return T("never run") }
+	since := now.Sub(e.time).Round(time.Second)
+	if e.fields["exit"] != "0" || (e.fields["error"] != "" && e.fields["error"] != "<nil>") { return T("failed (exit %s) %s ago", e.fields["exit"], since) }
+	return T("ok %s ago", since)
+}
+
+// crewMemberItem is one member in the crew viewer
+type crewMemberItem struct {
+	name   string
+	stage  int
+	after  []string
+	status string
+	known  bool // listed in the manifest's agents
+}
+
+func (i crewMemberItem) Title() string { return fmt.Sprintf("%d. %s", i.stage, i.name) }
+func (i crewMemberItem) Description() string {
+	parts := []string{i.status}
+	if len(i.after) > 0 { parts = append(parts, T("after %s", strings.Join(i.after, ", "))) }
+	if !i.known { parts = append(parts, T("not in the manifest")) }
+	return strings.Join(parts, " · ")
+}
+func (i crewMemberItem) FilterValue() string { return i.name }
+
+// crewView replaces the agents list while a crew is open
+type crewView struct {
+	spec   crewSpec
+	list   list.Model
+	result *crewResult     // the last run started from the viewer
+	open   map[string]bool // members expanded in the run report
+}
+
+// openCrew shows the members of crew name by stage, with their last runs
+func (m *model) openCrew(name string) {
+	mf, err := loadManifest()
+	if err != nil { m.status = T("manifest unreadable: %v", err); return }
+	var c crewSpec
+	found := false
+	for _, cr := range mf.Crews { if cr.Name == name { c, found = cr, true } }
+	if !found { return }
+	stages, err := crewStages(c)
+	if err != nil { m.status = err.Error(); return }
+	m.refreshAudit()
+	last, now := lastRuns(m.auditContent), time.Now()
+	var items []list.Item
+	for si, stage := range stages {
+		for _, a := range stage {
+			e, ran := last[a]
+			_, known := mf.agent(a)
+			items = append(items, crewMemberItem{name: a, stage: si + 1, after: c.Depends[a], status: runStatus(e, ran, now), known: known})
+		}
+	}
+	l := list.New(items, list.NewDefaultDelegate(), 40, m.height-8)
+	if m.plain { l.SetDelegate(plainDelegate{}) }
+	l.Title = T("Crew: %s", c.Name)
+	l.SetShowHelp(false)
+	m.crew = &crewView{spec: c, list: l}
+	m.setContent(renderCrew(c, stages, last, now))
+	m.status = T("crew %s: enter opens a member, r runs it (R with --exec), esc goes back", c.Name)
+}
+
+// renderCrew is the crew summary shown in the viewport
+func renderCrew(c crewSpec, stages [][]string, last map[string]auditEntry, now time.Time) string {
+	var b strings.Builder
+	b.WriteString(T("Crew: %s", c.Name) + "\n\n")
+	if c.Desc != "" { b.WriteString(c.Desc + "\n\n") }
+	for i, stage := range stages {
+		b.WriteString(T("Stage %d", i+1) + "\n")
+		for _, a := range stage {
+			e, ran := last[a]
+			line := fmt.Sprintf("  %-24s %s", a, runStatus(e, ran, now))
+			if deps := c.Depends[a]; len(deps) > 0 { line += "  " + T("after %s", strings.Join(deps, ", ")) }
+			b.WriteString(line + "\n")
+		}
+	}
+	return b.String()
+}
+
+// refreshStatus shows each member's result from the last run in the list
+func (v *crewView) refreshStatus() {
+	if v.result == nil { return }
+	by := map[string]memberResult{}
+	for _, r := range v.result.Members { by[r.Agent] = r }
+	items := v.list.Items()
+	for i, it := range items {
+		c := it.(crewMemberItem)
+		r, ok := by[c.name]
+		if !ok { continue }
+		switch {
+		case r.Skipped:
+			c.status = T("skipped: a dependency failed")
+		case r.ok():
+			c.status = T("ok in %s", r.Duration.Round(time.Millisecond))
+		default:
+			c.status = T("failed (exit %d) in %s", r.Exit, r.Duration.Round(time.Millisecond))
+		}
+		items[i] = c
+	}
+	v.list.SetItems(items)
+}
+
+// updateCrew handles keys in the crew viewer: enter jumps to the member agent, r/R
+// run the crew, space folds a member's output in the report, esc returns to the
+// agents list
+func (m *model) updateCrew(msg tea.KeyMsg) tea.Cmd {
+	switch msg.String() {
+	case "r", "R":
+		return m.startCrewRun(msg.String() == "R")
+	case " ":
+		m.toggleCrewMember()
+		return nil
+	case "esc":
+		m.crew = nil
+		m.status = ""
+		return nil
+	case "enter":
+		sel, ok := m.crew.list.SelectedItem().(crewMemberItem)
+		if !ok { return nil }
+		m.crew = nil
+		m.agentTag = ""
+		m.agentSearch.SetValue("")
+		m.refreshAgents()
+		for i, it := range m.agentsList.Items() {
+			if it.(agentItem).name == sel.name { m.agentsList.Select(i); break }
+		}
+		mf, _ := loadManifest()
+		if a, ok := mf.agent(sel.name); ok { m.setContent(a.describe()) } else { m.setContent(T("%s is not in the manifest", sel.name)) }
+		m.status = T("agent %s", sel.name)
+		return nil
+	}
+	var cmd tea.Cmd
+	m.crew.list, cmd = m.crew.list.Update(msg)
+	return cmd
+}
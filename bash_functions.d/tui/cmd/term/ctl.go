@@ -0,0 +1,181 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// ctlDir holds one control socket per running TUI, named <pid>.sock
+func ctlDir() string { return filepath.Join(tuiDataDir(), "ctl") }
+
+// ctlRequest is what `term ctl` sends; Cwd resolves relative paths, Token is the
+// session secret run --exec needs
+type ctlRequest struct {
+	Cmd   string   `json:"cmd"`
+	Args  []string `json:"args,omitempty"`
+	Cwd   string   `json:"cwd,omitempty"`
+	Token string   `json:"token,omitempty"`
+}
+
+type ctlReply struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// ctlMsg delivers a control request to the model; Update answers on reply
+type ctlMsg struct {
+	req   ctlRequest
+	reply chan ctlReply
+}
+
+const ctlTimeout = 5 * time.Second
+
+// ctlToken is this session's control secret. The socket's mode only says which unix
+// account connects, and every SSH user of the account shares that, so run --exec also
+// needs the secret, which only processes started from this TUI inherit.
+var ctlToken string
+
+// listenCtl serves this instance's control socket and exports its path as
+// CBW_TERM_SOCKET and its secret as CBW_TERM_TOKEN, so shells and agents started from
+// the TUI address it. The returned function closes and removes the socket.
+func listenCtl(p *tea.Program) func() {
+	if err := os.MkdirAll(ctlDir(), 0o700); err != nil { slog.Warn("control socket disabled", "err", err); return func() {} }
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil { slog.Warn("control socket disabled", "err", err); return func() {} }
+	ctlToken = hex.EncodeToString(b)
+	path := filepath.Join(ctlDir(), fmt.Sprintf("%d.sock", os.Getpid()))
+	os.Remove(path)
+	l, err := net.Listen("unix", path)
+	if err != nil { slog.Warn("control socket disabled", "err", err); return func() {} }
+	os.Chmod(path, 0o600)
+	os.Setenv("CBW_TERM_SOCKET", path)
+	os.Setenv("CBW_TERM_TOKEN", ctlToken)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil { return }
+			go serveCtl(p, conn)
+		}
+	}()
+	return func() { l.Close(); os.Remove(path) }
+}
+
+func serveCtl(p *tea.Program, conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(ctlTimeout))
+	var req ctlRequest
+	if err := json.NewDecoder(conn).Decode(&req); err != nil { json.NewEncoder(conn).Encode(ctlReply{Error: err.Error()}); return }
+	slog.Info("control request", "cmd", req.Cmd, "args", req.Args)
+	reply := make(chan ctlReply, 1)
+	p.Send(ctlMsg{req: req, reply: reply})
+	select {
+	case r := <-reply:
+		json.NewEncoder(conn).Encode(r)
+	case <-time.After(ctlTimeout):
+		json.NewEncoder(conn).Encode(ctlReply{Error: "the TUI did not answer"})
+	}
+}
+
+// handleCtl carries out a control request as if the user had done it
+func (m *model) handleCtl(req ctlRequest) (tea.Cmd, error) {
+	arg := strings.Join(req.Args, " ")
+	switch req.Cmd {
+	case "open":
+		if arg == "" { return nil, errors.New("usage: open <path[:line[:col]]>") }
+		path, line, col := parseFileTarget(arg)
+		path = expandHome(path)
+		if !filepath.IsAbs(path) && req.Cwd != "" { path = filepath.Join(req.Cwd, path) }
+		if _, err := os.Stat(path); err != nil { return nil, err }
+		return m.openInEditor(path, line, col), nil
+	case "tab":
+		if n, err := strconv.Atoi(arg); err == nil && n >= 1 && n <= len(m.tabs) { m.active = n - 1; return nil, nil }
+		for i, t := range m.tabs {
+			if strings.EqualFold(t, arg) || strings.EqualFold(T(t), arg) { m.active = i; return nil, nil }
+		}
+		return nil, fmt.Errorf("no tab %q", arg)
+	case "message":
+		m.status = arg
+		return nil, nil
+	case "run":
+		if len(req.Args) < 1 || len(req.Args) > 2 || (len(req.Args) == 2 && req.Args[1] != "--exec") { return nil, errors.New("usage: run <agent> [--exec]") }
+		if len(req.Args) == 2 && (ctlToken == "" || subtle.ConstantTimeCompare([]byte(req.Token), []byte(ctlToken)) != 1) {
+			slog.Warn("control run --exec refused", "agent", req.Args[0])
+			return nil, errors.New("run --exec only works from a shell started by this TUI")
+		}
+		m.panes.show(true, m.tabs[m.active], "Preview")
+		return m.startAgentJob(req.Args[0], len(req.Args) == 2)
+	}
+	return nil, fmt.Errorf("unknown command %q", req.Cmd)
+}
+
+// ctlSocket picks the instance `term ctl` talks to: CBW_TERM_SOCKET inside a TUI,
+// otherwise this user's most recently started TUI
+func ctlSocket() (string, error) {
+	if s := os.Getenv("CBW_TERM_SOCKET"); s != "" { return s, nil }
+	sessions := liveSessions()
+	me := transferUser()
+	for i := len(sessions) - 1; i >= 0; i-- {
+		if sessions[i].User != me { continue }
+		path := filepath.Join(ctlDir(), fmt.Sprintf("%d.sock", sessions[i].PID))
+		if _, err := os.Stat(path); err == nil { return path, nil }
+	}
+	return "", errors.New("no running TUI found")
+}
+
+const ctlUsage = `usage: term ctl [-s socket] <command> [args]
+
+  open <path[:line[:col]]>   open a file in the embedded editor
+  tab <name|number>          switch to a tab
+  message <text>             show text in the status line
+  run <agent> [--exec]       start an agent as a job of that TUI (--exec only from
+                             a shell that TUI started)
+  list                       list running TUIs and their sockets
+`
+
+// runCtl implements `term ctl`, the client of the control socket
+func runCtl(args []string) int {
+	fs := flag.NewFlagSet("ctl", flag.ExitOnError)
+	sock := fs.String("s", "", "control socket (default: $CBW_TERM_SOCKET or your newest TUI)")
+	fs.Usage = func() { fmt.Fprint(fs.Output(), ctlUsage); fs.PrintDefaults() }
+	fs.Parse(args)
+	if fs.NArg() < 1 { fs.Usage(); return 2 }
+
+	if fs.Arg(0) == "list" {
+		for _, s := range liveSessions() {
+			path := filepath.Join(ctlDir(), fmt.Sprintf("%d.sock", s.PID))
+			if _, err := os.Stat(path); err != nil { continue }
+			fmt.Printf("%d\t%s\t%s\t%s\n", s.PID, s.User, s.Started, path)
+		}
+		return 0
+	}
+	path := *sock
+	if path == "" {
+		p, err := ctlSocket()
+		if err != nil { fmt.Fprintln(os.Stderr, "ctl:", err); return 1 }
+		path = p
+	}
+	conn, err := net.DialTimeout("unix", path, ctlTimeout)
+	if err != nil { fmt.Fprintln(os.Stderr, "ctl:", err); return 1 }
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * ctlTimeout))
+	cwd, _ := os.Getwd()
+	if err := json.NewEncoder(conn).Encode(ctlRequest{Cmd: fs.Arg(0), Args: fs.Args()[1:], Cwd: cwd, Token: os.Getenv("CBW_TERM_TOKEN")}); err != nil { fmt.Fprintln(os.Stderr, "ctl:", err); return 1 }
+	var r ctlReply
+	if err := json.NewDecoder(conn).Decode(&r); err != nil { fmt.Fprintln(os.Stderr, "ctl:", err); return 1 }
+	if !r.OK { fmt.Fprintln(os.Stderr, "ctl:", r.Error); return 1 }
+	return 0
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// dashboardTickMsg refreshes the Dashboard tab while it is on screen
+type dashboardTickMsg struct{}
+
+const dashboardInterval = 5 * time.Second
+
+func dashboardTick() tea.Cmd {
+	return tea.Tick(dashboardInterval, func(time.Time) tea.Msg { return dashboardTickMsg{} })
+}
+
+// dashboardVisible reports whether any pane currently shows the Dashboard tab
+func (m model) dashboardVisible() bool {
+	if m.tabs[m.active] == "Dashboard" { return true }
+	for _, l := range m.panes.root.leaves() { if l.tab == "Dashboard" { return true } }
+	return false
+}
+
+// recentFailures returns up to n failed runs from the audit log, newest first
+func recentFailures(log string, n int) []auditEntry {
+	var out []auditEntry
+	lines := strings.Split(log, "\n")
+	for i := len(lines) - 1; i >= 0 && len(out) < n; i-- {
+		e, ok := parseAuditLine(lines[i])
+		if !ok { continue }
+		code, err := strconv.Atoi(e.fields["exit"])
+		if err != nil { continue }
+		if code != 0 || (e.fields["error"] != "" && e.fields["error"] != "<nil>") { out = append(out, e) }
+	}
+	return out
+}
+
+// renderDashboard summarizes jobs, requests, failures, sessions and schedules
+func renderDashboard(auditPath, requestsPath string, now time.Time) string {
+	var b strings.Builder
+	section := func(title string, n int) { fmt.Fprintf(&b, "\n%s (%d)\n", title, n) }
+	ago := func(ts string) string {
+		t, err := time.Parse(time.RFC3339, ts)
+		if err != nil { return ts }
+		return now.Sub(t).Round(time.Second).String()
+	}
+	fmt.Fprintf(&b, "%s  %s\n", T("Dashboard"), now.Format("2006-01-02 15:04:05"))
+
+	var running, queued []job
+	for _, j := range loadJobs() {
+		switch j.State {
+		case JobRunning:
+			running = append(running, j)
+		case JobQueued:
+			queued = append(queued, j)
+		}
+	}
+	section(T("Running jobs"), len(running))
+	for _, j := range running { fmt.Fprintf(&b, "  %-24s %-22s %s %s\n", trimTo(j.Agent, 24), j.ID, T("for"), ago(j.Started)) }
+	if len(queued) > 0 { fmt.Fprintf(&b, "  %s\n", T("%d queued", len(queued))) }
+
+	reqs, _ := listRequests(requestsPath)
+	section(T("Pending requests"), len(reqs))
+	for i, r := range reqs {
+		if i == 5 { fmt.Fprintf(&b, "  %s\n", T("... %d more in the Requests tab", len(reqs)-5)); break }
+		fmt.Fprintf(&b, "  %-12s %-24s %-12s %s\n", r.ID, trimTo(r.Agent, 24), r.User, r.Time)
+	}
+
+	audit, _ := readAudit(auditPath)
+	fails := recentFailures(audit, 5)
+	section(T("Recent failures"), len(fails))
+	for _, e := range fails {
+		fmt.Fprintf(&b, "  %-24s exit=%-4s %s %s\n", trimTo(e.fields["agent"], 24), e.fields["exit"], e.time.Local().Format("01-02 15:04"), e.fields["error"])
+	}
+
+	sessions := liveSessions()
+	section(T("Connected sessions"), len(sessions))
+	for _, s := range sessions {
+		remote := s.Remote
+		if remote == "" { remote = T("local") }
+		fmt.Fprintf(&b, "  %-16s %-20s %s %s\n", s.User, remote, T("for"), ago(s.Started))
+	}
+
+	scheds := loadSchedulerState(schedulerStatePath()).Schedules
+	sort.Slice(scheds, func(i, j int) bool { return scheds[i].NextRun < scheds[j].NextRun })
+	section(T("Scheduled runs"), len(scheds))
+	for _, s := range scheds {
+		next := s.NextRun
+		if t, err := time.Parse(time.RFC3339, s.NextRun); err == nil { next = T("in %s", t.Sub(now).Round(time.Second)) }
+		fmt.Fprintf(&b, "  %-20s %-20s %-18s %s=%d\n", trimTo(s.Name, 20), trimTo(s.Agent, 20), next, T("last exit"), s.LastExit)
+	}
+	return b.String()
+}
+
+// refreshDashboard re-renders the Dashboard tab
+func (m *model) refreshDashboard() {
+	m.dashboard = renderDashboard(m.auditPath, m.requestsPath, time.Now())
+}
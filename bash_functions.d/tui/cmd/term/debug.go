@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// debugKey toggles the debug overlay; it is deliberately left out of the help line
+const debugKey = "alt+D"
+
+// debugStats is shared by all copies of the crash guard and feeds the overlay
+type debugStats struct {
+	on                           bool
+	views, updates               int
+	lastView, maxView, totalView time.Duration
+	lastUpdate, maxUpdate        time.Duration
+	slowestMsg                   string // type of the message behind maxUpdate
+}
+
+func (d *debugStats) update(msg interface{}, took time.Duration) {
+	d.updates++
+	d.lastUpdate = took
+	if took > d.maxUpdate { d.maxUpdate, d.slowestMsg = took, fmt.Sprintf("%T", msg) }
+}
+
+func (d *debugStats) view(took time.Duration) {
+	d.views++
+	d.lastView = took
+	d.totalView += took
+	if took > d.maxView { d.maxView = took }
+}
+
+// renderDebug draws the overlay: timings, model size, goroutine and job counts and
+// the most recent messages, newest last
+func renderDebug(d *debugStats, m model, history []string, plain bool) string {
+	var b strings.Builder
+	b.WriteString(T("Debug") + "\n")
+	avg := time.Duration(0)
+	if d.views > 0 { avg = d.totalView / time.Duration(d.views) }
+	fmt.Fprintf(&b, "view:   last %v  avg %v  max %v  (%d renders)\n", d.lastView.Round(time.Microsecond), avg.Round(time.Microsecond), d.maxView.Round(time.Microsecond), d.views)
+	fmt.Fprintf(&b, "update: last %v  max %v %s  (%d msgs)\n", d.lastUpdate.Round(time.Microsecond), d.maxUpdate.Round(time.Microsecond), d.slowestMsg, d.updates)
+	var active, all int
+	for _, it := range m.jobsList.Items() {
+		if ji, ok := it.(jobItem); ok {
+			all++
+			if ji.j.State == JobQueued || ji.j.State == JobRunning { active++ }
+		}
+	}
+	fmt.Fprintf(&b, "size: %dx%d  goroutines: %d  jobs: %d active / %d  mine: %d\n", m.width, m.height, runtime.NumGoroutine(), active, all, len(m.myJobs))
+	// keep the overlay within half the screen
+	n := m.height/2 - 6
+	if n < 3 { n = 3 }
+	if len(history) > n { history = history[len(history)-n:] }
+	b.WriteString(T("last messages:") + "\n")
+	for _, l := range history {
+		if m.width > 6 && len(l) > m.width-6 { l = l[:m.width-6] }
+		b.WriteString("  " + l + "\n")
+	}
+	s := strings.TrimRight(b.String(), "\n")
+	if plain { return s }
+	return lipgloss.NewStyle().Border(lipgloss.NormalBorder()).Padding(0, 1).Render(s)
+}
+
+// overlayLines writes panel over view starting at line top, keeping the view's height
+func overlayLines(view, panel string, top int) string {
+	lines := strings.Split(view, "\n")
+	for i, l := range strings.Split(panel, "\n") {
+		if top+i < len(lines) { lines[top+i] = l } else { lines = append(lines, l) }
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// diffLine is one line of a line diff: ' ' kept, '-' only in the old text, '+' only
+// in the new one
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// diffLines is the shortest edit script from a to b (Myers' algorithm)
+func diffLines(a, b []string) []diffLine {
+	n, m := len(a), len(b)
+	off := n + m
+	v := make([]int, 2*off+2)
+	var trace [][]int
+	for d := 0; d <= off; d++ {
+		trace = append(trace, append([]int(nil), v...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || k != d && v[off+k-1] < v[off+k+1] { x = v[off+k+1] } else { x = v[off+k-1] + 1 }
+			y := x - k
+			for x < n && y < m && a[x] == b[y] { x++; y++ }
+			v[off+k] = x
+			if x >= n && y >= m { return diffBacktrack(trace, a, b, off) }
+		}
+	}
+	return nil
+}
+
+// diffBacktrack walks the saved frontiers back from the end to recover the edits
+func diffBacktrack(trace [][]int, a, b []string, off int) []diffLine {
+	x, y := len(a), len(b)
+	var out []diffLine
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		prevK := k - 1
+		if k == -d || k != d && v[off+k-1] < v[off+k+1] { prevK = k + 1 }
+		prevX := v[off+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY { out = append(out, diffLine{' ', a[x-1]}); x--; y-- }
+		if d > 0 {
+			if x == prevX { out = append(out, diffLine{'+', b[y-1]}) } else { out = append(out, diffLine{'-', a[x-1]}) }
+		}
+		x, y = prevX, prevY
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 { out[i], out[j] = out[j], out[i] }
+	return out
+}
+
+// splitLines splits text into lines without a trailing empty one
+func splitLines(s string) []string {
+	if s == "" { return nil }
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+var (
+	diffAddStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("70"))
+	diffDelStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("203"))
+)
+
+// renderDiff prints every line with its +/- marker, added lines green and removed
+// ones red unless plain
+func renderDiff(lines []diffLine, plain bool) string {
+	var b strings.Builder
+	for _, l := range lines {
+		line := string(l.op) + " " + l.text
+		switch {
+		case plain || l.op == ' ':
+		case l.op == '+':
+			line = diffAddStyle.Render(line)
+		case l.op == '-':
+			line = diffDelStyle.Render(line)
+		}
+		b.WriteString(line + "\n")
+	}
+	return b.String()
+}
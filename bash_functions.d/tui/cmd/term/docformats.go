@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// The preview renders markdown, so other document formats are converted to it
+// first: by asciidoctor and pandoc when they are installed, otherwise by the small
+// built-in converters below, which handle what dotfile docs commonly use.
+
+// convertTimeout bounds an external converter, so a huge file cannot hang the preview
+const convertTimeout = 10 * time.Second
+
+// docFormat is the preview format of path by extension: "markdown", "asciidoc", "org" or ""
+func docFormat(path string) string {
+	if isMarkdownFile(path) { return "markdown" }
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".adoc", ".asciidoc", ".asc":
+		return "asciidoc"
+	case ".org":
+		return "org"
+	}
+	return ""
+}
+
+// docMarkdown returns the source of the file at path as markdown for the preview
+func docMarkdown(path string, src []byte) string {
+	format := docFormat(path)
+	if format == "markdown" || format == "" { return string(src) }
+	if out, err := convertExternal(format, src); err == nil {
+		return out
+	} else if err != exec.ErrNotFound {
+		slog.Warn("document converter failed, using the built-in one", "path", path, "err", err)
+	}
+	if format == "org" { return orgToMarkdown(string(src)) }
+	return asciidocToMarkdown(string(src))
+}
+
+// convertExternal converts src with the installed tools: asciidoctor to DocBook and
+// pandoc from there for AsciiDoc, pandoc alone for Org. exec.ErrNotFound means the
+// tools are missing.
+func convertExternal(format string, src []byte) (string, error) {
+	if _, err := exec.LookPath("pandoc"); err != nil { return "", exec.ErrNotFound }
+	ctx, cancel := context.WithTimeout(context.Background(), convertTimeout)
+	defer cancel()
+	from := "org"
+	if format == "asciidoc" {
+		if _, err := exec.LookPath("asciidoctor"); err != nil { return "", exec.ErrNotFound }
+		var err error
+		if src, err = runConverter(ctx, src, "asciidoctor", "-b", "docbook5", "-o", "-", "-"); err != nil { return "", err }
+		from = "docbook"
+	}
+	out, err := runConverter(ctx, src, "pandoc", "-f", from, "-t", "gfm", "--wrap=none")
+	return string(out), err
+}
+
+// runConverter runs a converter with src on stdin; its stderr is part of the error
+func runConverter(ctx context.Context, src []byte, name string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdin = bytes.NewReader(src)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil { return nil, fmt.Errorf("%s: %w: %s", name, err, strings.TrimSpace(stderr.String())) }
+	return out, nil
+}
+
+var (
+	adocHeading   = regexp.MustCompile(`^(={1,6})\s+(.*)$`)
+	adocAttr      = regexp.MustCompile(`^:[\w-]+!?:`)
+	adocBlockAttr = regexp.MustCompile(`^\[([^\]]*)\]$`)
+	adocList      = regexp.MustCompile(`^(\*{1,5}|-|\.{1,5})\s+(.*)$`)
+	adocAdmon     = regexp.MustCompile(`^(NOTE|TIP|IMPORTANT|WARNING|CAUTION):\s+(.*)$`)
+	adocImage     = regexp.MustCompile(`^image::([^\[]+)\[([^\],]*)[^\]]*\]$`)
+	adocBold      = regexp.MustCompile(`(^|[^\w*])\*([^*\s](?:[^*]*[^*\s])?)\*($|[^\w*])`)
+	adocLink      = regexp.MustCompile(`(?:link:)?((?:https?|ftp|mailto):[^\s\[]+|link:[^\s\[]+)\[([^\]]*)\]`)
+	adocXref      = regexp.MustCompile(`<<([^,>]+)(?:,\s*([^>]+))?>>`)
+)
+
+// asciidocToMarkdown is the built-in AsciiDoc converter: section titles, attributes,
+// listing, literal and quote blocks, lists, admonitions, images, bold and links
+func asciidocToMarkdown(src string) string {
+	var b strings.Builder
+	lang, block := "", "" // language of the next listing block; delimiter of the open block
+	for _, line := range strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n") {
+		t := strings.TrimRight(line, " \t")
+		if block != "" {
+			switch {
+			case t == block && (block == "----" || block == "...."):
+				b.WriteString("```\n")
+				block = ""
+			case t == block:
+				block = ""
+			case block == "////":
+			case block == "____":
+				b.WriteString("> " + adocInline(t) + "\n")
+			case block == "----" || block == "....":
+				b.WriteString(line + "\n")
+			default:
+				b.WriteString(adocInline(t) + "\n")
+			}
+			continue
+		}
+		switch {
+		case t == "----" || t == "....":
+			b.WriteString("```" + lang + "\n")
+			block, lang = t, ""
+		case t == "////" || t == "____":
+			block = t
+		case t == "====" || t == "****" || t == "--" || t == "+":
+			// example, sidebar and open block delimiters and list continuations are dropped
+		case strings.HasPrefix(t, "//"), adocAttr.MatchString(t):
+		case adocBlockAttr.MatchString(t):
+			// [source,bash] sets the language of the listing block that follows
+			if f := strings.Split(adocBlockAttr.FindStringSubmatch(t)[1], ","); f[0] == "source" && len(f) > 1 { lang = strings.TrimSpace(f[1]) }
+		case adocHeading.MatchString(t):
+			mt := adocHeading.FindStringSubmatch(t)
+			b.WriteString(strings.Repeat("#", len(mt[1])) + " " + adocInline(mt[2]) + "\n")
+		case adocImage.MatchString(t):
+			mt := adocImage.FindStringSubmatch(t)
+			b.WriteString("![" + mt[2] + "](" + mt[1] + ")\n")
+		case adocAdmon.MatchString(t):
+			mt := adocAdmon.FindStringSubmatch(t)
+			b.WriteString("> **" + mt[1][:1] + strings.ToLower(mt[1][1:]) + ":** " + adocInline(mt[2]) + "\n")
+		case adocList.MatchString(t):
+			mt := adocList.FindStringSubmatch(t)
+			marker, depth := "- ", len(mt[1])-1
+			if mt[1] == "-" { depth = 0 }
+			if mt[1][0] == '.' { marker = "1. " }
+			b.WriteString(strings.Repeat("  ", depth) + marker + adocInline(mt[2]) + "\n")
+		case len(t) > 1 && t[0] == '.' && t[1] != '.' && t[1] != ' ':
+			// block title
+			b.WriteString("**" + adocInline(t[1:]) + "**\n")
+		default:
+			b.WriteString(adocInline(t) + "\n")
+		}
+	}
+	if block == "----" || block == "...." { b.WriteString("```\n") }
+	return b.String()
+}
+
+// adocInline converts inline markup outside of `code` spans
+func adocInline(s string) string {
+	return outsideCode(s, func(s string) string {
+		s = adocBold.ReplaceAllString(s, "$1**$2**$3")
+		s = adocXref.ReplaceAllStringFunc(s, func(x string) string {
+			mt := adocXref.FindStringSubmatch(x)
+			if mt[2] != "" { return mt[2] }
+			return mt[1]
+		})
+		return adocLink.ReplaceAllStringFunc(s, func(x string) string {
+			mt := adocLink.FindStringSubmatch(x)
+			url := strings.TrimPrefix(mt[1], "link:")
+			if mt[2] == "" { return "<" + url + ">" }
+			return "[" + mt[2] + "](" + url + ")"
+		})
+	})
+}
+
+var (
+	orgHeading = regexp.MustCompile(`^(\*+)\s+(.*?)(?:\s+(:[\w@#%:]+:))?\s*$`)
+	orgKeyword = regexp.MustCompile(`(?i)^#\+(\w+):\s*(.*)$`)
+	orgBegin   = regexp.MustCompile(`(?i)^#\+begin_(\w+)\s*(\S*)`)
+	orgList    = regexp.MustCompile(`^(\s*)([-+]|\d+[.)])\s+(.*)$`)
+	orgRule    = regexp.MustCompile(`^\|[-+|]+\|?$`)
+	orgLink    = regexp.MustCompile(`\[\[([^\]]+)\](?:\[([^\]]+)\])?\]`)
+	orgCode    = regexp.MustCompile(`(^|[\s(])[=~]([^\s=~](?:[^=~]*[^\s=~])?)[=~]($|[\s.,;:!?)])`)
+	orgBold    = regexp.MustCompile(`(^|[\s(])\*([^*\s](?:[^*]*[^*\s])?)\*($|[\s.,;:!?)])`)
+	orgItalic  = regexp.MustCompile(`(^|[\s(])/([^/\s](?:[^/]*[^/\s])?)/($|[\s.,;:!?)])`)
+	orgStrike  = regexp.MustCompile(`(^|[\s(])\+([^+\s](?:[^+]*[^+\s])?)\+($|[\s.,;:!?)])`)
+)
+
+// orgToMarkdown is the built-in Org converter: headlines with tags, #+TITLE, source,
+// example and quote blocks, drawers, lists, tables, links and emphasis
+func orgToMarkdown(src string) string {
+	var b strings.Builder
+	block, drawer := "", false // open #+begin_ block; inside a :PROPERTIES: style drawer
+	for _, line := range strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n") {
+		t := strings.TrimSpace(line)
+		if block != "" {
+			if strings.EqualFold(t, "#+end_"+block) {
+				if block != "quote" { b.WriteString("```\n") }
+				block = ""
+			} else if block == "quote" {
+				b.WriteString("> " + orgInline(t) + "\n")
+			} else {
+				b.WriteString(line + "\n")
+			}
+			continue
+		}
+		if drawer {
+			if strings.EqualFold(t, ":END:") { drawer = false }
+			continue
+		}
+		switch {
+		case orgBegin.MatchString(t):
+			mt := orgBegin.FindStringSubmatch(t)
+			block = strings.ToLower(mt[1])
+			switch block {
+			case "quote":
+			case "src":
+				b.WriteString("```" + mt[2] + "\n")
+			default:
+				b.WriteString("```\n")
+			}
+		case orgKeyword.MatchString(t):
+			if mt := orgKeyword.FindStringSubmatch(t); strings.EqualFold(mt[1], "title") { b.WriteString("# " + orgInline(mt[2]) + "\n") }
+		case t == "#" || strings.HasPrefix(t, "# "):
+			// comment
+		case len(t) > 2 && t[0] == ':' && t[len(t)-1] == ':' && !strings.Contains(t, " "):
+			drawer = true
+		case orgHeading.MatchString(line):
+			mt := orgHeading.FindStringSubmatch(line)
+			level := len(mt[1])
+			if level > 6 { level = 6 }
+			h := strings.Repeat("#", level) + " " + orgInline(mt[2])
+			if mt[3] != "" { h += " `" + mt[3] + "`" }
+			b.WriteString(h + "\n")
+		case orgRule.MatchString(t):
+			b.WriteString(strings.ReplaceAll(t, "+", "|") + "\n")
+		case orgList.MatchString(line):
+			mt := orgList.FindStringSubmatch(line)
+			marker := "- "
+			if mt[2][0] >= '0' && mt[2][0] <= '9' { marker = "1. " }
+			b.WriteString(mt[1] + marker + orgInline(mt[3]) + "\n")
+		default:
+			b.WriteString(orgInline(line) + "\n")
+		}
+	}
+	if block != "" && block != "quote" { b.WriteString("```\n") }
+	return b.String()
+}
+
+// orgInline converts links and emphasis; =verbatim= and ~code~ become code spans,
+// which the rest then leaves alone
+func orgInline(s string) string {
+	s = orgCode.ReplaceAllString(s, "$1`$2`$3")
+	return outsideCode(s, func(s string) string {
+		s = orgLink.ReplaceAllStringFunc(s, func(x string) string {
+			mt := orgLink.FindStringSubmatch(x)
+			if mt[2] == "" { return "<" + mt[1] + ">" }
+			return "[" + mt[2] + "](" + mt[1] + ")"
+		})
+		s = orgBold.ReplaceAllString(s, "$1**$2**$3")
+		s = orgItalic.ReplaceAllString(s, "$1*$2*$3")
+		return orgStrike.ReplaceAllString(s, "$1~~$2~~$3")
+	})
+}
+
+// outsideCode applies f to the parts of s that are not inside `code` spans
+func outsideCode(s string, f func(string) string) string {
+	parts := strings.Split(s, "`")
+	for i := 0; i < len(parts); i += 2 { parts[i] = f(parts[i]) }
+	return strings.Join(parts, "`")
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// maxRunningDownloads bounds concurrent yt-dlp processes; the rest stay queued
+const maxRunningDownloads = 2
+
+// maxResumes is how often a download whose process vanished is started again
+const maxResumes = 3
+
+// download states
+const (
+	DlQueued  = "queued"
+	DlRunning = "downloading"
+	DlDone    = "done"
+	DlFailed  = "failed"
+)
+
+// download is one yt-dlp download persisted in downloads.json. Like jobs, yt-dlp runs
+// detached from the TUI and writes its exit code to <id>.exit, so downloads go on
+// after the TUI exits and a later instance picks up their state. One that was cut off
+// (a reboot, say) is queued again and yt-dlp continues from its .part file.
+type download struct {
+	ID       string `json:"id"`
+	URL      string `json:"url"`
+	Title    string `json:"title"`
+	Format   string `json:"format"` // name of one of dlFormats
+	Dir      string `json:"dir"`
+	State    string `json:"state"`
+	PID      int    `json:"pid,omitempty"`
+	Queued   string `json:"queued"`
+	Started  string `json:"started,omitempty"`
+	Finished string `json:"finished,omitempty"`
+	Exit     int    `json:"exit"`
+	Log      string `json:"log"`
+	Resumes  int    `json:"resumes,omitempty"` // times restarted after its process was lost
+	File     string `json:"file,omitempty"`    // the downloaded file, once done
+}
+
+// dlFormat is a format choice offered when queueing; args go to yt-dlp
+type dlFormat struct {
+	Name string
+	Args []string
+}
+
+var dlFormats = []dlFormat{
+	{"best", []string{"-f", "bv*+ba/b"}},
+	{"1080p", []string{"-f", "bv*[height<=1080]+ba/b[height<=1080]"}},
+	{"720p", []string{"-f", "bv*[height<=720]+ba/b[height<=720]"}},
+	{"480p", []string{"-f", "bv*[height<=480]+ba/b[height<=480]"}},
+	{"audio (m4a)", []string{"-f", "ba[ext=m4a]/ba"}},
+	{"audio (mp3)", []string{"-f", "ba", "-x", "--audio-format", "mp3"}},
+}
+
+func dlFormatArgs(name string) []string {
+	for _, f := range dlFormats { if f.Name == name { return f.Args } }
+	return dlFormats[0].Args
+}
+
+// dlProgressTag marks the progress lines yt-dlp prints for us
+const dlProgressTag = "[cbw-progress]"
+
+// dlProgressTemplate makes yt-dlp print machine-readable progress, one line per update
+const dlProgressTemplate = "download:" + dlProgressTag + " %(progress.downloaded_bytes)s %(progress.total_bytes)s %(progress.total_bytes_estimate)s %(progress.speed)s %(progress.eta)s"
+
+type downloadsTickMsg struct{}
+
+func downloadsDir() string  { return filepath.Join(tuiDataDir(), "downloads") }
+func downloadsPath() string { return filepath.Join(tuiDataDir(), "downloads.json") }
+
+// dlPathFile is where yt-dlp writes the path of the file a download produced
+func dlPathFile(id string) string { return filepath.Join(downloadsDir(), id+".path") }
+
+// defaultDownloadDir is where downloads go unless download_dir is configured
+func defaultDownloadDir() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, "Downloads")
+}
+
+func loadDownloads() []download {
+	var dls []download
+	if b, err := ioutil.ReadFile(downloadsPath()); err == nil { _ = json.Unmarshal(b, &dls) }
+	return dls
+}
+
+func saveDownloads(dls []download) error {
+	b, err := json.MarshalIndent(dls, "", "  ")
+	if err != nil { return err }
+	tmp := downloadsPath() + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0o600); err != nil { return err }
+	return os.Rename(tmp, downloadsPath())
+}
+
+// enqueueDownload records a queued download and starts it if a slot is free
+func enqueueDownload(url, title, format, dir string) (download, error) {
+	if _, err := exec.LookPath("yt-dlp"); err != nil { return download{}, fmt.Errorf("yt-dlp not found in PATH") }
+	now := time.Now()
+	d := download{ID: fmt.Sprintf("dl-%d", now.UnixNano()), URL: url, Title: title, Format: format, Dir: dir, State: DlQueued, Queued: now.Format(time.RFC3339)}
+	d.Log = filepath.Join(downloadsDir(), d.ID+".log")
+	err := withLock("downloads", func() error {
+		dls := append(loadDownloads(), d)
+		dispatchDownloads(dls)
+		return saveDownloads(dls)
+	})
+	return d, err
+}
+
+// startDownloadProcess runs yt-dlp for d detached from the session, output to its log
+func startDownloadProcess(d *download) error {
+	if err := os.MkdirAll(downloadsDir(), 0o700); err != nil { return err }
+	if err := os.MkdirAll(d.Dir, 0o755); err != nil { return err }
+	args := append([]string{"yt-dlp", "--newline", "--no-colors", "--continue", "--progress-template", dlProgressTemplate,
+		"-P", d.Dir, "-o", "%(title)s [%(id)s].%(ext)s", "--print-to-file", "after_move:filepath", dlPathFile(d.ID)}, dlFormatArgs(d.Format)...)
+	args = append(args, "--", d.URL)
+	// the exit file is renamed into place, so its presence means the code is complete
+	cmd := exec.Command("/bin/sh", "-c", `"$@" >>"$CBW_DL_LOG" 2>&1; echo $? >"$CBW_DL_EXIT.tmp"; mv "$CBW_DL_EXIT.tmp" "$CBW_DL_EXIT"`, "sh")
+	cmd.Args = append(cmd.Args, args...)
+	cmd.Env = append(os.Environ(), "CBW_DL_LOG="+d.Log, "CBW_DL_EXIT="+filepath.Join(downloadsDir(), d.ID+".exit"))
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil { return err }
+	go cmd.Wait()
+	d.PID, d.State, d.Started = cmd.Process.Pid, DlRunning, time.Now().Format(time.RFC3339)
+	return nil
+}
+
+// dispatchDownloads starts queued downloads while fewer than maxRunningDownloads run
+// and returns how many it started, or tried to
+func dispatchDownloads(dls []download) (started int) {
+	running := 0
+	for _, d := range dls { if d.State == DlRunning { running++ } }
+	for i := range dls {
+		if running >= maxRunningDownloads { return started }
+		if dls[i].State != DlQueued { continue }
+		started++
+		if err := startDownloadProcess(&dls[i]); err != nil {
+			dls[i].State, dls[i].Exit, dls[i].Finished = DlFailed, 1, time.Now().Format(time.RFC3339)
+			slog.Error("failed to start download", "download", dls[i].ID, "url", dls[i].URL, "err", err)
+			appendFile(dls[i].Log, "failed to start: "+err.Error()+"\n")
+			continue
+		}
+		running++
+	}
+	return started
+}
+
+// reconcileDownload updates a running download from its exit file or process status;
+// a download whose process is gone without an exit code is queued to resume
+func reconcileDownload(d *download) bool {
+	if d.State != DlRunning { return false }
+	exitPath := filepath.Join(downloadsDir(), d.ID+".exit")
+	if b, err := ioutil.ReadFile(exitPath); err == nil {
+		code, err := strconv.Atoi(strings.TrimSpace(string(b)))
+		if err != nil { code = 1 }
+		d.State, d.Exit, d.Finished = DlDone, code, time.Now().Format(time.RFC3339)
+		if code != 0 { d.State = DlFailed }
+		// yt-dlp printed where the finished file went, after merging and conversion
+		if b, err := ioutil.ReadFile(dlPathFile(d.ID)); err == nil { d.File = strings.TrimSpace(string(b)) }
+		os.Remove(exitPath)
+		os.Remove(dlPathFile(d.ID))
+		return true
+	}
+	if processAlive(d.PID) { return false }
+	if d.Resumes < maxResumes {
+		d.State, d.PID, d.Resumes = DlQueued, 0, d.Resumes+1
+		appendFile(d.Log, "yt-dlp was interrupted; resuming\n")
+		return true
+	}
+	d.State, d.Exit, d.Finished = DlFailed, -1, time.Now().Format(time.RFC3339)
+	return true
+}
+
+// syncDownloads reconciles and starts downloads and returns them all
+func syncDownloads() ([]download, error) {
+	var all []download
+	err := withLock("downloads", func() error {
+		all = loadDownloads()
+		changed := false
+		for i := range all { if reconcileDownload(&all[i]) { changed = true } }
+		if dispatchDownloads(all) == 0 && !changed { return nil }
+		return saveDownloads(all)
+	})
+	return all, err
+}
+
+// updateDownloads applies fn to the downloads under the lock and saves them
+func updateDownloads(fn func([]download) []download) ([]download, error) {
+	var all []download
+	err := withLock("downloads", func() error {
+		all = fn(loadDownloads())
+		return saveDownloads(all)
+	})
+	return all, err
+}
+
+// cancelDownload stops a download and drops it from the queue; what was fetched stays
+func cancelDownload(id string) ([]download, error) {
+	return updateDownloads(func(dls []download) []download {
+		out := dls[:0]
+		for _, d := range dls {
+			if d.ID != id { out = append(out, d); continue }
+			// yt-dlp and its ffmpeg run in the session started for the download
+			if d.State == DlRunning && d.PID > 0 { syscall.Kill(-d.PID, syscall.SIGTERM) }
+			os.Remove(d.Log)
+		}
+		return out
+	})
+}
+
+// retryDownload queues a failed download again
+func retryDownload(id string) ([]download, error) {
+	return updateDownloads(func(dls []download) []download {
+		for i := range dls {
+			if dls[i].ID == id && dls[i].State == DlFailed { dls[i].State, dls[i].Resumes, dls[i].Finished = DlQueued, 0, "" }
+		}
+		dispatchDownloads(dls)
+		return dls
+	})
+}
+
+// clearDownloads drops finished downloads from the list
+func clearDownloads() ([]download, error) {
+	return updateDownloads(func(dls []download) []download {
+		out := dls[:0]
+		for _, d := range dls {
+			if d.State == DlDone { os.Remove(d.Log); continue }
+			out = append(out, d)
+		}
+		return out
+	})
+}
+
+func activeDownloads(dls []download) int {
+	n := 0
+	for _, d := range dls { if d.State == DlQueued || d.State == DlRunning { n++ } }
+	return n
+}
+
+func downloadsTick() tea.Cmd {
+	return tea.Tick(time.Second, func(time.Time) tea.Msg { return downloadsTickMsg{} })
+}
+
+// dlProgress is the state of a running download, read from the end of its log
+type dlProgress struct {
+	done, total int64   // bytes; total 0 when unknown
+	speed       float64 // bytes per second
+	eta         int     // seconds, -1 when unknown
+	phase       string  // "" while downloading, otherwise a post-processing step
+}
+
+func (p dlProgress) fraction() float64 {
+	if p.total <= 0 { return 0 }
+	return float64(p.done) / float64(p.total)
+}
+
+// readProgress parses the last progress line of d's log. A line from yt-dlp's
+// post-processors ([Merger], [ExtractAudio], ...) after it names the phase instead.
+func readProgress(d download) dlProgress {
+	p := dlProgress{eta: -1}
+	f, err := os.Open(d.Log)
+	if err != nil { return p }
+	defer f.Close()
+	if fi, err := f.Stat(); err == nil && fi.Size() > 8192 { f.Seek(fi.Size()-8192, io.SeekStart) }
+	b, _ := ioutil.ReadAll(f)
+	lines := strings.Split(strings.TrimRight(string(b), "\n"), "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		l := lines[i]
+		if strings.HasPrefix(l, dlProgressTag) { parseProgress(&p, l); return p }
+		if p.phase == "" && strings.HasPrefix(l, "[") && !strings.HasPrefix(l, "[download]") && !strings.HasPrefix(l, "[youtube]") && !strings.HasPrefix(l, "[info]") {
+			if j := strings.IndexByte(l, ']'); j > 0 { p.phase = l[1:j] }
+		}
+	}
+	return p
+}
+
+// parseProgress reads a dlProgressTemplate line; yt-dlp prints NA for unknown values
+func parseProgress(p *dlProgress, line string) {
+	f := strings.Fields(strings.TrimPrefix(line, dlProgressTag))
+	if len(f) < 5 { return }
+	num := func(s string) float64 { v, err := strconv.ParseFloat(s, 64); if err != nil { return 0 }; return v }
+	p.done, p.total = int64(num(f[0])), int64(num(f[1]))
+	if p.total == 0 { p.total = int64(num(f[2])) }
+	p.speed = num(f[3])
+	if f[4] != "NA" { p.eta = int(num(f[4])) }
+}
+
+// ytResult is one search hit
+type ytResult struct {
+	ID       string  `json:"id"`
+	Title    string  `json:"title"`
+	URL      string  `json:"url"`
+	Channel  string  `json:"channel"`
+	Duration float64 `json:"duration"`
+}
+
+type ytSearchMsg struct {
+	query   string
+	results []ytResult
+	err     error
+}
+
+// ytSearchLimit is how many results a search asks for
+const ytSearchLimit = 20
+
+// ytSearch searches YouTube with yt-dlp without downloading anything
+func ytSearch(query string) tea.Cmd {
+	return func() tea.Msg {
+		if _, err := exec.LookPath("yt-dlp"); err != nil { return ytSearchMsg{query: query, err: fmt.Errorf("yt-dlp not found in PATH")} }
+		out, err := exec.Command("yt-dlp", "--flat-playlist", "--dump-json", "--no-warnings", fmt.Sprintf("ytsearch%d:%s", ytSearchLimit, query)).Output()
+		if err != nil {
+			if ee, ok := err.(*exec.ExitError); ok { err = fmt.Errorf("yt-dlp: %s", strings.TrimSpace(string(ee.Stderr))) }
+			return ytSearchMsg{query: query, err: err}
+		}
+		var results []ytResult
+		for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+			var r ytResult
+			if json.Unmarshal([]byte(line), &r) != nil || r.ID == "" { continue }
+			if r.URL == "" { r.URL = "https://www.youtube.com/watch?v=" + r.ID }
+			results = append(results, r)
+		}
+		return ytSearchMsg{query: query, results: results}
+	}
+}
+
+func appendFile(path, s string) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil { return }
+	defer f.Close()
+	f.WriteString(s)
+}
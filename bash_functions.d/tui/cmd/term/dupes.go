@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// dupeSet is a group of files with the same content
+type dupeSet struct {
+	size  int64
+	sum   string
+	files []*usageNode // oldest first
+}
+
+// wasted is what deleting or linking all copies but one would free
+func (d dupeSet) wasted() int64 { return d.size * int64(len(d.files)-1) }
+
+// dupeScan hashes the files of a Usage scan that share a size; the counters are read
+// by the UI while it runs
+type dupeScan struct {
+	sets   []dupeSet // most space wasted first
+	total  int64     // bytes to hash
+	read   atomic.Int64
+	cur    atomic.Value // file being hashed
+	done   atomic.Bool
+	ctx    context.Context
+	cancel context.CancelFunc
+	sel    int // file row of the list
+}
+
+type dupeTickMsg struct{ d *dupeScan }
+
+func dupeTick(d *dupeScan) tea.Cmd {
+	return tea.Tick(250*time.Millisecond, func(time.Time) tea.Msg { return dupeTickMsg{d} })
+}
+
+// sizeGroups collects the regular files under n by size; only sizes shared by two or
+// more files can hold duplicates
+func sizeGroups(n *usageNode, groups map[int64][]*usageNode) {
+	for _, c := range n.children {
+		switch {
+		case c.dir:
+			sizeGroups(c, groups)
+		case c.regular && c.bytes > 0:
+			groups[c.bytes] = append(groups[c.bytes], c)
+		}
+	}
+}
+
+// startDupeScan groups the files under root by size, then hashes the groups of more
+// than one in the background
+func startDupeScan(root *usageNode) *dupeScan {
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &dupeScan{ctx: ctx, cancel: cancel}
+	d.cur.Store("")
+	groups := map[int64][]*usageNode{}
+	sizeGroups(root, groups)
+	for size, files := range groups {
+		if len(files) < 2 { delete(groups, size); continue }
+		d.total += size * int64(len(files))
+	}
+	go func() {
+		defer d.done.Store(true)
+		var sets []dupeSet
+		for size, files := range groups {
+			bySum := map[string][]*usageNode{}
+			for _, f := range files {
+				if ctx.Err() != nil { return }
+				d.cur.Store(f.path())
+				sum, err := sha256File(ctx, f.path(), &d.read)
+				if err != nil { continue }
+				bySum[sum] = append(bySum[sum], f)
+			}
+			for sum, same := range bySum {
+				if len(same) < 2 { continue }
+				sort.Slice(same, func(i, j int) bool { return same[i].mtime.Before(same[j].mtime) })
+				sets = append(sets, dupeSet{size: size, sum: sum, files: same})
+			}
+		}
+		sort.Slice(sets, func(i, j int) bool {
+			if sets[i].wasted() != sets[j].wasted() { return sets[i].wasted() > sets[j].wasted() }
+			return sets[i].sum < sets[j].sum
+		})
+		d.sets = sets
+	}()
+	return d
+}
+
+func sha256File(ctx context.Context, path string, n *atomic.Int64) (string, error) {
+	f, err := os.Open(path)
+	if err != nil { return "", err }
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, progressReader{ctx, f, n}); err != nil { return "", err }
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// findDupes shows the duplicates of the current scan, looking for them the first time
+func (m *model) findDupes() tea.Cmd {
+	v := m.usage
+	if v.dir == nil { m.status = T("scan a directory first (s)"); return nil }
+	v.showDupes = true
+	if v.dupes != nil { return nil }
+	v.dupes = startDupeScan(v.scan.root)
+	return dupeTick(v.dupes)
+}
+
+// dupesTicked shows the hashing progress, and the result once it is done
+func (m *model) dupesTicked(d *dupeScan) tea.Cmd {
+	if d != m.usage.dupes { return nil }
+	if !d.done.Load() {
+		if m.tabs[m.active] == "Usage" && d.total > 0 { m.status = T("hashing %s: %d%% of %s", filepath.Base(fmt.Sprint(d.cur.Load())), d.read.Load()*100/d.total, humanSize(d.total)) }
+		return dupeTick(d)
+	}
+	if d.ctx.Err() != nil { m.usage.dupes = nil; m.status = T("duplicate search cancelled"); return nil }
+	var wasted int64
+	for _, s := range d.sets { wasted += s.wasted() }
+	m.status = T("%d sets of duplicates, %s reclaimable", len(d.sets), humanSize(wasted))
+	return nil
+}
+
+// rows are the file rows of the duplicate list as set and file indexes
+func (d *dupeScan) rows() [][2]int {
+	var rows [][2]int
+	for i, s := range d.sets {
+		for j := range s.files { rows = append(rows, [2]int{i, j}) }
+	}
+	return rows
+}
+
+// dropDupes takes files out of a set, and the set out of the list once a single
+// copy is left
+func (d *dupeScan) dropDupes(set int, gone map[*usageNode]bool) {
+	var left []*usageNode
+	for _, f := range d.sets[set].files {
+		if !gone[f] { left = append(left, f) }
+	}
+	d.sets[set].files = left
+	if len(left) < 2 { d.sets = append(d.sets[:set], d.sets[set+1:]...) }
+	d.sel = max(0, min(d.sel, len(d.rows())-1))
+}
+
+// linkDupe replaces path with a hard link to keep, through a temporary name so path
+// is never missing
+func linkDupe(keep, path string) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil { return err }
+	tmp.Close()
+	os.Remove(tmp.Name())
+	if err := os.Link(keep, tmp.Name()); err != nil { return err }
+	if err := os.Rename(tmp.Name(), path); err != nil { os.Remove(tmp.Name()); return err }
+	return nil
+}
+
+// updateDupes handles the keys of the duplicate list: d deletes the selected copy,
+// L replaces the other copies with hard links to it, esc goes back to the sizes
+func (m *model) updateDupes(key string) (tea.Cmd, bool) {
+	v := m.usage
+	d := v.dupes
+	if !d.done.Load() {
+		if key == "esc" { d.cancel(); v.showDupes = false; return nil, true }
+		return nil, false
+	}
+	rows := d.rows()
+	switch key {
+	case "up", "k":
+		if d.sel > 0 { d.sel-- }
+	case "down", "j":
+		if d.sel < len(rows)-1 { d.sel++ }
+	case "esc", "D":
+		v.showDupes = false
+	case "d":
+		if d.sel >= len(rows) || m.denyReadOnly() { return nil, true }
+		set, f := rows[d.sel][0], d.sets[rows[d.sel][0]].files[rows[d.sel][1]]
+		m.ask(T("delete %s, a copy of %d other files?", f.path(), len(d.sets[set].files)-1), func(m *model) tea.Cmd {
+			if m.deleteUsageNode(f) { d.dropDupes(set, map[*usageNode]bool{f: true}) }
+			return nil
+		})
+	case "L":
+		if d.sel >= len(rows) || m.denyReadOnly() { return nil, true }
+		set, keep := rows[d.sel][0], d.sets[rows[d.sel][0]].files[rows[d.sel][1]]
+		s := d.sets[set]
+		m.ask(T("replace the %d other copies with hard links to %s?", len(s.files)-1, keep.path()), func(m *model) tea.Cmd {
+			var failed []string
+			var freed int64
+			linked := map[*usageNode]bool{}
+			for _, f := range s.files {
+				if f == keep { continue }
+				err := linkDupe(keep.path(), f.path())
+				appendAudit(m.auditPath, fmt.Sprintf("%s\tdupes=hardlink\tpath=%s\ttarget=%s\tuser=%s\terror=%v", time.Now().Format(time.RFC3339), f.path(), keep.path(), transferUser(), err))
+				if err != nil { failed = append(failed, fmt.Sprintf("%s: %v", f.name, err)); continue }
+				// a hard link takes no space of its own
+				for a := f.parent; a != nil; a = a.parent { a.size -= f.size }
+				freed += f.size
+				f.size = 0
+				linked[f] = true
+			}
+			d.dropDupes(set, linked)
+			m.status = T("linked to %s, freeing %s", keep.name, humanSize(freed))
+			if len(failed) > 0 { m.status = T("linking failed: %s", strings.Join(failed, "; ")); slog.Warn("hard link failed", "files", failed) }
+			return nil
+		})
+	default:
+		return nil, false
+	}
+	return nil, true
+}
+
+// dupesView renders the duplicate list in w x h cells
+func (m model) dupesView(w, h int) string {
+	d := m.usage.dupes
+	var b strings.Builder
+	if !d.done.Load() {
+		pct := int64(100)
+		if d.total > 0 { pct = d.read.Load() * 100 / d.total }
+		return T("Looking for duplicates: hashing %s (%d%% of %s), esc cancels", d.cur.Load(), pct, humanSize(d.total)) + "\n"
+	}
+	var wasted int64
+	for _, s := range d.sets { wasted += s.wasted() }
+	hdr := T("Duplicates under %s: %d sets, %s reclaimable", m.usage.scan.root.name, len(d.sets), humanSize(wasted))
+	if !m.plain { hdr = activeTabStyle.Render(hdr) }
+	b.WriteString(hdr + "\n")
+	help := T("d: delete copy • L: hard-link the other copies to this one • esc: back to sizes")
+	if !m.plain { help = helpStyle.Render(help) }
+	b.WriteString(help + "\n\n")
+	if len(d.sets) == 0 { b.WriteString(T("No duplicate files.") + "\n"); return b.String() }
+	// lines of the list, with the line of each file row
+	var lines []string
+	var at []int
+	root := m.usage.scan.root.name
+	now := time.Now()
+	for _, s := range d.sets {
+		head := T("%s × %d, %s reclaimable  sha256 %s…", humanSize(s.size), len(s.files), humanSize(s.wasted()), s.sum[:12])
+		if !m.plain { head = helpStyle.Render(head) }
+		lines = append(lines, head)
+		for _, f := range s.files {
+			rel, err := filepath.Rel(root, f.path())
+			if err != nil { rel = f.path() }
+			at = append(at, len(lines))
+			lines = append(lines, fmt.Sprintf("%s  %4s  %s", f.mtime.Format(fileTimeLayout), k8sAge(now.Sub(f.mtime)), truncateCells(rel, max(10, w-30))))
+		}
+	}
+	cur := at[min(d.sel, len(at)-1)]
+	n := max(1, h-4)
+	start := max(0, min(cur-n/2, len(lines)-n))
+	rowAt := map[int]bool{}
+	for _, l := range at { rowAt[l] = true }
+	for i := start; i < min(len(lines), start+n); i++ {
+		marker := ""
+		if rowAt[i] { marker = selMarker(i == cur) }
+		b.WriteString(marker + lines[i] + "\n")
+	}
+	return b.String()
+}
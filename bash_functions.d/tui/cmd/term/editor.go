@@ -0,0 +1,206 @@
+package main
+
+import (
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/bubbles/textarea"
+	"github.com/charmbracelet/bubbles/textinput"
+)
+
+// openInEditor loads path into the embedded editor with the cursor on the 1-based
+// line and column (values below 1 mean the start) and switches to the Editor tab.
+// Files the user cannot write open read-only. The returned command focuses the
+// textarea, whose next update scrolls to the cursor.
+func (m *model) openInEditor(path string, line, col int) tea.Cmd {
+	return m.openEditor(path, line, col, false)
+}
+
+// openReadOnly opens path like openInEditor but blocks edits and saves
+func (m *model) openReadOnly(path string, line, col int) tea.Cmd {
+	return m.openEditor(path, line, col, true)
+}
+
+func (m *model) openEditor(path string, line, col int, readOnly bool) tea.Cmd {
+	b, err := ioutil.ReadFile(path)
+	if err != nil { m.status = T("failed to read file for editor"); slog.Warn("failed to read file for editor", "path", path, "err", err); return nil }
+	m.ta.SetValue(string(b))
+	m.editorFile = path
+	m.draft = nil
+	m.editorRO = readOnly || readOnlySession() || !fileWritable(path)
+	if m.vim != nil { m.vim.insert = false } // files open in normal mode
+	editorGoto(&m.ta, line, col)
+	m.active = m.tabIndex("Editor")
+	if m.editorRO { recordRecent(path, "viewed"); m.visit(jump{kind: "view", path: path, line: line}) } else { recordRecent(path, "edited"); m.visit(jump{kind: "edit", path: path, line: line}) }
+	switch {
+	case m.editorRO:
+		m.status = T("viewing (read-only): %s", filepath.Base(path))
+	case line > 1:
+		m.status = T("editing: %s:%d", filepath.Base(path), line)
+	default:
+		m.status = T("editing: %s", filepath.Base(path))
+	}
+	return m.ta.Focus()
+}
+
+// fileWritable reports whether the user may write path, or create it if it is missing
+func fileWritable(path string) bool {
+	if _, err := os.Stat(path); os.IsNotExist(err) { path = filepath.Dir(path) }
+	return syscall.Access(path, 2) == nil // W_OK
+}
+
+// readOnlyKeys move the cursor or run editor commands that leave the buffer alone
+// (goto line, bracket jump, alt+w, quit); they are all a read-only buffer accepts
+var readOnlyKeys = map[string]bool{
+	"ctrl+g": true, "ctrl+]": true, "alt+w": true, "ctrl+q": true,
+	"up": true, "down": true, "left": true, "right": true, "pgup": true, "pgdown": true, "home": true, "end": true,
+	"ctrl+a": true, "ctrl+e": true, "ctrl+f": true, "ctrl+b": true, "ctrl+n": true, "ctrl+p": true,
+	"alt+left": true, "alt+right": true, "alt+f": true, "alt+b": true, "alt+<": true, "alt+>": true, "ctrl+home": true, "ctrl+end": true,
+}
+
+// toggleReadOnly switches a writable file between read-only and editing
+func (m *model) toggleReadOnly() {
+	if m.editorFile == "" { return }
+	if m.editorRO && m.denyReadOnly() { return }
+	if m.editorRO && !fileWritable(m.editorFile) { m.status = T("%s is not writable", m.editorFile); return }
+	m.editorRO = !m.editorRO
+	if m.editorRO { m.status = T("read-only") } else { m.status = T("editing: %s", filepath.Base(m.editorFile)) }
+}
+
+// editorGoto moves the editor cursor to the 1-based line and column, clamped to the
+// buffer
+func editorGoto(ta *textarea.Model, line, col int) {
+	for ta.Line() > 0 { ta.CursorUp() }
+	for ta.Line() < line-1 && ta.Line() < ta.LineCount()-1 { ta.CursorDown() }
+	ta.CursorStart()
+	if col > 1 { ta.SetCursor(col - 1) }
+}
+
+// parseFileTarget splits the "path:line:col" locations printed by grep -n, shellcheck
+// -f gcc, compilers and diff tools. Missing or non-numeric parts leave line/col at 0.
+func parseFileTarget(s string) (path string, line, col int) {
+	parts := strings.SplitN(s, ":", 4)
+	path = parts[0]
+	if len(parts) > 1 { line, _ = strconv.Atoi(parts[1]) }
+	if len(parts) > 2 { col, _ = strconv.Atoi(parts[2]) }
+	if line == 0 { return s, 0, 0 }
+	return path, line, col
+}
+
+// saveEditor writes the buffer to its file, appending a modification-log entry first
+// for scripts with the standard header. It reports whether the write succeeded.
+func (m *model) saveEditor() bool {
+	if m.editorFile == "" {
+		m.status = T("no file path to save to (open a file from Files with 'E')")
+		return false
+	}
+	if m.editorRO {
+		m.status = T("read-only: %s was not saved (alt+w to edit)", m.editorFile)
+		return false
+	}
+	if src, at, n := appendModLog(m.ta.Value(), m.cfg.Author, "edited"); n > 0 { m.rewriteEditor(src, at, n) }
+	if err := ioutil.WriteFile(m.editorFile, []byte(m.ta.Value()), 0o600); err != nil {
+		m.status = T("save failed: %v", err); slog.Warn("save failed", "err", err)
+		return false
+	}
+	m.status = T("saved: %s", m.editorFile)
+	return true
+}
+
+// editorCursor returns the 0-based line and rune column of the editor cursor
+func editorCursor(ta textarea.Model) (line, col int) {
+	li := ta.LineInfo()
+	return ta.Line(), li.StartColumn + li.ColumnOffset
+}
+
+func newGotoInput() textinput.Model {
+	ti := textinput.New()
+	ti.Prompt = T("go to line: ")
+	ti.Placeholder = T("line[:col]")
+	ti.CharLimit = 16
+	return ti
+}
+
+// updateGoto handles keys while the ctrl+g prompt has focus
+func (m *model) updateGoto(msg tea.KeyMsg) tea.Cmd {
+	switch msg.String() {
+	case "esc":
+		m.gotoInput.Blur()
+		return m.ta.Focus()
+	case "enter":
+		v := strings.TrimSpace(m.gotoInput.Value())
+		m.gotoInput.Blur()
+		_, line, col := parseFileTarget(":" + v)
+		if line < 1 { m.status = T("not a line number: %q", v); return m.ta.Focus() }
+		editorGoto(&m.ta, line, col)
+		m.status = T("line %d of %d", m.ta.Line()+1, m.ta.LineCount())
+		return m.ta.Focus()
+	}
+	var cmd tea.Cmd
+	m.gotoInput, cmd = m.gotoInput.Update(msg)
+	return cmd
+}
+
+var bracketPairs = map[rune]rune{'(': ')', '[': ']', '{': '}', ')': '(', ']': '[', '}': '{'}
+
+// matchBracket finds the partner of the bracket under the cursor, or just before it
+// as after typing one. It counts nesting only; brackets inside strings, comments and
+// bash case patterns count too. at is the bracket the match belongs to; onBracket is
+// false when the cursor is not at one.
+func matchBracket(lines []string, line, col int) (at, match [2]int, onBracket, ok bool) {
+	if line < 0 || line >= len(lines) { return at, match, false, false }
+	cur := []rune(lines[line])
+	for _, c := range []int{col, col - 1} {
+		if c < 0 || c >= len(cur) { continue }
+		open := cur[c]
+		closeR, isBracket := bracketPairs[open]
+		if !isBracket { continue }
+		at = [2]int{line, c}
+		dir := 1
+		if strings.ContainsRune(")]}", open) { dir = -1 }
+		depth := 0
+		for l, i := line, c; l >= 0 && l < len(lines); l += dir {
+			rs := []rune(lines[l])
+			if l != line { i = 0; if dir < 0 { i = len(rs) - 1 } }
+			for ; i >= 0 && i < len(rs); i += dir {
+				switch rs[i] {
+				case open:
+					depth++
+				case closeR:
+					depth--
+					if depth == 0 { return at, [2]int{l, i}, true, true }
+				}
+			}
+		}
+		return at, match, true, false
+	}
+	return at, match, false, false
+}
+
+// bracketHint is shown under the editor when the cursor is at a bracket: where its
+// partner is and that line, with the partner highlighted
+func (m model) bracketHint() string {
+	lines := strings.Split(m.ta.Value(), "\n")
+	line, col := editorCursor(m.ta)
+	at, match, onBracket, ok := matchBracket(lines, line, col)
+	if !onBracket { return "" }
+	if !ok { return helpStyle.Render(T("%c at %d:%d has no match", []rune(lines[at[0]])[at[1]], at[0]+1, at[1]+1)) }
+	rs := []rune(lines[match[0]])
+	text := string(rs[:match[1]]) + activeTabStyle.Reverse(true).Render(string(rs[match[1]])) + string(rs[match[1]+1:])
+	if m.plain { text = string(rs[:match[1]]) + "[" + string(rs[match[1]]) + "]" + string(rs[match[1]+1:]) }
+	return helpStyle.Render(T("match %d:%d ", match[0]+1, match[1]+1)) + strings.TrimSpace(text)
+}
+
+// jumpToBracket moves the cursor onto the partner of the bracket at the cursor
+func (m *model) jumpToBracket() {
+	line, col := editorCursor(m.ta)
+	_, match, _, ok := matchBracket(strings.Split(m.ta.Value(), "\n"), line, col)
+	if !ok { m.status = T("no matching bracket"); return }
+	editorGoto(&m.ta, match[0]+1, match[1]+1)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+// transforms are the encoders of the command palette, by the name typed before the
+// text; the names ending in d decode
+var transforms = map[string]func(string) (string, error){
+	"b64":    func(s string) (string, error) { return base64.StdEncoding.EncodeToString([]byte(s)), nil },
+	"b64url": func(s string) (string, error) { return base64.RawURLEncoding.EncodeToString([]byte(s)), nil },
+	"b64d":   decodeBase64,
+	"url":    func(s string) (string, error) { return url.QueryEscape(s), nil },
+	"urld":   url.QueryUnescape,
+	"json":   func(s string) (string, error) { b, err := json.Marshal(s); return string(b), err },
+	"jsond":  decodeJSONString,
+	"hex":    func(s string) (string, error) { return hex.EncodeToString([]byte(s)), nil },
+	"hexd":   decodeHex,
+}
+
+// decodeBase64 takes the standard and URL alphabets, padded or not, with line breaks
+func decodeBase64(s string) (string, error) {
+	s = strings.Join(strings.Fields(s), "")
+	s = strings.TrimRight(s, "=")
+	if strings.ContainsAny(s, "-_") { return decodedText(base64.RawURLEncoding.DecodeString(s)) }
+	return decodedText(base64.RawStdEncoding.DecodeString(s))
+}
+
+// decodeJSONString unquotes a JSON string; the quotes may be left off
+func decodeJSONString(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, `"`) { s = `"` + s + `"` }
+	var out string
+	err := json.Unmarshal([]byte(s), &out)
+	return out, err
+}
+
+// decodeHex ignores the spaces and colons of dumps and fingerprints
+func decodeHex(s string) (string, error) {
+	s = strings.NewReplacer(" ", "", ":", "", "\n", "", "\t", "").Replace(s)
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+	return decodedText(hex.DecodeString(s))
+}
+
+// decodedText refuses bytes that are not text, which could not be shown or pasted
+func decodedText(b []byte, err error) (string, error) {
+	if err != nil { return "", err }
+	if !utf8.Valid(b) { return "", errors.New(T("the result is binary (%d bytes), not text", len(b))) }
+	return string(b), nil
+}
+
+// transformSource is the text a transform typed without any works on: the line under
+// the cursor in the Editor, otherwise the newest clipboard history entry
+func (m *model) transformSource() (what, text string) {
+	if m.tabs[m.active] == "Editor" {
+		lines := strings.Split(m.ta.Value(), "\n")
+		if l := m.ta.Line(); l < len(lines) { return T("editor line %d", l+1), lines[l] }
+	}
+	if clips := loadClips(); len(clips) > 0 { return T("clipboard"), clips[0].Text }
+	return "", ""
+}
+
+// runTransform applies a palette transform: "b64 hello", or "b64" alone for the
+// transformSource. ok is false when q does not name one.
+func (m *model) runTransform(q string) (name, source, out string, ok bool, err error) {
+	name, text, hasText := strings.Cut(q, " ")
+	fn, ok := transforms[strings.ToLower(name)]
+	if !ok { return "", "", "", false, nil }
+	source = T("input")
+	if !hasText || strings.TrimSpace(text) == "" {
+		source, text = m.transformSource()
+		if source == "" { return name, "", "", true, errors.New(T("nothing to transform: type the text after %s", name)) }
+	}
+	out, err = fn(text)
+	return strings.ToLower(name), source, out, true, err
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// saveOutput writes content to a timestamped file in dir and returns its path.
+// label (usually the active tab) becomes part of the file name.
+func saveOutput(dir, label, content string) (string, error) { return saveOutputAs(dir, label, ".txt", content) }
+
+// saveOutputAs is saveOutput with the file extension ext
+func saveOutputAs(dir, label, ext, content string) (string, error) {
+	if strings.TrimSpace(content) == "" { return "", fmt.Errorf("nothing to save") }
+	if err := os.MkdirAll(dir, 0o700); err != nil { return "", err }
+	name := fmt.Sprintf("%s-%s%s", time.Now().Format("20060102-150405"), strings.ToLower(label), ext)
+	path := filepath.Join(dir, name)
+	// avoid clobbering a save made within the same second
+	for i := 1; ; i++ {
+		if _, err := os.Stat(path); os.IsNotExist(err) { break }
+		path = filepath.Join(dir, fmt.Sprintf("%s-%d%s", strings.TrimSuffix(name, ext), i, ext))
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0o600); err != nil { return "", err }
+	return path, nil
+}
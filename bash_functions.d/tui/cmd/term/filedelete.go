@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// maxDeleteNames is how many of the marked files the delete dialog names
+const maxDeleteNames = 10
+
+// deleteSelected is d in the Files tab. With files marked it asks whether d means
+// them or only the selected entry; otherwise it confirms deleting the selection.
+func (m *model) deleteSelected() tea.Cmd {
+	if m.denyReadOnly() { return nil }
+	sel, ok := m.list.SelectedItem().(fileItem)
+	if len(m.files.marked) == 0 {
+		if !ok { return nil }
+		return m.confirmDelete(sel)
+	}
+	marked := append([]string(nil), m.files.marked...)
+	choices := []string{T("delete the %d marked files", len(marked))}
+	if ok { choices = append(choices, T("delete only %s", sel.name)) }
+	choices = append(choices, T("cancel"))
+	m.askChoice(T("Delete which files?"), deleteNames(marked), choices, func(m *model, i int) tea.Cmd {
+		switch {
+		case i == 0:
+			m.deletePaths(marked)
+		case ok && i == 1:
+			return m.confirmDelete(sel)
+		default:
+			m.status = T("cancelled")
+		}
+		return nil
+	})
+	return nil
+}
+
+// deleteNames lists the files a delete is about to remove, up to maxDeleteNames
+func deleteNames(paths []string) string {
+	var names []string
+	for i, p := range paths {
+		if i == maxDeleteNames { names = append(names, T("and %d more", len(paths)-i)); break }
+		names = append(names, p)
+	}
+	return strings.Join(names, "\n")
+}
+
+// confirmDelete asks before deleting one entry; a directory with anything in it needs
+// its name typed, since everything under it goes too
+func (m *model) confirmDelete(f fileItem) tea.Cmd {
+	del := func(m *model) tea.Cmd { m.deletePaths([]string{f.path}); return nil }
+	if !f.isDir {
+		m.askDetail(T("Delete %s?", f.name), T("%s\n%s, modified %s", f.path, humanSize(f.size), f.mtime.Format("2006-01-02 15:04")), del)
+		return nil
+	}
+	entries, err := os.ReadDir(f.path)
+	if err != nil { m.status = T("cannot read %s: %v", f.path, err); return nil }
+	if len(entries) == 0 {
+		m.askDetail(T("Delete the empty directory %s?", f.name), f.path, del)
+		return nil
+	}
+	return m.askTyped(T("Delete the directory %s and everything in it?", f.name), T("%s holds %d entries.", f.path, len(entries)), f.name, del)
+}
+
+// deletePaths removes files and directory trees, auditing each, then unmarks them,
+// drops their tags and rereads the directory
+func (m *model) deletePaths(paths []string) {
+	var gone []string
+	var failed error
+	for _, p := range paths {
+		err := os.RemoveAll(p)
+		appendAudit(m.auditPath, fmt.Sprintf("%s\tfile=delete\tpath=%s\tuser=%s\terror=%v", time.Now().Format(time.RFC3339), p, transferUser(), err))
+		if err != nil { failed = err; slog.Warn("delete failed", "path", p, "err", err); continue }
+		gone = append(gone, p)
+	}
+	removed := map[string]bool{}
+	for _, p := range gone { removed[p] = true }
+	var marked []string
+	for _, p := range m.files.marked { if !removed[p] { marked = append(marked, p) } }
+	m.files.marked = marked
+	if err := dropTags(gone); err != nil { slog.Warn("tags not dropped", "err", err) }
+	m.refreshFiles()
+	switch {
+	case failed != nil:
+		m.status = T("deleted %d of %d: %v", len(gone), len(paths), failed)
+	case len(gone) == 1:
+		m.status = T("deleted %s", filepath.Base(gone[0]))
+	default:
+		m.status = T("deleted %d files", len(gone))
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// diffContext is how many unchanged lines a hunk shows around its changes
+const diffContext = 3
+
+// maxDiffSize bounds the files D diffs: the edit script search keeps a frontier per
+// edit, so two large, very different files would take a lot of memory
+const maxDiffSize = 1 << 20
+
+// diffHunk is a run of changes with its context, as indexes into the diff lines
+type diffHunk struct{ start, end int }
+
+// fileDiff is the diff of the two files marked in the Files tab, shown in the
+// viewport until other content replaces it
+type fileDiff struct {
+	a, b  string // the first and second marked file
+	lines []diffLine
+	hunks []diffHunk
+	rows  []int // line of each hunk header in the rendered diff
+	cur   int   // hunk the last ] or [ went to
+	side  bool  // side by side instead of unified
+}
+
+// diffHunks groups the changes of lines into hunks, merging those whose context
+// would overlap
+func diffHunks(lines []diffLine) []diffHunk {
+	var hunks []diffHunk
+	for i := 0; i < len(lines); i++ {
+		if lines[i].op == ' ' { continue }
+		start := max(i-diffContext, 0)
+		end := i
+		for j := i; j < len(lines) && j <= end+2*diffContext; j++ {
+			if lines[j].op != ' ' { end = j }
+		}
+		end = min(end+diffContext+1, len(lines))
+		if n := len(hunks); n > 0 && hunks[n-1].end >= start { hunks[n-1].end = end } else { hunks = append(hunks, diffHunk{start, end}) }
+		i = end - 1
+	}
+	return hunks
+}
+
+// hunkHeader is the @@ -l,n +l,n @@ line of h
+func hunkHeader(lines []diffLine, h diffHunk) string {
+	la, lb := 1, 1
+	for _, l := range lines[:h.start] {
+		if l.op != '+' { la++ }
+		if l.op != '-' { lb++ }
+	}
+	na, nb := 0, 0
+	for _, l := range lines[h.start:h.end] {
+		if l.op != '+' { na++ }
+		if l.op != '-' { nb++ }
+	}
+	return fmt.Sprintf("@@ -%d,%d +%d,%d @@", la, na, lb, nb)
+}
+
+// readDiffable reads a file for diffing, refusing binaries and files too big to diff
+func readDiffable(path string) ([]string, error) {
+	fi, err := os.Stat(path)
+	if err != nil { return nil, err }
+	if fi.IsDir() { return nil, errors.New(T("%s is a directory", filepath.Base(path))) }
+	if fi.Size() > maxDiffSize { return nil, errors.New(T("%s is too big to diff (%s)", filepath.Base(path), humanSize(fi.Size()))) }
+	b, err := ioutil.ReadFile(path)
+	if err != nil { return nil, err }
+	if bytes.IndexByte(b, 0) >= 0 { return nil, errors.New(T("%s is a binary file", filepath.Base(path))) }
+	return splitLines(string(b)), nil
+}
+
+// render lays the hunks out, unified or in two columns of width, and records where
+// each hunk starts
+func (d *fileDiff) render(width int, plain bool) string {
+	var b strings.Builder
+	head := "--- " + d.a + "\n+++ " + d.b
+	if d.side { head = T("left: %s\nright: %s", d.a, d.b) }
+	b.WriteString(head + "\n")
+	d.rows = d.rows[:0]
+	for _, h := range d.hunks {
+		d.rows = append(d.rows, strings.Count(b.String(), "\n"))
+		hdr := hunkHeader(d.lines, h)
+		if !plain { hdr = helpStyle.Render(hdr) }
+		b.WriteString(hdr + "\n")
+		if d.side { b.WriteString(sideBySide(d.lines[h.start:h.end], width, plain)) } else { b.WriteString(renderDiff(d.lines[h.start:h.end], plain)) }
+	}
+	return b.String()
+}
+
+// sideBySide pairs each run of removed lines with the added lines after it, old on
+// the left and new on the right
+func sideBySide(lines []diffLine, width int, plain bool) string {
+	cw := max((width-3)/2, 8)
+	cell := func(op byte, s string) string {
+		s = truncateCells(strings.ReplaceAll(s, "\t", "    "), cw)
+		s += strings.Repeat(" ", max(cw-len([]rune(s)), 0))
+		switch {
+		case plain || op == ' ':
+		case op == '+':
+			s = diffAddStyle.Render(s)
+		case op == '-':
+			s = diffDelStyle.Render(s)
+		}
+		return s
+	}
+	mark := func(op byte) string {
+		if op == ' ' { return " │ " }
+		return " " + string(op) + " "
+	}
+	var b strings.Builder
+	for i := 0; i < len(lines); {
+		if lines[i].op == ' ' {
+			b.WriteString(cell(' ', lines[i].text) + " │ " + cell(' ', lines[i].text) + "\n")
+			i++
+			continue
+		}
+		var del, add []string
+		for ; i < len(lines) && lines[i].op == '-'; i++ { del = append(del, lines[i].text) }
+		for ; i < len(lines) && lines[i].op == '+'; i++ { add = append(add, lines[i].text) }
+		for j := 0; j < max(len(del), len(add)); j++ {
+			left, right := cell(' ', ""), cell(' ', "")
+			op := byte('|')
+			if j < len(del) { left = cell('-', del[j]) } else { op = '>' }
+			if j < len(add) { right = cell('+', add[j]) } else { op = '<' }
+			b.WriteString(left + mark(op) + right + "\n")
+		}
+	}
+	return b.String()
+}
+
+// applyHunk is one file with hunk h of the diff applied: the first file taking the
+// second's lines, or with toFirst false the second file taking the first's
+func (d *fileDiff) applyHunk(h diffHunk, toFirst bool) string {
+	inside, outside := byte('-'), byte('+')
+	if toFirst { inside, outside = outside, inside }
+	var out []string
+	for i, l := range d.lines {
+		in := i >= h.start && i < h.end
+		if l.op == ' ' || in && l.op == inside || !in && l.op == outside { out = append(out, l.text) }
+	}
+	return strings.Join(out, "\n") + "\n"
+}
+
+// toggleDiffMark marks the selected file for D and the other tools working on marked
+// files, or unmarks it
+func (m *model) toggleDiffMark() {
+	sel, ok := m.list.SelectedItem().(fileItem)
+	if !ok || sel.isDir { m.status = T("select a file to mark"); return }
+	for i, p := range m.files.marked {
+		if p == sel.path {
+			m.files.marked = append(m.files.marked[:i], m.files.marked[i+1:]...)
+			m.status = T("unmarked %s", sel.name)
+			m.list.Title = m.filesTitle()
+			return
+		}
+	}
+	m.files.marked = append(m.files.marked, sel.path)
+	m.list.Title = m.filesTitle()
+	switch len(m.files.marked) {
+	case 1:
+		m.status = T("marked %s: mark another file or press D on it", sel.name)
+	case 2:
+		m.status = T("marked %s: press D to diff", sel.name)
+	default:
+		m.status = T("marked %s: %d files marked", sel.name, len(m.files.marked))
+	}
+}
+
+// diffMarked diffs the two marked files, or the one marked file against the selected one
+func (m *model) diffMarked() {
+	paths := append([]string(nil), m.files.marked...)
+	if sel, ok := m.list.SelectedItem().(fileItem); ok && len(paths) == 1 && sel.path != paths[0] && !sel.isDir { paths = append(paths, sel.path) }
+	if len(paths) != 2 { m.status = T("mark two files with m, or one and select the other"); return }
+	a, err := readDiffable(paths[0])
+	if err != nil { m.status = T("diff failed: %v", err); return }
+	b, err := readDiffable(paths[1])
+	if err != nil { m.status = T("diff failed: %v", err); return }
+	m.showFileDiff(&fileDiff{a: paths[0], b: paths[1], lines: diffLines(a, b)})
+}
+
+// showFileDiff shows d in a Preview pane beside the Files list
+func (m *model) showFileDiff(d *fileDiff) {
+	d.hunks = diffHunks(d.lines)
+	if len(d.hunks) == 0 { m.status = T("%s and %s are identical", filepath.Base(d.a), filepath.Base(d.b)); return }
+	m.panes.show(true, m.tabs[m.active], "Preview")
+	m.setContent(d.render(m.vp.Width, m.plain))
+	m.fileDiff = d
+	m.vp.GotoTop()
+	m.status = T("%d hunks: ]/[ next/previous, | unified/side by side, a/A apply to the first/second file, esc close", len(d.hunks))
+}
+
+// gotoHunk scrolls the viewport to hunk i; wrapped lines above it count as many rows
+// as they take
+func (m *model) gotoHunk(i int) {
+	d := m.fileDiff
+	d.cur = i
+	row := d.rows[i]
+	if !m.vpScroll {
+		lines := strings.Split(strings.ReplaceAll(m.vpContent, "\t", "    "), "\n")
+		row = 0
+		for _, l := range lines[:d.rows[i]] { row += strings.Count(wrapColumns(l, max(m.vp.Width, 1)), "\n") + 1 }
+	}
+	m.vp.SetYOffset(row)
+	m.status = T("hunk %d of %d", i+1, len(d.hunks))
+}
+
+// updateFileDiff handles the keys of a diff shown from the Files tab
+func (m *model) updateFileDiff(key string) (tea.Cmd, bool) {
+	d := m.fileDiff
+	switch key {
+	case "]", "[":
+		i := d.cur + 1
+		if key == "[" { i = d.cur - 1 }
+		if i < 0 || i >= len(d.hunks) { m.status = T("no more hunks"); return nil, true }
+		m.gotoHunk(i)
+	case "|":
+		d.side = !d.side
+		m.setContent(d.render(m.vp.Width, m.plain))
+		m.fileDiff = d
+		m.gotoHunk(d.cur)
+	case "a", "A":
+		// the result goes to the Editor unsaved, to be checked and saved with ctrl+s
+		path := d.a
+		if key == "A" { path = d.b }
+		out := d.applyHunk(d.hunks[d.cur], key == "a")
+		cmd := m.openInEditor(path, 1, 1)
+		if m.editorFile != path { return nil, true }
+		m.ta.SetValue(out)
+		editorGoto(&m.ta, hunkLine(d.lines, d.hunks[d.cur], key == "a"), 1)
+		if m.editorRO { m.status = T("hunk %d applied to %s, which is read-only", d.cur+1, filepath.Base(path)) } else { m.status = T("hunk %d applied to %s: ctrl+s saves it", d.cur+1, filepath.Base(path)) }
+		return cmd, true
+	case "esc":
+		m.setContent("")
+		m.status = T("diff closed")
+	default:
+		return nil, false
+	}
+	return nil, true
+}
+
+// hunkLine is the 1-based line hunk h starts at in the first file, or in the second
+func hunkLine(lines []diffLine, h diffHunk, first bool) int {
+	n := 1
+	for _, l := range lines[:h.start] {
+		if first && l.op != '+' || !first && l.op != '-' { n++ }
+	}
+	return n
+}
+
+// filesTitle is the Files list title: the directory, the frontmatter filter and the
+// files marked for diffing
+func (m *model) filesTitle() string {
+	t := T("Files: %s", m.cwd)
+	if m.files.meta != "" { t = T("Files: %s [%s]", m.cwd, m.files.meta) }
+	if m.files.tag != "" { t += " #" + m.files.tag }
+	if len(m.files.marked) > 0 {
+		names := make([]string, len(m.files.marked))
+		for i, p := range m.files.marked { names[i] = filepath.Base(p) }
+		t += "  " + T("marked: %s", strings.Join(names, ", "))
+	}
+	return t
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/bubbles/list"
+)
+
+// fileColumns are the detail view columns, in display order; each can be sorted by
+var fileColumns = []string{"name", "size", "modified", "permissions", "owner"}
+
+// fileListing is how the Files tab shows the directory: compact (name and kind) or
+// detail (one aligned row per file), sorted by one of fileColumns
+type fileListing struct {
+	detail bool
+	sortBy int // index into fileColumns
+	desc   bool
+	meta   string // frontmatter filter (F): only markdown files matching it are listed
+	marked []string // files marked with m, in marking order, for D, H, P, X, R and d
+	tag    string   // tag filter (#): only files with this tag are listed
+}
+
+// detailDelegate renders a file as one row of aligned columns
+type detailDelegate struct {
+	nameW int
+	plain bool
+}
+
+func (d detailDelegate) Height() int                             { return 1 }
+func (d detailDelegate) Spacing() int                            { return 0 }
+func (d detailDelegate) Update(msg tea.Msg, m *list.Model) tea.Cmd { return nil }
+func (d detailDelegate) Render(w io.Writer, m list.Model, index int, item list.Item) {
+	f, ok := item.(fileItem)
+	if !ok { return }
+	marker := "  "
+	if index == m.Index() { marker = "> " }
+	row := marker + fileRow(f, d.nameW)
+	if index == m.Index() && !d.plain { row = activeTabStyle.Render(row) }
+	fmt.Fprint(w, row)
+}
+
+const fileTimeLayout = "2006-01-02 15:04"
+
+func fileRow(f fileItem, nameW int) string {
+	name := f.name
+	if f.isDir { name += "/" }
+	if r := []rune(name); len(r) > nameW { name = string(r[:nameW-1]) + "…" }
+	row := fmt.Sprintf("%-*s  %8s  %-16s  %-13s  %s", nameW, name, humanSize(f.size), f.mtime.Format(fileTimeLayout), f.mode.String(), f.owner)
+	if len(f.tags) > 0 { row += "  #" + strings.Join(f.tags, " #") }
+	return row
+}
+
+// fileHeader is the column header shown above the detail view, marking the sort column
+func fileHeader(nameW int, l fileListing) string {
+	cols := make([]string, len(fileColumns))
+	for i, c := range fileColumns {
+		cols[i] = T(c)
+		if i == l.sortBy {
+			if l.desc { cols[i] += " v" } else { cols[i] += " ^" }
+		}
+	}
+	return fmt.Sprintf("  %-*s  %8s  %-16s  %-13s  %s", nameW, cols[0], cols[1], cols[2], cols[3], cols[4])
+}
+
+// nameWidth sizes the name column to the longest name, within reason
+func nameWidth(items []list.Item) int {
+	w := 8
+	for _, it := range items {
+		if f, ok := it.(fileItem); ok && len([]rune(f.name))+1 > w { w = len([]rune(f.name)) + 1 }
+	}
+	if w > 40 { w = 40 }
+	return w
+}
+
+// humanSize formats a byte count like ls -h: 512, 4.0K, 12M
+func humanSize(n int64) string {
+	if n < 1024 { return strconv.FormatInt(n, 10) }
+	f := float64(n)
+	for _, unit := range []string{"K", "M", "G", "T"} {
+		f /= 1024
+		if f < 1024 || unit == "T" {
+			if f < 10 { return fmt.Sprintf("%.1f%s", f, unit) }
+			return fmt.Sprintf("%.0f%s", f, unit)
+		}
+	}
+	return ""
+}
+
+// owners caches uid -> user name lookups; a directory listing asks for the same few
+var owners = map[uint32]string{}
+
+func fileOwner(fi os.FileInfo) string {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok { return "" }
+	if name, ok := owners[st.Uid]; ok { return name }
+	uid := strconv.FormatUint(uint64(st.Uid), 10)
+	name := uid
+	if u, err := user.LookupId(uid); err == nil { name = u.Username }
+	owners[st.Uid] = name
+	return name
+}
+
+// sortFileItems orders items by the listing's column; ties fall back to the name
+func sortFileItems(items []list.Item, l fileListing) {
+	less := func(a, b fileItem) bool {
+		switch fileColumns[l.sortBy] {
+		case "size":
+			if a.size != b.size { return a.size < b.size }
+		case "modified":
+			if !a.mtime.Equal(b.mtime) { return a.mtime.Before(b.mtime) }
+		case "permissions":
+			if a.mode != b.mode { return a.mode.String() < b.mode.String() }
+		case "owner":
+			if a.owner != b.owner { return a.owner < b.owner }
+		}
+		return strings.ToLower(a.name) < strings.ToLower(b.name)
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		a, _ := items[i].(fileItem)
+		b, _ := items[j].(fileItem)
+		if l.desc { return less(b, a) }
+		return less(a, b)
+	})
+}
+
+// refreshFiles re-reads the current directory into the Files list in the chosen
+// listing mode and order, keeping the selection on the same file when it is still there
+func (m *model) refreshFiles() {
+	var selected string
+	if sel, ok := m.list.SelectedItem().(fileItem); ok { selected = sel.path }
+	items := listItemsFromDir(m.cwd)
+	tags := loadTags()
+	for i, it := range items {
+		f := it.(fileItem)
+		if ts := tags[f.path]; len(ts) > 0 { f.tags = ts; items[i] = f }
+	}
+	if m.files.meta != "" { items = filterByFrontmatter(items, m.files.meta) }
+	if m.files.tag != "" { items = filterByTag(items, m.files.tag) }
+	sortFileItems(items, m.files)
+	m.list.SetItems(items)
+	m.list.Title = m.filesTitle()
+	switch {
+	case m.files.detail:
+		m.list.SetDelegate(detailDelegate{nameW: nameWidth(items), plain: m.plain})
+	case m.plain:
+		m.list.SetDelegate(plainDelegate{})
+	default:
+		m.list.SetDelegate(list.NewDefaultDelegate())
+	}
+	for i, it := range items {
+		if it.(fileItem).path == selected { m.list.Select(i); break }
+	}
+}
+
+// updateFileListing handles the listing keys of the Files tab: L switches between
+// the compact and detail views, < and > pick the sort column and - reverses the order
+func (m *model) updateFileListing(key string) bool {
+	switch key {
+	case "L":
+		m.files.detail = !m.files.detail
+		if m.files.detail { m.status = T("detail view") } else { m.status = T("compact view") }
+	case ">", "<":
+		n := len(fileColumns)
+		if key == ">" { m.files.sortBy = (m.files.sortBy + 1) % n } else { m.files.sortBy = (m.files.sortBy + n - 1) % n }
+		m.status = T("sorted by %s", T(fileColumns[m.files.sortBy]))
+	case "-":
+		m.files.desc = !m.files.desc
+		if m.files.desc { m.status = T("sorted by %s, descending", T(fileColumns[m.files.sortBy])) } else { m.status = T("sorted by %s", T(fileColumns[m.files.sortBy])) }
+	default:
+		return false
+	}
+	m.refreshFiles()
+	return true
+}
+
+// filesView is the Files tab: the list, under a column header in the detail view
+func (m model) filesView() string {
+	prompt := ""
+	if m.fmInput.Focused() { prompt = "\n" + m.fmInput.View() }
+	if m.sumInput.Focused() { prompt = "\n" + m.sumInput.View() }
+	if m.tagInput.Focused() { prompt = "\n" + m.tagInput.View() }
+	if !m.files.detail { return m.list.View() + prompt }
+	hdr := fileHeader(nameWidth(m.list.Items()), m.files)
+	if !m.plain { hdr = helpStyle.Render(hdr) }
+	return hdr + "\n" + m.list.View() + prompt
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"io"
+	"os"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// fmField is one top-level frontmatter key with its value, or values for a list
+type fmField struct {
+	key    string
+	values []string
+}
+
+// frontmatterHead is how much of a file the Files filter reads to find its frontmatter
+const frontmatterHead = 16 << 10
+
+var fmKeyStyle = lipgloss.NewStyle().Bold(true)
+
+// splitFrontmatter separates a leading YAML frontmatter block (between --- lines)
+// from the markdown body. Only what metadata tables and filters need is understood:
+// scalars, [a, b] lists and "- item" lists; nested values are folded into one line.
+func splitFrontmatter(src string) ([]fmField, string) {
+	if !strings.HasPrefix(src, "---\n") && !strings.HasPrefix(src, "---\r\n") { return nil, src }
+	lines := strings.SplitAfter(src, "\n")
+	end := -1
+	for i := 1; i < len(lines); i++ {
+		if t := strings.TrimRight(lines[i], "\r\n"); t == "---" || t == "..." { end = i; break }
+	}
+	if end < 0 { return nil, src }
+	var fm []fmField
+	for _, raw := range lines[1:end] {
+		line := strings.TrimRight(raw, "\r\n")
+		t := strings.TrimSpace(line)
+		if t == "" || strings.HasPrefix(t, "#") { continue }
+		if line[0] == ' ' || line[0] == '\t' || strings.HasPrefix(t, "- ") {
+			if len(fm) == 0 { continue }
+			f := &fm[len(fm)-1]
+			if strings.HasPrefix(t, "- ") { f.values = append(f.values, fmScalar(t[2:])); continue }
+			if len(f.values) == 0 { f.values = []string{t} } else { f.values[len(f.values)-1] += " " + t }
+			continue
+		}
+		k, v, ok := strings.Cut(t, ":")
+		if !ok { continue }
+		f := fmField{key: strings.TrimSpace(k)}
+		v = strings.TrimSpace(v)
+		switch {
+		case strings.HasPrefix(v, "[") && strings.HasSuffix(v, "]"):
+			for _, s := range strings.Split(v[1:len(v)-1], ",") {
+				if s = fmScalar(s); s != "" { f.values = append(f.values, s) }
+			}
+		case v != "" && v != "|" && v != ">":
+			f.values = []string{fmScalar(v)}
+		}
+		fm = append(fm, f)
+	}
+	return fm, strings.Join(lines[end+1:], "")
+}
+
+// fmScalar trims a YAML scalar: surrounding quotes and a trailing comment
+func fmScalar(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] { return s[1 : len(s)-1] }
+	if i := strings.Index(s, " #"); i >= 0 { s = strings.TrimSpace(s[:i]) }
+	return s
+}
+
+// renderFrontmatter draws the fields as a key/value table for the top of the preview
+func renderFrontmatter(fm []fmField, width int, plain bool) string {
+	if len(fm) == 0 { return "" }
+	kw := 0
+	for _, f := range fm { if len(f.key) > kw { kw = len(f.key) } }
+	rows := make([]string, len(fm))
+	for i, f := range fm {
+		key := f.key + strings.Repeat(" ", kw-len(f.key))
+		if !plain { key = fmKeyStyle.Render(key) }
+		rows[i] = key + "  " + strings.Join(f.values, ", ")
+	}
+	if plain { return strings.Join(rows, "\n") + "\n" }
+	// the border and padding take four columns
+	return paneStyle.Padding(0, 1).Width(width - 4).Render(strings.Join(rows, "\n")) + "\n"
+}
+
+// fmMatches reports whether fm satisfies every term of filter: "key" needs the key,
+// "key=value" one value equal to value, both ignoring case
+func fmMatches(fm []fmField, filter string) bool {
+	for _, term := range strings.Fields(filter) {
+		k, v, hasValue := strings.Cut(term, "=")
+		found := false
+		for _, f := range fm {
+			if !strings.EqualFold(f.key, k) { continue }
+			if !hasValue { found = true }
+			for _, fv := range f.values { if strings.EqualFold(fv, v) { found = true } }
+		}
+		if !found { return false }
+	}
+	return true
+}
+
+// fileFrontmatter reads the frontmatter at the top of the markdown file at path
+func fileFrontmatter(path string) []fmField {
+	f, err := os.Open(path)
+	if err != nil { return nil }
+	defer f.Close()
+	b, _ := io.ReadAll(io.LimitReader(f, frontmatterHead))
+	fm, _ := splitFrontmatter(string(b))
+	return fm
+}
+
+// filterByFrontmatter keeps the directories and the markdown files whose frontmatter
+// matches filter
+func filterByFrontmatter(items []list.Item, filter string) []list.Item {
+	out := items[:0]
+	for _, it := range items {
+		f := it.(fileItem)
+		if f.isDir || isMarkdownFile(f.path) && fmMatches(fileFrontmatter(f.path), filter) { out = append(out, it) }
+	}
+	return out
+}
+
+func newFrontmatterInput() textinput.Model {
+	ti := textinput.New()
+	ti.Prompt = T("frontmatter filter (tags=go status=draft): ")
+	ti.CharLimit = 200
+	return ti
+}
+
+// updateFrontmatterFilter handles keys while the Files frontmatter prompt has focus;
+// an empty filter shows every file again
+func (m *model) updateFrontmatterFilter(msg tea.KeyMsg) tea.Cmd {
+	switch msg.String() {
+	case "esc":
+		m.fmInput.Blur()
+		return nil
+	case "enter":
+		m.fmInput.Blur()
+		m.files.meta = strings.TrimSpace(m.fmInput.Value())
+		m.refreshFiles()
+		if m.files.meta == "" { m.status = T("frontmatter filter cleared") } else { m.status = T("%d markdown files match %s", len(m.list.Items())-countDirs(m.list.Items()), m.files.meta) }
+		return nil
+	}
+	var cmd tea.Cmd
+	m.fmInput, cmd = m.fmInput.Update(msg)
+	return cmd
+}
+
+func countDirs(items []list.Item) int {
+	n := 0
+	for _, it := range items { if it.(fileItem).isDir { n++ } }
+	return n
+}
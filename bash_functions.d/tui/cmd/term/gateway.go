@@ -0,0 +1,298 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/creack/pty"
+	"github.com/gorilla/websocket"
+)
+
+// The browser gateway serves an xterm.js page and runs one TUI per WebSocket, in a
+// pty with the session environment wish-server would set for the token's user, so
+// the TUI can be reached where SSH is blocked. Tokens are issued with `term gateway
+// token` and only their hashes are kept.
+
+// accessToken is one token issued for the gateway or the web dashboard
+type accessToken struct {
+	Hash    string    `json:"hash"`
+	User    string    `json:"user"`
+	Created time.Time `json:"created"`
+	Expires time.Time `json:"expires"`
+}
+
+func gatewayTokensPath() string { return filepath.Join(tuiDataDir(), "gateway_tokens.json") }
+
+func loadTokens(path string) ([]accessToken, error) {
+	var toks []accessToken
+	return toks, readJSONFile(path, &toks)
+}
+
+// issueToken stores a token for user valid for ttl in the token file at path and
+// returns it
+func issueToken(path, user string, ttl time.Duration) (string, error) {
+	if !allowUserRe.MatchString(user) { return "", fmt.Errorf("bad user name %q", user) }
+	token, err := randomToken()
+	if err != nil { return "", err }
+	now := time.Now().UTC()
+	err = withLock("tokens", func() error {
+		toks, err := loadTokens(path)
+		if err != nil { return err }
+		keep := []accessToken{}
+		for _, t := range toks { if now.Before(t.Expires) { keep = append(keep, t) } }
+		keep = append(keep, accessToken{Hash: inviteHash(token), User: user, Created: now, Expires: now.Add(ttl)})
+		os.MkdirAll(filepath.Dir(path), 0o700)
+		return writeJSONFile(path, keep)
+	})
+	return token, err
+}
+
+// revokeTokens drops every token of user and returns how many there were
+func revokeTokens(path, user string) (int, error) {
+	n := 0
+	err := withLock("tokens", func() error {
+		toks, err := loadTokens(path)
+		if err != nil { return err }
+		keep := []accessToken{}
+		for _, t := range toks { if t.User == user { n++ } else { keep = append(keep, t) } }
+		return writeJSONFile(path, keep)
+	})
+	return n, err
+}
+
+// tokenUser is the user a token belongs to; the file is read per connection so
+// revoking applies at once
+func tokenUser(path, token string) (string, error) {
+	toks, err := loadTokens(path)
+	if err != nil { return "", err }
+	h := inviteHash(strings.TrimSpace(token))
+	for _, t := range toks {
+		if t.Hash == h && time.Now().Before(t.Expires) { return t.User, nil }
+	}
+	return "", errors.New("invalid or expired token")
+}
+
+// gatewayEnv is the environment of a browser session: what wish-server's Env
+// middleware sets for user, from the same allowlist and manifest
+func gatewayEnv(user, allowPath, remote string) ([]string, error) {
+	allow, err := loadAllowlist(allowPath)
+	if err != nil && !os.IsNotExist(err) { return nil, err }
+	mf, err := loadManifest()
+	if err != nil && !os.IsNotExist(err) { return nil, err }
+	admin, readOnly := "0", "0"
+	var quota *quotaSpec
+	for _, e := range allow {
+		if e.User != user { continue }
+		if e.IsAdmin { admin = "1" }
+		if e.ReadOnly { readOnly = "1" }
+		quota = e.Quota
+	}
+	env := []string{"TERM=xterm-256color", "SSH_USER=" + user, "SSH_IS_ADMIN=" + admin, "SSH_READ_ONLY=" + readOnly, "SSH_CLIENT=" + remote, "TUI_GATEWAY=1"}
+	env = append(env, quota.env()...)
+	if g := execGrants(user, allow, mf); len(g) > 0 { env = append(env, "SSH_ALLOWED_EXEC="+strings.Join(g, ",")) }
+	for _, kv := range os.Environ() {
+		// the gateway's own identity must not leak into the session
+		if strings.HasPrefix(kv, "SSH_") || strings.HasPrefix(kv, "TERM=") || strings.HasPrefix(kv, "CBW_BROKER_TICKET_FD=") { continue }
+		env = append(env, kv)
+	}
+	return env, nil
+}
+
+// gatewayHello is the first message of a connection; the token travels in it
+// rather than in the URL so it stays out of access logs
+type gatewayHello struct {
+	Token string `json:"token"`
+	Cols  uint16 `json:"cols"`
+	Rows  uint16 `json:"rows"`
+}
+
+type gatewayServer struct {
+	allowPath string
+	xterm     string // npm-style base URL the xterm.js files are served from
+	upgrader  websocket.Upgrader
+}
+
+var gatewayPage = template.Must(template.New("gateway").Parse(`<!doctype html>
+<html><head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1">
+<title>term</title>
+<link rel="stylesheet" href="{{.}}/@xterm/xterm@5.5.0/css/xterm.css">
+<script src="{{.}}/@xterm/xterm@5.5.0/lib/xterm.js"></script>
+<script src="{{.}}/@xterm/addon-fit@0.10.0/lib/addon-fit.js"></script>
+<style>html,body,#t{margin:0;height:100%;background:#000}</style>
+</head><body><div id="t"></div><script>
+const token = new URLSearchParams(location.hash.slice(1)).get("token") || prompt("Gateway token");
+history.replaceState(null, "", location.pathname);
+const term = new Terminal({cursorBlink: true}), fit = new FitAddon.FitAddon();
+term.loadAddon(fit); term.open(document.getElementById("t")); fit.fit();
+const ws = new WebSocket((location.protocol === "https:" ? "wss://" : "ws://") + location.host + "/ws");
+ws.binaryType = "arraybuffer";
+const enc = new TextEncoder();
+ws.onopen = () => ws.send(JSON.stringify({token: token, cols: term.cols, rows: term.rows}));
+ws.onmessage = e => term.write(new Uint8Array(e.data));
+ws.onclose = e => term.write("\r\n[" + (e.reason || "disconnected") + "]\r\n");
+term.onData(d => ws.readyState === 1 && ws.send(enc.encode(d)));
+term.onResize(s => ws.readyState === 1 && ws.send(JSON.stringify({cols: s.cols, rows: s.rows})));
+addEventListener("resize", () => fit.fit());
+term.focus();
+</script></body></html>
+`))
+
+func (s *gatewayServer) page(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" { http.NotFound(w, r); return }
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	gatewayPage.Execute(w, s.xterm)
+}
+
+// session bridges one WebSocket to a TUI: binary frames are keystrokes, text
+// frames are JSON resizes, and the pty's output goes back as binary frames
+func (s *gatewayServer) session(w http.ResponseWriter, r *http.Request) {
+	ws, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil { slog.Warn("gateway: upgrade failed", "remote", r.RemoteAddr, "err", err); return }
+	defer ws.Close()
+	ws.SetReadLimit(64 << 10)
+	closeWith := func(code int, reason string) {
+		ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+	}
+	ws.SetReadDeadline(time.Now().Add(ctlTimeout))
+	var hello gatewayHello
+	_, b, err := ws.ReadMessage()
+	if err == nil { err = json.Unmarshal(b, &hello) }
+	var user string
+	if err == nil { user, err = tokenUser(gatewayTokensPath(), hello.Token) }
+	if err != nil { slog.Warn("gateway: refused", "remote", r.RemoteAddr, "err", err); closeWith(websocket.ClosePolicyViolation, "authentication failed"); return }
+	ws.SetReadDeadline(time.Time{})
+	env, err := gatewayEnv(user, s.allowPath, r.RemoteAddr)
+	if err != nil { slog.Error("gateway: policy unreadable", "err", err); closeWith(websocket.CloseInternalServerErr, "server error"); return }
+	self, err := os.Executable()
+	if err != nil { closeWith(websocket.CloseInternalServerErr, "server error"); return }
+	cmd := exec.Command(self)
+	// the session names its user to the exec broker with a ticket, not SSH_USER; it
+	// reads the ticket from an inherited pipe, as its environment is readable in /proc
+	if sock := brokerSocket(); sock != "" {
+		if t, err := issueBrokerTicket(sock, user); err != nil {
+			slog.Warn("gateway: no broker ticket, exec runs act for the gateway's account", "user", user, "err", err)
+		} else if r, err := ticketPipe(t); err != nil {
+			revokeBrokerTicket(sock, t)
+			slog.Error("gateway: ticket pipe failed", "err", err)
+			closeWith(websocket.CloseInternalServerErr, "server error")
+			return
+		} else {
+			defer revokeBrokerTicket(sock, t)
+			defer r.Close()
+			cmd.ExtraFiles = []*os.File{r}
+			env = append(env, "CBW_BROKER_TICKET_FD=3")
+		}
+	}
+	cmd.Env = env
+	if home, err := os.UserHomeDir(); err == nil { cmd.Dir = home }
+	ptmx, err := pty.StartWithSize(cmd, &pty.Winsize{Cols: hello.Cols, Rows: hello.Rows})
+	if err != nil { slog.Error("gateway: pty start failed", "err", err); closeWith(websocket.CloseInternalServerErr, "server error"); return }
+	defer ptmx.Close()
+	slog.Info("gateway session", "user", user, "remote", r.RemoteAddr)
+	start := time.Now()
+
+	// the TUI's output; this goroutine is the only writer of data frames
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		buf := make([]byte, 32<<10)
+		for {
+			n, err := ptmx.Read(buf)
+			if n > 0 && ws.WriteMessage(websocket.BinaryMessage, buf[:n]) != nil { return }
+			if err != nil { return }
+		}
+	}()
+	go func() {
+		for {
+			t, b, err := ws.ReadMessage()
+			if err != nil { break }
+			if t == websocket.BinaryMessage { if _, err := ptmx.Write(b); err != nil { break }; continue }
+			var size gatewayHello
+			if json.Unmarshal(b, &size) == nil && size.Cols > 0 && size.Rows > 0 { pty.Setsize(ptmx, &pty.Winsize{Cols: size.Cols, Rows: size.Rows}) }
+		}
+		// the browser went away: hang up on the TUI as a dropped SSH session would
+		if cmd.Process != nil { cmd.Process.Signal(syscall.SIGHUP) }
+	}()
+	cmd.Wait()
+	<-done
+	closeWith(websocket.CloseNormalClosure, "session ended")
+	slog.Info("gateway session ended", "user", user, "remote", r.RemoteAddr, "duration", time.Since(start).Round(time.Second).String())
+}
+
+const gatewayUsage = `usage: term gateway <command> [flags]
+
+  serve [-addr host:port] [-tls-cert file -tls-key file] [-xterm url]   serve the TUI to browsers
+  token [-ttl 720h] <user>                                              issue a token for user
+  revoke <user>                                                         drop every token of user
+`
+
+// runGateway implements `term gateway`
+func runGateway(args []string) int {
+	if len(args) < 1 { fmt.Fprint(os.Stderr, gatewayUsage); return 2 }
+	switch args[0] {
+	case "serve":
+		return serveGateway(args[1:])
+	case "token", "revoke":
+		return runTokenCmd("gateway", gatewayTokensPath(), gatewayUsage, args)
+	}
+	fmt.Fprint(os.Stderr, gatewayUsage)
+	return 2
+}
+
+// runTokenCmd implements the token and revoke subcommands of `term <name>`
+func runTokenCmd(name, path, usage string, args []string) int {
+	// tokens are the owner's or an admin's to hand out
+	if os.Getenv("SSH_USER") != "" && !isAdmin() { fmt.Fprintln(os.Stderr, T("Admin privileges required")); return 1 }
+	fs := flag.NewFlagSet(name+" "+args[0], flag.ExitOnError)
+	ttl := fs.Duration("ttl", 30*24*time.Hour, "how long the token is valid")
+	fs.Parse(args[1:])
+	if fs.NArg() != 1 { fmt.Fprint(os.Stderr, usage); return 2 }
+	user := fs.Arg(0)
+	if args[0] == "revoke" {
+		n, err := revokeTokens(path, user)
+		if err != nil { fmt.Fprintln(os.Stderr, err); return 1 }
+		fmt.Printf("revoked %d token(s) of %s\n", n, user)
+		return 0
+	}
+	token, err := issueToken(path, user, *ttl)
+	if err != nil { fmt.Fprintln(os.Stderr, err); return 1 }
+	fmt.Println(token)
+	return 0
+}
+
+func serveGateway(args []string) int {
+	fs := flag.NewFlagSet("gateway serve", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:8023", "address to listen on; put a TLS reverse proxy in front, or use -tls-cert")
+	cert := fs.String("tls-cert", "", "serve HTTPS with this certificate")
+	key := fs.String("tls-key", "", "private key of -tls-cert")
+	xterm := fs.String("xterm", "https://cdn.jsdelivr.net/npm", "base URL holding @xterm/xterm@5.5.0 and @xterm/addon-fit@0.10.0, for self-hosting them")
+	allowPath := fs.String("allowlist", allowlistPath(), "wish-server allowlist with allowed_exec, is_admin and roles")
+	fs.Parse(args)
+	cfg := loadConfig()
+	defer setupLogging(cfg.Log, "gateway", false)()
+
+	s := &gatewayServer{allowPath: *allowPath, xterm: strings.TrimSuffix(*xterm, "/")}
+	// the default origin check only lets the gateway's own page connect
+	s.upgrader = websocket.Upgrader{ReadBufferSize: 32 << 10, WriteBufferSize: 32 << 10}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.page)
+	mux.HandleFunc("/ws", s.session)
+	srv := &http.Server{Addr: *addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	slog.Info("browser gateway listening", "addr", *addr, "tls", *cert != "")
+	var err error
+	if *cert != "" { err = srv.ListenAndServeTLS(*cert, *key) } else { err = srv.ListenAndServe() }
+	if err != nil && err != http.ErrServerClosed { slog.Error("gateway: serve failed", "err", err); fmt.Fprintln(os.Stderr, err); return 1 }
+	return 0
+}
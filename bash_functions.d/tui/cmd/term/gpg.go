@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// gpgCommand runs gpg with its messages in English, so the status lines and the
+// output shown are the same for everyone
+func gpgCommand(args ...string) *exec.Cmd {
+	c := exec.Command("gpg", args...)
+	c.Env = append(os.Environ(), "LC_ALL=C")
+	return c
+}
+
+// isSignature reports whether path is a detached signature P verifies
+func isSignature(path string) bool {
+	ext := filepath.Ext(path)
+	return ext == ".sig" || ext == ".asc"
+}
+
+// gpgSignDoneMsg arrives when gpg has signed files[0]; the rest are signed next
+type gpgSignDoneMsg struct {
+	files []string
+	err   error
+}
+
+// signFiles makes an armored detached signature file.asc of each file, one gpg run
+// at a time in the foreground so pinentry can ask for the passphrase
+func (m *model) signFiles(files []string) tea.Cmd {
+	args := []string{"--armor", "--detach-sign", "--yes", "--output", files[0] + ".asc"}
+	if m.cfg.GPGKey != "" { args = append(args, "--local-user", m.cfg.GPGKey) }
+	c := gpgCommand(append(args, "--", files[0])...)
+	return tea.ExecProcess(c, func(err error) tea.Msg { return gpgSignDoneMsg{files, err} })
+}
+
+// gpgSigned records a signature and moves on to the next file; the last one is
+// verified so the viewport shows who signed it
+func (m *model) gpgSigned(msg gpgSignDoneMsg) tea.Cmd {
+	f := msg.files[0]
+	appendAudit(m.auditPath, fmt.Sprintf("%s\tgpg=sign\tpath=%s\tuser=%s\terror=%v", time.Now().Format(time.RFC3339), f, transferUser(), msg.err))
+	if msg.err != nil { m.status = T("signing %s failed: %v", filepath.Base(f), msg.err); slog.Warn("gpg sign failed", "path", f, "err", msg.err); return nil }
+	if len(msg.files) > 1 { return m.signFiles(msg.files[1:]) }
+	m.refreshFiles()
+	return gpgVerify(f+".asc", f)
+}
+
+// signSelected signs the marked files, or the selected one, or verifies the selected
+// signature; existing signatures are only replaced after asking
+func (m *model) signSelected() tea.Cmd {
+	if _, err := exec.LookPath("gpg"); err != nil { m.status = T("gpg not found in PATH"); return nil }
+	sel, ok := m.list.SelectedItem().(fileItem)
+	if len(m.files.marked) == 0 && ok && !sel.isDir && isSignature(sel.path) {
+		data := strings.TrimSuffix(sel.path, filepath.Ext(sel.path))
+		if _, err := os.Stat(data); err != nil { m.status = T("no %s next to the signature", filepath.Base(data)); return nil }
+		m.status = T("verifying %s", sel.name)
+		return gpgVerify(sel.path, data)
+	}
+	if m.denyReadOnly() { return nil }
+	files := m.checksumTargets()
+	if len(files) == 0 { m.status = T("select a file or mark some with m"); return nil }
+	var existing []string
+	for _, f := range files {
+		if _, err := os.Stat(f + ".asc"); err == nil { existing = append(existing, filepath.Base(f)+".asc") }
+	}
+	if len(existing) > 0 {
+		m.ask(T("replace the signature %s?", strings.Join(existing, ", ")), func(m *model) tea.Cmd { return m.signFiles(files) })
+		return nil
+	}
+	return m.signFiles(files)
+}
+
+// gpgVerdict is what gpg's status lines say about a signature
+type gpgVerdict struct {
+	result      string // GOODSIG, BADSIG, EXPSIG, EXPKEYSIG, REVKEYSIG or ERRSIG
+	keyID       string
+	signer      string
+	fingerprint string
+	created     time.Time
+	trust       string // UNDEFINED, NEVER, MARGINAL, FULLY or ULTIMATE
+	noKey       bool   // the signer's public key is not in the keyring
+}
+
+// parseGPGStatus reads the [GNUPG:] lines of gpg --status-fd
+func parseGPGStatus(out []byte) gpgVerdict {
+	var v gpgVerdict
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		f := strings.Fields(strings.TrimPrefix(sc.Text(), "[GNUPG:] "))
+		if len(f) == 0 { continue }
+		switch kw := f[0]; {
+		case kw == "GOODSIG" || kw == "BADSIG" || kw == "EXPSIG" || kw == "EXPKEYSIG" || kw == "REVKEYSIG" || kw == "ERRSIG":
+			v.result = kw
+			if len(f) > 1 { v.keyID = f[1] }
+			if len(f) > 2 && kw != "ERRSIG" { v.signer = strings.Join(f[2:], " ") }
+			if kw == "ERRSIG" && len(f) > 5 { v.created = gpgTime(f[5]) }
+		case kw == "VALIDSIG":
+			if len(f) > 1 { v.fingerprint = f[1] }
+			if len(f) > 3 { v.created = gpgTime(f[3]) }
+		case kw == "NO_PUBKEY":
+			v.noKey = true
+		case strings.HasPrefix(kw, "TRUST_"):
+			v.trust = strings.TrimPrefix(kw, "TRUST_")
+		}
+	}
+	return v
+}
+
+// gpgTime reads a status line time: seconds since the epoch or an ISO 8601 stamp
+func gpgTime(s string) time.Time {
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil { return time.Unix(n, 0) }
+	t, _ := time.Parse("20060102T150405", s)
+	return t
+}
+
+// gpgVerifyMsg carries the result of verifying sig against data
+type gpgVerifyMsg struct {
+	sig, data string
+	v         gpgVerdict
+	log       string // gpg's own messages
+	err       error
+}
+
+// gpgVerify checks the detached signature sig of data in the background
+func gpgVerify(sig, data string) tea.Cmd {
+	return func() tea.Msg {
+		c := gpgCommand("--batch", "--no-tty", "--status-fd", "1", "--verify", "--", sig, data)
+		var stderr bytes.Buffer
+		c.Stderr = &stderr
+		out, err := c.Output()
+		v := parseGPGStatus(out)
+		// a bad signature also exits non-zero: only no verdict at all is a failure
+		if v.result != "" { err = nil } else if err == nil { err = errors.New(T("gpg gave no verdict")) }
+		return gpgVerifyMsg{sig: sig, data: data, v: v, log: stderr.String(), err: err}
+	}
+}
+
+// trustText describes gpg's trust in the signing key
+func trustText(trust string) string {
+	switch trust {
+	case "ULTIMATE":
+		return T("ultimate (your own key)")
+	case "FULLY":
+		return T("full")
+	case "MARGINAL":
+		return T("marginal")
+	case "NEVER":
+		return T("never: the key is marked untrusted")
+	}
+	return T("unknown: the key is not certified by a key you trust")
+}
+
+// showVerification lays the verdict out in a Preview pane and sums it up in the
+// status line: green when good and trusted, yellow when good but not, red otherwise
+func (m *model) showVerification(msg gpgVerifyMsg) {
+	if msg.err != nil { m.status = T("cannot verify %s: %v", filepath.Base(msg.sig), msg.err); slog.Warn("gpg verify failed", "sig", msg.sig, "err", msg.err); return }
+	v := msg.v
+	var result string
+	style := diffDelStyle
+	switch v.result {
+	case "GOODSIG":
+		result = T("good signature")
+		style = diffAddStyle
+		if v.trust != "FULLY" && v.trust != "ULTIMATE" { style = ansChangedStyle }
+	case "BADSIG":
+		result = T("BAD signature: the file or the signature was altered")
+	case "EXPSIG":
+		result = T("good signature, but it has expired")
+	case "EXPKEYSIG":
+		result = T("good signature, but the key has expired")
+	case "REVKEYSIG":
+		result = T("good signature, but the key was revoked")
+	case "ERRSIG":
+		result = T("cannot check the signature")
+		if v.noKey { result = T("cannot check the signature: public key %s is not in your keyring (gpg --recv-keys %s)", v.keyID, v.keyID) }
+	}
+	var b strings.Builder
+	row := func(k, val string) { if val != "" { fmt.Fprintf(&b, "%-12s %s\n", k, val) } }
+	row(T("Signature:"), msg.sig)
+	row(T("File:"), msg.data)
+	if m.plain { row(T("Result:"), result) } else { row(T("Result:"), style.Render(result)) }
+	row(T("Signer:"), v.signer)
+	row(T("Key:"), v.keyID)
+	row(T("Fingerprint:"), v.fingerprint)
+	if !v.created.IsZero() { row(T("Signed:"), v.created.Format("2006-01-02 15:04:05 MST")) }
+	if v.result == "GOODSIG" { row(T("Trust:"), trustText(v.trust)) }
+	b.WriteString("\n" + T("gpg output:") + "\n" + msg.log)
+	m.panes.show(true, m.tabs[m.active], "Preview")
+	m.setContent(b.String())
+	m.vp.GotoTop()
+	status := "✗ " + result
+	if v.result == "GOODSIG" {
+		trust := strings.ToLower(v.trust)
+		if trust == "" || trust == "undefined" { trust = T("unknown") }
+		status = T("✓ good signature from %s (trust: %s)", v.signer, trust)
+	}
+	if m.plain { m.status = status } else { m.status = style.Render(status) }
+}
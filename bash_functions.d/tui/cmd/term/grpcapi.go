@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/cbwinslow/go-term/proto/agentsv1"
+)
+
+// `term grpc serve` serves proto/agents.proto to other tools: the same manifest,
+// jobs and request store as the TUI, behind mutual TLS. The client certificate's
+// common name is the caller's user; exec grants and admin rights come from the
+// allowlist and manifest as for an SSH session.
+
+type grpcServer struct {
+	pb.UnimplementedAgentsServer
+	allowPath    string
+	auditPath    string
+	requestsPath string
+}
+
+// grpcCaller is the user of the verified client certificate
+func grpcCaller(ctx context.Context) (string, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok { return "", status.Error(codes.Unauthenticated, "no peer") }
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 { return "", status.Error(codes.Unauthenticated, "no verified client certificate") }
+	user := info.State.VerifiedChains[0][0].Subject.CommonName
+	if !allowUserRe.MatchString(user) { return "", status.Errorf(codes.Unauthenticated, "bad user %q in the client certificate", user) }
+	return user, nil
+}
+
+// policy is what user may do: the agents they may exec and whether they are an admin
+func (s *grpcServer) policy(user string) (agentManifest, []string, bool, error) {
+	allow, err := loadAllowlist(s.allowPath)
+	if err != nil && !os.IsNotExist(err) { return agentManifest{}, nil, false, err }
+	mf, err := loadManifest()
+	if err != nil && !os.IsNotExist(err) { return agentManifest{}, nil, false, err }
+	admin := false
+	for _, e := range allow { if e.User == user { admin = e.IsAdmin } }
+	return mf, execGrants(user, allow, mf), admin, nil
+}
+
+func granted(grants []string, agent string) bool {
+	for _, g := range grants { if g == agent { return true } }
+	return false
+}
+
+func (s *grpcServer) ListAgents(ctx context.Context, _ *pb.ListAgentsRequest) (*pb.ListAgentsResponse, error) {
+	user, err := grpcCaller(ctx)
+	if err != nil { return nil, err }
+	mf, grants, _, err := s.policy(user)
+	if err != nil { return nil, status.Error(codes.Internal, err.Error()) }
+	resp := &pb.ListAgentsResponse{}
+	for _, a := range mf.Agents {
+		resp.Agents = append(resp.Agents, &pb.Agent{Name: a.Name, Description: a.Desc, Tags: a.Tags, ExecAllowed: granted(grants, a.Name)})
+	}
+	return resp, nil
+}
+
+func (s *grpcServer) RunAgent(ctx context.Context, req *pb.RunAgentRequest) (*pb.RunAgentResponse, error) {
+	user, err := grpcCaller(ctx)
+	if err != nil { return nil, err }
+	mf, grants, _, err := s.policy(user)
+	if err != nil { return nil, status.Error(codes.Internal, err.Error()) }
+	if _, ok := mf.agent(req.Agent); !ok { return nil, status.Errorf(codes.NotFound, "no agent %q", req.Agent) }
+	if req.Exec && !granted(grants, req.Agent) {
+		slog.Warn("grpc: exec refused", "user", user, "agent", req.Agent)
+		return nil, status.Errorf(codes.PermissionDenied, "%s may not exec %s", user, req.Agent)
+	}
+	j, err := enqueueJob(req.Agent, req.Exec, user)
+	if err != nil { return nil, status.Error(codes.Internal, err.Error()) }
+	slog.Info("grpc: job queued", "user", user, "agent", req.Agent, "exec", req.Exec, "job", j.ID)
+	return &pb.RunAgentResponse{JobId: j.ID, State: j.State}, nil
+}
+
+// grpcPoll is how often a followed job's log and state are checked
+const grpcPoll = 500 * time.Millisecond
+
+// StreamOutput sends the job's log line by line; with follow it keeps reading until
+// the job leaves the running state, reconciling jobs (and so auditing them) as the
+// TUI's Jobs tab does
+func (s *grpcServer) StreamOutput(req *pb.StreamOutputRequest, stream pb.Agents_StreamOutputServer) error {
+	ctx := stream.Context()
+	user, err := grpcCaller(ctx)
+	if err != nil { return err }
+	_, _, admin, err := s.policy(user)
+	if err != nil { return status.Error(codes.Internal, err.Error()) }
+	var sent int64
+	var partial string
+	for {
+		all, _, err := syncJobs(s.auditPath)
+		if err != nil { return status.Error(codes.Internal, err.Error()) }
+		var j *job
+		for i := range all { if all[i].ID == req.JobId { j = &all[i] } }
+		// other users' jobs are reported as missing, so their ids are not confirmed
+		if j == nil || !admin && j.User != user { return status.Errorf(codes.NotFound, "no job %q", req.JobId) }
+		b, _ := readFrom(j.Log, sent)
+		sent += int64(len(b))
+		lines := strings.Split(partial+string(b), "\n")
+		partial = lines[len(lines)-1]
+		for _, l := range lines[:len(lines)-1] {
+			if err := stream.Send(&pb.OutputLine{Text: l}); err != nil { return err }
+		}
+		if j.State != JobQueued && j.State != JobRunning || !req.Follow {
+			if partial != "" { if err := stream.Send(&pb.OutputLine{Text: partial}); err != nil { return err } }
+			return stream.Send(&pb.OutputLine{Done: true, State: j.State, Exit: int32(j.Exit)})
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(grpcPoll):
+		}
+	}
+}
+
+// readFrom is the part of the file at path after offset
+func readFrom(path string, offset int64) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil { return nil, err }
+	defer f.Close()
+	if _, err := f.Seek(offset, 0); err != nil { return nil, err }
+	return ioutil.ReadAll(f)
+}
+
+func (s *grpcServer) GetRequest(ctx context.Context, req *pb.GetRequestRequest) (*pb.Request, error) {
+	user, err := grpcCaller(ctx)
+	if err != nil { return nil, err }
+	_, _, admin, err := s.policy(user)
+	if err != nil { return nil, status.Error(codes.Internal, err.Error()) }
+	rec, err := loadRequestRecord(s.requestsPath, req.Id)
+	if err == errRequestNotFound || err == nil && !admin && rec.Request.User != user { return nil, status.Errorf(codes.NotFound, "no request %q", req.Id) }
+	if err != nil { return nil, status.Error(codes.Internal, err.Error()) }
+	r := rec.Request
+	out := &pb.Request{Id: r.ID, Agent: r.Agent, User: r.User, Time: r.Time, Notes: r.Notes, Pending: rec.Pending}
+	for _, ev := range rec.History {
+		pe := &pb.RequestEvent{State: ev.State, By: ev.By, Time: ev.Time, Note: ev.Note}
+		if ev.Exit != nil { e := int32(*ev.Exit); pe.Exit = &e }
+		out.History = append(out.History, pe)
+	}
+	return out, nil
+}
+
+// grpcTLS requires a client certificate signed by the CA in caFile
+func grpcTLS(certFile, keyFile, caFile string) (*tls.Config, error) {
+	if certFile == "" || keyFile == "" || caFile == "" { return nil, errors.New("-tls-cert, -tls-key and -client-ca are required") }
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil { return nil, err }
+	ca, err := ioutil.ReadFile(caFile)
+	if err != nil { return nil, err }
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) { return nil, fmt.Errorf("%s: no certificates", caFile) }
+	return &tls.Config{Certificates: []tls.Certificate{cert}, ClientCAs: pool, ClientAuth: tls.RequireAndVerifyClientCert, MinVersion: tls.VersionTLS12}, nil
+}
+
+const grpcUsage = `usage: term grpc serve [flags]
+
+  serve -tls-cert file -tls-key file -client-ca file [-addr host:port]   serve the agents API (proto/agents.proto)
+`
+
+// runGRPC implements `term grpc`
+func runGRPC(args []string) int {
+	if len(args) < 1 || args[0] != "serve" { fmt.Fprint(os.Stderr, grpcUsage); return 2 }
+	fs := flag.NewFlagSet("grpc serve", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:8025", "address to listen on")
+	cert := fs.String("tls-cert", "", "server certificate")
+	key := fs.String("tls-key", "", "private key of -tls-cert")
+	ca := fs.String("client-ca", "", "CA that signs client certificates; their common name is the user")
+	allowPath := fs.String("allowlist", allowlistPath(), "wish-server allowlist with allowed_exec, is_admin and roles")
+	fs.Parse(args[1:])
+	cfg := loadConfig()
+	defer setupLogging(cfg.Log, "grpc", false)()
+
+	tlsCfg, err := grpcTLS(*cert, *key, *ca)
+	if err != nil { fmt.Fprintln(os.Stderr, err); return 2 }
+	s := &grpcServer{allowPath: *allowPath, auditPath: filepath.Join(tuiDataDir(), "agent_audit.log"), requestsPath: filepath.Join(tuiDataDir(), "requests.json")}
+	srv := grpc.NewServer(grpc.Creds(credentials.NewTLS(tlsCfg)))
+	pb.RegisterAgentsServer(srv, s)
+	l, err := net.Listen("tcp", *addr)
+	if err != nil { slog.Error("grpc: listen failed", "addr", *addr, "err", err); fmt.Fprintln(os.Stderr, err); return 1 }
+	slog.Info("grpc agents API listening", "addr", *addr)
+	if err := srv.Serve(l); err != nil { slog.Error("grpc: serve failed", "err", err); return 1 }
+	return 0
+}
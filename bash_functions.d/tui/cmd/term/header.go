@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// headerFields are the sections of the standard script header, in order
+var headerFields = []string{"Author", "Date", "Summary", "Inputs", "Outputs", "Modification Log"}
+
+// headerBlock returns the leading comment block of lines (after any shebang) as the
+// half-open range [start, end)
+func headerBlock(lines []string) (start, end int) {
+	if len(lines) > 0 && strings.HasPrefix(lines[0], "#!") { start = 1 }
+	end = start
+	for end < len(lines) && strings.HasPrefix(lines[end], "#") { end++ }
+	return start, end
+}
+
+// findField returns the index of the "# Field:" line within lines[start:end], or -1
+func findField(lines []string, start, end int, field string) int {
+	for i := start; i < end; i++ {
+		if strings.HasPrefix(strings.TrimSpace(strings.TrimPrefix(lines[i], "#")), field+":") { return i }
+	}
+	return -1
+}
+
+// ensureHeader inserts the standard header into a script that has none, or adds the
+// sections an existing header is missing. It returns the new source and the line the
+// changes were made at plus how many lines were added, so the caller can keep the
+// cursor on the same text.
+func ensureHeader(src, name, author string) (out string, at, added int) {
+	lines := strings.Split(src, "\n")
+	start, end := headerBlock(lines)
+	date := time.Now().Format("2006-01-02")
+	if findField(lines, start, end, "Author") < 0 {
+		body, _ := renderTemplate(fileTemplate{name: "header", body: scriptHeader}, name, author)
+		body = strings.Replace(body, author+"  created", author+"  header added", 1)
+		hdr := strings.Split(strings.TrimSuffix(body, "\n"), "\n")
+		if start == 1 { hdr = hdr[1:] } // keep the script's own shebang
+		return joinInsert(lines, start, hdr), start, len(hdr)
+	}
+	var missing []string
+	for _, f := range headerFields {
+		if findField(lines, start, end, f) >= 0 { continue }
+		switch f {
+		case "Date":
+			missing = append(missing, "# Date: "+date)
+		case "Modification Log":
+			missing = append(missing, "#", "# Modification Log:", fmt.Sprintf("#   %s  %s  header added", date, author))
+		default:
+			missing = append(missing, "#", "# "+f+":", "#   TODO")
+		}
+	}
+	if len(missing) == 0 { return src, end, 0 }
+	return joinInsert(lines, end, missing), end, len(missing)
+}
+
+// appendModLog adds a dated entry to the header's Modification Log. Repeated saves on
+// the same day by the same author only log once.
+func appendModLog(src, author, note string) (out string, at, added int) {
+	lines := strings.Split(src, "\n")
+	start, end := headerBlock(lines)
+	i := findField(lines, start, end, "Modification Log")
+	if i < 0 { return src, 0, 0 }
+	j := i + 1
+	for j < end && strings.HasPrefix(lines[j], "#  ") { j++ }
+	date := time.Now().Format("2006-01-02")
+	if j > i+1 && strings.HasPrefix(strings.TrimSpace(strings.TrimPrefix(lines[j-1], "#")), date+"  "+author+"  ") { return src, j, 0 }
+	entry := fmt.Sprintf("#   %s  %s  %s", date, author, note)
+	return joinInsert(lines, j, []string{entry}), j, 1
+}
+
+func joinInsert(lines []string, at int, ins []string) string {
+	out := append(append(append([]string{}, lines[:at]...), ins...), lines[at:]...)
+	return strings.Join(out, "\n")
+}
+
+// rewriteEditor replaces the editor buffer, keeping the cursor on the same text when
+// lines were inserted above it
+func (m *model) rewriteEditor(src string, at, added int) {
+	line := m.ta.Line()
+	if line >= at { line += added }
+	m.ta.SetValue(src)
+	editorGoto(&m.ta, line+1, 1)
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// `term hooks` runs agents from a repository's git hooks. The hook files only call
+// back into `term hooks run`; which agents run is kept in cbw-hooks.json in the git
+// dir, so it can change without touching the hooks.
+
+// hookNames are the hooks that can run agents
+var hookNames = []string{"pre-commit", "pre-push"}
+
+// hookMarker identifies hook files written by `term hooks install`
+const hookMarker = "# installed by `term hooks install`"
+
+// hookTail is how many output lines of a failed agent the summary shows
+const hookTail = 20
+
+// gitPath runs git rev-parse in repo for one of its paths
+func gitPath(repo string, args ...string) (string, error) {
+	out, err := exec.Command("git", append([]string{"-C", repo, "rev-parse", "--path-format=absolute"}, args...)...).Output()
+	if err != nil {
+		if ee, ok := err.(*exec.ExitError); ok { return "", fmt.Errorf("git rev-parse: %s", strings.TrimSpace(string(ee.Stderr))) }
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// hooksConfig maps hook names to their agents, in order
+type hooksConfig map[string][]string
+
+func loadHooksConfig(path string) (hooksConfig, error) {
+	cfg := hooksConfig{}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) { return cfg, nil }
+	if err != nil { return nil, err }
+	if err := json.Unmarshal(b, &cfg); err != nil { return nil, fmt.Errorf("%s: %w", path, err) }
+	return cfg, nil
+}
+
+func saveHooksConfig(path string, cfg hooksConfig) error {
+	b, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil { return err }
+	return ioutil.WriteFile(path, append(b, '\n'), 0o644)
+}
+
+// hookScript is the hook file; it execs the binary that installed it
+func hookScript(self, hook string) string {
+	return fmt.Sprintf("#!/bin/sh\n%s; remove with `term hooks uninstall`\nexec '%s' hooks run %s \"$@\"\n", hookMarker, shellEscape(self), hook)
+}
+
+// installHook writes the hook file. A hook that did not come from us is only
+// replaced with force, and then kept as <hook>.cbw-backup for uninstall.
+func installHook(dir, hook, self string, force bool) error {
+	path := filepath.Join(dir, hook)
+	if b, err := ioutil.ReadFile(path); err == nil && !bytes.Contains(b, []byte(hookMarker)) {
+		if !force { return fmt.Errorf("%s already exists; -force moves it to %s.cbw-backup", path, hook) }
+		if err := os.Rename(path, path+".cbw-backup"); err != nil { return err }
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil { return err }
+	return ioutil.WriteFile(path, []byte(hookScript(self, hook)), 0o755)
+}
+
+// uninstallHook removes our hook file and puts back what -force replaced
+func uninstallHook(dir, hook string) error {
+	path := filepath.Join(dir, hook)
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) { return nil }
+	if err != nil { return err }
+	if !bytes.Contains(b, []byte(hookMarker)) { return fmt.Errorf("%s was not installed by term hooks; left alone", path) }
+	if err := os.Remove(path); err != nil { return err }
+	if _, err := os.Stat(path + ".cbw-backup"); err == nil { return os.Rename(path+".cbw-backup", path) }
+	return nil
+}
+
+func validHook(h string) bool {
+	for _, n := range hookNames { if n == h { return true } }
+	return false
+}
+
+// runHookAgents runs the hook's agents as dry-runs from the work tree and prints a
+// summary: one line per agent, and the end of the output of those that failed. It
+// returns the exit status for git, non-zero if any agent failed.
+func runHookAgents(hook string, agents []string, root, auditPath string) int {
+	if len(agents) == 0 { return 0 }
+	os.Setenv("CBW_HOOK", hook)
+	os.Setenv("CBW_GIT_ROOT", root)
+	if err := os.Chdir(root); err != nil { fmt.Fprintln(os.Stderr, err); return 1 }
+	failed := 0
+	fmt.Fprintf(os.Stderr, "cbw %s: %d agent(s)\n", hook, len(agents))
+	for _, a := range agents {
+		start := time.Now()
+		out, code, err := runAgentCapture(traceCtx, a, false)
+		took := time.Since(start).Round(100 * time.Millisecond)
+		appendAudit(auditPath, fmt.Sprintf("%s\tagent=%s\texec=false\texit=%d\terror=%v\tsource=hook\thook=%s\trepo=%s\tduration=%s", start.Format(time.RFC3339), a, code, err, hook, root, took))
+		if code == 0 && err == nil { fmt.Fprintf(os.Stderr, "  ok    %s (%s)\n", a, took); continue }
+		failed++
+		fmt.Fprintf(os.Stderr, "  FAIL  %s exit %d (%s)\n", a, code, took)
+		lines := strings.Split(strings.TrimRight(out.combined(), "\n"), "\n")
+		if len(lines) > hookTail {
+			fmt.Fprintf(os.Stderr, "        ... %d earlier lines\n", len(lines)-hookTail)
+			lines = lines[len(lines)-hookTail:]
+		}
+		for _, l := range lines { fmt.Fprintf(os.Stderr, "        %s\n", l) }
+	}
+	if failed == 0 { return 0 }
+	fmt.Fprintf(os.Stderr, "cbw %s: %d of %d agent(s) failed; `git %s --no-verify` skips the hook\n", hook, failed, len(agents), strings.TrimPrefix(hook, "pre-"))
+	return 1
+}
+
+const hooksUsage = `usage: term hooks <command> [flags]
+
+  install [-repo dir] [-hook pre-commit] [-force] <agent>...   run agents (dry-run) from a git hook
+  uninstall [-repo dir] [-hook pre-commit]                     remove the hook and its agents
+  list [-repo dir]                                              show the agents of each hook
+  run <hook>                                                    what the hook files call
+`
+
+// runHooks implements `term hooks`
+func runHooks(args []string) int {
+	if len(args) < 1 { fmt.Fprint(os.Stderr, hooksUsage); return 2 }
+	fs := flag.NewFlagSet("hooks "+args[0], flag.ExitOnError)
+	repo := fs.String("repo", ".", "repository to work on")
+	hook := fs.String("hook", "pre-commit", "pre-commit or pre-push")
+	force := fs.Bool("force", false, "replace an existing hook, keeping it as <hook>.cbw-backup")
+	fs.Usage = func() { fmt.Fprint(fs.Output(), hooksUsage); fs.PrintDefaults() }
+	fs.Parse(args[1:])
+
+	if args[0] == "run" {
+		if fs.NArg() < 1 || !validHook(fs.Arg(0)) { fs.Usage(); return 2 }
+		*hook = fs.Arg(0)
+	} else if !validHook(*hook) {
+		fmt.Fprintf(os.Stderr, "unknown hook %q; one of %s\n", *hook, strings.Join(hookNames, ", "))
+		return 2
+	}
+	dir, err := gitPath(*repo, "--git-path", "hooks")
+	if err != nil { fmt.Fprintln(os.Stderr, err); return 1 }
+	cfgPath, err := gitPath(*repo, "--git-common-dir")
+	if err != nil { fmt.Fprintln(os.Stderr, err); return 1 }
+	cfgPath = filepath.Join(cfgPath, "cbw-hooks.json")
+	cfg, err := loadHooksConfig(cfgPath)
+	if err != nil { fmt.Fprintln(os.Stderr, err); return 1 }
+
+	switch args[0] {
+	case "install":
+		if fs.NArg() == 0 { fs.Usage(); return 2 }
+		mf, err := loadManifest()
+		if err != nil && !os.IsNotExist(err) { fmt.Fprintln(os.Stderr, err); return 1 }
+		for _, a := range fs.Args() {
+			if _, ok := mf.agent(a); len(mf.Agents) > 0 && !ok { fmt.Fprintf(os.Stderr, "no agent %q in %s\n", a, manifestPath()); return 1 }
+		}
+		self, err := os.Executable()
+		if err != nil { fmt.Fprintln(os.Stderr, err); return 1 }
+		if err := installHook(dir, *hook, self, *force); err != nil { fmt.Fprintln(os.Stderr, err); return 1 }
+		cfg[*hook] = fs.Args()
+		if err := saveHooksConfig(cfgPath, cfg); err != nil { fmt.Fprintln(os.Stderr, err); return 1 }
+		fmt.Printf("%s runs %s (dry-run)\n", *hook, strings.Join(fs.Args(), ", "))
+	case "uninstall":
+		if err := uninstallHook(dir, *hook); err != nil { fmt.Fprintln(os.Stderr, err); return 1 }
+		delete(cfg, *hook)
+		if err := saveHooksConfig(cfgPath, cfg); err != nil { fmt.Fprintln(os.Stderr, err); return 1 }
+	case "list":
+		for _, h := range hookNames {
+			if len(cfg[h]) > 0 { fmt.Printf("%s\t%s\n", h, strings.Join(cfg[h], ", ")) }
+		}
+	case "run":
+		root, err := gitPath(*repo, "--show-toplevel")
+		if err != nil { fmt.Fprintln(os.Stderr, err); return 1 }
+		return runHookAgents(*hook, cfg[*hook], root, filepath.Join(tuiDataDir(), "agent_audit.log"))
+	default:
+		fmt.Fprint(os.Stderr, hooksUsage)
+		return 2
+	}
+	return 0
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// host is one machine in the Hosts tab inventory
+type host struct {
+	Name      string `json:"name"`
+	Addr      string `json:"addr,omitempty"`      // IP or DNS name, for ping
+	MAC       string `json:"mac,omitempty"`       // for Wake-on-LAN
+	SSH       string `json:"ssh,omitempty"`       // ssh destination, e.g. an alias from ~/.ssh/config
+	Broadcast string `json:"broadcast,omitempty"` // where magic packets go; 255.255.255.255 by default
+	Notes     string `json:"notes,omitempty"`
+}
+
+// target is what ping reaches the host by
+func (h host) target() string {
+	if h.Addr != "" { return h.Addr }
+	return h.Name
+}
+
+// sshDest is what ssh connects to: the alias if there is one, else the address
+func (h host) sshDest() string {
+	if h.SSH != "" { return h.SSH }
+	return h.target()
+}
+
+func hostsPath() string { return filepath.Join(tuiDataDir(), "hosts.json") }
+
+func loadHosts() ([]host, error) {
+	var hs []host
+	b, err := ioutil.ReadFile(hostsPath())
+	if os.IsNotExist(err) { return nil, nil }
+	if err != nil { return nil, err }
+	if err := json.Unmarshal(b, &hs); err != nil { return nil, fmt.Errorf("%s: %v", hostsPath(), err) }
+	sort.Slice(hs, func(i, j int) bool { return strings.ToLower(hs[i].Name) < strings.ToLower(hs[j].Name) })
+	return hs, nil
+}
+
+func saveHosts(hs []host) error {
+	b, err := json.MarshalIndent(hs, "", "  ")
+	if err != nil { return err }
+	if err := os.MkdirAll(tuiDataDir(), 0o700); err != nil { return err }
+	tmp := hostsPath() + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0o600); err != nil { return err }
+	return os.Rename(tmp, hostsPath())
+}
+
+// putHost adds h, or replaces the host named old when editing
+func putHost(old string, h host) error {
+	return withLock("hosts", func() error {
+		hs, err := loadHosts()
+		if err != nil { return err }
+		next := []host{}
+		for _, o := range hs {
+			if o.Name == old && old != "" { continue }
+			if strings.EqualFold(o.Name, h.Name) { return errors.New(T("there is already a host named %s", o.Name)) }
+			next = append(next, o)
+		}
+		return saveHosts(append(next, h))
+	})
+}
+
+func dropHost(name string) error {
+	return withLock("hosts", func() error {
+		hs, err := loadHosts()
+		if err != nil { return err }
+		next := []host{}
+		for _, h := range hs { if h.Name != name { next = append(next, h) } }
+		return saveHosts(next)
+	})
+}
+
+// magicPacket is six 0xff bytes followed by the MAC sixteen times
+func magicPacket(mac string) ([]byte, error) {
+	hw, err := net.ParseMAC(mac)
+	if err != nil || len(hw) != 6 { return nil, errors.New(T("bad MAC address %q", mac)) }
+	p := bytes.Repeat([]byte{0xff}, 6)
+	for i := 0; i < 16; i++ { p = append(p, hw...) }
+	return p, nil
+}
+
+// wakeHost broadcasts a Wake-on-LAN magic packet for h to UDP port 9
+func wakeHost(h host) error {
+	if h.MAC == "" { return errors.New(T("%s has no MAC address", h.Name)) }
+	p, err := magicPacket(h.MAC)
+	if err != nil { return err }
+	bcast := h.Broadcast
+	if bcast == "" { bcast = "255.255.255.255" }
+	if _, _, err := net.SplitHostPort(bcast); err != nil { bcast = net.JoinHostPort(bcast, "9") }
+	c, err := net.Dial("udp", bcast)
+	if err != nil { return err }
+	defer c.Close()
+	_, err = c.Write(p)
+	return err
+}
+
+// hostPing is the outcome of the last ping of a host
+type hostPing struct {
+	up   bool
+	rtt  string
+	when time.Time
+}
+
+type hostPingMsg struct {
+	name string
+	ping hostPing
+	err  error // ping could not be run at all
+}
+
+var pingRTT = regexp.MustCompile(`time[=<]([0-9.]+ ?ms)`)
+
+// pingHost sends one ping to h without blocking the UI
+func pingHost(h host) tea.Cmd {
+	return func() tea.Msg {
+		if _, err := exec.LookPath("ping"); err != nil { return hostPingMsg{name: h.Name, err: errors.New(T("ping not found in PATH"))} }
+		out, err := exec.Command("ping", "-c", "1", "-W", "2", h.target()).CombinedOutput()
+		p := hostPing{up: err == nil, when: time.Now()}
+		if m := pingRTT.FindSubmatch(out); m != nil { p.rtt = string(m[1]) }
+		return hostPingMsg{name: h.Name, ping: p}
+	}
+}
+
+type hostItem struct {
+	h    host
+	ping *hostPing
+}
+
+func (i hostItem) Title() string {
+	if i.ping == nil { return i.h.Name }
+	if i.ping.up { return i.h.Name + " " + T("up") + " " + i.ping.rtt }
+	return i.h.Name + " " + T("down")
+}
+
+func (i hostItem) Description() string {
+	parts := []string{}
+	for _, s := range []string{i.h.Addr, i.h.MAC, i.h.SSH} { if s != "" { parts = append(parts, s) } }
+	if i.h.Notes != "" { parts = append(parts, i.h.Notes) }
+	return strings.Join(parts, " · ")
+}
+
+func (i hostItem) FilterValue() string { return strings.Join([]string{i.h.Name, i.h.Addr, i.h.MAC, i.h.SSH, i.h.Notes}, " ") }
+
+func newHostsList() list.Model {
+	l := list.New(nil, list.NewDefaultDelegate(), 60, height-8)
+	l.Title = T("Hosts")
+	l.SetShowHelp(false)
+	return l
+}
+
+// refreshHosts rereads the inventory, keeping the last ping of each host
+func (m *model) refreshHosts() {
+	hs, err := loadHosts()
+	if err != nil { m.status = T("cannot read %s: %v", hostsPath(), err); slog.Warn("host inventory unreadable", "err", err); return }
+	items := make([]list.Item, 0, len(hs))
+	for _, h := range hs {
+		it := hostItem{h: h}
+		if p, ok := m.hostPings[h.Name]; ok { it.ping = &p }
+		items = append(items, it)
+	}
+	m.hostsList.SetItems(items)
+}
+
+// hostSSHDoneMsg arrives when an ssh session started from the Hosts tab ends
+type hostSSHDoneMsg struct {
+	name string
+	err  error
+}
+
+// updateHosts handles the Hosts tab keys: enter opens an ssh session, p pings the
+// selected host and P all of them, W wakes it, n adds, e edits and x removes
+func (m *model) updateHosts(key string) (tea.Cmd, bool) {
+	if m.hostsList.FilterState() == list.Filtering { return nil, false }
+	sel, ok := m.hostsList.SelectedItem().(hostItem)
+	switch key {
+	case "u":
+		m.refreshHosts()
+		m.status = T("refreshed hosts")
+		return nil, true
+	case "n":
+		return m.openHostForm(host{}, false), true
+	case "e":
+		if !ok { return nil, true }
+		return m.openHostForm(sel.h, true), true
+	case "x":
+		if !ok { return nil, true }
+		name := sel.h.Name
+		m.ask(T("remove %s from the hosts?", name), func(m *model) tea.Cmd {
+			if err := dropHost(name); err != nil { m.status = T("not removed: %v", err); slog.Warn("host removal failed", "host", name, "err", err); return nil }
+			m.refreshHosts()
+			m.status = T("removed %s", name)
+			return nil
+		})
+		return nil, true
+	case "p":
+		if !ok { return nil, true }
+		m.status = T("pinging %s", sel.h.target())
+		return pingHost(sel.h), true
+	case "P":
+		var cmds []tea.Cmd
+		for _, it := range m.hostsList.Items() { cmds = append(cmds, pingHost(it.(hostItem).h)) }
+		m.status = T("pinging %d hosts", len(cmds))
+		return tea.Batch(cmds...), true
+	case "W":
+		if !ok { return nil, true }
+		if err := wakeHost(sel.h); err != nil { m.status = T("cannot wake %s: %v", sel.h.Name, err); slog.Warn("wake-on-lan failed", "host", sel.h.Name, "err", err); return nil, true }
+		m.status = T("sent a wake-up packet to %s (%s); p to check when it is up", sel.h.Name, sel.h.MAC)
+		return nil, true
+	case "enter":
+		if !ok || m.denyReadOnly() { return nil, true }
+		if _, err := exec.LookPath("ssh"); err != nil { m.status = T("ssh not found in PATH"); return nil, true }
+		name := sel.h.Name
+		return tea.ExecProcess(exec.Command("ssh", sel.h.sshDest()), func(err error) tea.Msg { return hostSSHDoneMsg{name, err} }), true
+	}
+	return nil, false
+}
+
+// hostForm adds or edits one host: one input per field, tab moves between them
+type hostForm struct {
+	fields []textinput.Model
+	focus  int
+	name   string // host being edited; "" when adding
+}
+
+var hostFieldNames = []string{"name", "address", "MAC", "ssh", "broadcast", "notes"}
+
+func (m *model) openHostForm(h host, editing bool) tea.Cmd {
+	f := &hostForm{}
+	if editing { f.name = h.Name }
+	for i, v := range []string{h.Name, h.Addr, h.MAC, h.SSH, h.Broadcast, h.Notes} {
+		ti := textinput.New()
+		ti.Prompt = fmt.Sprintf("%-12s", T(hostFieldNames[i])+": ")
+		ti.CharLimit = 500
+		ti.Width = 60
+		ti.SetValue(v)
+		f.fields = append(f.fields, ti)
+	}
+	f.fields[1].Placeholder = T("IP or DNS name to ping")
+	f.fields[2].Placeholder = "aa:bb:cc:dd:ee:ff"
+	f.fields[3].Placeholder = T("ssh destination, e.g. an alias from ~/.ssh/config")
+	f.fields[4].Placeholder = T("255.255.255.255, or the subnet broadcast address")
+	m.hostForm = f
+	return f.fields[0].Focus()
+}
+
+// host is the host the form describes
+func (f *hostForm) host() (host, error) {
+	v := func(i int) string { return strings.TrimSpace(f.fields[i].Value()) }
+	h := host{Name: v(0), Addr: v(1), MAC: v(2), SSH: v(3), Broadcast: v(4), Notes: v(5)}
+	if h.Name == "" { return h, errors.New(T("a host needs a name")) }
+	if h.MAC != "" {
+		if _, err := magicPacket(h.MAC); err != nil { return h, err }
+	}
+	return h, nil
+}
+
+// updateHostForm handles keys while the host form is open
+func (m *model) updateHostForm(msg tea.KeyMsg) tea.Cmd {
+	f := m.hostForm
+	switch msg.String() {
+	case "esc":
+		m.hostForm = nil
+		m.status = T("cancelled")
+		return nil
+	case "tab", "down", "shift+tab", "up":
+		f.fields[f.focus].Blur()
+		if msg.String() == "tab" || msg.String() == "down" { f.focus = (f.focus + 1) % len(f.fields) } else { f.focus = (f.focus - 1 + len(f.fields)) % len(f.fields) }
+		return f.fields[f.focus].Focus()
+	case "enter":
+		h, err := f.host()
+		if err == nil { err = putHost(f.name, h) }
+		if err != nil { m.status = T("not saved: %v", err); slog.Warn("host edit rejected", "host", h.Name, "err", err); return nil }
+		m.hostForm = nil
+		m.refreshHosts()
+		m.status = T("saved %s", h.Name)
+		return nil
+	}
+	var cmd tea.Cmd
+	f.fields[f.focus], cmd = f.fields[f.focus].Update(msg)
+	return cmd
+}
+
+func (f *hostForm) view() string {
+	title := T("New host")
+	if f.name != "" { title = T("Edit %s", f.name) }
+	var b strings.Builder
+	b.WriteString(lipgloss.NewStyle().Bold(true).Render(title) + "\n\n")
+	for _, ti := range f.fields { b.WriteString(ti.View() + "\n") }
+	b.WriteString("\n" + helpStyle.Render(T("tab/shift+tab: next/previous field • enter: save • esc: cancel")))
+	return b.String()
+}
+
+// hostsView is the Hosts tab: the form while it is open, else the inventory
+func (m model) hostsView() string {
+	if m.hostForm != nil { return m.hostForm.view() }
+	if len(m.hostsList.Items()) == 0 { return T("No hosts yet; n adds one.") + "\n" }
+	return m.hostsList.View() + "\n" + helpStyle.Render(T("enter: ssh • p/P: ping one/all • W: wake-on-LAN • n/e/x: add/edit/remove • u: reload"))
+}
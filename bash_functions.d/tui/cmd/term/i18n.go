@@ -0,0 +1,712 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// locale is the active UI language, chosen once at startup by setLocale
+var locale = "en"
+
+// catalogs maps a locale to translations keyed by the English message (gettext style),
+// so untranslated messages fall back to English automatically. Format verbs must appear
+// in the same order in every translation.
+var catalogs = map[string]map[string]string{
+	"es": {
+		// tabs and titles
+		"Files": "Archivos", "Agents": "Agentes", "Requests": "Solicitudes", "Audit": "Auditoría",
+		"Plugins": "Complementos", "Preview": "Vista previa", "Editor": "Editor", "Shell": "Terminal",
+		"Image": "Imagen", "YouTube": "YouTube", "Schedule": "Programación", "Jobs": "Tareas", "Search": "Buscar",
+		"Files: %s": "Archivos: %s",
+		"%s by %s":  "%s de %s",
+		"directory": "directorio",
+		"file":      "archivo",
+		"status: ":  "estado: ",
+		" [ws %d/%d]": " [esp %d/%d]",
+
+		// placeholders and help
+		"enter shell command and press Enter":                       "escribe un comando y pulsa Enter",
+		"Write script here. Ctrl+S to save, Ctrl+Q to exit editor.": "Escribe el script aquí. Ctrl+S guarda, Ctrl+Q sale del editor.",
+		"Welcome to the TUI. Select a file and press Enter to preview or press 'e' to edit. Press 'E' to open in embedded editor.": "Bienvenido. Selecciona un archivo y pulsa Enter para previsualizar o 'e' para editar. Pulsa 'E' para abrirlo en el editor integrado.",
+		helpText: "q: salir • tab: siguiente pestaña • alt+v/alt+s: dividir • alt+o: siguiente panel • alt+x: cerrar panel • alt+z: ampliar • alt+i: acerca de • alt+1-9: espacio de trabajo • t: tema md • 1-7: cambiar pestaña • enter: abrir/previsualizar • ctrl+o: índice • /: buscar • n: archivo nuevo • d: borrar • e: editar • o: abrir externo • E: editar en la TUI • v: ver solo lectura • L: vista detallada • </>: columna de orden • -: invertir orden • m/D: marcar archivo, comparar marcados • H/V: sumas de comprobación, comprobar con un valor • P: firmar con gpg, verificar .sig/.asc • X: cifrar/descifrar con age • R: renombrar en lote (ctrl+t: mayúsculas) • +/#: etiquetar archivos, filtrar por etiqueta • ]/[/|/a/A: hunk siguiente/anterior, lado a lado, aplicar hunk (diff) • r: agente en simulación • R: ejecutar agente • c: comparar simulación con la última ejecución • #: filtrar agentes por etiqueta • s: buscar agentes • G: generar agente con un LLM • ?texto: sugerir un comando (Shell) • espacio: plegar salida del equipo • C: comentar solicitud • x: exportar estadísticas • f: seguir auditoría • a: archivo de auditoría • /: filtrar Auditoría, Solicitudes (agent=, user=, status=) • espacio: activar/desactivar plugin • n/e/x: añadir/editar/quitar entrada de la lista de acceso (Admin) • enter/p/P/W: ssh, ping, ping a todos, wake-on-LAN (Hosts) • enter/T/L/c: ejecutar playbook, tags, límite, modo de prueba (Ansible) • enter/esc/e/x: entrar, volver, shell, borrar pod (K8s) • p/enter/z/a: plan, expandir, expandir todo, pedir apply (Terraform) • enter/r/y/L: desbloquear, mostrar, copiar, bloquear (Vault) • s/enter/esc/d/x/D: analizar, entrar, subir, borrar, exportar, duplicados (Usage) • L: enlazar duplicados • enter/#/x/u: ir al archivo, filtrar Files, quitar etiqueta, recargar (Tags) • i/I: crear/ver invitaciones • a: aprobar clave pendiente • f/c/enter: filtrar, quitar filtro, misma dirección (Conexiones) • y/Y: copiar selección/última salida • alt+y: historial del portapapeles • alt+e: archivos recientes • alt+,/alt+.: saltar atrás/adelante • alt+c: paleta de comandos, calculadora • alt+q: mostrar la selección como código QR • O: vista stdout/stderr/markdown • w: guardar salida • alt+l: abrir en $PAGER • W: ajustar/desplazar líneas largas • Ctrl+S: guardar • alt+h: cabecera del script • alt+p: fragmentos • ctrl+r/alt+r: ejecutar búfer/archivo • ctrl+g: ir a la línea • ctrl+]: saltar al corchete • alt+w: alternar solo lectura • alt+m: vista previa markdown en vivo • F: filtrar markdown por frontmatter • flechas/enter/r: cuadrícula de imágenes, vista completa, recargar (Imagen) • s/d/p/x/R/c: buscar, descargas, reproducir, cancelar, reintentar, quitar terminadas (YouTube) • espacio/←/→/+/-/m/S: controles de mpv • Ctrl+Q: salir del editor",
+
+		// status messages
+		"cannot close the last pane":  "no se puede cerrar el último panel",
+		"theme=%s":                    "tema=%s",
+		"save output failed: %v":      "no se pudo guardar la salida: %v",
+		"saved output to %s":          "salida guardada en %s",
+		"preview: %s":                 "vista previa: %s",
+		"press 'e' to open in $EDITOR, 'E' to open in embedded editor, or 'p' to print": "pulsa 'e' para abrir en $EDITOR, 'E' para el editor integrado o 'p' para mostrarlo",
+		"no file selected for editor":    "no hay archivo seleccionado para el editor",
+		"failed to read file for editor": "no se pudo leer el archivo para el editor",
+		"editing: %s":                    "editando: %s",
+		"editing: %s:%d":                 "editando: %s:%d",
+		"scp commands for %s":            "comandos scp para %s",
+		"select a file to share":         "selecciona un archivo para compartir",
+		"share failed: %v":               "no se pudo compartir: %v",
+		"serving %s":                     "sirviendo %s",
+		"upload listener failed: %v":     "no se pudo aceptar subidas: %v",
+		"accepting uploads into %s":      "aceptando subidas en %s",
+		"One-time download link for %s (valid %s):\n\n  %s\n\n  curl -fSLO '%s'\n":                                      "Enlace de descarga de un solo uso para %s (válido %s):\n\n  %s\n\n  curl -fSLO '%s'\n",
+		"Uploads into %s are accepted for %s:\n\n  curl -fS -T ./FILE '%sFILE'\n\nExisting files are never overwritten.\n": "Se aceptan subidas en %s durante %s:\n\n  curl -fS -T ./ARCHIVO '%sARCHIVO'\n\nLos archivos existentes nunca se sobrescriben.\n",
+		"Agent: %s\n\n%s":                                          "Agente: %s\n\n%s",
+		"execution not allowed for this user":                      "ejecución no permitida para este usuario",
+		"Execution not allowed for this user (no SSH_ALLOWED_EXEC)": "Ejecución no permitida para este usuario (sin SSH_ALLOWED_EXEC)",
+		"execution needs an exec broker":                           "la ejecución necesita un broker de ejecución",
+		"Execution needs an exec broker (broker_socket in config.json)": "La ejecución necesita un broker de ejecución (broker_socket en config.json)",
+		"user not permitted to exec this agent":                    "usuario sin permiso para ejecutar este agente",
+		"User not permitted to exec this agent":                    "Usuario sin permiso para ejecutar este agente",
+		"failed to queue agent: %v":                                "no se pudo encolar el agente: %v",
+		"Started %s (exec=%v) as %s. Output appears here when it finishes; see the Jobs tab for progress.": "Iniciado %s (exec=%v) como %s. La salida aparecerá aquí al terminar; consulta la pestaña Tareas.",
+		"queued agent %s (exec=%v) as %s":                       "agente %s (exec=%v) encolado como %s",
+		"refreshed requests":                                    "solicitudes actualizadas",
+		"Request %s: %s by %s\nNotes: %s":                       "Solicitud %s: %s de %s\nNotas: %s",
+		"admin privileges required":                             "se requieren privilegios de administrador",
+		"Admin privileges required to approve/deny requests":    "Se requieren privilegios de administrador para aprobar/denegar solicitudes",
+		"Request denied":                                        "Solicitud denegada",
+		"approved request %s":                                   "solicitud %s aprobada",
+		"refreshed audit":                                       "auditoría actualizada",
+		"refreshed schedule":                                    "programación actualizada",
+		"no file path to save to (open a file from Files with 'E')": "no hay ruta donde guardar (abre un archivo desde Archivos con 'E')",
+		"save failed: %v":                                       "no se pudo guardar: %v",
+		"saved: %s":                                             "guardado: %s",
+		"exited editor":                                         "editor cerrado",
+		"running: %s":                                           "ejecutando: %s",
+		"job sync failed: %v":                                   "fallo al sincronizar tareas: %v",
+		"agent %s (exec=%v) finished: %s exit=%d":               "agente %s (exec=%v) terminado: %s salida=%d",
+		"copy failed: %v":                                       "no se pudo copiar: %v",
+		"copied %s to clipboard (%d bytes)":                     "%s copiado al portapapeles (%d bytes)",
+		"Outline":                         "Índice",
+		"no markdown document to outline": "no hay documento markdown para indexar",
+		"section not found: %s":           "sección no encontrada: %s",
+		"section: %s":                     "sección: %s",
+		"line %d":                         "línea %d",
+		"%d matches":                      "%d coincidencias",
+		"press / to search under the current directory": "pulsa / para buscar en el directorio actual",
+		"searching for %q in %s":          "buscando %q en %s",
+		"search failed: %v":               "búsqueda fallida: %v",
+		"%d matches for %q (%s)":          "%d coincidencias de %q (%s)",
+		", showing the first %d":          ", se muestran las primeras %d",
+		"open failed: %v":                 "no se pudo abrir: %v",
+		"user template":                   "plantilla de usuario",
+		"bash script with the cbw header block":             "script bash con el bloque de cabecera cbw",
+		"agent skeleton: dry-run by default, --exec to act": "esqueleto de agente: simulación por defecto, --exec para actuar",
+		"markdown document with title and sections":         "documento markdown con título y secciones",
+		"New file in %s":                  "Archivo nuevo en %s",
+		"file name, then enter (esc cancels)": "nombre del archivo y enter (esc cancela)",
+		"create failed: %v":               "no se pudo crear: %v",
+		"header updated (%d lines)":       "cabecera actualizada (%d líneas)",
+		"header is complete":              "la cabecera está completa",
+		"user snippet":                    "fragmento de usuario",
+		"Snippets":                        "Fragmentos",
+		"snippet %s: %v":                  "fragmento %s: %v",
+		"inserted snippet %s":             "fragmento %s insertado",
+		"save %s and run it?":       "¿guardar %s y ejecutarlo?",
+		"cancelled":                       "cancelado",
+		"Dry run (now, exit %d)":          "Simulación (ahora, salida %d)",
+		"No previous exec run of %s.":     "No hay ejecuciones previas de %s.",
+		"Last exec (%s, %s, exit %d)":     "Última ejecución (%s, %s, salida %d)",
+		"dry run of %s compared with its last exec": "simulación de %s comparada con su última ejecución",
+		"dry-running %s for comparison":   "simulando %s para comparar",
+		"Approval needed: %s":             "Aprobación pendiente: %s",
+		"Approve or deny in the Requests tab.": "Apruébala o recházala en la pestaña Solicitudes.",
+		"Request %s %s by %s":             "Solicitud %s %s por %s",
+		"%s requested by %s, exit %s":     "%s solicitado por %s, salida %s",
+		"Agent %s failed":                 "El agente %s falló",
+		"%s (%s) exited %s: %s":           "%s (%s) terminó con %s: %s",
+		"approved":                        "aprobada",
+		"denied":                          "rechazada",
+		"(no requests)":                   "(no hay solicitudes)",
+		"request %s: %v":                  "solicitud %s: %v",
+		"No agent runs in the audit log yet.": "Aún no hay ejecuciones de agentes en el registro de auditoría.",
+		"%d runs, %d failed (%.0f%%)":     "%d ejecuciones, %d fallidas (%.0f%%)",
+		"Runs per agent":                  "Ejecuciones por agente",
+		"agent":                           "agente",
+		"runs":                            "ejec.",
+		"failed":                          "fallos",
+		"avg":                             "media",
+		"Top users":                       "Usuarios principales",
+		"Runs per day (last %d days)":     "Ejecuciones por día (últimos %d días)",
+		"export failed: %v":               "no se pudo exportar: %v",
+		"Dashboard":                       "Panel",
+		"Running jobs":                    "Trabajos en ejecución",
+		"%d queued":                       "%d en cola",
+		"Pending requests":                "Solicitudes pendientes",
+		"... %d more in the Requests tab": "... %d más en la pestaña Solicitudes",
+		"Recent failures":                 "Fallos recientes",
+		"Connected sessions":              "Sesiones conectadas",
+		"local":                           "local",
+		"for":                             "desde hace",
+		"Scheduled runs":                  "Ejecuciones programadas",
+		"in %s":                           "en %s",
+		"last exit":                       "última salida",
+		"The TUI crashed and is closing.": "La TUI ha fallado y se está cerrando.",
+		"The TUI crashed. Crash report: %s": "La TUI ha fallado. Informe del fallo: %s",
+		"The TUI crashed; the crash report could not be written (see the log).": "La TUI ha fallado; no se pudo escribir el informe del fallo (consulta el registro).",
+		"About": "Acerca de", "version": "versión", "commit": "commit", "built": "compilado", "data": "datos",
+		"Update with `cbw self-update`.": "Actualiza con `cbw self-update`.",
+		"Debug": "Depuración", "last messages:": "últimos mensajes:",
+		"Mux": "Sesiones tmux", "Sessions": "Sesiones", "new: %s": "nueva: %s", "create from template (%s)": "crear desde plantilla (%s)",
+		"%d windows": "%d ventanas", "exited": "terminada", "attached": "conectada", "detached": "desconectada", "active %s ago": "activa hace %s", "stale": "inactiva",
+		"refreshed sessions": "sesiones actualizadas", "failed to create session: %v": "no se pudo crear la sesión: %v",
+		"kill %s session %s?": "¿terminar la sesión %[1]s %[2]s?", "kill failed: %v %s": "no se pudo terminar: %v %s", "killed %s": "terminada: %s",
+		"no stale sessions": "no hay sesiones inactivas", "kill %d stale sessions?": "¿terminar %d sesiones inactivas?",
+		"go to line: ": "ir a la línea: ", "line[:col]": "línea[:col]", "not a line number: %q": "no es un número de línea: %q", "line %d of %d": "línea %d de %d",
+		"long lines: scroll (left/right)": "líneas largas: desplazar (izquierda/derecha)", "long lines: wrap": "líneas largas: ajustar", "cols %d-%d of %d": "columnas %d-%d de %d",
+		"pending": "pendiente", "decided": "decidida", "Request %s (%s)": "Solicitud %s (%s)", "requester": "solicitante", "time": "hora", "notes": "notas",
+		"(output unavailable: %v)": "(salida no disponible: %v)", "(exit %d in %s)": "(salida %d en %s)", "output: %s": "salida: %s", "Output of the approved run": "Salida de la ejecución aprobada",
+		"entry": "entrada", "interpreter": "intérprete", "tools": "herramientas", "env": "entorno",
+		"tags": "etiquetas", "Agents #%s": "Agentes #%s", "no agent has tags": "ningún agente tiene etiquetas", "showing all agents": "mostrando todos los agentes", "showing agents tagged %s": "mostrando agentes con la etiqueta %s",
+		"search agents: ": "buscar agentes: ", "name, tag, description or script text": "nombre, etiqueta, descripción o texto del script", "%d agents match": "%d agentes coinciden",
+		"never run": "nunca ejecutado", "failed (exit %s) %s ago": "falló (salida %s) hace %s", "ok %s ago": "ok hace %s", "after %s": "después de %s",
+		"not in the manifest": "no está en el manifiesto", "Crew: %s": "Equipo: %s", "manifest unreadable: %v": "manifiesto ilegible: %v", "Stage %d": "Etapa %d",
+		"crew %s: enter opens a member, r runs it (R with --exec), esc goes back": "equipo %s: enter abre un miembro, r lo ejecuta (R con --exec), esc vuelve", "%s is not in the manifest": "%s no está en el manifiesto", "agent %s": "agente %s", "crew of %d": "equipo de %d",
+		"dry-run": "simulación", "PASS": "OK", "FAIL": "FALLO", "SKIP": "OMITIDO", "(no output)": "(sin salida)",
+		"Crew %s: %s (%s, %s)": "Equipo %s: %s (%s, %s)", "skipped: a dependency failed": "omitido: falló una dependencia", "exit %d in %s": "salida %d en %s",
+		"crew exec refused: %v": "exec del equipo rechazado: %v", "running crew %s (exec=%v)": "ejecutando equipo %s (exec=%v)", "crew %s: %s": "equipo %s: %s",
+		"ok in %s": "ok en %s", "failed (exit %d) in %s": "falló (salida %d) en %s", "crew run failed: %v": "falló la ejecución del equipo: %v",
+		"exec users": "usuarios exec", "exec roles": "roles exec", "exec": "exec", "not allowed for you (%v)": "no permitido para ti (%v)", "dry-run only": "solo simulación",
+		"sandbox": "aislamiento", "limits": "límites",
+		"stopped following the audit log": "ya no se sigue el registro de auditoría", "cannot follow the audit log: %v": "no se puede seguir el registro de auditoría: %v", "following the audit log (f stops)": "siguiendo el registro de auditoría (f para)",
+		"compressed": "comprimido", "no archived audit segments in %s": "no hay segmentos de auditoría archivados en %s", "Audit archive": "Archivo de auditoría",
+		"enter shows a segment, esc goes back": "enter muestra un segmento, esc vuelve", "cannot read %s: %v": "no se puede leer %s: %v", "%s: %d entries": "%s: %d entradas",
+		"stderr: ": "stderr: ", "(no %s output)": "(sin salida %s)", "no agent output shown": "no se muestra salida de agente", "showing %s": "mostrando %s",
+		"Admin": "Administración", "Admin privileges required": "Se requieren privilegios de administrador",
+		"Allowlist": "Lista de acceso", "Allowlist (%s)": "Lista de acceso (%s)", "(admin)": "(admin)",
+		"exec: %s": "exec: %s", "roles: %s": "roles: %s", "never logged in": "nunca ha iniciado sesión", "last login %s": "último acceso %s",
+		"invalid key: %v": "clave no válida: %v", "fingerprint": "huella", "admin": "admin", "roles": "roles", "never": "nunca", "last login": "último acceso",
+		"user": "usuario", "public key": "clave pública", "allowed exec": "exec permitido", "admin (yes/no)": "admin (sí/no)",
+		"agents, comma separated": "agentes, separados por comas", "roles, comma separated": "roles, separados por comas",
+		"admin must be yes or no": "admin debe ser sí o no", "New allowlist entry": "Nueva entrada de la lista de acceso", "Edit %s": "Editar %s",
+		"tab/shift+tab: next/previous field • enter: preview the change • esc: cancel": "tab/shift+tab: campo siguiente/anterior • enter: ver el cambio • esc: cancelar",
+		"not saved: %v": "no se guardó: %v", "saved %s to the allowlist": "%s guardado en la lista de acceso",
+		"%s is no longer in the allowlist": "%s ya no está en la lista de acceso", "refreshed allowlist": "lista de acceso actualizada",
+		"remove %s from the allowlist?": "¿quitar a %s de la lista de acceso?", "not removed: %v": "no se quitó: %v",
+		"removed %s from the allowlist": "%s quitado de la lista de acceso",
+		"no public key": "no hay clave pública", "more than one key; add them one at a time": "más de una clave; añádelas de una en una",
+		"paste a public key, or the path of a .pub file": "pega una clave pública, o la ruta de un archivo .pub",
+		"%s already has this key": "%s ya tiene esta clave", "no changes to the allowlist": "no hay cambios en la lista de acceso",
+		"the allowlist changed since the preview; review the change again": "la lista de acceso cambió desde la vista previa; revisa el cambio de nuevo",
+		"write %s to the allowlist?": "¿guardar a %s en la lista de acceso?", "Allowlist changes (%s)": "Cambios en la lista de acceso (%s)",
+		"(pending)": "(pendiente)", "requested %s from %s": "solicitado %s desde %s", "requested": "solicitado", "from": "desde", "invite": "invitación",
+		"no invite: %v": "sin invitación: %v", "invite created; it is shown only once": "invitación creada; solo se muestra una vez",
+		"approve %s?": "¿aprobar a %s?", "approved %s": "%s aprobado", "reject the request of %s?": "¿rechazar la solicitud de %s?",
+		"not rejected: %v": "no se rechazó: %v", "rejected the request of %s": "solicitud de %s rechazada", "the request of %s is gone": "la solicitud de %s ya no existe",
+		"Invite token (shown once, valid for %d hours):": "Token de invitación (se muestra una vez, válido durante %d horas):",
+		"The new user connects with the name they want and gives the token as the password, then pastes their public key, or runs:": "El nuevo usuario se conecta con el nombre que quiera y da el token como contraseña; luego pega su clave pública, o ejecuta:",
+		"The key shows up as pending in the Admin tab: a approves it, e edits it first, x rejects it.": "La clave aparece como pendiente en la pestaña Administración: a la aprueba, e la edita antes, x la rechaza.",
+		"No invites.": "No hay invitaciones.", "Invites": "Invitaciones", "open until %s": "abierta hasta %s", "used by %s at %s": "usada por %s el %s", "expired": "caducada",
+		"live preview off": "vista previa en vivo desactivada", "live preview is for markdown files": "la vista previa en vivo es para archivos markdown",
+		"live preview of %s": "vista previa en vivo de %s",
+		"frontmatter filter (tags=go status=draft): ": "filtro de frontmatter (tags=go status=draft): ",
+		"frontmatter filter cleared": "filtro de frontmatter quitado",
+		"%d markdown files match %s": "%d archivos markdown coinciden con %s",
+		"Files: %s [%s]": "Archivos: %s [%s]",
+		"loading thumbnails of %s...": "cargando miniaturas de %s...",
+		"no images (png, jpeg, gif) in %s": "no hay imágenes (png, jpeg, gif) en %s",
+		"cannot show %s: %v": "no se puede mostrar %s: %v",
+		"unreadable": "ilegible",
+		"%s - %dx%d; esc returns to the list": "%s - %dx%d; esc vuelve a la lista",
+		"%s - %dx%d; esc returns to the grid": "%s - %dx%d; esc vuelve a la cuadrícula",
+		"Downloads (%d active):": "Descargas (%d activas):",
+		"Format for %s:": "Formato para %s:",
+		"Results for %q:": "Resultados para %q:",
+		"cannot queue download: %v": "no se puede encolar la descarga: %v",
+		"cleared finished downloads": "descargas terminadas quitadas",
+		"download %s: %s": "descarga %s: %s",
+		"download queue: %v": "cola de descargas: %v",
+		"download sync failed: %v": "falló la sincronización de descargas: %v",
+		"enter: log • p: play • x: cancel/remove • R: retry • c: clear finished • d: back to the results": "enter: registro • p: reproducir • x: cancelar/quitar • R: reintentar • c: quitar terminadas • d: volver a los resultados",
+		"failed, exit %d": "falló, salida %d",
+		"no results yet": "aún no hay resultados",
+		"nothing queued": "nada en cola",
+		"queued %s (%s) into %s": "%s (%s) en cola hacia %s",
+		"removed %s; files already downloaded are kept": "%s quitada; los archivos ya descargados se conservan",
+		"retrying %s": "reintentando %s",
+		"s: search or paste a URL • enter: pick a format • p: play • d: go to the downloads": "s: buscar o pegar una URL • enter: elegir formato • p: reproducir • d: ir a las descargas",
+		"search YouTube: ": "buscar en YouTube: ",
+		"searching YouTube for %q": "buscando %q en YouTube",
+		"searching YouTube for %q...": "buscando %q en YouTube...",
+		"words, or a video URL": "palabras, o la URL de un vídeo",
+		"YouTube search failed: %v": "falló la búsqueda en YouTube: %v",
+		"%d results for %q": "%d resultados para %q",
+		"queued": "en cola",
+		"downloading": "descargando",
+		"done": "hecha",
+		"mpv is not responding: %v": "mpv no responde: %v",
+		"playback stopped": "reproducción detenida",
+		"playback ended": "reproducción terminada",
+		"cannot play: %v": "no se puede reproducir: %v",
+		"playing %s": "reproduciendo %s",
+		"playing": "reproduciendo",
+		"paused": "en pausa",
+		"muted": "silenciado",
+		"space: pause • ←/→: seek 5s • shift+←/→: 1 min • +/-: volume • m: mute • S: stop": "espacio: pausa • ←/→: saltar 5s • shift+←/→: 1 min • +/-: volumen • m: silenciar • S: detener",
+		"%s is not downloaded yet": "%s aún no está descargado",
+		" (+%d lines)": " (+%d líneas)",
+		"Clipboard history": "Historial del portapapeles",
+		"cannot update clipboard history: %v": "no se puede actualizar el historial del portapapeles: %v",
+		"enter: copy again • p: paste into the editor or shell • x: remove • /: search • esc: close": "enter: copiar de nuevo • p: pegar en el editor o la shell • x: quitar • /: buscar • esc: cerrar",
+		"pasted into the editor": "pegado en el editor",
+		"pasted into the shell input": "pegado en la entrada de la shell",
+		"removed from clipboard history": "quitado del historial del portapapeles",
+		"%s needs parentheses": "%s necesita paréntesis",
+		"bad number %q": "número no válido %q",
+		"cannot convert %s to %s": "no se puede convertir %s en %s",
+		"division by zero": "división por cero",
+		"enter: go to %s": "enter: ir a %s",
+		"incomplete expression": "expresión incompleta",
+		"missing )": "falta )",
+		"result is not a number": "el resultado no es un número",
+		"unexpected %q": "%q inesperado",
+		"unknown name %q": "nombre desconocido %q",
+		"unknown unit %q": "unidad desconocida %q",
+		"length": "longitud",
+		"mass": "masa",
+		"volume": "volumen",
+		"temperature": "temperatura",
+		"calculation": "cálculo",
+		"%s has no MAC address": "%s no tiene dirección MAC",
+		"255.255.255.255, or the subnet broadcast address": "255.255.255.255, o la dirección de difusión de la subred",
+		"Hosts": "Equipos",
+		"IP or DNS name to ping": "IP o nombre DNS para el ping",
+		"New host": "Nuevo equipo",
+		"No hosts yet; n adds one.": "Aún no hay equipos; n añade uno.",
+		"a host needs a name": "un equipo necesita un nombre",
+		"bad MAC address %q": "dirección MAC no válida %q",
+		"cannot wake %s: %v": "no se puede despertar %s: %v",
+		"down": "caído",
+		"enter: ssh • p/P: ping one/all • W: wake-on-LAN • n/e/x: add/edit/remove • u: reload": "enter: ssh • p/P: ping a uno/todos • W: wake-on-LAN • n/e/x: añadir/editar/quitar • u: recargar",
+		"pinging %d hosts": "haciendo ping a %d equipos",
+		"pinging %s": "haciendo ping a %s",
+		"refreshed hosts": "equipos actualizados",
+		"remove %s from the hosts?": "¿quitar %s de los equipos?",
+		"removed %s": "%s quitado",
+		"saved %s": "%s guardado",
+		"sent a wake-up packet to %s (%s); p to check when it is up": "paquete de encendido enviado a %s (%s); p para comprobar si responde",
+		"ssh destination, e.g. an alias from ~/.ssh/config": "destino ssh, p. ej. un alias de ~/.ssh/config",
+		"ssh not found in PATH": "ssh no está en el PATH",
+		"tab/shift+tab: next/previous field • enter: save • esc: cancel": "tab/shift+tab: campo siguiente/anterior • enter: guardar • esc: cancelar",
+		"there is already a host named %s": "ya hay un equipo llamado %s",
+		"up": "activo",
+		"%s is up (%s)": "%s está activo (%s)",
+		"%s does not answer ping": "%s no responde al ping",
+		"ssh to %s ended: %v": "ssh a %s terminó: %v",
+		"ssh session to %s closed": "sesión ssh a %s cerrada",
+		"host address": "dirección del equipo",
+		"address": "dirección",
+		"MAC": "MAC",
+		"ssh": "ssh",
+		"broadcast": "difusión",
+		"ping not found in PATH": "ping no está en el PATH",
+		"cannot ping %s: %v": "no se puede hacer ping a %s: %v",
+		"%s failed: %s": "%s falló: %s",
+		"%s finished": "%s terminó",
+		"(ansible.cfg default)": "(predeterminado de ansible.cfg)",
+		"(running)": "(en ejecución)",
+		"Ansible: %s": "Ansible: %s",
+		"a playbook is already running": "ya hay un playbook en ejecución",
+		"ansible-playbook not found in PATH": "ansible-playbook no está en el PATH",
+		"enter: run • ←/→: playbooks, inventories, runs • T/L: tags/limit • c: check mode • u: rescan": "enter: ejecutar • ←/→: playbooks, inventarios, ejecuciones • T/L: tags/límite • c: modo de prueba • u: volver a buscar",
+		"found %d playbooks in %s": "%d playbooks encontrados en %s",
+		"limit (hosts or groups): ": "límite (equipos o grupos): ",
+		"no playbooks in %s": "no hay playbooks en %s",
+		"none": "ninguno",
+		"run %s?": "¿ejecutar %s?",
+		"running %s as %s": "ejecutando %s como %s",
+		"tags (comma separated): ": "tags (separados por comas): ",
+		"tags: %s • limit: %s • check mode: %v": "tags: %s • límite: %s • modo de prueba: %v",
+		"Playbooks": "Playbooks",
+		"Inventories": "Inventarios",
+		"Runs": "Ejecuciones",
+		"Ansible": "Ansible",
+		"kubernetes: %v": "kubernetes: %v",
+		"following the log of %s; esc stops": "siguiendo el log de %s; esc para",
+		"kubectl not found in PATH": "kubectl no está en el PATH",
+		"delete pod %s in %s/%s?": "¿borrar el pod %s en %s/%s?",
+		"cannot delete %s: %v": "no se puede borrar %s: %v",
+		"deleted pod %s": "pod %s borrado",
+		"contexts": "contextos",
+		"enter: namespaces • u: reload": "enter: namespaces • u: recargar",
+		"enter: pods • esc: back • u: reload": "enter: pods • esc: volver • u: recargar",
+		"enter: follow log • e: shell • x: delete • esc: back • u: reload": "enter: seguir log • e: shell • x: borrar • esc: volver • u: recargar",
+		"esc: stop following": "esc: dejar de seguir",
+		"loading...": "cargando...",
+		"no contexts in the kubeconfig": "no hay contextos en el kubeconfig",
+		"(current)": "(actual)",
+		"no pods in %s": "no hay pods en %s",
+		"NAME": "NOMBRE",
+		"READY": "LISTOS",
+		"STATUS": "ESTADO",
+		"RESTARTS": "REINICIOS",
+		"AGE": "EDAD",
+		"NODE": "NODO",
+		"log stream ended: %v": "el log terminó: %v",
+		"log stream ended": "el log terminó",
+		"shell in %s ended: %v": "la shell en %s terminó: %v",
+		"shell in %s closed": "shell en %s cerrada",
+		"%d to add, %d to change, %d to destroy": "%d a crear, %d a cambiar, %d a destruir",
+		"(%d of %d)": "(%d de %d)",
+		"Directory:": "Directorio:",
+		"No Terraform configurations under %s (set terraform_dir in config.json)": "No hay configuraciones de Terraform en %s (define terraform_dir en config.json)",
+		"No changes. The infrastructure matches the configuration.": "Sin cambios. La infraestructura coincide con la configuración.",
+		"Plan of %s (%s): %s": "Plan de %s (%s): %s",
+		"Plan: %s": "Plan: %s",
+		"apply of %s queued as %s; an admin approves it in the Requests tab": "apply de %s en cola como %s; un admin lo aprueba en la pestaña Requests",
+		"cannot queue the apply: %v": "no se puede encolar el apply: %v",
+		"cannot read the plan of %s: %v": "no se puede leer el plan de %s: %v",
+		"no changes: the infrastructure matches the configuration": "sin cambios: la infraestructura coincide con la configuración",
+		"p runs terraform plan here": "p ejecuta terraform plan aquí",
+		"plan first: there is nothing to apply": "primero haz un plan: no hay nada que aplicar",
+		"plan: %s": "plan: %s",
+		"planning %s...": "planificando %s...",
+		"planning...": "planificando...",
+		"queue terraform apply of %s for approval?": "¿encolar terraform apply de %s para aprobación?",
+		"terraform not found in PATH": "terraform no está en el PATH",
+		"terraform plan failed: %v": "terraform plan falló: %v",
+		"←/→: directory • p: plan • enter/space: expand • z: expand all • a: request apply • u: rescan": "←/→: directorio • p: plan • enter/espacio: expandir • z: expandir todo • a: pedir apply • u: reescanear",
+		"%d to create": "%d a crear",
+		"%d to update in place": "%d a actualizar en el sitio",
+		"%d to replace": "%d a reemplazar",
+		"%d to destroy": "%d a destruir",
+		"%d data sources to read": "%d data sources a leer",
+		"L: lock": "L: bloquear",
+		"New entry": "Nueva entrada",
+		"The vault is empty; n adds an entry.": "El vault está vacío; n añade una entrada.",
+		"The vault is locked. enter: type the master passphrase": "El vault está bloqueado. enter: escribe la contraseña maestra",
+		"There is no vault yet. enter: choose a master passphrase": "Aún no hay vault. enter: elige una contraseña maestra",
+		"an entry named %s exists": "ya existe una entrada llamada %s",
+		"an entry needs a name": "una entrada necesita un nombre",
+		"cannot create the vault: %v": "no se puede crear el vault: %v",
+		"cannot remove %s: %v": "no se puede quitar %s: %v",
+		"cannot unlock: %v": "no se puede desbloquear: %v",
+		"e.g. openai, referenced by agents": "p. ej. openai, usado por los agentes",
+		"passphrase: ": "contraseña: ",
+		"r: reveal • y: copy • n/e/x: add/edit/remove • L: lock": "r: mostrar • y: copiar • n/e/x: añadir/editar/quitar • L: bloquear",
+		"remove %s from the vault?": "¿quitar %s del vault?",
+		"repeat the passphrase": "repite la contraseña",
+		"the passphrases differ; try again": "las contraseñas no coinciden; inténtalo de nuevo",
+		"vault locked": "vault bloqueado",
+		"vault unlocked for this session": "vault desbloqueado para esta sesión",
+		"wrong passphrase, or the vault is damaged": "contraseña incorrecta, o el vault está dañado",
+		"secret": "secreto",
+		"value": "valor",
+		"length must be between 1 and 1024": "la longitud debe estar entre 1 y 1024",
+		"the character set needs at least two characters": "el conjunto de caracteres necesita al menos dos caracteres",
+		"the number of words must be between 1 and 64": "el número de palabras debe estar entre 1 y 64",
+		"no word list: %v (set password.wordlist in config.json)": "no hay lista de palabras: %v (define password.wordlist en config.json)",
+		"%s has only %d usable words": "%s solo tiene %d palabras utilizables",
+		"weak": "débil",
+		"fair": "aceptable",
+		"strong": "fuerte",
+		"very strong": "muy fuerte",
+		"%q is not a number": "%q no es un número",
+		"unknown character set %s (full, alnum, alpha, lower, hex, digits)": "conjunto de caracteres desconocido %s (full, alnum, alpha, lower, hex, digits)",
+		"= %s  (%.0f bits, %s; enter copies, any key makes another)": "= %s  (%.0f bits, %s; enter copia, cualquier tecla genera otra)",
+		"nothing to show as QR": "nada que mostrar como QR",
+		"cannot make a QR code: %v": "no se puede crear el código QR: %v",
+		"QR code of the %s (%d bytes)": "código QR de %s (%d bytes)",
+		"QR code of the %s": "código QR de %s",
+		"the QR code needs %dx%d cells: zoom the pane (alt+z) or enlarge the terminal": "el código QR necesita %dx%d celdas: amplía el panel (alt+z) o agranda la terminal",
+		"text": "texto",
+		"enter: show as QR code": "enter: mostrar como código QR",
+		"tab name, a calculation like 3*1024 MiB in GB, pw 24, b64 text, qr text": "nombre de pestaña, un cálculo como 3*1024 MiB in GB, pw 24, b64 texto, qr texto",
+		"%s of the %s": "%s de %s",
+		"= %s  (enter: copy and show)": "= %s  (enter: copiar y mostrar)",
+		"the result is binary (%d bytes), not text": "el resultado es binario (%d bytes), no texto",
+		"editor line %d": "línea %d del editor",
+		"clipboard": "portapapeles",
+		"input": "entrada",
+		"nothing to transform: type the text after %s": "nada que transformar: escribe el texto después de %s",
+		"result": "resultado",
+		"select a file to mark": "selecciona un archivo para marcar",
+		"unmarked %s": "%s desmarcado",
+		"marked %s: press D to diff": "%s marcado: pulsa D para comparar",
+		"marked %s: mark another file or press D on it": "%s marcado: marca otro archivo o pulsa D sobre él",
+		"mark two files with m, or one and select the other": "marca dos archivos con m, o uno y selecciona el otro",
+		"diff failed: %v": "falló la comparación: %v",
+		"%s and %s are identical": "%s y %s son idénticos",
+		"%d hunks: ]/[ next/previous, | unified/side by side, a/A apply to the first/second file, esc close": "%d hunks: ]/[ siguiente/anterior, | unificado/lado a lado, a/A aplicar al primer/segundo archivo, esc cerrar",
+		"hunk %d of %d": "hunk %d de %d",
+		"no more hunks": "no hay más hunks",
+		"hunk %d applied to %s, which is read-only": "hunk %d aplicado a %s, que es de solo lectura",
+		"hunk %d applied to %s: ctrl+s saves it": "hunk %d aplicado a %s: ctrl+s lo guarda",
+		"diff closed": "comparación cerrada",
+		"%s is a directory": "%s es un directorio",
+		"%s is too big to diff (%s)": "%s es demasiado grande para comparar (%s)",
+		"%s is a binary file": "%s es un archivo binario",
+		"left: %s\nright: %s": "izquierda: %s\nderecha: %s",
+		"marked: %s": "marcados: %s",
+		"hashing %s": "calculando suma de %s",
+		"hashing %s: %d%% (%s of %s), esc cancels": "calculando suma de %s: %d%% (%s de %s), esc cancela",
+		"no checksum given": "no se indicó ninguna suma",
+		"%q is not a SHA-256 or MD5 checksum": "%q no es una suma SHA-256 ni MD5",
+		"%s has no checksums": "%s no contiene sumas",
+		"still hashing: esc cancels": "aún calculando sumas: esc cancela",
+		"select a file or mark some with m": "selecciona un archivo o marca varios con m",
+		"OK": "OK",
+		"FAILED: expected %s": "FALLO: se esperaba %s",
+		"checked against %s:": "comprobado con %s:",
+		"cancelled after %d of %d files": "cancelado tras %d de %d archivos",
+		"✗ FAILED: %s": "✗ FALLO: %s",
+		"✓ %d of %d checksums match (%s)": "✓ %d de %d sumas coinciden (%s)",
+		"checksums of %d files: no expected value to check them against (V enters one)": "sumas de %d archivos: no hay valor esperado con el que comprobarlas (V introduce uno)",
+		"cancelling checksums": "cancelando sumas",
+		"expected SHA-256 or MD5: ": "SHA-256 o MD5 esperado: ",
+		"an expected value checks one file: unmark the others": "un valor esperado comprueba un solo archivo: desmarca los demás",
+		"the value entered": "el valor introducido",
+		"signing %s failed: %v": "falló la firma de %s: %v",
+		"gpg not found in PATH": "gpg no está en el PATH",
+		"no %s next to the signature": "no hay %s junto a la firma",
+		"verifying %s": "verificando %s",
+		"replace the signature %s?": "¿reemplazar la firma %s?",
+		"gpg gave no verdict": "gpg no dio ningún veredicto",
+		"ultimate (your own key)": "absoluta (tu propia clave)",
+		"full": "completa",
+		"marginal": "marginal",
+		"never: the key is marked untrusted": "nunca: la clave está marcada como no fiable",
+		"unknown: the key is not certified by a key you trust": "desconocida: la clave no está certificada por una clave de confianza",
+		"cannot verify %s: %v": "no se puede verificar %s: %v",
+		"good signature": "firma correcta",
+		"BAD signature: the file or the signature was altered": "firma INCORRECTA: el archivo o la firma se modificaron",
+		"good signature, but it has expired": "firma correcta, pero ha caducado",
+		"good signature, but the key has expired": "firma correcta, pero la clave ha caducado",
+		"good signature, but the key was revoked": "firma correcta, pero la clave fue revocada",
+		"cannot check the signature": "no se puede comprobar la firma",
+		"cannot check the signature: public key %s is not in your keyring (gpg --recv-keys %s)": "no se puede comprobar la firma: la clave pública %s no está en tu anillo (gpg --recv-keys %s)",
+		"Signature:": "Firma:",
+		"File:": "Archivo:",
+		"Result:": "Resultado:",
+		"Signer:": "Firmante:",
+		"Key:": "Clave:",
+		"Fingerprint:": "Huella:",
+		"Signed:": "Firmado:",
+		"Trust:": "Confianza:",
+		"gpg output:": "salida de gpg:",
+		"unknown": "desconocida",
+		"✓ good signature from %s (trust: %s)": "✓ firma correcta de %s (confianza: %s)",
+		"no age recipients: set age.recipients in config.json or create %s": "no hay destinatarios de age: define age.recipients en config.json o crea %s",
+		"no age recipients: set age.recipients in config.json": "no hay destinatarios de age: define age.recipients en config.json",
+		"%s already exists": "%s ya existe",
+		"no age identity: %v (set age.identity in config.json)": "no hay identidad de age: %v (define age.identity en config.json)",
+		"replace %s?": "¿reemplazar %s?",
+		"age: working on %d files": "age: procesando %d archivos",
+		"age wrote %s; failed: %s": "age escribió %s; fallaron: %s",
+		"age failed: %s": "age falló: %s",
+		"age wrote %s": "age escribió %s",
+		"scan directory: ": "directorio a analizar: ",
+		"still scanning": "aún analizando",
+		"%s is not a directory": "%s no es un directorio",
+		"scanning %s: %d items, %s": "analizando %s: %d elementos, %s",
+		"scanned %s: %s in %d items (%s)": "analizado %s: %s en %d elementos (%s)",
+		"delete %s (%s)?": "¿borrar %s (%s)?",
+		"delete failed: %v (r rescans)": "falló el borrado: %v (r vuelve a analizar)",
+		"deleted %s, freeing %s": "borrado %s, liberados %s",
+		"Scanning %s: %d items, %s": "Analizando %s: %d elementos, %s",
+		"s scans a directory (the Files directory by default)": "s analiza un directorio (por defecto el de Archivos)",
+		"%s  %s in %d items": "%s  %s en %d elementos",
+		"(some of it could not be read)": "(parte no se pudo leer)",
+		"enter/esc: down/up • d: delete • x: export JSON • D: duplicates • s: scan another directory • r: rescan": "enter/esc: entrar/subir • d: borrar • x: exportar JSON • D: duplicados • s: analizar otro directorio • r: volver a analizar",
+		"(empty)": "(vacío)",
+		"scan a directory first (s)": "analiza primero un directorio (s)",
+		"hashing %s: %d%% of %s": "calculando el hash de %s: %d%% de %s",
+		"duplicate search cancelled": "búsqueda de duplicados cancelada",
+		"%d sets of duplicates, %s reclaimable": "%d grupos de duplicados, %s recuperables",
+		"delete %s, a copy of %d other files?": "¿borrar %s, copia de otros %d archivos?",
+		"replace the %d other copies with hard links to %s?": "¿sustituir las otras %d copias por enlaces duros a %s?",
+		"linked to %s, freeing %s": "enlazado a %s, liberando %s",
+		"linking failed: %s": "falló el enlace: %s",
+		"Looking for duplicates: hashing %s (%d%% of %s), esc cancels": "Buscando duplicados: calculando el hash de %s (%d%% de %s), esc cancela",
+		"Duplicates under %s: %d sets, %s reclaimable": "Duplicados en %s: %d grupos, %s recuperables",
+		"d: delete copy • L: hard-link the other copies to this one • esc: back to sizes": "d: borrar copia • L: enlazar las otras copias a esta • esc: volver a los tamaños",
+		"No duplicate files.": "No hay archivos duplicados.",
+		"%s × %d, %s reclaimable  sha256 %s…": "%s × %d, %s recuperables  sha256 %s…",
+		"marked %s: %d files marked": "%s marcado: %d archivos marcados",
+		"find (regexp, empty = whole name): ": "buscar (regexp, vacío = nombre entero): ",
+		"replace with: ": "sustituir por: ",
+		"invalid name": "nombre no válido",
+		"same name as #%d": "mismo nombre que el n.º %d",
+		"exists": "ya existe",
+		"bad pattern: %v": "patrón incorrecto: %v",
+		"cannot rename %s: %s": "no se puede renombrar %s: %s",
+		"no name changes": "ningún nombre cambia",
+		"rename failed, nothing was renamed: %v": "falló el renombrado, no se renombró nada: %v",
+		"renamed %d files": "%d archivos renombrados",
+		"case: %s • tab: switch field • ctrl+t: case • enter: rename • esc: cancel • {n}/{nnn}: counter, {name}/{ext}: name parts, $1: group": "mayúsculas: %s • tab: cambiar de campo • ctrl+t: mayúsculas • enter: renombrar • esc: cancelar • {n}/{nnn}: contador, {name}/{ext}: partes del nombre, $1: grupo",
+		"keep": "sin cambios",
+		"lower": "minúsculas",
+		"upper": "mayúsculas",
+		"title": "tipo título",
+		"… and %d more": "… y %d más",
+		"%d names cannot be applied": "%d nombres no se pueden aplicar",
+		"tags for %d files (wip -draft removes draft): ": "etiquetas de %d archivos (wip -draft quita draft): ",
+		"tags for %s (wip -draft removes draft): ": "etiquetas de %s (wip -draft quita draft): ",
+		"show files tagged (empty shows all): ": "mostrar archivos con la etiqueta (vacío muestra todos): ",
+		"tag filter cleared": "filtro de etiqueta quitado",
+		"%d files tagged %s": "%d archivos con la etiqueta %s",
+		"tags not saved: %v": "etiquetas no guardadas: %v",
+		"tagged %d files": "%d archivos etiquetados",
+		"(missing)": "(no existe)",
+		"Tags": "Etiquetas",
+		"refreshed tags": "etiquetas recargadas",
+		"%s no longer exists (x removes the tag)": "%s ya no existe (x quita la etiqueta)",
+		"removed #%s from %s": "#%s quitada de %s",
+		"edited": "editado",
+		"viewed": "visto",
+		"previewed": "previsualizado",
+		"at the start of the jump list": "al principio de la lista de saltos",
+		"at the end of the jump list": "al final de la lista de saltos",
+		"jump %d of %d: %s": "salto %d de %d: %s",
+		"%s no longer exists": "%s ya no existe",
+		"Recent files": "Archivos recientes",
+		"enter: open as before • E: edit • f: show in Files • x: remove • /: search • esc: close": "enter: abrir como antes • E: editar • f: mostrar en Files • x: quitar • /: buscar • esc: cerrar",
+		"%s no longer exists (x removes it)": "%s ya no existe (x lo quita)",
+		"cannot update recent files: %v": "no se pueden actualizar los archivos recientes: %v",
+		"removed from recent files": "quitado de los archivos recientes",
+		"opened": "abierto",
+		"no opener for %s: add one under openers in config.json": "no hay con qué abrir %s: añade un programa en openers de config.json",
+		"no opener for %s is installed (tried %s): install one or set openers in config.json": "no hay instalado ningún programa para abrir %s (probados: %s): instala uno o configura openers en config.json",
+		"cannot open %s: %v": "no se puede abrir %s: %v",
+		"opened %s with %s": "%s abierto con %s",
+		"closed %s": "%s cerrado",
+		"select a file to open": "selecciona un archivo para abrir",
+		"nothing to page": "no hay nada que paginar",
+		"cannot page: %v": "no se puede paginar: %v",
+		"pager failed: %v": "falló el paginador: %v",
+		"read-only session: browsing, previews and the audit log only": "sesión de solo lectura: solo navegar, vistas previas y el registro de auditoría",
+		"read-only must be yes or no": "solo lectura debe ser sí o no",
+		"yes: browse only, no edits, shell, exec or approvals": "sí: solo navegar, sin ediciones, shell, ejecución ni aprobaciones",
+		"agent time quota reached (%s of %s used)": "cuota de tiempo de agentes agotada (%s de %s usados)",
+		"%s of the %s agent time quota used": "usados %s de la cuota de %s de tiempo de agentes",
+		"agent time quota reached: stopped %s": "cuota de tiempo de agentes agotada: se detuvo %s",
+		"shell quota reached (%d commands an hour); next one at %s": "cuota de shell agotada (%d comandos por hora); el siguiente a las %s",
+		"%d of %d shell commands this hour": "%d de %d comandos de shell en esta hora",
+		"Connections": "Conexiones",
+		"login": "acceso",
+		"auth_failed": "fallo de autenticación",
+		"banned": "bloqueada",
+		"as %s": "como %s",
+		"filter: ": "filtro: ",
+		"bad time %q: use 2h, 7d, 2006-01-02 or 2006-01-02T15:04": "hora no válida %q: use 2h, 7d, 2006-01-02 o 2006-01-02T15:04",
+		"unknown filter %s: use user=, ip=, event=, since= or until=": "filtro desconocido %s: use user=, ip=, event=, since= o until=",
+		"Connections: %d logins, %d failed, %d bans, %d invites": "Conexiones: %d accesos, %d fallidos, %d bloqueos, %d invitaciones",
+		"refreshed connections": "conexiones actualizadas",
+		"output": "salida",
+		"describe the agent: ": "describe el agente: ",
+		"e.g. report the five largest directories under /var and their growth since yesterday": "p. ej. informar de los cinco directorios más grandes de /var y su crecimiento desde ayer",
+		"drafting an agent...": "generando un agente...",
+		"the model did not answer with a manifest entry and a script": "el modelo no respondió con una entrada de manifiesto y un script",
+		"the manifest entry is not JSON: %v": "la entrada de manifiesto no es JSON: %v",
+		"agent draft failed: %v": "falló el borrador del agente: %v",
+		"review the draft: ctrl+s adds the agent, ctrl+q drops it": "revisa el borrador: ctrl+s añade el agente, ctrl+q lo descarta",
+		"the draft lost its %q line": "el borrador perdió su línea %q",
+		"the draft has no script": "el borrador no tiene script",
+		"the agent needs a name of letters, digits, '.', '_' and '-'": "el agente necesita un nombre de letras, dígitos, '.', '_' y '-'",
+		"agent %s already exists": "el agente %s ya existe",
+		"a crew is named %s": "ya hay un equipo llamado %s",
+		"the entry must be a path inside %s": "la entrada debe ser una ruta dentro de %s",
+		"add agent %s: write %s and add it to manifest.json?": "¿añadir el agente %s: escribir %s y añadirlo a manifest.json?",
+		"cannot add agent %s: %v": "no se puede añadir el agente %s: %v",
+		"added agent %s": "agente %s añadido",
+		"dropped the agent draft": "borrador de agente descartado",
+		"draft agent for %q: ctrl+s adds it, ctrl+q drops it": "borrador de agente para %q: ctrl+s lo añade, ctrl+q lo descarta",
+		"the model did not answer with a command": "el modelo no respondió con un comando",
+		"asking for a command: %s": "pidiendo un comando: %s",
+		"no suggestion: %v": "sin sugerencia: %v",
+		"run the suggested command?": "¿ejecutar el comando sugerido?",
+		"No keeps it in the prompt to edit.": "No lo deja en la línea para editarlo.",
+		"audit filter failed: %v": "falló el filtro de auditoría: %v",
+		"%d entries match, newest first": "%d entradas coinciden, las más recientes primero",
+		"the latest %d matching entries, newest first": "las últimas %d entradas que coinciden, las más recientes primero",
+		"request filter failed: %v": "falló el filtro de solicitudes: %v",
+		"%d matching %s": "%d coinciden con %s",
+		"filter: %s (/ to change, esc in it to clear)": "filtro: %s (/ para cambiarlo, esc en él para quitarlo)",
+		"request %s is already %s": "la solicitud %s ya está %s",
+		"Yes": "Sí",
+		"Type %s to confirm.": "Escribe %s para confirmar.",
+		"type %s to confirm, or esc to cancel": "escribe %s para confirmar, o esc para cancelar",
+		"enter: confirm · esc: cancel": "enter: confirmar · esc: cancelar",
+		"up/down or 1-9, enter: choose · esc: cancel": "arriba/abajo o 1-9, enter: elegir · esc: cancelar",
+		"y/n, or left/right and enter · esc: cancel": "s/n, o izquierda/derecha y enter · esc: cancelar",
+		"Dialog: %s": "Diálogo: %s",
+		"agent: %s\nrequested by %s at %s": "agente: %s\nsolicitado por %s el %s",
+		"notes: %s": "notas: %s",
+		"Approving runs %s with --exec now.": "Aprobar ejecuta %s con --exec ahora.",
+		"Approving applies the saved Terraform plan in %s now.": "Aprobar aplica ahora el plan de Terraform guardado en %s.",
+		"Approve request %s?": "¿Aprobar la solicitud %s?",
+		"Deny request %s?": "¿Denegar la solicitud %s?",
+		"reason (optional)": "motivo (opcional)",
+		"delete the %d marked files": "borrar los %d archivos marcados",
+		"delete only %s": "borrar solo %s",
+		"cancel": "cancelar",
+		"Delete which files?": "¿Qué archivos borrar?",
+		"and %d more": "y %d más",
+		"Delete %s?": "¿Borrar %s?",
+		"%s\n%s, modified %s": "%s\n%s, modificado %s",
+		"Delete the empty directory %s?": "¿Borrar el directorio vacío %s?",
+		"Delete the directory %s and everything in it?": "¿Borrar el directorio %s y todo su contenido?",
+		"%s holds %d entries.": "%s contiene %d entradas.",
+		"deleted %d of %d: %v": "borrados %d de %d: %v",
+		"deleted %s": "%s borrado",
+		"deleted %d files": "%d archivos borrados",
+		"Disable plugin %s?": "¿Desactivar el plugin %s?",
+		"New shells no longer source its init.sh or have its bin directory on PATH; shells already open keep them.": "Las shells nuevas ya no cargan su init.sh ni tienen su directorio bin en el PATH; las shells abiertas los conservan.",
+		"enabled plugin %s": "plugin %s activado",
+		"disabled plugin %s": "plugin %s desactivado",
+		"Run %s with --exec?": "¿Ejecutar %s con --exec?",
+		"%s\n\nWith --exec the agent acts for real; r dry-runs it instead.": "%s\n\nCon --exec el agente actúa de verdad; r lo ejecuta en seco.",
+		"%s: %s in %d entries.": "%s: %s en %d entradas.",
+		"My requests (%s)": "Mis solicitudes (%s)",
+		"History": "Historial", "Raw JSON": "JSON sin procesar", "created": "creada", "commented": "comentada",
+		"comment: ": "comentario: ", "comment failed: %v": "no se pudo comentar: %v", "commented on request %s": "comentario añadido a la solicitud %s",
+		"name": "nombre", "size": "tamaño", "modified": "modificado", "permissions": "permisos", "owner": "propietario",
+		"detail view": "vista detallada", "compact view": "vista compacta", "sorted by %s": "ordenado por %s", "sorted by %s, descending": "ordenado por %s, descendente",
+		"-- INSERT --": "-- INSERTAR --", "-- NORMAL --": "-- NORMAL --", "unknown command: %s": "comando desconocido: %s",
+		"/%s: line %d": "/%s: línea %d", "pattern not found: %s": "patrón no encontrado: %s",
+		"preview failed: %v": "no se pudo previsualizar: %v", "reloaded %s": "%s recargado",
+		"viewing (read-only): %s": "viendo (solo lectura): %s", "%s is not writable": "%s no se puede escribir", "read-only": "solo lectura",
+		"read-only: %s was not saved (alt+w to edit)": "solo lectura: %s no se guardó (alt+w para editar)", "read-only: %s (alt+w to edit)": "solo lectura: %s (alt+w para editar)",
+		" RO ": " SL ", "%s is read-only; alt+w to edit": "%s es de solo lectura; alt+w para editar", "(read-only)": "(solo lectura)",
+		"%c at %d:%d has no match": "%c en %d:%d no tiene pareja", "match %d:%d ": "pareja %d:%d ", "no matching bracket": "no hay corchete correspondiente",
+		"killed %d of %d stale sessions": "terminadas %d de %d sesiones inactivas", "session ended: %v": "la sesión terminó: %v",
+		"term %s is up to date": "term %s está actualizado",
+		"term %s is available (installed: %s)": "term %s está disponible (instalado: %s)",
+		"updated %s from %s to %s": "%s actualizado de %s a %s",
+		"editor buffer is empty":          "el búfer del editor está vacío",
+		"run failed: %v":                  "no se pudo ejecutar: %v",
+		"running %s as %s; output appears beside the editor when it finishes": "ejecutando %s como %s; la salida aparecerá junto al editor al terminar",
+		"Running %s (%s)...\n":            "Ejecutando %s (%s)...\n",
+		"workspace %d: %s":                                      "espacio de trabajo %d: %s",
+		"Tab %d of %d: %s":       "Pestaña %d de %d: %s",
+		", workspace %d of %d":   ", espacio de trabajo %d de %d",
+		"Status: %s":             "Estado: %s",
+		"Keys: %s":               "Teclas: %s",
+		"path": "ruta", "request id": "id de solicitud", "viewport": "visor", "last output": "última salida", "download URL": "URL de descarga",
+	},
+}
+
+// setLocale picks the UI language from the config value, falling back to
+// LC_ALL/LC_MESSAGES/LANG, and to English when no catalog matches.
+func setLocale(configured string) {
+	locale = "en"
+	for _, v := range []string{configured, os.Getenv("LC_ALL"), os.Getenv("LC_MESSAGES"), os.Getenv("LANG")} {
+		if v == "" { continue }
+		// de_DE.UTF-8 -> de
+		parts := strings.FieldsFunc(v, func(r rune) bool { return r == '_' || r == '.' || r == '-' || r == '@' })
+		if len(parts) == 0 { continue }
+		lang := strings.ToLower(parts[0])
+		if _, ok := catalogs[lang]; ok || lang == "en" { locale = lang; return }
+		if lang != "c" && lang != "posix" { return }
+	}
+}
+
+// T translates msgid into the active locale and formats it with args, if any
+func T(msgid string, args ...interface{}) string {
+	msg := msgid
+	if c, ok := catalogs[locale]; ok {
+		if tr, ok := c[msgid]; ok { msg = tr }
+	}
+	if len(args) == 0 { return msg }
+	return fmt.Sprintf(msg, args...)
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// The Image tab shows the images in the Files cwd as a grid of thumbnails drawn with
+// half-block characters: each cell is two pixels, the upper half in the foreground
+// color and the lower in the background, so it works in any truecolor terminal.
+
+const (
+	thumbCols = 16 // thumbnail width in cells
+	thumbRows = 8  // thumbnail height in cells, each two pixels tall
+	thumbGap  = 2  // cells between thumbnails
+)
+
+var imageExts = map[string]bool{".png": true, ".jpg": true, ".jpeg": true, ".gif": true}
+
+type imageThumb struct {
+	path, name string
+	w, h       int      // size of the image in pixels
+	lines      []string // rendered thumbnail, thumbRows lines of thumbCols cells
+	err        error
+}
+
+// imageGrid is the Image tab: the thumbnails of dir, or the selected image full-size
+type imageGrid struct {
+	dir     string
+	thumbs  []imageThumb
+	sel     int
+	loading bool
+	cols    int    // thumbnails per row at the last render, for up and down
+	full    bool   // enter: the selected image fills the tab
+	fullKey string // path and size of the cached full-size rendering
+	fullOut string
+}
+
+type imageThumbsMsg struct {
+	dir    string
+	thumbs []imageThumb
+}
+
+// loadImageGrid starts rendering the thumbnails of the cwd when the Image tab is
+// shown and has none for it yet
+func (m *model) loadImageGrid() tea.Cmd {
+	if m.tabs[m.active] != "Image" || m.images != nil && m.images.dir == m.cwd { return nil }
+	m.images = &imageGrid{dir: m.cwd, loading: true}
+	dir, plain := m.cwd, m.plain
+	return func() tea.Msg { return imageThumbsMsg{dir: dir, thumbs: loadThumbs(dir, plain)} }
+}
+
+func loadThumbs(dir string, plain bool) []imageThumb {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil { return nil }
+	var out []imageThumb
+	for _, e := range entries {
+		if e.IsDir() || !imageExts[strings.ToLower(filepath.Ext(e.Name()))] { continue }
+		t := imageThumb{path: filepath.Join(dir, e.Name()), name: e.Name()}
+		img, err := decodeImage(t.path)
+		if err != nil {
+			t.err = err
+		} else {
+			t.w, t.h = img.Bounds().Dx(), img.Bounds().Dy()
+			if !plain { t.lines = renderBlocks(img, thumbCols, thumbRows) }
+		}
+		out = append(out, t)
+	}
+	return out
+}
+
+func decodeImage(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil { return nil, err }
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	return img, err
+}
+
+// renderBlocks draws img into at most cols x rows cells, keeping its aspect ratio.
+// Each pixel averages up to 8x8 of the source pixels it covers. Lines are padded to cols.
+func renderBlocks(img image.Image, cols, rows int) []string {
+	b := img.Bounds()
+	if b.Dx() == 0 || b.Dy() == 0 { return nil }
+	pw, ph := cols, rows*2
+	if b.Dx()*ph > b.Dy()*pw { ph = max(1, b.Dy()*pw/b.Dx()) } else { pw = max(1, b.Dx()*ph/b.Dy()) }
+	px := func(x, y int) (r, g, bl uint64) {
+		x0, x1 := b.Min.X+x*b.Dx()/pw, b.Min.X+(x+1)*b.Dx()/pw
+		y0, y1 := b.Min.Y+y*b.Dy()/ph, b.Min.Y+(y+1)*b.Dy()/ph
+		if x1 == x0 { x1++ }
+		if y1 == y0 { y1++ }
+		var n uint64
+		for yy := y0; yy < y1; yy += max(1, (y1-y0)/8) {
+			for xx := x0; xx < x1; xx += max(1, (x1-x0)/8) {
+				cr, cg, cb, _ := img.At(xx, yy).RGBA()
+				r, g, bl, n = r+uint64(cr), g+uint64(cg), bl+uint64(cb), n+1
+			}
+		}
+		return r / n >> 8, g / n >> 8, bl / n >> 8
+	}
+	lines := make([]string, 0, (ph+1)/2)
+	for y := 0; y < ph; y += 2 {
+		var s strings.Builder
+		for x := 0; x < pw; x++ {
+			r, g, bl := px(x, y)
+			fmt.Fprintf(&s, "\x1b[38;2;%d;%d;%dm", r, g, bl)
+			if y+1 < ph {
+				r, g, bl = px(x, y+1)
+				fmt.Fprintf(&s, "\x1b[48;2;%d;%d;%dm", r, g, bl)
+			}
+			s.WriteString("▀\x1b[0m")
+		}
+		s.WriteString(strings.Repeat(" ", cols-pw))
+		lines = append(lines, s.String())
+	}
+	return lines
+}
+
+// updateImageGrid handles the Image tab keys: arrows or hjkl move, enter opens the
+// selected image full-size, esc or enter goes back to the grid and r rereads the cwd
+func (m *model) updateImageGrid(key string) bool {
+	g := m.images
+	if key == "r" && g != nil && !g.loading { m.images = nil; return true }
+	if g == nil || len(g.thumbs) == 0 { return false }
+	if g.full {
+		if key == "esc" || key == "enter" { g.full = false; return true }
+		return false
+	}
+	cols := max(g.cols, 1)
+	switch key {
+	case "left", "h":
+		if g.sel > 0 { g.sel-- }
+	case "right", "l":
+		if g.sel < len(g.thumbs)-1 { g.sel++ }
+	case "up", "k":
+		if g.sel >= cols { g.sel -= cols }
+	case "down", "j":
+		g.sel = min(g.sel+cols, len(g.thumbs)-1)
+	case "home", "g":
+		g.sel = 0
+	case "end", "G":
+		g.sel = len(g.thumbs) - 1
+	case "enter":
+		t := g.thumbs[g.sel]
+		if t.err != nil { m.status = T("cannot show %s: %v", t.name, t.err); return true }
+		g.full = true
+		m.status = T("%s: %dx%d", t.name, t.w, t.h)
+	default:
+		return false
+	}
+	return true
+}
+
+// imageView renders the Image tab in w x h cells
+func (m model) imageView(w, h int) string {
+	g := m.images
+	if g == nil || g.loading { return T("loading thumbnails of %s...", m.cwd) + "\n" }
+	if len(g.thumbs) == 0 { return T("no images (png, jpeg, gif) in %s", g.dir) + "\n" }
+	if g.full { return g.fullView(w, h, m.plain) }
+	if m.plain {
+		var b strings.Builder
+		for i, t := range g.thumbs {
+			marker := "  "
+			if i == g.sel { marker = "> " }
+			if t.err != nil { fmt.Fprintf(&b, "%s%s - %v\n", marker, t.name, t.err); continue }
+			fmt.Fprintf(&b, "%s%s - %dx%d\n", marker, t.name, t.w, t.h)
+		}
+		return b.String()
+	}
+	// the grid keeps the selected row in view; the column count is kept for up/down
+	cols := max(1, (w+thumbGap)/(thumbCols+thumbGap))
+	g.cols = cols
+	visible := max(1, h/(thumbRows+1))
+	first := 0
+	if row := g.sel / cols; row >= visible { first = row - visible + 1 }
+	var b strings.Builder
+	for row := first; row < first+visible && row*cols < len(g.thumbs); row++ {
+		cells := g.thumbs[row*cols : min((row+1)*cols, len(g.thumbs))]
+		for line := 0; line <= thumbRows; line++ {
+			for i, t := range cells {
+				if i > 0 { b.WriteString(strings.Repeat(" ", thumbGap)) }
+				switch {
+				case line == thumbRows:
+					name := truncateCells(t.name, thumbCols)
+					pad := strings.Repeat(" ", thumbCols-len([]rune(name)))
+					if row*cols+i == g.sel { name = activeTabStyle.Reverse(true).Render(name) } else { name = helpStyle.Render(name) }
+					b.WriteString(name + pad)
+				case line < len(t.lines):
+					b.WriteString(t.lines[line])
+				case t.err != nil && line == thumbRows/2:
+					fmt.Fprintf(&b, "%-*s", thumbCols, truncateCells(T("unreadable"), thumbCols))
+				default:
+					b.WriteString(strings.Repeat(" ", thumbCols))
+				}
+			}
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+// fullView renders the selected image as large as the tab allows, once per size
+func (g *imageGrid) fullView(w, h int, plain bool) string {
+	t := g.thumbs[g.sel]
+	if plain { return T("%s - %dx%d; esc returns to the list", t.name, t.w, t.h) + "\n" }
+	key := fmt.Sprintf("%s %dx%d", t.path, w, h)
+	if key != g.fullKey {
+		img, err := decodeImage(t.path)
+		if err != nil { return T("cannot show %s: %v", t.name, err) + "\n" }
+		g.fullKey, g.fullOut = key, strings.Join(renderBlocks(img, w, max(1, h-1)), "\n")
+	}
+	return g.fullOut + "\n" + helpStyle.Render(T("%s - %dx%d; esc returns to the grid", t.name, t.w, t.h))
+}
+
+// truncateCells shortens s to n runes, marking the cut with an ellipsis
+func truncateCells(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n { return s }
+	return string(r[:n-1]) + "…"
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// invite is a one-time token an admin hands to a new user. wish-server lets the
+// token in as a password once, asks for a public key and files it as a pending
+// entry. Only the hash of the token is kept.
+type invite struct {
+	Hash    string     `json:"hash"`
+	By      string     `json:"by"`
+	Created time.Time  `json:"created"`
+	Expires time.Time  `json:"expires"`
+	UsedBy  string     `json:"used_by,omitempty"`
+	Used    *time.Time `json:"used,omitempty"`
+}
+
+// pendingEntry is a key submitted with an invite, waiting for an admin to approve it
+type pendingEntry struct {
+	User      string    `json:"user"`
+	PubKey    string    `json:"pubkey"`
+	Invite    string    `json:"invite"` // hash of the invite it came with
+	Requested time.Time `json:"requested"`
+	Remote    string    `json:"remote,omitempty"`
+}
+
+// inviteTTL is how long an invite can be redeemed
+const inviteTTL = 24 * time.Hour
+
+// invitesPath and pendingPath sit next to the allowlist, where wish-server finds them
+func invitesPath(allowPath string) string { return filepath.Join(filepath.Dir(allowPath), "invites.json") }
+
+func pendingPath(allowPath string) string { return filepath.Join(filepath.Dir(allowPath), "pending_allowlist.json") }
+
+func inviteHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// readJSONFile decodes path into v; a missing file leaves v alone
+func readJSONFile(path string, v interface{}) error {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) { return nil }
+	if err != nil { return err }
+	if err := json.Unmarshal(b, v); err != nil { return fmt.Errorf("%s: %w", path, err) }
+	return nil
+}
+
+func writeJSONFile(path string, v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil { return err }
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, append(b, '\n'), 0o600); err != nil { return err }
+	return os.Rename(tmp, path)
+}
+
+func loadInvites(allowPath string) ([]invite, error) {
+	var invs []invite
+	return invs, readJSONFile(invitesPath(allowPath), &invs)
+}
+
+func loadPending(allowPath string) ([]pendingEntry, error) {
+	var pend []pendingEntry
+	return pend, readJSONFile(pendingPath(allowPath), &pend)
+}
+
+// newInvite stores a new invite and returns its token, which is not kept anywhere.
+// Invites that expired unused are dropped on the way.
+func newInvite(allowPath string) (string, error) {
+	if !isAdmin() { return "", errors.New(T("Admin privileges required")) }
+	if readOnlySession() { return "", errReadOnly }
+	token, err := randomToken()
+	if err != nil { return "", err }
+	now := time.Now().UTC()
+	err = withLock("invites", func() error {
+		invs, err := loadInvites(allowPath)
+		if err != nil { return err }
+		keep := []invite{}
+		for _, inv := range invs {
+			if inv.UsedBy != "" || now.Before(inv.Expires) { keep = append(keep, inv) }
+		}
+		keep = append(keep, invite{Hash: inviteHash(token), By: transferUser(), Created: now, Expires: now.Add(inviteTTL)})
+		return writeJSONFile(invitesPath(allowPath), keep)
+	})
+	return token, err
+}
+
+// dropPending removes the pending entry of user that came with the invite hash
+func dropPending(allowPath, user, hash string) error {
+	if !isAdmin() { return errors.New(T("Admin privileges required")) }
+	if readOnlySession() { return errReadOnly }
+	return withLock("invites", func() error {
+		pend, err := loadPending(allowPath)
+		if err != nil { return err }
+		keep := []pendingEntry{}
+		for _, p := range pend {
+			if p.User != user || p.Invite != hash { keep = append(keep, p) }
+		}
+		if len(keep) == len(pend) { return errors.New(T("the request of %s is gone", user)) }
+		return writeJSONFile(pendingPath(allowPath), keep)
+	})
+}
+
+// renderInvite is what the admin passes on to the new user
+func renderInvite(token string) string {
+	host := transferHost()
+	return T("Invite token (shown once, valid for %d hours):", int(inviteTTL.Hours())) + "\n\n  " + token + "\n\n" +
+		T("The new user connects with the name they want and gives the token as the password, then pastes their public key, or runs:") + "\n\n" +
+		fmt.Sprintf("  ssh -p 8022 NEWUSER@%s < ~/.ssh/id_ed25519.pub\n\n", host) +
+		T("The key shows up as pending in the Admin tab: a approves it, e edits it first, x rejects it.") + "\n"
+}
+
+// renderInvites lists the invites with their state
+func renderInvites(invs []invite) string {
+	if len(invs) == 0 { return T("No invites.") + "\n" }
+	var b strings.Builder
+	b.WriteString(T("Invites") + "\n\n")
+	now := time.Now()
+	for _, inv := range invs {
+		state := T("open until %s", inv.Expires.Local().Format("2006-01-02 15:04"))
+		switch {
+		case inv.UsedBy != "" && inv.Used != nil:
+			state = T("used by %s at %s", inv.UsedBy, inv.Used.Local().Format("2006-01-02 15:04"))
+		case now.After(inv.Expires):
+			state = T("expired")
+		}
+		fmt.Fprintf(&b, "  %s  %-10s %s  %s\n", inv.Hash[:12], inv.By, inv.Created.Local().Format("2006-01-02 15:04"), state)
+	}
+	return b.String()
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/bubbles/list"
+)
+
+// maxRunningJobs bounds concurrently running agent jobs; the rest stay queued
+const maxRunningJobs = 4
+
+// job states
+const (
+	JobQueued   = "queued"
+	JobRunning  = "running"
+	JobFinished = "finished"
+	JobLost     = "lost" // process vanished without recording an exit code
+)
+
+// job is one agent run persisted in jobs.json so it survives TUI/wish-server restarts.
+// The process writes its exit code to <id>.exit, which lets any later instance
+// reconcile jobs it did not start itself.
+type job struct {
+	ID       string   `json:"id"`
+	Agent    string   `json:"agent"`
+	Exec     bool     `json:"exec"`
+	User     string   `json:"user,omitempty"`
+	State    string   `json:"state"`
+	PID      int      `json:"pid,omitempty"`
+	Queued   string   `json:"queued"`
+	Started  string   `json:"started,omitempty"`
+	Finished string   `json:"finished,omitempty"`
+	Exit     int      `json:"exit"`
+	Log      string   `json:"log"`
+	Script   string   `json:"script,omitempty"` // run with bash instead of an agent (editor buffers)
+	Env      []string `json:"env,omitempty"`    // extra variables, e.g. the file a watch rule matched
+}
+
+// jobItem implements list.Item for the Jobs tab
+type jobItem struct{ j job }
+
+func (i jobItem) Title() string { return fmt.Sprintf("%s [%s]", i.j.Agent, i.j.State) }
+func (i jobItem) Description() string {
+	d := i.j.ID + " queued " + i.j.Queued
+	if i.j.State == JobFinished { d += fmt.Sprintf(" exit=%d", i.j.Exit) }
+	return d
+}
+func (i jobItem) FilterValue() string { return i.j.Agent + " " + i.j.State }
+
+// jobsTickMsg asks the model to reconcile job state
+type jobsTickMsg struct{}
+
+func jobsDir() string  { return filepath.Join(tuiDataDir(), "jobs") }
+func jobsPath() string { return filepath.Join(tuiDataDir(), "jobs.json") }
+
+// withLock runs fn while holding an exclusive flock on ~/.bash_functions_d/locks/<name>.lock,
+// the same lock directory approve_request.sh uses.
+func withLock(name string, fn func() error) error {
+	home, _ := os.UserHomeDir()
+	dir := filepath.Join(home, ".bash_functions_d", "locks")
+	if err := os.MkdirAll(dir, 0o700); err != nil { return err }
+	f, err := os.OpenFile(filepath.Join(dir, name+".lock"), os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil { return err }
+	defer f.Close()
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil { return err }
+	defer syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+	return fn()
+}
+
+func loadJobs() []job {
+	var jobs []job
+	if b, err := ioutil.ReadFile(jobsPath()); err == nil { _ = json.Unmarshal(b, &jobs) }
+	return jobs
+}
+
+func saveJobs(jobs []job) error {
+	b, err := json.MarshalIndent(jobs, "", "  ")
+	if err != nil { return err }
+	tmp := jobsPath() + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0o600); err != nil { return err }
+	return os.Rename(tmp, jobsPath())
+}
+
+// enqueueJob records a new queued agent job and starts it if a slot is free
+func enqueueJob(agent string, execFlag bool, user string) (job, error) {
+	return enqueue(job{Agent: agent, Exec: execFlag, User: user})
+}
+
+// enqueueScript queues a bash script as a job; name is what the Jobs tab and audit
+// log show in place of an agent name
+func enqueueScript(name, script, user string) (job, error) {
+	return enqueue(job{Agent: name, Exec: true, User: user, Script: script})
+}
+
+func enqueue(j job) (job, error) {
+	now := time.Now()
+	j.ID, j.State, j.Queued = fmt.Sprintf("job-%d", now.UnixNano()), JobQueued, now.Format(time.RFC3339)
+	j.Log = filepath.Join(jobsDir(), j.ID+".log")
+	var started []job
+	err := withLock("jobs", func() error {
+		jobs := append(loadJobs(), j)
+		started = dispatchJobs(jobs)
+		return saveJobs(jobs)
+	})
+	if err == nil {
+		emitJobEvent(j)
+		for _, s := range started { emitJobEvent(s) }
+	}
+	return j, err
+}
+
+// startJobProcess launches a queued job detached from the TUI session so it keeps
+// running if the TUI exits; stdout/stderr go to the job log.
+func startJobProcess(j *job) error {
+	if err := os.MkdirAll(jobsDir(), 0o700); err != nil { return err }
+	exitFile := filepath.Join(jobsDir(), j.ID+".exit")
+	run := agentShellLine(j.Agent, j.Exec)
+	if j.Script != "" { run = scriptShellLine(j.Script) }
+	// stdout goes to the log, stderr to the log and <id>.err; the exit file is only
+	// written once tee has flushed, so a finished job's files are complete
+	log, errLog, exitTmp := shellEscape(j.Log), shellEscape(stderrPath(j.Log)), shellEscape(exitFile+".tmp")
+	line := fmt.Sprintf(": >'%s'; { ( %s ) 2>&1 >&3 3>&-; echo $? >'%s'; } 3>>'%s' | tee '%s' >>'%s' 2>&1; mv '%s' '%s'", log, run, exitTmp, log, errLog, log, exitTmp, shellEscape(exitFile))
+	cmd := exec.Command("/bin/sh", "-c", line)
+	cmd.Env = append(append(os.Environ(), traceEnv(traceCtx)...), j.Env...)
+	// secrets are resolved here rather than kept in j.Env, which is saved in jobs.json
+	if j.Script == "" { cmd.Env = append(cmd.Env, runSecretEnv(j.Agent, j.Exec)...) }
+	// `term broker run` presents the session's ticket, handed over on descriptor 4
+	// since the line above uses 3
+	if j.Script == "" && j.Exec && sessionTicket != "" && brokerSocket() != "" {
+		r, err := ticketPipe(sessionTicket)
+		if err != nil { return err }
+		defer r.Close()
+		cmd.ExtraFiles = []*os.File{nil, r}
+		cmd.Env = append(cmd.Env, "CBW_BROKER_TICKET_FD=4")
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil { return err }
+	// reap the child so it does not linger as a zombie that looks alive
+	go cmd.Wait()
+	j.PID = cmd.Process.Pid
+	j.State = JobRunning
+	j.Started = time.Now().Format(time.RFC3339)
+	return nil
+}
+
+// dispatchJobs starts queued jobs while fewer than maxRunningJobs are running and
+// returns the jobs it started, or tried to: those that failed come back finished
+func dispatchJobs(jobs []job) (started []job) {
+	running := 0
+	for _, j := range jobs { if j.State == JobRunning { running++ } }
+	for i := range jobs {
+		if running >= maxRunningJobs { return started }
+		if jobs[i].State != JobQueued { continue }
+		if err := startJobProcess(&jobs[i]); err != nil {
+			jobs[i].State, jobs[i].Exit, jobs[i].Finished = JobFinished, 1, time.Now().Format(time.RFC3339)
+			slog.Error("failed to start job", "job", jobs[i].ID, "agent", jobs[i].Agent, "err", err)
+			_ = ioutil.WriteFile(jobs[i].Log, []byte("failed to start: "+err.Error()+"\n"), 0o600)
+			started = append(started, jobs[i])
+			continue
+		}
+		running++
+		started = append(started, jobs[i])
+	}
+	return started
+}
+
+// reconcileJob updates a running job from its exit file or process status and reports
+// whether it just left the running state.
+func reconcileJob(j *job) bool {
+	if j.State != JobRunning { return false }
+	exitPath := filepath.Join(jobsDir(), j.ID+".exit")
+	finished := time.Now()
+	if b, err := ioutil.ReadFile(exitPath); err == nil {
+		code, err := strconv.Atoi(strings.TrimSpace(string(b)))
+		if err != nil { code = 1 }
+		j.State, j.Exit = JobFinished, code
+		// the exit file is written as the job ends, which may be a poll interval ago
+		if fi, err := os.Stat(exitPath); err == nil { finished = fi.ModTime() }
+	} else if !processAlive(j.PID) {
+		j.State, j.Exit = JobLost, -1
+	} else {
+		return false
+	}
+	j.Finished = finished.Format(time.RFC3339)
+	return true
+}
+
+// syncJobs reconciles every job, starts queued ones and audits jobs that finished since
+// the last sync. Holding the lock guarantees each completion is audited exactly once
+// even with several TUI sessions polling.
+func syncJobs(auditPath string) (all, done []job, err error) {
+	var started []job
+	err = withLock("jobs", func() error {
+		all = loadJobs()
+		for i := range all {
+			if reconcileJob(&all[i]) {
+				j := all[i]
+				done = append(done, j)
+				traceJob(j)
+				appendAudit(auditPath, fmt.Sprintf("%s\tagent=%s\texec=%v\texit=%d\terror=%v\tjob=%s\tuser=%s\tduration=%s", j.Finished, j.Agent, j.Exec, j.Exit, jobError(j), j.ID, j.User, jobDuration(j))+sandboxAudit(j.Agent, j.Exec && j.Script == ""))
+			}
+		}
+		started = dispatchJobs(all)
+		if len(started) == 0 && len(done) == 0 { return nil }
+		return saveJobs(all)
+	})
+	// queued outside the lock; emitJobEvent publishes from its own goroutine, so a slow
+	// bus holds up neither other sessions nor the update loop
+	if err == nil {
+		for _, j := range append(done, started...) { emitJobEvent(j) }
+	}
+	return all, done, err
+}
+
+// jobDuration is how long j ran, or empty when it was never started or is lost
+func jobDuration(j job) string {
+	start, err1 := time.Parse(time.RFC3339, j.Started)
+	end, err2 := time.Parse(time.RFC3339, j.Finished)
+	if err1 != nil || err2 != nil || j.State == JobLost { return "" }
+	return end.Sub(start).String()
+}
+
+// jobError renders a job outcome the way exec errors appear in the audit log
+func jobError(j job) string {
+	switch {
+	case j.State == JobLost:
+		return "process lost"
+	case j.Exit != 0:
+		return fmt.Sprintf("exit status %d", j.Exit)
+	}
+	return "<nil>"
+}
+
+func activeJobs(jobs []job) int {
+	n := 0
+	for _, j := range jobs { if j.State == JobQueued || j.State == JobRunning { n++ } }
+	return n
+}
+
+func jobItems(jobs []job) []list.Item {
+	out := make([]list.Item, 0, len(jobs))
+	// newest first
+	for i := len(jobs) - 1; i >= 0; i-- { out = append(out, jobItem{j: jobs[i]}) }
+	return out
+}
+
+func jobsTick() tea.Cmd {
+	return tea.Tick(time.Second, func(time.Time) tea.Msg { return jobsTickMsg{} })
+}
+
+// readJobLog returns the captured output of a job
+func readJobLog(j job) string {
+	b, err := ioutil.ReadFile(j.Log)
+	if err != nil { return fmt.Sprintf("(no output yet: %v)", err) }
+	return string(b)
+}
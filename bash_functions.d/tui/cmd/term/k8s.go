@@ -0,0 +1,415 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// The K8s tab browses the clusters of the kubeconfig ($KUBECONFIG or ~/.kube/config)
+// with client-go: contexts, then a context's namespaces, then the pods of one. Logs
+// stream into the tab; a shell in a pod runs kubectl exec on the terminal.
+
+// k8sTimeout bounds one API call
+const k8sTimeout = 10 * time.Second
+
+// k8sTailLines is how much of a pod's log is shown before following it
+const k8sTailLines = 200
+
+// k8sMaxLogLines is how many log lines the tab keeps
+const k8sMaxLogLines = 2000
+
+// k8s browser levels
+const (
+	k8sContexts = iota
+	k8sNamespaces
+	k8sPods
+	k8sLogs
+)
+
+// k8sPod is what the pod list shows of a pod
+type k8sPod struct {
+	name, status, node string
+	ready, total       int
+	restarts           int32
+	age                       time.Duration
+	containers                []string
+}
+
+// k8sView is the K8s tab
+type k8sView struct {
+	level      int
+	contexts   []string
+	current    string // kubeconfig's current context
+	context    string // context being browsed
+	namespaces []string
+	namespace  string
+	pods       []k8sPod
+	sel        [3]int
+	loading    bool
+	err        error
+	tail       *k8sLogTail
+	clients    map[string]*kubernetes.Clientset
+}
+
+func newK8sView() *k8sView { return &k8sView{clients: map[string]*kubernetes.Clientset{}} }
+
+// k8sListMsg carries the result of listing contexts, namespaces or pods
+type k8sListMsg struct {
+	level      int
+	contexts   []string
+	current    string
+	namespaces []string
+	pods       []k8sPod
+	err        error
+}
+
+// client returns a clientset for a kubeconfig context, built once per context
+func (v *k8sView) client(ctxName string) (*kubernetes.Clientset, error) {
+	if c, ok := v.clients[ctxName]; ok { return c, nil }
+	cfg, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(clientcmd.NewDefaultClientConfigLoadingRules(), &clientcmd.ConfigOverrides{CurrentContext: ctxName}).ClientConfig()
+	if err != nil { return nil, err }
+	cfg.Timeout = k8sTimeout
+	c, err := kubernetes.NewForConfig(cfg)
+	if err != nil { return nil, err }
+	v.clients[ctxName] = c
+	return c, nil
+}
+
+func listK8sContexts() tea.Cmd {
+	return func() tea.Msg {
+		cfg, err := clientcmd.NewDefaultClientConfigLoadingRules().Load()
+		if err != nil { return k8sListMsg{level: k8sContexts, err: err} }
+		var names []string
+		for n := range cfg.Contexts { names = append(names, n) }
+		sort.Strings(names)
+		return k8sListMsg{level: k8sContexts, contexts: names, current: cfg.CurrentContext}
+	}
+}
+
+// listK8sNamespaces lists the namespaces of a context; a user who may not list them
+// gets the context's own namespace
+func listK8sNamespaces(c *kubernetes.Clientset, ctxName string) tea.Cmd {
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), k8sTimeout)
+		defer cancel()
+		list, err := c.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+		if err != nil {
+			ns := "default"
+			if cfg, lerr := clientcmd.NewDefaultClientConfigLoadingRules().Load(); lerr == nil && cfg.Contexts[ctxName] != nil && cfg.Contexts[ctxName].Namespace != "" { ns = cfg.Contexts[ctxName].Namespace }
+			slog.Debug("k8s: cannot list namespaces", "context", ctxName, "err", err)
+			return k8sListMsg{level: k8sNamespaces, namespaces: []string{ns}}
+		}
+		var names []string
+		for _, n := range list.Items { names = append(names, n.Name) }
+		sort.Strings(names)
+		return k8sListMsg{level: k8sNamespaces, namespaces: names}
+	}
+}
+
+func listK8sPods(c *kubernetes.Clientset, ns string) tea.Cmd {
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), k8sTimeout)
+		defer cancel()
+		list, err := c.CoreV1().Pods(ns).List(ctx, metav1.ListOptions{})
+		if err != nil { return k8sListMsg{level: k8sPods, err: err} }
+		var pods []k8sPod
+		for _, p := range list.Items { pods = append(pods, summarizePod(p)) }
+		sort.Slice(pods, func(i, j int) bool { return pods[i].name < pods[j].name })
+		return k8sListMsg{level: k8sPods, pods: pods}
+	}
+}
+
+// summarizePod reduces a pod to the columns kubectl get pods shows
+func summarizePod(p corev1.Pod) k8sPod {
+	kp := k8sPod{name: p.Name, node: p.Spec.NodeName, status: string(p.Status.Phase), age: time.Since(p.CreationTimestamp.Time)}
+	if p.Status.Reason != "" { kp.status = p.Status.Reason }
+	for _, c := range p.Spec.Containers { kp.containers = append(kp.containers, c.Name) }
+	for _, cs := range p.Status.ContainerStatuses {
+		if cs.Ready { kp.ready++ }
+		kp.restarts += cs.RestartCount
+		// a container stuck waiting or terminated explains more than the phase
+		if w := cs.State.Waiting; w != nil && w.Reason != "" { kp.status = w.Reason }
+		if t := cs.State.Terminated; t != nil && t.Reason != "" && kp.status == string(corev1.PodRunning) { kp.status = t.Reason }
+	}
+	if p.DeletionTimestamp != nil { kp.status = "Terminating" }
+	kp.total = len(p.Spec.Containers)
+	return kp
+}
+
+// k8sLogTail follows a pod's log; lines are appended by a goroutine reading the
+// stream and picked up by the UI when changed fires
+type k8sLogTail struct {
+	pod, container string
+	cancel         context.CancelFunc
+	mu             sync.Mutex
+	lines          []string
+	err            error
+	done           bool
+	changed        chan struct{} // coalesced: one pending notification is enough
+}
+
+type k8sLogMsg struct{ t *k8sLogTail }
+
+func startK8sLogTail(c *kubernetes.Clientset, ns, pod, container string) *k8sLogTail {
+	ctx, cancel := context.WithCancel(context.Background())
+	t := &k8sLogTail{pod: pod, container: container, cancel: cancel, changed: make(chan struct{}, 1)}
+	go func() {
+		defer close(t.changed)
+		tail := int64(k8sTailLines)
+		rc, err := c.CoreV1().Pods(ns).GetLogs(pod, &corev1.PodLogOptions{Container: container, Follow: true, TailLines: &tail}).Stream(ctx)
+		if err != nil { t.finish(err); return }
+		defer rc.Close()
+		sc := bufio.NewScanner(rc)
+		sc.Buffer(make([]byte, 64<<10), 1<<20)
+		for sc.Scan() {
+			t.mu.Lock()
+			t.lines = append(t.lines, sc.Text())
+			if len(t.lines) > k8sMaxLogLines { t.lines = t.lines[len(t.lines)-k8sMaxLogLines:] }
+			t.mu.Unlock()
+			t.notify()
+		}
+		if ctx.Err() == nil { t.finish(sc.Err()) }
+	}()
+	return t
+}
+
+func (t *k8sLogTail) notify() {
+	select {
+	case t.changed <- struct{}{}:
+	default:
+	}
+}
+
+func (t *k8sLogTail) finish(err error) {
+	t.mu.Lock()
+	t.err, t.done = err, true
+	t.mu.Unlock()
+	t.notify()
+}
+
+// waitK8sLog delivers the next batch of log lines; nothing once the tail stopped
+func waitK8sLog(t *k8sLogTail) tea.Cmd {
+	return func() tea.Msg {
+		if _, ok := <-t.changed; !ok { return nil }
+		return k8sLogMsg{t: t}
+	}
+}
+
+func (t *k8sLogTail) snapshot() ([]string, error, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]string(nil), t.lines...), t.err, t.done
+}
+
+// loadK8s lists the contexts the first time the tab is shown
+func (m *model) loadK8s() tea.Cmd {
+	v := m.k8s
+	if m.tabs[m.active] != "K8s" || v.contexts != nil || v.loading || v.err != nil { return nil }
+	v.loading = true
+	return listK8sContexts()
+}
+
+// k8sListed stores what a list command found
+func (m *model) k8sListed(msg k8sListMsg) {
+	v := m.k8s
+	v.loading = false
+	if msg.err != nil {
+		v.err = msg.err
+		m.status = T("kubernetes: %v", msg.err)
+		slog.Warn("kubernetes request failed", "context", v.context, "namespace", v.namespace, "err", msg.err)
+		return
+	}
+	v.err = nil
+	switch msg.level {
+	case k8sContexts:
+		v.contexts, v.current = msg.contexts, msg.current
+		if v.contexts == nil { v.contexts = []string{} }
+		for i, c := range v.contexts { if c == v.current { v.sel[k8sContexts] = i } }
+	case k8sNamespaces:
+		v.namespaces = msg.namespaces
+		v.sel[k8sNamespaces] = 0
+		for i, n := range v.namespaces { if n == "default" { v.sel[k8sNamespaces] = i } }
+	case k8sPods:
+		v.pods = msg.pods
+		if v.sel[k8sPods] >= len(v.pods) { v.sel[k8sPods] = max(0, len(v.pods)-1) }
+	}
+}
+
+// k8sOpen moves down a level: a context's namespaces, or a namespace's pods
+func (m *model) k8sOpen(level int) tea.Cmd {
+	v := m.k8s
+	c, err := v.client(v.context)
+	if err != nil { v.err = err; m.status = T("kubernetes: %v", err); return nil }
+	v.level, v.loading, v.err = level, true, nil
+	if level == k8sNamespaces { return listK8sNamespaces(c, v.context) }
+	return listK8sPods(c, v.namespace)
+}
+
+// k8sShellDoneMsg arrives when a kubectl exec session ends
+type k8sShellDoneMsg struct {
+	pod string
+	err error
+}
+
+// updateK8s handles the K8s tab keys: enter opens a context, a namespace or a pod's
+// log, esc goes back up, e opens a shell in a pod, x deletes it and u reloads
+func (m *model) updateK8s(key string) (tea.Cmd, bool) {
+	v := m.k8s
+	if v.level == k8sLogs {
+		if key != "esc" { return nil, false }
+		if v.tail != nil { v.tail.cancel(); v.tail = nil }
+		v.level = k8sPods
+		return m.k8sOpen(k8sPods), true
+	}
+	counts := []int{len(v.contexts), len(v.namespaces), len(v.pods)}
+	n := counts[v.level]
+	var pod *k8sPod
+	if v.level == k8sPods && v.sel[k8sPods] < len(v.pods) { pod = &v.pods[v.sel[k8sPods]] }
+	switch key {
+	case "up", "k":
+		if v.sel[v.level] > 0 { v.sel[v.level]-- }
+	case "down", "j":
+		if v.sel[v.level] < n-1 { v.sel[v.level]++ }
+	case "esc", "backspace":
+		if v.level > k8sContexts { v.level--; v.err = nil }
+	case "u":
+		if v.level == k8sContexts { v.contexts, v.err, v.loading = nil, nil, true; v.clients = map[string]*kubernetes.Clientset{}; return listK8sContexts(), true }
+		return m.k8sOpen(v.level), true
+	case "enter":
+		if n == 0 || v.loading { return nil, true }
+		switch v.level {
+		case k8sContexts:
+			v.context = v.contexts[v.sel[k8sContexts]]
+			return m.k8sOpen(k8sNamespaces), true
+		case k8sNamespaces:
+			v.namespace = v.namespaces[v.sel[k8sNamespaces]]
+			return m.k8sOpen(k8sPods), true
+		}
+		c, err := v.client(v.context)
+		if err != nil { m.status = T("kubernetes: %v", err); return nil, true }
+		container := ""
+		if len(pod.containers) > 0 { container = pod.containers[0] }
+		v.tail = startK8sLogTail(c, v.namespace, pod.name, container)
+		v.level = k8sLogs
+		m.status = T("following the log of %s; esc stops", pod.name)
+		return waitK8sLog(v.tail), true
+	case "e":
+		if pod == nil || m.denyReadOnly() { return nil, true }
+		if _, err := exec.LookPath("kubectl"); err != nil { m.status = T("kubectl not found in PATH"); return nil, true }
+		name := pod.name
+		c := exec.Command("kubectl", "--context", v.context, "-n", v.namespace, "exec", "-it", name, "--", "sh", "-c", "command -v bash >/dev/null && exec bash || exec sh")
+		return tea.ExecProcess(c, func(err error) tea.Msg { return k8sShellDoneMsg{name, err} }), true
+	case "x":
+		if pod == nil || m.denyReadOnly() { return nil, true }
+		ctxName, ns, name := v.context, v.namespace, pod.name
+		m.ask(T("delete pod %s in %s/%s?", name, ctxName, ns), func(m *model) tea.Cmd {
+			c, err := m.k8s.client(ctxName)
+			if err == nil {
+				ctx, cancel := context.WithTimeout(context.Background(), k8sTimeout)
+				err = c.CoreV1().Pods(ns).Delete(ctx, name, metav1.DeleteOptions{})
+				cancel()
+			}
+			if err != nil { m.status = T("cannot delete %s: %v", name, err); slog.Warn("pod delete failed", "context", ctxName, "namespace", ns, "pod", name, "err", err); return nil }
+			m.status = T("deleted pod %s", name)
+			return m.k8sOpen(k8sPods)
+		})
+	default:
+		return nil, false
+	}
+	return nil, true
+}
+
+// k8sTabView renders the K8s tab in w x h cells
+func (m model) k8sTabView(w, h int) string {
+	v := m.k8s
+	var b strings.Builder
+	crumbs := []string{T("contexts")}
+	if v.level >= k8sNamespaces { crumbs = append(crumbs, v.context) }
+	if v.level >= k8sPods { crumbs = append(crumbs, v.namespace) }
+	if v.level == k8sLogs && v.tail != nil { crumbs = append(crumbs, v.tail.pod) }
+	b.WriteString(strings.Join(crumbs, " › ") + "\n")
+	hints := []string{
+		T("enter: namespaces • u: reload"),
+		T("enter: pods • esc: back • u: reload"),
+		T("enter: follow log • e: shell • x: delete • esc: back • u: reload"),
+		T("esc: stop following"),
+	}
+	b.WriteString(helpStyle.Render(hints[v.level]) + "\n\n")
+	rows := max(1, h-4)
+	switch {
+	case v.err != nil:
+		b.WriteString(diffDelStyle.Render(T("kubernetes: %v", v.err)) + "\n")
+	case v.loading:
+		b.WriteString(T("loading...") + "\n")
+	case v.level == k8sContexts:
+		if len(v.contexts) == 0 { b.WriteString(T("no contexts in the kubeconfig") + "\n") }
+		for i := max(0, v.sel[0]-rows+1); i < len(v.contexts) && i < max(0, v.sel[0]-rows+1)+rows; i++ {
+			c := v.contexts[i]
+			if c == v.current { c += " " + helpStyle.Render(T("(current)")) }
+			b.WriteString(selMarker(i == v.sel[0]) + c + "\n")
+		}
+	case v.level == k8sNamespaces:
+		for i := max(0, v.sel[1]-rows+1); i < len(v.namespaces) && i < max(0, v.sel[1]-rows+1)+rows; i++ {
+			b.WriteString(selMarker(i == v.sel[1]) + v.namespaces[i] + "\n")
+		}
+	case v.level == k8sPods:
+		if len(v.pods) == 0 { b.WriteString(T("no pods in %s", v.namespace) + "\n"); break }
+		nameW := 4
+		for _, p := range v.pods { nameW = max(nameW, len(p.name)) }
+		nameW = min(nameW, max(20, w-50))
+		fmt.Fprintf(&b, "  %-*s %-6s %-18s %8s %6s %s\n", nameW, T("NAME"), T("READY"), T("STATUS"), T("RESTARTS"), T("AGE"), T("NODE"))
+		for i := max(0, v.sel[2]-rows+2); i < len(v.pods) && i < max(0, v.sel[2]-rows+2)+rows-1; i++ {
+			p := v.pods[i]
+			status := fmt.Sprintf("%-18s", p.status)
+			if !m.plain { status = podStatusStyle(p).Render(status) }
+			fmt.Fprintf(&b, "%s%-*s %-6s %s %8d %6s %s\n", selMarker(i == v.sel[2]), nameW, truncateCells(p.name, nameW), fmt.Sprintf("%d/%d", p.ready, p.total), status, p.restarts, k8sAge(p.age), p.node)
+		}
+	case v.level == k8sLogs && v.tail != nil:
+		lines, err, done := v.tail.snapshot()
+		if len(lines) > rows { lines = lines[len(lines)-rows:] }
+		for _, l := range lines { b.WriteString(truncateCells(l, max(10, w)) + "\n") }
+		if err != nil { b.WriteString(diffDelStyle.Render(T("log stream ended: %v", err)) + "\n") } else if done { b.WriteString(helpStyle.Render(T("log stream ended")) + "\n") }
+	}
+	return b.String()
+}
+
+// podStatusStyle colors a pod's status: running and ready green, succeeded dim,
+// pending yellow, anything else red
+func podStatusStyle(p k8sPod) lipgloss.Style {
+	switch {
+	case p.status == "Running" && p.ready == p.total:
+		return diffAddStyle
+	case p.status == "Succeeded" || p.status == "Completed":
+		return helpStyle
+	case p.status == "Pending" || p.status == "ContainerCreating" || p.status == "Running" || p.status == "Terminating":
+		return ansChangedStyle
+	}
+	return diffDelStyle
+}
+
+// k8sAge formats an age the way kubectl does: 45s, 12m, 5h, 3d
+func k8sAge(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	}
+	return fmt.Sprintf("%dd", int(d.Hours()/24))
+}
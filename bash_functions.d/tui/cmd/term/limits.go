@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// limitSpec caps the resources of one agent run. CPU and Memory go to a transient
+// cgroup v2 scope when the user has a systemd manager; otherwise Memory falls back to
+// an address-space rlimit and CPU is not enforced. CPUTime and NoFile are rlimits.
+type limitSpec struct {
+	CPU     int    `json:"cpu,omitempty"`      // percent of one CPU; 200 is two CPUs
+	Memory  string `json:"memory,omitempty"`   // e.g. "512M" or "2G"
+	CPUTime int    `json:"cpu_time,omitempty"` // seconds of CPU time before the run is killed
+	NoFile  int    `json:"nofile,omitempty"`   // open file descriptors
+}
+
+// parseSize reads sizes like 512M, 2G or 1048576 (bytes)
+func parseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	mult := int64(1)
+	if n := len(s); n > 0 {
+		switch s[n-1] {
+		case 'K':
+			mult = 1 << 10
+		case 'M':
+			mult = 1 << 20
+		case 'G':
+			mult = 1 << 30
+		case 'T':
+			mult = 1 << 40
+		}
+		if mult > 1 { s = s[:n-1] }
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || v <= 0 { return 0, fmt.Errorf("bad size %q", s) }
+	return v * mult, nil
+}
+
+// cgroupScopes reports whether runs can be put in their own cgroup v2 scope: the
+// unified hierarchy, systemd-run and a user manager to talk to
+func cgroupScopes() bool {
+	if _, err := os.Stat("/sys/fs/cgroup/cgroup.controllers"); err != nil { return false }
+	if _, err := exec.LookPath("systemd-run"); err != nil { return false }
+	return os.Getenv("XDG_RUNTIME_DIR") != ""
+}
+
+// wrap applies the limits to line. cgroups says whether a systemd scope is used.
+func (l limitSpec) wrap(agent, line string, cgroups bool) string {
+	var rl []string
+	if l.NoFile > 0 { rl = append(rl, fmt.Sprintf("ulimit -n %d", l.NoFile)) }
+	if l.CPUTime > 0 { rl = append(rl, fmt.Sprintf("ulimit -t %d", l.CPUTime)) }
+	mem, err := int64(0), error(nil)
+	if l.Memory != "" {
+		if mem, err = parseSize(l.Memory); err != nil { slog.Warn("manifest: ignoring memory limit", "agent", agent, "err", err) }
+	}
+	if !cgroups && mem > 0 { rl = append(rl, fmt.Sprintf("ulimit -v %d", mem>>10)) }
+	if !cgroups && l.CPU > 0 { slog.Warn("cpu limit needs cgroups v2 and a systemd user manager; not enforced", "agent", agent) }
+	// a failing ulimit aborts the run instead of running it unlimited
+	if len(rl) > 0 { line = strings.Join(rl, " && ") + " && " + line }
+	var props []string
+	if cgroups && l.CPU > 0 { props = append(props, fmt.Sprintf("-p CPUQuota=%d%%", l.CPU)) }
+	if cgroups && mem > 0 { props = append(props, fmt.Sprintf("-p MemoryMax=%d", mem), "-p MemorySwapMax=0") }
+	if len(props) == 0 {
+		if len(rl) > 0 { return "( " + line + " )" }
+		return line
+	}
+	return "systemd-run --user --scope --quiet --collect " + strings.Join(props, " ") + " -- /bin/sh -c " + quoted(line)
+}
+
+// limitLine applies the manifest limits of agent to its run line
+func limitLine(agent, line string) string {
+	mf, err := loadManifest()
+	if err != nil { return line }
+	a, ok := mf.agent(agent)
+	if !ok || a.Limits == nil { return line }
+	return a.Limits.wrap(agent, line, cgroupScopes())
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// liveSettle is how long the buffer must stay unchanged before it is re-rendered
+const liveSettle = 300 * time.Millisecond
+
+// liveMarkdown is the Editor's live preview: the buffer, not the file, rendered in a
+// Preview pane beside it. The buffer is polled rather than hooked into each edit
+// path, so vim keys, snippets and header rewrites update the preview too.
+type liveMarkdown struct {
+	file     string    // editor file the preview belongs to
+	seen     string    // buffer at the last poll
+	rendered string    // buffer last rendered
+	changed  time.Time // when seen last changed
+}
+
+// liveMarkdownTickMsg polls the buffer while the live preview is on
+type liveMarkdownTickMsg struct{}
+
+func liveMarkdownTick() tea.Cmd {
+	return tea.Tick(liveSettle/2, func(time.Time) tea.Msg { return liveMarkdownTickMsg{} })
+}
+
+func isMarkdownFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".md", ".markdown", ".mdown", ".mkd":
+		return true
+	}
+	return false
+}
+
+// toggleLiveMarkdown opens or closes the live preview of the markdown buffer
+func (m *model) toggleLiveMarkdown() tea.Cmd {
+	if m.live != nil { m.live = nil; m.status = T("live preview off"); return nil }
+	if !isMarkdownFile(m.editorFile) { m.status = T("live preview is for markdown files"); return nil }
+	src := m.ta.Value()
+	m.live = &liveMarkdown{file: m.editorFile, seen: src, changed: time.Now()}
+	m.panes.show(true, m.tabs[m.active], "Preview")
+	m.vp.GotoTop()
+	m.renderLive(src)
+	m.status = T("live preview of %s", filepath.Base(m.editorFile))
+	return liveMarkdownTick()
+}
+
+// pollLiveMarkdown re-renders the buffer once it has settled; the preview ends when
+// another file is opened in the editor
+func (m *model) pollLiveMarkdown() tea.Cmd {
+	l := m.live
+	if l == nil { return nil }
+	if l.file != m.editorFile { m.live = nil; return nil }
+	src := m.ta.Value()
+	if src != l.seen { l.seen, l.changed = src, time.Now() }
+	if l.seen != l.rendered && time.Since(l.changed) >= liveSettle { m.renderLive(l.seen) }
+	return liveMarkdownTick()
+}
+
+// renderLive renders src into the preview and scrolls it to about where the cursor
+// is in the buffer, so the part being edited stays in view
+func (m *model) renderLive(src string) {
+	m.live.rendered = src
+	m.md = &mdDoc{source: src}
+	m.renderMarkdown()
+	total := strings.Count(m.vpContent, "\n") + 1
+	if n := m.ta.LineCount(); n > 1 {
+		m.vp.SetYOffset(m.ta.Line()*total/n - m.vp.Height/2)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// llmConfig is the model the TUI asks for drafts and suggestions. With an endpoint it
+// posts to an OpenAI-style chat completions API (OpenAI, Ollama, llama.cpp, vLLM...);
+// without one it runs mods, which has its own model settings.
+type llmConfig struct {
+	Endpoint string `json:"endpoint,omitempty"` // e.g. http://localhost:11434/v1/chat/completions
+	Model    string `json:"model,omitempty"`    // sent to the endpoint, or passed to mods --model
+	KeyEnv   string `json:"key_env,omitempty"`  // variable holding the endpoint's API key, sent as a bearer token
+	Mods     string `json:"mods,omitempty"`     // mods binary (default mods)
+	Timeout  int    `json:"timeout,omitempty"`  // seconds to wait for an answer (default 120)
+}
+
+var errNoLLM = errors.New("no LLM: install mods or set llm.endpoint in config.json")
+
+func (c llmConfig) timeout() time.Duration {
+	if c.Timeout > 0 { return time.Duration(c.Timeout) * time.Second }
+	return 2 * time.Minute
+}
+
+// askLLM sends the system prompt and the user's prompt to the configured model and
+// returns its answer
+func askLLM(ctx context.Context, cfg llmConfig, system, prompt string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, cfg.timeout())
+	defer cancel()
+	if cfg.Endpoint != "" { return askEndpoint(ctx, cfg, system, prompt) }
+	return askMods(ctx, cfg, system, prompt)
+}
+
+// askMods runs mods with the system prompt as its argument and the prompt on stdin,
+// which mods appends to it
+func askMods(ctx context.Context, cfg llmConfig, system, prompt string) (string, error) {
+	bin := cfg.Mods
+	if bin == "" { bin = "mods" }
+	if _, err := exec.LookPath(bin); err != nil { return "", errNoLLM }
+	args := []string{"--quiet", "--no-cache"}
+	if cfg.Model != "" { args = append(args, "--model", cfg.Model) }
+	c := exec.CommandContext(ctx, bin, append(args, system)...)
+	c.Stdin = strings.NewReader(prompt)
+	var stderr bytes.Buffer
+	c.Stderr = &stderr
+	out, err := c.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" { return "", fmt.Errorf("mods: %s", lastLine(msg)) }
+		return "", fmt.Errorf("mods: %w", err)
+	}
+	return string(out), nil
+}
+
+// askEndpoint posts a chat completion request and returns the first choice
+func askEndpoint(ctx context.Context, cfg llmConfig, system, prompt string) (string, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"model": cfg.Model,
+		"messages": []map[string]string{{"role": "system", "content": system}, {"role": "user", "content": prompt}},
+	})
+	if err != nil { return "", err }
+	req, err := http.NewRequestWithContext(ctx, "POST", cfg.Endpoint, bytes.NewReader(body))
+	if err != nil { return "", err }
+	req.Header.Set("Content-Type", "application/json")
+	if cfg.KeyEnv != "" {
+		key := os.Getenv(cfg.KeyEnv)
+		if key == "" { return "", fmt.Errorf("llm: %s is not set", cfg.KeyEnv) }
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil { return "", err }
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil { return "", err }
+	if resp.StatusCode >= 300 { return "", fmt.Errorf("llm: HTTP %s: %s", resp.Status, lastLine(strings.TrimSpace(string(b)))) }
+	var r struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(b, &r); err != nil { return "", fmt.Errorf("llm: %w", err) }
+	if len(r.Choices) == 0 { return "", errors.New("llm: empty answer") }
+	return r.Choices[0].Message.Content, nil
+}
+
+// codeBlock is a fenced block of a model's answer
+type codeBlock struct {
+	lang, body string
+}
+
+// fencedBlocks returns the ``` blocks of s in order; an unclosed block runs to the end
+func fencedBlocks(s string) []codeBlock {
+	var blocks []codeBlock
+	var cur *codeBlock
+	var body []string
+	for _, l := range strings.Split(s, "\n") {
+		t := strings.TrimSpace(l)
+		switch {
+		case cur == nil && strings.HasPrefix(t, "```"):
+			cur = &codeBlock{lang: strings.TrimSpace(strings.TrimPrefix(t, "```"))}
+			body = nil
+		case cur != nil && t == "```":
+			cur.body = strings.Join(body, "\n") + "\n"
+			blocks = append(blocks, *cur)
+			cur = nil
+		case cur != nil:
+			body = append(body, l)
+		}
+	}
+	if cur != nil { cur.body = strings.Join(body, "\n") + "\n"; blocks = append(blocks, *cur) }
+	return blocks
+}
+
+// lastLine is the last line of a tool's error output, usually the one that says what went wrong
+func lastLine(s string) string { return s[strings.LastIndex(s, "\n")+1:] }
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// logConfig selects the level, format and destination of diagnostic logs
+type logConfig struct {
+	Level  string `json:"level,omitempty"`  // debug, info (default), warn or error
+	Format string `json:"format,omitempty"` // text (default) or json
+	File   string `json:"file,omitempty"`   // default: stderr, or logs/<service>.log for the TUI
+}
+
+// logsDir holds the TUI's log files; stderr is hidden behind the alt screen
+func logsDir() string { return filepath.Join(tuiDataDir(), "logs") }
+
+// setupLogging makes slog (and the standard log package, which slog takes over)
+// write to the configured destination. toFile forces a file when none is configured,
+// for the TUI. The returned function closes the file.
+func setupLogging(cfg logConfig, service string, toFile bool) func() {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Level)); err != nil { level = slog.LevelInfo }
+	var w io.Writer = os.Stderr
+	closeFn := func() {}
+	path := expandHome(cfg.File)
+	if path == "" && toFile { path = filepath.Join(logsDir(), service+".log") }
+	if path != "" {
+		_ = os.MkdirAll(filepath.Dir(path), 0o700)
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0o600)
+		if err == nil { w, closeFn = f, func() { f.Close() } } else if toFile { w = io.Discard }
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	var h slog.Handler = slog.NewTextHandler(w, opts)
+	if strings.EqualFold(cfg.Format, "json") { h = slog.NewJSONHandler(w, opts) }
+	slog.SetDefault(slog.New(h).With("service", service, "pid", os.Getpid()))
+	return closeFn
+}
@@ -1,9 +1,11 @@
 package main
 
 import (
-	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -15,8 +17,8 @@ import (
 	"github.com/charmbracelet/bubbles/textinput"
 	"github.com/charmbracelet/bubbles/textarea"
 	"github.com/charmbracelet/bubbles/viewport"
-	"github.com/charmbracelet/glamour"
 	"github.com/charmbracelet/lipgloss"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 const (
@@ -25,18 +27,10 @@ const (
 )
 
 var (
-	titleStyle = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("205"))
-	tabStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("63"))
-	activeTabStyle = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("39"))
-	helpStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("241"))
-	boxStyle  = lipgloss.NewStyle().Padding(0,1)
-)
-
-// layout modes
-const (
-	LayoutSingle = iota
-	LayoutVerticalSplit
-	LayoutHorizontalSplit
+	titleStyle = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.AdaptiveColor{Light: "162", Dark: "205"})
+	tabStyle   = lipgloss.NewStyle().Foreground(lipgloss.AdaptiveColor{Light: "56", Dark: "63"})
+	activeTabStyle = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.AdaptiveColor{Light: "25", Dark: "39"})
+	helpStyle  = lipgloss.NewStyle().Foreground(lipgloss.AdaptiveColor{Light: "244", Dark: "241"})
 )
 
 // fileItem implements list.Item
@@ -44,19 +38,40 @@ type fileItem struct{
 	name string
 	path string
 	isDir bool
+	size int64
+	mode os.FileMode
+	mtime time.Time
+	owner string
+	tags []string // from the tag store, see tags.go
 }
 func (f fileItem) Title() string { return f.name }
-func (f fileItem) Description() string { if f.isDir { return "directory" }; return "file" }
+func (f fileItem) Description() string {
+	if f.isDir { return T("directory") }
+	if len(f.tags) > 0 { return T("file") + " · #" + strings.Join(f.tags, " #") }
+	return T("file")
+}
 func (f fileItem) FilterValue() string { return f.name }
 
 // agentItem implements list.Item for agents
 type agentItem struct{
 	name string
 	desc string
+	tags []string
+	crew int // number of members when this is a crew, else 0
+	locked bool // this user may not run it with --exec
 }
 func (a agentItem) Title() string { return a.name }
-func (a agentItem) Description() string { return a.desc }
-func (a agentItem) FilterValue() string { return a.name }
+func (a agentItem) Description() string { if len(a.tags) > 0 { return a.summary() + " [" + strings.Join(a.tags, ", ") + "]" }; return a.summary() }
+
+// summary is the description, marked as a crew for crews and as dry-run only when
+// the user cannot exec it
+func (a agentItem) summary() string {
+	s := a.desc
+	if a.crew > 0 { s = T("crew of %d", a.crew) + " · " + s }
+	if a.locked { s = T("dry-run only") + " · " + s }
+	return s
+}
+func (a agentItem) FilterValue() string { return a.name + " " + strings.Join(a.tags, " ") }
 
 // requestItem for Requests tab
 type requestItem struct{
@@ -65,9 +80,13 @@ type requestItem struct{
 	User string `json:"user"`
 	Time string `json:"time"`
 	Notes string `json:"notes,omitempty"`
+	State string `json:"-"` // pending, approved or denied; set by RequestStore.Find
+}
+func (r requestItem) Title() string { return T("%s by %s", r.Agent, r.User) }
+func (r requestItem) Description() string {
+	if r.State != "" && r.State != "pending" { return r.Time + " · " + T(r.State) }
+	return r.Time
 }
-func (r requestItem) Title() string { return fmt.Sprintf("%s by %s", r.Agent, r.User) }
-func (r requestItem) Description() string { return r.Time }
 func (r requestItem) FilterValue() string { return r.Agent + " " + r.User }
 
 type model struct{
@@ -81,28 +100,102 @@ type model struct{
 	tabs []string
 	active int
 	status string
-	layout int
+	panes *paneLayout
+	width, height int // current terminal size
 	mdTheme string // "dark" or "light"
 	editorFile string // path of file currently loaded into editor
 	auditPath string
 	auditContent string
+	auditFilter textinput.Model // / in the Audit tab: agent=, user=, status= and words
+	auditMatches string // entries matching auditFilter, shown instead of the log
+	reqFilter textinput.Model // / in the Requests tab; matches queued and decided requests
+	stats auditStats // aggregated from auditContent for the Stats tab
+	dashboard string // rendered Dashboard tab, refreshed by dashboardTickMsg
 	requestsPath string
 	pluginsList list.Model
+	vpContent string // raw content last set on vp, for copy/export
+	vpScroll bool // long lines in vp scroll sideways instead of wrapping
+	vpX int // first visible column in scroll mode
+	vpCols int // widest line of vpContent
+	md *mdDoc // markdown shown in vp, re-rendered on resize; nil for other content
+	previews *previewCache // rendered previews by path and mtime
+	tocList list.Model // outline of md, shown beside the preview
+	tocOpen bool
+	paneSizes string // the tabs on screen and their pane sizes when applySize last ran
+	searchInput textinput.Model // Search tab pattern
+	searchList list.Model // matches grouped by file
+	searchDir string // directory the current results are relative to
+	muxList list.Model // tmux/zellij sessions and templates
+	hostsList list.Model // host inventory in the Hosts tab
+	hostForm *hostForm // add/edit host form in the Hosts tab; nil when closed
+	hostPings map[string]hostPing // last ping of each host, by name
+	ans *ansibleView // Ansible tab: playbooks, inventories and runs
+	k8s *k8sView // K8s tab: contexts, namespaces, pods and log tail
+	tf *terraformView // Terraform tab: configurations and the last plan
+	vault *vaultView // Vault tab: passphrase prompt, entry form and revealed entries
+	usage *usageView // Usage tab: disk usage scan and the directory shown
+	gotoInput textinput.Model // ctrl+g prompt in the Editor
+	editorRO bool // editor buffer is read-only: edits and saves are blocked
+	live *liveMarkdown // live preview of a markdown buffer (alt+m); nil when off
+	images *imageGrid // Image tab thumbnails of the cwd; nil until the tab is shown
+	yt *ytView // YouTube tab: search results and the download queue
+	files fileListing // Files tab view mode and sort order
+	fileDiff *fileDiff // diff of two marked files shown in vp; nil for other content
+	sums *checksumRun // running or last checksum run of the Files tab
+	sumInput textinput.Model // V prompt in the Files tab: expected checksum
+	fmInput textinput.Model // F prompt in the Files tab: frontmatter filter
+	commentInput textinput.Model // C prompt in the Requests tab
+	agentTag string // Agents tab shows only agents with this tag; "" shows all
+	agentTagList []string // tags in the manifest, for cycling through with #
+	agentSearch textinput.Model // s search box in the Agents tab
+	agentDocs []agentDoc // what the agent search matches against, read when it opens
+	genInput textinput.Model // G prompt in the Agents tab: the agent to draft
+	draft *agentDraft // generated agent under review in the Editor tab; nil otherwise
+	crew *crewView // crew members shown in the Agents tab; nil shows the agents
+	streams *streamView // agent output in the viewport, for O
+	follow *auditFollow // set while the audit log is followed
+	archives *list.Model // archived audit segments, while browsing them
+	allowPath string // wish-server allowlist shown in the Admin tab
+	adminList list.Model // allowlist entries; the Admin tab exists for admins only
+	connList list.Model // wish-server connection log; admins only, like Admin
+	connInput textinput.Model
+	connFilter string // user=, ip=, event=, since=, until= of the Connections tab
+	adminForm *adminForm // add/edit entry form in the Admin tab; nil when closed
+	vim *vimState // vim key profile ("keys": "vim"); nil with the default keys
+	newFile *newFileForm // template picker opened with n in Files; nil when closed
+	rename  *renameForm  // batch rename opened with R in Files; nil when closed
+	tagInput textinput.Model // Files prompt of + (edit tags) and # (filter by tag)
+	tagFiles []string        // files whose tags tagInput edits; nil when it filters
+	tagsList list.Model      // tagged files in the Tags tab
+	snippets *snippetPicker // snippet picker opened with alt+p in Editor/Shell; nil when closed
+	clips *clipPicker // clipboard history opened with alt+y; nil when closed
+	recent *recentPicker // recent files opened with alt+e; nil when closed
+	jumps jumpList // directories and files visited, for alt+, and alt+.
+	palette *commandPalette // command palette and calculator opened with alt+c; nil when closed
+	dialog *dialog // open confirmation dialog, which takes every key; nil when closed
+	lastOutput string // output of the most recent shell command or agent run
+	termOut io.Writer // terminal the program renders to, used for OSC escapes
+	cfg tuiConfig
+	scheduleContent string
+	jobsList list.Model
+	myJobs map[string]bool // jobs started by this session, whose output we show on completion
+	quota sessionQuota // agent time and shell commands wish-server allows this connection
+	jobsTicking bool
+	plain bool // screen-reader friendly rendering (--plain)
+	workspaces []workspace // saved state of inactive workspaces; slot ws is stale while active
+	ws int
 }
 
 func initialModel() model {
+	cfg := loadConfig()
+	setLocale(cfg.Locale)
 	cwd, _ := os.Getwd()
-	items := listItemsFromDir(cwd)
-	l := list.New(items, list.NewDefaultDelegate(), 30, height-8)
-	l.Title = "Files: " + cwd
-	l.SetShowStatusBar(false)
-	l.SetFilteringEnabled(true)
-	l.SetShowHelp(false)
+	l := newFileList(cwd)
 
 	// Agents list
 	agents := loadAgents()
-	agList := list.New(agents, list.NewDefaultDelegate(), 40, height-8)
-	agList.Title = "Agents"
+	agList := list.New(agents, newAgentDelegate(), 40, height-8)
+	agList.Title = T("Agents")
 	agList.SetShowHelp(false)
 
 	// Requests list
@@ -112,49 +205,80 @@ func initialModel() model {
 	_ = os.MkdirAll(filepath.Dir(requestsPath), 0o700)
 	reqs := loadRequests(requestsPath)
 	reqList := list.New(reqs, list.NewDefaultDelegate(), 60, height-8)
-	reqList.Title = "Requests"
+	reqList.Title = T("Requests")
+	if u := requestScope(); u != "" { reqList.Title = T("My requests (%s)", u) }
+	reqList.SetFilteringEnabled(false) // / filters through the request store instead
 
 	// Plugins list
 	plugins := loadPlugins()
 	plList := list.New(plugins, list.NewDefaultDelegate(), 40, height-8)
-	plList.Title = "Plugins"
+	plList.Title = T("Plugins")
 
 	vp := viewport.New(width-32, height-10)
-	vp.SetContent("Welcome to the TUI. Select a file and press Enter to preview or press 'e' to edit. Press 'E' to open in embedded editor.\n")
 
 	ti := textinput.New()
-	ti.Placeholder = "enter shell command and press Enter"
+	ti.Placeholder = T("enter shell command and press Enter")
 	ti.CharLimit = 512
 	ti.Width = width-34
 
 	// embedded textarea editor
-	ta := textarea.New()
-	ta.Placeholder = "Write script here. Ctrl+S to save, Ctrl+Q to exit editor."
-	ta.SetWidth(width-34)
-	ta.SetHeight(height-12)
-	ta.ShowLineNumbers = true
+	ta := newEditor(width-34, height-12)
+
+	// Jobs list
+	jbList := list.New(jobItems(loadJobs()), list.NewDefaultDelegate(), 60, height-8)
+	jbList.Title = T("Jobs")
 
-	tabs := []string{"Files", "Agents", "Requests", "Audit", "Plugins", "Preview", "Editor", "Shell", "Image", "YouTube"}
+	tabs := []string{"Files", "Agents", "Requests", "Audit", "Plugins", "Preview", "Editor", "Shell", "Image", "YouTube", "Schedule", "Jobs", "Search", "Stats", "Dashboard", "Mux", "Hosts", "Ansible", "K8s", "Terraform", "Vault", "Usage", "Tags"}
+	if isAdmin() { tabs = append(tabs, "Admin", "Connections") }
 
 	home, _ = os.UserHomeDir()
 	auditDir := filepath.Join(home, ".bash_functions_d", "tui")
 	_ = os.MkdirAll(auditDir, 0o700)
 	auditPath := filepath.Join(auditDir, "agent_audit.log")
 
-	// load audit if exists
-	auditContent := ""
-	if b, err := ioutil.ReadFile(auditPath); err == nil { auditContent = string(b) }
 
-	m := model{list: l, agentsList: agList, requestsList: reqList, vp: vp, ti: ti, ta: ta, cwd: cwd, tabs: tabs, active: 0, layout: LayoutSingle, mdTheme: "dark", editorFile: "", auditPath: auditPath, auditContent: auditContent, requestsPath: requestsPath, pluginsList: plList}
+	m := model{list: l, agentsList: agList, requestsList: reqList, vp: vp, ti: ti, ta: ta, cwd: cwd, tabs: tabs, active: 0, panes: newPaneLayout(tabs[0]), width: width, height: height, mdTheme: "dark", editorFile: "", auditPath: auditPath, requestsPath: requestsPath, pluginsList: plList, termOut: os.Stdout, cfg: cfg, scheduleContent: renderSchedule(), jobsList: jbList, myJobs: map[string]bool{}, workspaces: make([]workspace, 1), tocList: newTocList(), searchInput: newSearchInput(), searchList: newSearchList(), muxList: newMuxList(), hostsList: newHostsList(), hostPings: map[string]hostPing{}, ans: newAnsibleView(), k8s: newK8sView(), tf: newTerraformView(), vault: newVaultView(), usage: newUsageView(), gotoInput: newGotoInput(), commentInput: newCommentInput(), fmInput: newFrontmatterInput(), sumInput: newChecksumInput(), tagInput: newTagInput(), tagsList: newTagsList(), yt: newYTView(), agentSearch: newAgentSearchInput(), genInput: newGenInput(), auditFilter: newRecordFilterInput(), reqFilter: newRecordFilterInput(), previews: newPreviewCache(cfg.PreviewCacheMB), allowPath: allowlistPath(), adminList: newAdminList(), connList: newConnList(), connInput: newConnInput(), quota: newSessionQuota()}
+	if cfg.Plain || os.Getenv("TUI_PLAIN") == "1" { m.enablePlain() }
+	if cfg.Keys == "vim" { m.vim = newVimState() }
+	maybeCompactAudit(auditPath, cfg.Audit)
+	m.refreshAudit() // load the audit log if it exists
+	if i := m.tabIndex(cfg.StartTab); m.tabs[i] == cfg.StartTab { m.active, m.panes = i, newPaneLayout(cfg.StartTab) }
+	m.refreshDashboard()
+	m.refreshMux()
+	m.refreshHosts()
+	m.refreshTags()
+	m.visit(jump{kind: "dir", path: cwd})
+	if isAdmin() { m.refreshAdmin(); m.refreshConnections() }
+	m.setContent(T("Welcome to the TUI. Select a file and press Enter to preview or press 'e' to edit. Press 'E' to open in embedded editor.") + "\n")
 	return m
 }
 
+// newFileList builds the Files tab list for dir
+func newFileList(dir string) list.Model {
+	l := list.New(listItemsFromDir(dir), list.NewDefaultDelegate(), 30, height-8)
+	l.Title = T("Files: %s", dir)
+	l.SetShowStatusBar(false)
+	l.SetFilteringEnabled(true)
+	l.SetShowHelp(false)
+	return l
+}
+
+// newEditor builds the embedded textarea editor
+func newEditor(w, h int) textarea.Model {
+	ta := textarea.New()
+	ta.Placeholder = T("Write script here. Ctrl+S to save, Ctrl+Q to exit editor.")
+	ta.SetWidth(w)
+	ta.SetHeight(h)
+	ta.ShowLineNumbers = true
+	return ta
+}
+
 func listItemsFromDir(dir string) []list.Item {
 	files, err := ioutil.ReadDir(dir)
 	if err != nil { return []list.Item{} }
 	out := make([]list.Item, 0, len(files))
 	for _, fi := range files {
-		out = append(out, fileItem{name: fi.Name(), path: filepath.Join(dir, fi.Name()), isDir: fi.IsDir()})
+		out = append(out, fileItem{name: fi.Name(), path: filepath.Join(dir, fi.Name()), isDir: fi.IsDir(), size: fi.Size(), mode: fi.Mode(), mtime: fi.ModTime(), owner: fileOwner(fi)})
 	}
 	return out
 }
@@ -169,30 +293,21 @@ func runExternalViewer(cmd string, args ...string) error {
 
 // loadAgents reads the agents manifest and returns list.Items for the agent list
 func loadAgents() []list.Item {
-	home, _ := os.UserHomeDir()
-	manifest := filepath.Join(home, "bash_functions.d", "40-agents", "manifest.json")
-	b, err := ioutil.ReadFile(manifest)
+	mf, err := loadManifest()
 	if err != nil { return []list.Item{} }
-	var data struct{
-		Agents []struct{ Name string `json:"name"`; Desc string `json:"desc"` } `json:"agents"`
-		Crews []struct{ Name string `json:"name"`; Desc string `json:"desc"` } `json:"crews"`
-	}
-	if err := json.Unmarshal(b, &data); err != nil { return []list.Item{} }
 	out := []list.Item{}
-	for _, a := range data.Agents {
-		out = append(out, agentItem{name: a.Name, desc: a.Desc})
+	for _, a := range mf.Agents {
+		out = append(out, agentItem{name: a.Name, desc: a.Desc, tags: a.Tags, locked: execAllowed(a.Name) != nil})
 	}
-	for _, c := range data.Crews {
-		out = append(out, agentItem{name: c.Name, desc: c.Desc})
+	for _, c := range mf.Crews {
+		out = append(out, agentItem{name: c.Name, desc: c.Desc, tags: c.Tags, crew: len(c.Agents), locked: crewExecAllowed(c) != nil})
 	}
 	return out
 }
 
 func loadRequests(path string) []list.Item {
-	b, err := ioutil.ReadFile(path)
-	if err != nil { return []list.Item{} }
-	var arr []requestItem
-	if err := json.Unmarshal(b, &arr); err != nil { return []list.Item{} }
+	arr, err := listRequests(path)
+	if err != nil { slog.Warn("cannot read requests", "path", path, "err", err); return []list.Item{} }
 	out := []list.Item{}
 	for _, r := range arr { out = append(out, r) }
 	return out
@@ -205,7 +320,8 @@ func loadPlugins() []list.Item {
 	files, err := ioutil.ReadDir(plugDir)
 	if err!=nil { return items }
 	for _, fi := range files {
-		if !fi.IsDir() { continue }
+		// enabled/ holds the symlinks of the enabled plugins
+		if !fi.IsDir() || fi.Name() == "enabled" { continue }
 		name := fi.Name()
 		enabled := "disabled"
 		if _, err := os.Lstat(filepath.Join(plugDir, "enabled", name)); err==nil { enabled = "enabled" }
@@ -216,42 +332,238 @@ func loadPlugins() []list.Item {
 
 // runAgent executes the agent_runner.sh with the given agent name. execFlag controls whether to pass --exec
 func (m *model) runAgent(agent string, execFlag bool) (string, int, error) {
-	home, _ := os.UserHomeDir()
-	script := filepath.Join(home, "bash_functions.d", "40-agents", "agent_runner.sh")
-	// prepend source of SSH_PLUGIN_ENV if set
-	pluginEnv := os.Getenv("SSH_PLUGIN_ENV")
-	var cmd *exec.Cmd
+	return runAgentScript(traceCtx, agent, execFlag)
+}
+
+// startAgentJob queues agent as a background job of this session after checking
+// that the user may exec it; output and audit arrive when the job finishes
+func (m *model) startAgentJob(agent string, execFlag bool) (tea.Cmd, error) {
+	// check permissions: allowed execs list from env
 	if execFlag {
-		if pluginEnv!="" {
-			cmd = exec.Command("/bin/sh", "-c", fmt.Sprintf("[ -f '%s' ] && . '%s'; %s %s --exec", pluginEnv, pluginEnv, script, shellEscape(agent)))
-		} else {
-			cmd = exec.Command("/bin/sh", "-c", fmt.Sprintf("%s %s --exec", script, shellEscape(agent)))
-		}
-	} else {
-		if pluginEnv!="" {
-			cmd = exec.Command("/bin/sh", "-c", fmt.Sprintf("[ -f '%s' ] && . '%s'; %s %s", pluginEnv, pluginEnv, script, shellEscape(agent)))
-		} else {
-			cmd = exec.Command("/bin/sh", "-c", fmt.Sprintf("%s %s", script, shellEscape(agent)))
+		if err := execAllowed(agent); err == errReadOnly {
+			m.denyReadOnly()
+			return nil, err
+		} else if err == errExecNotAllowed {
+			m.status = T("execution not allowed for this user")
+			m.setContent(T("Execution not allowed for this user (no SSH_ALLOWED_EXEC)"))
+			return nil, err
+		} else if err == errExecNoBroker {
+			m.status = T("execution needs an exec broker")
+			m.setContent(T("Execution needs an exec broker (broker_socket in config.json)"))
+			return nil, err
+		} else if err != nil {
+			m.status = T("user not permitted to exec this agent")
+			m.setContent(T("User not permitted to exec this agent"))
+			return nil, err
 		}
 	}
-	cmd.Env = os.Environ()
-	out, err := cmd.CombinedOutput()
-	exitCode := 0
-	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			exitCode = exitErr.ExitCode()
-		} else { exitCode = 1 }
-	}
-	return string(out), exitCode, err
+	if !m.agentQuotaLeft() { return nil, errQuotaReached }
+	j, err := enqueueJob(agent, execFlag, os.Getenv("SSH_USER"))
+	if err != nil { m.status = T("failed to queue agent: %v", err); slog.Warn("failed to queue agent", "err", err); return nil, err }
+	m.myJobs[j.ID] = true
+	m.setContent(T("Started %s (exec=%v) as %s. Output appears here when it finishes; see the Jobs tab for progress.", agent, execFlag, j.ID))
+	m.status = T("queued agent %s (exec=%v) as %s", agent, execFlag, j.ID)
+	return m.startJobsTick(), nil
+}
+
+// setContent replaces the viewport content and remembers the raw text
+func (m *model) setContent(s string) {
+	m.vpContent = s
+	m.md = nil
+	m.fileDiff = nil
+	if m.tocOpen { m.tocOpen = false; m.applySize() }
+	m.layoutContent()
 }
 
 func shellEscape(s string) string { return strings.ReplaceAll(s, "'", "'\\''") }
 
-func (m model) Init() tea.Cmd { return nil }
+// Init reconciles jobs and downloads left over from a previous run straight away and
+// starts the dashboard refresh
+func (m model) Init() tea.Cmd { return tea.Batch(func() tea.Msg { return jobsTickMsg{} }, func() tea.Msg { return downloadsTickMsg{} }, dashboardTick(), waitPreviewChange(m.previews)) }
+
+// startJobsTick begins polling job state unless a poll loop is already running
+func (m *model) startJobsTick() tea.Cmd {
+	if m.jobsTicking { return nil }
+	m.jobsTicking = true
+	return jobsTick()
+}
 
+// Update runs update, then starts loading what the tab now shown needs
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	next, cmd := m.update(msg)
+	nm, ok := next.(model)
+	if !ok { return next, cmd }
+	nm.resizePanes()
+	nm.loadAnsible()
+	nm.loadTerraform()
+	if load := nm.loadK8s(); load != nil { cmd = tea.Batch(cmd, load) }
+	if load := nm.loadImageGrid(); load != nil { return nm, tea.Batch(cmd, load) }
+	if watch := nm.watchMPV(); watch != nil { return nm, tea.Batch(cmd, watch) }
+	return nm, cmd
+}
+
+func (m model) update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
+		// an open dialog takes every key until it is answered or dismissed
+		if m.dialog != nil { return m, m.answer(msg) }
+		// snippet picker: every key goes to it while it is open
+		if m.snippets != nil {
+			if msg.String() == "ctrl+c" { return m, tea.Quit }
+			return m, m.updateSnippetPicker(msg)
+		}
+		// command palette: every key goes to it while it is open
+		if m.palette != nil {
+			if msg.String() == "ctrl+c" { return m, tea.Quit }
+			return m, m.updatePalette(msg)
+		}
+		if msg.String() == "alt+c" { return m, m.openPalette() }
+		// clipboard history: every key goes to it while it is open
+		if m.clips != nil {
+			if msg.String() == "ctrl+c" { return m, tea.Quit }
+			return m, m.updateClipPicker(msg)
+		}
+		if msg.String() == "alt+y" {
+			m.openClipPicker()
+			return m, nil
+		}
+		// the viewport, or the editor buffer, in $PAGER
+		if msg.String() == "alt+l" { return m, m.openPager() }
+		// recent files: every key goes to it while it is open
+		if m.recent != nil {
+			if msg.String() == "ctrl+c" { return m, tea.Quit }
+			return m, m.updateRecentPicker(msg)
+		}
+		if msg.String() == "alt+e" {
+			m.openRecentPicker()
+			return m, nil
+		}
+		// jump list: back and forward through the directories and files visited
+		if msg.String() == "alt+," { return m, m.jumpBy(-1) }
+		if msg.String() == "alt+." { return m, m.jumpBy(1) }
+		if msg.String() == "alt+p" && (m.tabs[m.active] == "Editor" && !m.editorRO || m.tabs[m.active] == "Shell") {
+			m.openSnippetPicker()
+			return m, nil
+		}
+		// new-file picker: every key goes to it while it is open
+		if m.tabs[m.active] == "Files" && m.newFile != nil {
+			if msg.String() == "ctrl+c" { return m, tea.Quit }
+			return m, m.updateNewFileForm(msg)
+		}
+		// batch rename form: every key goes to it while it is open
+		if m.tabs[m.active] == "Files" && m.rename != nil {
+			if msg.String() == "ctrl+c" { return m, tea.Quit }
+			return m, m.updateRenameForm(msg)
+		}
+		// Hosts entry form: every key goes to it while it is open
+		if m.tabs[m.active] == "Hosts" && m.hostForm != nil {
+			if msg.String() == "ctrl+c" { return m, tea.Quit }
+			return m, m.updateHostForm(msg)
+		}
+		// Admin entry form: every key goes to it while it is open
+		if m.tabs[m.active] == "Admin" && m.adminForm != nil {
+			if msg.String() == "ctrl+c" { return m, tea.Quit }
+			return m, m.updateAdminForm(msg)
+		}
+		// Connections filter prompt: every key goes to it while it has focus
+		if m.tabs[m.active] == "Connections" && m.connInput.Focused() {
+			if msg.String() == "ctrl+c" { return m, tea.Quit }
+			return m, m.updateConnInput(msg)
+		}
+		// Editor goto-line prompt: every key goes to it while it has focus
+		if m.tabs[m.active] == "Editor" && m.gotoInput.Focused() {
+			if msg.String() == "ctrl+c" { return m, tea.Quit }
+			return m, m.updateGoto(msg)
+		}
+		// Agents search box: every key goes to it while it has focus
+		if m.tabs[m.active] == "Agents" && m.agentSearch.Focused() {
+			if msg.String() == "ctrl+c" { return m, tea.Quit }
+			return m, m.updateAgentSearch(msg)
+		}
+		// Agents G prompt: every key goes to it while it has focus
+		if m.tabs[m.active] == "Agents" && m.genInput.Focused() {
+			if msg.String() == "ctrl+c" { return m, tea.Quit }
+			return m, m.updateGenInput(msg)
+		}
+		// Audit and Requests filter prompts: every key goes to them while they have focus
+		if tab := m.tabs[m.active]; (tab == "Audit" || tab == "Requests") && m.recordInput(tab).Focused() {
+			if msg.String() == "ctrl+c" { return m, tea.Quit }
+			return m, m.updateRecordFilter(tab, msg)
+		}
+		// Files frontmatter filter prompt: every key goes to it while it has focus
+		if m.tabs[m.active] == "Files" && m.fmInput.Focused() {
+			if msg.String() == "ctrl+c" { return m, tea.Quit }
+			return m, m.updateFrontmatterFilter(msg)
+		}
+		// Files expected checksum prompt: every key goes to it while it has focus
+		if m.tabs[m.active] == "Files" && m.sumInput.Focused() {
+			if msg.String() == "ctrl+c" { return m, tea.Quit }
+			return m, m.updateChecksumInput(msg)
+		}
+		// Files tag prompt: every key goes to it while it has focus
+		if m.tabs[m.active] == "Files" && m.tagInput.Focused() {
+			if msg.String() == "ctrl+c" { return m, tea.Quit }
+			return m, m.updateTagInput(msg)
+		}
+		// YouTube search box: every key goes to it while it has focus
+		if m.tabs[m.active] == "YouTube" && m.yt.input.Focused() {
+			if msg.String() == "ctrl+c" { return m, tea.Quit }
+			return m, m.updateYTInput(msg)
+		}
+		// Ansible tags/limit prompt: every key goes to it while it has focus
+		if m.tabs[m.active] == "Ansible" && m.ans.prompt.Focused() {
+			if msg.String() == "ctrl+c" { return m, tea.Quit }
+			return m, m.updateAnsibleInput(msg)
+		}
+		// Vault passphrase prompt and entry form: every key goes to them while open
+		if m.tabs[m.active] == "Vault" && (m.vault.prompt.Focused() || m.vault.form != nil) {
+			if msg.String() == "ctrl+c" { return m, tea.Quit }
+			return m, m.updateVaultInput(msg)
+		}
+		// Usage directory prompt: every key goes to it while it has focus
+		if m.tabs[m.active] == "Usage" && m.usage.prompt.Focused() {
+			if msg.String() == "ctrl+c" { return m, tea.Quit }
+			return m, m.updateUsageInput(msg)
+		}
+		// Requests comment prompt: every key goes to it while it has focus
+		if m.tabs[m.active] == "Requests" && m.commentInput.Focused() {
+			if msg.String() == "ctrl+c" { return m, tea.Quit }
+			return m, m.updateComment(msg)
+		}
+		// vim key profile: the / or : prompt takes every key while it has focus, the
+		// editor is modal and other tabs get hjkl, gg/G, ctrl+d/ctrl+u and search
+		if m.vim != nil {
+			if m.vim.prompt.Focused() {
+				if msg.String() == "ctrl+c" { return m, tea.Quit }
+				return m, m.updateVimPrompt(msg)
+			}
+			if m.tabs[m.active] == "Editor" && m.snippets == nil {
+				if cmd, ok := m.vimEditorKey(msg); ok { return m, cmd }
+			} else if m.tabs[m.active] != "Shell" && !(m.tabs[m.active] == "Search" && m.searchInput.Focused()) && !m.listFiltering() {
+				out, cmd, done := m.vimNavKey(msg)
+				if done { return m, cmd }
+				msg = out
+			}
+		}
+		// Search tab: while the pattern input has focus every key goes to it
+		if m.tabs[m.active] == "Search" && m.searchInput.Focused() {
+			switch msg.String() {
+			case "ctrl+c":
+				return m, tea.Quit
+			case "esc":
+				m.searchInput.Blur()
+				return m, nil
+			case "enter":
+				pattern := m.searchInput.Value()
+				if pattern == "" { return m, nil }
+				m.searchInput.Blur()
+				m.status = T("searching for %q in %s", pattern, m.cwd)
+				return m, runSearch(m.cwd, pattern)
+			}
+			var cmd tea.Cmd
+			m.searchInput, cmd = m.searchInput.Update(msg)
+			return m, cmd
+		}
 		switch msg.String() {
 		case "q", "ctrl+c":
 				return m, tea.Quit
@@ -262,15 +574,40 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case "shift+tab":
 				m.active = (m.active-1+len(m.tabs))%len(m.tabs)
 				return m, nil
-		case "l":
-				// cycle layout
-				m.layout = (m.layout + 1) % 3
-				m.status = fmt.Sprintf("layout=%d", m.layout)
+		// pane manager: split, focus, close, zoom
+		case "alt+v", "alt+s":
+				next := "Preview"
+				if m.tabs[m.active] == "Preview" { next = "Files" }
+				m.panes.split(msg.String() == "alt+v", m.tabs[m.active], next)
+				m.active = m.tabIndex(next)
+				return m, nil
+		case "alt+o":
+				m.active = m.tabIndex(m.panes.next(m.tabs[m.active]).tab)
+				return m, nil
+		case "alt+x":
+				if !m.panes.close() { m.status = T("cannot close the last pane"); return m, nil }
+				m.active = m.tabIndex(m.panes.focus.tab)
+				return m, nil
+		case "alt+z":
+				m.panes.zoomed = !m.panes.zoomed
+				return m, nil
+		case "alt+q":
+				m.showSelectionQR()
+				return m, nil
+		case "alt+i":
+				// About panel
+				m.panes.show(true, m.tabs[m.active], "Preview")
+				m.setContent(aboutText())
+				return m, nil
+		case "alt+1", "alt+2", "alt+3", "alt+4", "alt+5", "alt+6", "alt+7", "alt+8", "alt+9":
+				m.switchWorkspace(int(msg.String()[4]-'1'))
 				return m, nil
 		case "t":
 				// toggle markdown theme
 				if m.mdTheme=="dark" { m.mdTheme = "light" } else { m.mdTheme = "dark" }
-				m.status = "theme=" + m.mdTheme
+				lipgloss.SetHasDarkBackground(m.mdTheme == "dark")
+				m.status = T("theme=%s", m.mdTheme)
+				m.renderMarkdown()
 				return m, nil
 		case "1","2","3","4","5","6","7":
 				i := int(msg.String()[0]-'1')
@@ -278,142 +615,259 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				return m, nil
 		}
 
+		// copy to clipboard (OSC 52); not in tabs that take text input, nor while a list
+		// filter is being typed
+		if m.tabs[m.active] != "Editor" && m.tabs[m.active] != "Shell" {
+			filtering := m.listFiltering()
+			if msg.String() == "y" && !filtering { return m, m.copySelection() }
+			if msg.String() == "Y" && !filtering { return m, copyToClipboard(m.termOut, "last output", m.lastOutput) }
+			if msg.String() == "O" && !filtering { m.cycleStreams(); return m, nil }
+			// save the viewport (agent/shell output, preview) to a timestamped file
+			if msg.String() == "w" && !filtering {
+				if m.denyReadOnly() { return m, nil }
+				path, err := saveOutput(m.cfg.OutputDir, m.tabs[m.active], m.vpContent)
+				if err != nil { m.status = T("save output failed: %v", err); slog.Warn("save output failed", "err", err) } else { m.status = T("saved output to %s", path) }
+				return m, nil
+			}
+		}
+
+		// Preview tab: ctrl+o toggles the markdown outline; while it is open the arrow
+		// keys move through headings and enter jumps to the selected one
+		if m.tabs[m.active] == "Preview" {
+			switch msg.String() {
+			case "ctrl+o":
+				m.toggleToc()
+				return m, nil
+			case "esc":
+				if m.tocOpen { m.toggleToc() }
+				return m, nil
+			case "enter":
+				if m.tocOpen { m.jumpToHeading() }
+				return m, nil
+			case "W":
+				m.toggleWrap()
+				return m, nil
+			case "left", "right":
+				if !m.tocOpen && m.vpScroll {
+					if msg.String() == "left" { m.scrollColumns(-hScrollStep) } else { m.scrollColumns(hScrollStep) }
+					return m, nil
+				}
+			}
+		}
+
 		// Files tab handling
 		if m.tabs[m.active] == "Files" {
+			if msg.String() == "esc" && m.cancelChecksums() { return m, nil }
+			// diff of two files: hunk navigation, layout, apply to the Editor
+			if m.fileDiff != nil && m.list.FilterState() != list.Filtering {
+				if cmd, ok := m.updateFileDiff(msg.String()); ok { return m, cmd }
+			}
 			if msg.String() == "enter" {
 				sel, ok := m.list.SelectedItem().(fileItem)
 				if !ok { return m, nil }
 				if sel.isDir {
-					m.cwd = sel.path
-					m.list.SetItems(listItemsFromDir(m.cwd))
-					m.list.Title = "Files: " + m.cwd
-					m.status = "cd " + m.cwd
+					m.chdir(sel.path)
 					return m, nil
 				}
-				ext := strings.ToLower(filepath.Ext(sel.name))
-				if ext==".md" || ext==".markdown" {
-					content, _ := ioutil.ReadFile(sel.path)
-					r, _ := glamour.Render(string(content), m.mdTheme)
-					m.vp.SetContent(r)
-					m.active = 2 // Preview (note Agents at index 1)
-					m.status = "preview: " + sel.name
-					return m, nil
-				}
-				m.status = "press 'e' to open in $EDITOR, 'E' to open in embedded editor, or 'p' to print"
+				if docFormat(sel.path) != "" { return m, m.previewFile(sel.path) }
+				m.status = T("press 'e' to open in $EDITOR, 'E' to open in embedded editor, or 'p' to print")
 				return m, nil
 			}
 			if msg.String() == "e" {
 				sel, ok := m.list.SelectedItem().(fileItem)
-				if !ok { return m, nil }
+				if !ok || m.denyReadOnly() { return m, nil }
 				editor := os.Getenv("EDITOR")
 				if editor=="" { editor = "vi" }
-				_ = runExternalViewer(editor, sel.path)
+				if err := runExternalViewer(editor, sel.path); err != nil { slog.Warn("external editor failed", "editor", editor, "path", sel.path, "err", err) }
+				if !sel.isDir { recordRecent(sel.path, "edited") }
 				return m, nil
 			}
+			// open with the program configured for the file's type
+			if msg.String() == "o" && m.list.FilterState() != list.Filtering {
+				sel, ok := m.list.SelectedItem().(fileItem)
+				if !ok || sel.isDir { m.status = T("select a file to open"); return m, nil }
+				return m, m.openExternal(sel.path)
+			}
 			// open in embedded editor
 			if msg.String() == "E" {
 				sel, ok := m.list.SelectedItem().(fileItem)
-				if !ok || sel.isDir { m.status = "no file selected for editor"; return m, nil }
-				b, err := ioutil.ReadFile(sel.path)
-				if err!=nil { m.status = "failed to read file for editor"; return m, nil }
-				m.ta.SetValue(string(b))
-				m.editorFile = sel.path
-				m.active = 3 // Editor tab (Files=0, Agents=1, Preview=2, Editor=3)
-				m.status = "editing: " + sel.name
+				if !ok || sel.isDir { m.status = T("no file selected for editor"); return m, nil }
+				return m, m.openInEditor(sel.path, 1, 1)
+			}
+			// open in embedded editor, read-only
+			if msg.String() == "v" && m.list.FilterState() != list.Filtering {
+				sel, ok := m.list.SelectedItem().(fileItem)
+				if !ok || sel.isDir { m.status = T("no file selected for editor"); return m, nil }
+				return m, m.openReadOnly(sel.path, 1, 1)
+			}
+			// new file from a template
+			if msg.String() == "n" && m.list.FilterState() != list.Filtering && !m.denyReadOnly() { return m, m.openNewFileForm() }
+			// d = delete the selected or marked files, after a dialog
+			if msg.String() == "d" && m.list.FilterState() != list.Filtering { return m, m.deleteSelected() }
+			// m marks files, D diffs the two marked ones
+			if m.list.FilterState() != list.Filtering {
+				if msg.String() == "m" { m.toggleDiffMark(); return m, nil }
+				if msg.String() == "D" { m.diffMarked(); return m, nil }
+			}
+			// H = SHA-256 and MD5 of the marked or selected files, V = check one against a value
+			if m.list.FilterState() != list.Filtering {
+				if msg.String() == "H" { return m, m.checksumSelected() }
+				// P = detached signature of the marked or selected files, or verify a .sig/.asc
+				if msg.String() == "P" { return m, m.signSelected() }
+				// X = age: encrypt to file.age, decrypt file.age
+				if msg.String() == "X" && !m.denyReadOnly() { return m, m.cryptSelected() }
+				// R = batch rename of the marked or selected files
+				if msg.String() == "R" && !m.denyReadOnly() { return m, m.openRenameForm() }
+				// + = tag the marked or selected files, # = show the files with a tag
+				if msg.String() == "+" { return m, m.openTagEdit() }
+				if msg.String() == "#" { return m, m.openTagFilter() }
+				if msg.String() == "V" {
+					m.sumInput.SetValue("")
+					return m, m.sumInput.Focus()
+				}
+			}
+			// compact/detail view and sort order
+			if m.list.FilterState() != list.Filtering && m.updateFileListing(msg.String()) { return m, nil }
+			// markdown files by frontmatter field, e.g. tags=go status=draft
+			if msg.String() == "F" && m.list.FilterState() != list.Filtering {
+				m.fmInput.SetValue(m.files.meta)
+				m.fmInput.CursorEnd()
+				return m, m.fmInput.Focus()
+			}
+			// file transfer: s = scp one-liners, S = one-shot download URL, U = upload URL into cwd
+			if msg.String() == "s" && m.list.FilterState() != list.Filtering {
+				sel, ok := m.list.SelectedItem().(fileItem)
+				if !ok { return m, nil }
+				m.setContent(scpCommands(sel.path))
+				m.status = T("scp commands for %s", sel.name)
+				return m, nil
+			}
+			if msg.String() == "S" && m.list.FilterState() != list.Filtering {
+				sel, ok := m.list.SelectedItem().(fileItem)
+				if !ok || sel.isDir { m.status = T("select a file to share"); return m, nil }
+				u, err := serveDownload(sel.path)
+				if err != nil { m.status = T("share failed: %v", err); slog.Warn("share failed", "err", err); return m, nil }
+				m.setContent(T("One-time download link for %s (valid %s):\n\n  %s\n\n  curl -fSLO '%s'\n", sel.name, transferTTL, u, u))
+				m.status = T("serving %s", sel.name)
+				return m, copyToClipboard(m.termOut, "download URL", u)
+			}
+			if msg.String() == "U" && m.list.FilterState() != list.Filtering {
+				if m.denyReadOnly() { return m, nil }
+				u, err := receiveUploads(m.cwd)
+				if err != nil { m.status = T("upload listener failed: %v", err); slog.Warn("upload listener failed", "err", err); return m, nil }
+				m.setContent(T("Uploads into %s are accepted for %s:\n\n  curl -fS -T ./FILE '%sFILE'\n\nExisting files are never overwritten.\n", m.cwd, transferTTL, u))
+				m.status = T("accepting uploads into %s", m.cwd)
 				return m, nil
 			}
 			if msg.String() == "p" {
 				sel, ok := m.list.SelectedItem().(fileItem)
 				if !ok { return m, nil }
 				b, _ := ioutil.ReadFile(sel.path)
-				m.vp.SetContent(string(b))
+				m.setContent(string(b))
 				m.active = 2
 				return m, nil
 			}
 		}
 
+		// Image tab: thumbnail grid navigation
+		if m.tabs[m.active] == "Image" && m.updateImageGrid(msg.String()) { return m, nil }
+		// YouTube tab: search, format picker and download queue
+		if m.tabs[m.active] == "YouTube" {
+			if cmd, ok := m.updateMPV(msg.String()); ok { return m, cmd }
+			if cmd, ok := m.updateYouTube(msg.String()); ok { return m, cmd }
+		}
+
 		// Agents tab handling
 		if m.tabs[m.active] == "Agents" {
+			// crew viewer: its member list takes the keys until esc
+			if m.crew != nil { return m, m.updateCrew(msg) }
 			if msg.String() == "enter" {
-				// inspect agent
+				// inspect agent, or open a crew's members
 				sel, ok := m.agentsList.SelectedItem().(agentItem)
 				if !ok { return m, nil }
-				m.vp.SetContent(fmt.Sprintf("Agent: %s\n\n%s", sel.name, sel.desc))
+				if sel.crew > 0 { m.openCrew(sel.name); return m, nil }
+				mf, _ := loadManifest()
+				if a, ok := mf.agent(sel.name); ok { m.setContent(a.describe()); return m, nil }
+				m.setContent(T("Agent: %s\n\n%s", sel.name, sel.desc))
 				return m, nil
 			}
-			// r = dry-run, R = exec
+			// c = dry-run now and compare with the last exec
+			if msg.String() == "c" {
+				sel, ok := m.agentsList.SelectedItem().(agentItem)
+				if !ok { return m, nil }
+				m.status = T("dry-running %s for comparison", sel.name)
+				return m, compareAgent(sel.name)
+			}
+			// r = dry-run, R = exec after a dialog
 			if msg.String() == "r" || msg.String() == "R" {
 				sel, ok := m.agentsList.SelectedItem().(agentItem)
 				if !ok { return m, nil }
-				execFlag := msg.String() == "R"
-				// check permissions: allowed execs list from env
-				if execFlag {
-					allowed := os.Getenv("SSH_ALLOWED_EXEC")
-					if allowed == "" {
-						m.status = "execution not allowed for this user"
-						m.vp.SetContent("Execution not allowed for this user (no SSH_ALLOWED_EXEC)")
-						return m, nil
-					}
-					allowedList := strings.Split(allowed, ",")
-					ok := false
-					for _, a := range allowedList { if a == sel.name { ok = true; break } }
-					if !ok {
-						m.status = "user not permitted to exec this agent"
-						m.vp.SetContent("User not permitted to exec this agent")
-						return m, nil
-					}
-				}
-				out, code, err := m.runAgent(sel.name, execFlag)
-				// write audit
-				audit := fmt.Sprintf("%s\tagent=%s\texec=%v\texit=%d\terror=%v\n", time.Now().Format(time.RFC3339), sel.name, execFlag, code, err)
-				ioutil.WriteFile(m.auditPath, []byte(audit), 0o600) // overwrite simple log; append below
-				// append to file
-				f, _ := os.OpenFile(m.auditPath, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0o600)
-				if f != nil {
-					defer f.Close()
-					f.WriteString(audit)
+				// an exec the user may not run is refused by startAgentJob without asking
+				if msg.String() == "r" || execAllowed(sel.name) != nil {
+					cmd, _ := m.startAgentJob(sel.name, msg.String() == "R")
+					return m, cmd
 				}
-				m.vp.SetContent(out)
-				m.status = fmt.Sprintf("ran agent %s (exec=%v) code=%d", sel.name, execFlag, code)
+				m.askDetail(T("Run %s with --exec?", sel.name), T("%s\n\nWith --exec the agent acts for real; r dry-runs it instead.", sel.summary()), func(m *model) tea.Cmd {
+					cmd, _ := m.startAgentJob(sel.name, true)
+					return cmd
+				})
+				return m, nil
+			}
+			// G = draft a new agent from a description
+			if msg.String() == "G" && m.agentsList.FilterState() != list.Filtering { return m, m.openAgentGen() }
+			// s = search names, tags, descriptions and scripts
+			if msg.String() == "s" && m.agentsList.FilterState() != list.Filtering { return m, m.openAgentSearch() }
+			// # = show only agents with the next tag
+			if msg.String() == "#" && m.agentsList.FilterState() != list.Filtering {
+				m.cycleAgentTag()
 				return m, nil
 			}
-			return m, nil
 		}
 
 		// Requests tab handling
 		if m.tabs[m.active] == "Requests" {
 			if msg.String() == "r" {
-				m.requestsList.SetItems(loadRequests(m.requestsPath))
-				m.status = "refreshed requests"
+				m.reloadRequests()
+				m.status = T("refreshed requests")
 				return m, nil
 			}
+			// / = filter queued and decided requests by agent, user, status and text
+			if msg.String() == "/" { return m, m.openRecordFilter("Requests") }
+			// enter = full record and history in a Preview pane, C = comment on it
 			if msg.String() == "enter" {
 				sel, ok := m.requestsList.SelectedItem().(requestItem)
-				if ok { m.vp.SetContent(fmt.Sprintf("Request %s: %s by %s\nNotes: %s", sel.ID, sel.Agent, sel.User, sel.Notes)) }
+				if ok { m.showRequestRecord(sel.ID) }
 				return m, nil
 			}
+			if msg.String() == "C" {
+				if _, ok := m.requestsList.SelectedItem().(requestItem); !ok { return m, nil }
+				m.commentInput.SetValue("")
+				return m, m.commentInput.Focus()
+			}
+			// c = see what the requested agent would do before approving
+			if msg.String() == "c" {
+				sel, ok := m.requestsList.SelectedItem().(requestItem)
+				if !ok { return m, nil }
+				// an apply request has no dry run: show the plan it would apply
+				if dir, ok := terraformRequestDir(sel); ok { return m, showTerraformPlan(sel.ID, dir) }
+				m.status = T("dry-running %s for comparison", sel.Agent)
+				return m, compareAgent(sel.Agent)
+			}
 			// Approve (A) and Deny (D) - only if SSH_IS_ADMIN=1
 			if msg.String() == "A" || msg.String() == "D" {
 				sel, ok := m.requestsList.SelectedItem().(requestItem)
 				if !ok { return m, nil }
-				isAdmin := os.Getenv("SSH_IS_ADMIN") == "1"
-				if !isAdmin {
-					m.status = "admin privileges required"
-					m.vp.SetContent("Admin privileges required to approve/deny requests")
+				if !isAdmin() {
+					m.status = T("admin privileges required")
+					m.setContent(T("Admin privileges required to approve/deny requests"))
 					return m, nil
 				}
-				if msg.String() == "D" {
-					_ = m.markRequest(sel.ID, "denied", "denied by admin")
-					m.requestsList.SetItems(loadRequests(m.requestsPath))
-					m.vp.SetContent("Request denied")
-					return m, nil
-				}
-				// Approve: run the agent with exec
-				out, code, err := m.runAgent(sel.Agent, true)
-				_ = m.markRequest(sel.ID, "approved", fmt.Sprintf("exit=%d err=%v", code, err))
-				m.requestsList.SetItems(loadRequests(m.requestsPath))
-				m.vp.SetContent(out)
-				m.status = fmt.Sprintf("approved request %s", sel.ID)
+				if m.denyReadOnly() { return m, nil }
+				// the request comes off the queue first so a concurrent approval (another
+				// session, `term requests`, approve_request.sh) cannot run it twice
+				if sel.State != "" && sel.State != "pending" { m.status = T("request %s is already %s", sel.ID, T(sel.State)); return m, nil }
+				if msg.String() == "D" { return m, m.confirmDeny(sel) }
+				m.confirmApprove(sel)
 				return m, nil
 			}
 			return m, nil
@@ -421,30 +875,165 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 		// Audit tab handling
 		if m.tabs[m.active] == "Audit" {
+			if m.archives != nil { return m, m.updateAuditArchives(msg) }
+			if msg.String() == "a" { m.openAuditArchives(); return m, nil }
+			// / = filter by agent, user, status and text
+			if msg.String() == "/" { return m, m.openRecordFilter("Audit") }
 			if msg.String() == "u" {
 				m.refreshAudit()
-				m.vp.SetContent(m.auditContent)
-				m.status = "refreshed audit"
+				m.refilterAudit()
+				m.setContent(m.auditContent)
+				m.status = T("refreshed audit")
+				return m, nil
+			}
+			if msg.String() == "f" { return m, m.toggleAuditFollow() }
+		}
+
+		// Plugins tab handling: space enables the selected plugin, or disables it after a dialog
+		if m.tabs[m.active] == "Plugins" && msg.String() == " " && m.pluginsList.FilterState() != list.Filtering { return m, m.togglePlugin() }
+
+		// Admin tab handling: enter shows an entry, n adds, e edits, x removes, i invites, a approves
+		if m.tabs[m.active] == "Admin" {
+			if cmd, ok := m.updateAdmin(msg); ok { return m, cmd }
+		}
+		// Connections tab handling: filter by user, address, event and time, reload
+		if m.tabs[m.active] == "Connections" {
+			if cmd, ok := m.updateConnections(msg.String()); ok { return m, cmd }
+		}
+
+		if m.tabs[m.active] == "Dashboard" && msg.String() == "u" {
+			m.refreshDashboard()
+			return m, nil
+		}
+
+		// Stats tab handling: u recomputes from the audit log, x exports JSON
+		if m.tabs[m.active] == "Stats" {
+			switch msg.String() {
+			case "u":
+				m.refreshAudit()
+				m.status = T("refreshed audit")
+				return m, nil
+			case "x":
+				m.exportStats()
 				return m, nil
 			}
 		}
 
+		// Schedule tab handling
+		if m.tabs[m.active] == "Schedule" {
+			if msg.String() == "u" {
+				m.scheduleContent = renderSchedule()
+				m.status = T("refreshed schedule")
+				return m, nil
+			}
+		}
+
+		// Jobs tab handling
+		if m.tabs[m.active] == "Jobs" {
+			if msg.String() == "enter" {
+				sel, ok := m.jobsList.SelectedItem().(jobItem)
+				if !ok { return m, nil }
+				if lines, err := loadStreams(sel.j.Log); err == nil { m.showOutput(sel.j.Agent, lines) } else { m.setContent(readJobLog(sel.j)) }
+				m.status = fmt.Sprintf("%s: %s [%s]", sel.j.ID, sel.j.Agent, sel.j.State)
+				return m, nil
+			}
+			if msg.String() == "u" {
+				return m, func() tea.Msg { return jobsTickMsg{} }
+			}
+		}
+
+		// Mux tab handling: attach, create from template, kill
+		if m.tabs[m.active] == "Mux" && m.muxList.FilterState() != list.Filtering {
+			if cmd, ok := m.updateMux(msg.String()); ok { return m, cmd }
+		}
+		// Hosts tab handling: ssh, ping, wake-on-LAN, add/edit/remove
+		if m.tabs[m.active] == "Hosts" {
+			if cmd, ok := m.updateHosts(msg.String()); ok { return m, cmd }
+		}
+		// Ansible tab handling: pick a playbook and inventory, run, browse past runs
+		if m.tabs[m.active] == "Ansible" {
+			if cmd, ok := m.updateAnsible(msg.String()); ok { return m, cmd }
+		}
+		// K8s tab handling: browse contexts, namespaces and pods; logs, shell, delete
+		if m.tabs[m.active] == "K8s" {
+			if cmd, ok := m.updateK8s(msg.String()); ok { return m, cmd }
+		}
+		// Terraform tab handling: plan a configuration, browse it, request an apply
+		if m.tabs[m.active] == "Terraform" {
+			if cmd, ok := m.updateTerraform(msg.String()); ok { return m, cmd }
+		}
+		// Vault tab handling: unlock, reveal, add/edit/remove, lock
+		if m.tabs[m.active] == "Vault" {
+			if cmd, ok := m.updateVault(msg.String()); ok { return m, cmd }
+		}
+		// Usage tab handling: scan, drill down, delete, export
+		if m.tabs[m.active] == "Usage" {
+			if cmd, ok := m.updateUsage(msg.String()); ok { return m, cmd }
+		}
+		// Tags tab handling: go to a tagged file, filter Files by tag, untag
+		if m.tabs[m.active] == "Tags" {
+			if cmd, ok := m.updateTags(msg.String()); ok { return m, cmd }
+		}
+
+		// Search tab handling: / edits the pattern, enter previews a match, E edits it
+		if m.tabs[m.active] == "Search" {
+			switch msg.String() {
+			case "/":
+				return m, m.searchInput.Focus()
+			case "enter":
+				return m, m.openSearchHit(false)
+			case "E":
+				return m, m.openSearchHit(true)
+			}
+		}
+
 		// Editor tab handling
 		if m.tabs[m.active] == "Editor" {
 			// handle save (ctrl+s) and quit editor (ctrl+q)
 			if msg.String() == "ctrl+s" {
-				if m.editorFile == "" {
-					m.status = "no file path to save to (open a file from Files with 'E')"
-					return m, nil
-				}
-				err := ioutil.WriteFile(m.editorFile, []byte(m.ta.Value()), 0o600)
-				if err!=nil { m.status = "save failed: " + err.Error() } else { m.status = "saved: " + m.editorFile }
+				// a draft agent is added only after its own question
+				if m.draft != nil { m.confirmDraft(); return m, nil }
+				m.saveEditor()
+				return m, nil
+			}
+			// run the buffer with bash as a job: ctrl+r from a temp copy, alt+r saves
+			// the file first (after confirmation) and runs that
+			if msg.String() == "ctrl+r" { return m, m.runBuffer(false) }
+			if msg.String() == "alt+m" { return m, m.toggleLiveMarkdown() }
+			if m.editorRO && !readOnlyKeys[msg.String()] {
+				m.status = T("read-only: %s (alt+w to edit)", filepath.Base(m.editorFile))
+				return m, nil
+			}
+			if msg.String() == "alt+r" {
+				if m.editorFile == "" { m.status = T("no file path to save to (open a file from Files with 'E')"); return m, nil }
+				m.ask(T("save %s and run it?", filepath.Base(m.editorFile)), func(m *model) tea.Cmd { return m.runBuffer(true) })
+				return m, nil
+			}
+			// insert the standard header, or complete a partial one
+			if msg.String() == "alt+h" {
+				src, at, n := ensureHeader(m.ta.Value(), filepath.Base(m.editorFile), m.cfg.Author)
+				m.rewriteEditor(src, at, n)
+				if n > 0 { m.status = T("header updated (%d lines)", n) } else { m.status = T("header is complete") }
+				return m, nil
+			}
+			if msg.String() == "ctrl+g" {
+				m.gotoInput.SetValue("")
+				m.ta.Blur()
+				return m, m.gotoInput.Focus()
+			}
+			if msg.String() == "ctrl+]" {
+				m.jumpToBracket()
+				return m, nil
+			}
+			if msg.String() == "alt+w" {
+				m.toggleReadOnly()
 				return m, nil
 			}
 			if msg.String() == "ctrl+q" {
 				// exit editor back to Files
 				m.active = 0
-				m.status = "exited editor"
+				m.status = T("exited editor")
+				if m.draft != nil { m.draft = nil; m.ta.SetValue(""); m.status = T("dropped the agent draft") }
 				return m, nil
 			}
 			// otherwise, pass the key to textarea for editing
@@ -457,19 +1046,12 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		if m.tabs[m.active] == "Shell" {
 			if msg.String() == "enter" {
 				cmdStr := strings.TrimSpace(m.ti.Value())
-				if cmdStr=="" { return m, nil }
-				m.status = "running: " + cmdStr
+				// ?question asks the LLM for a command instead of running the line
+				if strings.HasPrefix(cmdStr, "?") { return m, m.askShell(strings.TrimSpace(cmdStr[1:])) }
+				if cmdStr=="" || m.denyReadOnly() || !m.shellQuotaLeft() { return m, nil }
 				m.ti.SetValue("")
-				pluginEnv := os.Getenv("SSH_PLUGIN_ENV")
-				var shellCmd *exec.Cmd
-				if pluginEnv!="" {
-					shellCmd = exec.Command("/bin/sh", "-c", fmt.Sprintf("[ -f '%s' ] && . '%s'; %s", pluginEnv, pluginEnv, cmdStr))
-				} else {
-					shellCmd = exec.Command("/bin/sh", "-c", cmdStr)
-				}
-				out, err := shellCmd.CombinedOutput()
-				if err!=nil { m.vp.SetContent(fmt.Sprintf("(error: %v)\n%s", err, string(out))) }
-				m.vp.SetContent(string(out))
+				m.runShell(cmdStr)
+				m.warnShellQuota()
 				return m, nil
 			}
 			var cmd tea.Cmd
@@ -477,14 +1059,166 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m, cmd
 		}
 
+	case liveMarkdownTickMsg:
+		return m, m.pollLiveMarkdown()
+
+	case downloadsTickMsg:
+		return m, m.syncYT()
+
+	case mpvTickMsg:
+		return m, mpvPoll(mpvSocketPath(), true)
+
+	case mpvStatusMsg:
+		return m, m.mpvStatusUpdate(msg)
+
+	case ytSearchMsg:
+		if msg.query != m.yt.query { return m, nil }
+		m.yt.searching, m.yt.results, m.yt.sel = false, msg.results, 0
+		if msg.err != nil { m.status = T("YouTube search failed: %v", msg.err); slog.Warn("YouTube search failed", "query", msg.query, "err", msg.err) } else { m.status = T("%d results for %q", len(msg.results), msg.query) }
+		return m, nil
+
+	case imageThumbsMsg:
+		if m.images != nil && m.images.dir == msg.dir { m.images.thumbs, m.images.loading = msg.thumbs, false }
+		return m, nil
+
+	case jobsTickMsg:
+		all, done, err := syncJobs(m.auditPath)
+		if err != nil { m.status = T("job sync failed: %v", err); slog.Warn("job sync failed", "err", err) }
+		m.jobsList.SetItems(jobItems(all))
+		m.syncAnsible(all)
+		m.checkAgentQuota(all, done)
+		var cmds []tea.Cmd
+		for _, j := range done {
+			if !m.myJobs[j.ID] { continue }
+			delete(m.myJobs, j.ID)
+			if lines, err := loadStreams(j.Log); err == nil { m.showOutput(j.Agent, lines); m.lastOutput = lines.combined() } else { m.setContent(readJobLog(j)); m.lastOutput = m.vpContent }
+			m.status = T("agent %s (exec=%v) finished: %s exit=%d", j.Agent, j.Exec, j.State, j.Exit)
+			if j.Script == "" && (j.Exit != 0 || j.State == JobLost) {
+				cmds = append(cmds, notifyEventCmd(m.cfg.Notify, notifyEvent{Kind: EventAgentFailure, ID: j.ID, Agent: j.Agent, User: j.User, Exit: j.Exit, Error: j.State}))
+			}
+		}
+		if activeJobs(all) == 0 { m.jobsTicking = false; return m, tea.Batch(cmds...) }
+		m.jobsTicking = true
+		return m, tea.Batch(append(cmds, jobsTick())...)
+
+	case dashboardTickMsg:
+		if m.dashboardVisible() { m.refreshDashboard() }
+		return m, dashboardTick()
+
+	case compareMsg:
+		m.showComparison(msg)
+		return m, nil
+
+	case auditChangedMsg:
+		return m, m.followAudit(msg)
+
+	case crewDoneMsg:
+		if msg.err != nil { m.status = T("crew run failed: %v", msg.err); slog.Warn("crew run failed", "err", msg.err); return m, nil }
+		m.showCrewResult(msg.res)
+		return m, nil
+
+	case previewChangedMsg:
+		// the cache already dropped the old rendering; refresh the preview if it shows the file
+		if m.md != nil && m.md.path == msg.path {
+			m.reloadMarkdown()
+			m.status = T("reloaded %s", filepath.Base(msg.path))
+		}
+		return m, waitPreviewChange(m.previews)
+
+	case hostPingMsg:
+		if msg.err != nil { m.status = T("cannot ping %s: %v", msg.name, msg.err); return m, nil }
+		m.hostPings[msg.name] = msg.ping
+		m.refreshHosts()
+		if msg.ping.up { m.status = T("%s is up (%s)", msg.name, msg.ping.rtt) } else { m.status = T("%s does not answer ping", msg.name) }
+		return m, nil
+
+	case hostSSHDoneMsg:
+		if msg.err != nil { m.status = T("ssh to %s ended: %v", msg.name, msg.err); slog.Warn("ssh session failed", "host", msg.name, "err", msg.err) } else { m.status = T("ssh session to %s closed", msg.name) }
+		return m, nil
+
+	case tfPlanMsg:
+		m.terraformPlanned(msg)
+		return m, nil
+
+	case ageDoneMsg:
+		m.ageDone(msg)
+		return m, nil
+
+	case gpgSignDoneMsg:
+		return m, m.gpgSigned(msg)
+
+	case gpgVerifyMsg:
+		m.showVerification(msg)
+		return m, nil
+
+	case checksumTickMsg:
+		return m, m.checksumTicked(msg.r)
+
+	case k8sListMsg:
+		m.k8sListed(msg)
+		return m, nil
+
+	case k8sLogMsg:
+		if msg.t != m.k8s.tail { return m, nil }
+		return m, waitK8sLog(msg.t)
+
+	case usageTickMsg:
+		return m, m.usageTicked(msg.s)
+
+	case dupeTickMsg:
+		return m, m.dupesTicked(msg.d)
+
+	case pagerDoneMsg:
+		m.pagerDone(msg)
+		return m, nil
+
+	case openerDoneMsg:
+		m.openerDone(msg)
+		return m, nil
+
+	case auditFilterMsg:
+		m.showAuditMatches(msg)
+		return m, nil
+	case requestFilterMsg:
+		m.showRequestMatches(msg)
+		return m, nil
+	case shellSuggestMsg:
+		m.showSuggestion(msg)
+		return m, nil
+	case agentDraftMsg:
+		return m, m.openDraft(msg)
+	case k8sShellDoneMsg:
+		if msg.err != nil { m.status = T("shell in %s ended: %v", msg.pod, msg.err); slog.Warn("kubectl exec failed", "pod", msg.pod, "err", msg.err) } else { m.status = T("shell in %s closed", msg.pod) }
+		return m, nil
+
+	case muxDoneMsg:
+		if msg.err != nil { m.status = T("session ended: %v", msg.err); slog.Warn("mux session failed", "err", msg.err) } else { m.status = T("detached") }
+		m.refreshMux()
+		return m, nil
+
+	case ctlMsg:
+		cmd, err := m.handleCtl(msg.req)
+		if err != nil { msg.reply <- ctlReply{Error: err.Error()} } else { msg.reply <- ctlReply{OK: true} }
+		return m, cmd
+
+	case searchResultMsg:
+		if msg.err != nil { m.status = T("search failed: %v", msg.err); slog.Warn("search failed", "err", msg.err); return m, nil }
+		m.searchDir = msg.dir
+		m.searchList.SetItems(searchItems(msg.dir, msg.hits))
+		m.searchList.Select(0)
+		m.status = T("%d matches for %q (%s)", len(msg.hits), msg.pattern, msg.tool)
+		if len(msg.hits) >= maxSearchHits { m.status += T(", showing the first %d", maxSearchHits) }
+		return m, nil
+
+	case clipboardMsg:
+		if msg.err != nil { m.status = T("copy failed: %v", msg.err); slog.Warn("copy failed", "err", msg.err) } else { m.status = T("copied %s to clipboard (%d bytes)", T(msg.what), msg.n) }
+		return m, nil
+
 	case tea.WindowSizeMsg:
-		m.vp.Width = msg.Width - 32
-		m.vp.Height = msg.Height - 8
-		m.list.SetSize(30, msg.Height-8)
-		m.ta.SetWidth(msg.Width-34)
-		m.ta.SetHeight(msg.Height-12)
-		m.agentsList.SetSize(40, msg.Height-8)
-		m.requestsList.SetSize(60, msg.Height-8)
+		m.width, m.height = msg.Width, msg.Height
+		m.applySize()
+		m.renderMarkdown()
+		m.layoutContent()
 		return m, nil
 	}
 
@@ -509,77 +1243,322 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.pluginsList, cmd = m.pluginsList.Update(msg)
 		return m, cmd
 	}
+	if m.tabs[m.active] == "Jobs" {
+		var cmd tea.Cmd
+		m.jobsList, cmd = m.jobsList.Update(msg)
+		return m, cmd
+	}
+	if m.tabs[m.active] == "Editor" {
+		// cursor blink and the scroll to a jump target happen on textarea updates
+		var cmd tea.Cmd
+		m.ta, cmd = m.ta.Update(msg)
+		return m, cmd
+	}
+	if m.tabs[m.active] == "Mux" {
+		var cmd tea.Cmd
+		m.muxList, cmd = m.muxList.Update(msg)
+		return m, cmd
+	}
+	if m.tabs[m.active] == "Hosts" {
+		var cmd tea.Cmd
+		m.hostsList, cmd = m.hostsList.Update(msg)
+		return m, cmd
+	}
+	if m.tabs[m.active] == "Tags" {
+		var cmd tea.Cmd
+		m.tagsList, cmd = m.tagsList.Update(msg)
+		return m, cmd
+	}
+	if m.tabs[m.active] == "Admin" {
+		var cmd tea.Cmd
+		m.adminList, cmd = m.adminList.Update(msg)
+		return m, cmd
+	}
+	if m.tabs[m.active] == "Connections" {
+		var cmd tea.Cmd
+		m.connList, cmd = m.connList.Update(msg)
+		return m, cmd
+	}
+	if m.tabs[m.active] == "Search" {
+		var cmd tea.Cmd
+		m.searchList, cmd = m.searchList.Update(msg)
+		return m, cmd
+	}
+	if m.tabs[m.active] == "Preview" {
+		var cmd tea.Cmd
+		if m.tocOpen { m.tocList, cmd = m.tocList.Update(msg) } else { m.vp, cmd = m.vp.Update(msg) }
+		return m, cmd
+	}
 
 	return m, nil
 }
 
-func renderSplit(left, right string, width int) string {
-	leftBox := boxStyle.Width(30).Render(left)
-	rightBox := boxStyle.Width(width-32).Render(right)
-	return lipgloss.JoinHorizontal(lipgloss.Top, leftBox, rightBox)
+// helpText is the key summary shown under the panes
+const helpText = "q: quit • tab: next tab • alt+v/alt+s: split • alt+o: next pane • alt+x: close pane • alt+z: zoom • alt+i: about • alt+1-9: workspace • t: toggle md theme • 1-7: switch tabs • enter: open/preview • ctrl+o: outline • /: search • n: new file • d: delete • e: edit • o: open external • E: edit in-TUI • v: view read-only • L: detail view • </>: sort column • -: reverse sort • m/D: mark file, diff marked files • H/V: checksums, check against a value • P: gpg sign, verify .sig/.asc • X: age encrypt/decrypt • R: batch rename (ctrl+t: case) • +/#: tag files, filter by tag • ]/[/|/a/A: next/previous hunk, side by side, apply hunk (diff) • r: dry-run agent • R: run agent (exec, asks first) • c: compare dry-run with last exec • #: filter agents by tag • s: search agents • G: draft agent with an LLM • ?text: suggest a shell command (Shell) • space: fold crew output • C: comment on request • x: export stats • f: follow audit log • a: audit archive • /: filter Audit, Requests (agent=, user=, status=) • space: enable/disable plugin • n/e/x: add/edit/remove allowlist entry (Admin) • enter/p/P/W: ssh, ping, ping all, wake-on-LAN (Hosts) • enter/T/L/c: run playbook, tags, limit, check mode (Ansible) • enter/esc/e/x: drill down, back, shell, delete pod (K8s) • p/enter/z/a: plan, expand, expand all, request apply (Terraform) • enter/r/y/L: unlock, reveal, copy, lock (Vault) • s/enter/esc/d/x/D: scan, down, up, delete, export, duplicates (Usage) • L: hard-link duplicates • enter/#/x/u: go to file, filter Files, untag, reload (Tags) • i/I: create/list invites • a: approve pending key • f/c/enter: filter, clear, same address (Connections) • y/Y: copy selection/last output • alt+y: clipboard history • alt+e: recent files • alt+,/alt+.: jump back/forward • alt+c: command palette, calculator • alt+q: show selection as QR code • O: stdout/stderr/markdown view • w: save output • alt+l: open in $PAGER • W: wrap/scroll long lines • Ctrl+S: save • alt+h: script header • alt+p: snippets • ctrl+r/alt+r: run buffer/file • ctrl+g: go to line • ctrl+]: jump to bracket • alt+w: toggle read-only • alt+m: live markdown preview • F: filter markdown by frontmatter • arrows/enter/r: image grid, full view, reload (Image) • s/d/p/x/R/c: search, downloads, play, cancel, retry, clear finished (YouTube) • space/←/→/+/-/m/S: mpv controls • Ctrl+Q: quit editor"
+
+// applySize sizes the components of the tabs on screen to their panes; a tab not on
+// screen keeps its last size until it is shown
+func (m *model) applySize() {
+	areas := m.panes.areas(m.tabs[m.active], m.width, m.height-5)
+	for _, a := range areas { m.sizeTab(a.tab, a.w, a.h, len(areas) > 1) }
+	m.paneSizes = fmt.Sprint(m.width, m.height, areas)
 }
 
-func (m model) View() string {
-	// tabs row
-	var b strings.Builder
-	for i, t := range m.tabs {
-		if i==m.active {
-			b.WriteString(activeTabStyle.Render(fmt.Sprintf(" %d:%s ", i+1, t)))
-		} else {
-			b.WriteString(tabStyle.Render(fmt.Sprintf(" %d:%s ", i+1, t)))
-		}
+// resizePanes re-lays the components out when a split, close, zoom or tab switch has
+// changed what is on screen or how big its panes are
+func (m *model) resizePanes() {
+	if fmt.Sprint(m.width, m.height, m.panes.areas(m.tabs[m.active], m.width, m.height-5)) == m.paneSizes { return }
+	m.applySize()
+	m.renderMarkdown()
+	m.layoutContent()
+}
+
+// sizeTab sizes the components of tab to a w x h area. Alone on screen a tab keeps the
+// margins of the full-screen layout; a split pane gives it all of the pane.
+func (m *model) sizeTab(tab string, w, h int, split bool) {
+	wide := func(margin int) int {
+		if split { return w }
+		return w - margin
 	}
-	b.WriteString("\n\n")
+	narrow := func(n int) int {
+		if n > w { return w }
+		return n
+	}
+	switch tab {
+	case "Files":
+		m.list.SetSize(narrow(30), h-3)
+	case "Agents":
+		m.agentsList.SetSize(narrow(40), h-3)
+	case "Requests":
+		m.requestsList.SetSize(narrow(60), h-3)
+	case "Plugins":
+		m.pluginsList.SetSize(narrow(40), h-3)
+	case "Preview", "Shell":
+		m.vp.Width = wide(32)
+		if m.tocOpen { m.vp.Width -= tocWidth + 1 }
+		m.vp.Height = h - 3
+		m.tocList.SetSize(tocWidth, h-3)
+	case "Editor":
+		m.ta.SetWidth(wide(34))
+		m.ta.SetHeight(h - 7)
+	case "Jobs":
+		m.jobsList.SetSize(narrow(60), h-3)
+	case "Search":
+		m.searchInput.Width = wide(34)
+		m.searchList.SetSize(wide(34), h-9)
+	case "Mux":
+		m.muxList.SetSize(narrow(60), h-3)
+	case "Hosts":
+		m.hostsList.SetSize(wide(34), h-5)
+	case "Tags":
+		m.tagsList.SetSize(wide(4), h-3)
+	case "Admin":
+		m.adminList.SetSize(wide(34), h-3)
+	case "Connections":
+		m.connList.SetSize(wide(4), h-5)
+	}
+}
+
+// tabIndex returns the index of the named tab (0 if unknown)
+func (m model) tabIndex(name string) int {
+	for i, t := range m.tabs { if t == name { return i } }
+	return 0
+}
 
-	// content
-	var mainContent string
-	switch m.tabs[m.active] {
+// tabContent renders one tab's body; panes call it with their inner size
+func (m model) tabContent(tab string, w, h int) string {
+	if m.clips != nil && tab == m.clips.target { return m.clips.list.View() }
+	if m.recent != nil && tab == m.recent.target { return m.recent.list.View() }
+	switch tab {
 	case "Files":
-		mainContent = m.list.View()
+		if m.newFile != nil { return m.newFile.view() }
+		if m.rename != nil { return m.rename.view(w, h, m.plain) }
+		return m.filesView()
 	case "Agents":
-		mainContent = m.agentsList.View()
+		if m.crew != nil { return m.crew.list.View() }
+		if m.genInput.Focused() { return m.genInput.View() + "\n" + m.agentsList.View() }
+		if m.agentSearch.Focused() || m.agentSearch.Value() != "" { return m.agentSearch.View() + "\n" + m.agentsList.View() }
+		return m.agentsList.View()
 	case "Requests":
-		mainContent = m.requestsList.View()
+		if m.commentInput.Focused() { return m.requestsList.View() + "\n" + m.commentInput.View() }
+		if m.reqFilter.Focused() || m.reqFilter.Value() != "" { return recordFilterView(m.reqFilter) + "\n" + m.requestsList.View() }
+		return m.requestsList.View()
 	case "Audit":
-		mainContent = m.auditContent
+		if m.archives != nil { return m.archives.View() }
+		if m.auditFilter.Focused() || m.auditFilter.Value() != "" { return recordFilterView(m.auditFilter) + "\n" + m.auditMatches }
+		if m.follow != nil { return auditTail(m.auditContent, h-3) }
+		return m.auditContent
 	case "Plugins":
-		mainContent = m.pluginsList.View()
+		return m.pluginsList.View()
 	case "Preview":
-		mainContent = m.vp.View()
+		if m.tocOpen { return lipgloss.JoinHorizontal(lipgloss.Top, m.tocList.View(), " ", m.vp.View()) }
+		if m.vim != nil && m.vim.prompt.Focused() { return m.vp.View() + "\n" + m.vim.prompt.View() }
+		if ind := m.columnIndicator(); ind != "" { return m.vp.View() + "\n" + helpStyle.Render(ind) }
+		return m.vp.View()
 	case "Editor":
-		mainContent = m.ta.View()
+		if m.snippets != nil { return m.snippets.list.View() }
+		v := m.ta.View()
+		if m.draft != nil { v = helpStyle.Render(T("draft agent for %q: ctrl+s adds it, ctrl+q drops it", m.draft.description)) + "\n" + v }
+		if m.editorRO { v = activeTabStyle.Reverse(true).Render(T(" RO ")) + " " + helpStyle.Render(T("%s is read-only; alt+w to edit", m.editorFile)) + "\n" + v }
+		if m.gotoInput.Focused() { return v + "\n" + m.gotoInput.View() }
+		if hint := m.bracketHint(); hint != "" { v += "\n" + hint }
+		if m.vim != nil { v += "\n" + m.vimModeLine() }
+		return v
 	case "Shell":
-		mainContent = m.vp.View() + "\n" + m.ti.View()
+		if m.snippets != nil { return m.snippets.list.View() }
+		return m.vp.View() + "\n" + m.ti.View()
 	case "Image":
-		mainContent = "Image tab: select an image in Files and press 'o' to view with 'viu' or 'xdg-open'.\n"
+		return m.imageView(w, h)
 	case "YouTube":
-		mainContent = "YouTube tab: select a file containing a video URL and press 'o' to play with mpv.\n"
+		return m.youTubeView(w, h)
+	case "Schedule":
+		return m.scheduleContent
+	case "Jobs":
+		return m.jobsList.View()
+	case "Search":
+		return m.searchView()
+	case "Stats":
+		return renderStats(m.stats, w, m.plain)
+	case "Dashboard":
+		return m.dashboard
+	case "Mux":
+		return m.muxList.View()
+	case "Hosts":
+		return m.hostsView()
+	case "Ansible":
+		return m.ansibleTabView(w, h)
+	case "K8s":
+		return m.k8sTabView(w, h)
+	case "Terraform":
+		return m.terraformTabView(w, h)
+	case "Vault":
+		return m.vaultTabView()
+	case "Usage":
+		return m.usageTabView(w, h)
+	case "Tags":
+		return m.tagsList.View()
+	case "Admin":
+		return m.adminView()
+	case "Connections":
+		return m.connectionsView()
 	}
+	return ""
+}
 
-	// layout rendering
-	switch m.layout {
-	case LayoutSingle:
-		b.WriteString(mainContent)
-	case LayoutVerticalSplit:
-		left := m.list.View()
-		right := m.vp.View()
-		b.WriteString(renderSplit(left, right, width))
-	case LayoutHorizontalSplit:
-		b.WriteString(m.list.View())
-		b.WriteString("\n--\n")
-		b.WriteString(m.vp.View())
+func (m model) View() string {
+	if m.plain { return m.plainView() }
+	// tabs row
+	var b strings.Builder
+	for i, t := range m.tabs {
+		label := T(t)
+		if t == "Editor" && m.editorRO { label += " [RO]" }
+		if i==m.active {
+			b.WriteString(activeTabStyle.Render(fmt.Sprintf(" %d:%s ", i+1, label)))
+		} else {
+			b.WriteString(tabStyle.Render(fmt.Sprintf(" %d:%s ", i+1, label)))
+		}
+	}
+	if len(m.workspaces) > 1 { b.WriteString(helpStyle.Render(T(" [ws %d/%d]", m.ws+1, len(m.workspaces)))) }
+	b.WriteString("\n\n")
+
+	// panes; leave room for the tab row, help and status lines
+	if m.dialog != nil {
+		b.WriteString(lipgloss.Place(m.width, m.height-5, lipgloss.Center, lipgloss.Center, m.dialogView()))
+	} else {
+		b.WriteString(m.panes.render(m.tabs[m.active], m.width, m.height-5, m.tabContent))
 	}
 
 	b.WriteString("\n")
-	b.WriteString(helpStyle.Render("q: quit • tab: next pane • l: cycle layout • t: toggle md theme • 1-7: switch tabs • enter: open/preview • e: edit • o: open external • E: edit in-TUI • r: dry-run agent • R: run agent (exec) • Ctrl+S: save • Ctrl+Q: quit editor"))
-	if m.status!="" { b.WriteString("\n" + helpStyle.Render("status: ") + " " + m.status) }
+	if m.palette != nil { b.WriteString(m.paletteView()) } else { b.WriteString(helpStyle.Render(T(helpText))) }
+	if m.status!="" { b.WriteString("\n" + helpStyle.Render(T("status: ")) + " " + m.status) }
 	return b.String()
 }
 
 func main() {
-	p := tea.NewProgram(initialModel(), tea.WithAltScreen())
+	loadSessionTicket()
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "scheduler":
+			os.Exit(runScheduler(os.Args[2:]))
+		case "watch":
+			os.Exit(runWatch(os.Args[2:]))
+		case "hooks":
+			os.Exit(runHooks(os.Args[2:]))
+		case "requests":
+			os.Exit(runRequests(os.Args[2:]))
+		case "crew":
+			os.Exit(runCrewCLI(os.Args[2:]))
+		case "broker":
+			os.Exit(runBroker(os.Args[2:]))
+		case "ctl":
+			os.Exit(runCtl(os.Args[2:]))
+		case "gateway":
+			os.Exit(runGateway(os.Args[2:]))
+		case "web":
+			os.Exit(runWeb(os.Args[2:]))
+		case "grpc":
+			os.Exit(runGRPC(os.Args[2:]))
+		case "script":
+			os.Exit(runScript(os.Args[2:]))
+		case "self-update":
+			os.Exit(runSelfUpdate(os.Args[2:]))
+		case "version":
+			fmt.Println(versionString())
+			os.Exit(0)
+		}
+	}
+	os.Exit(runTUI())
+}
+
+// runTUI runs the interactive program and returns the exit code once its deferred
+// cleanups have run
+func runTUI() int {
+	plain := flag.Bool("plain", false, "screen-reader friendly mode: no alt screen, borders or color-only cues")
+	traceFlag := flag.Bool("trace", false, "export OpenTelemetry spans over OTLP (endpoint from OTEL_EXPORTER_OTLP_ENDPOINT)")
+	edit := flag.String("edit", "", "open `path[:line[:col]]` in the embedded editor, e.g. from shellcheck -f gcc output")
+	view := flag.String("view", "", "open `path[:line[:col]]` in the embedded editor read-only")
+	showVersion := flag.Bool("version", false, "print version information and exit")
+	flag.Parse()
+	if *showVersion { fmt.Println(versionString()); return 0 }
+	cfg := loadConfig()
+	// stderr is hidden behind the alt screen, so the TUI logs to a file
+	defer setupLogging(cfg.Log, "term", true)()
+	if *traceFlag || cfg.Tracing {
+		defer setupTracing("cbw-term")()
+		ctx, span := startSpan(traceCtx, "tui.session", attribute.String("user", transferUser()), attribute.String("remote", os.Getenv("SSH_CLIENT")))
+		traceCtx = ctx
+		defer span.End()
+	}
+	defer registerSession()()
+	defer flushBus(busTimeout)
+	m := initialModel()
+	if *edit != "" {
+		path, line, col := parseFileTarget(*edit)
+		// the focus command is not needed before the program starts
+		_ = m.openInEditor(path, line, col)
+	}
+	if *view != "" {
+		path, line, col := parseFileTarget(*view)
+		_ = m.openReadOnly(path, line, col)
+	}
+	opts := []tea.ProgramOption{tea.WithAltScreen()}
+	if *plain || m.plain {
+		m.enablePlain()
+		opts = nil
+	} else {
+		// ask the terminal before bubbletea takes over stdin
+		m.applyTheme()
+	}
+	guard := newCrashGuard(m)
+	p := tea.NewProgram(guard, opts...)
+	defer listenCtl(p)()
 	if err := p.Start(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error starting TUI: %v\n", err)
-		os.Exit(1)
+		return 1
+	}
+	if guard.state.panicked {
+		if guard.state.report != "" { fmt.Fprintln(os.Stderr, T("The TUI crashed. Crash report: %s", guard.state.report)) } else { fmt.Fprintln(os.Stderr, T("The TUI crashed; the crash report could not be written (see the log).")) }
+		return 1
 	}
+	return 0
 }
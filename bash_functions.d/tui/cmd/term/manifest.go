@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// agentManifest is 40-agents/manifest.json, the list of agents and crews
+type agentManifest struct {
+	Agents    []agentSpec            `json:"agents"`
+	Crews     []crewSpec             `json:"crews"`
+	Sandboxes map[string]sandboxSpec `json:"sandboxes,omitempty"`
+}
+
+// agentSpec is one agent. Entry is relative to the manifest's directory. Env, Dir and
+// Interpreter are applied by the TUI when it starts agent_runner.sh, which finds the
+// entry and interpreter in AGENT_ENTRY and AGENT_INTERPRETER.
+type agentSpec struct {
+	Name           string            `json:"name"`
+	Desc           string            `json:"desc"`
+	Entry          string            `json:"entry,omitempty"`
+	Tags           []string          `json:"tags,omitempty"`
+	Tools          []string          `json:"tools,omitempty"`
+	AllowedActions []string          `json:"allowed_actions,omitempty"`
+	Env            map[string]string `json:"env,omitempty"`
+	Secrets        map[string]string `json:"secrets,omitempty"`     // variable -> vault entry, set when the run starts
+	Dir            string            `json:"dir,omitempty"`         // working directory, ~ expanded
+	Interpreter    string            `json:"interpreter,omitempty"` // e.g. python3; default: run the entry itself
+	Exec           *execACL          `json:"exec,omitempty"`        // who may run it with --exec, merged into the server allowlist
+	Sandbox        string            `json:"sandbox,omitempty"`     // name of the sandboxes profile exec runs use
+	Limits         *limitSpec        `json:"limits,omitempty"`      // CPU, memory and descriptor caps for every run
+	Output         string            `json:"output,omitempty"`      // "markdown" or "text"; default: guessed from stdout
+}
+
+// execACL names the users and allowlist roles that may exec an agent. wish-server
+// adds the agent to SSH_ALLOWED_EXEC for them; the TUI itself only reads that variable.
+type execACL struct {
+	Users []string `json:"users,omitempty"`
+	Roles []string `json:"roles,omitempty"` // "admin" matches every is_admin entry
+}
+
+type crewSpec struct {
+	Name    string              `json:"name"`
+	Desc    string              `json:"desc"`
+	Agents  []string            `json:"agents"`
+	Tags    []string            `json:"tags,omitempty"`
+	Depends map[string][]string `json:"depends,omitempty"` // member -> members that must finish first
+}
+
+// manifestPath is next to agent_runner.sh
+func manifestPath() string { return filepath.Join(filepath.Dir(agentRunnerPath()), "manifest.json") }
+
+func loadManifest() (agentManifest, error) {
+	var mf agentManifest
+	b, err := ioutil.ReadFile(manifestPath())
+	if err != nil { return mf, err }
+	if err := json.Unmarshal(b, &mf); err != nil { return mf, fmt.Errorf("%s: %w", manifestPath(), err) }
+	return mf, nil
+}
+
+func (mf agentManifest) agent(name string) (agentSpec, bool) {
+	for _, a := range mf.Agents { if a.Name == name { return a, true } }
+	return agentSpec{}, false
+}
+
+var envName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// entryPath is Entry made absolute; "" when the agent has none
+func (a agentSpec) entryPath() string {
+	if a.Entry == "" || filepath.IsAbs(a.Entry) { return a.Entry }
+	return filepath.Join(filepath.Dir(manifestPath()), a.Entry)
+}
+
+// shellPrefix is prepended to the runner's command line: a cd into Dir, then the
+// agent's variables as assignments on the runner command itself
+func (a agentSpec) shellPrefix() string {
+	var b strings.Builder
+	if a.Dir != "" { fmt.Fprintf(&b, "cd '%s' && ", shellEscape(expandHome(a.Dir))) }
+	keys := make([]string, 0, len(a.Env))
+	for k := range a.Env { keys = append(keys, k) }
+	sort.Strings(keys)
+	for _, k := range keys {
+		if !envName.MatchString(k) { slog.Warn("manifest: skipping invalid variable name", "agent", a.Name, "name", k); continue }
+		fmt.Fprintf(&b, "%s='%s' ", k, shellEscape(a.Env[k]))
+	}
+	if a.Entry != "" { fmt.Fprintf(&b, "AGENT_ENTRY='%s' ", shellEscape(a.entryPath())) }
+	if a.Interpreter != "" { fmt.Fprintf(&b, "AGENT_INTERPRETER='%s' ", shellEscape(a.Interpreter)) }
+	return b.String()
+}
+
+// agentRunPrefix looks agent up in the manifest; "" when it is not there or the
+// manifest cannot be read, so the runner gets the environment it always had
+func agentRunPrefix(agent string) string {
+	mf, err := loadManifest()
+	if err != nil {
+		if !os.IsNotExist(err) { slog.Warn("manifest unreadable", "err", err) }
+		return ""
+	}
+	a, ok := mf.agent(agent)
+	if !ok { return "" }
+	return a.shellPrefix()
+}
+
+// describe is the Agents tab detail of a
+func (a agentSpec) describe() string {
+	var b strings.Builder
+	b.WriteString(T("Agent: %s\n\n%s", a.Name, a.Desc) + "\n")
+	field := func(name, v string) { if v != "" { fmt.Fprintf(&b, "\n  %-12s %s", name, v) } }
+	field(T("entry"), a.Entry)
+	field(T("interpreter"), a.Interpreter)
+	field(T("directory"), a.Dir)
+	field(T("sandbox"), a.Sandbox)
+	field(T("output"), a.Output)
+	if l := a.Limits; l != nil {
+		var parts []string
+		if l.CPU > 0 { parts = append(parts, fmt.Sprintf("cpu %d%%", l.CPU)) }
+		if l.Memory != "" { parts = append(parts, "memory "+l.Memory) }
+		if l.CPUTime > 0 { parts = append(parts, fmt.Sprintf("cpu time %ds", l.CPUTime)) }
+		if l.NoFile > 0 { parts = append(parts, fmt.Sprintf("nofile %d", l.NoFile)) }
+		field(T("limits"), strings.Join(parts, ", "))
+	}
+	field(T("tags"), strings.Join(a.Tags, ", "))
+	field(T("tools"), strings.Join(a.Tools, ", "))
+	if a.Exec != nil {
+		field(T("exec users"), strings.Join(a.Exec.Users, ", "))
+		field(T("exec roles"), strings.Join(a.Exec.Roles, ", "))
+	}
+	if err := execAllowed(a.Name); err != nil { field(T("exec"), T("not allowed for you (%v)", err)) }
+	keys := make([]string, 0, len(a.Env))
+	for k := range a.Env { keys = append(keys, k) }
+	sort.Strings(keys)
+	for _, k := range keys { field(T("env"), k+"="+a.Env[k]) }
+	keys = keys[:0]
+	for k := range a.Secrets { keys = append(keys, k) }
+	sort.Strings(keys)
+	for _, k := range keys { field(T("secret"), k+" <- vault:"+a.Secrets[k]) }
+	return b.String()
+}
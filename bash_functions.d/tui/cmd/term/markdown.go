@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/glamour"
+)
+
+// tocWidth is the width of the outline pane shown next to the preview
+const tocWidth = 30
+
+var (
+	atxHeading = regexp.MustCompile(`^ {0,3}(#{1,6})\s+(.*?)(?:\s+#+)?\s*$`)
+	mdLink     = regexp.MustCompile(`!?\[([^\]]*)\]\([^)]*\)`)
+	ansiEscape = regexp.MustCompile(`\x1b\[[0-9;]*[A-Za-z]`)
+)
+
+// mdDoc is the markdown document currently shown in the viewport. The source is kept
+// so the document can be re-rendered when the viewport width or theme changes.
+type mdDoc struct {
+	source string
+	path   string    // file the source came from, "" if none; keys the preview cache
+	mtime  time.Time // of path when it was read
+	size   int64
+	width  int    // word-wrap width of the last render
+	theme  string // glamour style of the last render
+	toc    []tocItem
+}
+
+// tocItem is one heading in the outline; line is its row in the rendered output,
+// or -1 if it could not be located.
+type tocItem struct {
+	level int
+	title string
+	line  int
+}
+
+func (t tocItem) Title() string       { return strings.Repeat("  ", t.level-1) + t.title }
+func (t tocItem) Description() string { if t.line < 0 { return "" }; return T("line %d", t.line+1) }
+func (t tocItem) FilterValue() string { return t.title }
+
+// showMarkdown renders src into the viewport, wrapped to the viewport width
+func (m *model) showMarkdown(src string) {
+	m.setContent("")
+	m.vp.GotoTop()
+	m.md = &mdDoc{source: src}
+	m.renderMarkdown()
+}
+
+// showMarkdownFile previews the markdown, AsciiDoc or Org file at path, rendering it
+// only when the preview cache has no rendering of this version at the current width and theme
+func (m *model) showMarkdownFile(path string) error {
+	fi, err := os.Stat(path)
+	if err != nil { return err }
+	b, err := ioutil.ReadFile(path)
+	if err != nil { return err }
+	m.setContent("")
+	m.vp.GotoTop()
+	m.md = &mdDoc{source: docMarkdown(path, b), path: path, mtime: fi.ModTime(), size: fi.Size()}
+	m.renderMarkdown()
+	return nil
+}
+
+// reloadMarkdown re-reads the previewed file after it changed, keeping the scroll position
+func (m *model) reloadMarkdown() {
+	d := m.md
+	fi, err := os.Stat(d.path)
+	if err != nil { return }
+	b, err := ioutil.ReadFile(d.path)
+	if err != nil { return }
+	d.source, d.mtime, d.size = docMarkdown(d.path, b), fi.ModTime(), fi.Size()
+	d.width = 0 // force a render
+	m.renderMarkdown()
+}
+
+// renderMarkdown re-renders the cached document if the width or theme changed since
+// the last render, keeping the scroll position.
+func (m *model) renderMarkdown() {
+	d := m.md
+	if d == nil || d.width == m.vp.Width && d.theme == m.mdTheme { return }
+	w := m.vp.Width
+	if w < 20 { w = 20 }
+	key := ""
+	if d.path != "" && m.previews != nil { key = previewKey(d.path, d.mtime, d.size, fmt.Sprintf("md/%d/%s", w, m.mdTheme)) }
+	// frontmatter is shown as a table above the document rather than as a paragraph
+	fm, body := splitFrontmatter(d.source)
+	out, cached := "", false
+	if key != "" { out, cached = m.previews.get(key) }
+	if !cached {
+		out = body
+		if r, err := glamour.NewTermRenderer(glamour.WithStandardStyle(m.mdTheme), glamour.WithWordWrap(w)); err == nil {
+			if s, err := r.Render(body); err == nil {
+				out = s
+				if key != "" { m.previews.put(key, d.path, out) }
+			}
+		}
+	}
+	table := renderFrontmatter(fm, w, m.plain)
+	off := m.vp.YOffset
+	m.vpContent = table + out
+	m.vp.SetContent(m.vpContent)
+	m.vp.SetYOffset(off)
+	d.width, d.theme = m.vp.Width, m.mdTheme
+	// headings are found in the body alone, so a title field cannot shadow them
+	d.toc = locateHeadings(mdHeadings(body), out)
+	for i, n := 0, strings.Count(table, "\n"); i < len(d.toc) && n > 0; i++ {
+		if d.toc[i].line >= 0 { d.toc[i].line += n }
+	}
+	if m.tocOpen { m.tocList.SetItems(tocListItems(d.toc)) }
+}
+
+// mdHeadings returns the ATX headings of src in order, skipping fenced code blocks
+func mdHeadings(src string) []tocItem {
+	var out []tocItem
+	fence := ""
+	for _, line := range strings.Split(src, "\n") {
+		t := strings.TrimSpace(line)
+		if fence != "" {
+			if strings.HasPrefix(t, fence) { fence = "" }
+			continue
+		}
+		if strings.HasPrefix(t, "```") || strings.HasPrefix(t, "~~~") { fence = t[:3]; continue }
+		if mt := atxHeading.FindStringSubmatch(line); mt != nil {
+			out = append(out, tocItem{level: len(mt[1]), title: plainHeading(mt[2]), line: -1})
+		}
+	}
+	return out
+}
+
+// plainHeading drops inline markup so the title matches the rendered text
+func plainHeading(s string) string {
+	s = mdLink.ReplaceAllString(s, "$1")
+	return strings.NewReplacer("`", "", "**", "", "__", "").Replace(s)
+}
+
+// locateHeadings finds each heading's row in the rendered document. Headings are
+// searched in order so repeated titles map to successive sections.
+func locateHeadings(toc []tocItem, rendered string) []tocItem {
+	lines := strings.Split(ansiEscape.ReplaceAllString(rendered, ""), "\n")
+	row := 0
+	for i := range toc {
+		for r := row; r < len(lines); r++ {
+			if strings.Contains(lines[r], toc[i].title) { toc[i].line, row = r, r+1; break }
+		}
+	}
+	return toc
+}
+
+func tocListItems(toc []tocItem) []list.Item {
+	out := make([]list.Item, len(toc))
+	for i, t := range toc { out[i] = t }
+	return out
+}
+
+// newTocList builds the outline pane; filtering is off so letter keys keep their
+// global meaning while it has focus
+func newTocList() list.Model {
+	l := list.New(nil, list.NewDefaultDelegate(), tocWidth, height-8)
+	l.Title = T("Outline")
+	l.SetShowHelp(false)
+	l.SetShowStatusBar(false)
+	l.SetFilteringEnabled(false)
+	return l
+}
+
+// toggleToc opens or closes the outline next to the preview. The preview narrows
+// while the outline is open, so the document is re-wrapped either way.
+func (m *model) toggleToc() {
+	if !m.tocOpen && m.md == nil { m.status = T("no markdown document to outline"); return }
+	m.tocOpen = !m.tocOpen
+	m.applySize()
+	m.renderMarkdown()
+	if m.tocOpen { m.tocList.SetItems(tocListItems(m.md.toc)) }
+}
+
+// jumpToHeading scrolls the preview to the selected outline entry
+func (m *model) jumpToHeading() {
+	t, ok := m.tocList.SelectedItem().(tocItem)
+	if !ok { return }
+	if t.line < 0 { m.status = T("section not found: %s", t.title); return }
+	m.vp.SetYOffset(t.line)
+	m.status = T("section: %s", t.title)
+}
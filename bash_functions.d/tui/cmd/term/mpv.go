@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// mpv plays media in its own window; the YouTube tab drives it over mpv's JSON IPC
+// socket, which the TUI asks for when it starts mpv. An mpv started by hand with
+// --input-ipc-server=<the same path> is picked up as well.
+
+// mpvTimeout bounds one exchange with mpv
+const mpvTimeout = 500 * time.Millisecond
+
+func mpvSocketPath() string { return filepath.Join(tuiDataDir(), "mpv.sock") }
+
+// mpvState is what the transport controls show
+type mpvState struct {
+	Title    string
+	Pos, Dur float64 // seconds
+	Paused   bool
+	Muted    bool
+	Volume   float64
+}
+
+type mpvTickMsg struct{}
+
+type mpvStatusMsg struct {
+	st   mpvState
+	err  error
+	loop bool // from the poll loop, which schedules the next poll
+}
+
+func mpvTick() tea.Cmd {
+	return tea.Tick(500*time.Millisecond, func(time.Time) tea.Msg { return mpvTickMsg{} })
+}
+
+// mpvPoll asks mpv for its state without blocking the UI
+func mpvPoll(sock string, loop bool) tea.Cmd {
+	return func() tea.Msg {
+		st, err := mpvStatus(sock)
+		return mpvStatusMsg{st: st, err: err, loop: loop}
+	}
+}
+
+// mpvCommand sends commands to mpv on one connection and returns their data in order.
+// mpv answers with request_id set and may interleave event lines, which are skipped.
+func mpvCommand(sock string, cmds ...[]interface{}) ([]json.RawMessage, error) {
+	c, err := net.DialTimeout("unix", sock, mpvTimeout)
+	if err != nil { return nil, err }
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(mpvTimeout))
+	for i, cmd := range cmds {
+		b, _ := json.Marshal(map[string]interface{}{"command": cmd, "request_id": i + 1})
+		if _, err := c.Write(append(b, '\n')); err != nil { return nil, err }
+	}
+	out := make([]json.RawMessage, len(cmds))
+	sc := bufio.NewScanner(c)
+	for seen := 0; seen < len(cmds) && sc.Scan(); {
+		var r struct {
+			Error     string          `json:"error"`
+			Data      json.RawMessage `json:"data"`
+			RequestID int             `json:"request_id"`
+			Event     string          `json:"event"`
+		}
+		if json.Unmarshal(sc.Bytes(), &r) != nil || r.Event != "" || r.RequestID < 1 || r.RequestID > len(cmds) { continue }
+		seen++
+		// a property that is not available yet (no file loaded) is an error, not a failure
+		if r.Error == "success" { out[r.RequestID-1] = r.Data }
+	}
+	if err := sc.Err(); err != nil { return nil, err }
+	return out, nil
+}
+
+func mpvStatus(sock string) (mpvState, error) {
+	var st mpvState
+	props := []string{"media-title", "time-pos", "duration", "pause", "mute", "volume"}
+	cmds := make([][]interface{}, len(props))
+	for i, p := range props { cmds[i] = []interface{}{"get_property", p} }
+	res, err := mpvCommand(sock, cmds...)
+	if err != nil { return st, err }
+	json.Unmarshal(res[0], &st.Title)
+	json.Unmarshal(res[1], &st.Pos)
+	json.Unmarshal(res[2], &st.Dur)
+	json.Unmarshal(res[3], &st.Paused)
+	json.Unmarshal(res[4], &st.Muted)
+	json.Unmarshal(res[5], &st.Volume)
+	return st, nil
+}
+
+// playInMPV plays target, a file or a URL mpv streams through yt-dlp, in the running
+// mpv if there is one and in a new mpv window otherwise
+func playInMPV(sock, target string) error {
+	if _, err := mpvCommand(sock, []interface{}{"loadfile", target, "replace"}); err == nil { return nil }
+	if _, err := exec.LookPath("mpv"); err != nil { return fmt.Errorf("mpv not found in PATH") }
+	os.Remove(sock)
+	cmd := exec.Command("mpv", "--input-ipc-server="+sock, "--force-window=immediate", "--really-quiet", "--", target)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil { return err }
+	go cmd.Wait()
+	// the socket appears once mpv is up
+	for i := 0; i < 20; i++ {
+		if _, err := os.Stat(sock); err == nil { return nil }
+		time.Sleep(100 * time.Millisecond)
+	}
+	return fmt.Errorf("mpv did not open its IPC socket %s", sock)
+}
+
+// mpvKeys are the transport controls in the YouTube tab while mpv plays
+var mpvKeys = map[string][]interface{}{
+	"space":       {"cycle", "pause"},
+	" ":           {"cycle", "pause"},
+	"left":        {"seek", -5, "relative"},
+	"right":       {"seek", 5, "relative"},
+	"shift+left":  {"seek", -60, "relative"},
+	"shift+right": {"seek", 60, "relative"},
+	"+":           {"add", "volume", 5},
+	"=":           {"add", "volume", 5},
+	"-":           {"add", "volume", -5},
+	"m":           {"cycle", "mute"},
+	"S":           {"quit"},
+}
+
+// updateMPV sends a transport key to mpv and reports whether the key was one
+func (m *model) updateMPV(key string) (tea.Cmd, bool) {
+	y := m.yt
+	cmd, ok := mpvKeys[key]
+	if !ok || y.player == nil { return nil, false }
+	if _, err := mpvCommand(mpvSocketPath(), cmd); err != nil {
+		m.status = T("mpv is not responding: %v", err)
+		y.player = nil
+		return nil, true
+	}
+	if key == "S" { y.player = nil; m.status = T("playback stopped"); return nil, true }
+	// show the effect without waiting for the next poll
+	return mpvPoll(mpvSocketPath(), false), true
+}
+
+// play starts target in mpv and begins polling it for the transport controls
+func (m *model) play(target, title string) tea.Cmd {
+	if err := playInMPV(mpvSocketPath(), target); err != nil { m.status = T("cannot play: %v", err); return nil }
+	m.status = T("playing %s", title)
+	return m.startMPVTick()
+}
+
+// watchMPV picks up an mpv that is already running, e.g. from an earlier session,
+// when the YouTube tab is shown
+func (m *model) watchMPV() tea.Cmd {
+	if m.tabs[m.active] != "YouTube" || m.yt.mpvTicking { return nil }
+	if _, err := os.Stat(mpvSocketPath()); err != nil { return nil }
+	return m.startMPVTick()
+}
+
+// startMPVTick polls mpv unless a poll loop is already running
+func (m *model) startMPVTick() tea.Cmd {
+	if m.yt.mpvTicking { return nil }
+	m.yt.mpvTicking = true
+	return mpvPoll(mpvSocketPath(), true)
+}
+
+// mpvStatusUpdate records what mpv reported; the loop ends when mpv is gone
+func (m *model) mpvStatusUpdate(msg mpvStatusMsg) tea.Cmd {
+	y := m.yt
+	if msg.err != nil {
+		if y.player != nil { m.status = T("playback ended") }
+		y.player = nil
+		if msg.loop { y.mpvTicking = false }
+		// nothing listens on a socket left behind by an mpv that was killed
+		if errors.Is(msg.err, syscall.ECONNREFUSED) { os.Remove(mpvSocketPath()) }
+		return nil
+	}
+	st := msg.st
+	y.player = &st
+	if !msg.loop { return nil }
+	return mpvTick()
+}
+
+// mpvView is the transport line: state, position, a track bar and the volume
+func (m model) mpvView(w int) string {
+	st := m.yt.player
+	if st == nil { return "" }
+	icon := "▶"
+	if st.Paused { icon = "⏸" }
+	if m.plain {
+		icon = T("playing")
+		if st.Paused { icon = T("paused") }
+	}
+	vol := fmt.Sprintf("vol %.0f%%", st.Volume)
+	if st.Muted { vol = T("muted") }
+	times := mpvClock(st.Pos) + " / " + mpvClock(st.Dur)
+	title := truncateCells(st.Title, max(10, w/3))
+	barW := max(10, w-len([]rune(title))-len(times)-len(vol)-10)
+	if m.plain { return fmt.Sprintf("%s %s %s %s", icon, title, times, vol) + "\n" }
+	filled := 0
+	if st.Dur > 0 { filled = min(barW, int(st.Pos/st.Dur*float64(barW))) }
+	bar := diffAddStyle.Render(strings.Repeat("━", filled)) + "●" + helpStyle.Render(strings.Repeat("─", max(0, barW-filled-1)))
+	return fmt.Sprintf("%s %s  %s %s  %s", icon, title, times, bar, vol) + "\n" +
+		helpStyle.Render(T("space: pause • ←/→: seek 5s • shift+←/→: 1 min • +/-: volume • m: mute • S: stop")) + "\n"
+}
+
+// mpvClock formats seconds as m:ss or h:mm:ss
+func mpvClock(s float64) string {
+	d := int(s)
+	if d >= 3600 { return fmt.Sprintf("%d:%02d:%02d", d/3600, d/60%60, d%60) }
+	return fmt.Sprintf("%d:%02d", d/60, d%60)
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// muxTemplate describes a session the Mux tab can create. tmux sessions get one
+// window per entry in Windows; zellij sessions start from Layout.
+type muxTemplate struct {
+	Name    string      `json:"name"`
+	Tool    string      `json:"tool,omitempty"` // tmux (default) or zellij
+	Dir     string      `json:"dir,omitempty"`
+	Windows []muxWindow `json:"windows,omitempty"`
+	Layout  string      `json:"layout,omitempty"`
+}
+
+type muxWindow struct {
+	Name    string `json:"name"`
+	Command string `json:"command,omitempty"`
+}
+
+// muxSession is one tmux or zellij session
+type muxSession struct {
+	tool     string
+	name     string
+	windows  int
+	attached bool
+	activity time.Time // zero when unknown
+	exited   bool      // zellij keeps exited sessions around for resurrection
+}
+
+// muxStaleAfter is how long a detached tmux session may sit idle before X kills it
+const muxStaleAfter = 24 * time.Hour
+
+func (s muxSession) stale(now time.Time) bool {
+	if s.exited { return true }
+	return !s.attached && !s.activity.IsZero() && now.Sub(s.activity) > muxStaleAfter
+}
+
+type muxItem struct {
+	s    *muxSession
+	tmpl *muxTemplate
+}
+
+func (i muxItem) Title() string {
+	if i.tmpl != nil { return T("new: %s", i.tmpl.Name) }
+	return i.s.tool + ": " + i.s.name
+}
+
+func (i muxItem) Description() string {
+	if i.tmpl != nil {
+		tool := i.tmpl.Tool
+		if tool == "" { tool = "tmux" }
+		return T("create from template (%s)", tool)
+	}
+	var parts []string
+	if i.s.windows > 0 { parts = append(parts, T("%d windows", i.s.windows)) }
+	switch {
+	case i.s.exited:
+		parts = append(parts, T("exited"))
+	case i.s.attached:
+		parts = append(parts, T("attached"))
+	default:
+		parts = append(parts, T("detached"))
+	}
+	if !i.s.activity.IsZero() { parts = append(parts, T("active %s ago", time.Since(i.s.activity).Round(time.Minute))) }
+	if i.s.stale(time.Now()) { parts = append(parts, T("stale")) }
+	return strings.Join(parts, ", ")
+}
+
+func (i muxItem) FilterValue() string {
+	if i.tmpl != nil { return i.tmpl.Name }
+	return i.s.name
+}
+
+func newMuxList() list.Model {
+	l := list.New(nil, list.NewDefaultDelegate(), 60, height-8)
+	l.Title = T("Sessions")
+	return l
+}
+
+// muxSessions lists the sessions of whichever of tmux and zellij is installed
+func muxSessions() []muxSession {
+	var out []muxSession
+	if _, err := exec.LookPath("tmux"); err == nil {
+		// fails with "no server running" when there are no sessions
+		b, _ := exec.Command("tmux", "list-sessions", "-F", "#{session_name}\t#{session_windows}\t#{session_attached}\t#{session_activity}").Output()
+		out = append(out, parseTmuxSessions(string(b))...)
+	}
+	if _, err := exec.LookPath("zellij"); err == nil {
+		b, _ := exec.Command("zellij", "list-sessions", "--no-formatting").Output()
+		out = append(out, parseZellijSessions(string(b))...)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].activity.After(out[j].activity) })
+	return out
+}
+
+func parseTmuxSessions(s string) []muxSession {
+	var out []muxSession
+	for _, line := range strings.Split(strings.TrimSpace(s), "\n") {
+		f := strings.Split(line, "\t")
+		if len(f) != 4 { continue }
+		ms := muxSession{tool: "tmux", name: f[0]}
+		ms.windows, _ = strconv.Atoi(f[1])
+		n, _ := strconv.Atoi(f[2])
+		ms.attached = n > 0
+		if secs, err := strconv.ParseInt(f[3], 10, 64); err == nil { ms.activity = time.Unix(secs, 0) }
+		out = append(out, ms)
+	}
+	return out
+}
+
+// parseZellijSessions reads lines like "dev [Created 2h ago]" and
+// "old [Created 3days ago] (EXITED - attach to resurrect)"
+func parseZellijSessions(s string) []muxSession {
+	var out []muxSession
+	for _, line := range strings.Split(strings.TrimSpace(s), "\n") {
+		f := strings.Fields(line)
+		if len(f) == 0 { continue }
+		out = append(out, muxSession{tool: "zellij", name: f[0], exited: strings.Contains(line, "EXITED"), attached: strings.Contains(line, "(current)")})
+	}
+	return out
+}
+
+// muxAttachCmd attaches to a session; bubbletea hands the terminal over until it detaches
+func muxAttachCmd(s muxSession) *exec.Cmd {
+	if s.tool == "zellij" { return exec.Command("zellij", "attach", s.name) }
+	return exec.Command("tmux", "attach-session", "-t", s.name)
+}
+
+func muxKillCmd(s muxSession) *exec.Cmd {
+	if s.tool == "zellij" { return exec.Command("zellij", "delete-session", "--force", s.name) }
+	return exec.Command("tmux", "kill-session", "-t", s.name)
+}
+
+// muxCreate starts a detached session from t, named after it with a numeric suffix
+// when taken, and returns the command that attaches to it
+func muxCreate(t muxTemplate, existing []muxSession) (*exec.Cmd, error) {
+	name := t.Name
+	taken := map[string]bool{}
+	for _, s := range existing { taken[s.name] = true }
+	for n := 2; taken[name]; n++ { name = fmt.Sprintf("%s-%d", t.Name, n) }
+	dir := expandHome(t.Dir)
+	if dir == "" { dir, _ = os.Getwd() }
+	if t.Tool == "zellij" {
+		// zellij cannot start detached; the session is created on attach
+		args := []string{"--session", name}
+		if t.Layout != "" { args = append(args, "--layout", expandHome(t.Layout)) }
+		c := exec.Command("zellij", args...)
+		c.Dir = dir
+		return c, nil
+	}
+	wins := t.Windows
+	if len(wins) == 0 { wins = []muxWindow{{Name: t.Name}} }
+	args := []string{"new-session", "-d", "-s", name, "-c", dir, "-n", wins[0].Name}
+	if wins[0].Command != "" { args = append(args, wins[0].Command) }
+	if out, err := exec.Command("tmux", args...).CombinedOutput(); err != nil { return nil, fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out))) }
+	for _, w := range wins[1:] {
+		args := []string{"new-window", "-t", name, "-c", dir, "-n", w.Name}
+		if w.Command != "" { args = append(args, w.Command) }
+		if out, err := exec.Command("tmux", args...).CombinedOutput(); err != nil { return nil, fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out))) }
+	}
+	return exec.Command("tmux", "attach-session", "-t", name), nil
+}
+
+// muxDoneMsg arrives when an attached session detaches or exits
+type muxDoneMsg struct{ err error }
+
+func (m *model) refreshMux() {
+	var items []list.Item
+	for _, s := range muxSessions() {
+		s := s
+		items = append(items, muxItem{s: &s})
+	}
+	for i := range m.cfg.Mux { items = append(items, muxItem{tmpl: &m.cfg.Mux[i]}) }
+	m.muxList.SetItems(items)
+}
+
+// updateMux handles the Mux tab keys: enter attaches (or creates from a template),
+// K kills the selected session and X kills all stale ones
+func (m *model) updateMux(key string) (tea.Cmd, bool) {
+	sel, ok := m.muxList.SelectedItem().(muxItem)
+	switch key {
+	case "u":
+		m.refreshMux()
+		m.status = T("refreshed sessions")
+		return nil, true
+	case "enter":
+		if !ok || m.denyReadOnly() { return nil, true }
+		var c *exec.Cmd
+		if sel.tmpl != nil {
+			var err error
+			if c, err = muxCreate(*sel.tmpl, muxSessions()); err != nil { m.status = T("failed to create session: %v", err); return nil, true }
+		} else {
+			c = muxAttachCmd(*sel.s)
+		}
+		return tea.ExecProcess(c, func(err error) tea.Msg { return muxDoneMsg{err} }), true
+	case "K":
+		if !ok || sel.s == nil || m.denyReadOnly() { return nil, true }
+		s := *sel.s
+		m.ask(T("kill %s session %s?", s.tool, s.name), func(m *model) tea.Cmd {
+			if out, err := muxKillCmd(s).CombinedOutput(); err != nil { m.status = T("kill failed: %v %s", err, strings.TrimSpace(string(out))); return nil }
+			m.refreshMux()
+			m.status = T("killed %s", s.name)
+			return nil
+		})
+		return nil, true
+	case "X":
+		if m.denyReadOnly() { return nil, true }
+		var stale []muxSession
+		now := time.Now()
+		for _, s := range muxSessions() { if s.stale(now) { stale = append(stale, s) } }
+		if len(stale) == 0 { m.status = T("no stale sessions"); return nil, true }
+		m.ask(T("kill %d stale sessions?", len(stale)), func(m *model) tea.Cmd {
+			killed := 0
+			for _, s := range stale { if muxKillCmd(s).Run() == nil { killed++ } }
+			m.refreshMux()
+			m.status = T("killed %d of %d stale sessions", killed, len(stale))
+			return nil
+		})
+		return nil, true
+	}
+	return nil, false
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// notification event kinds
+const (
+	EventRequest      = "request"       // a new approval request is pending
+	EventApproval     = "approval"      // a request was approved or denied
+	EventAgentFailure = "agent_failure" // an agent job or scheduled run exited non-zero
+)
+
+// notifyConfig selects how admins hear about events; see config.json
+type notifyConfig struct {
+	Desktop   bool              `json:"desktop,omitempty"` // notify-send on the admin's desktop session
+	Email     *emailConfig      `json:"email,omitempty"`
+	Webhooks  []webhookConfig   `json:"webhooks,omitempty"`
+	Templates map[string]string `json:"templates,omitempty"` // per event kind; first line is the subject
+	Bus       *busConfig        `json:"bus,omitempty"`       // NATS or MQTT for automation; see bus.go
+}
+
+type emailConfig struct {
+	SMTP        string   `json:"smtp"` // host:port
+	From        string   `json:"from"`
+	To          []string `json:"to"`
+	Username    string   `json:"username,omitempty"`
+	PasswordEnv string   `json:"password_env,omitempty"` // env var holding the SMTP password
+	Events      []string `json:"events,omitempty"`       // default: request only
+}
+
+// webhookConfig is one chat-ops destination
+type webhookConfig struct {
+	Type     string   `json:"type"`                // slack, discord or telegram
+	URL      string   `json:"url,omitempty"`       // incoming webhook URL (slack, discord)
+	ChatID   string   `json:"chat_id,omitempty"`   // telegram chat
+	TokenEnv string   `json:"token_env,omitempty"` // env var holding the telegram bot token
+	Events   []string `json:"events,omitempty"`    // default: all events
+}
+
+// notifyEvent is what templates are rendered with
+type notifyEvent struct {
+	Kind     string
+	ID       string // request or job id
+	Agent    string
+	User     string // requester
+	Notes    string
+	By       string // approver
+	Decision string // approved or denied
+	Exit     int
+	Error    string
+}
+
+// defaultTemplate is used for kinds without a template in config.json; the fixed
+// text is translated, the placeholders are filled per event
+func defaultTemplate(kind string) string {
+	switch kind {
+	case EventRequest:
+		return T("Approval needed: %s", "{{.Agent}}") + "\n" + T("Request %s: %s by %s\nNotes: %s", "{{.ID}}", "{{.Agent}}", "{{.User}}", "{{.Notes}}") + "\n\n" + T("Approve or deny in the Requests tab.")
+	case EventApproval:
+		return T("Request %s %s by %s", "{{.ID}}", "{{.Decision}}", "{{.By}}") + "\n" + T("%s requested by %s, exit %s", "{{.Agent}}", "{{.User}}", "{{.Exit}}")
+	case EventAgentFailure:
+		return T("Agent %s failed", "{{.Agent}}") + "\n" + T("%s (%s) exited %s: %s", "{{.Agent}}", "{{.ID}}", "{{.Exit}}", "{{.Error}}")
+	}
+	return kind + " {{.ID}}"
+}
+
+// notifier delivers one message through some channel
+type notifier interface {
+	name() string
+	wants(kind string) bool
+	send(subject, body string) error
+}
+
+// notifiers returns the channels enabled in cfg
+func notifiers(cfg notifyConfig) []notifier {
+	var out []notifier
+	if cfg.Desktop { out = append(out, desktopNotifier{}) }
+	if cfg.Email != nil && cfg.Email.SMTP != "" && len(cfg.Email.To) > 0 { out = append(out, emailNotifier{*cfg.Email}) }
+	for _, w := range cfg.Webhooks { out = append(out, webhookNotifier{w}) }
+	return out
+}
+
+func inEvents(events []string, kind string) bool {
+	for _, e := range events { if e == kind { return true } }
+	return false
+}
+
+type desktopNotifier struct{}
+
+func (desktopNotifier) name() string           { return "desktop" }
+func (desktopNotifier) wants(kind string) bool { return kind == EventRequest }
+
+// send runs notify-send. Services started outside the desktop session have no
+// DBUS_SESSION_BUS_ADDRESS, so fall back to the user's bus under /run/user.
+func (desktopNotifier) send(subject, body string) error {
+	cmd := exec.Command("notify-send", "--app-name=cbw", subject, body)
+	cmd.Env = os.Environ()
+	if os.Getenv("DBUS_SESSION_BUS_ADDRESS") == "" {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("DBUS_SESSION_BUS_ADDRESS=unix:path=/run/user/%d/bus", os.Getuid()))
+	}
+	if out, err := cmd.CombinedOutput(); err != nil { return fmt.Errorf("notify-send: %v: %s", err, strings.TrimSpace(string(out))) }
+	return nil
+}
+
+type emailNotifier struct{ cfg emailConfig }
+
+func (emailNotifier) name() string { return "email" }
+func (e emailNotifier) wants(kind string) bool {
+	if len(e.cfg.Events) == 0 { return kind == EventRequest }
+	return inEvents(e.cfg.Events, kind)
+}
+
+func (e emailNotifier) send(subject, body string) error {
+	var auth smtp.Auth
+	if e.cfg.Username != "" {
+		host, _, err := net.SplitHostPort(e.cfg.SMTP)
+		if err != nil { return err }
+		auth = smtp.PlainAuth("", e.cfg.Username, os.Getenv(e.cfg.PasswordEnv), host)
+	}
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s\r\n",
+		e.cfg.From, strings.Join(e.cfg.To, ", "), subject, time.Now().Format(time.RFC1123Z), strings.ReplaceAll(body, "\n", "\r\n"))
+	return smtp.SendMail(e.cfg.SMTP, auth, e.cfg.From, e.cfg.To, []byte(msg))
+}
+
+// webhookNotifier posts to a Slack or Discord incoming webhook or the Telegram bot API
+type webhookNotifier struct{ cfg webhookConfig }
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+func (w webhookNotifier) name() string { return w.cfg.Type }
+func (w webhookNotifier) wants(kind string) bool {
+	return len(w.cfg.Events) == 0 || inEvents(w.cfg.Events, kind)
+}
+
+func (w webhookNotifier) send(subject, body string) error {
+	text := subject
+	if body != "" { text += "\n" + body }
+	url := w.cfg.URL
+	var payload interface{}
+	switch w.cfg.Type {
+	case "slack":
+		payload = map[string]string{"text": text}
+	case "discord":
+		payload = map[string]string{"content": text}
+	case "telegram":
+		token := os.Getenv(w.cfg.TokenEnv)
+		if token == "" { return fmt.Errorf("telegram: %s is not set", w.cfg.TokenEnv) }
+		url = "https://api.telegram.org/bot" + token + "/sendMessage"
+		payload = map[string]string{"chat_id": w.cfg.ChatID, "text": text}
+	default:
+		return fmt.Errorf("unknown webhook type %q", w.cfg.Type)
+	}
+	b, err := json.Marshal(payload)
+	if err != nil { return err }
+	resp, err := webhookClient.Post(url, "application/json", bytes.NewReader(b))
+	if err != nil {
+		// do not leak the telegram token through the request URL in logs
+		if w.cfg.Type == "telegram" { return fmt.Errorf("telegram: request failed") }
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 { return fmt.Errorf("%s: HTTP %s", w.cfg.Type, resp.Status) }
+	return nil
+}
+
+// renderEvent renders ev with its configured or default template into a subject
+// (the first line) and body
+func renderEvent(cfg notifyConfig, ev notifyEvent) (subject, body string) {
+	src, ok := cfg.Templates[ev.Kind]
+	if !ok { src = defaultTemplate(ev.Kind) }
+	out := src
+	if tpl, err := template.New(ev.Kind).Parse(src); err == nil {
+		var b bytes.Buffer
+		if err := tpl.Execute(&b, ev); err == nil { out = b.String() } else { slog.Warn("notify template failed", "kind", ev.Kind, "err", err) }
+	} else {
+		slog.Warn("notify template invalid", "kind", ev.Kind, "err", err)
+	}
+	parts := strings.SplitN(strings.TrimSpace(out), "\n", 2)
+	subject = parts[0]
+	if len(parts) > 1 { body = strings.TrimSpace(parts[1]) }
+	return subject, body
+}
+
+// sendEvent delivers ev to every channel that wants its kind and reports whether
+// at least one accepted it
+func sendEvent(cfg notifyConfig, ev notifyEvent) bool {
+	subject, body := renderEvent(cfg, ev)
+	delivered := false
+	for _, n := range notifiers(cfg) {
+		if !n.wants(ev.Kind) { continue }
+		if err := n.send(subject, body); err != nil { slog.Warn("notify failed", "channel", n.name(), "kind", ev.Kind, "id", ev.ID, "err", err); continue }
+		delivered = true
+	}
+	return delivered
+}
+
+// notifyEventCmd sends ev from the TUI without blocking the update loop
+func notifyEventCmd(cfg notifyConfig, ev notifyEvent) tea.Cmd {
+	if len(cfg.Webhooks) == 0 && cfg.Email == nil && !cfg.Desktop { return nil }
+	return func() tea.Msg { sendEvent(cfg, ev); return nil }
+}
+
+// notifyStatePath records which requests have already been announced
+func notifyStatePath() string { return filepath.Join(tuiDataDir(), "notify_state.json") }
+
+type notifyState struct {
+	Requests []string `json:"requests"`
+}
+
+// notifyPendingRequests announces requests that appeared since the last call. A
+// request counts as announced once any channel accepts it; if all fail it is retried
+// on the next call.
+func notifyPendingRequests(cfg notifyConfig, requestsPath string) error {
+	wanted := cfg.Bus.wants(BusRequestCreated)
+	for _, n := range notifiers(cfg) { if n.wants(EventRequest) { wanted = true } }
+	if !wanted { return nil }
+	reqs, err := listRequests(requestsPath)
+	if err != nil { return err }
+
+	var st notifyState
+	if b, err := ioutil.ReadFile(notifyStatePath()); err == nil { _ = json.Unmarshal(b, &st) }
+	seen := map[string]bool{}
+	for _, id := range st.Requests { seen[id] = true }
+
+	// keep only pending ids so the state file does not grow forever
+	next := notifyState{Requests: []string{}}
+	for _, r := range reqs {
+		if seen[r.ID] { next.Requests = append(next.Requests, r.ID); continue }
+		sent := sendEvent(cfg, notifyEvent{Kind: EventRequest, ID: r.ID, Agent: r.Agent, User: r.User, Notes: r.Notes})
+		if emitEvent(busEvent{Kind: BusRequestCreated, ID: r.ID, Agent: r.Agent, User: r.User, Notes: r.Notes, Source: "request"}) || sent {
+			next.Requests = append(next.Requests, r.ID)
+		}
+	}
+	b, err := json.MarshalIndent(next, "", "  ")
+	if err != nil { return err }
+	tmp := notifyStatePath() + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0o600); err != nil { return err }
+	return os.Rename(tmp, notifyStatePath())
+}
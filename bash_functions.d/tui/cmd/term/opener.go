@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// opener is a program o can open a file with. Cmd is split on spaces and {} is
+// replaced by the path, which is appended when there is no {}; a terminal opener
+// takes over the screen until it exits, the others run in their own window.
+type opener struct {
+	Cmd      string `json:"cmd"`
+	Terminal bool   `json:"terminal,omitempty"`
+}
+
+// defaultOpeners are tried when config.json has no opener for a key; the first whose
+// program is installed opens the file
+var defaultOpeners = map[string][]opener{
+	"image/*":         {{Cmd: "xdg-open {}"}, {Cmd: "open {}"}},
+	"video/*":         {{Cmd: "mpv {}"}, {Cmd: "xdg-open {}"}, {Cmd: "open {}"}},
+	"audio/*":         {{Cmd: "mpv --force-window {}"}, {Cmd: "xdg-open {}"}, {Cmd: "open {}"}},
+	"application/pdf": {{Cmd: "zathura {}"}, {Cmd: "xdg-open {}"}, {Cmd: "open {}"}},
+	"text/*":          {{Cmd: "less -R {}", Terminal: true}},
+	"*":               {{Cmd: "xdg-open {}"}, {Cmd: "open {}"}},
+}
+
+// readOnlyOpener is the only opener of a read-only session: with lessEnv, less can
+// neither edit the file nor start a shell, which any other program might
+var readOnlyOpener = opener{Cmd: "less -R {}", Terminal: true}
+
+// fileMIME is the media type of path by its extension, or by its first bytes when
+// the extension says nothing
+func fileMIME(path string) string {
+	t := mime.TypeByExtension(filepath.Ext(path))
+	if t == "" {
+		f, err := os.Open(path)
+		if err != nil { return "" }
+		defer f.Close()
+		b := make([]byte, 512)
+		n, _ := f.Read(b)
+		t = http.DetectContentType(b[:n])
+	}
+	t, _, _ = strings.Cut(t, ";")
+	return strings.TrimSpace(t)
+}
+
+// openerKeys are the keys looked up for path, most specific first: the extension,
+// the media type, its major type and *
+func openerKeys(path string) []string {
+	var keys []string
+	if ext := strings.ToLower(filepath.Ext(path)); ext != "" { keys = append(keys, ext) }
+	if t := fileMIME(path); t != "" {
+		major, _, _ := strings.Cut(t, "/")
+		keys = append(keys, t, major+"/*")
+	}
+	return append(keys, "*")
+}
+
+// pickOpener finds how to open path: the openers of each key, most specific first and
+// config.json before the defaults, are tried until one is installed
+func pickOpener(path string, cfg map[string][]opener) (opener, error) {
+	var tried []string
+	seen := map[string]bool{}
+	for _, k := range openerKeys(path) {
+		for _, set := range []map[string][]opener{cfg, defaultOpeners} {
+			for _, o := range set[k] {
+				args := strings.Fields(o.Cmd)
+				if len(args) == 0 { continue }
+				if _, err := exec.LookPath(args[0]); err == nil { return o, nil }
+				if !seen[args[0]] { seen[args[0]] = true; tried = append(tried, args[0]) }
+			}
+		}
+	}
+	if len(tried) == 0 { return opener{}, errors.New(T("no opener for %s: add one under openers in config.json", filepath.Base(path))) }
+	return opener{}, errors.New(T("no opener for %s is installed (tried %s): install one or set openers in config.json", filepath.Base(path), strings.Join(tried, ", ")))
+}
+
+// command is the opener's command line for path
+func (o opener) command(path string) *exec.Cmd {
+	args := strings.Fields(o.Cmd)
+	found := false
+	for i, a := range args {
+		if strings.Contains(a, "{}") { args[i] = strings.ReplaceAll(a, "{}", path); found = true }
+	}
+	if !found { args = append(args, path) }
+	return exec.Command(args[0], args[1:]...)
+}
+
+// openerDoneMsg arrives when a terminal opener exits
+type openerDoneMsg struct {
+	path string
+	err  error
+}
+
+// openExternal opens path with its configured program: a terminal one in the
+// foreground, any other detached so the TUI stays usable
+func (m *model) openExternal(path string) tea.Cmd {
+	o, err := pickOpener(path, m.cfg.Openers)
+	if err != nil { m.status = err.Error(); return nil }
+	if readOnlySession() {
+		if filepath.Base(strings.Fields(o.Cmd)[0]) != "less" { m.denyReadOnly(); return nil }
+		o = readOnlyOpener
+	}
+	c := o.command(path)
+	c.Env = lessEnv()
+	recordRecent(path, "opened")
+	if o.Terminal { return tea.ExecProcess(c, func(err error) tea.Msg { return openerDoneMsg{path, err} }) }
+	c.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := c.Start(); err != nil { m.status = T("cannot open %s: %v", filepath.Base(path), err); slog.Warn("opener failed", "cmd", o.Cmd, "path", path, "err", err); return nil }
+	go c.Wait()
+	m.status = T("opened %s with %s", filepath.Base(path), c.Args[0])
+	return nil
+}
+
+// openerDone reports how a terminal opener ended
+func (m *model) openerDone(msg openerDoneMsg) {
+	if msg.err != nil { m.status = T("cannot open %s: %v", filepath.Base(msg.path), msg.err); slog.Warn("opener failed", "path", msg.path, "err", msg.err); return }
+	m.status = T("closed %s", filepath.Base(msg.path))
+}
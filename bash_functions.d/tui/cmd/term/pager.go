@@ -0,0 +1,67 @@
+package main
+
+import (
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// pagerArgs is $PAGER split into words, less -R without one. less is given -R unless
+// it or $LESS already asks for raw control characters, so colors come through.
+func pagerArgs() []string {
+	args := strings.Fields(os.Getenv("PAGER"))
+	if len(args) == 0 { args = []string{"less"} }
+	if filepath.Base(args[0]) != "less" { return args }
+	// $LESS holds options like the command line, the leading - optional
+	opts := append(append([]string(nil), args[1:]...), strings.Fields(os.Getenv("LESS"))...)
+	for _, o := range opts {
+		if strings.EqualFold(o, "--raw-control-chars") { return args }
+		if !strings.HasPrefix(o, "--") && strings.ContainsAny(strings.TrimPrefix(o, "-"), "rR") { return args }
+	}
+	return append(args, "-R")
+}
+
+// pagerDoneMsg arrives when the pager exits; files are its temporary inputs
+type pagerDoneMsg struct {
+	files []string
+	err   error
+}
+
+// openPager shows the viewport, or the buffer in the Editor tab, in the pager. The
+// last output is passed as a second file when it differs, reached with :n in less.
+func (m *model) openPager() tea.Cmd {
+	tab := m.tabs[m.active]
+	texts := []string{m.vpContent}
+	if tab == "Editor" { texts = []string{m.ta.Value()} }
+	if m.lastOutput != "" && m.lastOutput != texts[0] { texts = append(texts, m.lastOutput) }
+	if strings.TrimSpace(texts[0]) == "" { m.status = T("nothing to page"); return nil }
+	var files []string
+	for i, t := range texts {
+		f, err := ioutil.TempFile("", "term-"+strings.ToLower(tab)+"-"+[]string{"view", "output"}[i]+"-*.txt")
+		if err == nil {
+			_, err = f.WriteString(t)
+			if cerr := f.Close(); err == nil { err = cerr }
+		}
+		if err != nil { removeAll(files); m.status = T("cannot page: %v", err); slog.Warn("pager input not written", "err", err); return nil }
+		files = append(files, f.Name())
+	}
+	args := pagerArgs()
+	c := exec.Command(args[0], append(args[1:], files...)...)
+	c.Env = lessEnv()
+	return tea.ExecProcess(c, func(err error) tea.Msg { return pagerDoneMsg{files, err} })
+}
+
+func removeAll(files []string) {
+	for _, f := range files { os.Remove(f) }
+}
+
+// pagerDone drops the pager's inputs
+func (m *model) pagerDone(msg pagerDoneMsg) {
+	removeAll(msg.files)
+	if msg.err != nil { m.status = T("pager failed: %v", msg.err); slog.Warn("pager failed", "pager", os.Getenv("PAGER"), "err", msg.err) }
+}
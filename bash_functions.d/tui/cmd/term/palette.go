@@ -0,0 +1,106 @@
+package main
+
+import (
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/bubbles/textinput"
+)
+
+// commandPalette is the prompt opened with alt+c from any tab. A tab name switches to
+// that tab, qr shows text as a QR code, pw and words generate a password or
+// passphrase, b64, url, json and hex (and their decoders) transform text, and
+// anything else is worked out by the calculator as it is typed; enter copies the
+// result.
+type commandPalette struct {
+	input  textinput.Model
+	result string // calculator result or error for the current input
+	value  string // what enter copies
+	secret bool   // value is a generated password: kept out of the clipboard history
+	tab    int    // tab named by the input, or -1
+	qr     string // text after "qr ", shown as a QR code on enter
+	title  string // for a transform: what its result is, shown with it in a Preview pane
+}
+
+func (m *model) openPalette() tea.Cmd {
+	ti := textinput.New()
+	ti.Prompt = "> "
+	ti.Placeholder = T("tab name, a calculation like 3*1024 MiB in GB, pw 24, b64 text, qr text")
+	ti.CharLimit = 4096
+	m.palette = &commandPalette{input: ti, tab: -1}
+	return m.palette.input.Focus()
+}
+
+// updatePalette handles keys while the palette is open; esc closes it
+func (m *model) updatePalette(msg tea.KeyMsg) tea.Cmd {
+	p := m.palette
+	switch msg.String() {
+	case "esc":
+		m.palette = nil
+		return nil
+	case "enter":
+		if p.tab >= 0 {
+			m.active = p.tab
+			m.palette = nil
+			return nil
+		}
+		if p.qr != "" {
+			m.palette = nil
+			m.showQR(T("text"), p.qr)
+			return nil
+		}
+		if p.value == "" { return nil }
+		// the palette stays open for the next calculation
+		if p.secret { return copySecret(m.termOut, "password", p.value) }
+		if p.title != "" {
+			m.panes.show(true, m.tabs[m.active], "Preview")
+			m.setContent(p.title + "\n\n" + p.value)
+			m.vp.GotoTop()
+			return copyToClipboard(m.termOut, "result", p.value)
+		}
+		return copyToClipboard(m.termOut, "calculation", p.value)
+	}
+	var cmd tea.Cmd
+	p.input, cmd = p.input.Update(msg)
+	m.evalPalette()
+	return cmd
+}
+
+// evalPalette works out what enter would do with the current input
+func (m *model) evalPalette() {
+	p := m.palette
+	q := strings.TrimSpace(p.input.Value())
+	p.result, p.value, p.tab, p.secret, p.qr, p.title = "", "", -1, false, "", ""
+	if q == "" { return }
+	for i, t := range m.tabs {
+		if strings.EqualFold(q, t) || strings.EqualFold(q, T(t)) { p.tab = i; p.result = T("enter: go to %s", T(t)); return }
+	}
+	if len(q) > 3 && strings.EqualFold(q[:3], "qr ") {
+		p.qr = strings.TrimSpace(q[3:])
+		p.result = T("enter: show as QR code")
+		return
+	}
+	if name, source, out, ok, err := m.runTransform(q); ok {
+		if err != nil { p.result = err.Error(); return }
+		p.value, p.title = out, T("%s of the %s", name, source)
+		p.result = T("= %s  (enter: copy and show)", truncateCells(strings.ReplaceAll(out, "\n", "⏎"), 60))
+		return
+	}
+	if pw, bits, ok, err := generateSecret(q, m.cfg.Password); ok {
+		if err != nil { p.result = err.Error(); return }
+		p.value, p.secret = pw, true
+		p.result = T("= %s  (%.0f bits, %s; enter copies, any key makes another)", pw, bits, strengthLabel(bits))
+		return
+	}
+	v, shown, err := calculate(q)
+	if err != nil { p.result = err.Error(); return }
+	p.value, p.result = formatNumber(v), "= "+shown
+}
+
+// paletteView is the palette line shown in place of the key help
+func (m model) paletteView() string {
+	p := m.palette
+	if p.result == "" { return p.input.View() }
+	if p.value == "" && p.tab < 0 && p.qr == "" { return p.input.View() + "  " + helpStyle.Render(p.result) }
+	return p.input.View() + "  " + diffAddStyle.Render(p.result)
+}
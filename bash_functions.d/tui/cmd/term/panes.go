@@ -0,0 +1,146 @@
+package main
+
+import (
+	"github.com/charmbracelet/lipgloss"
+)
+
+var (
+	paneStyle        = lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).BorderForeground(lipgloss.AdaptiveColor{Light: "250", Dark: "238"})
+	focusedPaneStyle = lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).BorderForeground(lipgloss.AdaptiveColor{Light: "25", Dark: "39"})
+)
+
+// paneNode is a node in the tiling layout tree. Leaves show one tab; inner nodes split
+// their area between a and b, side by side when vertical is set, stacked otherwise.
+type paneNode struct {
+	tab      string
+	vertical bool
+	a, b     *paneNode
+}
+
+func (n *paneNode) isLeaf() bool { return n.a == nil }
+
+// leaves returns the panes in reading order, used for focus cycling
+func (n *paneNode) leaves() []*paneNode {
+	if n.isLeaf() { return []*paneNode{n} }
+	return append(n.a.leaves(), n.b.leaves()...)
+}
+
+// paneLayout is the pane tree plus the focused leaf. The focused pane always shows the
+// active tab, so tab switching keys retarget whichever pane has focus.
+type paneLayout struct {
+	root   *paneNode
+	focus  *paneNode
+	zoomed bool
+}
+
+func newPaneLayout(tab string) *paneLayout {
+	n := &paneNode{tab: tab}
+	return &paneLayout{root: n, focus: n}
+}
+
+// split divides the focused pane and moves focus to the new half, which starts on tab
+func (p *paneLayout) split(vertical bool, current, tab string) {
+	f := p.focus
+	old := &paneNode{tab: current}
+	neu := &paneNode{tab: tab}
+	f.tab, f.vertical, f.a, f.b = "", vertical, old, neu
+	p.focus = neu
+	p.zoomed = false
+}
+
+// show makes sure some pane other than the focused one displays tab, splitting the
+// focused pane if needed; focus stays on current
+func (p *paneLayout) show(vertical bool, current, tab string) {
+	for _, l := range p.root.leaves() {
+		if l != p.focus && l.tab == tab { p.zoomed = false; return }
+	}
+	f := p.focus
+	p.split(vertical, current, tab)
+	p.focus = f.a
+}
+
+// close removes the focused pane; the last pane cannot be closed
+func (p *paneLayout) close() bool {
+	if p.root.isLeaf() { return false }
+	var sibling *paneNode
+	p.root = removePane(p.root, p.focus, &sibling)
+	p.focus = sibling.leaves()[0]
+	p.zoomed = false
+	return true
+}
+
+// removePane returns n without leaf, collapsing leaf's parent into its sibling
+func removePane(n, leaf *paneNode, sibling **paneNode) *paneNode {
+	if n.isLeaf() { return n }
+	if n.a == leaf { *sibling = n.b; return n.b }
+	if n.b == leaf { *sibling = n.a; return n.a }
+	n.a = removePane(n.a, leaf, sibling)
+	n.b = removePane(n.b, leaf, sibling)
+	return n
+}
+
+// next moves focus to the following pane (wrapping) and returns it
+func (p *paneLayout) next(current string) *paneNode {
+	p.focus.tab = current
+	ls := p.root.leaves()
+	for i, l := range ls {
+		if l == p.focus { p.focus = ls[(i+1)%len(ls)]; break }
+	}
+	return p.focus
+}
+
+// render draws the tree into a w x h area; content(tab, w, h) renders a single tab
+func (p *paneLayout) render(current string, w, h int, content func(tab string, w, h int) string) string {
+	p.focus.tab = current
+	if p.zoomed || p.root.isLeaf() { return content(current, w, h) }
+	return p.renderNode(p.root, w, h, content)
+}
+
+// paneArea is the size a pane's tab renders into
+type paneArea struct {
+	tab  string
+	w, h int
+}
+
+// areas lists the tabs on screen with the size each renders into, as render lays them
+// out in a w x h area; the focused pane comes last, so where two panes share a
+// component the focused one sizes it
+func (p *paneLayout) areas(current string, w, h int) []paneArea {
+	p.focus.tab = current
+	if p.zoomed || p.root.isLeaf() { return []paneArea{{current, w, h}} }
+	var out []paneArea
+	var focused paneArea
+	var walk func(n *paneNode, w, h int)
+	walk = func(n *paneNode, w, h int) {
+		switch {
+		case n.isLeaf() && n == p.focus:
+			focused = paneArea{n.tab, w - 2, h - 3}
+		case n.isLeaf():
+			out = append(out, paneArea{n.tab, w - 2, h - 3})
+		case n.vertical:
+			walk(n.a, w/2, h)
+			walk(n.b, w-w/2, h)
+		default:
+			walk(n.a, w, h/2)
+			walk(n.b, w, h-h/2)
+		}
+	}
+	walk(p.root, w, h)
+	return append(out, focused)
+}
+
+func (p *paneLayout) renderNode(n *paneNode, w, h int, content func(string, int, int) string) string {
+	if n.isLeaf() {
+		style := paneStyle
+		if n == p.focus { style = focusedPaneStyle }
+		// borders take one cell on each side and the title a line
+		inner := content(n.tab, w-2, h-3)
+		return style.Width(w - 2).Height(h - 2).MaxWidth(w).MaxHeight(h).Render(titleStyle.Render(T(n.tab)) + "\n" + inner)
+	}
+	if n.vertical {
+		wa := w / 2
+		return lipgloss.JoinHorizontal(lipgloss.Top, p.renderNode(n.a, wa, h, content), p.renderNode(n.b, w-wa, h, content))
+	}
+	ha := h / 2
+	return lipgloss.JoinVertical(lipgloss.Left, p.renderNode(n.a, w, ha, content), p.renderNode(n.b, w, h-ha, content))
+}
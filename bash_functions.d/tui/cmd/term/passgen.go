@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"errors"
+	"math"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// passwordConfig sets the defaults of the palette's password generator: `pw` makes
+// Length characters from Charset, `words` joins Words words from Wordlist
+type passwordConfig struct {
+	Length   int    `json:"length,omitempty"`   // default 20
+	Charset  string `json:"charset,omitempty"`  // a charsets name, default "full"
+	Words    int    `json:"words,omitempty"`    // default 6
+	Wordlist string `json:"wordlist,omitempty"` // diceware list or one word per line; default /usr/share/dict/words
+}
+
+// charsets are the named alphabets of `pw`; alnum suits sites that refuse symbols
+var charsets = map[string]string{
+	"full":   "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789!#$%&()*+,-./:;<=>?@[]^_{|}~",
+	"alnum":  "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789",
+	"alpha":  "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ",
+	"lower":  "abcdefghijklmnopqrstuvwxyz",
+	"hex":    "0123456789abcdef",
+	"digits": "0123456789",
+}
+
+// randIndex is a uniform random number below n from the system CSPRNG
+func randIndex(n int) (int, error) {
+	i, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil { return 0, err }
+	return int(i.Int64()), nil
+}
+
+// genPassword makes a password of length characters drawn from set
+func genPassword(length int, set string) (string, float64, error) {
+	runes := []rune(set)
+	if length < 1 || length > 1024 { return "", 0, errors.New(T("length must be between 1 and 1024")) }
+	if len(runes) < 2 { return "", 0, errors.New(T("the character set needs at least two characters")) }
+	out := make([]rune, length)
+	for i := range out {
+		j, err := randIndex(len(runes))
+		if err != nil { return "", 0, err }
+		out[i] = runes[j]
+	}
+	return string(out), float64(length) * math.Log2(float64(len(runes))), nil
+}
+
+// loadWordlist reads a diceware list ("11111<tab>word") or a file of one word per
+// line; proper nouns, possessives and the like of a system dictionary are skipped
+func loadWordlist(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil { return nil, err }
+	defer f.Close()
+	seen := map[string]bool{}
+	var words []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 { continue }
+		w := fields[len(fields)-1]
+		if len(fields) > 2 || len(w) < 3 || len(w) > 10 || seen[w] { continue }
+		ok := true
+		for _, r := range w { if !unicode.IsLower(r) { ok = false; break } }
+		if ok { seen[w] = true; words = append(words, w) }
+	}
+	if err := sc.Err(); err != nil { return nil, err }
+	return words, nil
+}
+
+// genPassphrase joins n words picked from the word list with sep
+func genPassphrase(n int, sep, wordlist string) (string, float64, error) {
+	if n < 1 || n > 64 { return "", 0, errors.New(T("the number of words must be between 1 and 64")) }
+	if wordlist == "" { wordlist = "/usr/share/dict/words" }
+	words, err := loadWordlist(wordlist)
+	if err != nil { return "", 0, errors.New(T("no word list: %v (set password.wordlist in config.json)", err)) }
+	if len(words) < 1000 { return "", 0, errors.New(T("%s has only %d usable words", wordlist, len(words))) }
+	out := make([]string, n)
+	for i := range out {
+		j, err := randIndex(len(words))
+		if err != nil { return "", 0, err }
+		out[i] = words[j]
+	}
+	return strings.Join(out, sep), float64(n) * math.Log2(float64(len(words))), nil
+}
+
+// strengthLabel rates entropy the usual way: under 40 bits falls to an offline
+// attack quickly, 80 and more is out of reach
+func strengthLabel(bits float64) string {
+	switch {
+	case bits < 40:
+		return T("weak")
+	case bits < 60:
+		return T("fair")
+	case bits < 80:
+		return T("strong")
+	}
+	return T("very strong")
+}
+
+// generateSecret runs a generator command of the palette:
+//
+//	pw [length] [charset]   e.g. pw, pw 32, pw 12 alnum
+//	words [n] [separator]   e.g. words, words 5 .
+//
+// ok is false when q is not a generator command
+func generateSecret(q string, cfg passwordConfig) (secret string, bits float64, ok bool, err error) {
+	f := strings.Fields(q)
+	if len(f) == 0 || len(f) > 3 { return "", 0, false, nil }
+	num := func(i, def int) (int, error) {
+		if len(f) <= i { return def, nil }
+		n, err := strconv.Atoi(f[i])
+		if err != nil { return 0, errors.New(T("%q is not a number", f[i])) }
+		return n, nil
+	}
+	switch strings.ToLower(f[0]) {
+	case "pw", "password":
+		if cfg.Length == 0 { cfg.Length = 20 }
+		length, err := num(1, cfg.Length)
+		if err != nil { return "", 0, true, err }
+		name := cfg.Charset
+		if len(f) > 2 { name = f[2] }
+		if name == "" { name = "full" }
+		set, known := charsets[name]
+		if !known { return "", 0, true, errors.New(T("unknown character set %s (full, alnum, alpha, lower, hex, digits)", name)) }
+		secret, bits, err = genPassword(length, set)
+		return secret, bits, true, err
+	case "words", "passphrase":
+		if cfg.Words == 0 { cfg.Words = 6 }
+		n, err := num(1, cfg.Words)
+		if err != nil { return "", 0, true, err }
+		sep := "-"
+		if len(f) > 2 { sep = f[2] }
+		secret, bits, err = genPassphrase(n, sep, cfg.Wordlist)
+		return secret, bits, true, err
+	}
+	return "", 0, false, nil
+}
@@ -0,0 +1,27 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"errors"
+	"net"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// peerUser is the account on the other end of a unix socket, from SO_PEERCRED
+func peerUser(conn net.Conn) (string, error) {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok { return "", errors.New("not a unix socket") }
+	raw, err := uc.SyscallConn()
+	if err != nil { return "", err }
+	var cred *syscall.Ucred
+	var credErr error
+	if err := raw.Control(func(fd uintptr) { cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED) }); err != nil { return "", err }
+	if credErr != nil { return "", credErr }
+	u, err := user.LookupId(strconv.Itoa(int(cred.Uid)))
+	if err != nil { return "", err }
+	return u.Username, nil
+}
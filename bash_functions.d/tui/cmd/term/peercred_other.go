@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"errors"
+	"net"
+)
+
+// peerUser needs SO_PEERCRED, so the exec broker only serves on Linux
+func peerUser(conn net.Conn) (string, error) {
+	return "", errors.New("peer credentials are only supported on linux")
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// plainDelegate renders list items as single unstyled lines, marking the selection
+// with text instead of color so screen readers and braille displays can follow it.
+type plainDelegate struct{}
+
+func (d plainDelegate) Height() int                             { return 1 }
+func (d plainDelegate) Spacing() int                            { return 0 }
+func (d plainDelegate) Update(msg tea.Msg, m *list.Model) tea.Cmd { return nil }
+func (d plainDelegate) Render(w io.Writer, m list.Model, index int, item list.Item) {
+	marker := "  "
+	if index == m.Index() { marker = "> " }
+	line := item.FilterValue()
+	if di, ok := item.(list.DefaultItem); ok {
+		line = di.Title()
+		if desc := di.Description(); desc != "" { line += " - " + desc }
+	}
+	fmt.Fprint(w, marker+line)
+}
+
+// enablePlain switches the model to screen-reader friendly rendering
+func (m *model) enablePlain() {
+	m.plain = true
+	m.mdTheme = "notty"
+	for _, l := range []*list.Model{&m.list, &m.agentsList, &m.requestsList, &m.pluginsList, &m.jobsList, &m.tocList, &m.searchList, &m.muxList, &m.hostsList, &m.tagsList, &m.adminList, &m.connList} {
+		l.SetDelegate(plainDelegate{})
+		l.Styles.Title = lipgloss.NewStyle()
+	}
+}
+
+// plainView is the linear View used in plain mode: labeled sections, one pane,
+// no borders or color-only cues.
+func (m model) plainView() string {
+	var b strings.Builder
+	b.WriteString(T("Tab %d of %d: %s", m.active+1, len(m.tabs), T(m.tabs[m.active])))
+	if m.tabs[m.active] == "Editor" && m.editorRO { b.WriteString(" " + T("(read-only)")) }
+	if len(m.workspaces) > 1 { b.WriteString(T(", workspace %d of %d", m.ws+1, len(m.workspaces))) }
+	b.WriteString("\n\n")
+	if m.dialog != nil { b.WriteString(T("Dialog: %s", m.dialogView())) } else { b.WriteString(m.tabContent(m.tabs[m.active], m.width, m.height-4)) }
+	b.WriteString("\n\n")
+	if m.status != "" { b.WriteString(T("Status: %s", m.status) + "\n") }
+	if m.dialog != nil { return b.String() }
+	if m.palette != nil { b.WriteString(m.paletteView()); return b.String() }
+	b.WriteString(T("Keys: %s", T(helpText)))
+	return b.String()
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// pluginManagerPath is the plugin_manager.sh that enables and disables plugins, so the
+// Plugins tab registers bin directories and regenerates enabled_env.sh the same way
+func pluginManagerPath() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, "bash_functions.d", "core", "plugin_manager.sh")
+}
+
+// togglePlugin is space in the Plugins tab: enabling happens at once, disabling asks
+// first since the plugin's commands go away for new shells
+func (m *model) togglePlugin() tea.Cmd {
+	sel, ok := m.pluginsList.SelectedItem().(agentItem)
+	if !ok || m.denyReadOnly() { return nil }
+	if sel.desc != "enabled" { m.setPlugin(sel.name, true); return nil }
+	m.askDetail(T("Disable plugin %s?", sel.name), T("New shells no longer source its init.sh or have its bin directory on PATH; shells already open keep them."), func(m *model) tea.Cmd {
+		m.setPlugin(sel.name, false)
+		return nil
+	})
+	return nil
+}
+
+// setPlugin runs plugin_manager.sh enable or disable and relists the plugins
+func (m *model) setPlugin(name string, enable bool) {
+	action := "disable"
+	if enable { action = "enable" }
+	out, err := exec.Command("bash", pluginManagerPath(), action, name).CombinedOutput()
+	appendAudit(m.auditPath, fmt.Sprintf("%s\tplugin=%s\taction=%s\tuser=%s\terror=%v", time.Now().Format(time.RFC3339), name, action, transferUser(), err))
+	if err != nil {
+		m.status = T("plugin %s: %v", name, err)
+		m.setContent(string(out))
+		slog.Warn("plugin toggle failed", "plugin", name, "action", action, "err", err)
+		return
+	}
+	m.pluginsList.SetItems(loadPlugins())
+	if enable { m.status = T("enabled plugin %s", name) } else { m.status = T("disabled plugin %s", name) }
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"container/list"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/fsnotify/fsnotify"
+)
+
+// defaultPreviewCacheMB bounds the rendered previews kept in memory
+const defaultPreviewCacheMB = 16
+
+// previewCache keeps rendered previews keyed by path, mtime and render settings, so
+// revisiting a file skips rendering. Entries are evicted least recently used once
+// the budget is exceeded, and dropped as soon as fsnotify reports their file changed.
+type previewCache struct {
+	mu      sync.Mutex
+	budget  int // bytes
+	used    int
+	lru     *list.List // of *previewEntry, most recent first
+	entries map[string]*list.Element
+	watcher *fsnotify.Watcher // nil when fsnotify is unavailable; mtimes still invalidate
+	watched map[string]int    // directory -> cached entries in it
+	changed chan string       // paths of cached files that changed
+}
+
+type previewEntry struct {
+	key, path string
+	out       string
+}
+
+// previewChangedMsg reports that a file with a cached preview changed on disk
+type previewChangedMsg struct{ path string }
+
+func newPreviewCache(budgetMB int) *previewCache {
+	if budgetMB <= 0 { budgetMB = defaultPreviewCacheMB }
+	c := &previewCache{budget: budgetMB << 20, lru: list.New(), entries: map[string]*list.Element{}, watched: map[string]int{}, changed: make(chan string, 16)}
+	w, err := fsnotify.NewWatcher()
+	if err != nil { slog.Warn("preview cache: file watching disabled", "err", err); return c }
+	c.watcher = w
+	go c.watch()
+	return c
+}
+
+// previewKey identifies one rendering of path; a changed mtime or size is a new key
+func previewKey(path string, mtime time.Time, size int64, settings string) string {
+	return fmt.Sprintf("%s\x00%d\x00%d\x00%s", path, mtime.UnixNano(), size, settings)
+}
+
+func (c *previewCache) get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok { return "", false }
+	c.lru.MoveToFront(el)
+	return el.Value.(*previewEntry).out, true
+}
+
+func (c *previewCache) put(key, path, out string) {
+	if len(out) > c.budget { return }
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok { c.removeLocked(el) }
+	c.entries[key] = c.lru.PushFront(&previewEntry{key: key, path: path, out: out})
+	c.used += len(out)
+	c.watchLocked(filepath.Dir(path), 1)
+	for c.used > c.budget {
+		c.removeLocked(c.lru.Back())
+	}
+}
+
+// invalidate drops every cached rendering of path
+func (c *previewCache) invalidate(path string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	found := false
+	for el := c.lru.Front(); el != nil; {
+		next := el.Next()
+		if el.Value.(*previewEntry).path == path { c.removeLocked(el); found = true }
+		el = next
+	}
+	return found
+}
+
+func (c *previewCache) removeLocked(el *list.Element) {
+	e := c.lru.Remove(el).(*previewEntry)
+	delete(c.entries, e.key)
+	c.used -= len(e.out)
+	c.watchLocked(filepath.Dir(e.path), -1)
+}
+
+// watchLocked counts cached entries per directory, watching a directory while it
+// has any. Directories are watched rather than files so editors that save by
+// renaming a new file into place are noticed too.
+func (c *previewCache) watchLocked(dir string, delta int) {
+	if c.watcher == nil { return }
+	n := c.watched[dir]
+	c.watched[dir] = n + delta
+	switch {
+	case n == 0 && delta > 0:
+		if err := c.watcher.Add(dir); err != nil { slog.Debug("preview cache: cannot watch", "dir", dir, "err", err) }
+	case n+delta <= 0:
+		delete(c.watched, dir)
+		c.watcher.Remove(dir)
+	}
+}
+
+func (c *previewCache) watch() {
+	for {
+		select {
+		case ev, ok := <-c.watcher.Events:
+			if !ok { return }
+			if ev.Op == fsnotify.Chmod { continue }
+			if c.invalidate(ev.Name) {
+				select {
+				case c.changed <- ev.Name:
+				default: // the TUI is behind; the mtime check still catches the change
+				}
+			}
+		case err, ok := <-c.watcher.Errors:
+			if !ok { return }
+			slog.Debug("preview cache: watch error", "err", err)
+		}
+	}
+}
+
+// waitPreviewChange delivers the next change to a cached file to the model
+func waitPreviewChange(c *previewCache) tea.Cmd {
+	return func() tea.Msg { return previewChangedMsg{path: <-c.changed} }
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// renderQR draws text as a QR code in half blocks, two rows of modules per line, with
+// the quiet zone around it. Scanners want dark modules on a light ground, so on a
+// dark terminal the light modules are the ones drawn.
+func renderQR(text string, darkTerminal bool) (string, error) {
+	q, err := qrcode.New(text, qrcode.Medium)
+	// long text still fits with less error correction
+	if err != nil { q, err = qrcode.New(text, qrcode.Low) }
+	if err != nil { return "", err }
+	bm := q.Bitmap()
+	drawn := func(y, x int) bool {
+		if y >= len(bm) { return darkTerminal } // below the last row is quiet zone
+		return bm[y][x] != darkTerminal
+	}
+	var b strings.Builder
+	for y := 0; y < len(bm); y += 2 {
+		for x := range bm[y] {
+			top, bottom := drawn(y, x), drawn(y+1, x)
+			switch {
+			case top && bottom:
+				b.WriteString("█")
+			case top:
+				b.WriteString("▀")
+			case bottom:
+				b.WriteString("▄")
+			default:
+				b.WriteString(" ")
+			}
+		}
+		b.WriteString("\n")
+	}
+	return b.String(), nil
+}
+
+// showQR shows text as a QR code in a Preview pane; what names it in the caption
+func (m *model) showQR(what, text string) {
+	if text == "" { m.status = T("nothing to show as QR"); return }
+	qr, err := renderQR(text, m.mdTheme != "light")
+	if err != nil { m.status = T("cannot make a QR code: %v", err); return }
+	m.panes.show(true, m.tabs[m.active], "Preview")
+	m.setContent(qr + "\n" + T("QR code of the %s (%d bytes)", what, len(text)))
+	m.vp.GotoTop()
+	m.status = T("QR code of the %s", what)
+	if w := lipgloss.Width(strings.SplitN(qr, "\n", 2)[0]); w > m.vp.Width || strings.Count(qr, "\n") > m.vp.Height {
+		m.status = T("the QR code needs %dx%d cells: zoom the pane (alt+z) or enlarge the terminal", w, strings.Count(qr, "\n"))
+	}
+}
+
+// showSelectionQR shows what y would copy as a QR code; a public key file selected in
+// Files is shown by content, so it can be scanned onto a phone
+func (m *model) showSelectionQR() {
+	if m.tabs[m.active] == "Files" {
+		if sel, ok := m.list.SelectedItem().(fileItem); ok && strings.HasSuffix(sel.path, ".pub") {
+			if fi, err := os.Stat(sel.path); err == nil && fi.Size() < 16<<10 {
+				if b, err := ioutil.ReadFile(sel.path); err == nil { m.showQR(T("public key"), strings.TrimSpace(string(b))); return }
+			}
+		}
+	}
+	what, text, _ := m.selection()
+	m.showQR(T(what), text)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// quotaWarn is the share of a quota after which the session is warned, once
+const quotaWarn = 0.8
+
+var errQuotaReached = errors.New("session quota reached")
+
+// quotaSpec is the quota of an allowlist entry. wish-server passes it to the
+// session as SSH_QUOTA_AGENT_TIME and SSH_QUOTA_SHELL_PER_HOUR, its own flags
+// filling in what the entry leaves out; zero is no limit.
+type quotaSpec struct {
+	AgentTime    string `json:"agent_time,omitempty"`     // total runtime of the session's jobs, e.g. "30m"
+	ShellPerHour int    `json:"shell_per_hour,omitempty"` // Shell tab commands in any hour
+}
+
+// env is the session environment of q
+func (q *quotaSpec) env() []string {
+	var env []string
+	if q == nil { return nil }
+	if q.AgentTime != "" { env = append(env, "SSH_QUOTA_AGENT_TIME="+q.AgentTime) }
+	if q.ShellPerHour > 0 { env = append(env, "SSH_QUOTA_SHELL_PER_HOUR="+strconv.Itoa(q.ShellPerHour)) }
+	return env
+}
+
+// sessionQuota is what this connection may still use and has used so far
+type sessionQuota struct {
+	agentTime    time.Duration // 0 is unlimited
+	shellPerHour int           // 0 is unlimited
+	agentUsed    time.Duration // runtime of the session's finished jobs
+	shellRuns    []time.Time   // Shell commands of the last hour
+	warned       map[string]bool
+	stopped      map[string]bool // jobs already stopped for going over the agent time
+}
+
+func newSessionQuota() sessionQuota {
+	q := sessionQuota{warned: map[string]bool{}, stopped: map[string]bool{}}
+	if s := os.Getenv("SSH_QUOTA_AGENT_TIME"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d < 0 { slog.Warn("ignoring bad SSH_QUOTA_AGENT_TIME", "value", s) } else { q.agentTime = d }
+	}
+	if s := os.Getenv("SSH_QUOTA_SHELL_PER_HOUR"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 { slog.Warn("ignoring bad SSH_QUOTA_SHELL_PER_HOUR", "value", s) } else { q.shellPerHour = n }
+	}
+	return q
+}
+
+// auditQuota records a quota hit: what ran out, the limit, what was used and the action taken
+func (m *model) auditQuota(what, limit, used, action string) {
+	appendAudit(m.auditPath, fmt.Sprintf("%s\tquota=%s\tlimit=%s\tused=%s\taction=%s\tuser=%s", time.Now().Format(time.RFC3339), what, limit, used, action, transferUser()))
+	slog.Warn("session quota reached", "quota", what, "limit", limit, "used", used, "action", action)
+}
+
+// warnQuota says once per quota that the session is close to it
+func (m *model) warnQuota(what string, used, limit float64, msg string) {
+	if limit <= 0 || used < quotaWarn*limit || m.quota.warned[what] { return }
+	m.quota.warned[what] = true
+	m.status = msg
+}
+
+// agentRuntime is the runtime of the session's finished jobs plus the running ones
+func (m *model) agentRuntime(all []job) time.Duration {
+	used := m.quota.agentUsed
+	for _, j := range all {
+		if !m.myJobs[j.ID] || j.State != JobRunning { continue }
+		if t, err := time.Parse(time.RFC3339, j.Started); err == nil { used += time.Since(t) }
+	}
+	return used
+}
+
+// agentQuotaLeft refuses a new job once the session used its agent time
+func (m *model) agentQuotaLeft() bool {
+	q := &m.quota
+	if q.agentTime == 0 { return true }
+	used := m.agentRuntime(loadJobs())
+	if used < q.agentTime { return true }
+	m.status = T("agent time quota reached (%s of %s used)", used.Round(time.Second), q.agentTime)
+	m.setContent(m.status)
+	m.auditQuota("agent_time", q.agentTime.String(), used.Round(time.Second).String(), "refused")
+	return false
+}
+
+// checkAgentQuota runs on every jobs sync: finished jobs are added to the time used,
+// and once it passes the quota the session's running jobs are stopped
+func (m *model) checkAgentQuota(all, done []job) {
+	q := &m.quota
+	if q.agentTime == 0 { return }
+	for _, j := range done {
+		if !m.myJobs[j.ID] { continue }
+		if d, err := time.ParseDuration(jobDuration(j)); err == nil { q.agentUsed += d }
+	}
+	used := m.agentRuntime(all)
+	m.warnQuota("agent_time", float64(used), float64(q.agentTime), T("%s of the %s agent time quota used", used.Round(time.Second), q.agentTime))
+	if used < q.agentTime { return }
+	for _, j := range all {
+		if !m.myJobs[j.ID] || j.State != JobRunning || j.PID <= 0 || q.stopped[j.ID] { continue }
+		// jobs run in their own session, so the group takes their children too
+		if err := syscall.Kill(-j.PID, syscall.SIGTERM); err != nil { slog.Warn("cannot stop job over quota", "job", j.ID, "err", err); continue }
+		q.stopped[j.ID] = true
+		m.auditQuota("agent_time", q.agentTime.String(), used.Round(time.Second).String(), "stopped "+j.ID)
+		m.status = T("agent time quota reached: stopped %s", j.Agent)
+	}
+}
+
+// shellQuotaLeft counts a Shell command against the hourly quota, refusing it when
+// the last hour already had as many
+func (m *model) shellQuotaLeft() bool {
+	q := &m.quota
+	if q.shellPerHour == 0 { return true }
+	hour := time.Now().Add(-time.Hour)
+	recent := q.shellRuns[:0]
+	for _, t := range q.shellRuns {
+		if t.After(hour) { recent = append(recent, t) }
+	}
+	q.shellRuns = recent
+	if len(recent) >= q.shellPerHour {
+		next := recent[0].Add(time.Hour)
+		m.status = T("shell quota reached (%d commands an hour); next one at %s", q.shellPerHour, next.Format("15:04"))
+		m.auditQuota("shell_per_hour", strconv.Itoa(q.shellPerHour), strconv.Itoa(len(recent)), "refused")
+		return false
+	}
+	q.shellRuns = append(q.shellRuns, time.Now())
+	return true
+}
+
+// warnShellQuota warns after a command that brought the hour close to the quota;
+// the warning comes back once the hour has room again
+func (m *model) warnShellQuota() {
+	q := &m.quota
+	if q.shellPerHour == 0 { return }
+	if float64(len(q.shellRuns)) < quotaWarn*float64(q.shellPerHour) { q.warned["shell_per_hour"] = false; return }
+	m.warnQuota("shell_per_hour", float64(len(q.shellRuns)), float64(q.shellPerHour), T("%d of %d shell commands this hour", len(q.shellRuns), q.shellPerHour))
+}
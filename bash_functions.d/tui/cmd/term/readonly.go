@@ -0,0 +1,29 @@
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// errReadOnly refuses a change in a read-only session
+var errReadOnly = errors.New("read-only session")
+
+// readOnlySession reports whether the allowlist marks the user read_only; wish-server
+// and the gateway set SSH_READ_ONLY for them. Such sessions browse, preview and read
+// the audit log, but cannot edit files, run shells, exec agents or approve requests.
+func readOnlySession() bool { return os.Getenv("SSH_READ_ONLY") == "1" }
+
+// denyReadOnly refuses an action in a read-only session, saying why in the status
+// line; it reports whether the action was refused
+func (m *model) denyReadOnly() bool {
+	if !readOnlySession() { return false }
+	m.status = T("read-only session: browsing, previews and the audit log only")
+	return true
+}
+
+// lessEnv is the environment of a pager or viewer started from the session: less
+// then cannot run commands or open an editor (! and v) in a read-only one
+func lessEnv() []string {
+	if !readOnlySession() { return nil }
+	return append(os.Environ(), "LESSSECURE=1")
+}
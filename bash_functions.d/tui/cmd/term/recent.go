@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// maxRecent is how many files the recent list keeps, and maxJumps how many locations
+// the jump list does
+const (
+	maxRecent = 100
+	maxJumps  = 100
+)
+
+// recentFile is a file opened in the TUI and how it was last opened: edited, viewed,
+// previewed or opened with an external program
+type recentFile struct {
+	Path string `json:"path"`
+	How  string `json:"how"`
+	Time string `json:"time"`
+}
+
+func (r recentFile) Title() string { return filepath.Base(r.Path) }
+func (r recentFile) Description() string {
+	when := r.Time
+	if t, err := time.Parse(time.RFC3339, r.Time); err == nil { when = t.Format("2006-01-02 15:04") }
+	d := T(r.How) + " · " + when + " · " + filepath.Dir(r.Path)
+	if _, err := os.Stat(r.Path); err != nil { d += "  " + T("(missing)") }
+	return d
+}
+func (r recentFile) FilterValue() string { return r.Path }
+
+// recentPath is the per-user list of recently opened files
+func recentPath() string { return filepath.Join(tuiDataDir(), "recent.json") }
+
+func loadRecent() []recentFile {
+	var rs []recentFile
+	if b, err := ioutil.ReadFile(recentPath()); err == nil { _ = json.Unmarshal(b, &rs) }
+	return rs
+}
+
+func saveRecent(rs []recentFile) error {
+	b, err := json.MarshalIndent(rs, "", "  ")
+	if err != nil { return err }
+	if err := os.MkdirAll(tuiDataDir(), 0o700); err != nil { return err }
+	tmp := recentPath() + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0o600); err != nil { return err }
+	return os.Rename(tmp, recentPath())
+}
+
+// recordRecent puts path at the top of the recent files; opening it again moves it there
+func recordRecent(path, how string) {
+	err := withLock("recent", func() error {
+		rs := []recentFile{{Path: path, How: how, Time: time.Now().Format(time.RFC3339)}}
+		for _, r := range loadRecent() {
+			if r.Path != path { rs = append(rs, r) }
+		}
+		if len(rs) > maxRecent { rs = rs[:maxRecent] }
+		return saveRecent(rs)
+	})
+	if err != nil { slog.Warn("cannot update recent files", "err", err) }
+}
+
+// dropRecent removes path from the recent files
+func dropRecent(path string) error {
+	return withLock("recent", func() error {
+		var rs []recentFile
+		for _, r := range loadRecent() {
+			if r.Path != path { rs = append(rs, r) }
+		}
+		return saveRecent(rs)
+	})
+}
+
+// jump is a location of the jump list: a directory shown in Files, a file in the
+// Editor (edit or view) at a line, or a file in Preview
+type jump struct {
+	kind string // dir, edit, view or preview
+	path string
+	line int
+}
+
+// jumpList is the session's location history; alt+, and alt+. move back and forward
+// through it like an editor's jump list
+type jumpList struct {
+	entries   []jump
+	cur       int  // index of the current location
+	replaying bool // set while going back or forward, which records nothing
+}
+
+// visit records a new location after the current one, dropping the ones ahead of it
+func (m *model) visit(j jump) {
+	l := &m.jumps
+	if l.replaying { return }
+	if len(l.entries) > 0 {
+		m.saveJumpLine()
+		if c := l.entries[l.cur]; c.kind == j.kind && c.path == j.path { l.entries[l.cur].line = j.line; return }
+	}
+	l.entries = append(l.entries[:min(l.cur+1, len(l.entries))], j)
+	if len(l.entries) > maxJumps { l.entries = l.entries[len(l.entries)-maxJumps:] }
+	l.cur = len(l.entries) - 1
+}
+
+// saveJumpLine remembers the cursor line of the file being left, so going back to it
+// returns there
+func (m *model) saveJumpLine() {
+	c := &m.jumps.entries[m.jumps.cur]
+	if (c.kind == "edit" || c.kind == "view") && c.path == m.editorFile { c.line = m.ta.Line() + 1 }
+}
+
+// jumpBy moves d locations back (negative) or forward in the jump list
+func (m *model) jumpBy(d int) tea.Cmd {
+	l := &m.jumps
+	i := l.cur + d
+	if len(l.entries) == 0 || i < 0 || i >= len(l.entries) {
+		if d < 0 { m.status = T("at the start of the jump list") } else { m.status = T("at the end of the jump list") }
+		return nil
+	}
+	m.saveJumpLine()
+	l.cur = i
+	l.replaying = true
+	defer func() { l.replaying = false }()
+	cmd := m.goTo(l.entries[i])
+	m.status = T("jump %d of %d: %s", i+1, len(l.entries), m.status)
+	return cmd
+}
+
+// goTo shows a location; a file already in the Editor only has its cursor moved, so
+// unsaved changes are kept
+func (m *model) goTo(j jump) tea.Cmd {
+	if _, err := os.Stat(j.path); err != nil { m.status = T("%s no longer exists", j.path); return nil }
+	switch j.kind {
+	case "dir":
+		m.chdir(j.path)
+	case "edit", "view":
+		if j.path == m.editorFile {
+			editorGoto(&m.ta, j.line, 1)
+			m.active = m.tabIndex("Editor")
+			m.status = filepath.Base(j.path)
+			return m.ta.Focus()
+		}
+		return m.openEditor(j.path, max(1, j.line), 1, j.kind == "view")
+	case "preview":
+		if err := m.showMarkdownFile(j.path); err != nil { m.status = T("preview failed: %v", err); return nil }
+		m.active = m.tabIndex("Preview")
+		m.status = T("preview: %s", filepath.Base(j.path))
+	}
+	return nil
+}
+
+// chdir shows dir in the Files tab and records it in the jump list
+func (m *model) chdir(dir string) {
+	m.cwd = dir
+	m.refreshFiles()
+	m.active = m.tabIndex("Files")
+	m.status = "cd " + m.cwd
+	m.visit(jump{kind: "dir", path: dir})
+}
+
+// recentPicker is the recent files overlay opened with alt+e; target is the tab it
+// was opened from
+type recentPicker struct {
+	list   list.Model
+	target string
+}
+
+func (m *model) openRecentPicker() {
+	items := []list.Item{}
+	for _, r := range loadRecent() { items = append(items, r) }
+	l := list.New(items, list.NewDefaultDelegate(), 60, m.height-10)
+	l.Title = T("Recent files")
+	l.SetShowHelp(false)
+	if m.plain { l.SetDelegate(plainDelegate{}); l.Styles.Title = lipgloss.NewStyle() }
+	m.recent = &recentPicker{list: l, target: m.tabs[m.active]}
+	m.status = T("enter: open as before • E: edit • f: show in Files • x: remove • /: search • esc: close")
+}
+
+// updateRecentPicker handles keys while the recent files are open; enter opens the
+// file the way it was last opened
+func (m *model) updateRecentPicker(msg tea.KeyMsg) tea.Cmd {
+	p := m.recent
+	r, ok := p.list.SelectedItem().(recentFile)
+	if !p.list.SettingFilter() {
+		switch msg.String() {
+		case "esc":
+			if p.list.IsFiltered() { break }
+			m.recent = nil
+			return nil
+		case "q":
+			m.recent = nil
+			return nil
+		case "enter", "E", "f":
+			if !ok { return nil }
+			if _, err := os.Stat(r.Path); err != nil { m.status = T("%s no longer exists (x removes it)", r.Path); return nil }
+			m.recent = nil
+			switch {
+			case msg.String() == "E" || r.How == "edited":
+				return m.openInEditor(r.Path, 1, 1)
+			case msg.String() == "f":
+				m.chdir(filepath.Dir(r.Path))
+				for i, it := range m.list.Items() {
+					if it.(fileItem).path == r.Path { m.list.Select(i); break }
+				}
+				return nil
+			case r.How == "viewed":
+				return m.openReadOnly(r.Path, 1, 1)
+			case r.How == "opened":
+				return m.openExternal(r.Path)
+			}
+			return m.previewFile(r.Path)
+		case "x":
+			if !ok { return nil }
+			if err := dropRecent(r.Path); err != nil { m.status = T("cannot update recent files: %v", err); slog.Warn("cannot update recent files", "err", err); return nil }
+			items := []list.Item{}
+			for _, r := range loadRecent() { items = append(items, r) }
+			m.status = T("removed from recent files")
+			return p.list.SetItems(items)
+		}
+	}
+	var cmd tea.Cmd
+	p.list, cmd = p.list.Update(msg)
+	return cmd
+}
+
+// previewFile shows a document in the Preview tab and records it as a recent file
+// and a jump
+func (m *model) previewFile(path string) tea.Cmd {
+	if err := m.showMarkdownFile(path); err != nil { m.status = T("preview failed: %v", err); slog.Warn("preview failed", "path", path, "err", err); return nil }
+	m.active = m.tabIndex("Preview")
+	m.status = T("preview: %s", filepath.Base(path))
+	recordRecent(path, "previewed")
+	m.visit(jump{kind: "preview", path: path})
+	return nil
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// maxFilterResults is how many matches a filter of the Audit or Requests tab shows
+const maxFilterResults = 500
+
+// recordQuery is the type-ahead filter of the Audit and Requests tabs. agent=, user=
+// and status= match the start of those fields and any other word the whole record,
+// all ignoring case. The stores evaluate it, so a filter does not load the whole log.
+type recordQuery struct {
+	agent, user, status string
+	words               []string // lowercased
+	owner               string   // exact requester, for sessions that see only their own requests
+}
+
+func parseRecordQuery(s string) recordQuery {
+	var q recordQuery
+	for _, w := range strings.Fields(s) {
+		k, v, _ := strings.Cut(w, "=")
+		switch k {
+		case "agent":
+			q.agent = v
+		case "user":
+			q.user = v
+		case "status":
+			q.status = v
+		default:
+			q.words = append(q.words, strings.ToLower(w))
+		}
+	}
+	return q
+}
+
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
+
+func containsWords(s string, words []string) bool {
+	s = strings.ToLower(s)
+	for _, w := range words {
+		if !strings.Contains(s, w) { return false }
+	}
+	return true
+}
+
+// matchState reports whether requests in state can match at all, so a store can skip
+// the queue or the history
+func (q recordQuery) matchState(state string) bool { return hasPrefixFold(state, q.status) }
+
+func (q recordQuery) matchRequest(r requestItem) bool {
+	return hasPrefixFold(r.Agent, q.agent) && hasPrefixFold(r.User, q.user) && q.matchState(r.State) &&
+		(q.owner == "" || r.User == q.owner) && containsWords(r.ID+" "+r.Agent+" "+r.User+" "+r.Time+" "+r.Notes, q.words)
+}
+
+// auditStatus is what an entry records: denied, failed (an exit code other than 0 or
+// an error) or ok
+func auditStatus(fields map[string]string) string {
+	switch {
+	case fields["denied"] == "true":
+		return "denied"
+	case fields["exit"] != "" && fields["exit"] != "0", fields["error"] != "" && fields["error"] != "<nil>":
+		return "failed"
+	}
+	return "ok"
+}
+
+func (q recordQuery) matchAudit(line string) bool {
+	e, ok := parseAuditLine(line)
+	if !ok { return false }
+	return hasPrefixFold(e.fields["agent"], q.agent) && hasPrefixFold(e.fields["user"], q.user) &&
+		hasPrefixFold(auditStatus(e.fields), q.status) && containsWords(line, q.words)
+}
+
+func newRecordFilterInput() textinput.Model {
+	ti := textinput.New()
+	ti.Prompt = T("filter: ")
+	ti.Placeholder = "agent=backup user=alice status=failed words"
+	ti.CharLimit = 200
+	return ti
+}
+
+// auditFilterMsg and requestFilterMsg carry the matches of a filter as it was typed
+type auditFilterMsg struct {
+	query string
+	lines []string
+	err   error
+}
+
+type requestFilterMsg struct {
+	query string
+	items []requestItem
+	err   error
+}
+
+func findAudit(auditPath, query string) ([]string, error) {
+	var lines []string
+	err := withAuditStore(auditPath, func(s AuditStore) (err error) {
+		lines, err = s.Query(parseRecordQuery(query), maxFilterResults)
+		return err
+	})
+	return lines, err
+}
+
+func findRequests(requestsPath, query string) ([]requestItem, error) {
+	var reqs []requestItem
+	err := withRequestStore(requestsPath, func(s RequestStore) (err error) {
+		reqs, err = s.Find(parseRecordQuery(query), maxFilterResults)
+		return err
+	})
+	return reqs, err
+}
+
+// filterRecords runs the filter of the Audit or Requests tab in the background;
+// answers to a query that has been typed over are dropped when they arrive
+func (m *model) filterRecords(tab, query string) tea.Cmd {
+	auditPath, requestsPath := m.auditPath, m.requestsPath
+	if tab == "Audit" {
+		return func() tea.Msg { lines, err := findAudit(auditPath, query); return auditFilterMsg{query, lines, err} }
+	}
+	return func() tea.Msg { items, err := findRequests(requestsPath, query); return requestFilterMsg{query, items, err} }
+}
+
+// recordInput is the filter prompt of the Audit or Requests tab
+func (m *model) recordInput(tab string) *textinput.Model {
+	if tab == "Audit" { return &m.auditFilter }
+	return &m.reqFilter
+}
+
+// openRecordFilter focuses the filter of the tab, keeping the current query to refine
+func (m *model) openRecordFilter(tab string) tea.Cmd {
+	in := m.recordInput(tab)
+	in.CursorEnd()
+	return in.Focus()
+}
+
+// updateRecordFilter handles keys while a filter prompt has focus: the matches follow
+// every edit, enter keeps them and esc clears the filter
+func (m *model) updateRecordFilter(tab string, msg tea.KeyMsg) tea.Cmd {
+	in := m.recordInput(tab)
+	switch msg.String() {
+	case "enter":
+		in.Blur()
+		return nil
+	case "esc":
+		in.Blur()
+		in.SetValue("")
+		m.clearRecordFilter(tab)
+		return nil
+	}
+	before := in.Value()
+	var cmd tea.Cmd
+	*in, cmd = in.Update(msg)
+	if in.Value() == before { return cmd }
+	if strings.TrimSpace(in.Value()) == "" { m.clearRecordFilter(tab); return cmd }
+	return tea.Batch(cmd, m.filterRecords(tab, in.Value()))
+}
+
+// clearRecordFilter goes back to the whole log, or to the queue
+func (m *model) clearRecordFilter(tab string) {
+	if tab == "Audit" { m.auditMatches = ""; return }
+	m.reloadRequests()
+}
+
+// reloadRequests rereads the Requests tab: the matches of its filter, or the queue
+func (m *model) reloadRequests() {
+	q := m.reqFilter.Value()
+	if strings.TrimSpace(q) == "" {
+		m.requestsList.SetItems(loadRequests(m.requestsPath))
+		m.requestsList.Title = m.requestsTitle()
+		return
+	}
+	items, err := findRequests(m.requestsPath, q)
+	m.showRequestMatches(requestFilterMsg{q, items, err})
+}
+
+// refilterAudit reruns the Audit filter, if one is set, after the log was reread
+func (m *model) refilterAudit() {
+	q := m.auditFilter.Value()
+	if strings.TrimSpace(q) == "" { return }
+	lines, err := findAudit(m.auditPath, q)
+	m.showAuditMatches(auditFilterMsg{q, lines, err})
+}
+
+func (m *model) requestsTitle() string {
+	if u := requestScope(); u != "" { return T("My requests (%s)", u) }
+	return T("Requests")
+}
+
+// showAuditMatches lays out the matches of the Audit filter, newest first
+func (m *model) showAuditMatches(msg auditFilterMsg) {
+	if msg.query != m.auditFilter.Value() { return }
+	if msg.err != nil { m.status = T("audit filter failed: %v", msg.err); return }
+	head := T("%d entries match, newest first", len(msg.lines))
+	if len(msg.lines) == maxFilterResults { head = T("the latest %d matching entries, newest first", maxFilterResults) }
+	m.auditMatches = head + "\n\n" + strings.Join(msg.lines, "\n")
+}
+
+// showRequestMatches lists the queued and decided requests matching the filter
+func (m *model) showRequestMatches(msg requestFilterMsg) {
+	if msg.query != m.reqFilter.Value() { return }
+	if msg.err != nil { m.status = T("request filter failed: %v", msg.err); return }
+	items := make([]list.Item, 0, len(msg.items))
+	for _, r := range msg.items { items = append(items, r) }
+	m.requestsList.SetItems(items)
+	m.requestsList.Title = fmt.Sprintf("%s · %s", m.requestsTitle(), T("%d matching %s", len(items), strings.TrimSpace(msg.query)))
+}
+
+// recordFilterView is the prompt over the filtered records, or a line saying which
+// filter is set once the prompt is closed
+func recordFilterView(in textinput.Model) string {
+	if in.Focused() { return in.View() }
+	return helpStyle.Render(T("filter: %s (/ to change, esc in it to clear)", in.Value()))
+}
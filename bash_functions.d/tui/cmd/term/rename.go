@@ -0,0 +1,235 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// renameCases are the case transforms ctrl+t cycles through
+var renameCases = []string{"keep", "lower", "upper", "title"}
+
+// numberRe matches the counters of a replacement: {n} is 1, 2, ...; {nnn} is 001, 002, ...
+var numberRe = regexp.MustCompile(`\{(n+)\}`)
+
+// renameForm is the Files tab batch rename opened with R: a pattern and its
+// replacement, applied to the marked files with a live preview
+type renameForm struct {
+	files   []string // in the order they were marked
+	find    textinput.Model
+	replace textinput.Model
+	caseIdx int // into renameCases
+}
+
+// renamePlan is the new name of each file, or why it cannot be renamed
+type renamePlan struct {
+	from, to string
+	problem  string
+}
+
+// openRenameForm starts a batch rename of the marked files, or of the selected one
+func (m *model) openRenameForm() tea.Cmd {
+	files := m.checksumTargets()
+	if len(files) == 0 { m.status = T("select a file or mark some with m"); return nil }
+	find := textinput.New()
+	find.Prompt = T("find (regexp, empty = whole name): ")
+	find.CharLimit = 255
+	replace := textinput.New()
+	replace.Prompt = T("replace with: ")
+	replace.CharLimit = 255
+	replace.Placeholder = "{name}{ext}"
+	m.rename = &renameForm{files: files, find: find, replace: replace}
+	return m.rename.find.Focus()
+}
+
+// newName renames one file: the counters and {name}/{ext} of the replacement are
+// filled in, then it replaces the matches of re ($1 and ${name} refer to groups),
+// or the whole name when there is no pattern
+func newName(name string, re *regexp.Regexp, repl string, n int, caseMode string) string {
+	ext := filepath.Ext(name)
+	repl = numberRe.ReplaceAllStringFunc(repl, func(s string) string { return fmt.Sprintf("%0*d", len(s)-2, n) })
+	repl = strings.NewReplacer("{name}", strings.TrimSuffix(name, ext), "{ext}", ext).Replace(repl)
+	out := name
+	switch {
+	case re != nil:
+		out = re.ReplaceAllString(name, repl)
+	case repl != "":
+		out = repl
+	}
+	switch caseMode {
+	case "lower":
+		out = strings.ToLower(out)
+	case "upper":
+		out = strings.ToUpper(out)
+	case "title":
+		// the extension is left alone: File.txt, not File.Txt
+		ext := filepath.Ext(out)
+		prev := ' '
+		out = strings.Map(func(r rune) rune {
+			// a letter after a separator starts a word
+			if !unicode.IsLetter(prev) && !unicode.IsDigit(prev) { r = unicode.ToUpper(r) } else { r = unicode.ToLower(r) }
+			prev = r
+			return r
+		}, strings.TrimSuffix(out, ext)) + ext
+	}
+	return out
+}
+
+// plan works out the new names and flags the ones that cannot be applied: invalid
+// names, two files ending up with the same name, or a name taken by another file
+func (f *renameForm) plan() ([]renamePlan, error) {
+	var re *regexp.Regexp
+	if p := f.find.Value(); p != "" {
+		var err error
+		if re, err = regexp.Compile(p); err != nil { return nil, err }
+	}
+	plans := make([]renamePlan, len(f.files))
+	moving := map[string]bool{}
+	for _, p := range f.files { moving[p] = true }
+	taken := map[string]int{}
+	for i, p := range f.files {
+		name := newName(filepath.Base(p), re, f.replace.Value(), i+1, renameCases[f.caseIdx])
+		to := filepath.Join(filepath.Dir(p), name)
+		plans[i] = renamePlan{from: p, to: to}
+		switch {
+		case name == "" || name == "." || name == ".." || strings.ContainsRune(name, '/'):
+			plans[i].problem = T("invalid name")
+		case taken[to] > 0:
+			plans[i].problem = T("same name as #%d", taken[to])
+			continue
+		case to != p && !moving[to]:
+			// on a case-insensitive filesystem File.txt finds file.txt, itself
+			if st, err := os.Lstat(to); err == nil {
+				if self, err := os.Lstat(p); err != nil || !os.SameFile(st, self) { plans[i].problem = T("exists") }
+			}
+		}
+		taken[to] = i + 1
+	}
+	return plans, nil
+}
+
+// applyRenames renames in two steps, every file to a temporary name and then to its
+// new one, so names can be swapped; on a failure the steps done are undone in reverse
+func applyRenames(plans []renamePlan) error {
+	type step struct{ from, to string }
+	var done []step
+	undo := func(err error) error {
+		for i := len(done) - 1; i >= 0; i-- {
+			if e := os.Rename(done[i].to, done[i].from); e != nil { slog.Warn("rename rollback failed", "from", done[i].to, "to", done[i].from, "err", e) }
+		}
+		return err
+	}
+	tmps := make([]string, len(plans))
+	for i, p := range plans {
+		tmps[i] = filepath.Join(filepath.Dir(p.from), fmt.Sprintf(".%s.rename-%d-%d", filepath.Base(p.from), os.Getpid(), i))
+		if err := os.Rename(p.from, tmps[i]); err != nil { return undo(err) }
+		done = append(done, step{p.from, tmps[i]})
+	}
+	for i, p := range plans {
+		// a hard link fails when the name was taken meanwhile, where a rename would
+		// replace the file. Filesystems without hard links (vfat, exFAT, some FUSE
+		// mounts) get a rename once Lstat has found the name free.
+		linked := true
+		err := os.Link(tmps[i], p.to)
+		if err != nil && !os.IsExist(err) {
+			if _, lerr := os.Lstat(p.to); lerr == nil {
+				err = os.ErrExist
+			} else if os.IsNotExist(lerr) {
+				linked, err = false, os.Rename(tmps[i], p.to)
+			}
+		}
+		if err != nil {
+			if os.IsExist(err) { err = errors.New(T("%s already exists", filepath.Base(p.to))) }
+			return undo(err)
+		}
+		if linked {
+			if err := os.Remove(tmps[i]); err != nil { os.Remove(p.to); return undo(err) }
+		}
+		done = append(done, step{tmps[i], p.to})
+	}
+	return nil
+}
+
+// updateRenameForm handles keys while the rename form is open: tab switches between
+// the pattern and the replacement, ctrl+t cycles the case, enter applies
+func (m *model) updateRenameForm(msg tea.KeyMsg) tea.Cmd {
+	f := m.rename
+	switch msg.String() {
+	case "esc":
+		m.rename = nil
+		return nil
+	case "tab", "shift+tab":
+		if f.find.Focused() { f.find.Blur(); return f.replace.Focus() }
+		f.replace.Blur()
+		return f.find.Focus()
+	case "ctrl+t":
+		f.caseIdx = (f.caseIdx + 1) % len(renameCases)
+		return nil
+	case "enter":
+		plans, err := f.plan()
+		if err != nil { m.status = T("bad pattern: %v", err); return nil }
+		var todo []renamePlan
+		for _, p := range plans {
+			if p.problem != "" { m.status = T("cannot rename %s: %s", filepath.Base(p.from), p.problem); return nil }
+			if p.to != p.from { todo = append(todo, p) }
+		}
+		if len(todo) == 0 { m.status = T("no name changes"); return nil }
+		err = applyRenames(todo)
+		for _, p := range todo {
+			appendAudit(m.auditPath, fmt.Sprintf("%s\trename=apply\tpath=%s\tto=%s\tuser=%s\terror=%v", time.Now().Format(time.RFC3339), p.from, p.to, transferUser(), err))
+		}
+		if err != nil { m.status = T("rename failed, nothing was renamed: %v", err); slog.Warn("batch rename failed", "err", err); return nil }
+		moved := map[string]string{}
+		for _, p := range todo { moved[p.from] = p.to }
+		if err := moveTags(moved); err != nil { slog.Warn("tags not moved", "err", err) }
+		m.rename = nil
+		m.files.marked = nil
+		m.refreshFiles()
+		m.status = T("renamed %d files", len(todo))
+		return nil
+	}
+	var cmd tea.Cmd
+	if f.find.Focused() { f.find, cmd = f.find.Update(msg) } else { f.replace, cmd = f.replace.Update(msg) }
+	return cmd
+}
+
+// view renders the form and the old → new preview in place of the file list
+func (f *renameForm) view(w, h int, plain bool) string {
+	var b strings.Builder
+	b.WriteString(f.find.View() + "\n" + f.replace.View() + "\n")
+	help := T("case: %s • tab: switch field • ctrl+t: case • enter: rename • esc: cancel • {n}/{nnn}: counter, {name}/{ext}: name parts, $1: group", T(renameCases[f.caseIdx]))
+	if !plain { help = helpStyle.Render(help) }
+	b.WriteString(help + "\n\n")
+	plans, err := f.plan()
+	if err != nil { return b.String() + T("bad pattern: %v", err) + "\n" }
+	n := max(1, h-5)
+	problems := 0
+	for i, p := range plans {
+		if p.problem != "" { problems++ }
+		if i >= n { continue }
+		old, name := filepath.Base(p.from), filepath.Base(p.to)
+		line := fmt.Sprintf("%s → %s", old, name)
+		if p.problem != "" { line += "  ✗ " + p.problem }
+		line = truncateCells(line, w)
+		switch {
+		case plain:
+		case p.problem != "":
+			line = diffDelStyle.Render(line)
+		case p.to == p.from:
+			line = helpStyle.Render(line)
+		}
+		b.WriteString(line + "\n")
+	}
+	if len(plans) > n { b.WriteString(T("… and %d more", len(plans)-n) + "\n") }
+	if problems > 0 { b.WriteString("\n" + T("%d names cannot be applied", problems) + "\n") }
+	return b.String()
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// requestEvent is one state change of a request. Events are appended to
+// request_history.jsonl next to requests.json, or the database store, and outlive the request itself, which
+// leaves the queue when it is decided.
+type requestEvent struct {
+	ID      string       `json:"id"`
+	State   string       `json:"state"` // created, commented, approved or denied
+	By      string       `json:"by"`
+	Time    string       `json:"time"`
+	Note    string       `json:"note,omitempty"`
+	Request *requestItem `json:"request,omitempty"` // snapshot, on created and decision events
+
+	// the approved run: exit code, duration, run error and the file with its output
+	Exit     *int   `json:"exit,omitempty"`
+	Duration string `json:"duration,omitempty"`
+	Error    string `json:"error,omitempty"`
+	Artifact string `json:"artifact,omitempty"`
+}
+
+func requestHistoryPath(requestsPath string) string {
+	return filepath.Join(filepath.Dir(requestsPath), "request_history.jsonl")
+}
+
+// saveRequestArtifact keeps the output of an approved run in artifacts/, named after
+// the request and the start of the run, and returns its path
+func saveRequestArtifact(requestsPath, id string, start time.Time, out outputLines) (string, error) {
+	dir := filepath.Join(filepath.Dir(requestsPath), "artifacts")
+	if err := os.MkdirAll(dir, 0o700); err != nil { return "", err }
+	path := filepath.Join(dir, fmt.Sprintf("%s-%s.log", filepath.Base(id), start.Format("20060102-150405")))
+	if err := saveStreams(path, out); err != nil { return "", err }
+	return path, nil
+}
+
+// recordRequestEvent appends ev to the history, stamping the time when unset
+func recordRequestEvent(requestsPath string, ev requestEvent) error {
+	if ev.Time == "" { ev.Time = time.Now().Format(time.RFC3339) }
+	return withRequestStore(requestsPath, func(s RequestStore) error { return s.Record(ev) })
+}
+
+// requestHistory returns the recorded events of request id, oldest first
+func requestHistory(requestsPath, id string) ([]requestEvent, error) {
+	var evs []requestEvent
+	err := withRequestStore(requestsPath, func(s RequestStore) (err error) {
+		evs, err = s.History(id)
+		return err
+	})
+	return evs, err
+}
+
+// requestRecord is everything known about one request: the request as queued (or as
+// it was when decided) and its history, starting with its creation
+type requestRecord struct {
+	Request requestItem    `json:"request"`
+	Pending bool           `json:"pending"`
+	History []requestEvent `json:"history"`
+	Output  string         `json:"-"` // artifact of the last approved run
+}
+
+// loadRequestRecord finds request id in the queue or, once decided, in the history.
+// Requests are queued by scripts that know nothing of the history, so a missing
+// created event is derived from the request itself.
+func loadRequestRecord(requestsPath, id string) (requestRecord, error) {
+	hist, err := requestHistory(requestsPath, id)
+	if err != nil { return requestRecord{}, err }
+	rec := requestRecord{History: hist}
+	r, err := findRequest(requestsPath, id)
+	switch {
+	case err == nil:
+		rec.Request, rec.Pending = r, true
+	case err != errRequestNotFound:
+		return requestRecord{}, err
+	default:
+		found := false
+		for _, ev := range hist { if ev.Request != nil { rec.Request, found = *ev.Request, true } }
+		if !found { return requestRecord{}, errRequestNotFound }
+	}
+	if len(hist) == 0 || hist[0].State != "created" {
+		r := rec.Request
+		rec.History = append([]requestEvent{{ID: r.ID, State: "created", By: r.User, Time: r.Time}}, hist...)
+	}
+	for _, ev := range rec.History {
+		if ev.Artifact == "" { continue }
+		b, err := ioutil.ReadFile(ev.Artifact)
+		if err != nil { rec.Output = T("(output unavailable: %v)", err) } else { rec.Output = string(b) }
+	}
+	return rec, nil
+}
+
+// commentRequest adds a comment to the history of a queued or decided request
+func commentRequest(requestsPath, id, by, text string) error {
+	if _, err := loadRequestRecord(requestsPath, id); err != nil { return err }
+	return recordRequestEvent(requestsPath, requestEvent{ID: id, State: "commented", By: by, Note: text})
+}
+
+// renderRequestRecord is the request detail pane: the fields, the history and the
+// raw JSON of the record
+func renderRequestRecord(rec requestRecord) string {
+	r := rec.Request
+	var b strings.Builder
+	state := T("pending")
+	if !rec.Pending { state = T("decided") }
+	b.WriteString(T("Request %s (%s)", r.ID, state) + "\n\n")
+	fmt.Fprintf(&b, "  %-10s %s\n", T("agent"), r.Agent)
+	fmt.Fprintf(&b, "  %-10s %s\n", T("requester"), r.User)
+	fmt.Fprintf(&b, "  %-10s %s\n", T("time"), r.Time)
+	if r.Notes != "" { fmt.Fprintf(&b, "  %-10s %s\n", T("notes"), r.Notes) }
+	b.WriteString("\n" + T("History") + "\n\n")
+	for _, ev := range rec.History {
+		line := fmt.Sprintf("  %-25s  %-9s  %s", ev.Time, T(ev.State), ev.By)
+		if ev.Note != "" { line += ": " + ev.Note }
+		if ev.Exit != nil { line += " " + T("(exit %d in %s)", *ev.Exit, ev.Duration) }
+		if ev.Error != "" { line += " " + ev.Error }
+		b.WriteString(line + "\n")
+		if ev.Artifact != "" { b.WriteString("    " + T("output: %s", ev.Artifact) + "\n") }
+	}
+	if rec.Output != "" { b.WriteString("\n" + T("Output of the approved run") + "\n\n" + strings.TrimRight(rec.Output, "\n") + "\n") }
+	raw, _ := json.MarshalIndent(rec, "", "  ")
+	b.WriteString("\n" + T("Raw JSON") + "\n\n" + string(raw) + "\n")
+	return b.String()
+}
+
+func newCommentInput() textinput.Model {
+	ti := textinput.New()
+	ti.Prompt = T("comment: ")
+	ti.CharLimit = 500
+	return ti
+}
+
+// updateComment handles keys while the Requests comment prompt has focus
+func (m *model) updateComment(msg tea.KeyMsg) tea.Cmd {
+	switch msg.String() {
+	case "esc":
+		m.commentInput.Blur()
+		return nil
+	case "enter":
+		text := strings.TrimSpace(m.commentInput.Value())
+		m.commentInput.Blur()
+		sel, ok := m.requestsList.SelectedItem().(requestItem)
+		if !ok || text == "" { return nil }
+		if err := commentRequest(m.requestsPath, sel.ID, transferUser(), text); err != nil { m.status = T("comment failed: %v", err); slog.Warn("comment failed", "request", sel.ID, "err", err); return nil }
+		m.showRequestRecord(sel.ID)
+		m.status = T("commented on request %s", sel.ID)
+		return nil
+	}
+	var cmd tea.Cmd
+	m.commentInput, cmd = m.commentInput.Update(msg)
+	return cmd
+}
+
+// showRequestRecord opens the detail of request id in a Preview pane beside the list
+func (m *model) showRequestRecord(id string) {
+	rec, err := loadRequestRecord(m.requestsPath, id)
+	if err != nil { m.status = T("request %s: %v", id, err); return }
+	m.panes.show(true, m.tabs[m.active], "Preview")
+	m.setContent(renderRequestRecord(rec))
+	m.vp.GotoTop()
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var errRequestNotFound = errors.New("request not found")
+
+// isAdmin reports whether the session may approve or deny requests; wish-server sets
+// SSH_IS_ADMIN for allowlisted admins
+func isAdmin() bool { return os.Getenv("SSH_IS_ADMIN") == "1" }
+
+// listRequests returns the pending requests, oldest first
+func listRequests(requestsPath string) ([]requestItem, error) {
+	var reqs []requestItem
+	err := withRequestStore(requestsPath, func(s RequestStore) (err error) {
+		reqs, err = s.Pending()
+		return err
+	})
+	return reqs, err
+}
+
+func findRequest(path, id string) (requestItem, error) {
+	reqs, err := listRequests(path)
+	if err != nil { return requestItem{}, err }
+	for _, r := range reqs { if r.ID == id { return r, nil } }
+	return requestItem{}, errRequestNotFound
+}
+
+// takeRequest removes request id from the queue. The store makes it atomic (the JSON
+// store under the same requests lock as approve_request.sh), so two approvers cannot
+// both act on it.
+func takeRequest(path, id string) (requestItem, error) {
+	var taken requestItem
+	err := withRequestStore(path, func(s RequestStore) (err error) {
+		taken, err = s.Take(id)
+		return err
+	})
+	return taken, err
+}
+
+// auditDecision records who approved or denied r; extra holds further tab-separated
+// key=value fields such as the exit code of the approved run
+func auditDecision(auditPath string, r requestItem, decision, by, extra string) error {
+	line := fmt.Sprintf("%s\tagent=%s\treq=%s\trequester=%s\t%s_by=%s", time.Now().Format(time.RFC3339), r.Agent, r.ID, r.User, decision, by)
+	if extra != "" { line += "\t" + extra }
+	return appendAudit(auditPath, line)
+}
+
+// requestSpan traces one approval decision; an approved run is its child
+func requestSpan(r requestItem, decision, by string) (context.Context, trace.Span) {
+	return startSpan(traceCtx, "request."+decision, attribute.String("request.id", r.ID), attribute.String("agent", r.Agent), attribute.String("requester", r.User), attribute.String("approver", by))
+}
+
+// decision is the outcome of approving or denying one request
+type decision struct {
+	req      requestItem
+	by       string
+	approved bool
+	out      string // output of the approved run
+	lines    outputLines // out with each line's stream
+	code     int
+	runErr   error
+	duration time.Duration
+	artifact string // file holding out, "" if it could not be written
+}
+
+func (d decision) event() notifyEvent {
+	verdict := T("denied")
+	if d.approved { verdict = T("approved") }
+	return notifyEvent{Kind: EventApproval, ID: d.req.ID, Agent: d.req.Agent, User: d.req.User, Notes: d.req.Notes, By: d.by, Decision: verdict, Exit: d.code}
+}
+
+// record adds the decision to the request history, with a snapshot of the request
+// since it has left the queue
+func (d decision) record(requestsPath string) {
+	state := "denied"
+	if d.approved { state = "approved" }
+	r := d.req
+	ev := requestEvent{ID: r.ID, State: state, By: d.by, Request: &r}
+	if d.approved {
+		code := d.code
+		ev.Exit, ev.Duration, ev.Artifact = &code, d.duration.Round(time.Millisecond).String(), d.artifact
+		if d.runErr != nil { ev.Error = d.runErr.Error() }
+	}
+	if err := recordRequestEvent(requestsPath, ev); err != nil { slog.Warn("request history write failed", "request", r.ID, "err", err) }
+}
+
+// emit publishes the decision on the event bus
+func (d decision) emit() {
+	ev := busEvent{Kind: BusRequestDecided, ID: d.req.ID, Agent: d.req.Agent, User: d.req.User, Notes: d.req.Notes, By: d.by, Decision: "denied", Source: "request"}
+	if d.approved { code := d.code; ev.Decision, ev.Exec, ev.Exit = "approved", true, &code }
+	emitEvent(ev)
+}
+
+// decideRequest takes request id off the queue, runs its agent with exec when
+// approving (or applies the saved plan of a Terraform request), and audits the decision. The caller checks isAdmin and notifies.
+func decideRequest(requestsPath, auditPath, id string, approve bool) (decision, error) {
+	r, err := takeRequest(requestsPath, id)
+	if err != nil { return decision{}, err }
+	tfDir, isTF := terraformRequestDir(r)
+	if isTF { defer os.Remove(terraformRequestPlan(r.ID)) }
+	d := decision{req: r, by: transferUser(), approved: approve}
+	if !approve {
+		_, span := requestSpan(r, "denied", d.by)
+		_ = auditDecision(auditPath, r, "denied", d.by, "")
+		d.record(requestsPath)
+		d.emit()
+		span.End()
+		return d, nil
+	}
+	ctx, span := requestSpan(r, "approved", d.by)
+	start := time.Now()
+	if isTF { d.lines, d.code, d.runErr = runTerraformApply(ctx, r, tfDir) } else { d.lines, d.code, d.runErr = runAgentCapture(ctx, r.Agent, true) }
+	d.out = d.lines.combined()
+	d.duration = time.Since(start)
+	d.artifact, err = saveRequestArtifact(requestsPath, r.ID, start, d.lines)
+	if err != nil { slog.Warn("request artifact write failed", "request", r.ID, "err", err) }
+	_ = auditDecision(auditPath, r, "approved", d.by, fmt.Sprintf("exit=%d\terror=%v\tduration=%s\tartifact=%s", d.code, d.runErr, d.duration.Round(time.Millisecond), d.artifact)+sandboxAudit(r.Agent, true))
+	d.record(requestsPath)
+	d.emit()
+	endSpan(span, d.code, d.runErr)
+	return d, nil
+}
+
+// requestSummary is the body of the approve and deny dialogs
+func requestSummary(r requestItem) string {
+	s := T("agent: %s\nrequested by %s at %s", r.Agent, r.User, r.Time)
+	if r.Notes != "" { s += "\n" + T("notes: %s", r.Notes) }
+	return s
+}
+
+// confirmApprove says what approving r will run before it runs
+func (m *model) confirmApprove(r requestItem) {
+	what := T("Approving runs %s with --exec now.", r.Agent)
+	if dir, ok := terraformRequestDir(r); ok { what = T("Approving applies the saved Terraform plan in %s now.", dir) }
+	m.askDetail(T("Approve request %s?", r.ID), requestSummary(r)+"\n\n"+what, func(m *model) tea.Cmd { return m.decide(r, true, "") })
+}
+
+// confirmDeny asks for an optional reason, added to the request's history as a comment
+func (m *model) confirmDeny(r requestItem) tea.Cmd {
+	return m.askText(T("Deny request %s?", r.ID), requestSummary(r), T("reason (optional)"), func(m *model, reason string) tea.Cmd { return m.decide(r, false, reason) })
+}
+
+// decide approves or denies r once the dialog was answered and shows the outcome
+func (m *model) decide(r requestItem, approve bool, reason string) tea.Cmd {
+	d, err := decideRequest(m.requestsPath, m.auditPath, r.ID, approve)
+	if err == nil && reason != "" {
+		if cerr := commentRequest(m.requestsPath, r.ID, d.by, reason); cerr != nil { slog.Warn("deny reason not recorded", "request", r.ID, "err", cerr) }
+	}
+	m.reloadRequests()
+	if err != nil { m.status = T("request %s: %v", r.ID, err); slog.Warn("request decision failed", "request", r.ID, "err", err); return nil }
+	if !d.approved {
+		m.setContent(T("Request denied"))
+		return notifyEventCmd(m.cfg.Notify, d.event())
+	}
+	m.showOutput(d.req.Agent, d.lines)
+	m.lastOutput = d.out
+	m.status = T("approved request %s", d.req.ID)
+	return notifyEventCmd(m.cfg.Notify, d.event())
+}
+
+// runRequests implements `term requests list|show|approve|deny`, the Requests tab for
+// scripts, plain SSH sessions and chat-ops bridges
+func runRequests(args []string) int {
+	fs := flag.NewFlagSet("requests", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print list/show output as JSON")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: term requests [-json] list | show <id> | comment <id> <text> | approve <id> | deny <id>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() < 1 { fs.Usage(); return 2 }
+
+	dir := tuiDataDir()
+	requestsPath := filepath.Join(dir, "requests.json")
+	auditPath := filepath.Join(dir, "agent_audit.log")
+	action, id := fs.Arg(0), fs.Arg(1)
+	if action != "list" && id == "" { fs.Usage(); return 2 }
+
+	switch action {
+	case "list":
+		reqs, err := listRequests(requestsPath)
+		if err != nil { fmt.Fprintln(os.Stderr, err); return 1 }
+		if *asJSON { return printJSON(reqs) }
+		if len(reqs) == 0 { fmt.Println(T("(no requests)")); return 0 }
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tAGENT\tUSER\tTIME")
+		for _, r := range reqs { fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.ID, r.Agent, r.User, r.Time) }
+		w.Flush()
+		return 0
+	case "show":
+		rec, err := loadRequestRecord(requestsPath, id)
+		if err != nil { fmt.Fprintf(os.Stderr, "%s: %v\n", id, err); return 1 }
+		if *asJSON { return printJSON(rec) }
+		fmt.Print(renderRequestRecord(rec))
+		return 0
+	case "comment":
+		text := strings.Join(fs.Args()[2:], " ")
+		if text == "" { fs.Usage(); return 2 }
+		if err := commentRequest(requestsPath, id, transferUser(), text); err != nil { fmt.Fprintf(os.Stderr, "%s: %v\n", id, err); return 1 }
+		return 0
+	case "approve", "deny":
+	default:
+		fs.Usage()
+		return 2
+	}
+
+	if !isAdmin() {
+		fmt.Fprintln(os.Stderr, T("Admin privileges required to approve/deny requests"))
+		return 3
+	}
+	if readOnlySession() {
+		fmt.Fprintln(os.Stderr, errReadOnly)
+		return 3
+	}
+	cfg := loadConfig()
+	defer setupLogging(cfg.Log, "requests", false)()
+	if cfg.Tracing { defer setupTracing("cbw-requests")() }
+	d, err := decideRequest(requestsPath, auditPath, id, action == "approve")
+	if err != nil { fmt.Fprintf(os.Stderr, "%s: %v\n", id, err); return 1 }
+	sendEvent(cfg.Notify, d.event())
+	if !d.approved { fmt.Println(T("Request denied")); return 0 }
+	fmt.Print(d.lines.text(true, false))
+	fmt.Fprint(os.Stderr, d.lines.stderr())
+	if d.code == 0 && d.runErr != nil { return 1 }
+	return d.code
+}
+
+func printJSON(v interface{}) int {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil { fmt.Fprintln(os.Stderr, err); return 1 }
+	fmt.Println(string(b))
+	return 0
+}
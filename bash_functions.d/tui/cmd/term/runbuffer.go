@@ -0,0 +1,42 @@
+package main
+
+import (
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// runBuffer runs the editor buffer with bash as a background job. With saveFirst the
+// buffer is saved and the real file runs, so relative paths and $0 behave as they
+// will in use; otherwise a temporary copy in the jobs dir runs and the file on disk
+// is left alone. The output shows in a Preview pane beside the editor.
+func (m *model) runBuffer(saveFirst bool) tea.Cmd {
+	if m.denyReadOnly() || !m.agentQuotaLeft() { return nil }
+	if strings.TrimSpace(m.ta.Value()) == "" { m.status = T("editor buffer is empty"); return nil }
+	name := "buffer"
+	if m.editorFile != "" { name = filepath.Base(m.editorFile) }
+	var script string
+	if saveFirst {
+		if !m.saveEditor() { return nil }
+		script = m.editorFile
+	} else {
+		if err := os.MkdirAll(jobsDir(), 0o700); err != nil { m.status = T("run failed: %v", err); slog.Warn("run failed", "err", err); return nil }
+		f, err := ioutil.TempFile(jobsDir(), "buffer-*.sh")
+		if err != nil { m.status = T("run failed: %v", err); slog.Warn("run failed", "err", err); return nil }
+		_, err = f.WriteString(m.ta.Value())
+		if cerr := f.Close(); err == nil { err = cerr }
+		if err != nil { m.status = T("run failed: %v", err); slog.Warn("run failed", "err", err); return nil }
+		script = f.Name()
+	}
+	j, err := enqueueScript("buffer:"+name, script, os.Getenv("SSH_USER"))
+	if err != nil { m.status = T("run failed: %v", err); slog.Warn("run failed", "err", err); return nil }
+	m.myJobs[j.ID] = true
+	m.panes.show(true, m.tabs[m.active], "Preview")
+	m.setContent(T("Running %s (%s)...\n", name, j.ID))
+	m.status = T("running %s as %s; output appears beside the editor when it finishes", name, j.ID)
+	return m.startJobsTick()
+}
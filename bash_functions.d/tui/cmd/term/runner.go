@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var (
+	errExecNotAllowed   = errors.New("execution not allowed for this user")
+	errExecNotPermitted = errors.New("user not permitted to exec this agent")
+	errExecNoBroker     = errors.New("exec needs an exec broker")
+)
+
+// execFallbackOnce logs once per process that exec is checked without a broker
+var execFallbackOnce sync.Once
+
+// execAllowed checks agent against the exec broker's grants for this user, and the
+// broker checks again; nothing is allowed in a read-only session. Without a broker
+// nothing is allowed either, unless insecure_env_exec trusts SSH_ALLOWED_EXEC, the
+// comma-separated agents any local shell can claim.
+func execAllowed(agent string) error {
+	if readOnlySession() { return errReadOnly }
+	var allowed []string
+	if sock := brokerSocket(); sock != "" {
+		g, err := brokerGrants(sock)
+		if err != nil { slog.Warn("exec broker unreachable", "err", err); return errExecNotAllowed }
+		allowed = g
+	} else if !loadConfig().InsecureEnvExec {
+		return errExecNoBroker
+	} else if env := os.Getenv("SSH_ALLOWED_EXEC"); env != "" {
+		execFallbackOnce.Do(func() { slog.Warn("insecure_env_exec: exec checked against SSH_ALLOWED_EXEC, which any local shell can set", "user", os.Getenv("SSH_USER")) })
+		allowed = strings.Split(env, ",")
+	}
+	if len(allowed) == 0 { return errExecNotAllowed }
+	for _, a := range allowed { if a == agent { return nil } }
+	return errExecNotPermitted
+}
+
+// agentRunnerPath is the shared agent_runner.sh used by the TUI, the scheduler and approvals
+func agentRunnerPath() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, "bash_functions.d", "40-agents", "agent_runner.sh")
+}
+
+// runAgentScript runs agent_runner.sh for agent, sourcing SSH_PLUGIN_ENV first when set.
+// It returns stdout and stderr interleaved and the exit code. The run is traced as a
+// child of ctx.
+func runAgentScript(ctx context.Context, agent string, execFlag bool) (string, int, error) {
+	out, code, err := runAgentCapture(ctx, agent, execFlag)
+	return out.combined(), code, err
+}
+
+// agentCommand builds the shell command for one agent run without starting it
+func agentCommand(ctx context.Context, agent string, execFlag bool) *exec.Cmd {
+	cmd := exec.Command("/bin/sh", "-c", agentShellLine(agent, execFlag))
+	cmd.Env = append(append(os.Environ(), traceEnv(ctx)...), runSecretEnv(agent, execFlag)...)
+	return cmd
+}
+
+// agentShellLine is the /bin/sh command line that invokes the runner for agent, in
+// the working directory and with the variables and limits the manifest gives it. Exec
+// runs are sandboxed, or go through `term broker run` when there is a broker.
+func agentShellLine(agent string, execFlag bool) string {
+	if execFlag && brokerSocket() != "" {
+		if self, err := os.Executable(); err == nil { return fmt.Sprintf("'%s' broker run '%s'", shellEscape(self), shellEscape(agent)) }
+	}
+	line := agentRunPrefix(agent) + fmt.Sprintf("'%s' '%s'", shellEscape(agentRunnerPath()), shellEscape(agent))
+	if execFlag { line = sandboxLine(agent, line+" --exec") }
+	line = limitLine(agent, line)
+	return withPluginEnv(line)
+}
+
+// scriptShellLine is the /bin/sh command line that runs a script file with bash
+func scriptShellLine(path string) string {
+	return withPluginEnv(fmt.Sprintf("bash '%s'", shellEscape(path)))
+}
+
+// withPluginEnv prepends sourcing SSH_PLUGIN_ENV to line when it is set
+func withPluginEnv(line string) string {
+	if pluginEnv := os.Getenv("SSH_PLUGIN_ENV"); pluginEnv != "" {
+		line = fmt.Sprintf("[ -f '%s' ] && . '%s'; %s", shellEscape(pluginEnv), shellEscape(pluginEnv), line)
+	}
+	return line
+}
+
+// exitCodeOf maps a command error to a process exit code (0 on success, 1 if it never ran)
+func exitCodeOf(err error) int {
+	if err == nil { return 0 }
+	if exitErr, ok := err.(*exec.ExitError); ok { return exitErr.ExitCode() }
+	return 1
+}
+
+// appendAudit appends one tab-separated line to the audit log
+func appendAudit(path, line string) error {
+	err := withAuditStore(path, func(s AuditStore) error { return s.Append(line) })
+	// most callers cannot do anything about a lost audit line, so it is logged here
+	if err != nil { slog.Error("audit write failed", "path", path, "err", err) }
+	return err
+}
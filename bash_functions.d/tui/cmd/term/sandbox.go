@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// sandboxSpec is a named profile in the manifest's sandboxes. Exec runs of agents
+// that name it are wrapped in bubblewrap or firejail; dry-runs are not.
+type sandboxSpec struct {
+	Tool     string   `json:"tool"`              // "bwrap" or "firejail"
+	Profile  string   `json:"profile,omitempty"` // firejail profile file
+	Network  bool     `json:"network,omitempty"` // keep network access; default none
+	Writable []string `json:"rw,omitempty"`      // paths the agent may write, ~ expanded
+	Hidden   []string `json:"hide,omitempty"`    // paths replaced by an empty directory, ~ expanded
+}
+
+func quoted(s string) string { return "'" + shellEscape(s) + "'" }
+
+// wrap runs line inside the sandbox. With bwrap the whole filesystem is read-only
+// apart from a private /tmp and the rw paths; firejail starts from its profile.
+func (s sandboxSpec) wrap(line string) (string, error) {
+	var args []string
+	switch s.Tool {
+	case "bwrap":
+		args = []string{"bwrap", "--die-with-parent", "--ro-bind", "/", "/", "--dev", "/dev", "--proc", "/proc", "--tmpfs", "/tmp"}
+		for _, p := range s.Writable { p = expandHome(p); args = append(args, "--bind", quoted(p), quoted(p)) }
+		for _, p := range s.Hidden { p = expandHome(p); args = append(args, "--tmpfs", quoted(p)) }
+		if !s.Network { args = append(args, "--unshare-net") }
+		args = append(args, "--")
+	case "firejail":
+		args = []string{"firejail", "--quiet"}
+		if s.Profile != "" { args = append(args, quoted("--profile="+expandHome(s.Profile))) }
+		if !s.Network { args = append(args, "--net=none") }
+		for _, p := range s.Writable { args = append(args, quoted("--read-write="+expandHome(p))) }
+		for _, p := range s.Hidden { args = append(args, quoted("--blacklist="+expandHome(p))) }
+		args = append(args, "--")
+	default:
+		return "", fmt.Errorf("unknown sandbox tool %q (want bwrap or firejail)", s.Tool)
+	}
+	return strings.Join(args, " ") + " /bin/sh -c " + quoted(line), nil
+}
+
+// agentSandbox is the profile agent names in the manifest; "" when it runs unsandboxed
+func agentSandbox(agent string) (string, sandboxSpec, error) {
+	mf, err := loadManifest()
+	if err != nil {
+		if os.IsNotExist(err) { return "", sandboxSpec{}, nil }
+		return "", sandboxSpec{}, err
+	}
+	a, ok := mf.agent(agent)
+	if !ok || a.Sandbox == "" { return "", sandboxSpec{}, nil }
+	s, ok := mf.Sandboxes[a.Sandbox]
+	if !ok {
+		names := make([]string, 0, len(mf.Sandboxes))
+		for n := range mf.Sandboxes { names = append(names, n) }
+		sort.Strings(names)
+		return a.Sandbox, s, fmt.Errorf("agent %s: no sandbox %q in the manifest (have %s)", agent, a.Sandbox, strings.Join(names, ", "))
+	}
+	return a.Sandbox, s, nil
+}
+
+// sandboxLine wraps an exec run of agent in its sandbox. A profile that cannot be
+// applied fails the run instead of running it unsandboxed.
+func sandboxLine(agent, line string) string {
+	_, s, err := agentSandbox(agent)
+	if err == nil && s.Tool == "" { return line }
+	if err == nil {
+		var wrapped string
+		if wrapped, err = s.wrap(line); err == nil { return wrapped }
+	}
+	return fmt.Sprintf("echo %s >&2; exit 126", quoted("sandbox: "+err.Error()))
+}
+
+// sandboxAudit is the sandbox= field of an audit line for a run of agent
+func sandboxAudit(agent string, execFlag bool) string {
+	if !execFlag { return "" }
+	name, _, _ := agentSandbox(agent)
+	if name == "" { return "" }
+	return "\tsandbox=" + name
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// maxCatchUp bounds how many missed runs the "all" policy replays after downtime
+const maxCatchUp = 24
+
+// schedule is one entry in schedules.json
+type schedule struct {
+	Name    string `json:"name"`
+	Agent   string `json:"agent"`
+	Every   string `json:"every"`              // Go duration, e.g. "15m", "24h"
+	Start   string `json:"start,omitempty"`    // RFC3339 time of the first run; default one interval after first seen
+	Exec    bool   `json:"exec,omitempty"`     // pass --exec to the runner (dry-run otherwise)
+	CatchUp string `json:"catch_up,omitempty"` // missed runs: "skip" (default), "once" or "all"
+}
+
+// scheduleState is the scheduler's view of one schedule, shared with the TUI through the state file
+type scheduleState struct {
+	Name      string `json:"name"`
+	Agent     string `json:"agent"`
+	Every     string `json:"every"`
+	Exec      bool   `json:"exec"`
+	NextRun   string `json:"next_run,omitempty"`
+	LastRun   string `json:"last_run,omitempty"`
+	LastExit  int    `json:"last_exit"`
+	LastError string `json:"last_error,omitempty"`
+	Runs      int    `json:"runs"`
+	Skipped   int    `json:"skipped"`
+}
+
+// schedulerState is persisted to scheduler_state.json after every change
+type schedulerState struct {
+	PID       int             `json:"pid"`
+	Updated   string          `json:"updated"`
+	Schedules []scheduleState `json:"schedules"`
+}
+
+func schedulesPath() string      { return filepath.Join(tuiDataDir(), "schedules.json") }
+func schedulerStatePath() string { return filepath.Join(tuiDataDir(), "scheduler_state.json") }
+
+func loadSchedules(path string) ([]schedule, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) { return nil, nil }
+		return nil, err
+	}
+	var arr []schedule
+	if err := json.Unmarshal(b, &arr); err != nil { return nil, err }
+	return arr, nil
+}
+
+func loadSchedulerState(path string) schedulerState {
+	var st schedulerState
+	if b, err := ioutil.ReadFile(path); err == nil { _ = json.Unmarshal(b, &st) }
+	return st
+}
+
+// saveSchedulerState writes the state atomically so the TUI never reads a partial file
+func saveSchedulerState(path string, st schedulerState) error {
+	st.PID = os.Getpid()
+	st.Updated = time.Now().Format(time.RFC3339)
+	b, err := json.MarshalIndent(st, "", "  ")
+	if err != nil { return err }
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0o600); err != nil { return err }
+	return os.Rename(tmp, path)
+}
+
+// dueRuns decides how many runs of a schedule to start at now and returns the next run time.
+// late counts the occurrences that fell due since next.
+func dueRuns(next, now time.Time, every time.Duration, policy string) (runs, late int, newNext time.Time) {
+	if now.Before(next) { return 0, 0, next }
+	late = int(now.Sub(next)/every) + 1
+	newNext = next.Add(time.Duration(late) * every)
+	switch policy {
+	case "all":
+		runs = late
+		if runs > maxCatchUp { runs = maxCatchUp }
+	case "once":
+		runs = 1
+	default:
+		// skip: only run if the current occurrence is on time, drop anything older
+		if late == 1 { runs = 1 }
+	}
+	return runs, late, newNext
+}
+
+// schedulerTick runs every due schedule once and persists the resulting state
+func schedulerTick(now time.Time, auditPath string, notify notifyConfig) error {
+	scheds, err := loadSchedules(schedulesPath())
+	if err != nil { return fmt.Errorf("load schedules: %w", err) }
+	prev := map[string]scheduleState{}
+	for _, s := range loadSchedulerState(schedulerStatePath()).Schedules { prev[s.Name] = s }
+
+	st := schedulerState{}
+	for _, sc := range scheds {
+		cur := prev[sc.Name]
+		cur.Name, cur.Agent, cur.Every, cur.Exec = sc.Name, sc.Agent, sc.Every, sc.Exec
+		every, err := time.ParseDuration(sc.Every)
+		if err != nil || every <= 0 {
+			cur.LastError = fmt.Sprintf("invalid interval %q", sc.Every)
+			st.Schedules = append(st.Schedules, cur)
+			continue
+		}
+		next, err := time.Parse(time.RFC3339, cur.NextRun)
+		if err != nil {
+			next = now.Add(every)
+			if t, err := time.Parse(time.RFC3339, sc.Start); err == nil { next = t }
+		}
+		runs, late, newNext := dueRuns(next, now, every, sc.CatchUp)
+		cur.Skipped += late - runs
+		cur.NextRun = newNext.Format(time.RFC3339)
+		for i := 0; i < runs; i++ {
+			start := time.Now()
+			emitEvent(busEvent{Kind: BusAgentStarted, ID: "schedule:" + sc.Name, Agent: sc.Agent, Exec: sc.Exec, User: "scheduler", State: JobRunning, Source: "scheduler"})
+			ctx, span := startSpan(traceCtx, "schedule.run", attribute.String("schedule", sc.Name), attribute.String("agent", sc.Agent))
+			_, code, runErr := runAgentScript(ctx, sc.Agent, sc.Exec)
+			endSpan(span, code, runErr)
+			cur.LastRun = start.Format(time.RFC3339)
+			cur.LastExit = code
+			cur.LastError = ""
+			if runErr != nil { cur.LastError = runErr.Error() }
+			cur.Runs++
+			appendAudit(auditPath, fmt.Sprintf("%s\tagent=%s\texec=%v\texit=%d\terror=%v\tsource=scheduler\tschedule=%s\tduration=%s", start.Format(time.RFC3339), sc.Agent, sc.Exec, code, runErr, sc.Name, time.Since(start).Round(time.Millisecond))+sandboxAudit(sc.Agent, sc.Exec))
+			slog.Info("schedule run", "schedule", sc.Name, "agent", sc.Agent, "exit", code, "duration", time.Since(start).Round(time.Millisecond))
+			emitEvent(busEvent{Kind: BusAgentFinished, ID: "schedule:" + sc.Name, Agent: sc.Agent, Exec: sc.Exec, User: "scheduler", State: JobFinished, Exit: &code, Source: "scheduler"})
+			if code != 0 || runErr != nil {
+				sendEvent(notify, notifyEvent{Kind: EventAgentFailure, ID: "schedule:" + sc.Name, Agent: sc.Agent, User: "scheduler", Exit: code, Error: cur.LastError})
+			}
+		}
+		st.Schedules = append(st.Schedules, cur)
+	}
+	return saveSchedulerState(schedulerStatePath(), st)
+}
+
+// runScheduler implements `term scheduler`: a headless loop suitable for a systemd service
+func runScheduler(args []string) int {
+	fs := flag.NewFlagSet("scheduler", flag.ExitOnError)
+	interval := fs.Duration("interval", 30*time.Second, "how often to check for due schedules")
+	once := fs.Bool("once", false, "check schedules once and exit")
+	fs.Parse(args)
+
+	_ = os.MkdirAll(tuiDataDir(), 0o700)
+	auditPath := filepath.Join(tuiDataDir(), "agent_audit.log")
+	requestsPath := filepath.Join(tuiDataDir(), "requests.json")
+	cfg := loadConfig()
+	defer setupLogging(cfg.Log, "scheduler", false)()
+	if cfg.Tracing { defer setupTracing("cbw-scheduler")() }
+	if *once {
+		if err := notifyPendingRequests(cfg.Notify, requestsPath); err != nil { slog.Error("notify failed", "err", err) }
+		if err := schedulerTick(time.Now(), auditPath, cfg.Notify); err != nil { slog.Error("scheduler tick failed", "err", err); return 1 }
+		maybeCompactAudit(auditPath, cfg.Audit)
+		return 0
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	slog.Info("scheduler started", "schedules", schedulesPath(), "interval", *interval)
+	t := time.NewTicker(*interval)
+	defer t.Stop()
+	for {
+		// the daemon also announces new approval requests, so admins need not watch the TUI
+		if err := notifyPendingRequests(cfg.Notify, requestsPath); err != nil { slog.Error("notify failed", "err", err) }
+		if err := schedulerTick(time.Now(), auditPath, cfg.Notify); err != nil { slog.Error("scheduler tick failed", "err", err) }
+		maybeCompactAudit(auditPath, cfg.Audit)
+		select {
+		case <-ctx.Done():
+			slog.Info("scheduler stopping")
+			return 0
+		case <-t.C:
+		}
+	}
+}
+
+// processAlive reports whether pid refers to a running process
+func processAlive(pid int) bool {
+	if pid <= 0 { return false }
+	p, err := os.FindProcess(pid)
+	if err != nil { return false }
+	return p.Signal(syscall.Signal(0)) == nil
+}
+
+// renderSchedule formats the scheduler state file for the Schedule tab
+func renderSchedule() string {
+	st := loadSchedulerState(schedulerStatePath())
+	var b strings.Builder
+	if st.Updated == "" {
+		b.WriteString("No scheduler state yet. Define schedules in " + schedulesPath() + " and run `term scheduler` (or install cbw-scheduler.service).\n")
+		return b.String()
+	}
+	daemon := "not running"
+	if processAlive(st.PID) { daemon = fmt.Sprintf("running (pid %d)", st.PID) }
+	fmt.Fprintf(&b, "Scheduler: %s, last update %s\n\n", daemon, st.Updated)
+	fmt.Fprintf(&b, "%-20s %-20s %-6s %-5s %-25s %-25s %-5s %s\n", "NAME", "AGENT", "EVERY", "EXEC", "NEXT RUN", "LAST RUN", "EXIT", "RUNS")
+	for _, s := range st.Schedules {
+		fmt.Fprintf(&b, "%-20s %-20s %-6s %-5v %-25s %-25s %-5d %d\n", s.Name, s.Agent, s.Every, s.Exec, s.NextRun, s.LastRun, s.LastExit, s.Runs)
+		if s.LastError != "" { fmt.Fprintf(&b, "    error: %s\n", s.LastError) }
+	}
+	return b.String()
+}
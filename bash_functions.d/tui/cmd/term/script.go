@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// scriptResult is printed as one JSON line per action
+type scriptResult struct {
+	Line   int         `json:"line"`
+	Action string      `json:"action"`
+	Args   []string    `json:"args,omitempty"`
+	OK     bool        `json:"ok"`
+	Exit   *int        `json:"exit,omitempty"`
+	Output string      `json:"output,omitempty"`
+	Data   interface{} `json:"data,omitempty"`
+	Error  string      `json:"error,omitempty"`
+	Took   string      `json:"took"`
+}
+
+// scriptRunner holds the state a script builds up, like the TUI's model does
+type scriptRunner struct {
+	cwd, selected           string
+	auditPath, requestsPath string
+	cfg                     tuiConfig
+}
+
+const scriptUsage = `usage: term script [-keep-going] [file|-]
+
+One action per line; blank lines and lines starting with # are ignored:
+  cd <dir>               change the working directory
+  select <file>          select a file (relative to the working directory)
+  preview [file]         print a file, by default the selected one
+  agents                 list agents
+  run <agent> [--exec]   run an agent and wait for it (exec needs SSH_ALLOWED_EXEC)
+  requests               list pending requests
+  approve <id>           approve a request and run its agent (needs SSH_IS_ADMIN=1)
+  deny <id>              deny a request (needs SSH_IS_ADMIN=1)
+  jobs                   list background jobs
+  echo <text>            print text, e.g. to narrate a demo
+  sleep <duration>       pause, e.g. 500ms
+`
+
+// runScript implements `term script`: it executes TUI actions without a terminal and
+// prints one JSON result per action. It stops at the first failure unless -keep-going.
+func runScript(args []string) int {
+	fs := flag.NewFlagSet("script", flag.ExitOnError)
+	keepGoing := fs.Bool("keep-going", false, "run the remaining actions after one fails")
+	fs.Usage = func() { fmt.Fprint(fs.Output(), scriptUsage); fs.PrintDefaults() }
+	fs.Parse(args)
+
+	var in io.Reader = os.Stdin
+	if name := fs.Arg(0); name != "" && name != "-" {
+		f, err := os.Open(name)
+		if err != nil { fmt.Fprintln(os.Stderr, err); return 2 }
+		defer f.Close()
+		in = f
+	}
+	cfg := loadConfig()
+	defer setupLogging(cfg.Log, "script", false)()
+	if cfg.Tracing { defer setupTracing("cbw-script")() }
+	cwd, _ := os.Getwd()
+	dir := tuiDataDir()
+	_ = os.MkdirAll(dir, 0o700)
+	r := &scriptRunner{cwd: cwd, auditPath: filepath.Join(dir, "agent_audit.log"), requestsPath: filepath.Join(dir, "requests.json"), cfg: cfg}
+
+	enc := json.NewEncoder(os.Stdout)
+	failed := false
+	sc := bufio.NewScanner(in)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") { continue }
+		fields := strings.Fields(line)
+		res := scriptResult{Line: n, Action: fields[0], Args: fields[1:]}
+		start := time.Now()
+		err := r.do(&res, fields[0], fields[1:], strings.TrimSpace(strings.TrimPrefix(line, fields[0])))
+		res.Took = time.Since(start).Round(time.Millisecond).String()
+		res.OK = err == nil
+		if err != nil { res.Error = err.Error() }
+		enc.Encode(res)
+		if err != nil {
+			failed = true
+			if !*keepGoing { return 1 }
+		}
+	}
+	if err := sc.Err(); err != nil { fmt.Fprintln(os.Stderr, err); return 1 }
+	if failed { return 1 }
+	return 0
+}
+
+// do runs one action; rest is the line after the action name, for arguments that may
+// contain spaces (paths, echo text)
+func (r *scriptRunner) do(res *scriptResult, action string, args []string, rest string) error {
+	switch action {
+	case "cd":
+		dir := r.path(rest)
+		fi, err := os.Stat(dir)
+		if err != nil { return err }
+		if !fi.IsDir() { return fmt.Errorf("%s: not a directory", dir) }
+		r.cwd = dir
+		res.Data = dir
+	case "select":
+		p := r.path(rest)
+		if _, err := os.Stat(p); err != nil { return err }
+		r.selected = p
+		res.Data = p
+	case "preview":
+		p := r.selected
+		if rest != "" { p = r.path(rest) }
+		if p == "" { return errors.New("no file selected") }
+		b, err := ioutil.ReadFile(p)
+		if err != nil { return err }
+		res.Output = string(b)
+	case "agents":
+		var names []string
+		for _, it := range loadAgents() { if a, ok := it.(agentItem); ok { names = append(names, a.name) } }
+		res.Data = names
+	case "run":
+		if len(args) < 1 || len(args) > 2 || (len(args) == 2 && args[1] != "--exec") { return errors.New("usage: run <agent> [--exec]") }
+		agent, execFlag := args[0], len(args) == 2
+		if execFlag {
+			if err := execAllowed(agent); err != nil { return err }
+		}
+		start := time.Now()
+		ctx, span := startSpan(traceCtx, "script.run", attribute.String("agent", agent))
+		out, code, runErr := runAgentScript(ctx, agent, execFlag)
+		endSpan(span, code, runErr)
+		appendAudit(r.auditPath, fmt.Sprintf("%s\tagent=%s\texec=%v\texit=%d\terror=%v\tsource=script\tuser=%s\tduration=%s", start.Format(time.RFC3339), agent, execFlag, code, runErr, transferUser(), time.Since(start).Round(time.Millisecond))+sandboxAudit(agent, execFlag))
+		res.Output, res.Exit = out, &code
+		if code != 0 { return fmt.Errorf("exit status %d", code) }
+		return runErr
+	case "requests":
+		reqs, err := listRequests(r.requestsPath)
+		if err != nil { return err }
+		res.Data = reqs
+	case "approve", "deny":
+		if len(args) != 1 { return fmt.Errorf("usage: %s <id>", action) }
+		if !isAdmin() { return errors.New(T("Admin privileges required to approve/deny requests")) }
+		if readOnlySession() { return errReadOnly }
+		d, err := decideRequest(r.requestsPath, r.auditPath, args[0], action == "approve")
+		if err != nil { return err }
+		sendEvent(r.cfg.Notify, d.event())
+		res.Data = d.req
+		if !d.approved { return nil }
+		res.Output, res.Exit = d.out, &d.code
+		if d.code != 0 { return fmt.Errorf("exit status %d", d.code) }
+		return d.runErr
+	case "jobs":
+		res.Data = loadJobs()
+	case "echo":
+		res.Output = rest
+	case "sleep":
+		d, err := time.ParseDuration(rest)
+		if err != nil { return err }
+		time.Sleep(d)
+	default:
+		return fmt.Errorf("unknown action %q", action)
+	}
+	return nil
+}
+
+func (r *scriptRunner) path(p string) string {
+	p = expandHome(p)
+	if p == "" { return r.cwd }
+	if !filepath.IsAbs(p) { p = filepath.Join(r.cwd, p) }
+	return filepath.Clean(p)
+}
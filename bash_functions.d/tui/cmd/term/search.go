@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/textinput"
+)
+
+const (
+	maxSearchHits  = 500     // stop collecting after this many matches
+	searchContext  = 2       // context lines shown around a match
+	maxSearchBytes = 4 << 20 // the Go fallback skips larger files
+)
+
+// searchHit is one matching line plus its surrounding context
+type searchHit struct {
+	path   string
+	line   int
+	col    int // 1-based column of the first match on the line
+	text   string
+	before []string
+	after  []string
+}
+
+// searchFileItem heads the matches of one file in the results list
+type searchFileItem struct {
+	rel string
+	n   int
+}
+
+func (i searchFileItem) Title() string       { return i.rel }
+func (i searchFileItem) Description() string { return T("%d matches", i.n) }
+func (i searchFileItem) FilterValue() string { return i.rel }
+
+// searchHitItem is a single match in the results list
+type searchHitItem struct{ h searchHit }
+
+func (i searchHitItem) Title() string       { return fmt.Sprintf("  %d: %s", i.h.line, strings.TrimSpace(i.h.text)) }
+func (i searchHitItem) Description() string { return "" }
+func (i searchHitItem) FilterValue() string { return i.h.text }
+
+// searchResultMsg delivers the matches of a finished search
+type searchResultMsg struct {
+	pattern string
+	dir     string
+	tool    string
+	hits    []searchHit
+	err     error
+}
+
+func newSearchInput() textinput.Model {
+	ti := textinput.New()
+	ti.Placeholder = T("press / to search under the current directory")
+	ti.CharLimit = 256
+	ti.Width = width - 34
+	return ti
+}
+
+func newSearchList() list.Model {
+	l := list.New(nil, list.NewDefaultDelegate(), 60, height-14)
+	l.Title = T("Search")
+	l.SetShowHelp(false)
+	l.SetFilteringEnabled(false)
+	return l
+}
+
+// runSearch searches dir for pattern in the background, with ripgrep when it is
+// installed and a pure-Go walk otherwise
+func runSearch(dir, pattern string) tea.Cmd {
+	return func() tea.Msg {
+		msg := searchResultMsg{pattern: pattern, dir: dir, tool: "rg"}
+		if _, err := exec.LookPath("rg"); err == nil {
+			msg.hits, msg.err = ripgrepSearch(dir, pattern)
+		} else {
+			msg.tool = "go"
+			msg.hits, msg.err = goSearch(dir, pattern)
+		}
+		return msg
+	}
+}
+
+// ripgrepSearch runs rg --json, which reports matches and context lines as separate
+// events; they are collected per file and joined into hits afterwards
+func ripgrepSearch(dir, pattern string) ([]searchHit, error) {
+	cmd := exec.Command("rg", "--json", "-C", fmt.Sprint(searchContext), "-e", pattern, ".")
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	// exit status 1 only means nothing matched
+	if exitErr, ok := err.(*exec.ExitError); err != nil && !(ok && exitErr.ExitCode() == 1) {
+		return nil, fmt.Errorf("rg: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	type event struct {
+		Type string `json:"type"`
+		Data struct {
+			Path       struct{ Text string `json:"text"` } `json:"path"`
+			Lines      struct{ Text string `json:"text"` } `json:"lines"`
+			LineNumber int `json:"line_number"`
+			Submatches []struct{ Start int `json:"start"` } `json:"submatches"`
+		} `json:"data"`
+	}
+	var order []string
+	lines := map[string]map[int]string{}
+	matches := map[string][]int{}
+	cols := map[string]map[int]int{}
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	sc.Buffer(make([]byte, 64*1024), 4<<20)
+	for sc.Scan() {
+		var ev event
+		if json.Unmarshal(sc.Bytes(), &ev) != nil || ev.Data.Path.Text == "" { continue }
+		p := filepath.Join(dir, ev.Data.Path.Text)
+		switch ev.Type {
+		case "begin":
+			order = append(order, p)
+			lines[p] = map[int]string{}
+			cols[p] = map[int]int{}
+		case "match", "context":
+			if lines[p] == nil { continue }
+			lines[p][ev.Data.LineNumber] = strings.TrimRight(ev.Data.Lines.Text, "\r\n")
+			if ev.Type == "match" {
+				matches[p] = append(matches[p], ev.Data.LineNumber)
+				if len(ev.Data.Submatches) > 0 { cols[p][ev.Data.LineNumber] = ev.Data.Submatches[0].Start }
+			}
+		}
+	}
+	var hits []searchHit
+	for _, p := range order {
+		hits = append(hits, buildHits(p, lines[p], matches[p], cols[p])...)
+		if len(hits) >= maxSearchHits { return hits[:maxSearchHits], nil }
+	}
+	return hits, nil
+}
+
+// goSearch walks dir matching pattern as a Go regexp. Like rg it skips hidden
+// directories and binary files, but it does not read .gitignore.
+func goSearch(dir, pattern string) ([]searchHit, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil { return nil, err }
+	var hits []searchHit
+	err = filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil { return nil }
+		if info.IsDir() {
+			if p != dir && (strings.HasPrefix(info.Name(), ".") || info.Name() == "node_modules") { return filepath.SkipDir }
+			return nil
+		}
+		if !info.Mode().IsRegular() || info.Size() > maxSearchBytes { return nil }
+		b, err := ioutil.ReadFile(p)
+		if err != nil { return nil }
+		// a NUL byte near the start marks a binary file
+		head := b
+		if len(head) > 8000 { head = head[:8000] }
+		if bytes.IndexByte(head, 0) >= 0 { return nil }
+		lines := map[int]string{}
+		var matched []int
+		cols := map[int]int{}
+		for i, l := range strings.Split(string(b), "\n") {
+			lines[i+1] = strings.TrimRight(l, "\r")
+			if loc := re.FindStringIndex(l); loc != nil { matched = append(matched, i+1); cols[i+1] = loc[0] }
+		}
+		hits = append(hits, buildHits(p, lines, matched, cols)...)
+		if len(hits) >= maxSearchHits { hits = hits[:maxSearchHits]; return filepath.SkipAll }
+		return nil
+	})
+	return hits, err
+}
+
+// buildHits turns the matched line numbers of one file into hits with context; offsets
+// holds the byte offset of the first match on each line
+func buildHits(path string, lines map[int]string, matched []int, offsets map[int]int) []searchHit {
+	sort.Ints(matched)
+	out := make([]searchHit, 0, len(matched))
+	for _, n := range matched {
+		h := searchHit{path: path, line: n, col: 1, text: lines[n]}
+		if off := offsets[n]; off > 0 && off <= len(h.text) { h.col = utf8.RuneCountInString(h.text[:off]) + 1 }
+		for i := n - searchContext; i < n; i++ {
+			if l, ok := lines[i]; ok { h.before = append(h.before, l) }
+		}
+		for i := n + 1; i <= n+searchContext; i++ {
+			if l, ok := lines[i]; ok { h.after = append(h.after, l) }
+		}
+		out = append(out, h)
+	}
+	return out
+}
+
+// searchItems groups hits by file under a header item per file
+func searchItems(dir string, hits []searchHit) []list.Item {
+	var out []list.Item
+	for i := 0; i < len(hits); {
+		j := i
+		for j < len(hits) && hits[j].path == hits[i].path { j++ }
+		rel, err := filepath.Rel(dir, hits[i].path)
+		if err != nil { rel = hits[i].path }
+		out = append(out, searchFileItem{rel: rel, n: j - i})
+		for _, h := range hits[i:j] { out = append(out, searchHitItem{h: h}) }
+		i = j
+	}
+	return out
+}
+
+// renderSearchContext shows the selected match with its context lines
+func renderSearchContext(h searchHit) string {
+	var b strings.Builder
+	for i, l := range h.before { fmt.Fprintf(&b, "  %5d  %s\n", h.line-len(h.before)+i, l) }
+	fmt.Fprintf(&b, "> %5d  %s\n", h.line, h.text)
+	for i, l := range h.after { fmt.Fprintf(&b, "  %5d  %s\n", h.line+1+i, l) }
+	return b.String()
+}
+
+// searchView is the Search tab: pattern input, grouped results and the context of
+// the selected match
+func (m model) searchView() string {
+	v := m.searchInput.View() + "\n" + m.searchList.View()
+	if sel, ok := m.searchList.SelectedItem().(searchHitItem); ok { v += "\n" + helpStyle.Render(renderSearchContext(sel.h)) }
+	return v
+}
+
+// openSearchHit opens the selected match in the preview, scrolled to the line, or in
+// the embedded editor with the cursor on it
+func (m *model) openSearchHit(inEditor bool) tea.Cmd {
+	var h searchHit
+	switch sel := m.searchList.SelectedItem().(type) {
+	case searchHitItem:
+		h = sel.h
+	case searchFileItem:
+		h = searchHit{path: filepath.Join(m.searchDir, sel.rel), line: 1, col: 1}
+	default:
+		return nil
+	}
+	if inEditor { return m.openInEditor(h.path, h.line, h.col) }
+	b, err := ioutil.ReadFile(h.path)
+	if err != nil { m.status = T("open failed: %v", err); slog.Warn("open failed", "err", err); return nil }
+	m.setContent(string(b))
+	m.vp.SetYOffset(h.line - 1 - searchContext)
+	m.active = m.tabIndex("Preview")
+	m.status = fmt.Sprintf("%s:%d", h.path, h.line)
+	return nil
+}
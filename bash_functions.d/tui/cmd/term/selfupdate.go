@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// set at build time with -ldflags "-X main.updateRepo=... -X main.updatePublicKey=..."
+var (
+	updateRepo      = "cbwinslow/bash.d"
+	updatePublicKey = "" // base64 ed25519 key that signs checksums.txt
+)
+
+// releases publish a term_<os>_<arch> binary per platform, checksums.txt with
+// "sha256  file" lines and checksums.txt.sig, the base64 ed25519 signature of it
+type ghRelease struct {
+	TagName string `json:"tag_name"`
+	Assets  []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+var updateClient = &http.Client{Timeout: 2 * time.Minute}
+
+// runSelfUpdate implements `term self-update`
+func runSelfUpdate(args []string) int {
+	fs := flag.NewFlagSet("self-update", flag.ExitOnError)
+	check := fs.Bool("check", false, "only report whether a newer release exists")
+	repo := fs.String("repo", updateRepo, "GitHub repository to fetch releases from")
+	noSig := fs.Bool("no-verify-signature", false, "accept a release without a valid signature (checksums are still verified)")
+	fs.Parse(args)
+
+	rel, err := latestRelease(*repo)
+	if err != nil { fmt.Fprintln(os.Stderr, "self-update:", err); return 1 }
+	if compareVersions(rel.TagName, version) <= 0 && version != "dev" {
+		fmt.Println(T("term %s is up to date", version))
+		return 0
+	}
+	if *check { fmt.Println(T("term %s is available (installed: %s)", rel.TagName, version)); return 0 }
+
+	asset := fmt.Sprintf("term_%s_%s", runtime.GOOS, runtime.GOARCH)
+	bin, err := releaseAsset(rel, asset)
+	if err != nil { fmt.Fprintln(os.Stderr, "self-update:", err); return 1 }
+	sums, err := releaseAsset(rel, "checksums.txt")
+	if err != nil { fmt.Fprintln(os.Stderr, "self-update:", err); return 1 }
+	if err := verifySignature(rel, sums); err != nil {
+		if !*noSig { fmt.Fprintln(os.Stderr, "self-update:", err); return 1 }
+		fmt.Fprintln(os.Stderr, "self-update: warning:", err)
+	}
+	if err := verifyChecksum(sums, asset, bin); err != nil { fmt.Fprintln(os.Stderr, "self-update:", err); return 1 }
+	path, err := replaceExecutable(bin)
+	if err != nil { fmt.Fprintln(os.Stderr, "self-update:", err); return 1 }
+	fmt.Println(T("updated %s from %s to %s", path, version, rel.TagName))
+	return 0
+}
+
+func latestRelease(repo string) (ghRelease, error) {
+	var rel ghRelease
+	b, err := httpGet("https://api.github.com/repos/" + repo + "/releases/latest")
+	if err != nil { return rel, err }
+	if err := json.Unmarshal(b, &rel); err != nil { return rel, err }
+	if rel.TagName == "" { return rel, errors.New("no release found") }
+	return rel, nil
+}
+
+func releaseAsset(rel ghRelease, name string) ([]byte, error) {
+	for _, a := range rel.Assets {
+		if a.Name == name { return httpGet(a.URL) }
+	}
+	return nil, fmt.Errorf("release %s has no %s", rel.TagName, name)
+}
+
+func httpGet(url string) ([]byte, error) {
+	resp, err := updateClient.Get(url)
+	if err != nil { return nil, err }
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK { return nil, fmt.Errorf("%s: %s", url, resp.Status) }
+	return ioutil.ReadAll(io.LimitReader(resp.Body, 256<<20))
+}
+
+// verifySignature checks checksums.txt against the public key built into the binary
+func verifySignature(rel ghRelease, sums []byte) error {
+	if updatePublicKey == "" { return errors.New("this build has no release signing key; cannot verify the signature") }
+	key, err := base64.StdEncoding.DecodeString(updatePublicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize { return errors.New("invalid built-in release signing key") }
+	sigB64, err := releaseAsset(rel, "checksums.txt.sig")
+	if err != nil { return err }
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sigB64)))
+	if err != nil { return fmt.Errorf("checksums.txt.sig: %v", err) }
+	if !ed25519.Verify(ed25519.PublicKey(key), sums, sig) { return errors.New("checksums.txt signature does not match") }
+	return nil
+}
+
+// verifyChecksum finds name in checksums.txt and compares its sha256 with data
+func verifyChecksum(sums []byte, name string, data []byte) error {
+	sc := bufio.NewScanner(bytes.NewReader(sums))
+	for sc.Scan() {
+		f := strings.Fields(sc.Text())
+		if len(f) != 2 || strings.TrimPrefix(f[1], "*") != name { continue }
+		sum := sha256.Sum256(data)
+		if !strings.EqualFold(f[0], hex.EncodeToString(sum[:])) { return fmt.Errorf("%s: checksum mismatch", name) }
+		return nil
+	}
+	return fmt.Errorf("checksums.txt has no entry for %s", name)
+}
+
+// replaceExecutable writes data next to the running binary and renames it over the
+// binary, so a failure never leaves a half-written executable behind
+func replaceExecutable(data []byte) (string, error) {
+	exe, err := os.Executable()
+	if err != nil { return "", err }
+	if p, err := filepath.EvalSymlinks(exe); err == nil { exe = p }
+	mode := os.FileMode(0o755)
+	if fi, err := os.Stat(exe); err == nil { mode = fi.Mode().Perm() }
+	tmp, err := ioutil.TempFile(filepath.Dir(exe), ".term-update-*")
+	if err != nil { return "", err }
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil { tmp.Close(); return "", err }
+	if err := tmp.Close(); err != nil { return "", err }
+	if err := os.Chmod(tmp.Name(), mode); err != nil { return "", err }
+	return exe, os.Rename(tmp.Name(), exe)
+}
+
+// compareVersions compares dotted versions such as v1.10.2 numerically; a
+// pre-release suffix ("-rc1") sorts before the release
+func compareVersions(a, b string) int {
+	split := func(v string) ([]int, string) {
+		v = strings.TrimPrefix(v, "v")
+		pre := ""
+		if i := strings.IndexByte(v, '-'); i >= 0 { v, pre = v[:i], v[i:] }
+		var n []int
+		for _, p := range strings.Split(v, ".") { x, _ := strconv.Atoi(p); n = append(n, x) }
+		return n, pre
+	}
+	an, ap := split(a)
+	bn, bp := split(b)
+	for i := 0; i < len(an) || i < len(bn); i++ {
+		var x, y int
+		if i < len(an) { x = an[i] }
+		if i < len(bn) { y = bn[i] }
+		if x != y { if x < y { return -1 }; return 1 }
+	}
+	switch {
+	case ap == bp:
+		return 0
+	case ap == "":
+		return 1
+	case bp == "":
+		return -1
+	case ap < bp:
+		return -1
+	}
+	return 1
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// session is one running TUI, recorded so the dashboard can show who is connected
+type session struct {
+	PID     int    `json:"pid"`
+	User    string `json:"user"`
+	Remote  string `json:"remote,omitempty"` // client address for SSH sessions
+	Started string `json:"started"`
+}
+
+func sessionsDir() string { return filepath.Join(tuiDataDir(), "sessions") }
+
+// registerSession records this process as a session and returns a function that
+// removes the record again
+func registerSession() func() {
+	if err := os.MkdirAll(sessionsDir(), 0o700); err != nil { return func() {} }
+	remote := os.Getenv("SSH_CLIENT")
+	if remote == "" { remote = os.Getenv("SSH_CONNECTION") }
+	if f := strings.Fields(remote); len(f) > 0 { remote = f[0] }
+	now := time.Now()
+	s := session{PID: os.Getpid(), User: transferUser(), Remote: remote, Started: now.Format(time.RFC3339)}
+	path := filepath.Join(sessionsDir(), fmt.Sprintf("%d-%d.json", s.PID, now.UnixNano()))
+	b, _ := json.Marshal(s)
+	if err := ioutil.WriteFile(path, b, 0o600); err != nil { return func() {} }
+	emitEvent(busEvent{Kind: BusSessionStarted, User: s.User, Remote: s.Remote, PID: s.PID})
+	return func() {
+		os.Remove(path)
+		emitEvent(busEvent{Kind: BusSessionEnded, User: s.User, Remote: s.Remote, PID: s.PID})
+	}
+}
+
+// liveSessions lists recorded sessions whose process is still running, oldest first,
+// and drops records left behind by sessions that died
+func liveSessions() []session {
+	var out []session
+	files, _ := ioutil.ReadDir(sessionsDir())
+	for _, fi := range files {
+		path := filepath.Join(sessionsDir(), fi.Name())
+		var s session
+		b, err := ioutil.ReadFile(path)
+		if err != nil || json.Unmarshal(b, &s) != nil { continue }
+		if !processAlive(s.PID) { os.Remove(path); continue }
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Started < out[j].Started })
+	return out
+}
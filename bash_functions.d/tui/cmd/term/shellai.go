@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// shellSuggestSystem tells the model how to answer a ? line of the Shell tab
+const shellSuggestSystem = `Translate the user's request into a single POSIX sh command line for Linux.
+Reply with the command in a fenced sh block, then a short paragraph explaining what it does, naming anything it changes, deletes or sends over the network.
+Prefer read-only commands; never add sudo unless asked.`
+
+// shellSuggestMsg carries the model's command for a ? line
+type shellSuggestMsg struct {
+	question, command, explanation string
+	err                            error
+}
+
+// suggestShell asks the model for a command doing what question describes
+func suggestShell(cfg llmConfig, question string) tea.Cmd {
+	return func() tea.Msg {
+		out, err := askLLM(context.Background(), cfg, shellSuggestSystem, question)
+		if err != nil { return shellSuggestMsg{question: question, err: err} }
+		blocks := fencedBlocks(out)
+		if len(blocks) == 0 || strings.TrimSpace(blocks[0].body) == "" { return shellSuggestMsg{question: question, err: errors.New(T("the model did not answer with a command"))} }
+		// the explanation is whatever the answer says outside its code blocks
+		var expl []string
+		inBlock := false
+		for _, l := range strings.Split(out, "\n") {
+			if strings.HasPrefix(strings.TrimSpace(l), "```") { inBlock = !inBlock; continue }
+			if !inBlock { expl = append(expl, l) }
+		}
+		return shellSuggestMsg{question: question, command: strings.TrimSpace(blocks[0].body), explanation: strings.TrimSpace(strings.Join(expl, "\n"))}
+	}
+}
+
+// askShell sends a ? line of the Shell tab to the model
+func (m *model) askShell(question string) tea.Cmd {
+	if question == "" || m.denyReadOnly() { return nil }
+	m.ti.SetValue("")
+	m.status = T("asking for a command: %s", question)
+	return suggestShell(m.cfg.LLM, question)
+}
+
+// showSuggestion shows the suggested command with its explanation and asks before
+// running it; declining leaves it in the prompt to edit
+func (m *model) showSuggestion(msg shellSuggestMsg) {
+	if msg.err != nil { m.status = T("no suggestion: %v", msg.err); slog.Warn("shell suggestion failed", "err", msg.err); return }
+	appendAudit(m.auditPath, fmt.Sprintf("%s\tshell_suggest=%q\tcommand=%q\tuser=%s", time.Now().Format(time.RFC3339), msg.question, msg.command, transferUser()))
+	m.active = m.tabIndex("Shell")
+	m.setContent(fmt.Sprintf("? %s\n\n    %s\n\n%s", msg.question, strings.ReplaceAll(msg.command, "\n", "\n    "), msg.explanation))
+	m.ti.SetValue(msg.command)
+	m.ti.CursorEnd()
+	m.askDetail(T("run the suggested command?"), T("No keeps it in the prompt to edit."), func(m *model) tea.Cmd {
+		if !m.shellQuotaLeft() { return nil }
+		m.ti.SetValue("")
+		code := m.runShell(msg.command)
+		appendAudit(m.auditPath, fmt.Sprintf("%s\tshell=%q\tsource=llm\texit=%d\tuser=%s", time.Now().Format(time.RFC3339), msg.command, code, transferUser()))
+		m.warnShellQuota()
+		return nil
+	})
+}
+
+// runShell runs a Shell tab command with sh, sourcing SSH_PLUGIN_ENV first when set,
+// shows its output and returns its exit code
+func (m *model) runShell(cmdStr string) int {
+	m.status = T("running: %s", cmdStr)
+	pluginEnv := os.Getenv("SSH_PLUGIN_ENV")
+	var shellCmd *exec.Cmd
+	if pluginEnv != "" {
+		shellCmd = exec.Command("/bin/sh", "-c", fmt.Sprintf("[ -f '%s' ] && . '%s'; %s", pluginEnv, pluginEnv, cmdStr))
+	} else {
+		shellCmd = exec.Command("/bin/sh", "-c", cmdStr)
+	}
+	out, err := shellCmd.CombinedOutput()
+	text := string(out)
+	if err != nil { text = fmt.Sprintf("(error: %v)\n%s", err, text) }
+	m.setContent(text)
+	m.lastOutput = string(out)
+	return exitCodeOf(err)
+}
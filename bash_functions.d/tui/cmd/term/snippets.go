@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// snippet is a named piece of text inserted into the editor or Shell input. Bodies
+// may use the template placeholders {{.File}}, {{.Cwd}}, {{.Author}} and {{.Date}}.
+type snippet struct {
+	name string
+	body string
+	user bool
+}
+
+func (s snippet) Title() string { return s.name }
+func (s snippet) Description() string {
+	first := strings.SplitN(strings.TrimSpace(s.body), "\n", 2)[0]
+	if s.user { return T("user snippet") + ": " + first }
+	return first
+}
+func (s snippet) FilterValue() string { return s.name + " " + s.body }
+
+var builtinSnippets = []snippet{
+	{name: "strict-mode", body: "set -euo pipefail\nIFS=$'\\n\\t'\n"},
+	{name: "script-dir", body: "SCRIPT_DIR=\"$(cd -- \"$(dirname -- \"${BASH_SOURCE[0]}\")\" && pwd -P)\"\n"},
+	{name: "require-cmd", body: "command -v jq >/dev/null 2>&1 || { echo \"jq is required\" >&2; exit 1; }\n"},
+	{name: "arg-loop", body: "while [[ $# -gt 0 ]]; do\n  case \"$1\" in\n    -h|--help) usage; exit 0;;\n    --) shift; break;;\n    *) echo \"unknown option: $1\" >&2; exit 2;;\n  esac\ndone\n"},
+	{name: "trap-cleanup", body: "tmp=\"$(mktemp -d)\"\ncleanup() { rm -rf \"$tmp\"; }\ntrap cleanup EXIT\n"},
+	{name: "log-fn", body: "log() { echo \"[$(date '+%Y-%m-%d %H:%M:%S')] $*\" >&2; }\n"},
+}
+
+// snippetsDir is the per-user snippet store; each file is a snippet named after its
+// base name without extension
+func snippetsDir() string { return filepath.Join(tuiDataDir(), "snippets") }
+
+// loadSnippets returns the user's snippets followed by the built-ins they do not replace
+func loadSnippets() []snippet {
+	var out []snippet
+	seen := map[string]bool{}
+	files, _ := ioutil.ReadDir(snippetsDir())
+	sort.Slice(files, func(i, j int) bool { return files[i].Name() < files[j].Name() })
+	for _, fi := range files {
+		if fi.IsDir() { continue }
+		b, err := ioutil.ReadFile(filepath.Join(snippetsDir(), fi.Name()))
+		if err != nil { continue }
+		name := strings.TrimSuffix(fi.Name(), filepath.Ext(fi.Name()))
+		out = append(out, snippet{name: name, body: string(b), user: true})
+		seen[name] = true
+	}
+	for _, s := range builtinSnippets {
+		if !seen[s.name] { out = append(out, s) }
+	}
+	return out
+}
+
+// snippetPicker is the overlay opened with alt+p from the Editor or Shell tab;
+// target is the tab the chosen snippet goes to
+type snippetPicker struct {
+	list   list.Model
+	target string
+}
+
+func (m *model) openSnippetPicker() {
+	items := []list.Item{}
+	for _, s := range loadSnippets() { items = append(items, s) }
+	l := list.New(items, list.NewDefaultDelegate(), 60, m.height-10)
+	l.Title = T("Snippets")
+	l.SetShowHelp(false)
+	if m.plain { l.SetDelegate(plainDelegate{}); l.Styles.Title = lipgloss.NewStyle() }
+	m.snippets = &snippetPicker{list: l, target: m.tabs[m.active]}
+}
+
+// updateSnippetPicker handles keys while the picker is open; / filters, enter inserts
+func (m *model) updateSnippetPicker(msg tea.KeyMsg) tea.Cmd {
+	p := m.snippets
+	filtering := p.list.SettingFilter()
+	switch {
+	case msg.String() == "esc" && !filtering && !p.list.IsFiltered():
+		m.snippets = nil
+		return nil
+	case msg.String() == "enter" && !filtering:
+		s, ok := p.list.SelectedItem().(snippet)
+		if !ok { return nil }
+		m.snippets = nil
+		m.insertSnippet(s, p.target)
+		return nil
+	}
+	var cmd tea.Cmd
+	p.list, cmd = p.list.Update(msg)
+	return cmd
+}
+
+// insertSnippet expands s and inserts it at the editor cursor, or appends it to the
+// Shell input joined into a single command line
+func (m *model) insertSnippet(s snippet, target string) {
+	body, err := renderSnippet(s, m.editorFile, m.cwd, m.cfg.Author)
+	if err != nil { m.status = T("snippet %s: %v", s.name, err); return }
+	if target == "Shell" {
+		m.ti.SetValue(m.ti.Value() + joinShellLines(body))
+		m.ti.CursorEnd()
+	} else {
+		m.ta.InsertString(body)
+	}
+	m.status = T("inserted snippet %s", s.name)
+}
+
+// joinShellLines folds a multi-line snippet into one command line. Lines are joined
+// with "; " except after tokens that must not be followed by a semicolon.
+func joinShellLines(body string) string {
+	var b strings.Builder
+	for i, l := range strings.Split(strings.TrimRight(body, "\n"), "\n") {
+		l = strings.TrimSpace(l)
+		if l == "" { continue }
+		if i > 0 && b.Len() > 0 {
+			prev := b.String()
+			sep := "; "
+			for _, t := range []string{" do", " then", " else", "{", "|", "&&", "||", " in", ";;", ";", "&"} {
+				if strings.HasSuffix(prev, t) { sep = " "; break }
+			}
+			b.WriteString(sep)
+		}
+		b.WriteString(l)
+	}
+	return b.String()
+}
+
+// renderSnippet fills in the placeholders of s
+func renderSnippet(s snippet, file, cwd, author string) (string, error) {
+	if !strings.Contains(s.body, "{{") { return s.body, nil }
+	tpl, err := template.New(s.name).Parse(s.body)
+	if err != nil { return "", err }
+	var b bytes.Buffer
+	err = tpl.Execute(&b, struct{ File, Cwd, Author, Date string }{file, cwd, author, time.Now().Format("2006-01-02")})
+	return b.String(), err
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// auditEntry is one parsed audit line: an RFC3339 time followed by tab-separated
+// key=value fields
+type auditEntry struct {
+	time   time.Time
+	fields map[string]string
+}
+
+// parseAuditLine splits one audit line. approve_request.sh writes literal "\t"
+// separators, which are accepted as well.
+func parseAuditLine(line string) (auditEntry, bool) {
+	parts := strings.Split(strings.ReplaceAll(line, `\t`, "\t"), "\t")
+	t, err := time.Parse(time.RFC3339, strings.TrimSpace(parts[0]))
+	if err != nil { return auditEntry{}, false }
+	e := auditEntry{time: t, fields: map[string]string{}}
+	for _, p := range parts[1:] {
+		if i := strings.IndexByte(p, '='); i > 0 { e.fields[p[:i]] = p[i+1:] }
+	}
+	return e, true
+}
+
+type agentStats struct {
+	Agent       string  `json:"agent"`
+	Runs        int     `json:"runs"`
+	Failures    int     `json:"failures"`
+	FailureRate float64 `json:"failure_rate"`
+	AvgSeconds  float64 `json:"avg_seconds,omitempty"` // over runs that recorded a duration
+	timed       int
+	total       time.Duration
+}
+
+type countStat struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// auditStats aggregates agent runs from the audit log
+type auditStats struct {
+	Generated string       `json:"generated"`
+	Runs      int          `json:"runs"`
+	Failures  int          `json:"failures"`
+	Agents    []agentStats `json:"agents"`
+	Users     []countStat  `json:"top_users"`
+	Days      []countStat  `json:"runs_per_day"` // the last statsDays days, oldest first
+}
+
+const statsDays = 14
+
+// computeStats counts every audit line that records a run (it has an exit code);
+// approvals and denials without a run are skipped
+func computeStats(log string, now time.Time) auditStats {
+	st := auditStats{Generated: now.Format(time.RFC3339)}
+	agents := map[string]*agentStats{}
+	users := map[string]int{}
+	days := map[string]int{}
+	for _, line := range strings.Split(log, "\n") {
+		e, ok := parseAuditLine(line)
+		if !ok { continue }
+		code, err := strconv.Atoi(e.fields["exit"])
+		if err != nil || e.fields["agent"] == "" { continue }
+		a := agents[e.fields["agent"]]
+		if a == nil { a = &agentStats{Agent: e.fields["agent"]}; agents[a.Agent] = a }
+		a.Runs++
+		st.Runs++
+		if code != 0 || (e.fields["error"] != "" && e.fields["error"] != "<nil>") { a.Failures++; st.Failures++ }
+		if d, err := time.ParseDuration(e.fields["duration"]); err == nil { a.timed++; a.total += d }
+		user := e.fields["user"]
+		if user == "" { user = e.fields["requester"] }
+		if user == "" && e.fields["source"] == "scheduler" { user = "scheduler" }
+		if user != "" { users[user]++ }
+		days[e.time.Local().Format("2006-01-02")]++
+	}
+	for _, a := range agents {
+		a.FailureRate = float64(a.Failures) / float64(a.Runs)
+		if a.timed > 0 { a.AvgSeconds = (a.total / time.Duration(a.timed)).Seconds() }
+		st.Agents = append(st.Agents, *a)
+	}
+	sort.Slice(st.Agents, func(i, j int) bool {
+		if st.Agents[i].Runs != st.Agents[j].Runs { return st.Agents[i].Runs > st.Agents[j].Runs }
+		return st.Agents[i].Agent < st.Agents[j].Agent
+	})
+	for u, n := range users { st.Users = append(st.Users, countStat{u, n}) }
+	sort.Slice(st.Users, func(i, j int) bool {
+		if st.Users[i].Count != st.Users[j].Count { return st.Users[i].Count > st.Users[j].Count }
+		return st.Users[i].Name < st.Users[j].Name
+	})
+	if len(st.Users) > 10 { st.Users = st.Users[:10] }
+	for i := statsDays - 1; i >= 0; i-- {
+		d := now.AddDate(0, 0, -i).Local().Format("2006-01-02")
+		st.Days = append(st.Days, countStat{d, days[d]})
+	}
+	return st
+}
+
+// bar draws n relative to max as a bar of at most width cells
+func bar(n, max, width int, plain bool) string {
+	if max <= 0 || width <= 0 { return "" }
+	cells := n * width / max
+	if cells == 0 && n > 0 { cells = 1 }
+	ch := "█"
+	if plain { ch = "#" }
+	return strings.Repeat(ch, cells)
+}
+
+// renderStats draws the Stats tab as bar charts fitting width
+func renderStats(st auditStats, width int, plain bool) string {
+	var b strings.Builder
+	if st.Runs == 0 { return T("No agent runs in the audit log yet.") + "\n" }
+	fmt.Fprintf(&b, "%s\n\n", T("%d runs, %d failed (%.0f%%)", st.Runs, st.Failures, 100*float64(st.Failures)/float64(st.Runs)))
+
+	barW := width - 55
+	if barW < 10 { barW = 10 }
+	max := 0
+	for _, a := range st.Agents { if a.Runs > max { max = a.Runs } }
+	b.WriteString(T("Runs per agent") + "\n")
+	fmt.Fprintf(&b, "  %-24s %5s %6s %7s\n", T("agent"), T("runs"), T("failed"), T("avg"))
+	for _, a := range st.Agents {
+		avg := "-"
+		if a.AvgSeconds > 0 { avg = time.Duration(a.AvgSeconds * float64(time.Second)).Round(time.Second).String() }
+		fmt.Fprintf(&b, "  %-24s %5d %5.0f%% %7s  %s\n", trimTo(a.Agent, 24), a.Runs, 100*a.FailureRate, avg, bar(a.Runs, max, barW, plain))
+	}
+
+	max = 0
+	for _, u := range st.Users { if u.Count > max { max = u.Count } }
+	if len(st.Users) > 0 {
+		b.WriteString("\n" + T("Top users") + "\n")
+		for _, u := range st.Users { fmt.Fprintf(&b, "  %-24s %5d  %s\n", trimTo(u.Name, 24), u.Count, bar(u.Count, max, barW, plain)) }
+	}
+
+	max = 0
+	for _, d := range st.Days { if d.Count > max { max = d.Count } }
+	b.WriteString("\n" + T("Runs per day (last %d days)", statsDays) + "\n")
+	for _, d := range st.Days { fmt.Fprintf(&b, "  %-10s %5d  %s\n", d.Name, d.Count, bar(d.Count, max, barW, plain)) }
+	return b.String()
+}
+
+func trimTo(s string, n int) string {
+	if r := []rune(s); len(r) > n { return string(r[:n-1]) + "…" }
+	return s
+}
+
+// refreshAudit rereads the audit log and recomputes the statistics for the Stats tab
+func (m *model) refreshAudit() {
+	if text, err := readAudit(m.auditPath); err == nil { m.auditContent = text }
+	if m.follow != nil { m.follow.offset = int64(len(m.auditContent)) }
+	m.stats = computeStats(m.auditContent, time.Now())
+}
+
+// exportStats writes the current statistics as JSON next to saved outputs
+func (m *model) exportStats() {
+	b, err := json.MarshalIndent(m.stats, "", "  ")
+	if err != nil { m.status = T("export failed: %v", err); slog.Warn("export failed", "err", err); return }
+	path, err := saveOutputAs(m.cfg.OutputDir, "audit-stats", ".json", string(b)+"\n")
+	if err != nil { m.status = T("export failed: %v", err); slog.Warn("export failed", "err", err); return }
+	m.status = T("saved output to %s", path)
+}
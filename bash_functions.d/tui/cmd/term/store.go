@@ -0,0 +1,446 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// RequestStore keeps the approval queue and the history of every request
+type RequestStore interface {
+	Pending() ([]requestItem, error)
+	Add(r requestItem) error
+	// Take removes request id from the queue; of two approvers taking the same
+	// request one gets errRequestNotFound
+	Take(id string) (requestItem, error)
+	Record(ev requestEvent) error
+	History(id string) ([]requestEvent, error)
+	// Find returns up to limit requests matching q, queued ones first and then
+	// decided ones, each newest first, with State set
+	Find(q recordQuery, limit int) ([]requestItem, error)
+	Close() error
+}
+
+// AuditStore keeps the audit log, one tab-separated entry per line, oldest first.
+// Offsets and sizes are in bytes of the log as text.
+type AuditStore interface {
+	Append(line string) error
+	// Since returns the log after offset and the size of the whole log; nothing when
+	// offset is past the end
+	Since(offset int64) (string, int64, error)
+	// Head returns the oldest entry and the size of the log
+	Head() (string, int64, error)
+	// Trim drops the n oldest entries, once compaction has archived them
+	Trim(n int) error
+	// Watched is the file that changes when entries are added, for follow mode
+	Watched() string
+	// Query returns the latest limit entries matching q, newest first
+	Query(q recordQuery, limit int) ([]string, error)
+	Close() error
+}
+
+// storageConfig picks where requests and the audit log are kept. "json", the default,
+// is requests.json, request_history.jsonl and agent_audit.log; "sqlite" and "bolt"
+// keep all three in one database file with transactional writes, for SSH servers
+// where many sessions approve and audit at once.
+type storageConfig struct {
+	Backend string `json:"backend,omitempty"` // json, sqlite or bolt
+	Path    string `json:"path,omitempty"`    // database file; default term.db or term.bolt in the data dir
+}
+
+// storageFile is the database of the configured backend for the data in dir; "" for json
+func storageFile(dir string) (backend, path string, err error) {
+	sc := loadConfig().Storage
+	switch sc.Backend {
+	case "", "json":
+		return "json", "", nil
+	case "sqlite":
+		path = filepath.Join(dir, "term.db")
+	case "bolt":
+		path = filepath.Join(dir, "term.bolt")
+	default:
+		return "", "", fmt.Errorf("unknown storage backend %q (want json, sqlite or bolt)", sc.Backend)
+	}
+	if sc.Path != "" { path = expandHome(sc.Path) }
+	return sc.Backend, path, nil
+}
+
+// the database backends keep requests and audit in one store
+type dbStore interface {
+	RequestStore
+	AuditStore
+}
+
+func openDB(backend, path string) (dbStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil { return nil, err }
+	if backend == "bolt" { return openBolt(path) }
+	return openSQLite(path)
+}
+
+// withRequestStore opens the store holding the requests queued at requestsPath. It is
+// opened for each operation, as the JSON files are read for each one: the TUI,
+// scheduler, broker and CLI are separate processes, and bolt locks its file.
+func withRequestStore(requestsPath string, fn func(RequestStore) error) error {
+	backend, path, err := storageFile(filepath.Dir(requestsPath))
+	if err != nil { return err }
+	if backend == "json" { return fn(scopeRequests(jsonRequestStore{path: requestsPath})) }
+	s, err := openDB(backend, path)
+	if err != nil { return err }
+	defer s.Close()
+	if err := importRequests(s, requestsPath); err != nil { slog.Warn("importing queued requests failed", "path", requestsPath, "err", err) }
+	return fn(scopeRequests(s))
+}
+
+// withAuditStore opens the store of the audit log at auditPath under the audit lock,
+// so appends never land in a log that compaction is trimming
+func withAuditStore(auditPath string, fn func(AuditStore) error) error {
+	backend, path, err := storageFile(filepath.Dir(auditPath))
+	if err != nil { return err }
+	return withLock("audit", func() error {
+		if backend == "json" { return fn(jsonAuditStore{path: auditPath}) }
+		s, err := openDB(backend, path)
+		if err != nil { return err }
+		defer s.Close()
+		if err := importAudit(s, auditPath); err != nil { slog.Warn("importing audit log failed", "path", auditPath, "err", err) }
+		return fn(s)
+	})
+}
+
+// readAudit returns the whole audit log
+func readAudit(auditPath string) (string, error) {
+	var text string
+	err := withAuditStore(auditPath, func(s AuditStore) (err error) {
+		text, _, err = s.Since(0)
+		return err
+	})
+	return text, err
+}
+
+// requestScope is the user whose requests this session may see. SSH sessions of
+// non-admins see only their own; admins and local processes (the data dir's owner,
+// the scheduler, the broker) see every request.
+func requestScope() string {
+	if isAdmin() { return "" }
+	return os.Getenv("SSH_USER")
+}
+
+func scopeRequests(s RequestStore) RequestStore {
+	if u := requestScope(); u != "" { return scopedRequestStore{RequestStore: s, user: u} }
+	return s
+}
+
+// scopedRequestStore limits a store to the requests of one user. Requests of others
+// are reported as not found, so their ids are not confirmed either.
+type scopedRequestStore struct {
+	RequestStore
+	user string
+}
+
+// owner is the requester of id, from the queue or, once decided, the history
+func (s scopedRequestStore) owner(id string) (string, error) {
+	reqs, err := s.RequestStore.Pending()
+	if err != nil { return "", err }
+	for _, r := range reqs { if r.ID == id { return r.User, nil } }
+	evs, err := s.RequestStore.History(id)
+	if err != nil { return "", err }
+	for _, ev := range evs { if ev.Request != nil { return ev.Request.User, nil } }
+	return "", errRequestNotFound
+}
+
+func (s scopedRequestStore) check(id string) error {
+	u, err := s.owner(id)
+	if err != nil { return err }
+	if u != s.user { return errRequestNotFound }
+	return nil
+}
+
+func (s scopedRequestStore) Pending() ([]requestItem, error) {
+	reqs, err := s.RequestStore.Pending()
+	var mine []requestItem
+	for _, r := range reqs { if r.User == s.user { mine = append(mine, r) } }
+	return mine, err
+}
+
+func (s scopedRequestStore) Add(r requestItem) error {
+	if r.User != s.user { return fmt.Errorf("cannot queue a request for %s as %s", r.User, s.user) }
+	return s.RequestStore.Add(r)
+}
+
+func (s scopedRequestStore) Take(id string) (requestItem, error) {
+	if err := s.check(id); err != nil { return requestItem{}, err }
+	return s.RequestStore.Take(id)
+}
+
+func (s scopedRequestStore) Record(ev requestEvent) error {
+	if err := s.check(ev.ID); err != nil { return err }
+	return s.RequestStore.Record(ev)
+}
+
+func (s scopedRequestStore) History(id string) ([]requestEvent, error) {
+	if err := s.check(id); err != nil { return nil, err }
+	return s.RequestStore.History(id)
+}
+
+func (s scopedRequestStore) Find(q recordQuery, limit int) ([]requestItem, error) {
+	q.owner = s.user
+	return s.RequestStore.Find(q, limit)
+}
+
+// importRequests moves requests that scripts queued in requests.json, and the history
+// of a previous JSON setup, into a database store
+func importRequests(s RequestStore, requestsPath string) error {
+	return withLock("requests", func() error {
+		reqs, err := (jsonRequestStore{path: requestsPath}).Pending()
+		if err != nil { return err }
+		for _, r := range reqs {
+			if err := s.Add(r); err != nil { slog.Warn("queued request not imported", "request", r.ID, "err", err) }
+		}
+		if len(reqs) > 0 {
+			if err := ioutil.WriteFile(requestsPath, []byte("[]\n"), 0o600); err != nil { return err }
+		}
+		hist := requestHistoryPath(requestsPath)
+		evs, err := readRequestEvents(hist, "")
+		if err != nil || len(evs) == 0 { return err }
+		for _, ev := range evs {
+			if err := s.Record(ev); err != nil { return err }
+		}
+		return os.Rename(hist, hist+".imported")
+	})
+}
+
+// importAudit moves entries appended to agent_audit.log by scripts into a database
+// store. The caller holds the audit lock.
+func importAudit(s AuditStore, auditPath string) error {
+	b, err := ioutil.ReadFile(auditPath)
+	if os.IsNotExist(err) || err == nil && len(b) == 0 { return nil }
+	if err != nil { return err }
+	for _, l := range strings.Split(strings.TrimRight(string(b), "\n"), "\n") {
+		if err := s.Append(l); err != nil { return err }
+	}
+	// writers that bypass the lock (approve_request.sh) may have appended meanwhile
+	rest := []byte{}
+	if cur, err := ioutil.ReadFile(auditPath); err == nil && len(cur) > len(b) { rest = cur[len(b):] }
+	return ioutil.WriteFile(auditPath, rest, 0o600)
+}
+
+// jsonRequestStore is the queue in requests.json and the history in
+// request_history.jsonl, shared with approve_request.sh through the requests lock
+type jsonRequestStore struct{ path string }
+
+func (s jsonRequestStore) Pending() ([]requestItem, error) {
+	var reqs []requestItem
+	b, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) { return reqs, nil }
+	if err != nil { return nil, err }
+	if err := json.Unmarshal(b, &reqs); err != nil { return nil, fmt.Errorf("%s: %w", s.path, err) }
+	return reqs, nil
+}
+
+func (s jsonRequestStore) Add(r requestItem) error {
+	return withLock("requests", func() error {
+		reqs, err := s.Pending()
+		if err != nil { return err }
+		return s.save(append(reqs, r))
+	})
+}
+
+func (s jsonRequestStore) Take(id string) (requestItem, error) {
+	var taken requestItem
+	err := withLock("requests", func() error {
+		reqs, err := s.Pending()
+		if err != nil { return err }
+		rest := []requestItem{}
+		found := false
+		for _, r := range reqs {
+			if r.ID == id && !found { taken, found = r, true; continue }
+			rest = append(rest, r)
+		}
+		if !found { return errRequestNotFound }
+		return s.save(rest)
+	})
+	return taken, err
+}
+
+func (s jsonRequestStore) save(reqs []requestItem) error {
+	b, err := json.MarshalIndent(reqs, "", "  ")
+	if err != nil { return err }
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0o600); err != nil { return err }
+	return os.Rename(tmp, s.path)
+}
+
+func (s jsonRequestStore) Record(ev requestEvent) error {
+	b, err := json.Marshal(ev)
+	if err != nil { return err }
+	return withLock("requests", func() error {
+		f, err := os.OpenFile(requestHistoryPath(s.path), os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0o600)
+		if err != nil { return err }
+		defer f.Close()
+		_, err = f.Write(append(b, '\n'))
+		return err
+	})
+}
+
+func (s jsonRequestStore) History(id string) ([]requestEvent, error) {
+	return readRequestEvents(requestHistoryPath(s.path), id)
+}
+
+// Find scans the queue and then the history file, keeping the latest decisions
+func (s jsonRequestStore) Find(q recordQuery, limit int) ([]requestItem, error) {
+	var out []requestItem
+	if q.matchState("pending") {
+		reqs, err := s.Pending()
+		if err != nil { return nil, err }
+		for i := len(reqs) - 1; i >= 0 && len(out) < limit; i-- {
+			reqs[i].State = "pending"
+			if q.matchRequest(reqs[i]) { out = append(out, reqs[i]) }
+		}
+	}
+	f, err := os.Open(requestHistoryPath(s.path))
+	if os.IsNotExist(err) { return out, nil }
+	if err != nil { return nil, err }
+	defer f.Close()
+	var decided []requestItem
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 4<<20)
+	for sc.Scan() {
+		var ev requestEvent
+		if json.Unmarshal(sc.Bytes(), &ev) != nil { continue }
+		if r, ok := decidedRequest(ev); ok && q.matchRequest(r) {
+			decided = append(decided, r)
+			if len(decided) > limit-len(out) { decided = decided[1:] }
+		}
+	}
+	for i := len(decided) - 1; i >= 0; i-- { out = append(out, decided[i]) }
+	return out, sc.Err()
+}
+
+func (s jsonRequestStore) Close() error { return nil }
+
+// decidedRequest is the request an approval or denial event records, in its final state
+func decidedRequest(ev requestEvent) (requestItem, bool) {
+	if ev.State != "approved" && ev.State != "denied" || ev.Request == nil { return requestItem{}, false }
+	r := *ev.Request
+	r.State = ev.State
+	return r, true
+}
+
+// readRequestEvents reads the events of request id from a history file; all of them
+// when id is ""
+func readRequestEvents(path, id string) ([]requestEvent, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) { return nil, nil }
+	if err != nil { return nil, err }
+	defer f.Close()
+	var out []requestEvent
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 4<<20)
+	for sc.Scan() {
+		var ev requestEvent
+		if json.Unmarshal(sc.Bytes(), &ev) != nil || id != "" && ev.ID != id { continue }
+		out = append(out, ev)
+	}
+	return out, sc.Err()
+}
+
+// jsonAuditStore is agent_audit.log itself. It does no locking; withAuditStore does.
+type jsonAuditStore struct{ path string }
+
+func (s jsonAuditStore) Append(line string) error {
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0o600)
+	if err != nil { return err }
+	_, err = f.WriteString(trimLine(line) + "\n")
+	if cerr := f.Close(); err == nil { err = cerr }
+	return err
+}
+
+func (s jsonAuditStore) Since(offset int64) (string, int64, error) {
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) { return "", 0, nil }
+	if err != nil { return "", 0, err }
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil { return "", 0, err }
+	if offset >= fi.Size() { return "", fi.Size(), nil }
+	if _, err := f.Seek(offset, 0); err != nil { return "", 0, err }
+	b, err := ioutil.ReadAll(f)
+	return string(b), offset + int64(len(b)), err
+}
+
+func (s jsonAuditStore) Head() (string, int64, error) {
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) { return "", 0, nil }
+	if err != nil { return "", 0, err }
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil { return "", 0, err }
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	for sc.Scan() {
+		if sc.Text() != "" { return sc.Text(), fi.Size(), nil }
+	}
+	return "", fi.Size(), sc.Err()
+}
+
+// Trim rewrites the log without its first n lines, keeping anything appended by
+// writers that bypass the lock
+func (s jsonAuditStore) Trim(n int) error {
+	b, err := ioutil.ReadFile(s.path)
+	if err != nil { return err }
+	text := string(b)
+	for ; n > 0 && text != ""; n-- {
+		i := strings.IndexByte(text, '\n')
+		if i < 0 { text = ""; break }
+		text = text[i+1:]
+	}
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, []byte(text), 0o600); err != nil { return err }
+	return os.Rename(tmp, s.path)
+}
+
+// Query reads the log through once, keeping only the latest matches
+func (s jsonAuditStore) Query(q recordQuery, limit int) ([]string, error) {
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) { return nil, nil }
+	if err != nil { return nil, err }
+	defer f.Close()
+	var hits []string
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	for sc.Scan() {
+		if !q.matchAudit(sc.Text()) { continue }
+		hits = append(hits, sc.Text())
+		if len(hits) > limit { hits = hits[1:] }
+	}
+	for i, j := 0, len(hits)-1; i < j; i, j = i+1, j-1 { hits[i], hits[j] = hits[j], hits[i] }
+	return hits, sc.Err()
+}
+
+func (s jsonAuditStore) Watched() string { return s.path }
+func (s jsonAuditStore) Close() error    { return nil }
+
+func trimLine(l string) string { return strings.TrimRight(l, "\n") }
+
+// auditText joins entries the way they are laid out in agent_audit.log
+func auditText(lines []string) string {
+	if len(lines) == 0 { return "" }
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// sinceText is Since for stores that hold entries rather than text
+func sinceText(lines []string, offset int64) (string, int64) {
+	text := auditText(lines)
+	size := int64(len(text))
+	if offset >= size { return "", size }
+	if offset < 0 { offset = 0 }
+	return text[offset:], size
+}
+
+// dbOpenTimeout bounds the wait for a database another process holds
+const dbOpenTimeout = 10 * time.Second
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// boltStore keeps requests, their history and the audit log in one bbolt file. Each
+// bucket is keyed by a sequence number so entries stay in the order they were added.
+// bolt allows one process at a time; others wait up to dbOpenTimeout to open it.
+type boltStore struct {
+	db   *bolt.DB
+	path string
+}
+
+var (
+	boltRequests = []byte("requests")
+	boltEvents   = []byte("request_events")
+	boltAudit    = []byte("audit")
+)
+
+func openBolt(path string) (*boltStore, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: dbOpenTimeout})
+	if err != nil { return nil, fmt.Errorf("%s: %w", path, err) }
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{boltRequests, boltEvents, boltAudit} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil { return err }
+		}
+		return nil
+	})
+	if err != nil { db.Close(); return nil, err }
+	return &boltStore{db: db, path: path}, nil
+}
+
+// boltPut stores v under the bucket's next sequence number
+func boltPut(b *bolt.Bucket, v []byte) error {
+	seq, err := b.NextSequence()
+	if err != nil { return err }
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return b.Put(key, v)
+}
+
+func (s *boltStore) Pending() ([]requestItem, error) {
+	var reqs []requestItem
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltRequests).ForEach(func(_, v []byte) error {
+			var r requestItem
+			if json.Unmarshal(v, &r) == nil { reqs = append(reqs, r) }
+			return nil
+		})
+	})
+	return reqs, err
+}
+
+func (s *boltStore) Add(r requestItem) error {
+	v, err := json.Marshal(r)
+	if err != nil { return err }
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltRequests)
+		dup := false
+		b.ForEach(func(_, v []byte) error {
+			var q requestItem
+			if json.Unmarshal(v, &q) == nil && q.ID == r.ID { dup = true }
+			return nil
+		})
+		if dup { return fmt.Errorf("request %s is already queued", r.ID) }
+		return boltPut(b, v)
+	})
+}
+
+func (s *boltStore) Take(id string) (requestItem, error) {
+	var taken requestItem
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		c := tx.Bucket(boltRequests).Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			var r requestItem
+			if json.Unmarshal(v, &r) != nil || r.ID != id { continue }
+			taken = r
+			return c.Delete()
+		}
+		return errRequestNotFound
+	})
+	return taken, err
+}
+
+func (s *boltStore) Record(ev requestEvent) error {
+	v, err := json.Marshal(ev)
+	if err != nil { return err }
+	return s.db.Update(func(tx *bolt.Tx) error { return boltPut(tx.Bucket(boltEvents), v) })
+}
+
+func (s *boltStore) History(id string) ([]requestEvent, error) {
+	var out []requestEvent
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltEvents).ForEach(func(_, v []byte) error {
+			var ev requestEvent
+			if json.Unmarshal(v, &ev) == nil && ev.ID == id { out = append(out, ev) }
+			return nil
+		})
+	})
+	return out, err
+}
+
+// Find walks the queue and then the history from their newest keys
+func (s *boltStore) Find(q recordQuery, limit int) ([]requestItem, error) {
+	var out []requestItem
+	err := s.db.View(func(tx *bolt.Tx) error {
+		if q.matchState("pending") {
+			c := tx.Bucket(boltRequests).Cursor()
+			for k, v := c.Last(); k != nil && len(out) < limit; k, v = c.Prev() {
+				r := requestItem{}
+				if json.Unmarshal(v, &r) != nil { continue }
+				r.State = "pending"
+				if q.matchRequest(r) { out = append(out, r) }
+			}
+		}
+		c := tx.Bucket(boltEvents).Cursor()
+		for k, v := c.Last(); k != nil && len(out) < limit; k, v = c.Prev() {
+			var ev requestEvent
+			if json.Unmarshal(v, &ev) != nil { continue }
+			if r, ok := decidedRequest(ev); ok && q.matchRequest(r) { out = append(out, r) }
+		}
+		return nil
+	})
+	return out, err
+}
+
+func (s *boltStore) Append(line string) error {
+	return s.db.Update(func(tx *bolt.Tx) error { return boltPut(tx.Bucket(boltAudit), []byte(trimLine(line))) })
+}
+
+func (s *boltStore) lines() ([]string, error) {
+	var out []string
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltAudit).ForEach(func(_, v []byte) error { out = append(out, string(v)); return nil })
+	})
+	return out, err
+}
+
+func (s *boltStore) Since(offset int64) (string, int64, error) {
+	lines, err := s.lines()
+	if err != nil { return "", 0, err }
+	text, size := sinceText(lines, offset)
+	return text, size, nil
+}
+
+func (s *boltStore) Head() (string, int64, error) {
+	var first string
+	var size int64
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltAudit).ForEach(func(_, v []byte) error {
+			if size == 0 { first = string(v) }
+			size += int64(len(v)) + 1
+			return nil
+		})
+	})
+	return first, size, err
+}
+
+func (s *boltStore) Trim(n int) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltAudit)
+		// deleting while the cursor moves can skip keys, so collect them first
+		var keys [][]byte
+		c := b.Cursor()
+		for k, _ := c.First(); k != nil && len(keys) < n; k, _ = c.Next() { keys = append(keys, append([]byte(nil), k...)) }
+		for _, k := range keys {
+			if err := b.Delete(k); err != nil { return err }
+		}
+		return nil
+	})
+}
+
+func (s *boltStore) Query(q recordQuery, limit int) ([]string, error) {
+	var out []string
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(boltAudit).Cursor()
+		for k, v := c.Last(); k != nil && len(out) < limit; k, v = c.Prev() {
+			if q.matchAudit(string(v)) { out = append(out, string(v)) }
+		}
+		return nil
+	})
+	return out, err
+}
+
+func (s *boltStore) Watched() string { return s.path }
+func (s *boltStore) Close() error    { return s.db.Close() }
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteStore keeps requests, their history and the audit log in one SQLite database.
+// WAL mode lets sessions read while another writes; writers wait for each other.
+type sqliteStore struct {
+	db   *sql.DB
+	path string
+}
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS requests (id TEXT PRIMARY KEY, agent TEXT NOT NULL, user TEXT NOT NULL, time TEXT NOT NULL, notes TEXT NOT NULL DEFAULT '');
+CREATE TABLE IF NOT EXISTS request_events (seq INTEGER PRIMARY KEY AUTOINCREMENT, id TEXT NOT NULL, event TEXT NOT NULL);
+CREATE INDEX IF NOT EXISTS request_events_id ON request_events (id);
+CREATE INDEX IF NOT EXISTS request_events_state ON request_events (json_extract(event, '$.state'));
+CREATE TABLE IF NOT EXISTS audit (seq INTEGER PRIMARY KEY AUTOINCREMENT, line TEXT NOT NULL);
+`
+
+func openSQLite(path string) (*sqliteStore, error) {
+	dsn := (&url.URL{Scheme: "file", Path: path, RawQuery: fmt.Sprintf("_pragma=busy_timeout(%d)&_pragma=journal_mode(WAL)", dbOpenTimeout.Milliseconds())}).String()
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil { return nil, err }
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(sqliteSchema); err != nil { db.Close(); return nil, fmt.Errorf("%s: %w", path, err) }
+	return &sqliteStore{db: db, path: path}, nil
+}
+
+func (s *sqliteStore) Pending() ([]requestItem, error) {
+	rows, err := s.db.Query(`SELECT id, agent, user, time, notes FROM requests ORDER BY rowid`)
+	if err != nil { return nil, err }
+	defer rows.Close()
+	var reqs []requestItem
+	for rows.Next() {
+		var r requestItem
+		if err := rows.Scan(&r.ID, &r.Agent, &r.User, &r.Time, &r.Notes); err != nil { return nil, err }
+		reqs = append(reqs, r)
+	}
+	return reqs, rows.Err()
+}
+
+func (s *sqliteStore) Add(r requestItem) error {
+	res, err := s.db.Exec(`INSERT INTO requests (id, agent, user, time, notes) VALUES (?, ?, ?, ?, ?) ON CONFLICT (id) DO NOTHING`, r.ID, r.Agent, r.User, r.Time, r.Notes)
+	if err != nil { return err }
+	if n, _ := res.RowsAffected(); n == 0 { return fmt.Errorf("request %s is already queued", r.ID) }
+	return nil
+}
+
+func (s *sqliteStore) Take(id string) (requestItem, error) {
+	r := requestItem{ID: id}
+	err := s.db.QueryRow(`DELETE FROM requests WHERE id = ? RETURNING agent, user, time, notes`, id).Scan(&r.Agent, &r.User, &r.Time, &r.Notes)
+	if err == sql.ErrNoRows { return requestItem{}, errRequestNotFound }
+	return r, err
+}
+
+func (s *sqliteStore) Record(ev requestEvent) error {
+	b, err := json.Marshal(ev)
+	if err != nil { return err }
+	_, err = s.db.Exec(`INSERT INTO request_events (id, event) VALUES (?, ?)`, ev.ID, string(b))
+	return err
+}
+
+func (s *sqliteStore) History(id string) ([]requestEvent, error) {
+	rows, err := s.db.Query(`SELECT event FROM request_events WHERE id = ? ORDER BY seq`, id)
+	if err != nil { return nil, err }
+	defer rows.Close()
+	var out []requestEvent
+	for rows.Next() {
+		var raw string
+		var ev requestEvent
+		if err := rows.Scan(&raw); err != nil { return nil, err }
+		if json.Unmarshal([]byte(raw), &ev) == nil { out = append(out, ev) }
+	}
+	return out, rows.Err()
+}
+
+// Find narrows both tables in SQL; q has the last word on what matches
+func (s *sqliteStore) Find(q recordQuery, limit int) ([]requestItem, error) {
+	var out []requestItem
+	if q.matchState("pending") {
+		where, args := likeClauses(map[string]string{"agent": q.agent, "user": q.user}, q.words, "id || ' ' || agent || ' ' || user || ' ' || notes")
+		if q.owner != "" { where, args = append(where, "user = ?"), append(args, q.owner) }
+		rows, err := s.db.Query(`SELECT id, agent, user, time, notes FROM requests`+sqlWhere(where)+` ORDER BY rowid DESC`, args...)
+		if err != nil { return nil, err }
+		for rows.Next() && len(out) < limit {
+			r := requestItem{State: "pending"}
+			if err := rows.Scan(&r.ID, &r.Agent, &r.User, &r.Time, &r.Notes); err != nil { rows.Close(); return nil, err }
+			if q.matchRequest(r) { out = append(out, r) }
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil { return nil, err }
+	}
+	where, args := likeClauses(map[string]string{"json_extract(event, '$.request.agent')": q.agent, "json_extract(event, '$.request.user')": q.user, "json_extract(event, '$.state')": q.status}, q.words, "event")
+	where = append(where, "json_extract(event, '$.state') IN ('approved', 'denied')")
+	if q.owner != "" { where, args = append(where, "json_extract(event, '$.request.user') = ?"), append(args, q.owner) }
+	rows, err := s.db.Query(`SELECT event FROM request_events`+sqlWhere(where)+` ORDER BY seq DESC`, args...)
+	if err != nil { return nil, err }
+	defer rows.Close()
+	for rows.Next() && len(out) < limit {
+		var raw string
+		var ev requestEvent
+		if err := rows.Scan(&raw); err != nil { return nil, err }
+		if json.Unmarshal([]byte(raw), &ev) != nil { continue }
+		if r, ok := decidedRequest(ev); ok && q.matchRequest(r) { out = append(out, r) }
+	}
+	return out, rows.Err()
+}
+
+func (s *sqliteStore) Append(line string) error {
+	_, err := s.db.Exec(`INSERT INTO audit (line) VALUES (?)`, trimLine(line))
+	return err
+}
+
+func (s *sqliteStore) lines() ([]string, error) {
+	rows, err := s.db.Query(`SELECT line FROM audit ORDER BY seq`)
+	if err != nil { return nil, err }
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var l string
+		if err := rows.Scan(&l); err != nil { return nil, err }
+		out = append(out, l)
+	}
+	return out, rows.Err()
+}
+
+func (s *sqliteStore) Since(offset int64) (string, int64, error) {
+	lines, err := s.lines()
+	if err != nil { return "", 0, err }
+	text, size := sinceText(lines, offset)
+	return text, size, nil
+}
+
+func (s *sqliteStore) Head() (string, int64, error) {
+	var first sql.NullString
+	var size int64
+	err := s.db.QueryRow(`SELECT (SELECT line FROM audit ORDER BY seq LIMIT 1), COALESCE(SUM(LENGTH(CAST(line AS BLOB)) + 1), 0) FROM audit`).Scan(&first, &size)
+	return first.String, size, err
+}
+
+func (s *sqliteStore) Trim(n int) error {
+	_, err := s.db.Exec(`DELETE FROM audit WHERE seq IN (SELECT seq FROM audit ORDER BY seq LIMIT ?)`, n)
+	return err
+}
+
+// Query walks the log from the newest entry through what the LIKE clauses let by
+func (s *sqliteStore) Query(q recordQuery, limit int) ([]string, error) {
+	where, args := likeClauses(nil, q.words, "line")
+	for k, v := range map[string]string{"agent": q.agent, "user": q.user} {
+		if v != "" { where, args = append(where, `line LIKE ? ESCAPE '\'`), append(args, "%\t"+k+"="+likeEscape(v)+"%") }
+	}
+	if q.status != "" && strings.HasPrefix("denied", strings.ToLower(q.status)) { where, args = append(where, `line LIKE ? ESCAPE '\'`), append(args, "%\tdenied=true%") }
+	rows, err := s.db.Query(`SELECT line FROM audit`+sqlWhere(where)+` ORDER BY seq DESC`, args...)
+	if err != nil { return nil, err }
+	defer rows.Close()
+	var out []string
+	for rows.Next() && len(out) < limit {
+		var l string
+		if err := rows.Scan(&l); err != nil { return nil, err }
+		if q.matchAudit(l) { out = append(out, l) }
+	}
+	return out, rows.Err()
+}
+
+// likeEscape quotes the LIKE wildcards of s for ESCAPE '\'
+func likeEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// likeClauses are the conditions of a record query: each column starting with its
+// value, and each word somewhere in text; LIKE ignores case as matchRequest does
+func likeClauses(prefixes map[string]string, words []string, text string) ([]string, []interface{}) {
+	var where []string
+	var args []interface{}
+	for col, v := range prefixes {
+		if v != "" { where, args = append(where, col+` LIKE ? ESCAPE '\'`), append(args, likeEscape(v)+"%") }
+	}
+	for _, w := range words { where, args = append(where, text+` LIKE ? ESCAPE '\'`), append(args, "%"+likeEscape(w)+"%") }
+	return where, args
+}
+
+func sqlWhere(conds []string) string {
+	if len(conds) == 0 { return "" }
+	return " WHERE " + strings.Join(conds, " AND ")
+}
+
+// Watched is the write-ahead log, which every committed write changes
+func (s *sqliteStore) Watched() string { return s.path + "-wal" }
+func (s *sqliteStore) Close() error    { return s.db.Close() }
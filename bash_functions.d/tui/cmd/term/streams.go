@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/charmbracelet/lipgloss"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// outLine is one line of agent output and the stream it was written to
+type outLine struct {
+	Text string `json:"text"`
+	Err  bool   `json:"err,omitempty"`
+}
+
+// outputLines is an agent's output in the order it was written
+type outputLines []outLine
+
+// text joins the lines of the chosen streams
+func (o outputLines) text(stdout, stderr bool) string {
+	var b strings.Builder
+	for _, l := range o {
+		if l.Err && stderr || !l.Err && stdout { b.WriteString(l.Text + "\n") }
+	}
+	return b.String()
+}
+
+func (o outputLines) combined() string { return o.text(true, true) }
+func (o outputLines) stderr() string   { return o.text(false, true) }
+
+// streamWriter splits what one stream writes into lines of a shared outputLines
+type streamWriter struct {
+	mu      *sync.Mutex
+	out     *outputLines
+	err     bool
+	partial []byte
+}
+
+func (w *streamWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 { break }
+		*w.out = append(*w.out, outLine{Text: string(w.partial[:i]), Err: w.err})
+		w.partial = w.partial[i+1:]
+	}
+	return len(p), nil
+}
+
+// flush keeps a last line that has no newline
+func (w *streamWriter) flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.partial) > 0 { *w.out = append(*w.out, outLine{Text: string(w.partial), Err: w.err}) }
+	w.partial = nil
+}
+
+// runAgentCapture is runAgentScript keeping stdout and stderr apart
+func runAgentCapture(ctx context.Context, agent string, execFlag bool) (outputLines, int, error) {
+	ctx, span := startSpan(ctx, "agent.run", attribute.String("agent", agent), attribute.Bool("exec", execFlag))
+	if sock := brokerSocket(); execFlag && sock != "" {
+		out, code, err := brokerRun(ctx, sock, agent)
+		endSpan(span, code, err)
+		return out, code, err
+	}
+	var out outputLines
+	var mu sync.Mutex
+	stdout, stderr := &streamWriter{mu: &mu, out: &out}, &streamWriter{mu: &mu, out: &out, err: true}
+	cmd := agentCommand(ctx, agent, execFlag)
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	err := cmd.Run()
+	stdout.flush()
+	stderr.flush()
+	code := exitCodeOf(err)
+	endSpan(span, code, err)
+	return out, code, err
+}
+
+// stderrPath is where the stderr of a run stored at log is kept
+func stderrPath(log string) string { return strings.TrimSuffix(log, ".log") + ".err" }
+
+// saveStreams writes a run to log (both streams, interleaved) and its stderr next to it
+func saveStreams(log string, out outputLines) error {
+	if err := ioutil.WriteFile(log, []byte(out.combined()), 0o600); err != nil { return err }
+	if e := out.stderr(); e != "" { return ioutil.WriteFile(stderrPath(log), []byte(e), 0o600) }
+	return nil
+}
+
+// splitStreams marks the lines of combined that came from stderr by walking the
+// stderr lines in order; both files keep the order each stream was written in
+func splitStreams(combined, stderr string) outputLines {
+	split := func(s string) []string {
+		if s == "" { return nil }
+		return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	}
+	errs := split(stderr)
+	var out outputLines
+	for _, l := range split(combined) {
+		isErr := len(errs) > 0 && l == errs[0]
+		if isErr { errs = errs[1:] }
+		out = append(out, outLine{Text: l, Err: isErr})
+	}
+	return out
+}
+
+// loadStreams reads a run stored by saveStreams or a job
+func loadStreams(log string) (outputLines, error) {
+	b, err := ioutil.ReadFile(log)
+	if err != nil { return nil, err }
+	e, err := ioutil.ReadFile(stderrPath(log))
+	if err != nil && !os.IsNotExist(err) { return nil, err }
+	return splitStreams(string(b), string(e)), nil
+}
+
+// stream views of agent output, cycled with O
+const (
+	viewInterleaved = iota
+	viewStdout
+	viewStderr
+	viewMarkdown // stdout rendered with glamour, only for markdown output
+)
+
+var streamViewNames = []string{"stdout+stderr", "stdout", "stderr", "markdown"}
+
+// streamView is the agent output in the viewport and which streams it shows
+type streamView struct {
+	lines outputLines
+	view  int
+	shown string // content set on the viewport, to tell whether it still shows this output
+	md    string // markdown source of the markdown view, "" when the output is not markdown
+}
+
+var stderrStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("203"))
+
+// render shows the chosen streams; in the interleaved view stderr lines are
+// highlighted, or marked in plain mode
+func (v *streamView) render(plain bool) string {
+	var b strings.Builder
+	for _, l := range v.lines {
+		switch {
+		case v.view == viewStdout && l.Err, v.view == viewStderr && !l.Err:
+			continue
+		case v.view == viewInterleaved && l.Err && plain:
+			b.WriteString(T("stderr: ") + l.Text + "\n")
+		case v.view == viewInterleaved && l.Err:
+			b.WriteString(stderrStyle.Render(l.Text) + "\n")
+		default:
+			b.WriteString(l.Text + "\n")
+		}
+	}
+	if b.Len() == 0 { return T("(no %s output)", streamViewNames[v.view]) }
+	return b.String()
+}
+
+var (
+	mdFence    = regexp.MustCompile("^ {0,3}(```|~~~)")
+	mdTableSep = regexp.MustCompile(`^\s*\|?\s*:?-{3,}:?\s*(\|\s*:?-{3,}:?\s*)+\|?\s*$`)
+	mdListItem = regexp.MustCompile(`^\s*([-*+]|\d+[.)])\s+\S`)
+	mdEmphasis = regexp.MustCompile(`\*\*[^*\s][^*]*\*\*|` + "`[^`]+`")
+)
+
+// looksLikeMarkdown guesses whether agent output is markdown: it needs a heading, a
+// fenced block or a table, and one more kind of markdown besides; output that already
+// carries terminal colors is left alone
+func looksLikeMarkdown(s string) bool {
+	if ansiEscape.MatchString(s) { return false }
+	kinds := map[string]bool{}
+	for _, l := range strings.Split(s, "\n") {
+		switch {
+		case atxHeading.MatchString(l):
+			kinds["heading"] = true
+		case mdFence.MatchString(l):
+			kinds["fence"] = true
+		case mdTableSep.MatchString(l):
+			kinds["table"] = true
+		case mdListItem.MatchString(l):
+			kinds["list"] = true
+		}
+		if mdLink.MatchString(l) { kinds["link"] = true }
+		if mdEmphasis.MatchString(l) { kinds["emphasis"] = true }
+	}
+	return (kinds["heading"] || kinds["fence"] || kinds["table"]) && len(kinds) >= 2
+}
+
+// outputIsMarkdown tells whether agent's stdout is rendered: the manifest's output
+// field when it is set, else a guess from out
+func outputIsMarkdown(agent, out string) bool {
+	if mf, err := loadManifest(); err == nil {
+		if a, ok := mf.agent(agent); ok {
+			switch a.Output {
+			case "markdown":
+				return true
+			case "text":
+				return false
+			}
+		}
+	}
+	return looksLikeMarkdown(out)
+}
+
+// showOutput puts agent output in the viewport: stdout rendered with glamour when the
+// agent writes markdown, else both streams interleaved
+func (m *model) showOutput(agent string, lines outputLines) {
+	m.streams = &streamView{lines: lines}
+	if out := lines.text(true, false); strings.TrimSpace(out) != "" && outputIsMarkdown(agent, out) {
+		m.streams.md = out
+		// stderr is not markdown; it goes below the report as it was written
+		if e := lines.stderr(); e != "" { m.streams.md += "\n\n---\n\n**stderr**\n\n```\n" + e + "```\n" }
+		m.streams.view = viewMarkdown
+		m.showMarkdown(m.streams.md)
+		return
+	}
+	m.streams.shown = m.streams.render(m.plain)
+	m.setContent(m.streams.shown)
+}
+
+// showingStreams reports whether the viewport still shows the agent output
+func (m *model) showingStreams() bool {
+	if m.streams == nil { return false }
+	if m.streams.view == viewMarkdown { return m.md != nil && m.md.path == "" && m.md.source == m.streams.md }
+	return m.md == nil && m.vpContent == m.streams.shown
+}
+
+// cycleStreams switches the shown agent output between both streams, stdout and
+// stderr, and the rendered report for markdown output
+func (m *model) cycleStreams() {
+	if !m.showingStreams() { m.status = T("no agent output shown"); return }
+	n := viewMarkdown
+	if m.streams.md != "" { n++ }
+	m.streams.view = (m.streams.view + 1) % n
+	m.status = T("showing %s", streamViewNames[m.streams.view])
+	if m.streams.view == viewMarkdown { m.streams.shown = ""; m.showMarkdown(m.streams.md); return }
+	m.streams.shown = m.streams.render(m.plain)
+	m.setContent(m.streams.shown)
+}
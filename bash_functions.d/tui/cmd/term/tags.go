@@ -0,0 +1,238 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// tagsPath is the per-user tag store: the tags of each file by absolute path
+func tagsPath() string { return filepath.Join(tuiDataDir(), "tags.json") }
+
+func loadTags() map[string][]string {
+	tags := map[string][]string{}
+	if b, err := ioutil.ReadFile(tagsPath()); err == nil { _ = json.Unmarshal(b, &tags) }
+	return tags
+}
+
+func saveTags(tags map[string][]string) error {
+	b, err := json.MarshalIndent(tags, "", "  ")
+	if err != nil { return err }
+	if err := os.MkdirAll(tuiDataDir(), 0o700); err != nil { return err }
+	tmp := tagsPath() + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0o600); err != nil { return err }
+	return os.Rename(tmp, tagsPath())
+}
+
+// parseTagEdit reads "runbook wip -draft": tags to add, and to remove with a leading -
+func parseTagEdit(s string) (add, remove []string) {
+	for _, t := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool { return r == ' ' || r == ',' }) {
+		t = strings.TrimPrefix(t, "#")
+		if strings.HasPrefix(t, "-") { if t = strings.TrimLeft(t, "-#"); t != "" { remove = append(remove, t) }; continue }
+		if t != "" { add = append(add, t) }
+	}
+	return add, remove
+}
+
+// editTags adds and removes tags of files; files left without tags are dropped
+func editTags(files, add, remove []string) error {
+	return withLock("tags", func() error {
+		tags := loadTags()
+		for _, f := range files {
+			set := map[string]bool{}
+			for _, t := range tags[f] { set[t] = true }
+			for _, t := range add { set[t] = true }
+			for _, t := range remove { delete(set, t) }
+			var ts []string
+			for t := range set { ts = append(ts, t) }
+			sort.Strings(ts)
+			if len(ts) == 0 { delete(tags, f) } else { tags[f] = ts }
+		}
+		return saveTags(tags)
+	})
+}
+
+// moveTags carries the tags of renamed files over to their new paths
+func moveTags(moved map[string]string) error {
+	return withLock("tags", func() error {
+		tags := loadTags()
+		changed := false
+		for from, to := range moved {
+			if ts, ok := tags[from]; ok { delete(tags, from); tags[to] = ts; changed = true }
+		}
+		if !changed { return nil }
+		return saveTags(tags)
+	})
+}
+
+// dropTags forgets the tags of deleted files
+func dropTags(files []string) error {
+	return withLock("tags", func() error {
+		tags := loadTags()
+		changed := false
+		for _, f := range files {
+			if _, ok := tags[f]; ok { delete(tags, f); changed = true }
+		}
+		if !changed { return nil }
+		return saveTags(tags)
+	})
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags { if t == tag { return true } }
+	return false
+}
+
+// filterByTag keeps the directories and the files tagged tag
+func filterByTag(items []list.Item, tag string) []list.Item {
+	out := items[:0]
+	for _, it := range items {
+		f := it.(fileItem)
+		if f.isDir || hasTag(f.tags, tag) { out = append(out, it) }
+	}
+	return out
+}
+
+// newTagInput is the Files prompt of + (edit the tags of files) and # (filter by tag)
+func newTagInput() textinput.Model {
+	ti := textinput.New()
+	ti.CharLimit = 200
+	return ti
+}
+
+// openTagEdit asks for the tags to add or remove on the marked or selected files
+func (m *model) openTagEdit() tea.Cmd {
+	files := m.checksumTargets()
+	if len(files) == 0 { m.status = T("select a file or mark some with m"); return nil }
+	m.tagFiles = files
+	m.tagInput.Prompt = T("tags for %d files (wip -draft removes draft): ", len(files))
+	m.tagInput.SetValue("")
+	if len(files) == 1 {
+		m.tagInput.Prompt = T("tags for %s (wip -draft removes draft): ", filepath.Base(files[0]))
+		m.tagInput.SetValue(strings.Join(loadTags()[files[0]], " "))
+		m.tagInput.CursorEnd()
+	}
+	return m.tagInput.Focus()
+}
+
+// openTagFilter asks for the tag the Files list is filtered by
+func (m *model) openTagFilter() tea.Cmd {
+	m.tagFiles = nil
+	m.tagInput.Prompt = T("show files tagged (empty shows all): ")
+	m.tagInput.SetValue(m.files.tag)
+	m.tagInput.CursorEnd()
+	return m.tagInput.Focus()
+}
+
+// updateTagInput handles keys while the tag prompt has focus. Editing the tags of a
+// single file replaces them with the words typed, as the prompt starts with them.
+func (m *model) updateTagInput(msg tea.KeyMsg) tea.Cmd {
+	switch msg.String() {
+	case "esc":
+		m.tagInput.Blur()
+		return nil
+	case "enter":
+		m.tagInput.Blur()
+		v := m.tagInput.Value()
+		if m.tagFiles == nil {
+			m.files.tag = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(v)), "#")
+			m.refreshFiles()
+			if m.files.tag == "" { m.status = T("tag filter cleared") } else { m.status = T("%d files tagged %s", len(m.list.Items())-countDirs(m.list.Items()), m.files.tag) }
+			return nil
+		}
+		add, remove := parseTagEdit(v)
+		if len(m.tagFiles) == 1 {
+			// the words shown are the file's tags: the ones deleted are removed
+			for _, t := range loadTags()[m.tagFiles[0]] {
+				if !hasTag(add, t) { remove = append(remove, t) }
+			}
+		}
+		if err := editTags(m.tagFiles, add, remove); err != nil { m.status = T("tags not saved: %v", err); slog.Warn("tags not saved", "err", err); return nil }
+		m.refreshFiles()
+		m.refreshTags()
+		m.status = T("tagged %d files", len(m.tagFiles))
+		return nil
+	}
+	var cmd tea.Cmd
+	m.tagInput, cmd = m.tagInput.Update(msg)
+	return cmd
+}
+
+// tagItem is one tagged file of the Tags tab
+type tagItem struct {
+	tag, path string
+	missing   bool
+}
+
+func (t tagItem) Title() string { return "#" + t.tag + "  " + filepath.Base(t.path) }
+func (t tagItem) Description() string {
+	if t.missing { return t.path + "  " + T("(missing)") }
+	return t.path
+}
+func (t tagItem) FilterValue() string { return t.tag + " " + t.path }
+
+func newTagsList() list.Model {
+	l := list.New(nil, list.NewDefaultDelegate(), 60, height-8)
+	l.Title = T("Tags")
+	l.SetShowHelp(false)
+	return l
+}
+
+// refreshTags lists every tagged file once per tag, by tag then path
+func (m *model) refreshTags() {
+	var items []tagItem
+	for path, ts := range loadTags() {
+		_, err := os.Stat(path)
+		for _, t := range ts { items = append(items, tagItem{tag: t, path: path, missing: err != nil}) }
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].tag != items[j].tag { return items[i].tag < items[j].tag }
+		return items[i].path < items[j].path
+	})
+	out := make([]list.Item, len(items))
+	for i, it := range items { out[i] = it }
+	m.tagsList.SetItems(out)
+}
+
+// updateTags handles the keys of the Tags tab: enter shows the file in the Files tab,
+// # filters the Files tab by the tag, x removes the tag from the file, u reloads
+func (m *model) updateTags(key string) (tea.Cmd, bool) {
+	if m.tagsList.FilterState() == list.Filtering { return nil, false }
+	sel, ok := m.tagsList.SelectedItem().(tagItem)
+	switch key {
+	case "u":
+		m.refreshTags()
+		m.status = T("refreshed tags")
+	case "enter":
+		if !ok { return nil, true }
+		if sel.missing { m.status = T("%s no longer exists (x removes the tag)", sel.path); return nil, true }
+		if m.files.tag != sel.tag { m.files.tag = "" }
+		m.chdir(filepath.Dir(sel.path))
+		for i, it := range m.list.Items() {
+			if it.(fileItem).path == sel.path { m.list.Select(i); break }
+		}
+	case "#":
+		if !ok { return nil, true }
+		m.files.tag = sel.tag
+		m.refreshFiles()
+		m.active = m.tabIndex("Files")
+		m.status = T("%d files tagged %s", len(m.list.Items())-countDirs(m.list.Items()), sel.tag)
+	case "x":
+		if !ok { return nil, true }
+		if err := editTags([]string{sel.path}, nil, []string{sel.tag}); err != nil { m.status = T("tags not saved: %v", err); slog.Warn("tags not saved", "err", err); return nil, true }
+		m.refreshTags()
+		m.refreshFiles()
+		m.status = T("removed #%s from %s", sel.tag, filepath.Base(sel.path))
+	default:
+		return nil, false
+	}
+	return nil, true
+}
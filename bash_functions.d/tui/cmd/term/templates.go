@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// fileTemplate is a starting point for a new file. Bodies are text/template with
+// .Name (file name), .Author and .Date filled in when the file is created.
+type fileTemplate struct {
+	name string
+	desc string
+	ext  string // appended when the new file name has no extension
+	body string
+}
+
+func (t fileTemplate) Title() string       { return t.name }
+func (t fileTemplate) Description() string { return T(t.desc) }
+func (t fileTemplate) FilterValue() string { return t.name }
+
+// scriptHeader is the standard header block used by scripts in this repo
+const scriptHeader = `#!/usr/bin/env bash
+# {{.Name}}
+# Author: {{.Author}}
+# Date: {{.Date}}
+#
+# Summary:
+#   TODO: what this script does
+#
+# Inputs:
+#   TODO: arguments, environment variables, files read
+#
+# Outputs:
+#   TODO: files written, exit codes
+#
+# Modification Log:
+#   {{.Date}}  {{.Author}}  created
+#
+`
+
+var builtinTemplates = []fileTemplate{
+	{name: "bash-script", desc: "bash script with the cbw header block", ext: ".sh", body: scriptHeader + `set -euo pipefail
+
+main() {
+  :
+}
+
+main "$@"
+`},
+	{name: "agent-script", desc: "agent skeleton: dry-run by default, --exec to act", ext: ".sh", body: scriptHeader + `set -euo pipefail
+
+EXEC=false
+[[ "${1:-}" == "--exec" ]] && { EXEC=true; shift; }
+
+# run prints the command in dry-run mode and executes it with --exec
+run() {
+  if $EXEC; then "$@"; else printf 'DRY-RUN: %s\n' "$*"; fi
+}
+
+run echo "hello from {{.Name}}"
+`},
+	{name: "markdown-doc", desc: "markdown document with title and sections", ext: ".md", body: `# {{.Name}}
+
+Author: {{.Author}}
+Date: {{.Date}}
+
+## Overview
+
+## Usage
+
+## Notes
+`},
+}
+
+// templatesDir holds user templates; each file is a template named after its base name
+func templatesDir() string { return filepath.Join(tuiDataDir(), "templates") }
+
+// loadTemplates returns the built-in templates followed by the user's, which
+// replace a built-in of the same name
+func loadTemplates() []fileTemplate {
+	out := append([]fileTemplate(nil), builtinTemplates...)
+	files, _ := ioutil.ReadDir(templatesDir())
+	sort.Slice(files, func(i, j int) bool { return files[i].Name() < files[j].Name() })
+	for _, fi := range files {
+		if fi.IsDir() { continue }
+		b, err := ioutil.ReadFile(filepath.Join(templatesDir(), fi.Name()))
+		if err != nil { continue }
+		ext := filepath.Ext(fi.Name())
+		t := fileTemplate{name: strings.TrimSuffix(fi.Name(), ext), desc: "user template", ext: ext, body: string(b)}
+		replaced := false
+		for i := range out {
+			if out[i].name == t.name { out[i], replaced = t, true }
+		}
+		if !replaced { out = append(out, t) }
+	}
+	return out
+}
+
+// renderTemplate fills in the placeholders of t for a file called name
+func renderTemplate(t fileTemplate, name, author string) (string, error) {
+	tpl, err := template.New(t.name).Parse(t.body)
+	if err != nil { return "", err }
+	var b bytes.Buffer
+	err = tpl.Execute(&b, struct{ Name, Author, Date string }{name, author, time.Now().Format("2006-01-02")})
+	return b.String(), err
+}
+
+// newFileForm is the Files tab picker for creating a file from a template
+type newFileForm struct {
+	templates list.Model
+	name      textinput.Model
+}
+
+// openNewFileForm shows the template picker with the name input focused
+func (m *model) openNewFileForm() tea.Cmd {
+	items := []list.Item{}
+	for _, t := range loadTemplates() { items = append(items, t) }
+	l := list.New(items, list.NewDefaultDelegate(), 50, m.height-12)
+	l.Title = T("New file in %s", m.cwd)
+	l.SetShowHelp(false)
+	l.SetFilteringEnabled(false)
+	if m.plain { l.SetDelegate(plainDelegate{}); l.Styles.Title = lipgloss.NewStyle() }
+	ti := textinput.New()
+	ti.Placeholder = T("file name, then enter (esc cancels)")
+	ti.CharLimit = 255
+	ti.Width = 50
+	m.newFile = &newFileForm{templates: l, name: ti}
+	return m.newFile.name.Focus()
+}
+
+// updateNewFileForm handles keys while the picker is open: up/down choose the
+// template, everything else edits the name
+func (m *model) updateNewFileForm(msg tea.KeyMsg) tea.Cmd {
+	f := m.newFile
+	var cmd tea.Cmd
+	switch msg.String() {
+	case "esc":
+		m.newFile = nil
+		return nil
+	case "up", "down":
+		f.templates, cmd = f.templates.Update(msg)
+		return cmd
+	case "enter":
+		t, ok := f.templates.SelectedItem().(fileTemplate)
+		name := strings.TrimSpace(f.name.Value())
+		if !ok || name == "" { return nil }
+		path, err := m.createFromTemplate(t, name)
+		if err != nil { m.status = T("create failed: %v", err); slog.Warn("create failed", "err", err); return nil }
+		m.newFile = nil
+		m.refreshFiles()
+		return m.openInEditor(path, 1, 1)
+	}
+	f.name, cmd = f.name.Update(msg)
+	return cmd
+}
+
+// createFromTemplate writes a new file in the current directory; existing files are
+// never overwritten
+func (m *model) createFromTemplate(t fileTemplate, name string) (string, error) {
+	if filepath.Ext(name) == "" { name += t.ext }
+	path := filepath.Join(m.cwd, name)
+	body, err := renderTemplate(t, filepath.Base(name), m.cfg.Author)
+	if err != nil { return "", err }
+	mode := os.FileMode(0o644)
+	if strings.HasPrefix(body, "#!") { mode = 0o755 }
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil { return "", err }
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil { return "", err }
+	if _, err := f.WriteString(body); err != nil { f.Close(); return "", err }
+	return path, f.Close()
+}
+
+// view renders the picker in place of the file list
+func (f *newFileForm) view() string {
+	return f.name.View() + "\n\n" + f.templates.View()
+}
@@ -0,0 +1,478 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// The Terraform tab plans the configurations found under terraform_dir (the cwd by
+// default) and shows what the plan would create, change and destroy. Applying is not
+// done from the tab: `a` queues the saved plan as a request, and the plan is applied
+// exactly as reviewed when an admin approves it.
+
+// terraformSkipDirs are not searched for configurations
+var terraformSkipDirs = map[string]bool{".git": true, ".terraform": true, "modules": true, "node_modules": true, "vendor": true}
+
+// tfActions are the plan's change kinds, in the order the summary shows them
+var tfActions = []string{"create", "update", "replace", "delete", "read"}
+
+var tfActionSigns = map[string]string{"create": "+", "update": "~", "replace": "-/+", "delete": "-", "read": "<="}
+
+// tfActionGroups head the groups of the summary
+var tfActionGroups = map[string]string{"create": "%d to create", "update": "%d to update in place", "replace": "%d to replace", "delete": "%d to destroy", "read": "%d data sources to read"}
+
+// terraformView is the Terraform tab
+type terraformView struct {
+	dir      string   // where configurations are looked for
+	dirs     []string // relative to dir: the directories holding .tf files
+	sel      int
+	plan     *tfPlan // last plan of the selected directory
+	planning bool
+	cursor   int             // row of the plan summary
+	open     map[string]bool // expanded rows, by tfRow key
+}
+
+func newTerraformView() *terraformView { return &terraformView{open: map[string]bool{}} }
+
+// tfPlan is a saved plan and what it changes
+type tfPlan struct {
+	dir     string // absolute
+	file    string // saved plan, for apply
+	changes []tfChange
+	out     string // terraform output when planning failed
+	err     error
+}
+
+// tfChange is one resource the plan touches
+type tfChange struct {
+	address string
+	action  string // one of tfActions
+	attrs   []tfAttr
+}
+
+// tfAttr is a top-level attribute that the change sets, alters or removes
+type tfAttr struct{ key, before, after string }
+
+// tfPlanJSON is the part of `terraform show -json` used here
+type tfPlanJSON struct {
+	ResourceChanges []struct {
+		Address string `json:"address"`
+		Change  struct {
+			Actions         []string               `json:"actions"`
+			Before          map[string]interface{} `json:"before"`
+			After           map[string]interface{} `json:"after"`
+			AfterUnknown    interface{}            `json:"after_unknown"`
+			BeforeSensitive interface{}            `json:"before_sensitive"`
+			AfterSensitive  interface{}            `json:"after_sensitive"`
+		} `json:"change"`
+	} `json:"resource_changes"`
+}
+
+func terraformDataDir() string { return filepath.Join(tuiDataDir(), "terraform") }
+
+// terraformPlanFile is where the tab saves the plan of dir
+func terraformPlanFile(dir string) string {
+	return filepath.Join(terraformDataDir(), fmt.Sprintf("%x", sha256.Sum256([]byte(dir)))[:16]+".tfplan")
+}
+
+// terraformRequestPlan is the copy of the plan kept for request id until it is decided
+func terraformRequestPlan(id string) string { return filepath.Join(terraformDataDir(), id+".tfplan") }
+
+// terraformRequestDir returns the configuration an apply request is for; requests
+// queued from the Terraform tab have the agent "terraform:<dir>"
+func terraformRequestDir(r requestItem) (string, bool) {
+	if !strings.HasPrefix(r.Agent, "terraform:") { return "", false }
+	return strings.TrimPrefix(r.Agent, "terraform:"), true
+}
+
+// scanTerraform finds the directories up to three levels below dir holding .tf files
+func scanTerraform(dir string) []string {
+	seen := map[string]bool{}
+	var dirs []string
+	base := strings.Count(filepath.Clean(dir), string(filepath.Separator))
+	filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil { return nil }
+		if fi.IsDir() {
+			if path != dir && (terraformSkipDirs[fi.Name()] || strings.Count(path, string(filepath.Separator))-base > 3) { return filepath.SkipDir }
+			return nil
+		}
+		if filepath.Ext(path) != ".tf" { return nil }
+		rel, _ := filepath.Rel(dir, filepath.Dir(path))
+		if !seen[rel] { seen[rel] = true; dirs = append(dirs, rel) }
+		return nil
+	})
+	sort.Strings(dirs)
+	return dirs
+}
+
+// tfPlanMsg carries a finished plan; request is set when it is the plan of a queued
+// apply request shown from the Requests tab
+type tfPlanMsg struct {
+	plan    *tfPlan
+	request string
+}
+
+// planTerraform runs terraform plan in dir, saving the plan to file, then reads it back
+func planTerraform(dir, file string) tea.Cmd {
+	return func() tea.Msg {
+		p := &tfPlan{dir: dir, file: file}
+		if err := os.MkdirAll(terraformDataDir(), 0o700); err != nil { p.err = err; return tfPlanMsg{plan: p} }
+		cmd := exec.Command("terraform", "plan", "-input=false", "-no-color", "-out="+file)
+		cmd.Dir, cmd.Env = dir, append(os.Environ(), "TF_IN_AUTOMATION=1")
+		out, err := cmd.CombinedOutput()
+		if err != nil { p.out, p.err = string(out), err; return tfPlanMsg{plan: p} }
+		p.changes, p.err = readTerraformPlan(dir, file)
+		return tfPlanMsg{plan: p}
+	}
+}
+
+// showTerraformPlan reads the saved plan of apply request id
+func showTerraformPlan(id, dir string) tea.Cmd {
+	return func() tea.Msg {
+		p := &tfPlan{dir: dir, file: terraformRequestPlan(id)}
+		p.changes, p.err = readTerraformPlan(dir, p.file)
+		return tfPlanMsg{plan: p, request: id}
+	}
+}
+
+func readTerraformPlan(dir, file string) ([]tfChange, error) {
+	cmd := exec.Command("terraform", "show", "-json", "-no-color", file)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" { return nil, errors.New(msg) }
+		return nil, err
+	}
+	return parseTerraformPlan(out)
+}
+
+// parseTerraformPlan lists the changes of a JSON plan, leaving out no-ops
+func parseTerraformPlan(b []byte) ([]tfChange, error) {
+	var pj tfPlanJSON
+	if err := json.Unmarshal(b, &pj); err != nil { return nil, err }
+	var changes []tfChange
+	for _, rc := range pj.ResourceChanges {
+		c := tfChange{address: rc.Address, action: tfAction(rc.Change.Actions)}
+		if c.action == "" { continue }
+		unknown, sensitive := tfFlags(rc.Change.AfterUnknown), tfFlags(rc.Change.AfterSensitive)
+		for k, v := range tfFlags(rc.Change.BeforeSensitive) { sensitive[k] = sensitive[k] || v }
+		keys := map[string]bool{}
+		for k := range rc.Change.Before { keys[k] = true }
+		for k := range rc.Change.After { keys[k] = true }
+		for k := range unknown { keys[k] = true }
+		for k := range keys {
+			before, after := tfValue(rc.Change.Before, k), tfValue(rc.Change.After, k)
+			if unknown[k] { after = "(known after apply)" }
+			if c.action == "delete" { after = "" }
+			if before == after { continue }
+			if sensitive[k] {
+				if before != "" { before = "(sensitive)" }
+				if after != "" && !unknown[k] { after = "(sensitive)" }
+			}
+			c.attrs = append(c.attrs, tfAttr{key: k, before: before, after: after})
+		}
+		sort.Slice(c.attrs, func(i, j int) bool { return c.attrs[i].key < c.attrs[j].key })
+		changes = append(changes, c)
+	}
+	return changes, nil
+}
+
+// tfAction names a plan's action list; "" for no-op
+func tfAction(actions []string) string {
+	switch strings.Join(actions, ",") {
+	case "create", "update", "delete", "read":
+		return actions[0]
+	case "delete,create", "create,delete":
+		return "replace"
+	}
+	return ""
+}
+
+// tfFlags reads after_unknown and the *_sensitive fields: true for the whole object,
+// or an object marking its attributes
+func tfFlags(v interface{}) map[string]bool {
+	flags := map[string]bool{}
+	obj, ok := v.(map[string]interface{})
+	if !ok { return flags }
+	for k, f := range obj {
+		// a nested value with any flag set counts for the whole attribute
+		switch f := f.(type) {
+		case bool:
+			flags[k] = f
+		case map[string]interface{}, []interface{}:
+			b, _ := json.Marshal(f)
+			flags[k] = bytes.Contains(b, []byte("true"))
+		}
+	}
+	return flags
+}
+
+// tfValue is the JSON of attribute k of obj, "" when unset
+func tfValue(obj map[string]interface{}, k string) string {
+	v, ok := obj[k]
+	if !ok || v == nil { return "" }
+	b, err := json.Marshal(v)
+	if err != nil { return fmt.Sprint(v) }
+	return string(b)
+}
+
+// counts returns how many resources each action touches
+func (p *tfPlan) counts() map[string]int {
+	n := map[string]int{}
+	for _, c := range p.changes { n[c.action]++ }
+	return n
+}
+
+// summary is the one-line count terraform prints after a plan
+func (p *tfPlan) summary() string {
+	n := p.counts()
+	return T("%d to add, %d to change, %d to destroy", n["create"]+n["replace"], n["update"], n["delete"]+n["replace"])
+}
+
+// tfRow is one line of the plan summary: an action group, a resource or an attribute
+type tfRow struct {
+	key, text string
+	depth     int
+	action    string
+	attr      *tfAttr
+}
+
+// rows lays out the plan as a tree: groups are expanded and resources collapsed
+// until toggled; all expands everything
+func (p *tfPlan) rows(open map[string]bool, all bool) []tfRow {
+	n := p.counts()
+	var rows []tfRow
+	for _, a := range tfActions {
+		if n[a] == 0 { continue }
+		gk := "group:" + a
+		rows = append(rows, tfRow{key: gk, action: a, text: tfActionSigns[a] + " " + T(tfActionGroups[a], n[a])})
+		if !all && open[gk+"!"] { continue }
+		for _, c := range p.changes {
+			if c.action != a { continue }
+			rk := "resource:" + c.address
+			rows = append(rows, tfRow{key: rk, action: a, depth: 1, text: tfActionSigns[a] + " " + c.address})
+			if !all && !open[rk] { continue }
+			for i := range c.attrs { rows = append(rows, tfRow{key: rk + "." + c.attrs[i].key, action: a, depth: 2, attr: &c.attrs[i]}) }
+		}
+	}
+	return rows
+}
+
+// toggle expands or collapses the row at the cursor. Groups start out expanded, so
+// collapsing one is remembered under its key plus "!".
+func (v *terraformView) toggle(r tfRow) {
+	switch {
+	case strings.HasPrefix(r.key, "group:"):
+		v.open[r.key+"!"] = !v.open[r.key+"!"]
+	case r.depth == 1:
+		v.open[r.key] = !v.open[r.key]
+	}
+}
+
+// loadTerraform scans the Terraform dir the first time the tab is shown
+func (m *model) loadTerraform() {
+	if m.tabs[m.active] == "Terraform" && m.tf.dir == "" { m.refreshTerraform() }
+}
+
+func (m *model) refreshTerraform() {
+	v := m.tf
+	v.dir = m.cfg.TerraformDir
+	if v.dir == "" { v.dir = m.cwd }
+	v.dirs = scanTerraform(v.dir)
+	if v.sel >= len(v.dirs) { v.sel = max(0, len(v.dirs)-1) }
+}
+
+// selectedDir is the absolute path of the selected configuration
+func (v *terraformView) selectedDir() string {
+	if len(v.dirs) == 0 { return "" }
+	return filepath.Join(v.dir, v.dirs[v.sel])
+}
+
+// terraformPlanned stores a plan run from the tab, or shows the plan of a request
+func (m *model) terraformPlanned(msg tfPlanMsg) {
+	p := msg.plan
+	if msg.request != "" {
+		if p.err != nil { m.status = T("cannot read the plan of %s: %v", msg.request, p.err); slog.Warn("terraform show failed", "request", msg.request, "err", p.err); return }
+		m.panes.show(true, m.tabs[m.active], "Preview")
+		m.setContent(T("Plan of %s (%s): %s", msg.request, p.dir, p.summary()) + "\n\n" + m.renderTerraformRows(p.rows(nil, true), -1, m.width))
+		m.vp.GotoTop()
+		return
+	}
+	v := m.tf
+	v.planning = false
+	if p.dir != v.selectedDir() { return }
+	v.plan, v.cursor = p, 0
+	if p.err != nil { m.status = T("terraform plan failed: %v", p.err); slog.Warn("terraform plan failed", "dir", p.dir, "err", p.err); return }
+	if len(p.changes) == 0 { m.status = T("no changes: the infrastructure matches the configuration"); return }
+	m.status = T("plan: %s", p.summary())
+}
+
+// requestApply queues the plan shown for approval. The plan file is copied for the
+// request, so replanning in the tab does not change what the approver applies.
+func (m *model) requestApply() {
+	p := m.tf.plan
+	if p == nil || p.err != nil || len(p.changes) == 0 { m.status = T("plan first: there is nothing to apply"); return }
+	m.ask(T("queue terraform apply of %s for approval?", filepath.Base(p.dir)), func(m *model) tea.Cmd {
+		now := time.Now()
+		r := requestItem{ID: fmt.Sprintf("tf-%d", now.UnixNano()), Agent: "terraform:" + p.dir, User: transferUser(), Time: now.Format(time.RFC3339), Notes: "terraform apply: " + p.summary()}
+		err := copyFile(p.file, terraformRequestPlan(r.ID))
+		if err == nil { err = withRequestStore(m.requestsPath, func(s RequestStore) error { return s.Add(r) }) }
+		if err != nil { os.Remove(terraformRequestPlan(r.ID)); m.status = T("cannot queue the apply: %v", err); slog.Warn("terraform apply request failed", "dir", p.dir, "err", err); return nil }
+		m.reloadRequests()
+		m.status = T("apply of %s queued as %s; an admin approves it in the Requests tab", filepath.Base(p.dir), r.ID)
+		return nil
+	})
+}
+
+func copyFile(from, to string) error {
+	b, err := ioutil.ReadFile(from)
+	if err != nil { return err }
+	return ioutil.WriteFile(to, b, 0o600)
+}
+
+// runTerraformApply applies the saved plan of request r in its directory
+func runTerraformApply(ctx context.Context, r requestItem, dir string) (outputLines, int, error) {
+	_, span := startSpan(ctx, "terraform.apply", attribute.String("request.id", r.ID), attribute.String("dir", dir))
+	var out outputLines
+	var mu sync.Mutex
+	stdout, stderr := &streamWriter{mu: &mu, out: &out}, &streamWriter{mu: &mu, out: &out, err: true}
+	cmd := exec.Command("terraform", "apply", "-input=false", "-no-color", terraformRequestPlan(r.ID))
+	cmd.Dir, cmd.Env = dir, append(os.Environ(), "TF_IN_AUTOMATION=1")
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	err := cmd.Run()
+	stdout.flush()
+	stderr.flush()
+	code := exitCodeOf(err)
+	endSpan(span, code, err)
+	return out, code, err
+}
+
+// updateTerraform handles the Terraform tab keys: left/right pick the directory, p
+// plans it, up/down move through the plan, enter/space expand or collapse, z expands
+// everything, a queues an apply and u rescans
+func (m *model) updateTerraform(key string) (tea.Cmd, bool) {
+	v := m.tf
+	var rows []tfRow
+	if v.plan != nil { rows = v.plan.rows(v.open, false) }
+	switch key {
+	case "left", "h":
+		if v.sel > 0 { v.sel--; v.plan = nil }
+	case "right", "l":
+		if v.sel < len(v.dirs)-1 { v.sel++; v.plan = nil }
+	case "up", "k":
+		if v.cursor > 0 { v.cursor-- }
+	case "down", "j":
+		if v.cursor < len(rows)-1 { v.cursor++ }
+	case "enter", " ":
+		if v.cursor < len(rows) { v.toggle(rows[v.cursor]) }
+	case "z":
+		if v.plan == nil { return nil, true }
+		// expand all when anything is collapsed, otherwise collapse the resources
+		expand := false
+		for _, c := range v.plan.changes { if !v.open["resource:"+c.address] { expand = true } }
+		v.open = map[string]bool{}
+		if expand { for _, c := range v.plan.changes { v.open["resource:"+c.address] = true } }
+		v.cursor = max(0, min(v.cursor, len(v.plan.rows(v.open, false))-1))
+	case "p":
+		dir := v.selectedDir()
+		if dir == "" || v.planning { return nil, true }
+		if _, err := exec.LookPath("terraform"); err != nil { m.status = T("terraform not found in PATH"); return nil, true }
+		v.planning, v.plan, v.open = true, nil, map[string]bool{}
+		m.status = T("planning %s...", v.dirs[v.sel])
+		return planTerraform(dir, terraformPlanFile(dir)), true
+	case "a":
+		if !m.denyReadOnly() { m.requestApply() }
+	case "u":
+		m.refreshTerraform()
+		v.plan = nil
+	default:
+		return nil, false
+	}
+	return nil, true
+}
+
+// terraformTabView renders the Terraform tab in w x h cells
+func (m model) terraformTabView(w, h int) string {
+	v := m.tf
+	var b strings.Builder
+	if len(v.dirs) == 0 { return T("No Terraform configurations under %s (set terraform_dir in config.json)", v.dir) + "\n" }
+	fmt.Fprintf(&b, "%s %s  %s\n", T("Directory:"), activeTabStyle.Render(v.dirs[v.sel]), helpStyle.Render(T("(%d of %d)", v.sel+1, len(v.dirs))))
+	b.WriteString(helpStyle.Render(T("←/→: directory • p: plan • enter/space: expand • z: expand all • a: request apply • u: rescan")) + "\n\n")
+	switch p := v.plan; {
+	case v.planning:
+		b.WriteString(T("planning...") + "\n")
+	case p == nil:
+		b.WriteString(helpStyle.Render(T("p runs terraform plan here")) + "\n")
+	case p.err != nil:
+		b.WriteString(diffDelStyle.Render(T("terraform plan failed: %v", p.err)) + "\n")
+		lines := strings.Split(strings.TrimSpace(p.out), "\n")
+		if len(lines) > h-5 { lines = lines[len(lines)-max(1, h-5):] }
+		for _, l := range lines { b.WriteString(truncateCells(l, max(10, w)) + "\n") }
+	case len(p.changes) == 0:
+		b.WriteString(T("No changes. The infrastructure matches the configuration.") + "\n")
+	default:
+		b.WriteString(T("Plan: %s", p.summary()) + "\n")
+		rows := p.rows(v.open, false)
+		n := max(1, h-5)
+		start := max(0, min(v.cursor-n/2, len(rows)-n))
+		b.WriteString(m.renderTerraformRows(rows[start:min(len(rows), start+n)], v.cursor-start, w))
+	}
+	return b.String()
+}
+
+// renderTerraformRows draws plan rows, marking row cursor (-1 for none)
+func (m model) renderTerraformRows(rows []tfRow, cursor, w int) string {
+	var b strings.Builder
+	for i, r := range rows {
+		line := strings.Repeat("  ", r.depth) + r.text
+		if r.attr != nil {
+			a := r.attr
+			switch {
+			case a.before == "":
+				line = fmt.Sprintf("%s+ %s = %s", strings.Repeat("  ", r.depth), a.key, a.after)
+			case a.after == "":
+				line = fmt.Sprintf("%s- %s = %s", strings.Repeat("  ", r.depth), a.key, a.before)
+			default:
+				line = fmt.Sprintf("%s~ %s = %s -> %s", strings.Repeat("  ", r.depth), a.key, a.before, a.after)
+			}
+		}
+		line = truncateCells(line, max(10, w-2))
+		if !m.plain && r.depth < 2 { line = tfActionStyle(r.action).Render(line) }
+		marker := "  "
+		if cursor >= 0 { marker = selMarker(i == cursor) }
+		b.WriteString(marker + line + "\n")
+	}
+	return b.String()
+}
+
+// tfActionStyle colors a change the way terraform does
+func tfActionStyle(action string) lipgloss.Style {
+	switch action {
+	case "create":
+		return diffAddStyle
+	case "update":
+		return ansChangedStyle
+	case "read":
+		return helpStyle
+	}
+	return diffDelStyle
+}
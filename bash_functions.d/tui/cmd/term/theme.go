@@ -0,0 +1,90 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"golang.org/x/term"
+)
+
+// bgQueryTimeout bounds how long startup waits for the terminal to answer OSC 11
+const bgQueryTimeout = 150 * time.Millisecond
+
+// applyTheme resolves the configured theme ("auto", "dark" or "light") and sets the
+// glamour style and lipgloss adaptive colors to match.
+func (m *model) applyTheme() {
+	dark := true
+	switch m.cfg.Theme {
+	case "light":
+		dark = false
+	case "dark":
+	default:
+		dark = detectDarkBackground()
+	}
+	lipgloss.SetHasDarkBackground(dark)
+	if dark { m.mdTheme = "dark" } else { m.mdTheme = "light" }
+}
+
+// detectDarkBackground reports whether the terminal background is dark. COLORFGBG is
+// trusted when set; otherwise the terminal is asked directly. Dark is the fallback
+// for terminals that do not answer, as before.
+func detectDarkBackground() bool {
+	if v := os.Getenv("COLORFGBG"); v != "" {
+		// "15;0" or "15;default;0": the last field is the background palette index
+		parts := strings.Split(v, ";")
+		if bg, err := strconv.Atoi(parts[len(parts)-1]); err == nil { return bg < 7 || bg == 8 }
+	}
+	if r, g, b, ok := queryBackground(); ok {
+		// relative luminance, channels normalized to 0..1
+		return 0.2126*r+0.7152*g+0.0722*b < 0.5
+	}
+	return true
+}
+
+// queryBackground sends OSC 11 followed by a DA1 request to the controlling terminal.
+// Every terminal answers DA1, so its reply marks the end of the response and we do not
+// wait out the timeout on terminals that ignore OSC 11.
+func queryBackground() (r, g, b float64, ok bool) {
+	f, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil { return 0, 0, 0, false }
+	defer f.Close()
+	fd := int(f.Fd())
+	if !term.IsTerminal(fd) { return 0, 0, 0, false }
+	st, err := term.MakeRaw(fd)
+	if err != nil { return 0, 0, 0, false }
+	defer term.Restore(fd, st)
+
+	if _, err := f.WriteString("\x1b]11;?\x07\x1b[c"); err != nil { return 0, 0, 0, false }
+	deadline := time.Now().Add(bgQueryTimeout)
+	var resp []byte
+	buf := make([]byte, 64)
+	for time.Now().Before(deadline) {
+		// a tty that does not support deadlines just blocks until the DA1 reply arrives
+		_ = f.SetReadDeadline(deadline)
+		n, err := f.Read(buf)
+		resp = append(resp, buf[:n]...)
+		if err != nil || strings.Contains(string(resp), "\x1b[?") && resp[len(resp)-1] == 'c' { break }
+	}
+	return parseOSC11(string(resp))
+}
+
+// parseOSC11 extracts the color from a reply like "\x1b]11;rgb:ffff/ffff/ffff\x07"
+func parseOSC11(s string) (r, g, b float64, ok bool) {
+	i := strings.Index(s, "]11;rgb:")
+	if i < 0 { return 0, 0, 0, false }
+	s = s[i+len("]11;rgb:"):]
+	if end := strings.IndexAny(s, "\x07\x1b"); end >= 0 { s = s[:end] }
+	parts := strings.Split(s, "/")
+	if len(parts) != 3 { return 0, 0, 0, false }
+	var c [3]float64
+	for k, p := range parts {
+		v, err := strconv.ParseUint(p, 16, 16)
+		if err != nil || len(p) == 0 || len(p) > 4 { return 0, 0, 0, false }
+		// channels are 1-4 hex digits; scale by the maximum for that width
+		c[k] = float64(v) / float64(uint64(1)<<(4*uint(len(p)))-1)
+	}
+	return c[0], c[1], c[2], true
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// traceCtx is the root context of this process. It carries the session (or daemon)
+// span once tracing is set up; until then spans go to the no-op global provider.
+var traceCtx = context.Background()
+
+// setupTracing exports spans over OTLP/HTTP to the endpoint in the standard
+// OTEL_EXPORTER_OTLP_* variables and continues the trace of the process that started
+// this one (e.g. the SSH server) when TRACEPARENT is set. The returned function
+// flushes pending spans.
+func setupTracing(service string) func() {
+	exp, err := otlptracehttp.New(context.Background())
+	if err != nil { slog.Warn("tracing disabled", "err", err); return func() {} }
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exp), sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", service))))
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	traceCtx = otel.GetTextMapPropagator().Extract(context.Background(), propagation.MapCarrier{"traceparent": os.Getenv("TRACEPARENT"), "tracestate": os.Getenv("TRACESTATE")})
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := tp.Shutdown(ctx); err != nil { slog.Warn("tracing shutdown failed", "err", err) }
+	}
+}
+
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer("github.com/cbwinslow/go-term").Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// endSpan records the outcome of a command run and ends span
+func endSpan(span trace.Span, code int, err error, opts ...trace.SpanEndOption) {
+	span.SetAttributes(attribute.Int("exit_code", code))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	} else if code != 0 {
+		span.SetStatus(codes.Error, "non-zero exit")
+	}
+	span.End(opts...)
+}
+
+// traceEnv returns TRACEPARENT/TRACESTATE for ctx so agent scripts (e.g. via
+// otel-cli) can attach their own spans to the run
+func traceEnv(ctx context.Context) []string {
+	c := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, c)
+	var env []string
+	if v := c.Get("traceparent"); v != "" { env = append(env, "TRACEPARENT="+v) }
+	if v := c.Get("tracestate"); v != "" { env = append(env, "TRACESTATE="+v) }
+	return env
+}
+
+// traceJob records a finished background job as a span after the fact; the job
+// process itself outlives the session that started it
+func traceJob(j job) {
+	start, err := time.Parse(time.RFC3339, j.Started)
+	if err != nil { return }
+	_, span := otel.Tracer("github.com/cbwinslow/go-term").Start(traceCtx, "agent.job", trace.WithTimestamp(start),
+		trace.WithAttributes(attribute.String("agent", j.Agent), attribute.Bool("exec", j.Exec), attribute.String("job.id", j.ID), attribute.String("user", j.User), attribute.String("job.state", j.State)))
+	end := time.Now()
+	if t, err := time.Parse(time.RFC3339, j.Finished); err == nil { end = t }
+	endSpan(span, j.Exit, nil, trace.WithTimestamp(end))
+}
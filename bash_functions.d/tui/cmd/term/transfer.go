@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// transferTTL is how long a download/upload URL stays valid
+const transferTTL = 10 * time.Minute
+
+// maxUploadBytes caps a single upload so a session cannot fill the disk
+const maxUploadBytes = 512 << 20
+
+// transferHost returns the hostname clients should use to reach this machine.
+// TUI_PUBLIC_HOST overrides it when the host is behind NAT or a proxy.
+func transferHost() string {
+	if h := os.Getenv("TUI_PUBLIC_HOST"); h != "" { return h }
+	h, err := os.Hostname()
+	if err != nil { return "localhost" }
+	return h
+}
+
+// transferUser is the login name to put in scp one-liners
+func transferUser() string {
+	if u := os.Getenv("SSH_USER"); u != "" { return u }
+	if u, err := user.Current(); err == nil { return u.Username }
+	return os.Getenv("USER")
+}
+
+// scpCommands returns scp/sftp one-liners for fetching path from the client side
+func scpCommands(path string) string {
+	target := fmt.Sprintf("%s@%s", transferUser(), transferHost())
+	return fmt.Sprintf("Run on your machine to download %s:\n\n  scp %s:'%s' .\n  sftp %s:'%s'\n\nTo upload into %s:\n\n  scp ./FILE %s:'%s/'\n",
+		filepath.Base(path), target, shellEscape(path), target, shellEscape(path), filepath.Dir(path), target, shellEscape(filepath.Dir(path)))
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil { return "", err }
+	return hex.EncodeToString(b), nil
+}
+
+// startTransferServer listens on TUI_TRANSFER_ADDR (default all interfaces, random port)
+// and shuts the server down after ttl or when done is closed, whichever is first.
+func startTransferServer(h http.Handler, ttl time.Duration, done chan struct{}) (int, error) {
+	addr := os.Getenv("TUI_TRANSFER_ADDR")
+	if addr == "" { addr = ":0" }
+	ln, err := net.Listen("tcp", addr)
+	if err != nil { return 0, err }
+	srv := &http.Server{Handler: h, ReadHeaderTimeout: 10 * time.Second}
+	go srv.Serve(ln)
+	go func() {
+		select {
+		case <-time.After(ttl):
+		case <-done:
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(ctx)
+	}()
+	return ln.Addr().(*net.TCPAddr).Port, nil
+}
+
+// countingWriter records the status and body size of a response
+type countingWriter struct {
+	http.ResponseWriter
+	status int
+	n      int64
+}
+
+func (w *countingWriter) WriteHeader(code int) {
+	if w.status == 0 { w.status = code }
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	if w.status == 0 { w.status = http.StatusOK }
+	n, err := w.ResponseWriter.Write(b)
+	w.n += int64(n)
+	return n, err
+}
+
+// serveDownload serves a single file once under a random token URL and returns that URL.
+// Only a GET that receives the whole file spends the link: HEAD requests, range probes
+// and fetches that break off early leave it valid until the TTL.
+func serveDownload(path string) (string, error) {
+	fi, err := os.Stat(path)
+	if err != nil { return "", err }
+	if fi.IsDir() { return "", fmt.Errorf("%s is a directory", path) }
+	token, err := randomToken()
+	if err != nil { return "", err }
+	name := filepath.Base(path)
+	done := make(chan struct{})
+	var mu sync.Mutex
+	served := false
+	mux := http.NewServeMux()
+	mux.HandleFunc("/d/"+token+"/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "use GET", http.StatusMethodNotAllowed)
+			return
+		}
+		mu.Lock()
+		spent := served
+		mu.Unlock()
+		if spent { http.NotFound(w, r); return }
+		// ServeContent on the open file, unlike ServeFile, does not redirect names
+		// such as index.html
+		f, err := os.Open(path)
+		if err != nil { http.Error(w, "file no longer available", http.StatusGone); return }
+		defer f.Close()
+		st, err := f.Stat()
+		if err != nil { http.Error(w, "file no longer available", http.StatusGone); return }
+		w.Header().Set("Content-Disposition", "attachment; filename="+strconv.Quote(name))
+		cw := &countingWriter{ResponseWriter: w}
+		http.ServeContent(cw, r, name, st.ModTime(), f)
+		if r.Method != http.MethodGet || cw.status != http.StatusOK || cw.n != st.Size() { return }
+		mu.Lock()
+		first := !served
+		served = true
+		mu.Unlock()
+		if first { close(done) }
+	})
+	port, err := startTransferServer(mux, transferTTL, done)
+	if err != nil { return "", err }
+	return fmt.Sprintf("http://%s:%d/d/%s/%s", transferHost(), port, token, url.PathEscape(name)), nil
+}
+
+// receiveUploads accepts PUT/POST uploads into dir under a random token URL until the TTL
+// expires. Existing files are never overwritten.
+func receiveUploads(dir string) (string, error) {
+	token, err := randomToken()
+	if err != nil { return "", err }
+	mux := http.NewServeMux()
+	mux.HandleFunc("/u/"+token+"/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut && r.Method != http.MethodPost {
+			http.Error(w, "use PUT or POST", http.StatusMethodNotAllowed)
+			return
+		}
+		name := filepath.Base(r.URL.Path)
+		if name == "" || name == "." || name == "/" || name == token {
+			http.Error(w, "missing file name", http.StatusBadRequest)
+			return
+		}
+		f, err := os.OpenFile(filepath.Join(dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if err != nil { http.Error(w, err.Error(), http.StatusConflict); return }
+		defer f.Close()
+		n, err := io.Copy(f, http.MaxBytesReader(w, r.Body, maxUploadBytes))
+		if err != nil {
+			_ = os.Remove(f.Name())
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintf(w, "stored %s (%d bytes)\n", f.Name(), n)
+	})
+	port, err := startTransferServer(mux, transferTTL, make(chan struct{}))
+	if err != nil { return "", err }
+	return fmt.Sprintf("http://%s:%d/u/%s/", transferHost(), port, token), nil
+}
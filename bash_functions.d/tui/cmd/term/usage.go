@@ -0,0 +1,317 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// The Usage tab is a disk usage browser in the manner of ncdu: s scans a directory
+// in the background, then enter and esc move through the tree of sizes.
+
+// usageNode is a file or directory of a scan; sizes are disk usage, what du reports
+type usageNode struct {
+	name     string
+	size     int64 // of the node and everything under it
+	bytes    int64 // apparent size of a file, for finding duplicates
+	mtime    time.Time
+	items    int   // files and directories under it, itself included
+	dir      bool
+	regular  bool // a plain file, not a link or device
+	partial  bool // some of it could not be read
+	parent   *usageNode
+	children []*usageNode // largest first
+}
+
+func (n *usageNode) path() string {
+	if n.parent == nil { return n.name }
+	return filepath.Join(n.parent.path(), n.name)
+}
+
+// usageScan walks a directory tree; the counters are read by the UI while it runs
+type usageScan struct {
+	root    *usageNode
+	files   atomic.Int64
+	bytes   atomic.Int64
+	cur     atomic.Value // directory being read
+	done    atomic.Bool
+	started time.Time
+}
+
+type usageTickMsg struct{ s *usageScan }
+
+func usageTick(s *usageScan) tea.Cmd {
+	return tea.Tick(250*time.Millisecond, func(time.Time) tea.Msg { return usageTickMsg{s} })
+}
+
+// startUsageScan scans dir without leaving its filesystem; hard links are counted once
+func startUsageScan(dir string) *usageScan {
+	s := &usageScan{started: time.Now()}
+	s.cur.Store(dir)
+	go func() {
+		defer s.done.Store(true)
+		fi, err := os.Lstat(dir)
+		root := &usageNode{name: dir, dir: true, items: 1}
+		if err != nil { root.partial = true; s.root = root; return }
+		st, _ := fi.Sys().(*syscall.Stat_t)
+		var dev uint64
+		if st != nil { dev = uint64(st.Dev); root.size = st.Blocks * 512 }
+		s.walk(root, dev, map[[2]uint64]bool{})
+		s.root = root
+	}()
+	return s
+}
+
+func (s *usageScan) walk(n *usageNode, dev uint64, seen map[[2]uint64]bool) {
+	path := n.path()
+	s.cur.Store(path)
+	entries, err := os.ReadDir(path)
+	if err != nil { n.partial = true }
+	for _, e := range entries {
+		fi, err := e.Info()
+		if err != nil { n.partial = true; continue }
+		c := &usageNode{name: e.Name(), dir: fi.IsDir(), parent: n, items: 1, regular: fi.Mode().IsRegular(), bytes: fi.Size(), mtime: fi.ModTime()}
+		if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+			if st.Nlink > 1 && !fi.IsDir() {
+				key := [2]uint64{uint64(st.Dev), st.Ino}
+				if seen[key] { continue }
+				seen[key] = true
+			}
+			c.size = st.Blocks * 512
+			// mount points are listed but not entered, like du -x
+			if c.dir && uint64(st.Dev) == dev { s.walk(c, dev, seen) }
+		} else {
+			c.size = fi.Size()
+		}
+		s.files.Add(1)
+		s.bytes.Add(c.size)
+		n.size += c.size
+		n.items += c.items
+		if c.partial { n.partial = true }
+		n.children = append(n.children, c)
+	}
+	sort.Slice(n.children, func(i, j int) bool {
+		if n.children[i].size != n.children[j].size { return n.children[i].size > n.children[j].size }
+		return n.children[i].name < n.children[j].name
+	})
+}
+
+// usageView is the Usage tab
+type usageView struct {
+	scan   *usageScan
+	dir    *usageNode // directory shown
+	sel    map[*usageNode]int
+	prompt textinput.Model // s: directory to scan
+	dupes  *dupeScan       // duplicates of the scan, once D looked for them
+	showDupes bool         // the duplicate list is shown instead of the sizes
+}
+
+func newUsageView() *usageView {
+	ti := textinput.New()
+	ti.Prompt = T("scan directory: ")
+	ti.CharLimit = 4096
+	return &usageView{sel: map[*usageNode]int{}, prompt: ti}
+}
+
+func (v *usageView) selected() *usageNode {
+	if v.dir == nil || len(v.dir.children) == 0 { return nil }
+	return v.dir.children[min(v.sel[v.dir], len(v.dir.children)-1)]
+}
+
+// scanUsage starts scanning dir unless a scan is still running
+func (m *model) scanUsage(dir string) tea.Cmd {
+	v := m.usage
+	if v.scan != nil && !v.scan.done.Load() { m.status = T("still scanning"); return nil }
+	dir = filepath.Clean(expandHome(dir))
+	if fi, err := os.Stat(dir); err != nil || !fi.IsDir() { m.status = T("%s is not a directory", dir); return nil }
+	v.scan, v.dir, v.sel, v.dupes = startUsageScan(dir), nil, map[*usageNode]int{}, nil
+	return usageTick(v.scan)
+}
+
+// usageTicked shows a scan's progress, and its root once it is done
+func (m *model) usageTicked(s *usageScan) tea.Cmd {
+	v := m.usage
+	if s != v.scan { return nil }
+	if !s.done.Load() {
+		if m.tabs[m.active] == "Usage" { m.status = T("scanning %s: %d items, %s", s.cur.Load(), s.files.Load(), humanSize(s.bytes.Load())) }
+		return usageTick(s)
+	}
+	v.dir = s.root
+	m.status = T("scanned %s: %s in %d items (%s)", s.root.name, humanSize(s.root.size), s.root.items, time.Since(s.started).Round(time.Millisecond))
+	return nil
+}
+
+// updateUsageInput handles keys while the directory prompt has focus
+func (m *model) updateUsageInput(msg tea.KeyMsg) tea.Cmd {
+	v := m.usage
+	switch msg.String() {
+	case "esc":
+		v.prompt.Blur()
+		return nil
+	case "enter":
+		v.prompt.Blur()
+		return m.scanUsage(strings.TrimSpace(v.prompt.Value()))
+	}
+	var cmd tea.Cmd
+	v.prompt, cmd = v.prompt.Update(msg)
+	return cmd
+}
+
+// updateUsage handles the Usage tab keys: s scans a directory, r rescans, enter and
+// esc go down and up the tree, d deletes and x exports the scan as JSON
+func (m *model) updateUsage(key string) (tea.Cmd, bool) {
+	v := m.usage
+	switch key {
+	case "s":
+		dir := m.cwd
+		if v.scan != nil && v.scan.root != nil { dir = v.scan.root.name }
+		v.prompt.SetValue(dir)
+		v.prompt.CursorEnd()
+		return v.prompt.Focus(), true
+	case "r":
+		if v.dir == nil { return nil, true }
+		return m.scanUsage(v.scan.root.name), true
+	}
+	if v.dir == nil { return nil, false }
+	if v.showDupes { return m.updateDupes(key) }
+	n := len(v.dir.children)
+	switch key {
+	case "up", "k":
+		if v.sel[v.dir] > 0 { v.sel[v.dir]-- }
+	case "down", "j":
+		if v.sel[v.dir] < n-1 { v.sel[v.dir]++ }
+	case "enter", "right", "l":
+		if c := v.selected(); c != nil && c.dir { v.dir = c }
+	case "esc", "backspace", "left", "h":
+		if v.dir.parent != nil { v.dir = v.dir.parent }
+	case "d":
+		c := v.selected()
+		if c == nil || m.denyReadOnly() { return nil, true }
+		del := func(m *model) tea.Cmd {
+			// the duplicates found are stale now
+			if m.deleteUsageNode(c) { m.usage.dupes = nil }
+			return nil
+		}
+		if !c.dir { m.ask(T("delete %s (%s)?", c.path(), humanSize(c.size)), del); return nil, true }
+		// a whole tree needs its name typed
+		return m.askTyped(T("Delete the directory %s and everything in it?", c.name), T("%s: %s in %d entries.", c.path(), humanSize(c.size), c.items-1), c.name, del), true
+	case "x":
+		m.exportUsage()
+	case "D":
+		return m.findDupes(), true
+	default:
+		return nil, false
+	}
+	return nil, true
+}
+
+// deleteUsageNode removes a file or directory from disk and from the scan
+func (m *model) deleteUsageNode(c *usageNode) bool {
+	path := c.path()
+	err := os.RemoveAll(path)
+	appendAudit(m.auditPath, fmt.Sprintf("%s\tusage=delete\tpath=%s\tsize=%d\tuser=%s\terror=%v", time.Now().Format(time.RFC3339), path, c.size, transferUser(), err))
+	if err != nil {
+		// part of it may be gone: a rescan shows what is left
+		m.status = T("delete failed: %v (r rescans)", err)
+		slog.Warn("usage delete failed", "path", path, "err", err)
+		return false
+	}
+	p := c.parent
+	for i, s := range p.children {
+		if s == c { p.children = append(p.children[:i], p.children[i+1:]...); break }
+	}
+	for a := p; a != nil; a = a.parent { a.size -= c.size; a.items -= c.items }
+	m.status = T("deleted %s, freeing %s", path, humanSize(c.size))
+	return true
+}
+
+// usageJSON is a node of the exported scan
+type usageJSON struct {
+	Name     string      `json:"name"`
+	Size     int64       `json:"size"`
+	Items    int         `json:"items,omitempty"`
+	Partial  bool        `json:"partial,omitempty"`
+	Children []usageJSON `json:"children,omitempty"`
+}
+
+func (n *usageNode) export() usageJSON {
+	j := usageJSON{Name: n.name, Size: n.size, Partial: n.partial}
+	if n.dir { j.Items = n.items }
+	for _, c := range n.children { j.Children = append(j.Children, c.export()) }
+	return j
+}
+
+// exportUsage saves the whole scan as JSON in the output dir
+func (m *model) exportUsage() {
+	s := m.usage.scan
+	b, err := json.MarshalIndent(struct {
+		Scanned time.Time `json:"scanned"`
+		Root    usageJSON `json:"root"`
+	}{s.started, s.root.export()}, "", "  ")
+	if err == nil {
+		var path string
+		if path, err = saveOutputAs(m.cfg.OutputDir, "usage", ".json", string(b)+"\n"); err == nil { m.status = T("saved output to %s", path); return }
+	}
+	m.status = T("export failed: %v", err)
+	slog.Warn("export failed", "err", err)
+}
+
+// usageBar is a bar of width cells filled in proportion to part of whole
+func usageBar(part, whole int64, width int, plain bool) string {
+	n := 0
+	if whole > 0 { n = int(part * int64(width) / whole) }
+	if plain { return "[" + strings.Repeat("#", n) + strings.Repeat(" ", width-n) + "]" }
+	return "[" + diffAddStyle.Render(strings.Repeat("█", n)) + strings.Repeat("░", width-n) + "]"
+}
+
+// usageTabView renders the Usage tab in w x h cells
+func (m model) usageTabView(w, h int) string {
+	v := m.usage
+	var b strings.Builder
+	if v.prompt.Focused() { b.WriteString(v.prompt.View() + "\n\n") }
+	if v.dir == nil {
+		switch {
+		case v.scan != nil && !v.scan.done.Load():
+			b.WriteString(T("Scanning %s: %d items, %s", v.scan.cur.Load(), v.scan.files.Load(), humanSize(v.scan.bytes.Load())) + "\n")
+		default:
+			b.WriteString(helpStyle.Render(T("s scans a directory (the Files directory by default)")) + "\n")
+		}
+		return b.String()
+	}
+	if v.showDupes { return b.String() + m.dupesView(w, h) }
+	d := v.dir
+	hdr := T("%s  %s in %d items", d.path(), humanSize(d.size), d.items)
+	if d.partial { hdr += "  " + T("(some of it could not be read)") }
+	b.WriteString(activeTabStyle.Render(hdr) + "\n")
+	b.WriteString(helpStyle.Render(T("enter/esc: down/up • d: delete • x: export JSON • D: duplicates • s: scan another directory • r: rescan")) + "\n\n")
+	if len(d.children) == 0 { b.WriteString(T("(empty)") + "\n"); return b.String() }
+	n := max(1, h-4)
+	sel := min(v.sel[d], len(d.children)-1)
+	start := max(0, min(sel-n/2, len(d.children)-n))
+	for i := start; i < min(len(d.children), start+n); i++ {
+		c := d.children[i]
+		name := c.name
+		if c.dir { name += "/" }
+		if c.partial { name += " !" }
+		pct := 0.0
+		if d.size > 0 { pct = float64(c.size) * 100 / float64(d.size) }
+		row := fmt.Sprintf("%7s %5.1f%% %s %s", humanSize(c.size), pct, usageBar(c.size, d.size, 20, m.plain), truncateCells(name, max(10, w-40)))
+		if c.dir {
+			count := fmt.Sprintf("  %d", c.items-1)
+			if !m.plain { count = helpStyle.Render(count) }
+			row += count
+		}
+		b.WriteString(selMarker(i == sel) + row + "\n")
+	}
+	return b.String()
+}
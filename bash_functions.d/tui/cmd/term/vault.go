@@ -0,0 +1,357 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"filippo.io/age"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// The vault keeps API tokens and other credentials in vault.age, one JSON document
+// encrypted with age under a master passphrase. The Vault tab unlocks it for the rest
+// of the session; agents name the entries they need under "secrets" in the manifest
+// and get them as environment variables when they start.
+
+// vaultEntry is one secret
+type vaultEntry struct {
+	Name    string `json:"name"`
+	Value   string `json:"value"`
+	Notes   string `json:"notes,omitempty"`
+	Updated string `json:"updated"`
+}
+
+var errVaultLocked = errors.New("vault is locked")
+
+// vaultSession holds the passphrase and entries once the vault is unlocked
+var vaultSession struct {
+	sync.Mutex
+	pass    string
+	entries []vaultEntry
+}
+
+func vaultPath() string { return filepath.Join(tuiDataDir(), "vault.age") }
+
+// loadVault decrypts the vault; an absent vault is empty
+func loadVault(pass string) ([]vaultEntry, error) {
+	b, err := ioutil.ReadFile(vaultPath())
+	if os.IsNotExist(err) { return nil, nil }
+	if err != nil { return nil, err }
+	id, err := age.NewScryptIdentity(pass)
+	if err != nil { return nil, err }
+	r, err := age.Decrypt(bytes.NewReader(b), id)
+	if err != nil { return nil, errors.New(T("wrong passphrase, or the vault is damaged")) }
+	plain, err := ioutil.ReadAll(r)
+	if err != nil { return nil, err }
+	var es []vaultEntry
+	if err := json.Unmarshal(plain, &es); err != nil { return nil, fmt.Errorf("%s: %v", vaultPath(), err) }
+	return es, nil
+}
+
+func saveVault(pass string, es []vaultEntry) error {
+	sort.Slice(es, func(i, j int) bool { return strings.ToLower(es[i].Name) < strings.ToLower(es[j].Name) })
+	plain, err := json.Marshal(es)
+	if err != nil { return err }
+	rcpt, err := age.NewScryptRecipient(pass)
+	if err != nil { return err }
+	var buf bytes.Buffer
+	w, err := age.Encrypt(&buf, rcpt)
+	if err != nil { return err }
+	if _, err := w.Write(plain); err != nil { return err }
+	if err := w.Close(); err != nil { return err }
+	if err := os.MkdirAll(tuiDataDir(), 0o700); err != nil { return err }
+	tmp := vaultPath() + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf.Bytes(), 0o600); err != nil { return err }
+	return os.Rename(tmp, vaultPath())
+}
+
+// unlockVault checks pass against the vault and keeps it for the session
+func unlockVault(pass string) error {
+	es, err := loadVault(pass)
+	if err != nil { return err }
+	vaultSession.Lock()
+	vaultSession.pass, vaultSession.entries = pass, es
+	vaultSession.Unlock()
+	return nil
+}
+
+func lockVault() {
+	vaultSession.Lock()
+	vaultSession.pass, vaultSession.entries = "", nil
+	vaultSession.Unlock()
+}
+
+// vaultEntries returns the entries of the unlocked vault, or nil while it is locked
+func vaultEntries() ([]vaultEntry, bool) {
+	vaultSession.Lock()
+	defer vaultSession.Unlock()
+	if vaultSession.pass == "" { return nil, false }
+	return append([]vaultEntry(nil), vaultSession.entries...), true
+}
+
+// changeVault applies fn to the entries under the vault lock and saves them; the
+// vault is read again first, in case another session changed it
+func changeVault(fn func([]vaultEntry) ([]vaultEntry, error)) error {
+	vaultSession.Lock()
+	pass := vaultSession.pass
+	vaultSession.Unlock()
+	if pass == "" { return errVaultLocked }
+	return withLock("vault", func() error {
+		es, err := loadVault(pass)
+		if err != nil { return err }
+		if es, err = fn(es); err != nil { return err }
+		if err := saveVault(pass, es); err != nil { return err }
+		vaultSession.Lock()
+		vaultSession.entries = es
+		vaultSession.Unlock()
+		return nil
+	})
+}
+
+// putVaultEntry adds e, or replaces the entry named old when editing
+func putVaultEntry(old string, e vaultEntry) error {
+	return changeVault(func(es []vaultEntry) ([]vaultEntry, error) {
+		next := []vaultEntry{}
+		for _, x := range es {
+			if x.Name == old && old != "" { continue }
+			if x.Name == e.Name { return nil, errors.New(T("an entry named %s exists", e.Name)) }
+			next = append(next, x)
+		}
+		e.Updated = time.Now().Format(time.RFC3339)
+		return append(next, e), nil
+	})
+}
+
+func dropVaultEntry(name string) error {
+	return changeVault(func(es []vaultEntry) ([]vaultEntry, error) {
+		next := []vaultEntry{}
+		for _, x := range es { if x.Name != name { next = append(next, x) } }
+		return next, nil
+	})
+}
+
+// runSecretEnv is agentSecretEnv for one run. Only exec runs get the secrets, and
+// callers start those once the grant check has passed; with a broker, the broker adds
+// them after its own check, so the client's runs get none.
+func runSecretEnv(agent string, execFlag bool) []string {
+	if !execFlag || brokerSocket() != "" { return nil }
+	return agentSecretEnv(agent)
+}
+
+// agentSecretEnv resolves the manifest secrets of agent to VAR=value pairs. They come
+// from the vault unlocked in this session, or, for the scheduler and other services,
+// from the vault opened with $CBW_VAULT_PASSPHRASE. A secret that cannot be resolved
+// is left unset and logged.
+func agentSecretEnv(agent string) []string {
+	mf, err := loadManifest()
+	if err != nil { return nil }
+	a, ok := mf.agent(agent)
+	if !ok || len(a.Secrets) == 0 { return nil }
+	es, ok := vaultEntries()
+	if !ok {
+		pass := os.Getenv("CBW_VAULT_PASSPHRASE")
+		if pass == "" { slog.Warn("agent secrets not set: vault is locked", "agent", agent); return nil }
+		if es, err = loadVault(pass); err != nil { slog.Warn("agent secrets not set", "agent", agent, "err", err); return nil }
+	}
+	byName := map[string]string{}
+	for _, e := range es { byName[e.Name] = e.Value }
+	keys := make([]string, 0, len(a.Secrets))
+	for k := range a.Secrets { keys = append(keys, k) }
+	sort.Strings(keys)
+	var env []string
+	for _, k := range keys {
+		v, ok := byName[a.Secrets[k]]
+		if !envName.MatchString(k) || !ok { slog.Warn("agent secret not set", "agent", agent, "variable", k, "entry", a.Secrets[k]); continue }
+		env = append(env, k+"="+v)
+	}
+	return env
+}
+
+// vaultView is the Vault tab
+type vaultView struct {
+	sel      int
+	shown    map[string]bool // entries revealed, by name
+	prompt   textinput.Model // master passphrase
+	creating string          // first passphrase when creating the vault, awaiting the repeat
+	form     *vaultForm
+}
+
+func newVaultView() *vaultView {
+	ti := textinput.New()
+	ti.Prompt = T("passphrase: ")
+	ti.EchoMode = textinput.EchoPassword
+	ti.CharLimit = 200
+	return &vaultView{shown: map[string]bool{}, prompt: ti}
+}
+
+// vaultForm adds or edits one entry
+type vaultForm struct {
+	fields []textinput.Model
+	focus  int
+	name   string // entry being edited; "" when adding
+}
+
+var vaultFieldNames = []string{"name", "value", "notes"}
+
+func (m *model) openVaultForm(e vaultEntry, editing bool) tea.Cmd {
+	f := &vaultForm{}
+	if editing { f.name = e.Name }
+	for i, v := range []string{e.Name, e.Value, e.Notes} {
+		ti := textinput.New()
+		ti.Prompt = fmt.Sprintf("%-8s", T(vaultFieldNames[i])+": ")
+		ti.CharLimit = 4096
+		ti.Width = 60
+		ti.SetValue(v)
+		f.fields = append(f.fields, ti)
+	}
+	f.fields[1].EchoMode = textinput.EchoPassword
+	f.fields[0].Placeholder = T("e.g. openai, referenced by agents")
+	m.vault.form = f
+	return f.fields[0].Focus()
+}
+
+// updateVaultInput handles keys while the passphrase prompt or the entry form is open
+func (m *model) updateVaultInput(msg tea.KeyMsg) tea.Cmd {
+	v := m.vault
+	if f := v.form; f != nil {
+		switch msg.String() {
+		case "esc":
+			v.form = nil
+			m.status = T("cancelled")
+			return nil
+		case "tab", "down", "shift+tab", "up":
+			f.fields[f.focus].Blur()
+			if msg.String() == "tab" || msg.String() == "down" { f.focus = (f.focus + 1) % len(f.fields) } else { f.focus = (f.focus - 1 + len(f.fields)) % len(f.fields) }
+			return f.fields[f.focus].Focus()
+		case "enter":
+			e := vaultEntry{Name: strings.TrimSpace(f.fields[0].Value()), Value: f.fields[1].Value(), Notes: strings.TrimSpace(f.fields[2].Value())}
+			var err error
+			if e.Name == "" { err = errors.New(T("an entry needs a name")) } else { err = putVaultEntry(f.name, e) }
+			if err != nil { m.status = T("not saved: %v", err); slog.Warn("vault entry not saved", "entry", e.Name, "err", err); return nil }
+			v.form = nil
+			m.status = T("saved %s", e.Name)
+			return nil
+		}
+		var cmd tea.Cmd
+		f.fields[f.focus], cmd = f.fields[f.focus].Update(msg)
+		return cmd
+	}
+	switch msg.String() {
+	case "esc":
+		v.prompt.Blur()
+		v.prompt.SetValue("")
+		v.creating = ""
+		return nil
+	case "enter":
+		pass := v.prompt.Value()
+		v.prompt.SetValue("")
+		if pass == "" { return nil }
+		if _, err := os.Stat(vaultPath()); os.IsNotExist(err) {
+			// a new vault takes the passphrase twice
+			if v.creating == "" { v.creating = pass; m.status = T("repeat the passphrase"); return nil }
+			if pass != v.creating { v.creating = ""; m.status = T("the passphrases differ; try again"); return nil }
+			v.creating = ""
+			if err := withLock("vault", func() error { return saveVault(pass, nil) }); err != nil { m.status = T("cannot create the vault: %v", err); slog.Warn("vault create failed", "err", err); return nil }
+		}
+		if err := unlockVault(pass); err != nil { m.status = T("cannot unlock: %v", err); return nil }
+		v.prompt.Blur()
+		m.status = T("vault unlocked for this session")
+		return nil
+	}
+	var cmd tea.Cmd
+	v.prompt, cmd = v.prompt.Update(msg)
+	return cmd
+}
+
+// selectedVaultEntry is the entry under the cursor of the unlocked vault
+func (m *model) selectedVaultEntry() (vaultEntry, bool) {
+	es, ok := vaultEntries()
+	if !ok || m.vault.sel >= len(es) { return vaultEntry{}, false }
+	return es[m.vault.sel], true
+}
+
+// updateVault handles the Vault tab keys: enter unlocks, then r reveals the selected
+// entry, y copies it, n/e/x add, edit and remove entries and L locks the vault
+func (m *model) updateVault(key string) (tea.Cmd, bool) {
+	v := m.vault
+	es, unlocked := vaultEntries()
+	if !unlocked {
+		if key != "enter" { return nil, false }
+		return v.prompt.Focus(), true
+	}
+	sel, ok := m.selectedVaultEntry()
+	switch key {
+	case "up", "k":
+		if v.sel > 0 { v.sel-- }
+	case "down", "j":
+		if v.sel < len(es)-1 { v.sel++ }
+	case "r", "enter":
+		if ok { v.shown[sel.Name] = !v.shown[sel.Name] }
+	case "n":
+		if !m.denyReadOnly() { return m.openVaultForm(vaultEntry{}, false), true }
+	case "e":
+		if ok && !m.denyReadOnly() { return m.openVaultForm(sel, true), true }
+	case "x":
+		if !ok || m.denyReadOnly() { return nil, true }
+		m.ask(T("remove %s from the vault?", sel.Name), func(m *model) tea.Cmd {
+			if err := dropVaultEntry(sel.Name); err != nil { m.status = T("cannot remove %s: %v", sel.Name, err); slog.Warn("vault entry not removed", "entry", sel.Name, "err", err); return nil }
+			if m.vault.sel > 0 && m.vault.sel >= len(es)-1 { m.vault.sel-- }
+			m.status = T("removed %s", sel.Name)
+			return nil
+		})
+	case "L":
+		lockVault()
+		v.shown = map[string]bool{}
+		m.status = T("vault locked")
+	default:
+		return nil, false
+	}
+	return nil, true
+}
+
+// vaultTabView is the Vault tab: the passphrase prompt while locked, else the entries
+func (m model) vaultTabView() string {
+	v := m.vault
+	if v.form != nil {
+		title := T("New entry")
+		if v.form.name != "" { title = T("Edit %s", v.form.name) }
+		var b strings.Builder
+		b.WriteString(lipgloss.NewStyle().Bold(true).Render(title) + "\n\n")
+		for _, ti := range v.form.fields { b.WriteString(ti.View() + "\n") }
+		b.WriteString("\n" + helpStyle.Render(T("tab/shift+tab: next/previous field • enter: save • esc: cancel")))
+		return b.String()
+	}
+	es, unlocked := vaultEntries()
+	if !unlocked {
+		_, err := os.Stat(vaultPath())
+		msg := T("The vault is locked. enter: type the master passphrase")
+		if os.IsNotExist(err) { msg = T("There is no vault yet. enter: choose a master passphrase") }
+		if v.prompt.Focused() { return msg + "\n\n" + v.prompt.View() + "\n" }
+		return msg + "\n"
+	}
+	if len(es) == 0 { return T("The vault is empty; n adds an entry.") + "\n\n" + helpStyle.Render(T("L: lock")) }
+	var b strings.Builder
+	nameW := 4
+	for _, e := range es { nameW = max(nameW, len(e.Name)) }
+	for i, e := range es {
+		val := strings.Repeat("•", 12)
+		if v.shown[e.Name] { val = e.Value }
+		line := fmt.Sprintf("%-*s  %s", nameW, e.Name, val)
+		if e.Notes != "" { line += "  " + helpStyle.Render(e.Notes) }
+		b.WriteString(selMarker(i == v.sel) + line + "\n")
+	}
+	b.WriteString("\n" + helpStyle.Render(T("r: reveal • y: copy • n/e/x: add/edit/remove • L: lock")))
+	return b.String()
+}
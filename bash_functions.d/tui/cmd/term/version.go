@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// set at build time, e.g.
+//   go build -ldflags "-X main.version=v1.2.0 -X main.commit=$(git rev-parse --short HEAD) -X main.date=$(date -u +%FT%TZ)" ./cmd/term
+var (
+	version = "dev"
+	commit  = ""
+	date    = ""
+)
+
+// buildInfo returns version, commit and date, filling the latter two from the VCS
+// stamp Go records in the binary when they were not set with -ldflags
+func buildInfo() (v, c, d string) {
+	v, c, d = version, commit, date
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if c == "" && len(s.Value) >= 12 { c = s.Value[:12] } else if c == "" { c = s.Value }
+			case "vcs.time":
+				if d == "" { d = s.Value }
+			case "vcs.modified":
+				if s.Value == "true" && c != "" && !strings.HasSuffix(c, "-dirty") { c += "-dirty" }
+			}
+		}
+	}
+	return v, c, d
+}
+
+// versionString is the one-line --version output
+func versionString() string {
+	v, c, d := buildInfo()
+	s := "term " + v
+	if c != "" { s += " (" + c + ")" }
+	if d != "" { s += " built " + d }
+	return s + fmt.Sprintf(" %s %s/%s", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
+
+// aboutText is shown by the About panel
+func aboutText() string {
+	v, c, d := buildInfo()
+	if c == "" { c = "-" }
+	if d == "" { d = "-" }
+	var b strings.Builder
+	b.WriteString(T("About") + "\n\n")
+	fmt.Fprintf(&b, "  %-10s %s\n", T("version"), v)
+	fmt.Fprintf(&b, "  %-10s %s\n", T("commit"), c)
+	fmt.Fprintf(&b, "  %-10s %s\n", T("built"), d)
+	fmt.Fprintf(&b, "  %-10s %s %s/%s\n", "go", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	fmt.Fprintf(&b, "  %-10s %s\n", T("data"), tuiDataDir())
+	fmt.Fprintf(&b, "\n%s\n", T("Update with `cbw self-update`."))
+	return b.String()
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// vimState is the vim keybinding profile ("keys": "vim" in config.json); the model's
+// vim field is nil with the default keys
+type vimState struct {
+	insert  bool   // editor is in insert mode; otherwise normal mode
+	pending string // first key of a two-key command: "g" or "d"
+	prompt  textinput.Model
+	kind    string // what the prompt is for: "/" (find) or ":" (editor command)
+	find    string // last search pattern, repeated with n/N
+}
+
+func newVimState() *vimState {
+	ti := textinput.New()
+	ti.CharLimit = 256
+	return &vimState{prompt: ti}
+}
+
+// vimListKeys maps vim motions onto the keys lists and viewports already understand
+var vimListKeys = map[string]tea.KeyType{
+	"h": tea.KeyLeft, "j": tea.KeyDown, "k": tea.KeyUp, "l": tea.KeyRight, "G": tea.KeyEnd,
+	"ctrl+d": tea.KeyPgDown, "ctrl+u": tea.KeyPgUp,
+}
+
+// vimTranslate rewrites vim motions outside the editor into arrow/paging keys; gg
+// needs two presses. ok is false when the key was swallowed (the first g).
+func (v *vimState) vimTranslate(msg tea.KeyMsg) (tea.KeyMsg, bool) {
+	k := msg.String()
+	if v.pending == "g" {
+		v.pending = ""
+		if k == "g" { return tea.KeyMsg{Type: tea.KeyHome}, true }
+	}
+	if k == "g" { v.pending = "g"; return msg, false }
+	if t, ok := vimListKeys[k]; ok { return tea.KeyMsg{Type: t}, true }
+	return msg, true
+}
+
+// vimNavKey handles vim keys outside the editor. The Preview scrolls and searches
+// here; lists get the key rewritten into one they already understand. done is true
+// when nothing is left to do with the key.
+func (m *model) vimNavKey(msg tea.KeyMsg) (out tea.KeyMsg, cmd tea.Cmd, done bool) {
+	if m.tabs[m.active] == "Preview" && !m.tocOpen {
+		switch msg.String() {
+		case "/":
+			return msg, m.openVimPrompt("/"), true
+		case "n":
+			m.vimFind(1)
+			return msg, nil, true
+		case "N":
+			m.vimFind(-1)
+			return msg, nil, true
+		}
+	}
+	out, ok := m.vim.vimTranslate(msg)
+	if !ok { return out, nil, true }
+	if m.tabs[m.active] != "Preview" || m.tocOpen { return out, nil, false }
+	switch out.Type {
+	case tea.KeyHome:
+		m.vp.GotoTop()
+	case tea.KeyEnd:
+		m.vp.GotoBottom()
+	case tea.KeyPgDown:
+		m.vp.HalfViewDown()
+	case tea.KeyPgUp:
+		m.vp.HalfViewUp()
+	default:
+		return out, nil, false
+	}
+	return out, nil, true
+}
+
+// listFiltering reports whether any list is taking filter text, which vim keys must not touch
+func (m *model) listFiltering() bool {
+	for _, l := range []*list.Model{&m.list, &m.agentsList, &m.requestsList, &m.pluginsList, &m.jobsList, &m.tocList, &m.searchList, &m.muxList, &m.hostsList, &m.tagsList, &m.adminList, &m.connList} {
+		if l.FilterState() == list.Filtering { return true }
+	}
+	return false
+}
+
+// openVimPrompt starts a "/" search or ":" command line
+func (m *model) openVimPrompt(kind string) tea.Cmd {
+	m.vim.kind = kind
+	m.vim.prompt.Prompt = kind
+	m.vim.prompt.SetValue("")
+	m.ta.Blur()
+	return m.vim.prompt.Focus()
+}
+
+// updateVimPrompt handles keys while the "/" or ":" prompt has focus
+func (m *model) updateVimPrompt(msg tea.KeyMsg) tea.Cmd {
+	v := m.vim
+	switch msg.String() {
+	case "esc":
+		v.prompt.Blur()
+		if m.tabs[m.active] == "Editor" { return m.ta.Focus() }
+		return nil
+	case "enter":
+		text := v.prompt.Value()
+		v.prompt.Blur()
+		var cmd tea.Cmd
+		if m.tabs[m.active] == "Editor" { cmd = m.ta.Focus() }
+		if v.kind == ":" { return tea.Batch(cmd, m.vimCommand(strings.TrimSpace(text))) }
+		if text != "" { v.find = text }
+		m.vimFind(1)
+		return cmd
+	}
+	var cmd tea.Cmd
+	v.prompt, cmd = v.prompt.Update(msg)
+	return cmd
+}
+
+// vimCommand runs an editor command line: :w, :q, :wq, :x or a line number
+func (m *model) vimCommand(c string) tea.Cmd {
+	if n, err := strconv.Atoi(c); err == nil {
+		editorGoto(&m.ta, n, 1)
+		return nil
+	}
+	switch c {
+	case "w":
+		m.saveEditor()
+	case "wq", "x":
+		if !m.saveEditor() { return nil }
+		m.active = 0
+	case "q", "q!":
+		m.active = 0
+		m.status = T("exited editor")
+	case "":
+	default:
+		m.status = T("unknown command: %s", c)
+	}
+	return nil
+}
+
+// vimFind moves to the next (dir 1) or previous (dir -1) line containing the last
+// pattern: in the editor from the cursor, in the Preview from the top visible line
+func (m *model) vimFind(dir int) {
+	pat := m.vim.find
+	if pat == "" { return }
+	var lines []string
+	var from int
+	inEditor := m.tabs[m.active] == "Editor"
+	if inEditor {
+		lines = strings.Split(m.ta.Value(), "\n")
+		from = m.ta.Line()
+	} else {
+		lines = strings.Split(ansiEscape.ReplaceAllString(m.shownContent(), ""), "\n")
+		from = m.vp.YOffset
+	}
+	for i := 1; i <= len(lines); i++ {
+		l := ((from+dir*i)%len(lines) + len(lines)) % len(lines)
+		c := strings.Index(lines[l], pat)
+		if c < 0 { continue }
+		if inEditor { editorGoto(&m.ta, l+1, len([]rune(lines[l][:c]))+1) } else { m.vp.SetYOffset(l) }
+		m.status = T("/%s: line %d", pat, l+1)
+		return
+	}
+	m.status = T("pattern not found: %s", pat)
+}
+
+// vimEditorKey is the modal editor. In insert mode typed text goes straight to the
+// textarea, bypassing the single-key shortcuts of other tabs; in normal mode keys are
+// commands. ok is false for keys left to the usual Editor handling (ctrl+s, alt+...).
+func (m *model) vimEditorKey(msg tea.KeyMsg) (tea.Cmd, bool) {
+	v := m.vim
+	k := msg.String()
+	if v.insert {
+		if k == "esc" { v.insert = false; m.status = ""; return nil, true }
+		if msg.Type == tea.KeyRunes && !msg.Alt || k == "enter" || k == "backspace" || k == " " {
+			if m.editorRO { m.status = T("read-only: %s (alt+w to edit)", filepath.Base(m.editorFile)); return nil, true }
+			var cmd tea.Cmd
+			m.ta, cmd = m.ta.Update(msg)
+			return cmd, true
+		}
+		return nil, false
+	}
+
+	if v.pending != "" {
+		p := v.pending
+		v.pending = ""
+		switch p + k {
+		case "gg":
+			editorGoto(&m.ta, 1, 1)
+		case "dd":
+			if !m.editorRO { m.deleteEditorLine() }
+		}
+		return nil, true
+	}
+	_, col := editorCursor(m.ta)
+	edit := func(f func()) {
+		if m.editorRO { m.status = T("read-only: %s (alt+w to edit)", filepath.Base(m.editorFile)); return }
+		f()
+	}
+	switch k {
+	case "h", "left", "backspace":
+		if col > 0 { m.ta.SetCursor(col - 1) }
+	case "l", "right", " ":
+		m.ta.SetCursor(col + 1)
+	case "j", "down", "enter":
+		m.ta.CursorDown()
+	case "k", "up":
+		m.ta.CursorUp()
+	case "0", "home":
+		m.ta.CursorStart()
+	case "$", "end":
+		m.ta.CursorEnd()
+	case "w", "b":
+		dir := tea.KeyRight
+		if k == "b" { dir = tea.KeyLeft }
+		m.ta, _ = m.ta.Update(tea.KeyMsg{Type: dir, Alt: true})
+	case "G":
+		editorGoto(&m.ta, m.ta.LineCount(), 1)
+	case "ctrl+d", "ctrl+u":
+		half := m.ta.Height() / 2
+		if half < 1 { half = 1 }
+		for i := 0; i < half; i++ { if k == "ctrl+d" { m.ta.CursorDown() } else { m.ta.CursorUp() } }
+	case "g", "d":
+		v.pending = k
+	case "x", "delete":
+		edit(func() { m.ta, _ = m.ta.Update(tea.KeyMsg{Type: tea.KeyDelete}) })
+	case "i", "a", "A", "I", "o", "O":
+		edit(func() {
+			switch k {
+			case "a":
+				m.ta.SetCursor(col + 1)
+			case "A":
+				m.ta.CursorEnd()
+			case "I":
+				m.ta.CursorStart()
+			case "o":
+				m.ta.CursorEnd()
+				m.ta.InsertString("\n")
+			case "O":
+				m.ta.CursorStart()
+				m.ta.InsertString("\n")
+				m.ta.CursorUp()
+			}
+			v.insert = true
+		})
+	case "/", ":":
+		return m.openVimPrompt(k), true
+	case "n":
+		m.vimFind(1)
+	case "N":
+		m.vimFind(-1)
+	case "esc":
+	default:
+		// leave ctrl/alt commands and tab to the usual handling; swallow other text
+		if msg.Type == tea.KeyRunes && !msg.Alt { return nil, true }
+		return nil, false
+	}
+	return nil, true
+}
+
+// shownContent is the viewport text as laid out, so search hits map to viewport lines
+func (m model) shownContent() string {
+	if m.md != nil { return m.vpContent }
+	text := strings.ReplaceAll(m.vpContent, "\t", "    ")
+	if m.vpScroll { return text } // cutting columns keeps the lines
+	w := m.vp.Width
+	if w < 1 { w = 1 }
+	return wrapColumns(text, w)
+}
+
+// deleteEditorLine removes the cursor line, like vim's dd
+func (m *model) deleteEditorLine() {
+	lines := strings.Split(m.ta.Value(), "\n")
+	row := m.ta.Line()
+	if row >= len(lines) { return }
+	lines = append(lines[:row], lines[row+1:]...)
+	m.ta.SetValue(strings.Join(lines, "\n"))
+	if row >= len(lines) { row = len(lines) - 1 }
+	editorGoto(&m.ta, row+1, 1)
+}
+
+// vimModeLine is shown under the editor in the vim profile
+func (m model) vimModeLine() string {
+	if m.vim.prompt.Focused() { return m.vim.prompt.View() }
+	if m.vim.insert { return helpStyle.Render(T("-- INSERT --")) }
+	return helpStyle.Render(T("-- NORMAL --"))
+}
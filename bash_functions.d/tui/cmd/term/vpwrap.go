@@ -0,0 +1,116 @@
+package main
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// hScrollStep is how many columns left/right scroll the Preview in scroll mode
+const hScrollStep = 8
+
+// layoutContent puts vpContent into the viewport, wrapped to its width or, in scroll
+// mode, cut to the visible columns. Markdown is left alone: glamour wraps it already.
+func (m *model) layoutContent() {
+	if m.md != nil { return }
+	w := m.vp.Width
+	if w < 1 { w = 1 }
+	text := strings.ReplaceAll(m.vpContent, "\t", "    ")
+	m.vpCols = 0
+	for _, l := range strings.Split(text, "\n") { if n := visibleLen(l); n > m.vpCols { m.vpCols = n } }
+	off := m.vp.YOffset
+	if m.vpScroll {
+		if m.vpX > m.vpCols-w { m.vpX = m.vpCols - w }
+		if m.vpX < 0 { m.vpX = 0 }
+		m.vp.SetContent(cutColumns(text, m.vpX, w))
+	} else {
+		m.vp.SetContent(wrapColumns(text, w))
+	}
+	m.vp.SetYOffset(off)
+}
+
+// toggleWrap switches the viewport between wrapping long lines and scrolling sideways
+func (m *model) toggleWrap() {
+	m.vpScroll = !m.vpScroll
+	m.vpX = 0
+	m.layoutContent()
+	if m.vpScroll { m.status = T("long lines: scroll (left/right)") } else { m.status = T("long lines: wrap") }
+}
+
+func (m *model) scrollColumns(delta int) {
+	if !m.vpScroll { return }
+	m.vpX += delta
+	m.layoutContent()
+}
+
+// columnIndicator shows which columns are visible in scroll mode, e.g. "cols 9-88 of 240"
+func (m model) columnIndicator() string {
+	if !m.vpScroll || m.md != nil { return "" }
+	last := m.vpX + m.vp.Width
+	if last > m.vpCols { last = m.vpCols }
+	return T("cols %d-%d of %d", m.vpX+1, last, m.vpCols)
+}
+
+// ansiSeqLen returns the length of the CSI escape sequence at the start of s, or 0
+func ansiSeqLen(s string) int {
+	if len(s) < 2 || s[0] != '\x1b' || s[1] != '[' { return 0 }
+	for i := 2; i < len(s); i++ {
+		if s[i] >= 0x40 && s[i] <= 0x7e { return i + 1 }
+	}
+	return len(s)
+}
+
+// visibleLen counts the runes of s outside escape sequences; every rune is taken to
+// be one column wide
+func visibleLen(s string) int {
+	n := 0
+	for i := 0; i < len(s); {
+		if k := ansiSeqLen(s[i:]); k > 0 { i += k; continue }
+		_, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+		n++
+	}
+	return n
+}
+
+// cutColumns keeps columns [x, x+w) of every line. Escape sequences outside the
+// window are kept so colors carry over into it.
+func cutColumns(s string, x, w int) string {
+	lines := strings.Split(s, "\n")
+	for li, l := range lines {
+		var b strings.Builder
+		col := 0
+		for i := 0; i < len(l); {
+			if k := ansiSeqLen(l[i:]); k > 0 { b.WriteString(l[i : i+k]); i += k; continue }
+			_, size := utf8.DecodeRuneInString(l[i:])
+			if col >= x && col < x+w { b.WriteString(l[i : i+size]) }
+			i += size
+			col++
+		}
+		lines[li] = b.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// wrapColumns breaks lines longer than w columns, at the last space that fits when
+// there is one
+func wrapColumns(s string, w int) string {
+	var out []string
+	for _, l := range strings.Split(s, "\n") {
+		for visibleLen(l) > w {
+			cut, lastSpace, col := len(l), -1, 0
+			for i := 0; i < len(l); {
+				if k := ansiSeqLen(l[i:]); k > 0 { i += k; continue }
+				if col == w { cut = i; break }
+				r, size := utf8.DecodeRuneInString(l[i:])
+				if r == ' ' { lastSpace = i }
+				i += size
+				col++
+			}
+			if lastSpace > 0 { cut = lastSpace + 1 }
+			out = append(out, strings.TrimRight(l[:cut], " "))
+			l = l[cut:]
+		}
+		out = append(out, l)
+	}
+	return strings.Join(out, "\n")
+}
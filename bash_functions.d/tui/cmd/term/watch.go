@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchRule is one entry in watch_rules.json: files matching Glob run Agent
+type watchRule struct {
+	Name   string   `json:"name"`
+	Glob   string   `json:"glob"` // e.g. "~/inbox/*.pdf"; only the file name may hold wildcards
+	Agent  string   `json:"agent"`
+	Exec   bool     `json:"exec,omitempty"`   // pass --exec to the runner (dry-run otherwise)
+	Events []string `json:"events,omitempty"` // create (default), write, remove, rename
+	Settle string   `json:"settle,omitempty"` // quiet time before running, so a file being copied in is complete (default 2s)
+
+	dir, pattern string
+	settle       time.Duration
+}
+
+func watchRulesPath() string { return filepath.Join(tuiDataDir(), "watch_rules.json") }
+
+// loadWatchRules reads and checks the rules file; a missing file is no rules
+func loadWatchRules(path string) ([]watchRule, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) { return nil, nil }
+		return nil, err
+	}
+	var rules []watchRule
+	if err := json.Unmarshal(b, &rules); err != nil { return nil, fmt.Errorf("%s: %w", path, err) }
+	mf, _ := loadManifest()
+	for i := range rules {
+		r := &rules[i]
+		if r.Name == "" { r.Name = fmt.Sprintf("rule-%d", i+1) }
+		glob := expandHome(r.Glob)
+		r.dir, r.pattern = filepath.Dir(glob), filepath.Base(glob)
+		if r.Glob == "" || !filepath.IsAbs(glob) { return nil, fmt.Errorf("rule %s: glob must be an absolute path", r.Name) }
+		if strings.ContainsAny(r.dir, "*?[") { return nil, fmt.Errorf("rule %s: only the file name may hold wildcards", r.Name) }
+		if _, err := filepath.Match(r.pattern, ""); err != nil { return nil, fmt.Errorf("rule %s: %w", r.Name, err) }
+		if r.Agent == "" { return nil, fmt.Errorf("rule %s: no agent", r.Name) }
+		if _, ok := mf.agent(r.Agent); len(mf.Agents) > 0 && !ok { return nil, fmt.Errorf("rule %s: agent %s is not in the manifest", r.Name, r.Agent) }
+		if len(r.Events) == 0 { r.Events = []string{"create"} }
+		for _, e := range r.Events {
+			if watchOps[e] == 0 { return nil, fmt.Errorf("rule %s: unknown event %q", r.Name, e) }
+		}
+		r.settle = 2 * time.Second
+		if r.Settle != "" {
+			if r.settle, err = time.ParseDuration(r.Settle); err != nil || r.settle < 0 { return nil, fmt.Errorf("rule %s: invalid settle %q", r.Name, r.Settle) }
+		}
+	}
+	return rules, nil
+}
+
+var watchOps = map[string]fsnotify.Op{"create": fsnotify.Create, "write": fsnotify.Write, "remove": fsnotify.Remove, "rename": fsnotify.Rename}
+
+// matches reports the rule event that ev fires, if any
+func (r watchRule) matches(ev fsnotify.Event) (string, bool) {
+	if filepath.Dir(ev.Name) != r.dir { return "", false }
+	if ok, _ := filepath.Match(r.pattern, filepath.Base(ev.Name)); !ok { return "", false }
+	for _, e := range r.Events { if ev.Op&watchOps[e] != 0 { return e, true } }
+	return "", false
+}
+
+// watchPending is a matched file waiting for its rule's settle time
+type watchPending struct {
+	rule  watchRule
+	event string
+	due   time.Time
+}
+
+// watcher runs rules on the files fsnotify reports. Every event on a pending file
+// pushes its run back, so a file still being written is only handled once it is quiet.
+type watcher struct {
+	fs        *fsnotify.Watcher
+	rulesPath string
+	auditPath string
+	rules     []watchRule
+	dirs      map[string]bool
+	pending   map[string]*watchPending // by rule name and path
+}
+
+// load (re)reads the rules and watches their directories; bad rules keep the old set
+func (w *watcher) load() error {
+	rules, err := loadWatchRules(w.rulesPath)
+	if err != nil { return err }
+	want := map[string]bool{}
+	for _, r := range rules { want[r.dir] = true }
+	for d := range w.dirs {
+		// the rules file's own directory stays watched for reloads
+		if !want[d] && d != filepath.Dir(w.rulesPath) { w.fs.Remove(d); delete(w.dirs, d) }
+	}
+	for d := range want {
+		if w.dirs[d] { continue }
+		if err := w.fs.Add(d); err != nil { slog.Warn("watch: cannot watch directory", "dir", d, "err", err); continue }
+		w.dirs[d] = true
+	}
+	w.rules = rules
+	slog.Info("watch rules loaded", "rules", len(rules), "dirs", len(w.dirs))
+	return nil
+}
+
+func (w *watcher) event(ev fsnotify.Event) {
+	if ev.Name == w.rulesPath {
+		if ev.Op&(fsnotify.Create|fsnotify.Write|fsnotify.Rename) != 0 {
+			if err := w.load(); err != nil { slog.Warn("watch: rules not reloaded", "err", err) }
+		}
+		return
+	}
+	for _, r := range w.rules {
+		key := r.Name + "\x00" + ev.Name
+		if p, ok := w.pending[key]; ok { p.due = time.Now().Add(r.settle); continue }
+		if e, ok := r.matches(ev); ok { w.pending[key] = &watchPending{rule: r, event: e, due: time.Now().Add(r.settle)} }
+	}
+}
+
+// fire queues a job for every pending file whose settle time has passed
+func (w *watcher) fire(now time.Time) {
+	for key, p := range w.pending {
+		if now.Before(p.due) { continue }
+		delete(w.pending, key)
+		path := key[strings.IndexByte(key, 0)+1:]
+		// a file that was created and removed again before settling is not run
+		if p.event == "create" || p.event == "write" {
+			if fi, err := os.Stat(path); err != nil || !fi.Mode().IsRegular() { continue }
+		}
+		j, err := enqueue(job{Agent: p.rule.Agent, Exec: p.rule.Exec, User: "watch:" + p.rule.Name, Env: []string{"CBW_WATCH_FILE=" + path, "CBW_WATCH_RULE=" + p.rule.Name, "CBW_WATCH_EVENT=" + p.event}})
+		if err != nil { slog.Error("watch: queueing failed", "rule", p.rule.Name, "file", path, "err", err); continue }
+		slog.Info("watch: job queued", "rule", p.rule.Name, "file", path, "agent", p.rule.Agent, "exec", p.rule.Exec, "job", j.ID)
+	}
+}
+
+// runWatch implements `term watch`: a daemon that runs agents on files matching the rules
+func runWatch(args []string) int {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	rulesPath := fs.String("rules", watchRulesPath(), "rules file")
+	check := fs.Bool("check", false, "check the rules file and exit")
+	fs.Parse(args)
+
+	if *check {
+		rules, err := loadWatchRules(*rulesPath)
+		if err != nil { fmt.Fprintln(os.Stderr, err); return 1 }
+		for _, r := range rules {
+			mode := "dry-run"
+			if r.Exec { mode = "exec" }
+			fmt.Printf("%s\t%s\t%s (%s)\ton %s, settle %s\n", r.Name, r.Glob, r.Agent, mode, strings.Join(r.Events, ","), r.settle)
+		}
+		return 0
+	}
+
+	cfg := loadConfig()
+	defer setupLogging(cfg.Log, "watch", false)()
+	_ = os.MkdirAll(tuiDataDir(), 0o700)
+	fw, err := fsnotify.NewWatcher()
+	if err != nil { fmt.Fprintln(os.Stderr, err); return 1 }
+	defer fw.Close()
+	abs, _ := filepath.Abs(*rulesPath)
+	w := &watcher{fs: fw, rulesPath: abs, auditPath: filepath.Join(tuiDataDir(), "agent_audit.log"), dirs: map[string]bool{}, pending: map[string]*watchPending{}}
+	if err := w.load(); err != nil { fmt.Fprintln(os.Stderr, err); return 1 }
+	// the rules file's directory is watched so edits apply without a restart
+	if err := fw.Add(filepath.Dir(abs)); err != nil { slog.Warn("watch: rules file not watched", "err", err) }
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	// the tick settles files and, like the Jobs tab, starts queued jobs and audits finished ones
+	t := time.NewTicker(500 * time.Millisecond)
+	defer t.Stop()
+	lastSync := time.Time{}
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("watch stopping")
+			return 0
+		case ev, ok := <-fw.Events:
+			if !ok { return 1 }
+			w.event(ev)
+		case err, ok := <-fw.Errors:
+			if !ok { return 1 }
+			slog.Warn("watch: fsnotify error", "err", err)
+		case now := <-t.C:
+			w.fire(now)
+			if now.Sub(lastSync) >= 2*time.Second {
+				lastSync = now
+				if _, _, err := syncJobs(w.auditPath); err != nil { slog.Warn("watch: job sync failed", "err", err) }
+			}
+		}
+	}
+}
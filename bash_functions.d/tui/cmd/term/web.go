@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The web dashboard is a read-only view of pending requests, recent audit entries
+// and jobs, as HTML for a phone browser or JSON for scripts. Tokens are issued like
+// the gateway's; non-admins only see their own requests, runs and jobs.
+
+func webTokensPath() string { return filepath.Join(tuiDataDir(), "web_tokens.json") }
+
+// webCookie holds the token once entered on the login page
+const webCookie = "cbw_web_token"
+
+// webAuditEntries is how many audit entries the dashboard shows
+const webAuditEntries = 50
+
+type webAudit struct {
+	Time   time.Time         `json:"time"`
+	Fields map[string]string `json:"fields"`
+}
+
+// webState is everything the dashboard shows, in the shape /api/state returns it
+type webState struct {
+	Generated time.Time     `json:"generated"`
+	User      string        `json:"user"`
+	Admin     bool          `json:"admin"`
+	Requests  []requestItem `json:"requests"`
+	Audit     []webAudit    `json:"audit"`
+	Jobs      []job         `json:"jobs"`
+}
+
+type webServer struct {
+	allowPath    string
+	auditPath    string
+	requestsPath string
+	tls          bool
+}
+
+// user is the token's user from the Authorization header or the login cookie
+func (s *webServer) user(r *http.Request) (string, bool) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if c, err := r.Cookie(webCookie); err == nil && token == "" { token = c.Value }
+	if token == "" { return "", false }
+	user, err := tokenUser(webTokensPath(), token)
+	if err != nil { slog.Warn("web: refused", "remote", r.RemoteAddr, "err", err); return "", false }
+	return user, true
+}
+
+// state gathers the dashboard for user; admins of the allowlist see everything
+func (s *webServer) state(user string) webState {
+	st := webState{Generated: time.Now(), User: user, Requests: []requestItem{}, Audit: []webAudit{}, Jobs: []job{}}
+	if allow, err := loadAllowlist(s.allowPath); err == nil {
+		for _, e := range allow { if e.User == user { st.Admin = e.IsAdmin } }
+	}
+	mine := func(u string) bool { return st.Admin || u == user }
+	reqs, err := listRequests(s.requestsPath)
+	if err != nil { slog.Warn("web: requests unreadable", "err", err) }
+	for _, r := range reqs { if mine(r.User) { st.Requests = append(st.Requests, r) } }
+	audit, err := readAudit(s.auditPath)
+	if err != nil { slog.Warn("web: audit unreadable", "err", err) }
+	lines := strings.Split(audit, "\n")
+	for i := len(lines) - 1; i >= 0 && len(st.Audit) < webAuditEntries; i-- {
+		if e, ok := parseAuditLine(lines[i]); ok && mine(e.fields["user"]) { st.Audit = append(st.Audit, webAudit{Time: e.time, Fields: e.fields}) }
+	}
+	jobs := loadJobs()
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Queued > jobs[j].Queued })
+	for _, j := range jobs {
+		if !mine(j.User) { continue }
+		// an editor buffer's script stays on the host
+		j.Script, j.Log = "", ""
+		st.Jobs = append(st.Jobs, j)
+	}
+	return st
+}
+
+var webPage = template.Must(template.New("web").Funcs(template.FuncMap{
+	"when": func(t time.Time) string { return t.Local().Format("01-02 15:04:05") },
+}).Parse(`<!doctype html>
+<html><head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1">
+<meta http-equiv="refresh" content="30"><title>cbw dashboard</title>
+<style>body{font:14px system-ui,sans-serif;margin:1em;color:#222}h2{font-size:1.1em;margin-top:1.5em}
+table{border-collapse:collapse;width:100%}td,th{text-align:left;padding:.2em .5em;border-bottom:1px solid #ddd;vertical-align:top}
+.fail{color:#b00}.muted{color:#777}</style></head><body>
+<h1>Dashboard</h1><p class="muted">{{.User}}{{if .Admin}} (admin){{end}} · {{when .Generated}} · <a href="/api/state">JSON</a></p>
+<h2>Pending requests ({{len .Requests}})</h2>
+<table><tr><th>ID</th><th>Agent</th><th>User</th><th>Time</th><th>Notes</th></tr>
+{{range .Requests}}<tr><td>{{.ID}}</td><td>{{.Agent}}</td><td>{{.User}}</td><td>{{.Time}}</td><td>{{.Notes}}</td></tr>{{end}}</table>
+<h2>Jobs ({{len .Jobs}})</h2>
+<table><tr><th>Agent</th><th>State</th><th>User</th><th>Queued</th><th>Exit</th></tr>
+{{range .Jobs}}<tr><td>{{.Agent}}</td><td>{{.State}}</td><td>{{.User}}</td><td>{{.Queued}}</td><td{{if ne .Exit 0}} class="fail"{{end}}>{{.Exit}}</td></tr>{{end}}</table>
+<h2>Recent audit ({{len .Audit}})</h2>
+<table><tr><th>Time</th><th>Agent</th><th>User</th><th>Exit</th><th>Source</th></tr>
+{{range .Audit}}<tr><td>{{when .Time}}</td><td>{{index .Fields "agent"}}</td><td>{{index .Fields "user"}}</td><td{{with index .Fields "exit"}}{{if ne . "0"}} class="fail"{{end}}{{end}}>{{index .Fields "exit"}}</td><td>{{index .Fields "source"}}</td></tr>{{end}}</table>
+</body></html>
+`))
+
+var webLoginPage = `<!doctype html>
+<html><head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title>cbw dashboard</title></head>
+<body style="font:16px system-ui,sans-serif;margin:2em"><form method="post" action="/login">
+<p><label>Token <input name="token" type="password" autocomplete="current-password" autofocus></label></p>
+<p><button>Sign in</button></p></form></body></html>
+`
+
+func (s *webServer) index(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" { http.NotFound(w, r); return }
+	user, ok := s.user(r)
+	if !ok { http.Redirect(w, r, "/login", http.StatusSeeOther); return }
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := webPage.Execute(w, s.state(user)); err != nil { slog.Warn("web: render failed", "err", err) }
+}
+
+func (s *webServer) api(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.user(r)
+	if !ok { http.Error(w, "unauthorized", http.StatusUnauthorized); return }
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(s.state(user))
+}
+
+// login shows the token form and, on POST, keeps a valid token in a cookie
+func (s *webServer) login(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	if r.Method != http.MethodPost {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, webLoginPage)
+		return
+	}
+	token := strings.TrimSpace(r.PostFormValue("token"))
+	if _, err := tokenUser(webTokensPath(), token); err != nil {
+		slog.Warn("web: login refused", "remote", r.RemoteAddr, "err", err)
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: webCookie, Value: token, Path: "/", HttpOnly: true, Secure: s.tls, SameSite: http.SameSiteStrictMode, MaxAge: 30 * 24 * 3600})
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+const webUsage = `usage: term web <command> [flags]
+
+  serve [-addr host:port] [-tls-cert file -tls-key file]   serve the read-only dashboard
+  token [-ttl 720h] <user>                                 issue a token for user
+  revoke <user>                                            drop every token of user
+`
+
+// runWeb implements `term web`
+func runWeb(args []string) int {
+	if len(args) < 1 { fmt.Fprint(os.Stderr, webUsage); return 2 }
+	switch args[0] {
+	case "serve":
+		return serveWeb(args[1:])
+	case "token", "revoke":
+		return runTokenCmd("web", webTokensPath(), webUsage, args)
+	}
+	fmt.Fprint(os.Stderr, webUsage)
+	return 2
+}
+
+func serveWeb(args []string) int {
+	fs := flag.NewFlagSet("web serve", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:8024", "address to listen on; put a TLS reverse proxy in front, or use -tls-cert")
+	cert := fs.String("tls-cert", "", "serve HTTPS with this certificate")
+	key := fs.String("tls-key", "", "private key of -tls-cert")
+	allowPath := fs.String("allowlist", allowlistPath(), "wish-server allowlist; its admins see every user's entries")
+	fs.Parse(args)
+	cfg := loadConfig()
+	defer setupLogging(cfg.Log, "web", false)()
+
+	s := &webServer{allowPath: *allowPath, auditPath: filepath.Join(tuiDataDir(), "agent_audit.log"), requestsPath: filepath.Join(tuiDataDir(), "requests.json"), tls: *cert != ""}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.index)
+	mux.HandleFunc("/login", s.login)
+	mux.HandleFunc("/api/state", s.api)
+	srv := &http.Server{Addr: *addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	slog.Info("web dashboard listening", "addr", *addr, "tls", s.tls)
+	var err error
+	if s.tls { err = srv.ListenAndServeTLS(*cert, *key) } else { err = srv.ListenAndServe() }
+	if err != nil && err != http.ErrServerClosed { slog.Error("web: serve failed", "err", err); fmt.Fprintln(os.Stderr, err); return 1 }
+	return 0
+}
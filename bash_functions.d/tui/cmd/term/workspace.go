@@ -0,0 +1,50 @@
+package main
+
+import (
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/textarea"
+	"github.com/charmbracelet/bubbles/viewport"
+)
+
+// workspace is the per-workspace slice of the model: its own cwd, file list, editor
+// buffer, viewport and pane layout. Shared state (agents, requests, jobs) stays global.
+type workspace struct {
+	cwd        string
+	list       list.Model
+	ta         textarea.Model
+	editorFile string
+	editorRO   bool
+	vp         viewport.Model
+	vpContent  string
+	vpScroll   bool
+	vpX        int
+	md         *mdDoc
+	active     int
+	panes      *paneLayout
+}
+
+// newWorkspace starts a workspace in the current directory with empty buffers
+func (m model) newWorkspace() workspace {
+	ws := workspace{cwd: m.cwd, list: newFileList(m.cwd), ta: newEditor(m.ta.Width(), m.ta.Height()), vp: viewport.New(m.vp.Width, m.vp.Height)}
+	ws.panes = newPaneLayout(m.tabs[0])
+	return ws
+}
+
+// switchWorkspace stores the active workspace and restores workspace i, creating
+// any missing workspaces up to i.
+func (m *model) switchWorkspace(i int) {
+	if i == m.ws { return }
+	m.workspaces[m.ws] = workspace{cwd: m.cwd, list: m.list, ta: m.ta, editorFile: m.editorFile, editorRO: m.editorRO, vp: m.vp, vpContent: m.vpContent, vpScroll: m.vpScroll, vpX: m.vpX, md: m.md, active: m.active, panes: m.panes}
+	for len(m.workspaces) <= i { m.workspaces = append(m.workspaces, m.newWorkspace()) }
+	ws := m.workspaces[i]
+	m.ws = i
+	// the outline belongs to the document of the workspace being left
+	m.tocOpen = false
+	m.cwd, m.list, m.ta, m.editorFile, m.editorRO, m.vp, m.vpContent, m.md, m.active, m.panes = ws.cwd, ws.list, ws.ta, ws.editorFile, ws.editorRO, ws.vp, ws.vpContent, ws.md, ws.active, ws.panes
+	m.vpScroll, m.vpX = ws.vpScroll, ws.vpX
+	m.applySize()
+	m.refreshFiles() // the listing mode is shared by all workspaces
+	m.layoutContent()
+	m.renderMarkdown()
+	m.status = T("workspace %d: %s", i+1, m.cwd)
+}
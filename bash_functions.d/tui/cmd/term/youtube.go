@@ -0,0 +1,263 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/bubbles/textinput"
+)
+
+// dlBarWidth is the width of a download's progress bar in cells
+const dlBarWidth = 20
+
+// dlStatusWidth is the width of the status column: bar, percent, speed and time left
+const dlStatusWidth = dlBarWidth + 2 + 24
+
+// ytView is the YouTube tab: a yt-dlp search, its results and the download queue
+type ytView struct {
+	input      textinput.Model // s: a search, or a URL to download directly
+	query      string
+	results    []ytResult
+	sel        int
+	searching  bool
+	picking    *ytResult // format picker open for this result
+	fmtSel     int
+	downloads  []download
+	progress   map[string]dlProgress // of running downloads, by ID
+	dlSel      int
+	onQueue    bool // d: the keys move through the downloads instead of the results
+	ticking    bool
+	player     *mpvState // mpv playing, as of the last poll; nil when nothing plays
+	mpvTicking bool
+}
+
+func newYTView() *ytView {
+	ti := textinput.New()
+	ti.Prompt = T("search YouTube: ")
+	ti.Placeholder = T("words, or a video URL")
+	ti.CharLimit = 300
+	return &ytView{input: ti, progress: map[string]dlProgress{}}
+}
+
+// startDownloadsTick syncs the download queue now and keeps polling it, unless a
+// poll loop is already running
+func (m *model) startDownloadsTick() tea.Cmd {
+	if m.yt.ticking { return nil }
+	m.yt.ticking = true
+	return func() tea.Msg { return downloadsTickMsg{} }
+}
+
+// syncYT refreshes the queue and the progress of running downloads; it keeps
+// polling while any are queued or running
+func (m *model) syncYT() tea.Cmd {
+	y := m.yt
+	all, err := syncDownloads()
+	if err != nil { m.status = T("download sync failed: %v", err); slog.Warn("download sync failed", "err", err) }
+	for _, d := range all {
+		for _, old := range y.downloads {
+			if old.ID == d.ID && old.State == DlRunning && d.State != DlRunning && d.State != DlQueued { m.status = T("download %s: %s", d.State, d.Title) }
+		}
+	}
+	y.downloads = all
+	y.progress = map[string]dlProgress{}
+	for _, d := range all { if d.State == DlRunning { y.progress[d.ID] = readProgress(d) } }
+	if y.dlSel >= len(all) { y.dlSel = max(0, len(all)-1) }
+	if activeDownloads(all) == 0 { y.ticking = false; return nil }
+	y.ticking = true
+	return downloadsTick()
+}
+
+// updateYTInput handles keys while the search box has focus: enter searches, or
+// opens the format picker when the input is a URL
+func (m *model) updateYTInput(msg tea.KeyMsg) tea.Cmd {
+	y := m.yt
+	switch msg.String() {
+	case "esc":
+		y.input.Blur()
+		return nil
+	case "enter":
+		q := strings.TrimSpace(y.input.Value())
+		if q == "" { return nil }
+		y.input.Blur()
+		if strings.HasPrefix(q, "http://") || strings.HasPrefix(q, "https://") {
+			y.picking, y.fmtSel = &ytResult{URL: q, Title: q}, 0
+			return nil
+		}
+		y.query, y.searching, y.results, y.sel, y.onQueue = q, true, nil, 0, false
+		m.status = T("searching YouTube for %q", q)
+		return ytSearch(q)
+	}
+	var cmd tea.Cmd
+	y.input, cmd = y.input.Update(msg)
+	return cmd
+}
+
+// updateYouTube handles the YouTube tab keys: s searches, enter on a result picks a
+// format and queues it, p plays a result or a finished download in mpv, d switches
+// between results and downloads, and on a download enter shows its log, x cancels,
+// R retries and c clears finished ones
+func (m *model) updateYouTube(key string) (tea.Cmd, bool) {
+	y := m.yt
+	if y.picking != nil {
+		switch key {
+		case "up", "k":
+			if y.fmtSel > 0 { y.fmtSel-- }
+		case "down", "j":
+			if y.fmtSel < len(dlFormats)-1 { y.fmtSel++ }
+		case "esc":
+			y.picking = nil
+		case "enter":
+			r, f := y.picking, dlFormats[y.fmtSel]
+			y.picking = nil
+			dir := m.cfg.DownloadDir
+			if dir == "" { dir = defaultDownloadDir() }
+			d, err := enqueueDownload(r.URL, r.Title, f.Name, dir)
+			if err != nil { m.status = T("cannot queue download: %v", err); slog.Warn("cannot queue download", "url", r.URL, "err", err); return nil, true }
+			m.status = T("queued %s (%s) into %s", d.Title, f.Name, dir)
+			y.onQueue = true
+			return m.startDownloadsTick(), true
+		default:
+			return nil, false
+		}
+		return nil, true
+	}
+	switch key {
+	case "s":
+		y.input.SetValue("")
+		return y.input.Focus(), true
+	case "d":
+		y.onQueue = !y.onQueue
+		return nil, true
+	}
+	if !y.onQueue {
+		switch key {
+		case "up", "k":
+			if y.sel > 0 { y.sel-- }
+		case "down", "j":
+			if y.sel < len(y.results)-1 { y.sel++ }
+		case "enter":
+			if len(y.results) == 0 { return nil, true }
+			r := y.results[y.sel]
+			y.picking, y.fmtSel = &r, 0
+		case "p":
+			if len(y.results) == 0 { return nil, true }
+			return m.play(y.results[y.sel].URL, y.results[y.sel].Title), true
+		default:
+			return nil, false
+		}
+		return nil, true
+	}
+	var sel *download
+	if y.dlSel < len(y.downloads) { sel = &y.downloads[y.dlSel] }
+	var all []download
+	var err error
+	switch key {
+	case "up", "k":
+		if y.dlSel > 0 { y.dlSel-- }
+		return nil, true
+	case "down", "j":
+		if y.dlSel < len(y.downloads)-1 { y.dlSel++ }
+		return nil, true
+	case "p":
+		if sel == nil { return nil, true }
+		if sel.State != DlDone || sel.File == "" { m.status = T("%s is not downloaded yet", sel.Title); return nil, true }
+		return m.play(sel.File, sel.Title), true
+	case "enter":
+		if sel == nil { return nil, true }
+		m.setContent(readJobLog(job{Log: sel.Log}))
+		m.active = m.tabIndex("Preview")
+		return nil, true
+	case "x":
+		if sel == nil { return nil, true }
+		all, err = cancelDownload(sel.ID)
+		m.status = T("removed %s; files already downloaded are kept", sel.Title)
+	case "R":
+		if sel == nil || sel.State != DlFailed { return nil, true }
+		all, err = retryDownload(sel.ID)
+		m.status = T("retrying %s", sel.Title)
+	case "c":
+		all, err = clearDownloads()
+		m.status = T("cleared finished downloads")
+	default:
+		return nil, false
+	}
+	if err != nil { m.status = T("download queue: %v", err); slog.Warn("download queue update failed", "err", err); return nil, true }
+	y.downloads = all
+	if y.dlSel >= len(all) { y.dlSel = max(0, len(all)-1) }
+	return m.startDownloadsTick(), true
+}
+
+// youTubeView renders the YouTube tab in w x h cells: the search box, the results or
+// format picker, then the downloads
+func (m model) youTubeView(w, h int) string {
+	y := m.yt
+	var b strings.Builder
+	b.WriteString(m.mpvView(w))
+	if y.input.Focused() {
+		b.WriteString(y.input.View() + "\n")
+	} else {
+		hint := T("s: search or paste a URL • enter: pick a format • p: play • d: go to the downloads")
+		if y.onQueue { hint = T("enter: log • p: play • x: cancel/remove • R: retry • c: clear finished • d: back to the results") }
+		b.WriteString(helpStyle.Render(hint) + "\n")
+	}
+	dlRows := min(len(y.downloads), max(3, h/3))
+	listRows := max(1, h-dlRows-4)
+	if y.player != nil { listRows = max(1, listRows-2) }
+	switch {
+	case y.picking != nil:
+		b.WriteString(T("Format for %s:", truncateCells(y.picking.Title, max(10, w-12))) + "\n")
+		for i, f := range dlFormats { b.WriteString(selMarker(i == y.fmtSel) + f.Name + "\n") }
+	case y.searching:
+		b.WriteString(T("searching YouTube for %q...", y.query) + "\n")
+	case len(y.results) == 0:
+		b.WriteString(T("no results yet") + "\n")
+	default:
+		b.WriteString(T("Results for %q:", y.query) + "\n")
+		first := max(0, y.sel-listRows+1)
+		for i := first; i < len(y.results) && i < first+listRows; i++ {
+			r := y.results[i]
+			meta := ""
+			if r.Duration > 0 { meta = " " + (time.Duration(r.Duration) * time.Second).String() }
+			if r.Channel != "" { meta += " · " + r.Channel }
+			line := truncateCells(r.Title, max(10, w-len([]rune(meta))-3)) + helpStyle.Render(meta)
+			b.WriteString(selMarker(!y.onQueue && i == y.sel) + line + "\n")
+		}
+	}
+	b.WriteString("\n" + T("Downloads (%d active):", activeDownloads(y.downloads)) + "\n")
+	if len(y.downloads) == 0 { b.WriteString(helpStyle.Render(T("nothing queued")) + "\n") }
+	first := max(0, y.dlSel-dlRows+1)
+	for i := first; i < len(y.downloads) && i < first+dlRows; i++ {
+		d := y.downloads[i]
+		b.WriteString(selMarker(y.onQueue && i == y.dlSel) + m.dlStatus(d) + " " + truncateCells(d.Title, max(10, w-dlStatusWidth-3)) + "\n")
+	}
+	return b.String()
+}
+
+// dlStatus is the status column of a download: a bar, percent, speed and time left
+// while it runs, its state and format otherwise
+func (m model) dlStatus(d download) string {
+	if d.State != DlRunning {
+		state := T(d.State)
+		if d.State == DlFailed && d.Exit > 0 { state = T("failed, exit %d", d.Exit) }
+		if m.plain { return "[" + state + "] " + d.Format }
+		return fmt.Sprintf("%-*s", dlStatusWidth, "["+state+"] "+d.Format)
+	}
+	p := m.yt.progress[d.ID]
+	pct := fmt.Sprintf("%3.0f%%", p.fraction()*100)
+	speed, eta := "", ""
+	if p.speed > 0 { speed = humanSize(int64(p.speed)) + "/s" }
+	if p.eta >= 0 { eta = (time.Duration(p.eta) * time.Second).String() }
+	if p.phase != "" { speed, eta = p.phase, "" }
+	if m.plain { return strings.TrimSpace(strings.Join([]string{pct, speed, eta}, " ")) }
+	filled := int(p.fraction() * dlBarWidth)
+	bar := diffAddStyle.Render(strings.Repeat("█", filled)) + helpStyle.Render(strings.Repeat("░", dlBarWidth-filled))
+	return fmt.Sprintf(" %s  %4s %9s %9s", bar, pct, speed, eta)
+}
+
+func selMarker(selected bool) string {
+	if selected { return "> " }
+	return "  "
+}
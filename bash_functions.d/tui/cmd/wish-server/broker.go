@@ -0,0 +1,82 @@
+//go:build wish
+// +build wish
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/charmbracelet/wish"
+)
+
+// brokerTimeout bounds a ticket request to the exec broker
+const brokerTimeout = 5 * time.Second
+
+// brokerTicketKey holds a session's broker ticket in its context
+type brokerTicketKey struct{}
+
+// callBroker sends one request to the exec broker (term broker serve) and returns
+// the ticket of its reply
+func callBroker(sock string, req map[string]string) (string, error) {
+	conn, err := net.DialTimeout("unix", sock, brokerTimeout)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(brokerTimeout))
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return "", err
+	}
+	var r struct {
+		Error  string `json:"error"`
+		Ticket string `json:"ticket"`
+	}
+	if err := json.NewDecoder(conn).Decode(&r); err != nil {
+		return "", err
+	}
+	if r.Error != "" {
+		return "", errors.New(r.Error)
+	}
+	return r.Ticket, nil
+}
+
+// brokerMiddleware asks the broker for a ticket naming each session's SSH user, so
+// the broker learns the user from this server rather than from the session. The
+// ticket stays in the session's context, where the TUI presents it on exec runs; it
+// is never put in the environment, which other processes of this account can read
+// in /proc. The broker only issues tickets to the accounts it trusts, and the
+// ticket is revoked when the session ends.
+func brokerMiddleware(sock string, readOnly func(user string) bool) wish.Middleware {
+	return func(next wish.Handler) wish.Handler {
+		return func(s wish.Session) {
+			// invite sessions only submit a key, and read-only ones run nothing
+			if hash, _ := s.Context().Value(inviteKey{}).(string); hash != "" || readOnly(s.User()) {
+				next(s)
+				return
+			}
+			t, err := callBroker(sock, map[string]string{"op": "ticket", "user": s.User()})
+			if err != nil {
+				slog.Warn("no broker ticket, exec runs act for the server's account", "user", s.User(), "err", err)
+				next(s)
+				return
+			}
+			s.Context().SetValue(brokerTicketKey{}, t)
+			defer func() {
+				if _, err := callBroker(sock, map[string]string{"op": "revoke", "ticket": t}); err != nil {
+					slog.Warn("broker ticket not revoked", "user", s.User(), "err", err)
+				}
+			}()
+			next(s)
+		}
+	}
+}
+
+// sessionBrokerTicket is the ticket brokerMiddleware got for the session of ctx
+func sessionBrokerTicket(ctx wish.Context) string {
+	t, _ := ctx.Value(brokerTicketKey{}).(string)
+	return t
+}
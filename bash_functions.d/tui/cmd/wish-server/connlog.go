@@ -0,0 +1,228 @@
+//go:build wish
+// +build wish
+
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// connLogMax is the size at which connections.log is moved to connections.log.1
+const connLogMax = 10 << 20
+
+// connEvent is one line of connections.log, which the TUI's Connections tab shows
+type connEvent struct {
+	Time   time.Time `json:"time"`
+	Event  string    `json:"event"` // login, auth_failed, banned or invite
+	User   string    `json:"user,omitempty"`
+	Remote string    `json:"remote"`
+	Method string    `json:"method,omitempty"` // publickey, password or keyboard-interactive
+	Detail string    `json:"detail,omitempty"` // key fingerprint, ban length
+}
+
+func connLogPath(allowPath string) string {
+	return filepath.Join(filepath.Dir(allowPath), "connections.log")
+}
+
+var connLogMu sync.Mutex
+
+// logConn appends e to the connection log next to the allowlist; without an
+// allowlist there is nowhere to keep it
+func logConn(allowPath string, e connEvent) {
+	if allowPath == "" {
+		return
+	}
+	e.Time = time.Now().UTC()
+	b, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	connLogMu.Lock()
+	defer connLogMu.Unlock()
+	path := connLogPath(allowPath)
+	if fi, err := os.Stat(path); err == nil && fi.Size() > connLogMax {
+		if err := os.Rename(path, path+".1"); err != nil {
+			slog.Warn("cannot rotate the connection log", "path", path, "err", err)
+		}
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0o600)
+	if err == nil {
+		_, err = f.Write(append(b, '\n'))
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		slog.Warn("cannot write the connection log", "path", path, "err", err)
+	}
+}
+
+// remoteIP is the address of a peer without its port
+func remoteIP(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+// banList refuses addresses that failed to authenticate after times within window,
+// for length; after 0 turns it off
+type banList struct {
+	mu     sync.Mutex
+	after  int
+	window time.Duration
+	length time.Duration
+	fails  map[string][]time.Time
+	until  map[string]time.Time
+}
+
+func newBanList(after int, window, length time.Duration) *banList {
+	return &banList{after: after, window: window, length: length, fails: map[string][]time.Time{}, until: map[string]time.Time{}}
+}
+
+// banned reports whether ip is banned now
+func (b *banList) banned(ip string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	until, ok := b.until[ip]
+	if ok && time.Now().After(until) {
+		delete(b.until, ip)
+		return false
+	}
+	return ok
+}
+
+// fail counts a failed attempt of ip and reports whether it got ip banned
+func (b *banList) fail(ip string) bool {
+	if b.after <= 0 || ip == "" {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	// forget addresses whose failures are all out of the window, and ended bans
+	for k, ts := range b.fails {
+		if now.Sub(ts[len(ts)-1]) >= b.window {
+			delete(b.fails, k)
+		}
+	}
+	for k, until := range b.until {
+		if now.After(until) {
+			delete(b.until, k)
+		}
+	}
+	recent := []time.Time{}
+	for _, t := range b.fails[ip] {
+		if now.Sub(t) < b.window {
+			recent = append(recent, t)
+		}
+	}
+	recent = append(recent, now)
+	if len(recent) < b.after {
+		b.fails[ip] = recent
+		return false
+	}
+	delete(b.fails, ip)
+	b.until[ip] = now.Add(b.length)
+	return true
+}
+
+// authFailed logs a failed attempt and bans the address once it failed too often
+func authFailed(allowPath string, bans *banList, user string, addr net.Addr, method, detail string) {
+	ip := remoteIP(addr)
+	logConn(allowPath, connEvent{Event: "auth_failed", User: user, Remote: ip, Method: method, Detail: detail})
+	if bans.fail(ip) {
+		slog.Warn("address banned after failed logins", "remote", ip, "for", bans.length)
+		logConn(allowPath, connEvent{Event: "banned", User: user, Remote: ip, Detail: bans.length.String()})
+	}
+}
+
+// authTracker counts failed logins per connection rather than per key: a client
+// offers each key of its agent in turn, so rejected keys are remembered and only
+// a connection that closes without getting in counts as a failure
+type authTracker struct {
+	mu    sync.Mutex
+	conns map[string]*authAttempt
+}
+
+// authAttempt is what a connection tried before it got in or closed
+type authAttempt struct {
+	user   string
+	method string
+	keys   []string
+}
+
+func newAuthTracker() *authTracker {
+	return &authTracker{conns: map[string]*authAttempt{}}
+}
+
+// rejected records a refused key or answer on the connection from addr
+func (t *authTracker) rejected(addr net.Addr, user, method, detail string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	a, ok := t.conns[addr.String()]
+	if !ok {
+		a = &authAttempt{}
+		t.conns[addr.String()] = a
+	}
+	a.user, a.method = user, method
+	if detail != "" {
+		a.keys = append(a.keys, detail)
+	}
+}
+
+// accepted forgets what the connection from addr tried, since it got in
+func (t *authTracker) accepted(addr net.Addr) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.conns, addr.String())
+}
+
+// closed ends the connection from addr and returns what it tried when it was
+// refused and never got in
+func (t *authTracker) closed(addr net.Addr) (authAttempt, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	a, ok := t.conns[addr.String()]
+	if !ok {
+		return authAttempt{}, false
+	}
+	delete(t.conns, addr.String())
+	return *a, true
+}
+
+// trackedListener calls onClose with the remote address of each connection it
+// accepted once that connection is closed
+type trackedListener struct {
+	net.Listener
+	onClose func(net.Addr)
+}
+
+func (l *trackedListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &trackedConn{Conn: c, onClose: l.onClose}, nil
+}
+
+type trackedConn struct {
+	net.Conn
+	once    sync.Once
+	onClose func(net.Addr)
+}
+
+func (c *trackedConn) Close() error {
+	c.once.Do(func() { c.onClose(c.RemoteAddr()) })
+	return c.Conn.Close()
+}
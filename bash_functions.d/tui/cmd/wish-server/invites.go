@@ -0,0 +1,232 @@
+//go:build wish
+// +build wish
+
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/charmbracelet/wish"
+	"golang.org/x/crypto/ssh"
+)
+
+// invite is a one-time token created in the TUI's Admin tab; only its hash is stored
+type invite struct {
+	Hash    string     `json:"hash"`
+	By      string     `json:"by"`
+	Created time.Time  `json:"created"`
+	Expires time.Time  `json:"expires"`
+	UsedBy  string     `json:"used_by,omitempty"`
+	Used    *time.Time `json:"used,omitempty"`
+}
+
+// pendingEntry is a key submitted with an invite, waiting for an admin in the Admin tab
+type pendingEntry struct {
+	User      string    `json:"user"`
+	PubKey    string    `json:"pubkey"`
+	Invite    string    `json:"invite"`
+	Requested time.Time `json:"requested"`
+	Remote    string    `json:"remote,omitempty"`
+}
+
+// inviteKey is the session context key holding the hash of the invite a
+// connection authenticated with
+type inviteKey struct{}
+
+var inviteUserRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+func invitesPath(allowPath string) string {
+	return filepath.Join(filepath.Dir(allowPath), "invites.json")
+}
+
+func pendingPath(allowPath string) string {
+	return filepath.Join(filepath.Dir(allowPath), "pending_allowlist.json")
+}
+
+// withLock holds the same flock as the TUI's withLock, so invites are not
+// redeemed and created at the same time
+func withLock(name string, fn func() error) error {
+	home, _ := os.UserHomeDir()
+	dir := filepath.Join(home, ".bash_functions_d", "locks")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, name+".lock"), os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		return err
+	}
+	defer syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+	return fn()
+}
+
+func readJSONFile(path string, v interface{}) error {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func writeJSONFile(path string, v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, append(b, '\n'), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// openInvite returns the index of the unused, unexpired invite whose hash is hash
+func openInvite(invs []invite, hash string, now time.Time) int {
+	for i, inv := range invs {
+		if subtle.ConstantTimeCompare([]byte(inv.Hash), []byte(hash)) == 1 && inv.UsedBy == "" && now.Before(inv.Expires) {
+			return i
+		}
+	}
+	return -1
+}
+
+// checkInvite lets a new user in with token as the password. The name they connect
+// with becomes the requested user, so it must be valid and not in the allowlist yet.
+// The invite is only spent once a key is submitted.
+func checkInvite(ctx wish.Context, allowPath string, allowed []allowEntry, token string) bool {
+	if allowPath == "" || !inviteUserRe.MatchString(ctx.User()) {
+		return false
+	}
+	for _, a := range allowed {
+		if a.User == ctx.User() {
+			return false
+		}
+	}
+	sum := sha256.Sum256([]byte(strings.TrimSpace(token)))
+	hash := hex.EncodeToString(sum[:])
+	var invs []invite
+	if err := readJSONFile(invitesPath(allowPath), &invs); err != nil {
+		slog.Warn("cannot read invites", "path", invitesPath(allowPath), "err", err)
+		return false
+	}
+	if openInvite(invs, hash, time.Now()) < 0 {
+		slog.Info("invite refused", "user", ctx.User(), "remote", ctx.RemoteAddr().String())
+		return false
+	}
+	ctx.SetValue(inviteKey{}, hash)
+	return true
+}
+
+// redeemInvite spends the invite and files key as a pending entry for user
+func redeemInvite(allowPath, hash, user, key, remote string) error {
+	return withLock("invites", func() error {
+		var invs []invite
+		if err := readJSONFile(invitesPath(allowPath), &invs); err != nil {
+			return err
+		}
+		now := time.Now().UTC()
+		i := openInvite(invs, hash, now)
+		if i < 0 {
+			return errors.New("the invite was used or has expired")
+		}
+		var pend []pendingEntry
+		if err := readJSONFile(pendingPath(allowPath), &pend); err != nil {
+			return err
+		}
+		pend = append(pend, pendingEntry{User: user, PubKey: key, Invite: hash, Requested: now, Remote: remote})
+		if err := writeJSONFile(pendingPath(allowPath), pend); err != nil {
+			return err
+		}
+		invs[i].UsedBy, invs[i].Used = user, &now
+		return writeJSONFile(invitesPath(allowPath), invs)
+	})
+}
+
+// readKeyLine reads one line from a session, ended by a newline or, in a raw
+// terminal, a carriage return
+func readKeyLine(r io.Reader) (string, error) {
+	br := bufio.NewReader(io.LimitReader(r, 16<<10))
+	var b strings.Builder
+	for {
+		c, err := br.ReadByte()
+		if err != nil {
+			if b.Len() > 0 && err == io.EOF {
+				return b.String(), nil
+			}
+			return "", err
+		}
+		switch c {
+		case '\r', '\n':
+			if strings.TrimSpace(b.String()) != "" {
+				return b.String(), nil
+			}
+		case 3, 4: // ctrl+c, ctrl+d
+			return "", io.EOF
+		default:
+			b.WriteByte(c)
+		}
+	}
+}
+
+// inviteMiddleware takes over sessions that authenticated with an invite: instead
+// of the TUI they get a prompt for their public key. It must run before everything
+// else, so it is the last middleware listed.
+func inviteMiddleware(allowPath string) wish.Middleware {
+	return func(next wish.Handler) wish.Handler {
+		return func(s wish.Session) {
+			hash, _ := s.Context().Value(inviteKey{}).(string)
+			if hash == "" {
+				next(s)
+				return
+			}
+			onboard(s, allowPath, hash)
+		}
+	}
+}
+
+func onboard(s wish.Session, allowPath, hash string) {
+	wish.Printf(s, "Welcome, %s. Paste your SSH public key (one line, e.g. ~/.ssh/id_ed25519.pub) and press enter:\r\n", s.User())
+	line, err := readKeyLine(s)
+	if err != nil {
+		wish.Fatalln(s, "\r\nno key received")
+		return
+	}
+	k, comment, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+	if err != nil {
+		wish.Fatalln(s, fmt.Sprintf("\r\nnot a public key: %v", err))
+		return
+	}
+	key := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(k)))
+	if comment != "" {
+		key += " " + comment
+	}
+	if err := redeemInvite(allowPath, hash, s.User(), key, s.RemoteAddr().String()); err != nil {
+		slog.Warn("invite not redeemed", "user", s.User(), "err", err)
+		wish.Fatalln(s, fmt.Sprintf("\r\nkey not filed: %v", err))
+		return
+	}
+	slog.Info("invite redeemed", "user", s.User(), "fingerprint", ssh.FingerprintSHA256(k), "remote", s.RemoteAddr().String())
+	wish.Printf(s, "\r\nThanks. Your key %s is waiting for an admin; once approved, connect as %s with it.\r\n", ssh.FingerprintSHA256(k), s.User())
+	s.Exit(0)
+}
@@ -0,0 +1,101 @@
+//go:build wish
+// +build wish
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// sdListenFDsStart is the first descriptor systemd passes, after stdin/out/err
+const sdListenFDsStart = 3
+
+// systemdListeners returns the sockets systemd passed under socket activation
+// (LISTEN_PID/LISTEN_FDS), or nil when the server was started some other way
+func systemdListeners() ([]net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil, nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	// keep the sockets from leaking into the agents and shells sessions start
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	var lns []net.Listener
+	for i := 0; i < n; i++ {
+		fd := sdListenFDsStart + i
+		syscall.CloseOnExec(fd)
+		name := fmt.Sprintf("LISTEN_FD_%d", fd)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		f := os.NewFile(uintptr(fd), name)
+		ln, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("systemd socket %s: %w", name, err)
+		}
+		lns = append(lns, ln)
+	}
+	return lns, nil
+}
+
+// listenOn opens one --listen address: "unix:/path" for a unix socket, anything
+// else is a TCP address such as ":8022" or "127.0.0.1:8022"
+func listenOn(addr string, mode os.FileMode) (net.Listener, error) {
+	path := strings.TrimPrefix(addr, "unix:")
+	if path == addr {
+		return net.Listen("tcp", addr)
+	}
+	// a socket left behind by a previous run would make the bind fail
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if c, err := net.Dial("unix", path); err == nil {
+			c.Close()
+			return nil, fmt.Errorf("%s is in use by another server", path)
+		}
+		os.Remove(path)
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// openListeners is what the server serves: the systemd sockets when activated,
+// else each --listen address, else the --port
+func openListeners(listen string, port int, mode os.FileMode) ([]net.Listener, error) {
+	lns, err := systemdListeners()
+	if err != nil || len(lns) > 0 {
+		return lns, err
+	}
+	addrs := strings.Split(listen, ",")
+	if strings.TrimSpace(listen) == "" {
+		addrs = []string{fmt.Sprintf(":%d", port)}
+	}
+	for _, a := range addrs {
+		ln, err := listenOn(strings.TrimSpace(a), mode)
+		if err != nil {
+			for _, l := range lns {
+				l.Close()
+			}
+			return nil, fmt.Errorf("listen %s: %w", a, err)
+		}
+		lns = append(lns, ln)
+	}
+	return lns, nil
+}
@@ -4,17 +4,23 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
-	"log"
+	"log/slog"
+	"net"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"syscall"
+	"time"
 	"os/user"
 
 	"github.com/charmbracelet/wish"
@@ -22,6 +28,8 @@ import (
 	wishtea "github.com/charmbracelet/wish/tea"
 	"github.com/charmbracelet/wish/middleware"
 	"golang.org/x/crypto/ssh"
+
+	"github.com/cbwinslow/go-term/cmd/internal/proxyproto"
 )
 
 // allowlist entry
@@ -30,6 +38,96 @@ type allowEntry struct {
 	PubKey     string   `json:"pubkey"`
 	AllowedExec []string `json:"allowed_exec,omitempty"`
 	IsAdmin    bool     `json:"is_admin,omitempty"`
+	Roles      []string `json:"roles,omitempty"`
+	ReadOnly   bool     `json:"read_only,omitempty"`
+	Quota      *quota   `json:"quota,omitempty"`
+}
+
+// quota caps what one connection may use; the TUI enforces it from the session
+// environment and audits every hit
+type quota struct {
+	AgentTime    string `json:"agent_time,omitempty"`     // total runtime of the session's agent jobs, e.g. "30m"
+	ShellPerHour int    `json:"shell_per_hour,omitempty"` // Shell tab commands in any hour
+}
+
+// manifestAgent is the part of an agent in manifest.json that grants exec
+type manifestAgent struct {
+	Name string `json:"name"`
+	Exec *struct {
+		Users []string `json:"users,omitempty"`
+		Roles []string `json:"roles,omitempty"`
+	} `json:"exec,omitempty"`
+}
+
+// loadManifestACL reads the agents of the manifest; a missing file grants nothing
+func loadManifestACL(path string) ([]manifestAgent, error) {
+	if path == "" {
+		return nil, nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var mf struct {
+		Agents []manifestAgent `json:"agents"`
+	}
+	if err := json.Unmarshal(b, &mf); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return mf.Agents, nil
+}
+
+// rolesForUser is the entry's roles, plus "admin" for admins
+func rolesForUser(user string, allowed []allowEntry) []string {
+	for _, a := range allowed {
+		if a.User == user {
+			roles := a.Roles
+			if a.IsAdmin {
+				roles = append(append([]string{}, roles...), "admin")
+			}
+			return roles
+		}
+	}
+	return nil
+}
+
+// mergeManifestExec adds the agents whose manifest ACL names user or one of roles
+// to the agents the allowlist already grants
+func mergeManifestExec(execs []string, user string, roles []string, agents []manifestAgent) []string {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, e := range execs {
+		if !seen[e] {
+			seen[e] = true
+			out = append(out, e)
+		}
+	}
+	for _, ag := range agents {
+		if ag.Exec == nil || seen[ag.Name] {
+			continue
+		}
+		granted := false
+		for _, u := range ag.Exec.Users {
+			if u == user {
+				granted = true
+			}
+		}
+		for _, r := range ag.Exec.Roles {
+			for _, have := range roles {
+				if r == have {
+					granted = true
+				}
+			}
+		}
+		if granted {
+			seen[ag.Name] = true
+			out = append(out, ag.Name)
+		}
+	}
+	return out
 }
 
 func loadAllowlist(path string) ([]allowEntry, error) {
@@ -47,6 +145,80 @@ func loadAllowlist(path string) ([]allowEntry, error) {
 	return arr, nil
 }
 
+// allowlist is the allowlist file, reread when it changes so that edits made in the
+// TUI's Admin tab apply to new connections without a restart
+type allowlist struct {
+	mu      sync.Mutex
+	path    string
+	mtime   time.Time
+	entries []allowEntry
+}
+
+func (a *allowlist) load() error {
+	if a.path == "" {
+		return nil
+	}
+	fi, err := os.Stat(a.path)
+	if err != nil {
+		return err
+	}
+	entries, err := loadAllowlist(a.path)
+	if err != nil {
+		return err
+	}
+	a.entries, a.mtime = entries, fi.ModTime()
+	return nil
+}
+
+// get returns the current entries; a file that no longer parses keeps the previous ones
+func (a *allowlist) get() []allowEntry {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.path == "" {
+		return nil
+	}
+	if fi, err := os.Stat(a.path); err != nil || fi.ModTime().Equal(a.mtime) {
+		return a.entries
+	}
+	if err := a.load(); err != nil {
+		slog.Warn("allowlist reload failed, keeping the previous one", "path", a.path, "err", err)
+		return a.entries
+	}
+	slog.Info("allowlist reloaded", "path", a.path, "entries", len(a.entries))
+	return a.entries
+}
+
+// keyMatches reports whether an allowlist pubkey line is key; a comment or options
+// on the line do not matter
+func keyMatches(line string, key ssh.PublicKey) bool {
+	k, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+	return err == nil && bytes.Equal(k.Marshal(), key.Marshal())
+}
+
+var loginMu sync.Mutex
+
+// recordLogin sets user's last login in last_login.json next to the allowlist, which
+// the TUI's Admin tab shows
+func recordLogin(allowPath, user string, t time.Time) error {
+	loginMu.Lock()
+	defer loginMu.Unlock()
+	path := filepath.Join(filepath.Dir(allowPath), "last_login.json")
+	logins := map[string]string{}
+	if b, err := ioutil.ReadFile(path); err == nil {
+		_ = json.Unmarshal(b, &logins)
+	}
+	logins[user] = t.UTC().Format(time.RFC3339)
+	b, err := json.MarshalIndent(logins, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
 func allowedExecForUser(user string, allowed []allowEntry) []string {
 	for _, a := range allowed {
 		if a.User == user {
@@ -65,15 +237,113 @@ func isAdminForUser(user string, allowed []allowEntry) bool {
 	return false
 }
 
+// quotaForUser is the quota of user: their entry's, with the server defaults for
+// what it leaves out
+func quotaForUser(user string, allowed []allowEntry, def quota) quota {
+	q := def
+	for _, a := range allowed {
+		if a.User == user && a.Quota != nil {
+			if a.Quota.AgentTime != "" {
+				q.AgentTime = a.Quota.AgentTime
+			}
+			if a.Quota.ShellPerHour > 0 {
+				q.ShellPerHour = a.Quota.ShellPerHour
+			}
+		}
+	}
+	return q
+}
+
+// readOnlyForUser reports whether user may only browse: no edits, shell, exec or approvals
+func readOnlyForUser(user string, allowed []allowEntry) bool {
+	for _, a := range allowed {
+		if a.User == user {
+			return a.ReadOnly
+		}
+	}
+	return false
+}
+
 func main() {
 	port := flag.Int("port", 8022, "ssh listen port")
 	hostKey := flag.String("host-key", "", "path to host private key (recommended)")
 	allowPath := flag.String("allowlist", "", "path to allowlist JSON file")
+	home, _ := os.UserHomeDir()
+	manifestPath := flag.String("manifest", filepath.Join(home, "bash_functions.d", "40-agents", "manifest.json"), "agent manifest whose exec ACLs are merged with the allowlist")
+	logLevel := flag.String("log-level", "info", "log level: debug, info, warn or error")
+	logFormat := flag.String("log-format", "text", "log format: text or json")
+	logFile := flag.String("log-file", "", "append logs to this file instead of stderr")
+	listen := flag.String("listen", "", "comma separated addresses to listen on instead of --port: host:port, or unix:/path for a unix socket")
+	socketMode := flag.Uint("socket-mode", 0o660, "permissions of --listen unix sockets")
+	proxyProto := flag.Bool("proxy-protocol", false, "read a PROXY protocol v1/v2 header from connections of --proxy-trust peers")
+	proxyTrust := flag.String("proxy-trust", "127.0.0.1,::1", "comma separated addresses or CIDRs of the load balancers that send PROXY headers")
+	maxAgentTime := flag.Duration("max-agent-time", 0, "total agent runtime each connection may use, unless its allowlist entry sets quota.agent_time (0 is no limit)")
+	maxShell := flag.Int("max-shell-per-hour", 0, "Shell tab commands each connection may run in an hour, unless its allowlist entry sets quota.shell_per_hour (0 is no limit)")
+	banAfter := flag.Int("ban-after", 10, "failed logins from one address within --ban-window that ban it (0 never bans)")
+	banWindow := flag.Duration("ban-window", 10*time.Minute, "period in which --ban-after failed logins ban an address")
+	banFor := flag.Duration("ban-for", 15*time.Minute, "how long a banned address is refused")
+	brokerSock := flag.String("broker-socket", "", "exec broker that issues each session a ticket naming its SSH user (needs --trust of this account in the broker)")
 	flag.Parse()
 
-	allowed, err := loadAllowlist(*allowPath)
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(*logLevel)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	var logOut io.Writer = os.Stderr
+	if *logFile != "" {
+		f, err := os.OpenFile(*logFile, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0o600)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		logOut = f
+	}
+	logOpts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler = slog.NewTextHandler(logOut, logOpts)
+	if strings.EqualFold(*logFormat, "json") {
+		handler = slog.NewJSONHandler(logOut, logOpts)
+	}
+	slog.SetDefault(slog.New(handler).With("service", "wish-server"))
+
+	defQuota := quota{ShellPerHour: *maxShell}
+	if *maxAgentTime > 0 {
+		defQuota.AgentTime = maxAgentTime.String()
+	}
+
+	allowed := &allowlist{path: *allowPath}
+	if err := allowed.load(); err != nil {
+		slog.Error("failed to load allowlist", "path", *allowPath, "err", err)
+		os.Exit(1)
+	}
+	manifest, err := loadManifestACL(*manifestPath)
 	if err != nil {
-		log.Fatalf("failed to load allowlist: %v", err)
+		slog.Error("failed to load manifest", "path", *manifestPath, "err", err)
+		os.Exit(1)
+	}
+
+	bans := newBanList(*banAfter, *banWindow, *banFor)
+	// a connection that closes without getting in is one failed login, however many
+	// keys it offered
+	auths := newAuthTracker()
+	connClosed := func(addr net.Addr) {
+		if a, failed := auths.closed(addr); failed {
+			authFailed(*allowPath, bans, a.user, addr, a.method, strings.Join(a.keys, ","))
+		}
+	}
+	// invites log in with a password or keyboard-interactive answer; a wrong one is a
+	// guess, so each counts towards bans
+	inviteAuth := func(ctx wish.Context, method, token string) bool {
+		if bans.banned(remoteIP(ctx.RemoteAddr())) {
+			return false
+		}
+		if checkInvite(ctx, *allowPath, allowed.get(), token) {
+			auths.accepted(ctx.RemoteAddr())
+			logConn(*allowPath, connEvent{Event: "invite", User: ctx.User(), Remote: remoteIP(ctx.RemoteAddr()), Method: method})
+			return true
+		}
+		authFailed(*allowPath, bans, ctx.User(), ctx.RemoteAddr(), method, "")
+		return false
 	}
 
 	// build options
@@ -82,21 +352,40 @@ func main() {
 		wish.WithMiddleware(
 			logging.Middleware(),
 			middleware.PublicKeyAuth(func(conn ssh.ConnMetadata, key ssh.PublicKey) bool {
+				if bans.banned(remoteIP(conn.RemoteAddr())) {
+					return false
+				}
 				// match key against allowlist entries
-				for _, a := range allowed {
+				for _, a := range allowed.get() {
 					if a.User == conn.User() {
-						// compare key string
-						if strings.TrimSpace(a.PubKey) == strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key))) {
+						if keyMatches(a.PubKey, key) {
+							auths.accepted(conn.RemoteAddr())
 							return true
 						}
 					}
 				}
+				// clients offer every key they have; the connection counts once when it closes
+				auths.rejected(conn.RemoteAddr(), conn.User(), "publickey", ssh.FingerprintSHA256(key))
 				return false
 			}),
-			// middleware to set allowed execs and admin flag into the session environment
+			// middleware to set allowed execs, admin and read-only flags and quotas into the session environment
 			middleware.Env(func(conn ssh.ConnMetadata, key ssh.PublicKey) map[string]string {
-				allowedExec := allowedExecForUser(conn.User(), allowed)
-				isAdmin := isAdminForUser(conn.User(), allowed)
+				entries := allowed.get()
+				allowedExec := mergeManifestExec(allowedExecForUser(conn.User(), entries), conn.User(), rolesForUser(conn.User(), entries), manifest)
+				isAdmin := isAdminForUser(conn.User(), entries)
+				readOnly := readOnlyForUser(conn.User(), entries)
+				if readOnly {
+					// nothing runs with --exec, whatever the manifest grants
+					allowedExec = nil
+				}
+				if *allowPath != "" {
+					if err := recordLogin(*allowPath, conn.User(), time.Now()); err != nil {
+						slog.Warn("cannot record login", "user", conn.User(), "err", err)
+					}
+				}
+				if key != nil {
+					logConn(*allowPath, connEvent{Event: "login", User: conn.User(), Remote: remoteIP(conn.RemoteAddr()), Method: "publickey", Detail: ssh.FingerprintSHA256(key)})
+				}
 				env := map[string]string{}
 				if len(allowedExec) > 0 {
 					env["SSH_ALLOWED_EXEC"] = strings.Join(allowedExec, ",")
@@ -106,6 +395,18 @@ func main() {
 				} else {
 					env["SSH_IS_ADMIN"] = "0"
 				}
+				if readOnly {
+					env["SSH_READ_ONLY"] = "1"
+				} else {
+					env["SSH_READ_ONLY"] = "0"
+				}
+				q := quotaForUser(conn.User(), entries, defQuota)
+				if q.AgentTime != "" {
+					env["SSH_QUOTA_AGENT_TIME"] = q.AgentTime
+				}
+				if q.ShellPerHour > 0 {
+					env["SSH_QUOTA_SHELL_PER_HOUR"] = strconv.Itoa(q.ShellPerHour)
+				}
 				// expose the authenticated username to session
 				env["SSH_USER"] = conn.User()
 				// resolve user's home directory more robustly
@@ -124,8 +425,29 @@ func main() {
 				env["SSH_PLUGIN_ENV"] = pluginEnvPath
 				return env
 			}),
+			// sessions that came in with an invite only get to submit a key
+			inviteMiddleware(*allowPath),
 		),
 	}
+	// the broker does not take SSH_USER's word for it: the session presents a ticket
+	if *brokerSock != "" {
+		opts = append(opts, wish.WithMiddleware(brokerMiddleware(*brokerSock, func(user string) bool {
+			return readOnlyForUser(user, allowed.get())
+		})))
+	}
+
+	// new users redeem an invite token as their password, or answer it when asked
+	if *allowPath != "" {
+		opts = append(opts,
+			wish.WithPasswordAuth(func(ctx wish.Context, password string) bool {
+				return inviteAuth(ctx, "password", password)
+			}),
+			wish.WithKeyboardInteractiveAuth(func(ctx wish.Context, challenger wish.KeyboardInteractiveChallenge) bool {
+				answers, err := challenger("", "Connecting with an invite", []string{"Invite token: "}, []bool{false})
+				return err == nil && len(answers) == 1 && inviteAuth(ctx, "keyboard-interactive", answers[0])
+			}),
+		)
+	}
 
 	if *hostKey != "" {
 		opts = append(opts, wish.WithHostKeyPath(*hostKey))
@@ -136,7 +458,8 @@ func main() {
 
 	srv, err := wish.NewServer(opts...)
 	if err != nil {
-		log.Fatalf("failed to create wish server: %v", err)
+		slog.Error("failed to create wish server", "err", err)
+		os.Exit(1)
 	}
 
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
@@ -144,12 +467,38 @@ func main() {
 
 	go func() {
 		<-ctx.Done()
-		log.Printf("shutting down...")
+		slog.Info("shutting down")
 		srv.Close()
 	}()
 
-	log.Printf("wish server listening on :%d", *port)
-	if err := srv.ListenAndServe(); err != nil {
-		log.Fatalf("server error: %v", err)
+	lns, err := openListeners(*listen, *port, os.FileMode(*socketMode))
+	if err != nil {
+		slog.Error("listen failed", "err", err)
+		os.Exit(1)
+	}
+	var trusted []*net.IPNet
+	if *proxyProto {
+		if trusted, err = proxyproto.ParseCIDRs(*proxyTrust); err != nil {
+			slog.Error("bad --proxy-trust", "err", err)
+			os.Exit(2)
+		}
+		slog.Info("PROXY protocol enabled", "trusted", *proxyTrust)
+	}
+
+	errc := make(chan error, len(lns))
+	for _, ln := range lns {
+		slog.Info("wish server listening", "addr", ln.Addr().String(), "network", ln.Addr().Network())
+		if *proxyProto {
+			// the real client address then reaches the logs, last logins and invites
+			ln = &proxyproto.Listener{Listener: ln, Trusted: trusted}
+		}
+		ln = &trackedListener{Listener: ln, onClose: connClosed}
+		go func(ln net.Listener) { errc <- srv.Serve(ln) }(ln)
+	}
+	for range lns {
+		if err := <-errc; err != nil && ctx.Err() == nil {
+			slog.Error("server error", "err", err)
+			os.Exit(1)
+		}
 	}
 }
@@ -0,0 +1,259 @@
+// The agents API served by `term grpc serve`. Clients authenticate with a TLS client
+// certificate whose common name is their user, as in the wish-server allowlist.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: agents.proto
+
+package agentsv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	Agents_ListAgents_FullMethodName   = "/cbw.agents.v1.Agents/ListAgents"
+	Agents_RunAgent_FullMethodName     = "/cbw.agents.v1.Agents/RunAgent"
+	Agents_StreamOutput_FullMethodName = "/cbw.agents.v1.Agents/StreamOutput"
+	Agents_GetRequest_FullMethodName   = "/cbw.agents.v1.Agents/GetRequest"
+)
+
+// AgentsClient is the client API for Agents service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type AgentsClient interface {
+	// ListAgents lists the manifest's agents and whether the caller may exec them
+	ListAgents(ctx context.Context, in *ListAgentsRequest, opts ...grpc.CallOption) (*ListAgentsResponse, error)
+	// RunAgent queues a job running the agent, as the Agents tab does
+	RunAgent(ctx context.Context, in *RunAgentRequest, opts ...grpc.CallOption) (*RunAgentResponse, error)
+	// StreamOutput sends a job's output, and with follow keeps sending until it ends
+	StreamOutput(ctx context.Context, in *StreamOutputRequest, opts ...grpc.CallOption) (Agents_StreamOutputClient, error)
+	// GetRequest returns an approval request and its history
+	GetRequest(ctx context.Context, in *GetRequestRequest, opts ...grpc.CallOption) (*Request, error)
+}
+
+type agentsClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewAgentsClient(cc grpc.ClientConnInterface) AgentsClient {
+	return &agentsClient{cc}
+}
+
+func (c *agentsClient) ListAgents(ctx context.Context, in *ListAgentsRequest, opts ...grpc.CallOption) (*ListAgentsResponse, error) {
+	out := new(ListAgentsResponse)
+	err := c.cc.Invoke(ctx, Agents_ListAgents_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *agentsClient) RunAgent(ctx context.Context, in *RunAgentRequest, opts ...grpc.CallOption) (*RunAgentResponse, error) {
+	out := new(RunAgentResponse)
+	err := c.cc.Invoke(ctx, Agents_RunAgent_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *agentsClient) StreamOutput(ctx context.Context, in *StreamOutputRequest, opts ...grpc.CallOption) (Agents_StreamOutputClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Agents_ServiceDesc.Streams[0], Agents_StreamOutput_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &agentsStreamOutputClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Agents_StreamOutputClient interface {
+	Recv() (*OutputLine, error)
+	grpc.ClientStream
+}
+
+type agentsStreamOutputClient struct {
+	grpc.ClientStream
+}
+
+func (x *agentsStreamOutputClient) Recv() (*OutputLine, error) {
+	m := new(OutputLine)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *agentsClient) GetRequest(ctx context.Context, in *GetRequestRequest, opts ...grpc.CallOption) (*Request, error) {
+	out := new(Request)
+	err := c.cc.Invoke(ctx, Agents_GetRequest_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AgentsServer is the server API for Agents service.
+// All implementations must embed UnimplementedAgentsServer
+// for forward compatibility
+type AgentsServer interface {
+	// ListAgents lists the manifest's agents and whether the caller may exec them
+	ListAgents(context.Context, *ListAgentsRequest) (*ListAgentsResponse, error)
+	// RunAgent queues a job running the agent, as the Agents tab does
+	RunAgent(context.Context, *RunAgentRequest) (*RunAgentResponse, error)
+	// StreamOutput sends a job's output, and with follow keeps sending until it ends
+	StreamOutput(*StreamOutputRequest, Agents_StreamOutputServer) error
+	// GetRequest returns an approval request and its history
+	GetRequest(context.Context, *GetRequestRequest) (*Request, error)
+	mustEmbedUnimplementedAgentsServer()
+}
+
+// UnimplementedAgentsServer must be embedded to have forward compatible implementations.
+type UnimplementedAgentsServer struct {
+}
+
+func (UnimplementedAgentsServer) ListAgents(context.Context, *ListAgentsRequest) (*ListAgentsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListAgents not implemented")
+}
+func (UnimplementedAgentsServer) RunAgent(context.Context, *RunAgentRequest) (*RunAgentResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RunAgent not implemented")
+}
+func (UnimplementedAgentsServer) StreamOutput(*StreamOutputRequest, Agents_StreamOutputServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamOutput not implemented")
+}
+func (UnimplementedAgentsServer) GetRequest(context.Context, *GetRequestRequest) (*Request, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetRequest not implemented")
+}
+func (UnimplementedAgentsServer) mustEmbedUnimplementedAgentsServer() {}
+
+// UnsafeAgentsServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to AgentsServer will
+// result in compilation errors.
+type UnsafeAgentsServer interface {
+	mustEmbedUnimplementedAgentsServer()
+}
+
+func RegisterAgentsServer(s grpc.ServiceRegistrar, srv AgentsServer) {
+	s.RegisterService(&Agents_ServiceDesc, srv)
+}
+
+func _Agents_ListAgents_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListAgentsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AgentsServer).ListAgents(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Agents_ListAgents_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentsServer).ListAgents(ctx, req.(*ListAgentsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Agents_RunAgent_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RunAgentRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AgentsServer).RunAgent(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Agents_RunAgent_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentsServer).RunAgent(ctx, req.(*RunAgentRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Agents_StreamOutput_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamOutputRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(AgentsServer).StreamOutput(m, &agentsStreamOutputServer{stream})
+}
+
+type Agents_StreamOutputServer interface {
+	Send(*OutputLine) error
+	grpc.ServerStream
+}
+
+type agentsStreamOutputServer struct {
+	grpc.ServerStream
+}
+
+func (x *agentsStreamOutputServer) Send(m *OutputLine) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Agents_GetRequest_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRequestRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AgentsServer).GetRequest(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Agents_GetRequest_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentsServer).GetRequest(ctx, req.(*GetRequestRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Agents_ServiceDesc is the grpc.ServiceDesc for Agents service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Agents_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "cbw.agents.v1.Agents",
+	HandlerType: (*AgentsServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListAgents",
+			Handler:    _Agents_ListAgents_Handler,
+		},
+		{
+			MethodName: "RunAgent",
+			Handler:    _Agents_RunAgent_Handler,
+		},
+		{
+			MethodName: "GetRequest",
+			Handler:    _Agents_GetRequest_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamOutput",
+			Handler:       _Agents_StreamOutput_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "agents.proto",
+}
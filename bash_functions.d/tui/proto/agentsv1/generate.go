@@ -0,0 +1,5 @@
+// Package agentsv1 is the Go code of proto/agents.proto, generated with
+// protoc-gen-go and protoc-gen-go-grpc; run go generate here after editing the .proto.
+package agentsv1
+
+//go:generate protoc -I .. --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative agents.proto